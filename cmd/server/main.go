@@ -5,10 +5,15 @@
 // observable microservice with the following key features:
 //
 //   - Gin framework with middleware for compression, tracing, and request context.
+//   - JWT bearer authentication (HS256 secret or RS256/ES256 JWKS).
 //   - SQLite persistence via GORM (with optional auto-migration in dev).
 //   - Pluggable semantic search index built from Markdown datasets.
 //   - OpenTelemetry instrumentation for traces and metrics.
 //   - Structured JSON logging via zerolog (with console pretty mode).
+//   - Hot reload of the knowledge corpus (file watcher, SIGHUP, admin API).
+//   - Background maintenance: purge of deleted chats once their retention
+//     has passed, idempotency GC, SQLite optimize/checkpoint and rate limiter
+//     eviction.
 //   - Graceful shutdown on SIGINT/SIGTERM with configurable timeouts.
 //   - Optional Swagger UI for API exploration.
 //
@@ -25,11 +30,11 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
@@ -46,9 +51,12 @@ import (
 
 	"github.com/tbourn/go-chat-backend/internal/config"
 	httpapi "github.com/tbourn/go-chat-backend/internal/http"
+	"github.com/tbourn/go-chat-backend/internal/http/middleware"
+	"github.com/tbourn/go-chat-backend/internal/maintenance"
 	"github.com/tbourn/go-chat-backend/internal/observability"
 	"github.com/tbourn/go-chat-backend/internal/repo"
 	"github.com/tbourn/go-chat-backend/internal/search"
+	"github.com/tbourn/go-chat-backend/internal/services"
 	"github.com/tbourn/go-chat-backend/internal/sysutil"
 
 	// swagger docs (generated by `swag init`)
@@ -87,6 +95,33 @@ var (
 // @tag.name        Messages
 // @tag.description Send messages and get assistant replies
 //
+// @tag.name        API Keys
+// @tag.description Issue and revoke API keys for server-to-server callers
+//
+// @tag.name        Workspaces
+// @tag.description Tenants isolating chats, feedback and corpora (select with X-Workspace-ID)
+//
+// @tag.name        Usage
+// @tag.description Usage quotas and per-user overrides
+//
+// @tag.name        Admin
+// @tag.description Operational endpoints (require ADMIN_TOKEN)
+//
+// @securityDefinitions.apikey BearerAuth
+// @in                         header
+// @name                       Authorization
+// @description                "Bearer <JWT>" (HS256, RS256 or ES256; see AUTH_MODE)
+//
+// @securityDefinitions.apikey AdminToken
+// @in                         header
+// @name                       Authorization
+// @description                "Bearer <ADMIN_TOKEN>"
+//
+// @securityDefinitions.apikey APIKeyAuth
+// @in                         header
+// @name                       X-API-Key
+// @description                API key issued via POST /api-keys; limited to its scopes
+//
 // @externalDocs.description Project documentation
 // @externalDocs.url         https://github.com/tbourn/go-chat-backend
 func main() {
@@ -142,28 +177,87 @@ func main() {
 		zlog.Fatal().Err(err).Msg("db migration failed")
 	}
 
-	// ---------- Search index (from data.md) ----------
+	// ---------- Search index (from data.md, hot-reloadable) ----------
 	// Prefer cfg.DataMD override, then cfg.DataPath, then sensible default.
 	dataPath := sysutil.FirstNonEmpty(cfg.DataMD, cfg.DataPath, "data/data.md")
-	mdBytes, prepErr := search.PrepareMarkdownInMemory(dataPath)
-	if prepErr != nil {
-		zlog.Warn().Err(prepErr).Str("data_path", dataPath).
-			Msg("markdown preprocess failed; indexing raw file")
-		if raw, readErr := os.ReadFile(dataPath); readErr == nil {
-			mdBytes = raw
-		} else {
-			mdBytes = []byte{}
-		}
-	}
-	idx, idxErr := search.NewIndexFromReader(
-		bytes.NewReader(mdBytes),
+	idx := search.NewReloadable(
+		func() (search.Corpus, error) { return loadCorpus(dataPath) },
 		search.WithMinParagraphRunes(1),
+		search.WithSource(filepath.Base(dataPath)),
+		search.WithScoring(search.Scoring(cfg.SearchScoring)),
+		search.WithBM25Params(cfg.BM25K1, cfg.BM25B),
 	)
-	if idxErr != nil {
+	idx.OnSwap(func(prev, next search.Version) {
+		zlog.Info().
+			Str("data_path", dataPath).
+			Uint64("corpus_seq", next.Seq).
+			Str("corpus_hash", next.Hash).
+			Str("prev_hash", prev.Hash).
+			Int("corpus_docs", next.Docs).
+			Msg("corpus index swapped")
+	})
+	if _, _, idxErr := idx.Reload(); idxErr != nil {
 		zlog.Warn().Err(idxErr).Str("data_path", dataPath).
 			Msg("index build encountered an error; bot may decline more often")
 	}
 
+	// Per-workspace corpora, loaded from CORPUS_DIR on first use.
+	var corpora *search.Registry
+	if cfg.CorpusDir != "" {
+		corpora = search.NewRegistry(cfg.CorpusDir, func(path string) *search.Reloadable {
+			r := search.NewReloadable(
+				func() (search.Corpus, error) { return loadCorpus(path) },
+				search.WithMinParagraphRunes(1),
+				search.WithSource(filepath.Base(path)),
+				search.WithScoring(search.Scoring(cfg.SearchScoring)),
+				search.WithBM25Params(cfg.BM25K1, cfg.BM25B),
+			)
+			r.OnSwap(func(_, next search.Version) {
+				zlog.Info().
+					Str("data_path", path).
+					Uint64("corpus_seq", next.Seq).
+					Str("corpus_hash", next.Hash).
+					Int("corpus_docs", next.Docs).
+					Msg("workspace corpus index swapped")
+			})
+			return r
+		})
+	}
+
+	// Reload triggers: file watcher (mtime polling) and SIGHUP.
+	reloadCtx, stopReload := context.WithCancel(context.Background())
+	defer stopReload()
+	go idx.WatchFile(reloadCtx, dataPath, cfg.CorpusWatchInterval, func(err error) {
+		zlog.Warn().Err(err).Str("data_path", dataPath).
+			Msg("corpus reload failed; previous index still serving")
+	})
+	if corpora != nil {
+		go corpora.Watch(reloadCtx, cfg.CorpusWatchInterval, func(name string, err error) {
+			zlog.Warn().Err(err).Str("corpus", name).
+				Msg("workspace corpus reload failed; previous index still serving")
+		})
+	}
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-reloadCtx.Done():
+				return
+			case <-hup:
+				if _, _, err := idx.Reload(); err != nil {
+					zlog.Warn().Err(err).Str("data_path", dataPath).
+						Msg("SIGHUP corpus reload failed; previous index still serving")
+				}
+				if corpora != nil {
+					if err := corpora.ReloadAll(); err != nil {
+						zlog.Warn().Err(err).Msg("SIGHUP workspace corpus reload failed; previous indexes still serving")
+					}
+				}
+			}
+		}
+	}()
+
 	// Similarity threshold: keep permissive default for recall if unset
 	if cfg.Threshold <= 0 {
 		cfg.Threshold = 0.10
@@ -171,20 +265,28 @@ func main() {
 
 	// ---------- Router & middleware ----------
 	r := gin.New()
-	r.Use(gzip.Gzip(gzip.DefaultCompression))
+	// Event streams are left uncompressed so each event reaches the client as
+	// soon as it is flushed (see middleware.ShouldCompress).
+	r.Use(gzip.Gzip(gzip.DefaultCompression, gzip.WithCustomShouldCompressFn(middleware.ShouldCompress)))
 
-	// Simple user identity stub
-	r.Use(func(c *gin.Context) {
-		uid := strings.TrimSpace(c.GetHeader("X-User-ID"))
-		if uid == "" {
-			uid = "demo-user"
-		}
-		c.Set("userID", uid)
-		c.Next()
-	})
+	// Wire routes (otel, auth, metrics, cors, security, api, etc. are set inside)
+	// A nil *search.Registry must reach the router as a nil interface.
+	var workspaceCorpora services.CorpusIndexes
+	if corpora != nil {
+		workspaceCorpora = corpora
+	}
+	routerJobs := httpapi.RegisterRoutes(r, db, idx, workspaceCorpora, cfg)
 
-	// Wire routes (otel, metrics, cors, security, api, etc. are set inside)
-	httpapi.RegisterRoutes(r, db, idx, cfg)
+	// ---------- Background maintenance ----------
+	mc := cfg.Maintenance
+	sched := maintenance.New(mc.Jitter, append([]maintenance.Job{
+		maintenance.IdempotencyGC(db, mc.IdempotencyGCInterval),
+		maintenance.ChatPurge(db, cfg.ChatPurgeInterval, cfg.ChatRetention),
+		maintenance.SQLiteOptimize(db, mc.SQLiteOptimizeInterval),
+	}, routerJobs...)...).WithLeases(maintenance.DBLeases(db))
+	sched.Start(context.Background())
+	defer sched.Stop()
+	zlog.Info().Strs("jobs", sched.Jobs()).Msg("maintenance scheduler started")
 
 	// Swagger UI (opt-in)
 	if cfg.SwaggerEnabled {
@@ -224,6 +326,8 @@ func main() {
 	<-quit
 
 	zlog.Info().Msg("shutdown signal received")
+	stopReload()
+	sched.Stop()
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	if err := srv.Shutdown(ctx); err != nil {
@@ -232,3 +336,16 @@ func main() {
 		zlog.Info().Msg("server shutdown complete")
 	}
 }
+
+// loadCorpus reads the Markdown corpus at path and flattens tables into
+// standalone facts. If preprocessing fails, the raw file is indexed instead.
+func loadCorpus(path string) (search.Corpus, error) {
+	b, lines, err := search.PrepareMarkdownWithLines(path)
+	if err == nil {
+		return search.Corpus{Data: b, Lines: lines}, nil
+	}
+	zlog.Warn().Err(err).Str("data_path", path).
+		Msg("markdown preprocess failed; indexing raw file")
+	b, err = os.ReadFile(path)
+	return search.Corpus{Data: b}, err
+}
@@ -0,0 +1,113 @@
+// API keys
+//
+// API keys are long-lived credentials for server-to-server callers. A key
+// looks like
+//
+//	gck_<12 hex prefix>_<43 char base64url secret>
+//
+// The "gck_<prefix>" part is stored in clear so keys can be looked up and
+// recognized in listings; the full key is only ever stored as its SHA-256
+// hash. The secret carries 256 bits of entropy, so a fast hash is enough:
+// there is nothing to brute-force that a slow KDF would protect.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// API key scopes. A key may only be used on routes requiring one of its
+// scopes; ScopeAdmin satisfies every scope.
+const (
+	// ScopeChatsRead allows listing chats and reading their messages and shares.
+	ScopeChatsRead = "chats:read"
+	// ScopeChatsWrite allows creating, renaming, deleting, restoring and sharing chats.
+	ScopeChatsWrite = "chats:write"
+	// ScopeMessagesWrite allows posting messages and leaving feedback.
+	ScopeMessagesWrite = "messages:write"
+	// ScopeAdmin grants every scope, the admin override on chats, and API
+	// key management.
+	ScopeAdmin = "admin"
+)
+
+// Scopes lists every valid API key scope.
+var Scopes = []string{ScopeChatsRead, ScopeChatsWrite, ScopeMessagesWrite, ScopeAdmin}
+
+// ErrInvalidAPIKey is returned for API keys that are malformed, unknown,
+// revoked or expired. Callers must not distinguish these cases to clients.
+var ErrInvalidAPIKey = errors.New("auth: invalid api key")
+
+const (
+	apiKeyScheme      = "gck"
+	apiKeyPrefixBytes = 6
+	apiKeySecretBytes = 32
+)
+
+// NewAPIKey generates a random API key and returns it together with its
+// public prefix ("gck_<hex>").
+func NewAPIKey() (key, prefix string, err error) {
+	buf := make([]byte, apiKeyPrefixBytes+apiKeySecretBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	prefix = apiKeyScheme + "_" + hex.EncodeToString(buf[:apiKeyPrefixBytes])
+	key = prefix + "_" + base64.RawURLEncoding.EncodeToString(buf[apiKeyPrefixBytes:])
+	return key, prefix, nil
+}
+
+// APIKeyPrefix returns the public prefix of key, or false if key is not
+// shaped like a key produced by NewAPIKey.
+func APIKeyPrefix(key string) (string, bool) {
+	scheme, rest, ok := strings.Cut(key, "_")
+	if !ok || scheme != apiKeyScheme {
+		return "", false
+	}
+	id, secret, ok := strings.Cut(rest, "_")
+	if !ok || len(id) != 2*apiKeyPrefixBytes || len(secret) != base64.RawURLEncoding.EncodedLen(apiKeySecretBytes) {
+		return "", false
+	}
+	if _, err := hex.DecodeString(id); err != nil {
+		return "", false
+	}
+	if _, err := base64.RawURLEncoding.DecodeString(secret); err != nil {
+		return "", false
+	}
+	return scheme + "_" + id, true
+}
+
+// HashAPIKey returns the hex SHA-256 of key, the form keys are stored in.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyMatches reports in constant time whether key hashes to hash.
+func APIKeyMatches(key, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashAPIKey(key)), []byte(hash)) == 1
+}
+
+// ValidScope reports whether s is one of Scopes.
+func ValidScope(s string) bool {
+	for _, v := range Scopes {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether scopes grants want, either directly or through
+// ScopeAdmin.
+func HasScope(scopes []string, want string) bool {
+	for _, s := range scopes {
+		if s == want || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
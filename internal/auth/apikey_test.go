@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewAPIKey_RoundTrip(t *testing.T) {
+	key, prefix, err := NewAPIKey()
+	if err != nil {
+		t.Fatalf("NewAPIKey: %v", err)
+	}
+	if !strings.HasPrefix(key, prefix+"_") || !strings.HasPrefix(prefix, "gck_") {
+		t.Fatalf("key %q does not start with prefix %q", key, prefix)
+	}
+	got, ok := APIKeyPrefix(key)
+	if !ok || got != prefix {
+		t.Fatalf("APIKeyPrefix = %q, %v; want %q", got, ok, prefix)
+	}
+	hash := HashAPIKey(key)
+	if len(hash) != 64 || strings.Contains(hash, prefix) {
+		t.Fatalf("unexpected hash %q", hash)
+	}
+	if !APIKeyMatches(key, hash) || APIKeyMatches(key+"x", hash) {
+		t.Fatalf("APIKeyMatches mismatch")
+	}
+
+	other, _, _ := NewAPIKey()
+	if other == key {
+		t.Fatalf("keys must be random")
+	}
+}
+
+func TestAPIKeyPrefix_Malformed(t *testing.T) {
+	key, _, _ := NewAPIKey()
+	for _, bad := range []string{
+		"",
+		"gck_",
+		strings.Replace(key, "gck_", "abc_", 1),
+		key[:len(key)-1],
+		key + "A",
+		"gck_zzzzzzzzzzzz_" + key[len(key)-43:],
+		"gck_0123456789ab_" + strings.Repeat("!", 43),
+	} {
+		if p, ok := APIKeyPrefix(bad); ok {
+			t.Errorf("APIKeyPrefix(%q) = %q; want rejection", bad, p)
+		}
+	}
+}
+
+func TestScopes(t *testing.T) {
+	for _, s := range Scopes {
+		if !ValidScope(s) {
+			t.Errorf("ValidScope(%q) = false", s)
+		}
+	}
+	if ValidScope("chats:*") {
+		t.Errorf("unknown scope accepted")
+	}
+	if !HasScope([]string{ScopeChatsRead}, ScopeChatsRead) || HasScope([]string{ScopeChatsRead}, ScopeChatsWrite) {
+		t.Errorf("HasScope: direct scope check wrong")
+	}
+	if !HasScope([]string{ScopeAdmin}, ScopeMessagesWrite) {
+		t.Errorf("HasScope: admin should grant every scope")
+	}
+	if HasScope(nil, ScopeChatsRead) {
+		t.Errorf("HasScope: empty scopes grant nothing")
+	}
+}
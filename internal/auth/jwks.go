@@ -0,0 +1,213 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	defaultJWKSRefresh = 15 * time.Minute
+	// minJWKSRetry bounds how often an unknown kid (or a failed load) can
+	// trigger another fetch, so bogus tokens cannot hammer the key server.
+	minJWKSRetry = 30 * time.Second
+	maxJWKSBytes = 1 << 20
+)
+
+// JWKS is a KeySource backed by a JSON Web Key Set read from a local file
+// (Path) or fetched over HTTP (URL). Keys are loaded on first use and
+// reloaded every RefreshInterval, or sooner when a token names an unknown
+// kid (key rotation). If a reload fails, the previous keys stay in use.
+//
+// Supported keys: RSA (RS256) and EC P-256 (ES256). Keys whose "use" is not
+// "sig" and other key types are ignored. Safe for concurrent use.
+type JWKS struct {
+	Path string // local JWKS file; takes precedence over URL
+	URL  string // remote JWKS endpoint, e.g. https://issuer/.well-known/jwks.json
+
+	RefreshInterval time.Duration // default 15m
+	HTTPClient      *http.Client  // default: 10s timeout
+
+	mu      sync.Mutex
+	keys    map[string]crypto.PublicKey
+	loaded  time.Time // last successful load
+	tried   time.Time // last load attempt
+	lastErr error
+}
+
+// Key implements KeySource.
+func (j *JWKS) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	now := time.Now()
+	refresh := j.RefreshInterval
+	if refresh <= 0 {
+		refresh = defaultJWKSRefresh
+	}
+	key, found := j.lookup(kid)
+	stale := j.keys == nil || now.Sub(j.loaded) >= refresh
+	if (stale || !found) && now.Sub(j.tried) >= minJWKSRetry {
+		j.tried = now
+		keys, err := j.load(ctx)
+		if err == nil {
+			j.keys, j.loaded, j.lastErr = keys, now, nil
+			key, found = j.lookup(kid)
+		} else {
+			j.lastErr = err
+		}
+	}
+
+	switch {
+	case found:
+		return key, nil
+	case j.keys == nil:
+		return nil, fmt.Errorf("%w: %v", ErrKeysUnavailable, j.lastErr)
+	default:
+		return nil, fmt.Errorf("%w: kid %q", ErrUnknownKey, kid)
+	}
+}
+
+// lookup finds kid in the current set; an empty kid matches a single-key set.
+func (j *JWKS) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(j.keys) == 1 {
+		for _, k := range j.keys {
+			return k, true
+		}
+	}
+	k, ok := j.keys[kid]
+	return k, ok
+}
+
+// load reads and parses the key set from Path or URL.
+func (j *JWKS) load(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if j.Path != "" {
+		data, err = os.ReadFile(j.Path)
+	} else {
+		data, err = j.fetch(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+func (j *JWKS) fetch(ctx context.Context) ([]byte, error) {
+	if j.URL == "" {
+		return nil, errors.New("no JWKS path or URL configured")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, j.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	client := j.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: HTTP %d", j.URL, resp.StatusCode)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxJWKSBytes))
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS decodes a JSON Web Key Set ({"keys": [...]}) into public keys by
+// kid. Unsupported keys are skipped; a set without any usable key is an error.
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("parse JWKS: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var (
+			pub crypto.PublicKey
+			err error
+		)
+		switch k.Kty {
+		case "RSA":
+			pub, err = k.rsa()
+		case "EC":
+			pub, err = k.ec()
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse JWKS key %q: %w", k.Kid, err)
+		}
+		keys[k.Kid] = pub
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("parse JWKS: no usable signing keys")
+	}
+	return keys, nil
+}
+
+func (k jwk) rsa() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil || len(n) == 0 {
+		return nil, errors.New("invalid modulus")
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil || len(e) == 0 || len(e) > 4 {
+		return nil, errors.New("invalid exponent")
+	}
+	exp := new(big.Int).SetBytes(e)
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exp.Int64())}, nil
+}
+
+func (k jwk) ec() (*ecdsa.PublicKey, error) {
+	if k.Crv != "P-256" {
+		return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+	}
+	x, errX := base64.RawURLEncoding.DecodeString(k.X)
+	y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+	if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+		return nil, errors.New("invalid coordinates")
+	}
+	// Reject points that are not on the curve.
+	if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+		return nil, err
+	}
+	return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+}
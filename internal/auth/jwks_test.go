@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func rsaJWK(kid string, pub *rsa.PublicKey) map[string]any {
+	return map[string]any{
+		"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256",
+		"n": base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}
+}
+
+func ecJWK(kid string, pub *ecdsa.PublicKey) map[string]any {
+	x, y := make([]byte, 32), make([]byte, 32)
+	pub.X.FillBytes(x)
+	pub.Y.FillBytes(y)
+	return map[string]any{
+		"kty": "EC", "kid": kid, "crv": "P-256",
+		"x": base64.RawURLEncoding.EncodeToString(x),
+		"y": base64.RawURLEncoding.EncodeToString(y),
+	}
+}
+
+func jwksJSON(t *testing.T, keys ...map[string]any) []byte {
+	t.Helper()
+	raw, err := json.Marshal(map[string]any{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestParseJWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	keys, err := ParseJWKS(jwksJSON(t,
+		rsaJWK("r", &rsaKey.PublicKey),
+		ecJWK("e", &ecKey.PublicKey),
+		map[string]any{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},                       // ignored type
+		map[string]any{"kty": "RSA", "kid": "enc", "use": "enc", "n": "AQAB", "e": "AQAB"}, // not for signing
+	))
+	if err != nil {
+		t.Fatalf("ParseJWKS: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("keys = %d; want 2", len(keys))
+	}
+	if pub, ok := keys["r"].(*rsa.PublicKey); !ok || !pub.Equal(&rsaKey.PublicKey) {
+		t.Fatalf("rsa key mismatch")
+	}
+	if pub, ok := keys["e"].(*ecdsa.PublicKey); !ok || !pub.Equal(&ecKey.PublicKey) {
+		t.Fatalf("ec key mismatch")
+	}
+
+	offCurve := ecJWK("bad", &ecKey.PublicKey)
+	offCurve["y"] = offCurve["x"]
+	if _, err := ParseJWKS(jwksJSON(t, offCurve)); err == nil {
+		t.Fatalf("expected error for point off the curve")
+	}
+	if _, err := ParseJWKS([]byte(`{"keys":[]}`)); err == nil {
+		t.Fatalf("expected error for empty set")
+	}
+}
+
+func TestJWKS_File(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwksJSON(t, ecJWK("only", &ecKey.PublicKey)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	v := &Verifier{Keys: &JWKS{Path: path}, Now: func() time.Time { return testNow }}
+	// A token without kid resolves to the single key of the set.
+	uid, _, err := v.Verify(context.Background(), sign(t, ES256, "", validClaims(), ecKey))
+	if err != nil || uid != "user-1" {
+		t.Fatalf("Verify = %q, %v", uid, err)
+	}
+}
+
+func TestJWKS_URL_RotationAndOutage(t *testing.T) {
+	k1, _ := rsa.GenerateKey(rand.Reader, 2048)
+	k2, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	var (
+		body  atomic.Value
+		fails atomic.Bool
+		hits  atomic.Int32
+	)
+	body.Store(jwksJSON(t, rsaJWK("k1", &k1.PublicKey)))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if fails.Load() {
+			http.Error(w, "down", http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write(body.Load().([]byte))
+	}))
+	defer srv.Close()
+
+	j := &JWKS{URL: srv.URL, RefreshInterval: time.Hour}
+	ctx := context.Background()
+	if _, err := j.Key(ctx, "k1"); err != nil {
+		t.Fatalf("initial load: %v", err)
+	}
+	if _, err := j.Key(ctx, "k1"); err != nil || hits.Load() != 1 {
+		t.Fatalf("cached lookup: err=%v hits=%d", err, hits.Load())
+	}
+
+	// Rotation: an unknown kid triggers a reload once the retry interval passed.
+	body.Store(jwksJSON(t, rsaJWK("k1", &k1.PublicKey), rsaJWK("k2", &k2.PublicKey)))
+	j.mu.Lock()
+	j.tried = j.tried.Add(-minJWKSRetry)
+	j.mu.Unlock()
+	if _, err := j.Key(ctx, "k2"); err != nil {
+		t.Fatalf("rotated key: %v", err)
+	}
+	// Unknown kids do not refetch again within the retry interval.
+	if _, err := j.Key(ctx, "k3"); !errors.Is(err, ErrUnknownKey) || hits.Load() != 2 {
+		t.Fatalf("unknown kid: err=%v hits=%d", err, hits.Load())
+	}
+
+	// Outage on refresh keeps serving the previous keys.
+	fails.Store(true)
+	j.mu.Lock()
+	j.loaded = j.loaded.Add(-2 * time.Hour)
+	j.tried = j.tried.Add(-minJWKSRetry)
+	j.mu.Unlock()
+	if _, err := j.Key(ctx, "k1"); err != nil {
+		t.Fatalf("stale keys should be kept on failure: %v", err)
+	}
+
+	// Without any keys loaded, an outage surfaces ErrKeysUnavailable.
+	down := &JWKS{URL: srv.URL}
+	if _, err := down.Key(ctx, "k1"); !errors.Is(err, ErrKeysUnavailable) {
+		t.Fatalf("err = %v; want ErrKeysUnavailable", err)
+	}
+}
@@ -0,0 +1,284 @@
+// Package auth verifies the bearer tokens that identify API callers.
+//
+// Verifier checks compact JWS tokens (JWTs) signed with:
+//
+//   - HS256, using a shared secret;
+//   - RS256 or ES256 (P-256), using public keys from a KeySource such as a
+//     JSON Web Key Set read from a file or URL (see JWKS).
+//
+// Besides the signature it validates the registered claims exp (required),
+// nbf, iss and aud, and extracts the caller's user id from a configurable
+// claim ("sub" by default). Only the standard library is used.
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Signing algorithms accepted by Verifier.
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+// DefaultUserClaim is the claim holding the user id when Verifier.UserClaim is empty.
+const DefaultUserClaim = "sub"
+
+// Verification errors. Every error returned by Verify wraps one of these.
+var (
+	ErrMalformed       = errors.New("auth: malformed token")
+	ErrAlgorithm       = errors.New("auth: unsupported signing algorithm")
+	ErrSignature       = errors.New("auth: invalid signature")
+	ErrUnknownKey      = errors.New("auth: unknown signing key")
+	ErrKeysUnavailable = errors.New("auth: signing keys unavailable")
+	ErrExpired         = errors.New("auth: token expired")
+	ErrNotYetValid     = errors.New("auth: token not valid yet")
+	ErrIssuer          = errors.New("auth: unexpected issuer")
+	ErrAudience        = errors.New("auth: unexpected audience")
+	ErrNoUser          = errors.New("auth: user claim missing")
+)
+
+// Claims is the decoded token payload. Numbers are json.Number.
+type Claims map[string]any
+
+// KeySource resolves the public key a token names in its "kid" header. An
+// empty kid asks for the only key of the set.
+type KeySource interface {
+	Key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+// Verifier validates bearer tokens. Configure at least one of Secret and Keys;
+// algorithms without a configured key are rejected, so an RS256 deployment
+// never accepts HS256 tokens and vice versa.
+type Verifier struct {
+	Secret []byte    // HS256 shared secret; empty disables HS256
+	Keys   KeySource // RS256/ES256 public keys; nil disables them
+
+	Issuer    string        // required "iss" value when set
+	Audience  string        // value that must appear in "aud" when set
+	UserClaim string        // claim carrying the user id; default "sub"
+	Leeway    time.Duration // clock skew tolerated for exp and nbf
+
+	Now func() time.Time // default time.Now
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify checks token and returns the user id and all claims.
+func (v *Verifier) Verify(ctx context.Context, token string) (string, Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", nil, ErrMalformed
+	}
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return "", nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: signature encoding", ErrMalformed)
+	}
+	if err := v.verifySignature(ctx, h, parts[0]+"."+parts[1], sig); err != nil {
+		return "", nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return "", nil, err
+	}
+	if err := v.validate(claims); err != nil {
+		return "", nil, err
+	}
+
+	name := v.UserClaim
+	if name == "" {
+		name = DefaultUserClaim
+	}
+	var user string
+	switch u := claims[name].(type) {
+	case string:
+		user = strings.TrimSpace(u)
+	case json.Number:
+		user = u.String()
+	}
+	if user == "" {
+		return "", nil, fmt.Errorf("%w: %q", ErrNoUser, name)
+	}
+	return user, claims, nil
+}
+
+// verifySignature checks sig over signed with the key selected by h.
+func (v *Verifier) verifySignature(ctx context.Context, h header, signed string, sig []byte) error {
+	switch h.Alg {
+	case HS256:
+		if len(v.Secret) == 0 {
+			return fmt.Errorf("%w: %s", ErrAlgorithm, h.Alg)
+		}
+		mac := hmac.New(sha256.New, v.Secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(sig, mac.Sum(nil)) {
+			return ErrSignature
+		}
+		return nil
+
+	case RS256, ES256:
+		if v.Keys == nil {
+			return fmt.Errorf("%w: %s", ErrAlgorithm, h.Alg)
+		}
+		key, err := v.Keys.Key(ctx, h.Kid)
+		if err != nil {
+			return err
+		}
+		digest := sha256.Sum256([]byte(signed))
+		if h.Alg == RS256 {
+			pub, ok := key.(*rsa.PublicKey)
+			if !ok {
+				return fmt.Errorf("%w: key %q is not an RSA key", ErrUnknownKey, h.Kid)
+			}
+			if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) != nil {
+				return ErrSignature
+			}
+			return nil
+		}
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || pub.Curve != elliptic.P256() {
+			return fmt.Errorf("%w: key %q is not a P-256 key", ErrUnknownKey, h.Kid)
+		}
+		// JWS encodes ES256 signatures as the fixed-size concatenation r || s.
+		if len(sig) != 64 {
+			return ErrSignature
+		}
+		r, s := new(big.Int).SetBytes(sig[:32]), new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return ErrSignature
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("%w: %q", ErrAlgorithm, h.Alg)
+	}
+}
+
+// validate checks the time-based and audience claims.
+func (v *Verifier) validate(c Claims) error {
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+
+	exp, ok, err := c.numericDate("exp")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: exp required", ErrMalformed)
+	}
+	if !now.Before(exp.Add(v.Leeway)) {
+		return ErrExpired
+	}
+	nbf, ok, err := c.numericDate("nbf")
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(v.Leeway).Before(nbf) {
+		return ErrNotYetValid
+	}
+
+	if v.Issuer != "" {
+		if iss, _ := c["iss"].(string); iss != v.Issuer {
+			return ErrIssuer
+		}
+	}
+	if v.Audience != "" && !c.hasAudience(v.Audience) {
+		return ErrAudience
+	}
+	return nil
+}
+
+// numericDate reads a NumericDate claim (seconds since the epoch).
+func (c Claims) numericDate(name string) (time.Time, bool, error) {
+	raw, ok := c[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+	n, isNum := raw.(json.Number)
+	if !isNum {
+		return time.Time{}, false, fmt.Errorf("%w: %s is not a number", ErrMalformed, name)
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("%w: %s is not a number", ErrMalformed, name)
+	}
+	sec := int64(f)
+	return time.Unix(sec, int64((f-float64(sec))*1e9)), true, nil
+}
+
+// hasAudience reports whether the "aud" claim (a string or an array of
+// strings) contains aud.
+func (c Claims) hasAudience(aud string) bool {
+	switch a := c["aud"].(type) {
+	case string:
+		return a == aud
+	case []any:
+		for _, x := range a {
+			if s, _ := x.(string); s == aud {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Has reports whether the claim name contains want. The claim may be an array
+// of strings or a single space-separated string (as OAuth "scope" claims are),
+// so both {"roles":["admin"]} and {"scope":"read admin"} match "admin".
+func (c Claims) Has(name, want string) bool {
+	switch v := c[name].(type) {
+	case string:
+		for _, f := range strings.Fields(v) {
+			if f == want {
+				return true
+			}
+		}
+	case []any:
+		for _, x := range v {
+			if s, _ := x.(string); s == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// decodeSegment base64url-decodes a token segment and unmarshals its JSON,
+// keeping numbers as json.Number.
+func decodeSegment(seg string, v any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return fmt.Errorf("%w: segment encoding", ErrMalformed)
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformed, err)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+var testNow = time.Unix(1_700_000_000, 0)
+
+// staticKeys is a KeySource over a fixed map.
+type staticKeys map[string]crypto.PublicKey
+
+func (k staticKeys) Key(_ context.Context, kid string) (crypto.PublicKey, error) {
+	if pub, ok := k[kid]; ok {
+		return pub, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+func b64(v any) string {
+	raw, _ := json.Marshal(v)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// sign builds a compact JWS for claims with alg/kid, signed by key.
+func sign(t *testing.T, alg, kid string, claims map[string]any, key any) string {
+	t.Helper()
+	hdr := map[string]any{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		hdr["kid"] = kid
+	}
+	signed := b64(hdr) + "." + b64(claims)
+	digest := sha256.Sum256([]byte(signed))
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	default:
+		t.Fatalf("unsupported key %T", key)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"sub": "user-1",
+		"iss": "https://idp.test/",
+		"aud": []string{"other", "chat-api"},
+		"exp": testNow.Add(time.Hour).Unix(),
+		"nbf": testNow.Add(-time.Minute).Unix(),
+	}
+}
+
+func with(c map[string]any, k string, v any) map[string]any {
+	if v == nil {
+		delete(c, k)
+	} else {
+		c[k] = v
+	}
+	return c
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherEC, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	v := &Verifier{
+		Secret:   secret,
+		Keys:     staticKeys{"rsa1": &rsaKey.PublicKey, "ec1": &ecKey.PublicKey},
+		Issuer:   "https://idp.test/",
+		Audience: "chat-api",
+		Leeway:   30 * time.Second,
+		Now:      func() time.Time { return testNow },
+	}
+
+	cases := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"hs256", sign(t, HS256, "", validClaims(), secret), nil},
+		{"rs256", sign(t, RS256, "rsa1", validClaims(), rsaKey), nil},
+		{"es256", sign(t, ES256, "ec1", validClaims(), ecKey), nil},
+		{"aud as string", sign(t, HS256, "", with(validClaims(), "aud", "chat-api"), secret), nil},
+		{"expired within leeway", sign(t, HS256, "", with(validClaims(), "exp", testNow.Add(-10*time.Second).Unix()), secret), nil},
+
+		{"wrong secret", sign(t, HS256, "", validClaims(), []byte("another-secret-another-secret-xx")), ErrSignature},
+		{"wrong ec key", sign(t, ES256, "ec1", validClaims(), otherEC), ErrSignature},
+		{"unknown kid", sign(t, RS256, "nope", validClaims(), rsaKey), ErrUnknownKey},
+		{"alg/key mismatch", sign(t, ES256, "rsa1", validClaims(), ecKey), ErrUnknownKey},
+		{"alg none", b64(map[string]any{"alg": "none"}) + "." + b64(validClaims()) + ".", ErrAlgorithm},
+		{"expired", sign(t, HS256, "", with(validClaims(), "exp", testNow.Add(-time.Minute).Unix()), secret), ErrExpired},
+		{"missing exp", sign(t, HS256, "", with(validClaims(), "exp", nil), secret), ErrMalformed},
+		{"not yet valid", sign(t, HS256, "", with(validClaims(), "nbf", testNow.Add(time.Minute).Unix()), secret), ErrNotYetValid},
+		{"wrong issuer", sign(t, HS256, "", with(validClaims(), "iss", "https://evil/"), secret), ErrIssuer},
+		{"wrong audience", sign(t, HS256, "", with(validClaims(), "aud", "other"), secret), ErrAudience},
+		{"missing sub", sign(t, HS256, "", with(validClaims(), "sub", nil), secret), ErrNoUser},
+		{"not a jwt", "abc.def", ErrMalformed},
+		{"bad signature encoding", "eyJhbGciOiJIUzI1NiJ9.e30.!!", ErrMalformed},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			uid, _, err := v.Verify(context.Background(), tc.token)
+			if tc.wantErr == nil {
+				if err != nil || uid != "user-1" {
+					t.Fatalf("Verify = %q, %v; want user-1", uid, err)
+				}
+				return
+			}
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("err = %v; want %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifier_AlgorithmsNeedConfiguredKeys(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	now := func() time.Time { return testNow }
+
+	// HS256 tokens are refused when only public keys are configured, so a
+	// public key can never be used as an HMAC secret.
+	pubOnly := &Verifier{Keys: staticKeys{"": &ecKey.PublicKey}, Now: now}
+	if _, _, err := pubOnly.Verify(context.Background(), sign(t, HS256, "", validClaims(), secret)); !errors.Is(err, ErrAlgorithm) {
+		t.Fatalf("HS256 without secret: err = %v", err)
+	}
+	secretOnly := &Verifier{Secret: secret, Now: now}
+	if _, _, err := secretOnly.Verify(context.Background(), sign(t, ES256, "", validClaims(), ecKey)); !errors.Is(err, ErrAlgorithm) {
+		t.Fatalf("ES256 without keys: err = %v", err)
+	}
+}
+
+func TestVerifier_UserClaim(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	v := &Verifier{Secret: secret, UserClaim: "uid", Now: func() time.Time { return testNow }}
+
+	uid, claims, err := v.Verify(context.Background(), sign(t, HS256, "", with(validClaims(), "uid", 42), secret))
+	if err != nil || uid != "42" {
+		t.Fatalf("numeric claim: uid=%q err=%v", uid, err)
+	}
+	if claims["sub"] != "user-1" {
+		t.Fatalf("claims not returned: %v", claims)
+	}
+	if _, _, err := v.Verify(context.Background(), sign(t, HS256, "", validClaims(), secret)); !errors.Is(err, ErrNoUser) {
+		t.Fatalf("missing uid: err = %v", err)
+	}
+}
+
+func TestClaims_Has(t *testing.T) {
+	c := Claims{
+		"roles": []any{"user", "admin"},
+		"scope": "chats:read admin",
+		"sub":   "admin-not-a-role",
+		"num":   json.Number("1"),
+	}
+	cases := []struct {
+		name, want string
+		ok         bool
+	}{
+		{"roles", "admin", true},
+		{"roles", "root", false},
+		{"scope", "admin", true},
+		{"scope", "chats", false},
+		{"sub", "admin", false},
+		{"num", "1", false},
+		{"missing", "admin", false},
+	}
+	for _, tc := range cases {
+		if got := c.Has(tc.name, tc.want); got != tc.ok {
+			t.Errorf("Has(%q, %q) = %v; want %v", tc.name, tc.want, got, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// Share link tokens
+//
+// A share link token grants anonymous, read-only access to one chat through
+// GET /shared/{token}. A token looks like
+//
+//	gcs_<43 char base64url secret>
+//
+// Like API keys, tokens carry 256 bits of entropy and only their SHA-256
+// hash is stored, so a leaked database does not leak working links.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	shareTokenScheme = "gcs"
+	shareTokenBytes  = 32
+)
+
+// NewShareToken generates a random share link token.
+func NewShareToken() (string, error) {
+	buf := make([]byte, shareTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return shareTokenScheme + "_" + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// ValidShareToken reports whether token is shaped like a token produced by
+// NewShareToken.
+func ValidShareToken(token string) bool {
+	secret, ok := strings.CutPrefix(token, shareTokenScheme+"_")
+	if !ok || len(secret) != base64.RawURLEncoding.EncodedLen(shareTokenBytes) {
+		return false
+	}
+	_, err := base64.RawURLEncoding.DecodeString(secret)
+	return err == nil
+}
+
+// HashShareToken returns the hex SHA-256 of token, the form tokens are
+// stored and looked up in.
+func HashShareToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,35 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestShareToken(t *testing.T) {
+	token, err := NewShareToken()
+	if err != nil {
+		t.Fatalf("NewShareToken: %v", err)
+	}
+	if !strings.HasPrefix(token, "gcs_") || !ValidShareToken(token) {
+		t.Fatalf("token %q rejected", token)
+	}
+	if other, _ := NewShareToken(); other == token {
+		t.Fatalf("tokens must be random")
+	}
+	if h := HashShareToken(token); len(h) != 64 || h == HashShareToken(token+"x") {
+		t.Fatalf("unexpected hash %q", h)
+	}
+
+	for _, bad := range []string{
+		"",
+		"gcs_",
+		strings.Replace(token, "gcs_", "gck_", 1),
+		token[:len(token)-1],
+		token + "A",
+		"gcs_" + strings.Repeat("!", 43),
+	} {
+		if ValidShareToken(bad) {
+			t.Errorf("ValidShareToken(%q) = true", bad)
+		}
+	}
+}
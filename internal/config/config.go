@@ -31,6 +31,78 @@ type OTELConfig struct {
 	SampleRatio float64 // OTEL_TRACES_SAMPLER_ARG in [0..1]
 }
 
+// GeneratorConfig selects the answer generator and configures the
+// OpenAI-compatible backend.
+type GeneratorConfig struct {
+	Kind           string        // GENERATOR: extractive|openai
+	BaseURL        string        // LLM_BASE_URL (e.g. "https://api.openai.com/v1")
+	APIKey         string        // LLM_API_KEY (optional for local servers)
+	Model          string        // LLM_MODEL
+	Timeout        time.Duration // LLM_TIMEOUT, per attempt
+	MaxRetries     int           // LLM_MAX_RETRIES (>= 0)
+	MaxTokens      int           // LLM_MAX_TOKENS, completion cap (>= 0; 0 = server default)
+	MaxInputTokens int           // LLM_MAX_INPUT_TOKENS, prompt budget (>= 0; 0 = unlimited)
+	Temperature    float64       // LLM_TEMPERATURE [0,2]
+}
+
+// AuthConfig selects how API callers are identified.
+//
+// In "jwt" mode every API request must carry "Authorization: Bearer <jwt>"
+// signed with the HS256 secret or a key from the JWKS file/URL. "header"
+// mode trusts X-User-ID and is only accepted with GIN_MODE=debug or test.
+type AuthConfig struct {
+	Mode        string        // AUTH_MODE: jwt|header
+	JWTSecret   string        // JWT_HS256_SECRET, shared HS256 secret (>= 32 bytes)
+	JWKSFile    string        // JWT_JWKS_FILE, local JWKS with RS256/ES256 keys
+	JWKSURL     string        // JWT_JWKS_URL, remote JWKS (exclusive with JWT_JWKS_FILE)
+	JWKSRefresh time.Duration // JWT_JWKS_REFRESH, key set reload interval (> 0)
+	Issuer      string        // JWT_ISSUER, required "iss" when set
+	Audience    string        // JWT_AUDIENCE, required "aud" entry when set
+	UserClaim   string        // JWT_USER_CLAIM, claim mapped to the user id
+	Leeway      time.Duration // JWT_LEEWAY, clock skew for exp/nbf (>= 0)
+	RolesClaim  string        // JWT_ROLES_CLAIM, claim listing the caller's roles
+	AdminRole   string        // JWT_ADMIN_ROLE, role that may access every chat ("" = off)
+}
+
+// RateStoreConfig selects where rate-limit buckets live. "memory" limits per
+// process; "redis" shares limits across replicas; "sqlite" keeps them in the
+// application database across restarts of a single node.
+type RateStoreConfig struct {
+	Kind          string        // RATE_STORE, memory|redis|sqlite
+	RedisAddr     string        // RATE_REDIS_ADDR, host:port (required for redis)
+	RedisPassword string        // RATE_REDIS_PASSWORD, AUTH password
+	RedisDB       int           // RATE_REDIS_DB, logical database (>= 0)
+	Timeout       time.Duration // RATE_STORE_TIMEOUT, per call before falling back to local limits
+}
+
+// QuotaLimits caps usage per calendar day and month. Zero means unlimited.
+type QuotaLimits struct {
+	MessagesPerDay   int // *_MESSAGES_DAILY, posted prompts per day
+	MessagesPerMonth int // *_MESSAGES_MONTHLY, posted prompts per month
+	ChatsPerDay      int // *_CHATS_DAILY, created chats per day
+	ChatsPerMonth    int // *_CHATS_MONTHLY, created chats per month
+}
+
+// QuotaConfig defines the persistent usage quotas. Per-user limits count a
+// user's usage across workspaces (QUOTA_USER_*); workspace limits count all
+// members of each non-default workspace (QUOTA_WORKSPACE_*).
+type QuotaConfig struct {
+	Timezone  string         // QUOTA_TIMEZONE, IANA zone whose midnight resets quotas
+	Location  *time.Location // loaded from Timezone by Load
+	User      QuotaLimits    // QUOTA_USER_*
+	Workspace QuotaLimits    // QUOTA_WORKSPACE_*
+}
+
+// MaintenanceConfig schedules the background maintenance jobs (see package
+// maintenance). A zero interval disables a job; the deleted-chat purge runs
+// every ChatPurgeInterval.
+type MaintenanceConfig struct {
+	IdempotencyGCInterval  time.Duration // IDEMPOTENCY_GC_INTERVAL, delete expired idempotency records
+	SQLiteOptimizeInterval time.Duration // SQLITE_OPTIMIZE_INTERVAL, PRAGMA optimize and WAL checkpoint
+	RateEvictInterval      time.Duration // RATE_EVICT_INTERVAL, drop idle rate-limit buckets
+	Jitter                 float64       // MAINTENANCE_JITTER, share of each interval randomized, in [0,1]
+}
+
 // Config holds all configuration values for the application.
 type Config struct {
 	// Server
@@ -40,6 +112,7 @@ type Config struct {
 	WriteTimeout      time.Duration // e.g. 20s
 	IdleTimeout       time.Duration // e.g. 60s
 	MaxHeaderBytes    int           // bytes
+	ImportMaxBytes    int64         // IMPORT_MAX_BYTES, body cap of chat imports (others: 1 MiB)
 	GinMode           string        // debug|release|test
 
 	// Logging / Docs
@@ -54,9 +127,37 @@ type Config struct {
 	DataMD    string  // optional override for DataPath
 	Threshold float64 // retrieval confidence threshold [0,1]
 
+	// Search
+	SearchScoring string  // jaccard|bm25
+	BM25K1        float64 // BM25 term-frequency saturation (>= 0)
+	BM25B         float64 // BM25 length normalization [0,1]
+
+	// Answer generation
+	Generator    GeneratorConfig
+	HistoryTurns int // earlier chat messages used as context for follow-ups (>= 0)
+
+	// Corpus hot reload
+	CorpusWatchInterval time.Duration // poll DATA_MD/DATA_PATH mtime; 0 disables
+
+	// Workspaces
+	CorpusDir string // directory holding per-workspace corpora; "" disables them
+
+	// Authentication
+	Auth AuthConfig
+
+	// Admin
+	AdminToken string // bearer token for /admin endpoints; empty disables them
+
 	// Rate limiting
-	RateRPS   float64 // tokens per second (>= 0)
-	RateBurst int     // bucket size (>= 1)
+	RateRPS         float64 // tokens per second (>= 0)
+	RateBurst       int     // bucket size (>= 1)
+	RateMessageCost int     // tokens per posted message, from separate buckets (1..RATE_BURST)
+	SharedRateRPS   float64 // SHARED_RATE_RPS, public share link reads per second and IP (>= 0)
+	SharedRateBurst int     // SHARED_RATE_BURST, bucket size of public share link reads (>= 1)
+	RateStore       RateStoreConfig
+
+	// Usage quotas
+	Quota QuotaConfig
 
 	// Web protection
 	CORS     CORSConfig
@@ -65,6 +166,17 @@ type Config struct {
 	// Idempotency
 	IdempotencyTTL time.Duration // how long a given Idempotency-Key is valid
 
+	// Pagination
+	CursorSecret string // CURSOR_SECRET, HMAC key of pagination cursors (>= 32 bytes; random per process when empty)
+
+	// Chat deletion
+	ChatRestoreWindow time.Duration // how long a deleted chat can be restored (> 0)
+	ChatRetention     time.Duration // when deleted chats are purged (>= ChatRestoreWindow)
+	ChatPurgeInterval time.Duration // how often the purger runs; 0 disables it
+
+	// Background maintenance
+	Maintenance MaintenanceConfig
+
 	// Observability
 	OTEL OTELConfig
 }
@@ -89,6 +201,7 @@ func Load() (Config, error) {
 		WriteTimeout:      getdur("WRITE_TIMEOUT", 20*time.Second),
 		IdleTimeout:       getdur("IDLE_TIMEOUT", 60*time.Second),
 		MaxHeaderBytes:    getint("MAX_HEADER_BYTES", 1<<20),
+		ImportMaxBytes:    int64(getint("IMPORT_MAX_BYTES", 32<<20)),
 		GinMode:           strings.ToLower(getenv("GIN_MODE", "release")),
 
 		// Logging / Docs
@@ -103,9 +216,69 @@ func Load() (Config, error) {
 		DataMD:    getenv("DATA_MD", ""),
 		Threshold: getfloat("THRESHOLD", 0.32),
 
+		// Search
+		SearchScoring: strings.ToLower(getenv("SEARCH_SCORING", "jaccard")),
+		BM25K1:        getfloat("BM25_K1", 1.2),
+		BM25B:         getfloat("BM25_B", 0.75),
+
+		// Answer generation
+		Generator: GeneratorConfig{
+			Kind:           strings.ToLower(getenv("GENERATOR", "extractive")),
+			BaseURL:        getenv("LLM_BASE_URL", "https://api.openai.com/v1"),
+			APIKey:         strings.TrimSpace(getenv("LLM_API_KEY", "")),
+			Model:          strings.TrimSpace(getenv("LLM_MODEL", "")),
+			Timeout:        getdur("LLM_TIMEOUT", 15*time.Second),
+			MaxRetries:     getint("LLM_MAX_RETRIES", 2),
+			MaxTokens:      getint("LLM_MAX_TOKENS", 512),
+			MaxInputTokens: getint("LLM_MAX_INPUT_TOKENS", 3000),
+			Temperature:    getfloat("LLM_TEMPERATURE", 0.2),
+		},
+		HistoryTurns: getint("HISTORY_TURNS", 6),
+
+		// Corpus hot reload
+		CorpusWatchInterval: getdur("CORPUS_WATCH_INTERVAL", 30*time.Second),
+
+		// Workspaces
+		CorpusDir: strings.TrimSpace(getenv("CORPUS_DIR", "data")),
+
+		// Authentication
+		Auth: AuthConfig{
+			Mode:        strings.ToLower(strings.TrimSpace(getenv("AUTH_MODE", "jwt"))),
+			JWTSecret:   getenv("JWT_HS256_SECRET", ""),
+			JWKSFile:    strings.TrimSpace(getenv("JWT_JWKS_FILE", "")),
+			JWKSURL:     strings.TrimSpace(getenv("JWT_JWKS_URL", "")),
+			JWKSRefresh: getdur("JWT_JWKS_REFRESH", 15*time.Minute),
+			Issuer:      strings.TrimSpace(getenv("JWT_ISSUER", "")),
+			Audience:    strings.TrimSpace(getenv("JWT_AUDIENCE", "")),
+			UserClaim:   strings.TrimSpace(getenv("JWT_USER_CLAIM", "sub")),
+			Leeway:      getdur("JWT_LEEWAY", 30*time.Second),
+			RolesClaim:  strings.TrimSpace(getenv("JWT_ROLES_CLAIM", "roles")),
+			AdminRole:   strings.TrimSpace(getenv("JWT_ADMIN_ROLE", "")),
+		},
+
+		// Admin
+		AdminToken: strings.TrimSpace(getenv("ADMIN_TOKEN", "")),
+
 		// Rate limiting
-		RateRPS:   getfloat("RATE_RPS", 5.0),
-		RateBurst: getint("RATE_BURST", 10),
+		RateRPS:         getfloat("RATE_RPS", 5.0),
+		RateBurst:       getint("RATE_BURST", 10),
+		RateMessageCost: getint("RATE_MESSAGE_COST", 5),
+		SharedRateRPS:   getfloat("SHARED_RATE_RPS", 1.0),
+		SharedRateBurst: getint("SHARED_RATE_BURST", 10),
+		RateStore: RateStoreConfig{
+			Kind:          strings.ToLower(strings.TrimSpace(getenv("RATE_STORE", "memory"))),
+			RedisAddr:     strings.TrimSpace(getenv("RATE_REDIS_ADDR", "")),
+			RedisPassword: getenv("RATE_REDIS_PASSWORD", ""),
+			RedisDB:       getint("RATE_REDIS_DB", 0),
+			Timeout:       getdur("RATE_STORE_TIMEOUT", 50*time.Millisecond),
+		},
+
+		// Usage quotas
+		Quota: QuotaConfig{
+			Timezone:  strings.TrimSpace(getenv("QUOTA_TIMEZONE", "UTC")),
+			User:      getQuotaLimits("QUOTA_USER_"),
+			Workspace: getQuotaLimits("QUOTA_WORKSPACE_"),
+		},
 
 		// Web protection
 		CORS: CORSConfig{
@@ -119,6 +292,22 @@ func Load() (Config, error) {
 		// Idempotency
 		IdempotencyTTL: getdur("IDEMPOTENCY_TTL", 24*time.Hour),
 
+		// Pagination
+		CursorSecret: getenv("CURSOR_SECRET", ""),
+
+		// Chat deletion
+		ChatRestoreWindow: getdur("CHAT_RESTORE_WINDOW", 7*24*time.Hour),
+		ChatRetention:     getdur("CHAT_RETENTION", 30*24*time.Hour),
+		ChatPurgeInterval: getdur("CHAT_PURGE_INTERVAL", time.Hour),
+
+		// Background maintenance
+		Maintenance: MaintenanceConfig{
+			IdempotencyGCInterval:  getdur("IDEMPOTENCY_GC_INTERVAL", 10*time.Minute),
+			SQLiteOptimizeInterval: getdur("SQLITE_OPTIMIZE_INTERVAL", 6*time.Hour),
+			RateEvictInterval:      getdur("RATE_EVICT_INTERVAL", 5*time.Minute),
+			Jitter:                 getfloat("MAINTENANCE_JITTER", 0.1),
+		},
+
 		// Observability (OpenTelemetry)
 		OTEL: OTELConfig{
 			Enabled:     getbool("OTEL_ENABLED", false),
@@ -154,6 +343,9 @@ func Load() (Config, error) {
 	if cfg.MaxHeaderBytes <= 0 {
 		return cfg, errors.New("MAX_HEADER_BYTES must be > 0")
 	}
+	if cfg.ImportMaxBytes <= 0 {
+		return cfg, errors.New("IMPORT_MAX_BYTES must be > 0")
+	}
 	if strings.TrimSpace(cfg.DBPath) == "" {
 		return cfg, errors.New("DB_PATH must not be empty")
 	}
@@ -163,21 +355,101 @@ func Load() (Config, error) {
 	if cfg.Threshold < 0 || cfg.Threshold > 1 {
 		return cfg, errors.New("THRESHOLD must be between 0 and 1")
 	}
+	switch cfg.SearchScoring {
+	case "jaccard", "bm25":
+	default:
+		return cfg, errors.New("SEARCH_SCORING must be one of: jaccard, bm25")
+	}
+	if cfg.BM25K1 < 0 {
+		return cfg, errors.New("BM25_K1 must be >= 0")
+	}
+	if cfg.BM25B < 0 || cfg.BM25B > 1 {
+		return cfg, errors.New("BM25_B must be between 0 and 1")
+	}
+	switch cfg.Generator.Kind {
+	case "extractive":
+	case "openai":
+		if strings.TrimSpace(cfg.Generator.BaseURL) == "" || cfg.Generator.Model == "" {
+			return cfg, errors.New("LLM_BASE_URL and LLM_MODEL are required when GENERATOR=openai")
+		}
+	default:
+		return cfg, errors.New("GENERATOR must be one of: extractive, openai")
+	}
+	if cfg.Generator.Timeout <= 0 {
+		return cfg, errors.New("LLM_TIMEOUT must be > 0")
+	}
+	if cfg.Generator.MaxRetries < 0 || cfg.Generator.MaxTokens < 0 || cfg.Generator.MaxInputTokens < 0 {
+		return cfg, errors.New("LLM_MAX_RETRIES, LLM_MAX_TOKENS and LLM_MAX_INPUT_TOKENS must be >= 0")
+	}
+	if cfg.HistoryTurns < 0 {
+		return cfg, errors.New("HISTORY_TURNS must be >= 0")
+	}
+	if cfg.Generator.Temperature < 0 || cfg.Generator.Temperature > 2 {
+		return cfg, errors.New("LLM_TEMPERATURE must be between 0 and 2")
+	}
+	if cfg.CorpusWatchInterval < 0 {
+		return cfg, errors.New("CORPUS_WATCH_INTERVAL must be >= 0")
+	}
 	if cfg.RateRPS < 0 {
 		return cfg, errors.New("RATE_RPS must be >= 0")
 	}
 	if cfg.RateBurst < 1 {
 		return cfg, errors.New("RATE_BURST must be >= 1")
 	}
+	if cfg.RateMessageCost < 1 || cfg.RateMessageCost > cfg.RateBurst {
+		return cfg, errors.New("RATE_MESSAGE_COST must be between 1 and RATE_BURST")
+	}
+	if cfg.SharedRateRPS < 0 {
+		return cfg, errors.New("SHARED_RATE_RPS must be >= 0")
+	}
+	if cfg.SharedRateBurst < 1 {
+		return cfg, errors.New("SHARED_RATE_BURST must be >= 1")
+	}
+	switch cfg.RateStore.Kind {
+	case "memory", "sqlite":
+	case "redis":
+		if cfg.RateStore.RedisAddr == "" {
+			return cfg, errors.New("RATE_REDIS_ADDR is required when RATE_STORE=redis")
+		}
+	default:
+		return cfg, errors.New("RATE_STORE must be one of: memory, redis, sqlite")
+	}
+	if cfg.RateStore.RedisDB < 0 {
+		return cfg, errors.New("RATE_REDIS_DB must be >= 0")
+	}
+	if cfg.RateStore.Timeout <= 0 {
+		return cfg, errors.New("RATE_STORE_TIMEOUT must be > 0")
+	}
+	if err := validateQuota(&cfg.Quota); err != nil {
+		return cfg, err
+	}
 	if cfg.Security.HSTSMaxAge < 0 {
 		return cfg, errors.New("HSTS_MAX_AGE must be >= 0")
 	}
 	if cfg.IdempotencyTTL <= 0 {
 		return cfg, errors.New("IDEMPOTENCY_TTL must be > 0")
 	}
+	if cfg.CursorSecret != "" && len(cfg.CursorSecret) < 32 {
+		return cfg, errors.New("CURSOR_SECRET must be at least 32 bytes")
+	}
+	if cfg.ChatRestoreWindow <= 0 {
+		return cfg, errors.New("CHAT_RESTORE_WINDOW must be > 0")
+	}
+	if cfg.ChatRetention < cfg.ChatRestoreWindow {
+		return cfg, errors.New("CHAT_RETENTION must be >= CHAT_RESTORE_WINDOW")
+	}
+	if cfg.ChatPurgeInterval < 0 {
+		return cfg, errors.New("CHAT_PURGE_INTERVAL must be >= 0")
+	}
+	if err := validateMaintenance(cfg.Maintenance); err != nil {
+		return cfg, err
+	}
 	if cfg.OTEL.SampleRatio < 0 || cfg.OTEL.SampleRatio > 1 {
 		return cfg, errors.New("OTEL_TRACES_SAMPLER_ARG must be in [0,1]")
 	}
+	if err := validateAuth(cfg.Auth, cfg.GinMode); err != nil {
+		return cfg, err
+	}
 	// if cfg.APIBasePath == "" || cfg.APIBasePath[0] != '/' {
 	// 	return cfg, errors.New("API_BASE_PATH must start with '/'")
 	// }
@@ -185,8 +457,85 @@ func Load() (Config, error) {
 	return cfg, nil
 }
 
+// validateMaintenance checks the maintenance job settings.
+func validateMaintenance(m MaintenanceConfig) error {
+	switch {
+	case m.IdempotencyGCInterval < 0:
+		return errors.New("IDEMPOTENCY_GC_INTERVAL must be >= 0")
+	case m.SQLiteOptimizeInterval < 0:
+		return errors.New("SQLITE_OPTIMIZE_INTERVAL must be >= 0")
+	case m.RateEvictInterval < 0:
+		return errors.New("RATE_EVICT_INTERVAL must be >= 0")
+	case m.Jitter < 0 || m.Jitter > 1:
+		return errors.New("MAINTENANCE_JITTER must be in [0,1]")
+	}
+	return nil
+}
+
+// validateAuth checks the authentication settings. Header mode is refused
+// outside debug/test so it cannot be enabled in production by accident.
+func validateAuth(a AuthConfig, ginMode string) error {
+	switch a.Mode {
+	case "header":
+		if ginMode != "debug" && ginMode != "test" {
+			return errors.New("AUTH_MODE=header is for local development only (requires GIN_MODE=debug or test)")
+		}
+		return nil
+	case "jwt":
+	default:
+		return errors.New("AUTH_MODE must be one of: jwt, header")
+	}
+	if a.JWTSecret == "" && a.JWKSFile == "" && a.JWKSURL == "" {
+		return errors.New("AUTH_MODE=jwt requires JWT_HS256_SECRET, JWT_JWKS_FILE or JWT_JWKS_URL")
+	}
+	if a.JWTSecret != "" && len(a.JWTSecret) < 32 {
+		return errors.New("JWT_HS256_SECRET must be at least 32 bytes")
+	}
+	if a.JWKSFile != "" && a.JWKSURL != "" {
+		return errors.New("JWT_JWKS_FILE and JWT_JWKS_URL are mutually exclusive")
+	}
+	if a.JWKSRefresh <= 0 {
+		return errors.New("JWT_JWKS_REFRESH must be > 0")
+	}
+	if a.UserClaim == "" {
+		return errors.New("JWT_USER_CLAIM must not be empty")
+	}
+	if a.Leeway < 0 {
+		return errors.New("JWT_LEEWAY must be >= 0")
+	}
+	if a.AdminRole != "" && a.RolesClaim == "" {
+		return errors.New("JWT_ROLES_CLAIM must not be empty when JWT_ADMIN_ROLE is set")
+	}
+	return nil
+}
+
+// validateQuota checks the quota limits and loads the quota time zone.
+func validateQuota(q *QuotaConfig) error {
+	loc, err := time.LoadLocation(q.Timezone)
+	if err != nil {
+		return errors.New("QUOTA_TIMEZONE must be a valid IANA time zone (e.g. UTC, Europe/Athens)")
+	}
+	q.Location = loc
+	for _, l := range []QuotaLimits{q.User, q.Workspace} {
+		if l.MessagesPerDay < 0 || l.MessagesPerMonth < 0 || l.ChatsPerDay < 0 || l.ChatsPerMonth < 0 {
+			return errors.New("QUOTA_USER_* and QUOTA_WORKSPACE_* limits must be >= 0")
+		}
+	}
+	return nil
+}
+
 // ---- helpers (no external deps) ----
 
+// getQuotaLimits reads the four quota limits sharing prefix.
+func getQuotaLimits(prefix string) QuotaLimits {
+	return QuotaLimits{
+		MessagesPerDay:   getint(prefix+"MESSAGES_DAILY", 0),
+		MessagesPerMonth: getint(prefix+"MESSAGES_MONTHLY", 0),
+		ChatsPerDay:      getint(prefix+"CHATS_DAILY", 0),
+		ChatsPerMonth:    getint(prefix+"CHATS_MONTHLY", 0),
+	}
+}
+
 func getenv(k, def string) string {
 	if v, ok := os.LookupEnv(k); ok && v != "" {
 		return v
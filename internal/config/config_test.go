@@ -31,6 +31,7 @@ func TestLoad_Success_DefaultsAndOverrides(t *testing.T) {
 	t.Setenv("WRITE_TIMEOUT", "3s")
 	t.Setenv("IDLE_TIMEOUT", "4s")
 	t.Setenv("MAX_HEADER_BYTES", "8192")
+	t.Setenv("IMPORT_MAX_BYTES", "4096")
 	t.Setenv("GIN_MODE", "weird") // will normalize to "release"
 
 	// Logging / Docs
@@ -45,9 +46,53 @@ func TestLoad_Success_DefaultsAndOverrides(t *testing.T) {
 	t.Setenv("DATA_MD", "override.md")
 	t.Setenv("THRESHOLD", "0.5")
 
+	// Search
+	t.Setenv("SEARCH_SCORING", "BM25")
+	t.Setenv("BM25_K1", "1.5")
+	t.Setenv("BM25_B", "0.6")
+	t.Setenv("CORPUS_WATCH_INTERVAL", "5s")
+
+	// Answer generation
+	t.Setenv("GENERATOR", "OpenAI")
+	t.Setenv("LLM_BASE_URL", "http://llm:8000/v1")
+	t.Setenv("LLM_API_KEY", " sk-x ")
+	t.Setenv("LLM_MODEL", "llama3")
+	t.Setenv("LLM_TIMEOUT", "7s")
+	t.Setenv("LLM_MAX_RETRIES", "0")
+	t.Setenv("LLM_MAX_TOKENS", "128")
+	t.Setenv("LLM_MAX_INPUT_TOKENS", "1000")
+	t.Setenv("LLM_TEMPERATURE", "0")
+	t.Setenv("HISTORY_TURNS", "4")
+	t.Setenv("ADMIN_TOKEN", "  s3cret ")
+
+	// Authentication
+	t.Setenv("AUTH_MODE", " JWT ")
+	t.Setenv("JWT_JWKS_URL", " https://idp.example/jwks.json ")
+	t.Setenv("JWT_JWKS_REFRESH", "5m")
+	t.Setenv("JWT_ISSUER", "https://idp.example/")
+	t.Setenv("JWT_AUDIENCE", "chat-api")
+	t.Setenv("JWT_USER_CLAIM", "uid")
+	t.Setenv("JWT_LEEWAY", "10s")
+	t.Setenv("JWT_ROLES_CLAIM", " groups ")
+	t.Setenv("JWT_ADMIN_ROLE", " chat-admin ")
+
 	// Rate limiting (use invalids for parse to fall back to defaults)
 	t.Setenv("RATE_RPS", "x")      // -> default 5.0
 	t.Setenv("RATE_BURST", "nope") // -> default 10
+	t.Setenv("RATE_MESSAGE_COST", "3")
+	t.Setenv("SHARED_RATE_RPS", "0.5")
+	t.Setenv("SHARED_RATE_BURST", "4")
+	t.Setenv("RATE_STORE", " Redis ")
+	t.Setenv("RATE_REDIS_ADDR", " redis:6379 ")
+	t.Setenv("RATE_REDIS_PASSWORD", "pw")
+	t.Setenv("RATE_REDIS_DB", "2")
+	t.Setenv("RATE_STORE_TIMEOUT", "20ms")
+
+	// Usage quotas
+	t.Setenv("QUOTA_TIMEZONE", " Europe/Athens ")
+	t.Setenv("QUOTA_USER_MESSAGES_DAILY", "50")
+	t.Setenv("QUOTA_USER_CHATS_MONTHLY", "20")
+	t.Setenv("QUOTA_WORKSPACE_MESSAGES_MONTHLY", "5000")
 
 	// Web protection
 	t.Setenv("CORS_ALLOWED_ORIGINS", " https://a.com , , http://b ")
@@ -57,6 +102,20 @@ func TestLoad_Success_DefaultsAndOverrides(t *testing.T) {
 	// Idempotency
 	t.Setenv("IDEMPOTENCY_TTL", "48h")
 
+	// Chat deletion
+	t.Setenv("CHAT_RESTORE_WINDOW", "24h")
+	t.Setenv("CHAT_RETENTION", "72h")
+	t.Setenv("CHAT_PURGE_INTERVAL", "0s")
+
+	// Maintenance
+	t.Setenv("IDEMPOTENCY_GC_INTERVAL", "1m")
+	t.Setenv("SQLITE_OPTIMIZE_INTERVAL", "0s")
+	t.Setenv("RATE_EVICT_INTERVAL", "30s")
+	t.Setenv("MAINTENANCE_JITTER", "0.25")
+
+	// Pagination
+	t.Setenv("CURSOR_SECRET", "0123456789abcdef0123456789abcdef")
+
 	// OTEL
 	t.Setenv("OTEL_ENABLED", "1")
 	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "otel:4317")
@@ -76,6 +135,7 @@ func TestLoad_Success_DefaultsAndOverrides(t *testing.T) {
 		cfg.WriteTimeout != 3*time.Second ||
 		cfg.IdleTimeout != 4*time.Second ||
 		cfg.MaxHeaderBytes != 8192 ||
+		cfg.ImportMaxBytes != 4096 ||
 		cfg.GinMode != "release" {
 		t.Fatalf("server fields unexpected: %+v", cfg)
 	}
@@ -90,10 +150,47 @@ func TestLoad_Success_DefaultsAndOverrides(t *testing.T) {
 		t.Fatalf("app fields unexpected: %+v", cfg)
 	}
 
+	// Search
+	if cfg.SearchScoring != "bm25" || cfg.BM25K1 != 1.5 || cfg.BM25B != 0.6 {
+		t.Fatalf("search fields unexpected: %+v", cfg)
+	}
+	if cfg.CorpusWatchInterval != 5*time.Second || cfg.AdminToken != "s3cret" {
+		t.Fatalf("reload/admin fields unexpected: %+v", cfg)
+	}
+
+	// Answer generation
+	if want := (GeneratorConfig{
+		Kind: "openai", BaseURL: "http://llm:8000/v1", APIKey: "sk-x", Model: "llama3", Timeout: 7 * time.Second,
+		MaxRetries: 0, MaxTokens: 128, MaxInputTokens: 1000, Temperature: 0,
+	}); cfg.Generator != want || cfg.HistoryTurns != 4 {
+		t.Fatalf("generator unexpected: %+v history=%d", cfg.Generator, cfg.HistoryTurns)
+	}
+
+	// Authentication
+	if want := (AuthConfig{
+		Mode: "jwt", JWKSURL: "https://idp.example/jwks.json", JWKSRefresh: 5 * time.Minute,
+		Issuer: "https://idp.example/", Audience: "chat-api", UserClaim: "uid", Leeway: 10 * time.Second,
+		RolesClaim: "groups", AdminRole: "chat-admin",
+	}); cfg.Auth != want {
+		t.Fatalf("auth unexpected: %+v", cfg.Auth)
+	}
+
 	// Rate limiting (parse fallback to defaults)
-	if cfg.RateRPS != 5.0 || cfg.RateBurst != 10 {
+	if cfg.RateRPS != 5.0 || cfg.RateBurst != 10 || cfg.RateMessageCost != 3 || cfg.SharedRateRPS != 0.5 || cfg.SharedRateBurst != 4 {
 		t.Fatalf("rate limiting unexpected: %+v", cfg)
 	}
+	if want := (RateStoreConfig{
+		Kind: "redis", RedisAddr: "redis:6379", RedisPassword: "pw", RedisDB: 2, Timeout: 20 * time.Millisecond,
+	}); cfg.RateStore != want {
+		t.Fatalf("rate store unexpected: %+v", cfg.RateStore)
+	}
+
+	// Usage quotas
+	if cfg.Quota.Timezone != "Europe/Athens" || cfg.Quota.Location == nil || cfg.Quota.Location.String() != "Europe/Athens" ||
+		cfg.Quota.User != (QuotaLimits{MessagesPerDay: 50, ChatsPerMonth: 20}) ||
+		cfg.Quota.Workspace != (QuotaLimits{MessagesPerMonth: 5000}) {
+		t.Fatalf("quota unexpected: %+v", cfg.Quota)
+	}
 
 	// Web protection
 	if !reflect.DeepEqual(cfg.CORS.AllowedOrigins, []string{"https://a.com", "http://b"}) {
@@ -108,6 +205,19 @@ func TestLoad_Success_DefaultsAndOverrides(t *testing.T) {
 		t.Fatalf("idempotency ttl unexpected: %v", cfg.IdempotencyTTL)
 	}
 
+	// Chat deletion
+	if cfg.ChatRestoreWindow != 24*time.Hour || cfg.ChatRetention != 72*time.Hour || cfg.ChatPurgeInterval != 0 {
+		t.Fatalf("chat deletion unexpected: window=%v retention=%v interval=%v", cfg.ChatRestoreWindow, cfg.ChatRetention, cfg.ChatPurgeInterval)
+	}
+	if m := cfg.Maintenance; m.IdempotencyGCInterval != time.Minute || m.SQLiteOptimizeInterval != 0 || m.RateEvictInterval != 30*time.Second || m.Jitter != 0.25 {
+		t.Fatalf("maintenance unexpected: %+v", m)
+	}
+
+	// Pagination
+	if cfg.CursorSecret != "0123456789abcdef0123456789abcdef" {
+		t.Fatalf("cursor secret unexpected: %q", cfg.CursorSecret)
+	}
+
 	// OTEL
 	if !cfg.OTEL.Enabled || cfg.OTEL.Endpoint != "otel:4317" || cfg.OTEL.Insecure || cfg.OTEL.ServiceName != "svc" || cfg.OTEL.SampleRatio != 0.75 {
 		t.Fatalf("otel unexpected: %+v", cfg.OTEL)
@@ -141,6 +251,12 @@ func TestLoad_ValidationErrors(t *testing.T) {
 			t.Fatalf("expected MAX_HEADER_BYTES validation error, got: %v", err)
 		}
 	})
+	t.Run("import max bytes <= 0", func(t *testing.T) {
+		t.Setenv("IMPORT_MAX_BYTES", "0")
+		if _, err := Load(); err == nil || !containsErr(err, "IMPORT_MAX_BYTES") {
+			t.Fatalf("expected IMPORT_MAX_BYTES validation error, got: %v", err)
+		}
+	})
 	t.Run("empty DB_PATH", func(t *testing.T) {
 		t.Setenv("DB_PATH", "   ")
 		if _, err := Load(); err == nil || !containsErr(err, "DB_PATH must not be empty") {
@@ -159,6 +275,67 @@ func TestLoad_ValidationErrors(t *testing.T) {
 			t.Fatalf("expected THRESHOLD validation error, got: %v", err)
 		}
 	})
+	t.Run("unknown SEARCH_SCORING", func(t *testing.T) {
+		t.Setenv("SEARCH_SCORING", "tfidf")
+		if _, err := Load(); err == nil || !containsErr(err, "SEARCH_SCORING") {
+			t.Fatalf("expected SEARCH_SCORING validation error, got: %v", err)
+		}
+	})
+	t.Run("bm25 k1 negative", func(t *testing.T) {
+		t.Setenv("BM25_K1", "-0.1")
+		if _, err := Load(); err == nil || !containsErr(err, "BM25_K1") {
+			t.Fatalf("expected BM25_K1 validation error, got: %v", err)
+		}
+	})
+	t.Run("bm25 b out of range", func(t *testing.T) {
+		t.Setenv("BM25_B", "1.2")
+		if _, err := Load(); err == nil || !containsErr(err, "BM25_B") {
+			t.Fatalf("expected BM25_B validation error, got: %v", err)
+		}
+	})
+	t.Run("corpus watch interval negative", func(t *testing.T) {
+		t.Setenv("CORPUS_WATCH_INTERVAL", "-1s")
+		if _, err := Load(); err == nil || !containsErr(err, "CORPUS_WATCH_INTERVAL") {
+			t.Fatalf("expected CORPUS_WATCH_INTERVAL validation error, got: %v", err)
+		}
+	})
+	t.Run("unknown GENERATOR", func(t *testing.T) {
+		t.Setenv("GENERATOR", "markov")
+		if _, err := Load(); err == nil || !containsErr(err, "GENERATOR") {
+			t.Fatalf("expected GENERATOR validation error, got: %v", err)
+		}
+	})
+	t.Run("openai without model", func(t *testing.T) {
+		t.Setenv("GENERATOR", "openai")
+		t.Setenv("LLM_MODEL", " ")
+		if _, err := Load(); err == nil || !containsErr(err, "LLM_MODEL") {
+			t.Fatalf("expected LLM_MODEL validation error, got: %v", err)
+		}
+	})
+	t.Run("llm timeout non-positive", func(t *testing.T) {
+		t.Setenv("LLM_TIMEOUT", "0s")
+		if _, err := Load(); err == nil || !containsErr(err, "LLM_TIMEOUT") {
+			t.Fatalf("expected LLM_TIMEOUT validation error, got: %v", err)
+		}
+	})
+	t.Run("llm retries negative", func(t *testing.T) {
+		t.Setenv("LLM_MAX_RETRIES", "-1")
+		if _, err := Load(); err == nil || !containsErr(err, "LLM_MAX_RETRIES") {
+			t.Fatalf("expected LLM_MAX_RETRIES validation error, got: %v", err)
+		}
+	})
+	t.Run("llm temperature out of range", func(t *testing.T) {
+		t.Setenv("LLM_TEMPERATURE", "3")
+		if _, err := Load(); err == nil || !containsErr(err, "LLM_TEMPERATURE") {
+			t.Fatalf("expected LLM_TEMPERATURE validation error, got: %v", err)
+		}
+	})
+	t.Run("history turns negative", func(t *testing.T) {
+		t.Setenv("HISTORY_TURNS", "-1")
+		if _, err := Load(); err == nil || !containsErr(err, "HISTORY_TURNS") {
+			t.Fatalf("expected HISTORY_TURNS validation error, got: %v", err)
+		}
+	})
 	t.Run("rate rps negative", func(t *testing.T) {
 		t.Setenv("RATE_RPS", "-1")
 		if _, err := Load(); err == nil || !containsErr(err, "RATE_RPS") {
@@ -171,24 +348,168 @@ func TestLoad_ValidationErrors(t *testing.T) {
 			t.Fatalf("expected RATE_BURST validation error, got: %v", err)
 		}
 	})
+	t.Run("rate message cost above burst", func(t *testing.T) {
+		t.Setenv("RATE_BURST", "4")
+		if _, err := Load(); err == nil || !containsErr(err, "RATE_MESSAGE_COST") {
+			t.Fatalf("expected RATE_MESSAGE_COST validation error, got: %v", err)
+		}
+	})
+	t.Run("shared rate rps negative", func(t *testing.T) {
+		t.Setenv("SHARED_RATE_RPS", "-1")
+		if _, err := Load(); err == nil || !containsErr(err, "SHARED_RATE_RPS") {
+			t.Fatalf("expected SHARED_RATE_RPS validation error, got: %v", err)
+		}
+	})
+	t.Run("shared rate burst < 1", func(t *testing.T) {
+		t.Setenv("SHARED_RATE_BURST", "0")
+		if _, err := Load(); err == nil || !containsErr(err, "SHARED_RATE_BURST") {
+			t.Fatalf("expected SHARED_RATE_BURST validation error, got: %v", err)
+		}
+	})
+	t.Run("unknown RATE_STORE", func(t *testing.T) {
+		t.Setenv("RATE_STORE", "memcached")
+		if _, err := Load(); err == nil || !containsErr(err, "RATE_STORE") {
+			t.Fatalf("expected RATE_STORE validation error, got: %v", err)
+		}
+	})
+	t.Run("redis store without address", func(t *testing.T) {
+		t.Setenv("RATE_STORE", "redis")
+		if _, err := Load(); err == nil || !containsErr(err, "RATE_REDIS_ADDR") {
+			t.Fatalf("expected RATE_REDIS_ADDR validation error, got: %v", err)
+		}
+	})
+	t.Run("rate redis db negative", func(t *testing.T) {
+		t.Setenv("RATE_REDIS_DB", "-1")
+		if _, err := Load(); err == nil || !containsErr(err, "RATE_REDIS_DB") {
+			t.Fatalf("expected RATE_REDIS_DB validation error, got: %v", err)
+		}
+	})
+	t.Run("rate store timeout zero", func(t *testing.T) {
+		t.Setenv("RATE_STORE_TIMEOUT", "0s")
+		if _, err := Load(); err == nil || !containsErr(err, "RATE_STORE_TIMEOUT") {
+			t.Fatalf("expected RATE_STORE_TIMEOUT validation error, got: %v", err)
+		}
+	})
 	t.Run("hsts max age negative", func(t *testing.T) {
 		t.Setenv("HSTS_MAX_AGE", "-1s")
 		if _, err := Load(); err == nil || !containsErr(err, "HSTS_MAX_AGE") {
 			t.Fatalf("expected HSTS_MAX_AGE validation error, got: %v", err)
 		}
 	})
+	t.Run("unknown QUOTA_TIMEZONE", func(t *testing.T) {
+		t.Setenv("QUOTA_TIMEZONE", "Mars/Olympus")
+		if _, err := Load(); err == nil || !containsErr(err, "QUOTA_TIMEZONE") {
+			t.Fatalf("expected QUOTA_TIMEZONE validation error, got: %v", err)
+		}
+	})
+	t.Run("negative quota", func(t *testing.T) {
+		t.Setenv("QUOTA_WORKSPACE_CHATS_DAILY", "-1")
+		if _, err := Load(); err == nil || !containsErr(err, "QUOTA_USER_* and QUOTA_WORKSPACE_*") {
+			t.Fatalf("expected quota validation error, got: %v", err)
+		}
+	})
 	t.Run("idempotency ttl non-positive", func(t *testing.T) {
 		t.Setenv("IDEMPOTENCY_TTL", "0s")
 		if _, err := Load(); err == nil || !containsErr(err, "IDEMPOTENCY_TTL") {
 			t.Fatalf("expected IDEMPOTENCY_TTL validation error, got: %v", err)
 		}
 	})
+	t.Run("cursor secret too short", func(t *testing.T) {
+		t.Setenv("CURSOR_SECRET", "short")
+		if _, err := Load(); err == nil || !containsErr(err, "CURSOR_SECRET") {
+			t.Fatalf("expected CURSOR_SECRET validation error, got: %v", err)
+		}
+	})
+	t.Run("chat restore window non-positive", func(t *testing.T) {
+		t.Setenv("CHAT_RESTORE_WINDOW", "0s")
+		if _, err := Load(); err == nil || !containsErr(err, "CHAT_RESTORE_WINDOW") {
+			t.Fatalf("expected CHAT_RESTORE_WINDOW validation error, got: %v", err)
+		}
+	})
+	t.Run("chat retention shorter than restore window", func(t *testing.T) {
+		t.Setenv("CHAT_RESTORE_WINDOW", "48h")
+		t.Setenv("CHAT_RETENTION", "24h")
+		if _, err := Load(); err == nil || !containsErr(err, "CHAT_RETENTION") {
+			t.Fatalf("expected CHAT_RETENTION validation error, got: %v", err)
+		}
+	})
+	t.Run("chat purge interval negative", func(t *testing.T) {
+		t.Setenv("CHAT_PURGE_INTERVAL", "-1s")
+		if _, err := Load(); err == nil || !containsErr(err, "CHAT_PURGE_INTERVAL") {
+			t.Fatalf("expected CHAT_PURGE_INTERVAL validation error, got: %v", err)
+		}
+	})
+	t.Run("maintenance interval negative", func(t *testing.T) {
+		t.Setenv("IDEMPOTENCY_GC_INTERVAL", "-1s")
+		if _, err := Load(); err == nil || !containsErr(err, "IDEMPOTENCY_GC_INTERVAL") {
+			t.Fatalf("expected IDEMPOTENCY_GC_INTERVAL validation error, got: %v", err)
+		}
+	})
+	t.Run("maintenance jitter out of range", func(t *testing.T) {
+		t.Setenv("MAINTENANCE_JITTER", "1.5")
+		if _, err := Load(); err == nil || !containsErr(err, "MAINTENANCE_JITTER") {
+			t.Fatalf("expected MAINTENANCE_JITTER validation error, got: %v", err)
+		}
+	})
 	t.Run("otel sample ratio out of range", func(t *testing.T) {
 		t.Setenv("OTEL_TRACES_SAMPLER_ARG", "1.5")
 		if _, err := Load(); err == nil || !containsErr(err, "OTEL_TRACES_SAMPLER_ARG") {
 			t.Fatalf("expected OTEL_TRACES_SAMPLER_ARG validation error, got: %v", err)
 		}
 	})
+	t.Run("unknown AUTH_MODE", func(t *testing.T) {
+		t.Setenv("AUTH_MODE", "basic")
+		if _, err := Load(); err == nil || !containsErr(err, "AUTH_MODE must be one of") {
+			t.Fatalf("expected AUTH_MODE validation error, got: %v", err)
+		}
+	})
+	t.Run("header auth outside development", func(t *testing.T) {
+		t.Setenv("AUTH_MODE", "header")
+		t.Setenv("GIN_MODE", "release")
+		if _, err := Load(); err == nil || !containsErr(err, "AUTH_MODE=header") {
+			t.Fatalf("expected AUTH_MODE=header validation error, got: %v", err)
+		}
+	})
+	t.Run("jwt without key source", func(t *testing.T) {
+		if _, err := Load(); err == nil || !containsErr(err, "AUTH_MODE=jwt requires") {
+			t.Fatalf("expected missing key source error, got: %v", err)
+		}
+	})
+	t.Run("short hs256 secret", func(t *testing.T) {
+		t.Setenv("JWT_HS256_SECRET", "too-short")
+		if _, err := Load(); err == nil || !containsErr(err, "JWT_HS256_SECRET") {
+			t.Fatalf("expected JWT_HS256_SECRET validation error, got: %v", err)
+		}
+	})
+	t.Run("jwks file and url together", func(t *testing.T) {
+		t.Setenv("JWT_JWKS_FILE", "jwks.json")
+		t.Setenv("JWT_JWKS_URL", "https://idp.example/jwks.json")
+		if _, err := Load(); err == nil || !containsErr(err, "mutually exclusive") {
+			t.Fatalf("expected JWKS exclusivity error, got: %v", err)
+		}
+	})
+	t.Run("jwks refresh non-positive", func(t *testing.T) {
+		t.Setenv("JWT_JWKS_FILE", "jwks.json")
+		t.Setenv("JWT_JWKS_REFRESH", "0s")
+		if _, err := Load(); err == nil || !containsErr(err, "JWT_JWKS_REFRESH") {
+			t.Fatalf("expected JWT_JWKS_REFRESH validation error, got: %v", err)
+		}
+	})
+	t.Run("negative leeway", func(t *testing.T) {
+		t.Setenv("JWT_JWKS_FILE", "jwks.json")
+		t.Setenv("JWT_LEEWAY", "-1s")
+		if _, err := Load(); err == nil || !containsErr(err, "JWT_LEEWAY") {
+			t.Fatalf("expected JWT_LEEWAY validation error, got: %v", err)
+		}
+	})
+	t.Run("admin role without roles claim", func(t *testing.T) {
+		t.Setenv("JWT_JWKS_FILE", "jwks.json")
+		t.Setenv("JWT_ADMIN_ROLE", "admin")
+		t.Setenv("JWT_ROLES_CLAIM", " ")
+		if _, err := Load(); err == nil || !containsErr(err, "JWT_ROLES_CLAIM") {
+			t.Fatalf("expected JWT_ROLES_CLAIM validation error, got: %v", err)
+		}
+	})
 
 	// Note: API_BASE_PATH validation is effectively unreachable due to normalizeBasePath
 	// always ensuring a leading '/' and returning "/" for empty input.
@@ -305,6 +626,7 @@ func containsErr(err error, want string) bool {
 func TestLoad_Defaults_APIBasePathDefault_And_DataMDOptional(t *testing.T) {
 	t.Setenv("DB_PATH", "db.sqlite")
 	t.Setenv("DATA_PATH", "data.md")
+	t.Setenv("JWT_HS256_SECRET", strings.Repeat("k", 32))
 	// Intentionally leave DATA_MD and API_BASE_PATH unset
 
 	cfg, err := Load()
@@ -319,10 +641,23 @@ func TestLoad_Defaults_APIBasePathDefault_And_DataMDOptional(t *testing.T) {
 	if cfg.DataMD != "" {
 		t.Fatalf("expected empty DataMD when unset, got %q", cfg.DataMD)
 	}
+	if cfg.Auth.Mode != "jwt" || cfg.Auth.UserClaim != "sub" || cfg.Auth.Leeway != 30*time.Second || cfg.Auth.JWKSRefresh != 15*time.Minute ||
+		cfg.Auth.RolesClaim != "roles" || cfg.Auth.AdminRole != "" {
+		t.Fatalf("auth defaults unexpected: %+v", cfg.Auth)
+	}
+	if cfg.RateMessageCost != 5 || cfg.SharedRateRPS != 1 || cfg.SharedRateBurst != 10 ||
+		cfg.RateStore.Kind != "memory" || cfg.RateStore.Timeout != 50*time.Millisecond {
+		t.Fatalf("rate store defaults unexpected: %+v", cfg.RateStore)
+	}
+	if m := cfg.Maintenance; m.IdempotencyGCInterval != 10*time.Minute || m.SQLiteOptimizeInterval != 6*time.Hour ||
+		m.RateEvictInterval != 5*time.Minute || m.Jitter != 0.1 {
+		t.Fatalf("maintenance defaults unexpected: %+v", m)
+	}
 }
 
 func TestMustLoad_Success_NoPanic(t *testing.T) {
-	// No special env needed; defaults are valid.
+	// Defaults are valid once a JWT key source is configured.
+	t.Setenv("JWT_HS256_SECRET", strings.Repeat("k", 32))
 	defer func() {
 		if r := recover(); r != nil {
 			t.Fatalf("MustLoad should not panic on valid defaults, got: %v", r)
@@ -0,0 +1,48 @@
+// Package domain defines the core persistence models for the application.
+// These types are used by GORM for database schema mapping and are shared
+// across the repository and service layers.
+package domain
+
+import (
+	"strings"
+	"time"
+)
+
+// APIKey is a long-lived credential a user issues for server-to-server
+// callers. Only a hash of the secret is stored; the key itself is shown once
+// when created (see auth.NewAPIKey).
+//
+// Fields:
+//   - ID: UUID primary key (char(36)).
+//   - UserID: owner of the key; requests made with it act as this user.
+//   - Name: optional human-readable label.
+//   - Prefix: public, unique key prefix ("gck_<hex>") used for lookup.
+//   - SecretHash: hex SHA-256 of the full key.
+//   - Scopes: space-separated granted scopes (see auth.Scopes).
+//   - ExpiresAt: optional expiry; nil keys never expire.
+//   - LastUsedAt: last successful authentication (updated at most once a minute).
+//   - RevokedAt: set when the key is revoked; revoked keys are kept for audit.
+//   - CreatedAt: timestamp managed by GORM.
+type APIKey struct {
+	ID         string     `json:"id"           gorm:"type:char(36);primaryKey"`
+	UserID     string     `json:"user_id"      gorm:"type:varchar(64);not null;index"`
+	Name       string     `json:"name"         gorm:"type:varchar(100);not null;default:''"`
+	Prefix     string     `json:"prefix"       gorm:"type:varchar(32);not null;uniqueIndex"`
+	SecretHash string     `json:"-"            gorm:"type:char(64);not null"`
+	Scopes     string     `json:"-"            gorm:"type:varchar(255);not null"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// TableName returns the database table name for APIKey.
+func (APIKey) TableName() string { return "api_keys" }
+
+// ScopeList returns the key's scopes as a slice.
+func (k APIKey) ScopeList() []string { return strings.Fields(k.Scopes) }
+
+// Active reports whether the key is neither revoked nor expired at now.
+func (k APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
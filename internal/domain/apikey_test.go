@@ -0,0 +1,37 @@
+package domain
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAPIKey_ScopeListAndActive(t *testing.T) {
+	if (APIKey{}).TableName() != "api_keys" {
+		t.Fatalf("APIKey.TableName() = %q; want %q", (APIKey{}).TableName(), "api_keys")
+	}
+
+	k := APIKey{Scopes: " chats:read  messages:write "}
+	if got := k.ScopeList(); !reflect.DeepEqual(got, []string{"chats:read", "messages:write"}) {
+		t.Fatalf("ScopeList = %v", got)
+	}
+
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+	cases := []struct {
+		name string
+		key  APIKey
+		want bool
+	}{
+		{"no expiry", APIKey{}, true},
+		{"expires later", APIKey{ExpiresAt: &future}, true},
+		{"expired", APIKey{ExpiresAt: &past}, false},
+		{"expires now", APIKey{ExpiresAt: &now}, false},
+		{"revoked", APIKey{RevokedAt: &past}, false},
+	}
+	for _, tc := range cases {
+		if got := tc.key.Active(now); got != tc.want {
+			t.Errorf("%s: Active = %v; want %v", tc.name, got, tc.want)
+		}
+	}
+}
@@ -5,19 +5,34 @@ package domain
 
 import "time"
 
-// Idempotency represents a recorded result of a previously processed request,
-// keyed by (user_id, chat_id, key). It enables safe retries for POST/PUT
-// operations by returning the originally produced response without re-executing
-// side effects.
+// Idempotency states.
+const (
+	IdempotencyInFlight  = "in_flight" // the first request is still running
+	IdempotencyCompleted = "completed" // Status, Header and Body hold its response
+)
+
+// Idempotency represents the response of a request made with an
+// Idempotency-Key, keyed by (workspace_id, user_id, key). It enables safe
+// retries of POST/PUT/PATCH/DELETE operations by replaying the originally
+// produced response without re-executing side effects.
+//
+// A record is claimed in state IdempotencyInFlight before the request runs
+// and completed with its response; ExpiresAt bounds both the claim and the
+// replay window. Fingerprint identifies the request (method, URI and body) so
+// a key reused for a different request can be rejected.
 type Idempotency struct {
-	ID        string    `gorm:"type:TEXT NOT NULL;primaryKey"`
-	UserID    string    `gorm:"type:TEXT NOT NULL;uniqueIndex:ux_user_chat_key,priority:1"`
-	ChatID    string    `gorm:"type:TEXT NOT NULL;uniqueIndex:ux_user_chat_key,priority:2"`
-	Key       string    `gorm:"type:TEXT NOT NULL;uniqueIndex:ux_user_chat_key,priority:3"`
-	MessageID string    `gorm:"type:TEXT NOT NULL"`
-	Status    int       `gorm:"type:INTEGER NOT NULL"`
-	CreatedAt time.Time `gorm:"type:DATETIME NOT NULL;autoCreateTime"`
-	ExpiresAt time.Time `gorm:"type:DATETIME NOT NULL;index"`
+	ID          string    `gorm:"type:TEXT NOT NULL;primaryKey"`
+	WorkspaceID string    `gorm:"type:TEXT NOT NULL;default:'default';uniqueIndex:ux_idempotency_key,priority:1"`
+	UserID      string    `gorm:"type:TEXT NOT NULL;uniqueIndex:ux_idempotency_key,priority:2"`
+	Key         string    `gorm:"type:TEXT NOT NULL;uniqueIndex:ux_idempotency_key,priority:3"`
+	ChatID      string    `gorm:"type:TEXT NOT NULL;default:'';index"` // chat the request targeted, if any
+	Fingerprint string    `gorm:"type:TEXT NOT NULL;default:''"`
+	State       string    `gorm:"type:TEXT NOT NULL;default:'completed'"`
+	Status      int       `gorm:"type:INTEGER NOT NULL"`
+	Header      string    `gorm:"type:TEXT NOT NULL;default:''"` // JSON-encoded response headers
+	Body        []byte    `gorm:"type:BLOB"`
+	CreatedAt   time.Time `gorm:"type:DATETIME NOT NULL;autoCreateTime"`
+	ExpiresAt   time.Time `gorm:"type:DATETIME NOT NULL;index"`
 }
 
 // TableName implements the GORM tabler interface.
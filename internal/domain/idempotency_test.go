@@ -37,33 +37,17 @@ type colinfo struct {
 func TestIdempotency_Migration_Indexes_AndInsert(t *testing.T) {
 	db := newTestDB(t)
 
-	// We create the exact schema we want (NOT NULL + PK + unique index),
-	// executing each statement separately (multi-statement Exec is flaky on this driver).
 	m := db.Migrator()
-	_ = m.DropTable("idempotency")
-
-	if err := db.Exec(`CREATE TABLE idempotency (
-		id          TEXT     NOT NULL PRIMARY KEY,
-		user_id     TEXT     NOT NULL,
-		chat_id     TEXT     NOT NULL,
-		key         TEXT     NOT NULL,
-		message_id  TEXT     NOT NULL,
-		status      INTEGER  NOT NULL,
-		created_at  DATETIME NOT NULL,
-		expires_at  DATETIME NOT NULL
-	)`).Error; err != nil {
-		t.Fatalf("create table: %v", err)
-	}
-	if err := db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS ux_user_chat_key ON idempotency (user_id, chat_id, key)`).Error; err != nil {
-		t.Fatalf("create unique index: %v", err)
+	if err := db.AutoMigrate(&Idempotency{}); err != nil {
+		t.Fatalf("automigrate: %v", err)
 	}
 
 	// Quick sanity checks (existence)
 	if !m.HasTable(&Idempotency{}) {
 		t.Fatalf("expected table %q to exist", Idempotency{}.TableName())
 	}
-	if !m.HasIndex(&Idempotency{}, "ux_user_chat_key") {
-		t.Fatalf("expected composite index ux_user_chat_key to exist")
+	if !m.HasIndex(&Idempotency{}, "ux_idempotency_key") {
+		t.Fatalf("expected composite index ux_idempotency_key to exist")
 	}
 
 	// --------- Assert NOT NULL constraints by behavior (attempt NULL insert) ----------
@@ -71,46 +55,39 @@ func TestIdempotency_Migration_Indexes_AndInsert(t *testing.T) {
 
 	assertNullRejected := func(col string) {
 		t.Helper()
-		// base values
-		id := "x-" + col
-		u := "u1"
-		c := "c1"
-		k := "k1"
-		mid := "m1"
-		status := 201
-		created := now
-		expires := now.Add(time.Hour)
-
 		// choose which column to make NULL
-		vals := []any{id, u, c, k, mid, status, created, expires}
-		names := []string{"id", "user_id", "chat_id", "key", "message_id", "status", "created_at", "expires_at"}
+		vals := []any{"x-" + col, "ws", "u1", "k1", 201, now, now.Add(time.Hour)}
+		names := []string{"id", "workspace_id", "user_id", "key", "status", "created_at", "expires_at"}
 		for i, name := range names {
 			if name == col {
 				vals[i] = nil // force NULL
 			}
 		}
 
-		err := db.Exec(`INSERT INTO idempotency ("id","user_id","chat_id","key","message_id","status","created_at","expires_at")
-		                VALUES (?,?,?,?,?,?,?,?)`, vals...).Error
+		err := db.Exec(`INSERT INTO idempotency ("id","workspace_id","user_id","key","status","created_at","expires_at")
+		                VALUES (?,?,?,?,?,?,?)`, vals...).Error
 		if err == nil {
 			t.Fatalf("expected NOT NULL violation when inserting NULL into %q", col)
 		}
 	}
 
-	for _, col := range []string{"user_id", "chat_id", "key", "message_id", "status", "created_at", "expires_at"} {
+	for _, col := range []string{"workspace_id", "user_id", "key", "status", "created_at", "expires_at"} {
 		assertNullRejected(col)
 	}
 
 	// --------- Insert a valid record and read it back ----------
 	rec := &Idempotency{
-		ID:        "id-1",
-		UserID:    "u1",
-		ChatID:    "c1",
-		Key:       "k1",
-		MessageID: "m1",
-		Status:    201,
-		CreatedAt: now,
-		ExpiresAt: now.Add(time.Hour),
+		ID:          "id-1",
+		WorkspaceID: DefaultWorkspaceID,
+		UserID:      "u1",
+		Key:         "k1",
+		Fingerprint: "fp",
+		State:       IdempotencyCompleted,
+		Status:      201,
+		Header:      `{"Content-Type":["application/json"]}`,
+		Body:        []byte(`{"ok":true}`),
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(time.Hour),
 	}
 	if err := db.Create(rec).Error; err != nil {
 		t.Fatalf("insert valid: %v", err)
@@ -120,18 +97,22 @@ func TestIdempotency_Migration_Indexes_AndInsert(t *testing.T) {
 	if err := db.First(&got, "id = ?", "id-1").Error; err != nil {
 		t.Fatalf("readback: %v", err)
 	}
-	if got.UserID != "u1" || got.ChatID != "c1" || got.Key != "k1" || got.MessageID != "m1" || got.Status != 201 {
+	if got.UserID != "u1" || got.ChatID != "" || got.Key != "k1" || got.State != IdempotencyCompleted ||
+		got.Status != 201 || string(got.Body) != `{"ok":true}` || got.Header != rec.Header {
 		t.Fatalf("unexpected row: %+v", got)
 	}
 	if got.ExpiresAt.Before(now) {
 		t.Fatalf("ExpiresAt should be after CreatedAt: %v vs %v", got.ExpiresAt, now)
 	}
 
-	// --------- Unique index behavior check (user_id,chat_id,key must be unique) ----------
-	err := db.Exec(`INSERT INTO idempotency ("id","user_id","chat_id","key","message_id","status","created_at","expires_at")
-	                VALUES (?,?,?,?,?,?,?,?)`,
-		"id-2", "u1", "c1", "k1", "m2", 202, now, now.Add(2*time.Hour)).Error
-	if err == nil {
-		t.Fatalf("expected UNIQUE constraint violation on (user_id, chat_id, key)")
+	// --------- Unique index behavior check (workspace_id,user_id,key must be unique) ----------
+	dup := &Idempotency{ID: "id-2", WorkspaceID: DefaultWorkspaceID, UserID: "u1", Key: "k1", ChatID: "c2", Status: 202, ExpiresAt: now.Add(2 * time.Hour)}
+	if err := db.Create(dup).Error; err == nil {
+		t.Fatalf("expected UNIQUE constraint violation on (workspace_id, user_id, key)")
+	}
+	// The same key is independent in another workspace.
+	dup.WorkspaceID = "ws-2"
+	if err := db.Create(dup).Error; err != nil {
+		t.Fatalf("insert in another workspace: %v", err)
 	}
 }
@@ -0,0 +1,22 @@
+// Package domain defines the core persistence models for the application.
+// These types are used by GORM for database schema mapping and are shared
+// across the repository and service layers.
+package domain
+
+import "time"
+
+// JobLease is the lease of a background maintenance job, shared by every
+// replica using the database so that only one of them runs the job at a time.
+//
+// Fields:
+//   - Name: the job name, e.g. "idempotency_gc".
+//   - Holder: the scheduler instance holding the lease.
+//   - ExpiresAt: when the lease lapses; any holder may take it afterwards.
+type JobLease struct {
+	Name      string    `json:"name" gorm:"type:varchar(64);primaryKey"`
+	Holder    string    `json:"holder" gorm:"type:varchar(64);not null"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null"`
+}
+
+// TableName returns the database table name for JobLease.
+func (JobLease) TableName() string { return "job_leases" }
@@ -15,38 +15,79 @@ import (
 //
 // Fields:
 //   - ID: stable UUID primary key (char(36)).
-//   - UserID: identifier of the chat owner; indexed for efficient retrieval.
+//   - WorkspaceID: workspace the chat belongs to (see Workspace).
+//   - UserID: identifier of the chat owner; indexed with WorkspaceID for
+//     efficient retrieval.
 //   - Title: human-readable chat title (auto-generated if not provided).
+//   - Version: starts at 1 and is incremented by every change to the row;
+//     the chat's ETag is derived from it (optimistic concurrency).
+//   - ActiveMessageID: last message of the active branch (see Message);
+//     new messages are appended after it. Not part of the chat's version.
 //   - CreatedAt / UpdatedAt: timestamps managed by GORM.
 //   - DeletedAt: soft deletion marker (retains row for audit/history).
 type Chat struct {
-	ID        string         `json:"id"        gorm:"type:char(36);primaryKey"`
-	UserID    string         `json:"user_id"   gorm:"type:varchar(64);not null;index:idx_user_chats"`
-	Title     string         `json:"title"     gorm:"type:varchar(255);not null;default:'New chat'"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"-"         gorm:"index"`
+	ID          string         `json:"id"           gorm:"type:char(36);primaryKey"`
+	WorkspaceID string         `json:"workspace_id" gorm:"type:char(36);not null;default:'default';index:idx_workspace_user_chats,priority:1"`
+	UserID      string         `json:"user_id"      gorm:"type:varchar(64);not null;index:idx_user_chats;index:idx_workspace_user_chats,priority:2"`
+	Title       string         `json:"title"        gorm:"type:varchar(255);not null;default:'New chat'"`
+	Version     int64          `json:"version"      gorm:"not null;default:1"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-"            gorm:"index"`
+
+	ActiveMessageID *string `json:"-" gorm:"type:char(36)"`
 }
 
 // TableName returns the database table name for Chat.
 func (Chat) TableName() string { return "chats" }
 
+// ChatShare grants a user other than the owner access to a chat. Shared
+// users can read the chat and post messages and feedback; only the owner
+// (or an admin) can rename, delete, restore or re-share it.
+//
+// Fields:
+//   - ChatID / UserID: composite primary key; UserID is indexed for lookups.
+//   - CreatedAt: when access was granted.
+//   - Chat: FK association, ensures cascade delete/update.
+type ChatShare struct {
+	ChatID    string    `json:"-"          gorm:"type:char(36);primaryKey"`
+	UserID    string    `json:"user_id"    gorm:"type:varchar(64);primaryKey;index"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Chat is the shared conversation. Shares are cascade-deleted if the
+	// chat is removed.
+	Chat Chat `json:"-" gorm:"foreignKey:ChatID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+// TableName returns the database table name for ChatShare.
+func (ChatShare) TableName() string { return "chat_shares" }
+
 // Message represents a single utterance within a chat. Messages are linked
 // to a chat, and can be authored either by the "user" or the "assistant".
 // Assistant messages may include a confidence score.
 //
+// The messages of a chat form a tree: each message follows its parent, and
+// editing a user message adds a sibling with its own reply, starting a new
+// branch. The path from the first message to Chat.ActiveMessageID is the
+// conversation as currently shown.
+//
 // Fields:
 //   - ID: UUID primary key (char(36)).
 //   - ChatID: foreign key to the owning chat (indexed).
+//   - ParentID: message this one follows; nil for the first message of the
+//     chat and its edits (indexed).
 //   - Role: "user" or "assistant" (enforced by DB constraint).
 //   - Content: full text content of the message.
 //   - Score: optional numeric score (only present for assistant messages).
 //   - CreatedAt / UpdatedAt: timestamps managed by GORM.
 //   - DeletedAt: soft deletion marker.
+//   - Citations: corpus documents an assistant reply was built from
+//     (not loaded automatically; see repo.AttachCitations).
 //   - Chat: FK association, ensures cascade delete/update.
 type Message struct {
 	ID        string         `json:"id"        gorm:"type:char(36);primaryKey"`
 	ChatID    string         `json:"chat_id"   gorm:"type:char(36);not null;index:idx_chat_msgs,priority:1"`
+	ParentID  *string        `json:"parent_id,omitempty" gorm:"type:char(36);index"`
 	Role      string         `json:"role"      gorm:"type:varchar(16);not null;check:role IN ('user','assistant')"`
 	Content   string         `json:"content"   gorm:"type:text;not null"`
 	Score     *float64       `json:"score,omitempty"` // only for assistant messages
@@ -54,6 +95,13 @@ type Message struct {
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-"         gorm:"index"`
 
+	// Citations lists the corpus sources of an assistant reply, best first.
+	Citations []MessageSource `json:"citations,omitempty" gorm:"foreignKey:MessageID;references:ID"`
+
+	// RetrievalQuery is the (possibly context-rewritten) query an assistant
+	// reply was retrieved with. Not persisted; returned only for debugging.
+	RetrievalQuery string `json:"retrieval_query,omitempty" gorm:"-"`
+
 	// Chat is the parent conversation. Messages are cascade-deleted
 	// if their chat is removed.
 	Chat Chat `json:"-" gorm:"foreignKey:ChatID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
@@ -62,11 +110,44 @@ type Message struct {
 // TableName returns the database table name for Message.
 func (Message) TableName() string { return "messages" }
 
+// MessageSource links an assistant message to one corpus document used to
+// build it, so every number in a reply can be traced back to its row.
+//
+// Fields:
+//   - ID: UUID primary key (char(36)).
+//   - MessageID: foreign key to the assistant message (indexed with Rank).
+//   - Rank: 0-based position of the source in the reply.
+//   - DocID: stable corpus document ID (search.Result.DocID).
+//   - Source / Line: corpus file and 1-based line of the row.
+//   - Score: retrieval score of the document for the prompt.
+//   - Snippet: the document text as cited (kept even if the corpus changes).
+//   - CreatedAt: timestamp managed by GORM.
+//   - Message: FK association, ensures cascade delete/update.
+type MessageSource struct {
+	ID        string    `json:"-"                gorm:"type:char(36);primaryKey"`
+	MessageID string    `json:"-"                gorm:"type:char(36);not null;index:idx_msg_sources,priority:1"`
+	Rank      int       `json:"rank"             gorm:"not null;index:idx_msg_sources,priority:2"`
+	DocID     string    `json:"doc_id"           gorm:"type:varchar(64);not null;index"`
+	Source    string    `json:"source,omitempty" gorm:"type:varchar(255)"`
+	Line      int       `json:"line,omitempty"`
+	Score     float64   `json:"score"`
+	Snippet   string    `json:"snippet"          gorm:"type:text;not null"`
+	CreatedAt time.Time `json:"-"`
+
+	// Message is the cited assistant message. Sources are cascade-deleted
+	// if the message is removed.
+	Message Message `json:"-" gorm:"foreignKey:MessageID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+// TableName returns the database table name for MessageSource.
+func (MessageSource) TableName() string { return "message_sources" }
+
 // Feedback represents a user-provided rating on a specific assistant message.
 // A user can only leave one feedback entry per message (enforced by unique index).
 //
 // Fields:
 //   - ID: UUID primary key (char(36)).
+//   - WorkspaceID: workspace of the rated message's chat.
 //   - MessageID: foreign key to the rated message (unique per user).
 //   - UserID: identifier of the feedback author (unique per message).
 //   - Value: +1 (positive) or -1 (negative).
@@ -74,13 +155,14 @@ func (Message) TableName() string { return "messages" }
 //   - DeletedAt: soft deletion marker.
 //   - Message: FK association, ensures cascade delete/update.
 type Feedback struct {
-	ID        string         `json:"id"         gorm:"type:char(36);primaryKey"`
-	MessageID string         `json:"message_id" gorm:"type:char(36);not null;index;uniqueIndex:ux_feedback_message_user"`
-	UserID    string         `json:"user_id"    gorm:"type:varchar(64);not null;index;uniqueIndex:ux_feedback_message_user"`
-	Value     int            `json:"value"      gorm:"not null;check:value IN (-1,1)"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"-"          gorm:"index"`
+	ID          string         `json:"id"           gorm:"type:char(36);primaryKey"`
+	WorkspaceID string         `json:"workspace_id" gorm:"type:char(36);not null;default:'default';index"`
+	MessageID   string         `json:"message_id"   gorm:"type:char(36);not null;index;uniqueIndex:ux_feedback_message_user"`
+	UserID      string         `json:"user_id"      gorm:"type:varchar(64);not null;index;uniqueIndex:ux_feedback_message_user"`
+	Value       int            `json:"value"        gorm:"not null;check:value IN (-1,1)"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-"            gorm:"index"`
 
 	// Message is the rated assistant message. Feedback is cascade-deleted
 	// if the underlying message is removed.
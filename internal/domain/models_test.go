@@ -29,6 +29,24 @@ func TestTableNames(t *testing.T) {
 	if (Message{}).TableName() != "messages" {
 		t.Fatalf("Message.TableName() = %q; want %q", (Message{}).TableName(), "messages")
 	}
+	if (ChatShare{}).TableName() != "chat_shares" {
+		t.Fatalf("ChatShare.TableName() = %q; want %q", (ChatShare{}).TableName(), "chat_shares")
+	}
+	if (Workspace{}).TableName() != "workspaces" {
+		t.Fatalf("Workspace.TableName() = %q; want %q", (Workspace{}).TableName(), "workspaces")
+	}
+	if (WorkspaceMember{}).TableName() != "workspace_members" {
+		t.Fatalf("WorkspaceMember.TableName() = %q; want %q", (WorkspaceMember{}).TableName(), "workspace_members")
+	}
+	if (UsageCounter{}).TableName() != "usage_counters" {
+		t.Fatalf("UsageCounter.TableName() = %q; want %q", (UsageCounter{}).TableName(), "usage_counters")
+	}
+	if (QuotaOverride{}).TableName() != "quota_overrides" {
+		t.Fatalf("QuotaOverride.TableName() = %q; want %q", (QuotaOverride{}).TableName(), "quota_overrides")
+	}
+	if (RateLimitBucket{}).TableName() != "rate_limit_buckets" {
+		t.Fatalf("RateLimitBucket.TableName() = %q; want %q", (RateLimitBucket{}).TableName(), "rate_limit_buckets")
+	}
 	if (Feedback{}).TableName() != "feedback" {
 		t.Fatalf("Feedback.TableName() = %q; want %q", (Feedback{}).TableName(), "feedback")
 	}
@@ -0,0 +1,19 @@
+// Package domain defines the core persistence models for the application.
+// These types are used by GORM for database schema mapping and are shared
+// across the repository and service layers.
+package domain
+
+// RateLimitBucket is the persisted state of one rate-limit key when the
+// SQLite rate-limit store is used (RATE_STORE=sqlite).
+//
+// Fields:
+//   - Key: the limiter key, e.g. "user:<id>" or "ip:<addr>".
+//   - TAT: the GCRA "theoretical arrival time" in Unix microseconds; a TAT in
+//     the past means the bucket is full and the row can be evicted.
+type RateLimitBucket struct {
+	Key string `json:"key" gorm:"type:varchar(255);primaryKey"`
+	TAT int64  `json:"tat" gorm:"not null;index"`
+}
+
+// TableName returns the database table name for RateLimitBucket.
+func (RateLimitBucket) TableName() string { return "rate_limit_buckets" }
@@ -0,0 +1,41 @@
+// Package domain defines the core persistence models for the application.
+// These types are used by GORM for database schema mapping and are shared
+// across the repository and service layers.
+package domain
+
+import "time"
+
+// ShareLink is a public, read-only link to a chat for people without an
+// account. A chat has at most one link; creating a new one replaces it.
+// Only a hash of the token is stored; the token itself is shown once when
+// the link is created (see auth.NewShareToken).
+//
+// Fields:
+//   - ChatID: primary key; the shared chat.
+//   - TokenHash: hex SHA-256 of the token, unique, used for lookup.
+//   - CreatedBy: user who created the link. Never shown to link viewers.
+//   - ExpiresAt: optional expiry; nil links never expire.
+//   - Views / LastViewedAt: how often and when the link was last opened.
+//   - CreatedAt: when the link was created.
+//   - Chat: FK association, ensures cascade delete/update.
+type ShareLink struct {
+	ChatID       string     `json:"-"                        gorm:"type:char(36);primaryKey"`
+	TokenHash    string     `json:"-"                        gorm:"type:char(64);not null;uniqueIndex"`
+	CreatedBy    string     `json:"-"                        gorm:"type:varchar(64);not null"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	Views        int64      `json:"views"                    gorm:"not null;default:0"`
+	LastViewedAt *time.Time `json:"last_viewed_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+
+	// Chat is the shared conversation. Links are cascade-deleted if the
+	// chat is removed.
+	Chat Chat `json:"-" gorm:"foreignKey:ChatID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+// TableName returns the database table name for ShareLink.
+func (ShareLink) TableName() string { return "share_links" }
+
+// Active reports whether the link has not expired at now.
+func (l ShareLink) Active(now time.Time) bool {
+	return l.ExpiresAt == nil || now.Before(*l.ExpiresAt)
+}
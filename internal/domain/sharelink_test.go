@@ -0,0 +1,29 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShareLink_Active(t *testing.T) {
+	if (ShareLink{}).TableName() != "share_links" {
+		t.Fatalf("ShareLink.TableName() = %q; want %q", (ShareLink{}).TableName(), "share_links")
+	}
+
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+	for _, tc := range []struct {
+		name string
+		link ShareLink
+		want bool
+	}{
+		{"no expiry", ShareLink{}, true},
+		{"expires later", ShareLink{ExpiresAt: &future}, true},
+		{"expired", ShareLink{ExpiresAt: &past}, false},
+		{"expires now", ShareLink{ExpiresAt: &now}, false},
+	} {
+		if got := tc.link.Active(now); got != tc.want {
+			t.Errorf("%s: Active = %v; want %v", tc.name, got, tc.want)
+		}
+	}
+}
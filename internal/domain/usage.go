@@ -0,0 +1,107 @@
+// Package domain defines the core persistence models for the application.
+// These types are used by GORM for database schema mapping and are shared
+// across the repository and service layers.
+package domain
+
+import "time"
+
+// Usage metrics subject to quotas.
+const (
+	// UsageMessages counts prompts posted to chats (POST /chats/:id/messages
+	// and its streaming variant). Imported messages are not counted: they
+	// are stored, not answered.
+	UsageMessages = "messages"
+	// UsageChats counts created chats, including each imported chat.
+	UsageChats = "chats"
+)
+
+// Quota periods. Periods follow calendar boundaries in the configured quota
+// time zone.
+const (
+	PeriodDay   = "day"
+	PeriodMonth = "month"
+)
+
+// Quota scopes: who a usage counter belongs to.
+const (
+	// QuotaScopeUser counts a user's usage across all workspaces.
+	QuotaScopeUser = "user"
+	// QuotaScopeWorkspace counts the usage of all members of a workspace.
+	QuotaScopeWorkspace = "workspace"
+)
+
+// QuotaLimits caps usage per metric and period. Zero means unlimited.
+type QuotaLimits struct {
+	MessagesPerDay   int64 `json:"messages_per_day"`
+	MessagesPerMonth int64 `json:"messages_per_month"`
+	ChatsPerDay      int64 `json:"chats_per_day"`
+	ChatsPerMonth    int64 `json:"chats_per_month"`
+}
+
+// Limit returns the cap for metric in period (0 when unlimited or unknown).
+func (l QuotaLimits) Limit(metric, period string) int64 {
+	switch {
+	case metric == UsageMessages && period == PeriodDay:
+		return l.MessagesPerDay
+	case metric == UsageMessages && period == PeriodMonth:
+		return l.MessagesPerMonth
+	case metric == UsageChats && period == PeriodDay:
+		return l.ChatsPerDay
+	case metric == UsageChats && period == PeriodMonth:
+		return l.ChatsPerMonth
+	}
+	return 0
+}
+
+// UsageCounter is the persisted usage of one subject for one metric in one
+// calendar period. Counters of past periods are simply never read again.
+//
+// Fields:
+//   - Scope / SubjectID: QuotaScopeUser with a user ID, or
+//     QuotaScopeWorkspace with a workspace ID.
+//   - Metric: UsageMessages or UsageChats.
+//   - Period / PeriodStart: PeriodDay with "2006-01-02", or PeriodMonth with
+//     "2006-01", in the quota time zone.
+//   - Count: units used in the period.
+//
+// All five key fields form the composite primary key.
+type UsageCounter struct {
+	Scope       string    `json:"scope"        gorm:"type:varchar(16);primaryKey"`
+	SubjectID   string    `json:"subject_id"   gorm:"type:varchar(64);primaryKey"`
+	Metric      string    `json:"metric"       gorm:"type:varchar(16);primaryKey"`
+	Period      string    `json:"period"       gorm:"type:varchar(8);primaryKey"`
+	PeriodStart string    `json:"period_start" gorm:"type:varchar(10);primaryKey"`
+	Count       int64     `json:"count"        gorm:"not null;default:0"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TableName returns the database table name for UsageCounter.
+func (UsageCounter) TableName() string { return "usage_counters" }
+
+// QuotaOverride replaces the configured per-user limits for one user. Nil
+// fields keep the configured default; zero lifts the limit.
+type QuotaOverride struct {
+	UserID           string    `json:"user_id"                      gorm:"type:varchar(64);primaryKey"`
+	MessagesPerDay   *int64    `json:"messages_per_day,omitempty"`
+	MessagesPerMonth *int64    `json:"messages_per_month,omitempty"`
+	ChatsPerDay      *int64    `json:"chats_per_day,omitempty"`
+	ChatsPerMonth    *int64    `json:"chats_per_month,omitempty"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// TableName returns the database table name for QuotaOverride.
+func (QuotaOverride) TableName() string { return "quota_overrides" }
+
+// Apply returns base with the override's non-nil fields replacing it.
+func (o QuotaOverride) Apply(base QuotaLimits) QuotaLimits {
+	set := func(dst *int64, v *int64) {
+		if v != nil {
+			*dst = *v
+		}
+	}
+	set(&base.MessagesPerDay, o.MessagesPerDay)
+	set(&base.MessagesPerMonth, o.MessagesPerMonth)
+	set(&base.ChatsPerDay, o.ChatsPerDay)
+	set(&base.ChatsPerMonth, o.ChatsPerMonth)
+	return base
+}
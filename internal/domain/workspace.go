@@ -0,0 +1,69 @@
+// Package domain defines the core persistence models for the application.
+// These types are used by GORM for database schema mapping and are shared
+// across the repository and service layers.
+package domain
+
+import "time"
+
+// DefaultWorkspaceID is the workspace requests use when they do not select
+// one. Every user is implicitly a member of it and it searches the server's
+// default corpus (DATA_MD/DATA_PATH). Rows created before workspaces existed
+// belong to it.
+const DefaultWorkspaceID = "default"
+
+// Workspace roles.
+const (
+	// WorkspaceRoleOwner may rename the workspace and manage its members.
+	WorkspaceRoleOwner = "owner"
+	// WorkspaceRoleMember may use the workspace's chats and corpus.
+	WorkspaceRoleMember = "member"
+)
+
+// ValidWorkspaceRole reports whether role is a known workspace role.
+func ValidWorkspaceRole(role string) bool {
+	return role == WorkspaceRoleOwner || role == WorkspaceRoleMember
+}
+
+// Workspace isolates a team's chats, feedback and idempotency records from
+// every other team sharing the deployment, and may answer from its own
+// corpus.
+//
+// Fields:
+//   - ID: UUID primary key (char(36)); DefaultWorkspaceID for the implicit
+//     default workspace.
+//   - Name: human-readable name.
+//   - CorpusPath: corpus file, relative to CORPUS_DIR, searched by the
+//     workspace's chats; empty means the server's default corpus.
+//   - CreatedAt / UpdatedAt: timestamps managed by GORM.
+type Workspace struct {
+	ID         string    `json:"id"                    gorm:"type:char(36);primaryKey"`
+	Name       string    `json:"name"                  gorm:"type:varchar(100);not null"`
+	CorpusPath string    `json:"corpus_path,omitempty" gorm:"type:varchar(255);not null;default:''"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// TableName returns the database table name for Workspace.
+func (Workspace) TableName() string { return "workspaces" }
+
+// WorkspaceMember grants a user access to a workspace with a role.
+//
+// Fields:
+//   - WorkspaceID / UserID: composite primary key; UserID is indexed for
+//     "my workspaces" lookups.
+//   - Role: WorkspaceRoleOwner or WorkspaceRoleMember.
+//   - CreatedAt: when the user joined.
+//   - Workspace: FK association, ensures cascade delete/update.
+type WorkspaceMember struct {
+	WorkspaceID string    `json:"-"          gorm:"type:char(36);primaryKey"`
+	UserID      string    `json:"user_id"    gorm:"type:varchar(64);primaryKey;index"`
+	Role        string    `json:"role"       gorm:"type:varchar(16);not null;check:role IN ('owner','member')"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// Workspace is the joined workspace. Memberships are cascade-deleted if
+	// the workspace is removed.
+	Workspace Workspace `json:"-" gorm:"foreignKey:WorkspaceID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE"`
+}
+
+// TableName returns the database table name for WorkspaceMember.
+func (WorkspaceMember) TableName() string { return "workspace_members" }
@@ -0,0 +1,160 @@
+// Package export renders chat transcripts as Markdown, JSON or HTML.
+//
+// Transcripts are written incrementally through a Writer (Begin, then
+// Messages once per page, then End), so long chats never have to be held in
+// memory. The JSON format is a versioned Document, which is also what chat
+// imports accept; the Markdown and HTML formats are meant for people.
+package export
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// JSON document identification. Version changes when a change to the
+// document would break readers.
+const (
+	DocumentKind    = "go-chat-backend/chat"
+	DocumentVersion = 1
+)
+
+// ErrUnknownFormat is returned for export formats other than md, json and
+// html.
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Format is an export format.
+type Format string
+
+// Export formats.
+const (
+	Markdown Format = "md"
+	JSON     Format = "json"
+	HTML     Format = "html"
+)
+
+// ParseFormat returns the format named s ("markdown" is accepted for md).
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case Markdown, JSON, HTML:
+		return f, nil
+	case "markdown":
+		return Markdown, nil
+	}
+	return "", ErrUnknownFormat
+}
+
+// ContentType returns the media type of the format.
+func (f Format) ContentType() string {
+	switch f {
+	case JSON:
+		return "application/json; charset=utf-8"
+	case HTML:
+		return "text/html; charset=utf-8"
+	default:
+		return "text/markdown; charset=utf-8"
+	}
+}
+
+// Document is a chat export in the JSON format.
+type Document struct {
+	Kind       string    `json:"kind"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	Chat       Chat      `json:"chat"`
+	Messages   []Message `json:"messages"`
+}
+
+// Chat describes the exported chat.
+type Chat struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Message is an exported message.
+type Message struct {
+	ID        string     `json:"id"`
+	Role      string     `json:"role"`
+	Content   string     `json:"content"`
+	Score     *float64   `json:"score,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	Feedback  []Feedback `json:"feedback,omitempty"`
+	Citations []Citation `json:"citations,omitempty"`
+}
+
+// Feedback is a rating left on a message.
+type Feedback struct {
+	UserID string `json:"user_id"`
+	Value  int    `json:"value"`
+}
+
+// Citation is a corpus source of an assistant message.
+type Citation struct {
+	Rank    int     `json:"rank"`
+	DocID   string  `json:"doc_id"`
+	Source  string  `json:"source,omitempty"`
+	Line    int     `json:"line,omitempty"`
+	Score   float64 `json:"score"`
+	Snippet string  `json:"snippet"`
+}
+
+// Writer writes a transcript: Begin once, Messages for each page of messages
+// in order, then End.
+type Writer interface {
+	Begin(chat Chat) error
+	Messages(msgs []Message) error
+	End() error
+}
+
+// NewWriter returns a Writer rendering format to w, stamped with exportedAt.
+func NewWriter(format Format, w io.Writer, exportedAt time.Time) (Writer, error) {
+	switch format {
+	case Markdown:
+		return &markdownWriter{w: w, at: exportedAt}, nil
+	case JSON:
+		return &jsonWriter{w: w, at: exportedAt}, nil
+	case HTML:
+		return &htmlWriter{w: w, at: exportedAt}, nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+// ContentDisposition returns an attachment Content-Disposition whose file
+// name is derived from the chat title: an ASCII name for old clients and the
+// UTF-8 one (RFC 6266) when the title has other letters.
+func ContentDisposition(title string, format Format) string {
+	ascii, full := slug(title, true), slug(title, false)
+	if ascii == "" {
+		ascii = "chat"
+	}
+	if full == "" {
+		full = ascii
+	}
+	v := fmt.Sprintf(`attachment; filename="%s.%s"`, ascii, format)
+	if full != ascii {
+		v += fmt.Sprintf("; filename*=UTF-8''%s.%s", url.PathEscape(full), format)
+	}
+	return v
+}
+
+// slug lowercases title and joins its words (runs of letters and digits,
+// ASCII only if asciiOnly) with dashes, up to 64 runes.
+func slug(title string, asciiOnly bool) string {
+	words := strings.FieldsFunc(strings.ToLower(title), func(r rune) bool {
+		if asciiOnly && r > unicode.MaxASCII {
+			return true
+		}
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	s := []rune(strings.Join(words, "-"))
+	if len(s) > 64 {
+		s = []rune(strings.TrimRight(string(s[:64]), "-"))
+	}
+	return string(s)
+}
@@ -0,0 +1,127 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	at    = time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	score = 0.63
+	chat  = Chat{ID: "c1", Title: "Gen Z <trends>", CreatedAt: at, UpdatedAt: at.Add(time.Hour)}
+	pages = [][]Message{
+		{{ID: "m1", Role: "user", Content: "Where do teens <script>watch</script>?", CreatedAt: at}},
+		{},
+		{{ID: "m2", Role: "assistant", Content: "On TikTok.", Score: &score, CreatedAt: at.Add(time.Second),
+			Feedback:  []Feedback{{UserID: "u1", Value: 1}, {UserID: "u2", Value: -1}},
+			Citations: []Citation{{Rank: 0, DocID: "7", Source: "data.md", Line: 42, Score: 0.63, Snippet: "TikTok\n 61%"}}}},
+	}
+)
+
+func render(t *testing.T, f Format) string {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(f, &buf, at.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("NewWriter(%s): %v", f, err)
+	}
+	if err := w.Begin(chat); err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	for _, p := range pages {
+		if err := w.Messages(p); err != nil {
+			t.Fatalf("Messages: %v", err)
+		}
+	}
+	if err := w.End(); err != nil {
+		t.Fatalf("End: %v", err)
+	}
+	return buf.String()
+}
+
+func TestJSON_RoundTrips(t *testing.T) {
+	var doc Document
+	if err := json.Unmarshal([]byte(render(t, JSON)), &doc); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if doc.Kind != DocumentKind || doc.Version != DocumentVersion || !doc.ExportedAt.Equal(at.Add(2*time.Hour)) || doc.Chat != chat {
+		t.Fatalf("document = %+v", doc)
+	}
+	if len(doc.Messages) != 2 || doc.Messages[0].Content != pages[0][0].Content || *doc.Messages[1].Score != score ||
+		len(doc.Messages[1].Feedback) != 2 || doc.Messages[1].Citations[0] != pages[2][0].Citations[0] {
+		t.Fatalf("messages = %+v", doc.Messages)
+	}
+
+	// A chat without messages is still a valid document.
+	var buf bytes.Buffer
+	w, _ := NewWriter(JSON, &buf, at)
+	_ = w.Begin(chat)
+	_ = w.End()
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil || doc.Messages == nil || len(doc.Messages) != 0 {
+		t.Fatalf("empty = %s, %v", buf.String(), err)
+	}
+}
+
+func TestMarkdownAndHTML(t *testing.T) {
+	md := render(t, Markdown)
+	for _, want := range []string{
+		"# Gen Z <trends>\n", "- Exported: 2025-05-01 14:00:00 UTC",
+		"### User · 2025-05-01 12:00:00 UTC\n\nWhere do teens <script>watch</script>?\n",
+		"### Assistant · 2025-05-01 12:00:01 UTC · score 0.63",
+		"**Feedback:** +1 (u1), -1 (u2)", "1. data.md:42 (doc 7) — TikTok 61%",
+	} {
+		if !strings.Contains(md, want) {
+			t.Fatalf("markdown lacks %q:\n%s", want, md)
+		}
+	}
+
+	page := render(t, HTML)
+	for _, want := range []string{
+		"<title>Gen Z &lt;trends&gt;</title>", "teens &lt;script&gt;watch&lt;/script&gt;?",
+		`<article class="assistant" id="m-m2">`, "score 0.63", "&#43;1 (u1), -1 (u2)",
+		`<li value="1">data.md:42 (doc 7) — TikTok`, "</html>",
+	} {
+		if !strings.Contains(page, want) {
+			t.Fatalf("html lacks %q:\n%s", want, page)
+		}
+	}
+	if strings.Contains(page, "<script>") {
+		t.Fatalf("html not escaped:\n%s", page)
+	}
+}
+
+func TestFormatsAndFilenames(t *testing.T) {
+	for in, want := range map[string]Format{"md": Markdown, "Markdown": Markdown, "JSON": JSON, "html": HTML} {
+		if f, err := ParseFormat(in); err != nil || f != want {
+			t.Fatalf("ParseFormat(%q) = %q, %v", in, f, err)
+		}
+	}
+	for _, in := range []string{"", "pdf"} {
+		if _, err := ParseFormat(in); !errors.Is(err, ErrUnknownFormat) {
+			t.Fatalf("ParseFormat(%q) err = %v", in, err)
+		}
+	}
+	if _, err := NewWriter("pdf", &bytes.Buffer{}, at); !errors.Is(err, ErrUnknownFormat) {
+		t.Fatalf("NewWriter(pdf) err = %v", err)
+	}
+
+	for _, tc := range []struct {
+		title string
+		f     Format
+		want  string
+	}{
+		{"Gen Z: TikTok / \"Trends\"", Markdown, `attachment; filename="gen-z-tiktok-trends.md"`},
+		{"", JSON, `attachment; filename="chat.json"`},
+		{"Ελληνικά", HTML, `attachment; filename="chat.html"; filename*=UTF-8''%CE%B5%CE%BB%CE%BB%CE%B7%CE%BD%CE%B9%CE%BA%CE%AC.html`},
+		{"Café notes", Markdown, `attachment; filename="caf-notes.md"; filename*=UTF-8''caf%C3%A9-notes.md`},
+		{strings.Repeat("ab ", 40), JSON, `attachment; filename="` + strings.Repeat("ab-", 21) + `a.json"`},
+	} {
+		if got := ContentDisposition(tc.title, tc.f); got != tc.want {
+			t.Fatalf("ContentDisposition(%q) = %s, want %s", tc.title, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package export
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"time"
+)
+
+// htmlTemplates render a standalone, print-friendly HTML page; html/template
+// escapes all chat content.
+var htmlTemplates = template.Must(template.New("head").Funcs(template.FuncMap{
+	"stamp": stamp,
+	"role":  roleName,
+	"ref":   citationRef,
+	"inc":   func(i int) int { return i + 1 },
+	"score": func(s *float64) string { return fmt.Sprintf("%.2f", *s) },
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Chat.Title}}</title>
+<style>
+body{font-family:system-ui,sans-serif;max-width:48rem;margin:2rem auto;padding:0 1rem;color:#222}
+header dl{display:grid;grid-template-columns:max-content 1fr;gap:.25rem 1rem;color:#555}
+article{border-top:1px solid #ddd;padding:1rem 0}
+article h2{font-size:1rem;margin:0 0 .5rem}
+article h2 small{font-weight:normal;color:#777}
+.content{white-space:pre-wrap}
+.assistant h2{color:#1a5fb4}
+.meta{color:#555;font-size:.9rem}
+</style>
+</head>
+<body>
+<header>
+<h1>{{.Chat.Title}}</h1>
+<dl>
+<dt>Chat</dt><dd><code>{{.Chat.ID}}</code></dd>
+<dt>Created</dt><dd>{{stamp .Chat.CreatedAt}}</dd>
+<dt>Updated</dt><dd>{{stamp .Chat.UpdatedAt}}</dd>
+<dt>Exported</dt><dd>{{stamp .ExportedAt}}</dd>
+</dl>
+</header>
+<main>
+{{define "messages"}}{{range .}}<article class="{{.Role}}" id="m-{{.ID}}">
+<h2>{{role .Role}} <small>· <time datetime="{{.CreatedAt.UTC.Format "2006-01-02T15:04:05Z07:00"}}">{{stamp .CreatedAt}}</time>{{if .Score}} · score {{score .Score}}{{end}}</small></h2>
+<div class="content">{{.Content}}</div>
+{{- if .Feedback}}
+<p class="meta">Feedback: {{range $i, $f := .Feedback}}{{if $i}}, {{end}}{{printf "%+d" $f.Value}} ({{$f.UserID}}){{end}}</p>
+{{- end}}
+{{- if .Citations}}
+<ol class="meta">
+{{- range .Citations}}
+<li value="{{inc .Rank}}">{{ref .}} — {{.Snippet}}</li>
+{{- end}}
+</ol>
+{{- end}}
+</article>
+{{end}}{{end}}{{define "foot"}}</main>
+</body>
+</html>
+{{end}}`))
+
+// htmlWriter renders a transcript as a standalone HTML page.
+type htmlWriter struct {
+	w  io.Writer
+	at time.Time
+}
+
+func (h *htmlWriter) Begin(chat Chat) error {
+	return htmlTemplates.ExecuteTemplate(h.w, "head", Document{ExportedAt: h.at, Chat: chat})
+}
+
+func (h *htmlWriter) Messages(msgs []Message) error {
+	return htmlTemplates.ExecuteTemplate(h.w, "messages", msgs)
+}
+
+func (h *htmlWriter) End() error {
+	return htmlTemplates.ExecuteTemplate(h.w, "foot", nil)
+}
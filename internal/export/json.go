@@ -0,0 +1,48 @@
+package export
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// jsonWriter streams a Document: the envelope is written by Begin and End
+// and the messages array is filled in between, one page at a time.
+type jsonWriter struct {
+	w     io.Writer
+	at    time.Time
+	count int
+}
+
+func (j *jsonWriter) Begin(chat Chat) error {
+	head, err := json.Marshal(Document{Kind: DocumentKind, Version: DocumentVersion, ExportedAt: j.at.UTC(), Chat: chat})
+	if err != nil {
+		return err
+	}
+	// Reopen the trailing `"messages":null}` as an array.
+	head = append(head[:len(head)-len(`null}`)], '[')
+	_, err = j.w.Write(head)
+	return err
+}
+
+func (j *jsonWriter) Messages(msgs []Message) error {
+	for _, m := range msgs {
+		b, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		if j.count > 0 {
+			b = append([]byte{','}, b...)
+		}
+		if _, err := j.w.Write(b); err != nil {
+			return err
+		}
+		j.count++
+	}
+	return nil
+}
+
+func (j *jsonWriter) End() error {
+	_, err := io.WriteString(j.w, "]}\n")
+	return err
+}
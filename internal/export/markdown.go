@@ -0,0 +1,86 @@
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// markdownWriter renders a transcript as Markdown: a title and metadata list,
+// then one section per message. Message content is Markdown already and is
+// written as is.
+type markdownWriter struct {
+	w  io.Writer
+	at time.Time
+}
+
+func (m *markdownWriter) Begin(chat Chat) error {
+	_, err := fmt.Fprintf(m.w, "# %s\n\n- Chat: `%s`\n- Created: %s\n- Updated: %s\n- Exported: %s\n",
+		oneLine(chat.Title), chat.ID, stamp(chat.CreatedAt), stamp(chat.UpdatedAt), stamp(m.at))
+	return err
+}
+
+func (m *markdownWriter) Messages(msgs []Message) error {
+	var b strings.Builder
+	for _, msg := range msgs {
+		fmt.Fprintf(&b, "\n---\n\n### %s · %s", roleName(msg.Role), stamp(msg.CreatedAt))
+		if msg.Score != nil {
+			fmt.Fprintf(&b, " · score %.2f", *msg.Score)
+		}
+		fmt.Fprintf(&b, "\n\n%s\n", strings.TrimRight(msg.Content, "\n"))
+		if len(msg.Feedback) > 0 {
+			b.WriteString("\n**Feedback:** ")
+			for i, f := range msg.Feedback {
+				if i > 0 {
+					b.WriteString(", ")
+				}
+				fmt.Fprintf(&b, "%+d (%s)", f.Value, f.UserID)
+			}
+			b.WriteString("\n")
+		}
+		if len(msg.Citations) > 0 {
+			b.WriteString("\n**Sources:**\n\n")
+			for _, c := range msg.Citations {
+				fmt.Fprintf(&b, "%d. %s — %s\n", c.Rank+1, citationRef(c), oneLine(c.Snippet))
+			}
+		}
+	}
+	_, err := io.WriteString(m.w, b.String())
+	return err
+}
+
+func (m *markdownWriter) End() error { return nil }
+
+// roleName is the heading of a message by role.
+func roleName(role string) string {
+	switch role {
+	case "user":
+		return "User"
+	case "assistant":
+		return "Assistant"
+	}
+	return role
+}
+
+// citationRef names a citation's corpus location, e.g. "data.md:42 (doc 7)".
+func citationRef(c Citation) string {
+	ref := c.Source
+	if c.Line > 0 {
+		ref = fmt.Sprintf("%s:%d", ref, c.Line)
+	}
+	if ref == "" {
+		return "doc " + c.DocID
+	}
+	return fmt.Sprintf("%s (doc %s)", ref, c.DocID)
+}
+
+// stamp formats a time for people, in UTC.
+func stamp(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05 UTC")
+}
+
+// oneLine collapses runs of whitespace (including newlines) into spaces.
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
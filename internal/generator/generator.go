@@ -0,0 +1,60 @@
+// Package generator turns retrieved corpus snippets into an assistant reply.
+//
+// A Generator receives the user prompt, the recent chat history and the
+// snippets selected by retrieval (best first) and returns the reply text.
+// Two implementations ship with the service:
+//
+//   - Extractive: the original behaviour — the snippets themselves are the
+//     answer. It never fails and is used as the fallback for other generators.
+//   - OpenAI: a client for any OpenAI-compatible /v1/chat/completions endpoint,
+//     with per-attempt timeouts, retries and token limits.
+//
+// Generators are only asked to answer when retrieval found supporting
+// snippets; declining is decided by the caller.
+package generator
+
+import (
+	"context"
+	"strings"
+)
+
+// Role values used in Turn.
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Turn is one earlier message of the conversation.
+type Turn struct {
+	Role    string // RoleUser or RoleAssistant
+	Content string
+}
+
+// Request is the input of a single generation.
+type Request struct {
+	Prompt   string   // the user message being answered
+	History  []Turn   // earlier turns, oldest first; excludes Prompt
+	Snippets []string // retrieved passages, best first; never empty
+}
+
+// Generator produces a reply grounded in Request.Snippets.
+type Generator interface {
+	Generate(ctx context.Context, req Request) (string, error)
+}
+
+// Extractive answers with the snippets themselves, one per line, with
+// whitespace collapsed. It ignores the prompt and history.
+type Extractive struct{}
+
+// Generate implements Generator.
+func (Extractive) Generate(_ context.Context, req Request) (string, error) {
+	lines := make([]string, 0, len(req.Snippets))
+	for _, s := range req.Snippets {
+		for _, ln := range strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n") {
+			if parts := strings.Fields(ln); len(parts) > 0 {
+				lines = append(lines, strings.Join(parts, " "))
+			}
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
@@ -0,0 +1,27 @@
+package generator
+
+import (
+	"context"
+	"testing"
+)
+
+func TestExtractive_JoinsSnippetsAndCollapsesWhitespace(t *testing.T) {
+	got, err := Extractive{}.Generate(context.Background(), Request{
+		Prompt:   "ignored",
+		History:  []Turn{{Role: RoleUser, Content: "ignored"}},
+		Snippets: []string{"  first   snippet ", "second\r\n\r\n  line  two"},
+	})
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	if want := "first snippet\nsecond\nline two"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	if got, _ := (Extractive{}).Generate(context.Background(), Request{Snippets: []string{" a \r\n \n b \n\n c "}}); got != "a\nb\nc" {
+		t.Fatalf("blank lines should be dropped, got %q", got)
+	}
+	if got, _ := (Extractive{}).Generate(context.Background(), Request{}); got != "" {
+		t.Fatalf("expected empty reply without snippets, got %q", got)
+	}
+}
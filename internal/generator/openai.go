@@ -0,0 +1,239 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultSystemPrompt instructs the model to stay within the retrieved context.
+const DefaultSystemPrompt = "You are a market-research assistant. Answer the user's question using only the numbered context passages below. " +
+	"Quote figures exactly as written. If the passages do not answer the question, say that you can't answer it from the provided data. " +
+	"Be concise."
+
+const (
+	defaultRetryBackoff = 200 * time.Millisecond
+	maxRetryAfter       = 30 * time.Second
+	maxErrorBody        = 4 << 10
+)
+
+// ErrEmptyCompletion is returned when the endpoint answers without any text.
+var ErrEmptyCompletion = errors.New("generator: empty completion")
+
+// APIError is a non-2xx response from the completions endpoint.
+type APIError struct {
+	StatusCode int
+	Message    string
+	retryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("generator: HTTP %d: %s", e.StatusCode, e.Message)
+}
+
+// retryable reports whether the request may succeed if repeated.
+func (e *APIError) retryable() bool {
+	return e.StatusCode == http.StatusRequestTimeout ||
+		e.StatusCode == http.StatusTooManyRequests ||
+		e.StatusCode >= http.StatusInternalServerError
+}
+
+// OpenAI generates replies with an OpenAI-compatible chat completions API
+// (OpenAI, Azure-compatible gateways, vLLM, Ollama, llama.cpp server, ...).
+// The zero value is not usable: BaseURL and Model are required.
+type OpenAI struct {
+	BaseURL string // e.g. "https://api.openai.com/v1"; "/chat/completions" is appended
+	APIKey  string // sent as a bearer token when set
+	Model   string
+
+	MaxTokens      int     // completion cap (max_tokens); 0 leaves it to the server
+	MaxInputTokens int     // approximate prompt budget; 0 = unlimited (see Generate)
+	Temperature    float64 // sampling temperature
+
+	Timeout      time.Duration // per attempt; 0 relies on ctx alone
+	MaxRetries   int           // extra attempts after network errors, 408, 429 and 5xx
+	RetryBackoff time.Duration // first retry delay, doubled per attempt; default 200ms
+
+	SystemPrompt string       // default DefaultSystemPrompt
+	HTTPClient   *http.Client // default http.DefaultClient
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type chatRequest struct {
+	Model       string        `json:"model"`
+	Messages    []chatMessage `json:"messages"`
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+	Temperature float64       `json:"temperature"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message chatMessage `json:"message"`
+	} `json:"choices"`
+}
+
+type errorEnvelope struct {
+	Error struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// Generate implements Generator. When MaxInputTokens is set, the oldest
+// history turns and then the lowest-ranked snippets are dropped until the
+// estimated prompt size fits; the best snippet and the prompt are always sent.
+func (g *OpenAI) Generate(ctx context.Context, req Request) (string, error) {
+	body, err := json.Marshal(chatRequest{
+		Model:       g.Model,
+		Messages:    g.messages(req),
+		MaxTokens:   g.MaxTokens,
+		Temperature: g.Temperature,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	backoff := g.RetryBackoff
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+	}
+	for attempt := 0; ; attempt++ {
+		reply, err := g.do(ctx, body)
+		if err == nil {
+			return reply, nil
+		}
+		if attempt >= g.MaxRetries || ctx.Err() != nil {
+			return "", err
+		}
+		wait := backoff << attempt
+		var apiErr *APIError
+		if errors.As(err, &apiErr) {
+			if !apiErr.retryable() {
+				return "", err
+			}
+			if apiErr.retryAfter > wait {
+				wait = apiErr.retryAfter
+			}
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return "", err
+		case <-t.C:
+		}
+	}
+}
+
+// do performs one attempt.
+func (g *OpenAI) do(ctx context.Context, body []byte) (string, error) {
+	if g.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.Timeout)
+		defer cancel()
+	}
+	url := strings.TrimRight(g.BaseURL, "/") + "/chat/completions"
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if g.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+g.APIKey)
+	}
+
+	client := g.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		apiErr := &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(raw))}
+		var env errorEnvelope
+		if json.Unmarshal(raw, &env) == nil && env.Error.Message != "" {
+			apiErr.Message = env.Error.Message
+		}
+		if secs, perr := strconv.Atoi(resp.Header.Get("Retry-After")); perr == nil && secs > 0 {
+			apiErr.retryAfter = min(time.Duration(secs)*time.Second, maxRetryAfter)
+		}
+		return "", apiErr
+	}
+
+	var out chatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("generator: decode response: %w", err)
+	}
+	if len(out.Choices) == 0 {
+		return "", ErrEmptyCompletion
+	}
+	reply := strings.TrimSpace(out.Choices[0].Message.Content)
+	if reply == "" {
+		return "", ErrEmptyCompletion
+	}
+	return reply, nil
+}
+
+// messages builds the chat transcript: a system message carrying the
+// instructions and numbered context passages, the history, then the prompt.
+func (g *OpenAI) messages(req Request) []chatMessage {
+	sys := g.SystemPrompt
+	if sys == "" {
+		sys = DefaultSystemPrompt
+	}
+	history, snippets := req.History, req.Snippets
+
+	if g.MaxInputTokens > 0 {
+		used := estimateTokens(sys) + estimateTokens(req.Prompt)
+		for _, s := range snippets {
+			used += estimateTokens(s)
+		}
+		for _, t := range history {
+			used += estimateTokens(t.Content)
+		}
+		for len(history) > 0 && used > g.MaxInputTokens {
+			used -= estimateTokens(history[0].Content)
+			history = history[1:]
+		}
+		for len(snippets) > 1 && used > g.MaxInputTokens {
+			used -= estimateTokens(snippets[len(snippets)-1])
+			snippets = snippets[:len(snippets)-1]
+		}
+	}
+
+	var ctxText strings.Builder
+	ctxText.WriteString(sys)
+	ctxText.WriteString("\n\nContext:")
+	for i, s := range snippets {
+		fmt.Fprintf(&ctxText, "\n[%d] %s", i+1, s)
+	}
+
+	msgs := make([]chatMessage, 0, len(history)+2)
+	msgs = append(msgs, chatMessage{Role: "system", Content: ctxText.String()})
+	for _, t := range history {
+		msgs = append(msgs, chatMessage{Role: t.Role, Content: t.Content})
+	}
+	return append(msgs, chatMessage{Role: RoleUser, Content: req.Prompt})
+}
+
+// estimateTokens approximates the token count of s (about four characters
+// per token for English text); it only needs to be good enough for budgeting.
+func estimateTokens(s string) int {
+	return (utf8.RuneCountInString(s) + 3) / 4
+}
@@ -0,0 +1,199 @@
+package generator
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// stubServer answers /v1/chat/completions with handler and counts calls.
+func stubServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request, n int32)) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Method != http.MethodPost {
+			http.NotFound(w, r)
+			return
+		}
+		handler(w, r, calls.Add(1))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func completion(w http.ResponseWriter, text string) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": text}}},
+	})
+}
+
+func TestOpenAI_Generate_RequestShape(t *testing.T) {
+	var got chatRequest
+	srv, _ := stubServer(t, func(w http.ResponseWriter, r *http.Request, _ int32) {
+		if r.Header.Get("Authorization") != "Bearer sk-test" {
+			t.Errorf("missing bearer token: %q", r.Header.Get("Authorization"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decode: %v", err)
+		}
+		completion(w, "  12% of Gen Z do.  ")
+	})
+	g := &OpenAI{BaseURL: srv.URL + "/v1/", APIKey: "sk-test", Model: "m", MaxTokens: 64, Temperature: 0.2}
+
+	reply, err := g.Generate(context.Background(), Request{
+		Prompt:   "How many?",
+		History:  []Turn{{Role: RoleUser, Content: "hi"}, {Role: RoleAssistant, Content: "hello"}},
+		Snippets: []string{"12% of Gen Z do.", "Other fact."},
+	})
+	if err != nil || reply != "12% of Gen Z do." {
+		t.Fatalf("reply=%q err=%v", reply, err)
+	}
+	if got.Model != "m" || got.MaxTokens != 64 || got.Temperature != 0.2 {
+		t.Fatalf("unexpected request: %+v", got)
+	}
+	roles := make([]string, len(got.Messages))
+	for i, m := range got.Messages {
+		roles[i] = m.Role
+	}
+	if strings.Join(roles, ",") != "system,user,assistant,user" {
+		t.Fatalf("unexpected roles: %v", roles)
+	}
+	sys := got.Messages[0].Content
+	if !strings.HasPrefix(sys, DefaultSystemPrompt) || !strings.Contains(sys, "[1] 12% of Gen Z do.") || !strings.Contains(sys, "[2] Other fact.") {
+		t.Fatalf("unexpected system message: %q", sys)
+	}
+	if got.Messages[3].Content != "How many?" {
+		t.Fatalf("prompt should be last: %+v", got.Messages)
+	}
+}
+
+func TestOpenAI_Generate_RetriesTransientErrors(t *testing.T) {
+	srv, calls := stubServer(t, func(w http.ResponseWriter, _ *http.Request, n int32) {
+		switch n {
+		case 1:
+			http.Error(w, `{"error":{"message":"overloaded"}}`, http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			http.Error(w, `{"error":{"message":"slow down"}}`, http.StatusTooManyRequests)
+		default:
+			completion(w, "ok")
+		}
+	})
+	g := &OpenAI{BaseURL: srv.URL + "/v1", Model: "m", MaxRetries: 2, RetryBackoff: time.Millisecond}
+	if reply, err := g.Generate(context.Background(), Request{Prompt: "q", Snippets: []string{"s"}}); err != nil || reply != "ok" {
+		t.Fatalf("reply=%q err=%v", reply, err)
+	}
+	if calls.Load() != 3 {
+		t.Fatalf("expected 3 attempts, got %d", calls.Load())
+	}
+}
+
+func TestOpenAI_Generate_Errors(t *testing.T) {
+	t.Run("client error is not retried", func(t *testing.T) {
+		srv, calls := stubServer(t, func(w http.ResponseWriter, _ *http.Request, _ int32) {
+			http.Error(w, `{"error":{"message":"bad model"}}`, http.StatusBadRequest)
+		})
+		g := &OpenAI{BaseURL: srv.URL + "/v1", Model: "m", MaxRetries: 3, RetryBackoff: time.Millisecond}
+		_, err := g.Generate(context.Background(), Request{Prompt: "q", Snippets: []string{"s"}})
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest || apiErr.Message != "bad model" {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if calls.Load() != 1 {
+			t.Fatalf("expected 1 attempt, got %d", calls.Load())
+		}
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		srv, calls := stubServer(t, func(w http.ResponseWriter, _ *http.Request, _ int32) {
+			http.Error(w, "boom", http.StatusInternalServerError)
+		})
+		g := &OpenAI{BaseURL: srv.URL + "/v1", Model: "m", MaxRetries: 1, RetryBackoff: time.Millisecond}
+		if _, err := g.Generate(context.Background(), Request{Prompt: "q", Snippets: []string{"s"}}); err == nil {
+			t.Fatalf("expected error")
+		}
+		if calls.Load() != 2 {
+			t.Fatalf("expected 2 attempts, got %d", calls.Load())
+		}
+	})
+
+	t.Run("per-attempt timeout", func(t *testing.T) {
+		srv, calls := stubServer(t, func(w http.ResponseWriter, r *http.Request, n int32) {
+			if n == 1 {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(200 * time.Millisecond):
+				}
+				return
+			}
+			completion(w, "second try")
+		})
+		g := &OpenAI{BaseURL: srv.URL + "/v1", Model: "m", Timeout: 50 * time.Millisecond, MaxRetries: 1, RetryBackoff: time.Millisecond}
+		if reply, err := g.Generate(context.Background(), Request{Prompt: "q", Snippets: []string{"s"}}); err != nil || reply != "second try" {
+			t.Fatalf("reply=%q err=%v", reply, err)
+		}
+		if calls.Load() != 2 {
+			t.Fatalf("expected 2 attempts, got %d", calls.Load())
+		}
+	})
+
+	t.Run("empty completion", func(t *testing.T) {
+		srv, _ := stubServer(t, func(w http.ResponseWriter, _ *http.Request, _ int32) { completion(w, "  ") })
+		g := &OpenAI{BaseURL: srv.URL + "/v1", Model: "m"}
+		if _, err := g.Generate(context.Background(), Request{Prompt: "q", Snippets: []string{"s"}}); !errors.Is(err, ErrEmptyCompletion) {
+			t.Fatalf("expected ErrEmptyCompletion, got %v", err)
+		}
+	})
+
+	t.Run("cancelled context stops retrying", func(t *testing.T) {
+		srv, calls := stubServer(t, func(w http.ResponseWriter, _ *http.Request, _ int32) {
+			http.Error(w, "boom", http.StatusBadGateway)
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+		defer cancel()
+		g := &OpenAI{BaseURL: srv.URL + "/v1", Model: "m", MaxRetries: 10, RetryBackoff: time.Second}
+		if _, err := g.Generate(ctx, Request{Prompt: "q", Snippets: []string{"s"}}); err == nil {
+			t.Fatalf("expected error")
+		}
+		if calls.Load() != 1 {
+			t.Fatalf("expected 1 attempt before cancel, got %d", calls.Load())
+		}
+	})
+}
+
+func TestOpenAI_Messages_InputTokenBudget(t *testing.T) {
+	long := strings.Repeat("word ", 40) // ~50 tokens
+	req := Request{
+		Prompt:   "q",
+		History:  []Turn{{Role: RoleUser, Content: long}, {Role: RoleAssistant, Content: "short"}},
+		Snippets: []string{long, long, long},
+	}
+
+	// The oldest turn is dropped first.
+	g := &OpenAI{Model: "m", SystemPrompt: "sys", MaxInputTokens: 160}
+	msgs := g.messages(req)
+	if len(msgs) != 3 || msgs[1].Content != "short" || !strings.Contains(msgs[0].Content, "[3]") {
+		t.Fatalf("unexpected transcript: %+v", msgs)
+	}
+
+	// Then the rest of the history, then trailing snippets.
+	g.MaxInputTokens = 110
+	msgs = g.messages(req)
+	if len(msgs) != 2 || !strings.Contains(msgs[0].Content, "[2]") || strings.Contains(msgs[0].Content, "[3]") {
+		t.Fatalf("unexpected transcript: %+v", msgs)
+	}
+
+	// The best snippet and the prompt are always sent.
+	g.MaxInputTokens = 1
+	msgs = g.messages(Request{Prompt: "q", Snippets: []string{long, long}})
+	if len(msgs) != 2 || !strings.Contains(msgs[0].Content, "[1]") || strings.Contains(msgs[0].Content, "[2]") {
+		t.Fatalf("unexpected minimal transcript: %+v", msgs)
+	}
+}
@@ -0,0 +1,99 @@
+// Admin HTTP handlers.
+//
+// This file exposes operational endpoints for the knowledge corpus:
+//   - GET  /admin/corpus          (current corpus version)
+//   - POST /admin/corpus/reload   (rebuild the search index and swap it in)
+//
+// These routes are guarded by a shared admin bearer token at the router level
+// and are only mounted when the configured search index supports reloading.
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tbourn/go-chat-backend/internal/search"
+)
+
+// CorpusReloader is implemented by search indexes that can rebuild their
+// corpus at runtime (see search.Reloadable).
+type CorpusReloader interface {
+	// Reload rebuilds the index; on error the previous corpus keeps serving.
+	Reload() (search.Version, bool, error)
+	// Version reports the corpus currently serving.
+	Version() search.Version
+}
+
+// AdminHandlers groups operational endpoints.
+type AdminHandlers struct {
+	corpus CorpusReloader
+}
+
+// NewAdmin constructs AdminHandlers bound to the given corpus reloader.
+func NewAdmin(corpus CorpusReloader) *AdminHandlers {
+	return &AdminHandlers{corpus: corpus}
+}
+
+// CorpusVersionResponse describes the corpus snapshot serving queries.
+type CorpusVersionResponse struct {
+	// Seq increments on every successful swap (0 = nothing loaded yet).
+	Seq uint64 `json:"seq" example:"3"`
+	// Hash is the hex SHA-256 of the indexed corpus.
+	Hash string `json:"hash" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+	// Docs is the number of indexed paragraphs.
+	Docs int `json:"docs" example:"5000"`
+	// LoadedAt is when the snapshot was swapped in (omitted before the first load).
+	LoadedAt *time.Time `json:"loaded_at,omitempty"`
+	// Changed reports whether a reload swapped in a new snapshot (reload only).
+	Changed *bool `json:"changed,omitempty"`
+}
+
+func corpusVersionResponse(v search.Version) CorpusVersionResponse {
+	resp := CorpusVersionResponse{Seq: v.Seq, Hash: v.Hash, Docs: v.Docs}
+	if !v.LoadedAt.IsZero() {
+		t := v.LoadedAt
+		resp.LoadedAt = &t
+	}
+	return resp
+}
+
+// CorpusVersion godoc
+// @ID          getCorpusVersion
+// @Summary     Current corpus version
+// @Description Returns the sequence number, content hash and size of the corpus currently serving answers.
+// @Tags        Admin
+// @Produce     json
+// @Security    AdminToken
+//
+// @Success     200  {object} handlers.CorpusVersionResponse
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid admin token"
+// @Router      /admin/corpus [get]
+func (h *AdminHandlers) CorpusVersion(c *gin.Context) {
+	ok(c, http.StatusOK, corpusVersionResponse(h.corpus.Version()))
+}
+
+// ReloadCorpus godoc
+// @ID          reloadCorpus
+// @Summary     Reload the corpus
+// @Description Re-reads the corpus file, rebuilds the search index and swaps it in atomically.
+// @Description If the build fails or yields no documents, the previous corpus keeps serving.
+// @Tags        Admin
+// @Produce     json
+// @Security    AdminToken
+//
+// @Success     200  {object} handlers.CorpusVersionResponse
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid admin token"
+// @Failure     500  {object} handlers.ErrorResponse "Reload failed; previous corpus still serving"
+// @Router      /admin/corpus/reload [post]
+func (h *AdminHandlers) ReloadCorpus(c *gin.Context) {
+	v, changed, err := h.corpus.Reload()
+	if err != nil {
+		fail(c, http.StatusInternalServerError, ErrCodeReloadFailed, err.Error())
+		return
+	}
+	resp := corpusVersionResponse(v)
+	resp.Changed = &changed
+	ok(c, http.StatusOK, resp)
+}
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tbourn/go-chat-backend/internal/search"
+)
+
+type stubReloader struct {
+	v       search.Version
+	changed bool
+	err     error
+}
+
+func (s stubReloader) Reload() (search.Version, bool, error) { return s.v, s.changed, s.err }
+func (s stubReloader) Version() search.Version               { return s.v }
+
+func newAdminRouter(rl CorpusReloader) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	ah := NewAdmin(rl)
+	r.GET("/admin/corpus", ah.CorpusVersion)
+	r.POST("/admin/corpus/reload", ah.ReloadCorpus)
+	return r
+}
+
+func TestCorpusVersion_BeforeAndAfterLoad(t *testing.T) {
+	// Nothing loaded → loaded_at omitted.
+	w := httptest.NewRecorder()
+	newAdminRouter(stubReloader{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/corpus", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	var raw map[string]any
+	_ = json.Unmarshal(w.Body.Bytes(), &raw)
+	if _, ok := raw["loaded_at"]; ok {
+		t.Fatalf("loaded_at should be omitted before first load: %s", w.Body.String())
+	}
+	if _, ok := raw["changed"]; ok {
+		t.Fatalf("changed should be omitted on GET: %s", w.Body.String())
+	}
+
+	at := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	w = httptest.NewRecorder()
+	newAdminRouter(stubReloader{v: search.Version{Seq: 2, Hash: "abc", Docs: 10, LoadedAt: at}}).
+		ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/corpus", nil))
+	var resp CorpusVersionResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Seq != 2 || resp.Hash != "abc" || resp.Docs != 10 || resp.LoadedAt == nil || !resp.LoadedAt.Equal(at) {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+}
+
+func TestReloadCorpus_SuccessAndFailure(t *testing.T) {
+	w := httptest.NewRecorder()
+	newAdminRouter(stubReloader{v: search.Version{Seq: 3, Hash: "h", Docs: 1, LoadedAt: time.Now()}, changed: true}).
+		ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/corpus/reload", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	var resp CorpusVersionResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Changed == nil || !*resp.Changed || resp.Seq != 3 {
+		t.Fatalf("unexpected response: %s", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	newAdminRouter(stubReloader{err: errors.New("boom")}).
+		ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/admin/corpus/reload", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d", w.Code)
+	}
+	var er ErrorResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &er)
+	if er.Code != ErrCodeReloadFailed {
+		t.Fatalf("unexpected error code: %+v", er)
+	}
+}
@@ -0,0 +1,199 @@
+// API key HTTP handlers.
+//
+// This file exposes self-service management of API keys:
+//   - POST   /api-keys       (issue a key; the secret is returned only here)
+//   - GET    /api-keys       (list the caller's keys, without secrets)
+//   - DELETE /api-keys/{id}  (revoke a key; idempotent)
+//
+// Keys authenticate server-to-server callers through the X-API-Key header
+// (see middleware.APIKeyAuth). Requests made with an API key may only manage
+// keys when that key holds the admin scope.
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/services"
+)
+
+// APIKeyService defines API key management operations.
+type APIKeyService interface {
+	// Create issues a key for the caller and returns it with its secret.
+	Create(ctx context.Context, caller services.Caller, name string, scopes []string, expiresAt *time.Time) (*domain.APIKey, string, error)
+	// List returns the caller's keys, newest first.
+	List(ctx context.Context, caller services.Caller) ([]domain.APIKey, error)
+	// Revoke revokes a key owned by the caller (or any key, for admins).
+	Revoke(ctx context.Context, caller services.Caller, id string) error
+}
+
+// APIKeyHandlers groups API key endpoints.
+type APIKeyHandlers struct {
+	svc APIKeyService
+}
+
+// NewAPIKeys constructs APIKeyHandlers bound to the given service.
+func NewAPIKeys(svc APIKeyService) *APIKeyHandlers {
+	return &APIKeyHandlers{svc: svc}
+}
+
+// CreateAPIKeyRequest is the JSON payload for issuing an API key.
+type CreateAPIKeyRequest struct {
+	// Name is an optional label shown in listings.
+	Name string `json:"name" binding:"max=100" example:"nightly export"`
+	// Scopes lists the granted scopes: chats:read, chats:write, messages:write, admin.
+	Scopes []string `json:"scopes" binding:"required,min=1" example:"chats:read,messages:write"`
+	// ExpiresAt optionally limits the key's lifetime (RFC 3339, must be in the future).
+	ExpiresAt *time.Time `json:"expires_at,omitempty" example:"2026-01-01T00:00:00Z"`
+}
+
+// APIKeyResponse describes an API key without its secret.
+type APIKeyResponse struct {
+	ID         string     `json:"id" example:"5b0e5c43-4f58-4f47-a5b4-5f2f3d0f3c11"`
+	Name       string     `json:"name" example:"nightly export"`
+	Prefix     string     `json:"prefix" example:"gck_3f9a1c0b7d2e"`
+	Scopes     []string   `json:"scopes" example:"chats:read,messages:write"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CreateAPIKeyResponse is returned once, when a key is issued.
+type CreateAPIKeyResponse struct {
+	APIKeyResponse
+	// Key is the full secret to send as X-API-Key. It cannot be retrieved again.
+	Key string `json:"key" example:"gck_3f9a1c0b7d2e_Jq0dC9m0bq3a2l6m1u5c6P2k0x8yZ3vT4nQ7rS1wE0A"`
+}
+
+// ListAPIKeysResponse lists the caller's API keys.
+type ListAPIKeysResponse struct {
+	APIKeys []APIKeyResponse `json:"api_keys"`
+}
+
+func apiKeyResponse(k domain.APIKey) APIKeyResponse {
+	return APIKeyResponse{
+		ID:         k.ID,
+		Name:       k.Name,
+		Prefix:     k.Prefix,
+		Scopes:     k.ScopeList(),
+		CreatedAt:  k.CreatedAt,
+		ExpiresAt:  k.ExpiresAt,
+		LastUsedAt: k.LastUsedAt,
+		RevokedAt:  k.RevokedAt,
+	}
+}
+
+// CreateAPIKey godoc
+// @ID          createAPIKey
+// @Summary     Issue an API key
+// @Description Issues an API key acting as the current user, limited to the given scopes. The secret is only returned in this response. Only admins may grant the admin scope.
+// @Tags        API Keys
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Security    APIKeyAuth
+//
+// @Param       X-User-ID  header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       body       body    handlers.CreateAPIKeyRequest  true  "API key payload"
+//
+// @Success     201  {object}  handlers.CreateAPIKeyResponse
+// @Failure     400  {object}  handlers.ErrorResponse  "Bad request (unknown scope, past expiry)"
+// @Failure     401  {object}  handlers.ErrorResponse  "Missing or invalid credentials"
+// @Failure     403  {object}  handlers.ErrorResponse  "Admin scope requested by a non-admin, or API key without the admin scope"
+// @Failure     500  {object}  handlers.ErrorResponse  "Internal error"
+// @Router      /api-keys [post]
+func (h *APIKeyHandlers) CreateAPIKey(c *gin.Context) {
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "invalid JSON body: name (max 100 chars) and scopes are expected")
+		return
+	}
+
+	k, secret, err := h.svc.Create(c.Request.Context(), caller(c), req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidScope), errors.Is(err, services.ErrInvalidExpiry):
+			fail(c, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+		case errors.Is(err, services.ErrScopeNotAllowed):
+			fail(c, http.StatusForbidden, ErrCodeForbidden, err.Error())
+		default:
+			fail(c, http.StatusInternalServerError, ErrCodeCreateFailed, err.Error())
+		}
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	ok(c, http.StatusCreated, CreateAPIKeyResponse{APIKeyResponse: apiKeyResponse(*k), Key: secret})
+}
+
+// ListAPIKeys godoc
+// @ID          listAPIKeys
+// @Summary     List API keys
+// @Description Returns the current user's API keys (including revoked and expired ones), newest first. Secrets are never returned.
+// @Tags        API Keys
+// @Produce     json
+// @Security    BearerAuth
+// @Security    APIKeyAuth
+//
+// @Param       X-User-ID  header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+//
+// @Success     200  {object} handlers.ListAPIKeysResponse
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid credentials"
+// @Failure     403  {object} handlers.ErrorResponse "API key without the admin scope"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /api-keys [get]
+func (h *APIKeyHandlers) ListAPIKeys(c *gin.Context) {
+	keys, err := h.svc.List(c.Request.Context(), caller(c))
+	if err != nil {
+		fail(c, http.StatusInternalServerError, ErrCodeListFailed, err.Error())
+		return
+	}
+	resp := ListAPIKeysResponse{APIKeys: make([]APIKeyResponse, 0, len(keys))}
+	for _, k := range keys {
+		resp.APIKeys = append(resp.APIKeys, apiKeyResponse(k))
+	}
+	ok(c, http.StatusOK, resp)
+}
+
+// RevokeAPIKey godoc
+// @ID          revokeAPIKey
+// @Summary     Revoke an API key
+// @Description Revokes one of the current user's API keys (admins may revoke any key). Revoking twice is a no-op.
+// @Tags        API Keys
+// @Produce     json
+// @Security    BearerAuth
+// @Security    APIKeyAuth
+//
+// @Param       X-User-ID  header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       id         path    string  true  "API key ID (UUID)"  format(uuid) example(5b0e5c43-4f58-4f47-a5b4-5f2f3d0f3c11)
+//
+// @Success     204  {string} string "No Content"
+// @Failure     400  {object} handlers.ErrorResponse "Bad request"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid credentials"
+// @Failure     403  {object} handlers.ErrorResponse "API key without the admin scope"
+// @Failure     404  {object} handlers.ErrorResponse "API key not found"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /api-keys/{id} [delete]
+func (h *APIKeyHandlers) RevokeAPIKey(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "api key id must be a UUID")
+		return
+	}
+
+	if err := h.svc.Revoke(c.Request.Context(), caller(c), id); err != nil {
+		if errors.Is(err, services.ErrAPIKeyNotFound) {
+			fail(c, http.StatusNotFound, ErrCodeNotFound, "api key not found")
+			return
+		}
+		fail(c, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		return
+	}
+	noContent(c)
+}
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/services"
+)
+
+type stubAPIKeySvc struct {
+	createErr error
+	revokeErr error
+	gotCaller services.Caller
+	gotScopes []string
+}
+
+func (s *stubAPIKeySvc) Create(_ context.Context, who services.Caller, name string, scopes []string, exp *time.Time) (*domain.APIKey, string, error) {
+	s.gotCaller, s.gotScopes = who, scopes
+	if s.createErr != nil {
+		return nil, "", s.createErr
+	}
+	return &domain.APIKey{ID: "k1", UserID: who.UserID, Name: name, Prefix: "gck_abc", SecretHash: "hash", Scopes: strings.Join(scopes, " "), ExpiresAt: exp}, "gck_abc_secret", nil
+}
+
+func (s *stubAPIKeySvc) List(_ context.Context, who services.Caller) ([]domain.APIKey, error) {
+	return []domain.APIKey{{ID: "k1", UserID: who.UserID, Prefix: "gck_abc", SecretHash: "hash", Scopes: "chats:read"}}, nil
+}
+
+func (s *stubAPIKeySvc) Revoke(_ context.Context, _ services.Caller, _ string) error {
+	return s.revokeErr
+}
+
+func newAPIKeyRouter(svc APIKeyService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	h := NewAPIKeys(svc)
+	r.POST("/api-keys", h.CreateAPIKey)
+	r.GET("/api-keys", h.ListAPIKeys)
+	r.DELETE("/api-keys/:id", h.RevokeAPIKey)
+	return r
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	cases := []struct {
+		name string
+		body string
+		err  error
+		want int
+	}{
+		{"created", `{"name":"job","scopes":["chats:read"]}`, nil, http.StatusCreated},
+		{"no scopes", `{"name":"job"}`, nil, http.StatusBadRequest},
+		{"name too long", `{"name":"` + strings.Repeat("n", 101) + `","scopes":["chats:read"]}`, nil, http.StatusBadRequest},
+		{"unknown scope", `{"scopes":["x"]}`, services.ErrInvalidScope, http.StatusBadRequest},
+		{"past expiry", `{"scopes":["chats:read"],"expires_at":"2000-01-01T00:00:00Z"}`, services.ErrInvalidExpiry, http.StatusBadRequest},
+		{"admin by user", `{"scopes":["admin"]}`, services.ErrScopeNotAllowed, http.StatusForbidden},
+		{"store failure", `{"scopes":["chats:read"]}`, errors.New("db"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			svc := &stubAPIKeySvc{createErr: tc.err}
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/api-keys", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-User-ID", "u1")
+			newAPIKeyRouter(svc).ServeHTTP(w, req)
+			if w.Code != tc.want {
+				t.Fatalf("status = %d; want %d (body=%s)", w.Code, tc.want, w.Body.String())
+			}
+			if tc.want != http.StatusCreated {
+				return
+			}
+			var resp CreateAPIKeyResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if resp.Key != "gck_abc_secret" || resp.Prefix != "gck_abc" || len(resp.Scopes) != 1 || svc.gotCaller.UserID != "u1" {
+				t.Fatalf("unexpected response %+v (caller %+v)", resp, svc.gotCaller)
+			}
+			if w.Header().Get("Cache-Control") != "no-store" || strings.Contains(w.Body.String(), "hash") {
+				t.Fatalf("secret response must not be cached or leak the hash: %v %s", w.Header(), w.Body.String())
+			}
+		})
+	}
+}
+
+func TestListAndRevokeAPIKeys(t *testing.T) {
+	w := httptest.NewRecorder()
+	newAPIKeyRouter(&stubAPIKeySvc{}).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api-keys", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"scopes":["chats:read"]`) ||
+		strings.Contains(w.Body.String(), "hash") || strings.Contains(w.Body.String(), `"key"`) {
+		t.Fatalf("list: %d %s", w.Code, w.Body.String())
+	}
+
+	id := uuid.NewString()
+	cases := []struct {
+		name string
+		path string
+		err  error
+		want int
+	}{
+		{"revoked", "/api-keys/" + id, nil, http.StatusNoContent},
+		{"bad id", "/api-keys/nope", nil, http.StatusBadRequest},
+		{"not found", "/api-keys/" + id, services.ErrAPIKeyNotFound, http.StatusNotFound},
+		{"store failure", "/api-keys/" + id, errors.New("db"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		w := httptest.NewRecorder()
+		newAPIKeyRouter(&stubAPIKeySvc{revokeErr: tc.err}).ServeHTTP(w, httptest.NewRequest(http.MethodDelete, tc.path, nil))
+		if w.Code != tc.want {
+			t.Fatalf("%s: status = %d; want %d", tc.name, w.Code, tc.want)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+// Conversation branch HTTP handlers.
+//
+// This file exposes message edits and the branches they create:
+//   - PUT /messages/{id}               (edit a user message; answered on a new branch)
+//   - GET /messages/{id}/branches      (list the branches at a message)
+//   - PUT /chats/{id}/active-branch    (choose the branch the chat shows)
+//
+// Editing never rewrites history: the edited prompt is stored next to the
+// original with its own reply and becomes the active branch, and the
+// original branch stays available through the branches endpoint.
+// GET /chats/{id}/messages lists the active branch by default.
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/services"
+)
+
+// MessageBranch is one branch at a message: the message starting it and
+// whether it is part of the chat's active branch.
+type MessageBranch struct {
+	Message domain.Message `json:"message"`
+	Active  bool           `json:"active" example:"true"`
+}
+
+// ListBranchesResponse lists the branches at a message, oldest first.
+type ListBranchesResponse struct {
+	Branches []MessageBranch `json:"branches"`
+}
+
+// SelectBranchRequest is the JSON payload for choosing a chat's active branch.
+type SelectBranchRequest struct {
+	// MessageID is any message of the branch to show; the branch continues
+	// to its newest message.
+	MessageID string `json:"message_id" binding:"required" example:"fa4dfbe0-c3bf-47bd-b32f-d7de221cf43b"`
+}
+
+// EditMessage godoc
+// @ID          editMessage
+// @Summary     Edit a user message
+// @Description Answers a new version of a user message: the content is stored next to the original (same parent) with a fresh assistant reply.
+// @Description The new branch becomes the chat's active branch; the original and the conversation after it are kept (see listBranches).
+// @Tags        Messages
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+//
+// @Param       X-User-ID        header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       Idempotency-Key  header  string  false "Idempotency key for safe retries (UUID recommended)"
+// @Param       id               path    string  true  "Message ID (UUID)"  format(uuid)
+// @Param       debug            query   bool    false "Include retrieval_query (the context-rewritten search query) in the reply"
+// @Param       body             body    handlers.PostMessageRequest  true  "New content of the message"
+//
+// @Success     200  {object}  handlers.PostMessageResponse  "Assistant reply (its parent_id is the new user message)"
+// @Failure     400  {object}  handlers.ErrorResponse        "Bad request, or not a user message"
+// @Failure     401  {object}  handlers.ErrorResponse        "Missing or invalid bearer token"
+// @Failure     403  {object}  handlers.ErrorResponse        "Not allowed to post to this chat"
+// @Failure     404  {object}  handlers.ErrorResponse        "Message not found"
+// @Failure     429  {object}  handlers.ErrorResponse        "Usage quota exceeded (quota_exceeded)"
+// @Failure     500  {object}  handlers.ErrorResponse        "Internal error"
+// @Router      /messages/{id} [put]
+func (h *Handlers) EditMessage(c *gin.Context) {
+	messageID := c.Param("id")
+	if _, err := uuid.Parse(messageID); err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "message id must be a UUID")
+		return
+	}
+	content, maxRunes, valid := h.bindContent(c)
+	if !valid {
+		return
+	}
+
+	m, err := h.msgSvc.Edit(c.Request.Context(), caller(c), messageID, content)
+	switch {
+	case errors.Is(err, services.ErrMessageNotFound):
+		fail(c, http.StatusNotFound, ErrCodeNotFound, "message not found")
+		return
+	case errors.Is(err, services.ErrNotEditable):
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "only user messages can be edited")
+		return
+	case errors.Is(err, services.ErrForbidden):
+		fail(c, http.StatusForbidden, ErrCodeForbidden, "not allowed to post to this chat")
+		return
+	case err != nil:
+		failAnswer(c, err, maxRunes)
+		return
+	}
+
+	if !retrievalDebug(c) {
+		m.RetrievalQuery = ""
+	}
+	ok(c, http.StatusOK, PostMessageResponse{Message: m})
+}
+
+// ListBranches godoc
+// @ID          listBranches
+// @Summary     List the branches at a message
+// @Description Returns the message and the others following the same parent (edits of a user message and the original), oldest first.
+// @Description active marks the one on the chat's active branch; choose another with selectBranch.
+// @Tags        Messages
+// @Produce     json
+// @Security    BearerAuth
+//
+// @Param       X-User-ID  header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       id         path    string  true  "Message ID (UUID)"  format(uuid)
+//
+// @Success     200  {object} handlers.ListBranchesResponse
+// @Failure     400  {object} handlers.ErrorResponse "Bad request"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid bearer token"
+// @Failure     404  {object} handlers.ErrorResponse "Message not found"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /messages/{id}/branches [get]
+func (h *Handlers) ListBranches(c *gin.Context) {
+	messageID := c.Param("id")
+	if _, err := uuid.Parse(messageID); err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "message id must be a UUID")
+		return
+	}
+
+	branches, err := h.msgSvc.ListBranches(c.Request.Context(), caller(c), messageID)
+	switch {
+	case errors.Is(err, services.ErrMessageNotFound):
+		fail(c, http.StatusNotFound, ErrCodeNotFound, "message not found")
+		return
+	case err != nil:
+		fail(c, http.StatusInternalServerError, ErrCodeListFailed, err.Error())
+		return
+	}
+	out := make([]MessageBranch, len(branches))
+	for i, b := range branches {
+		out[i] = MessageBranch{Message: b.Message, Active: b.Active}
+	}
+	ok(c, http.StatusOK, ListBranchesResponse{Branches: out})
+}
+
+// SelectBranch godoc
+// @ID          selectBranch
+// @Summary     Choose a chat's active branch
+// @Description Makes the branch through message_id the chat's active branch, continued to its newest message.
+// @Description GET /chats/{id}/messages then lists it, and new messages are appended to it.
+// @Tags        Messages
+// @Accept      json
+// @Security    BearerAuth
+//
+// @Param       X-User-ID  header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       id         path    string  true  "Chat ID (UUID)"  format(uuid)
+// @Param       body       body    handlers.SelectBranchRequest  true  "Message of the branch"
+//
+// @Success     204  {string} string "No Content"
+// @Failure     400  {object} handlers.ErrorResponse "Bad request"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid bearer token"
+// @Failure     403  {object} handlers.ErrorResponse "Not allowed to post to this chat"
+// @Failure     404  {object} handlers.ErrorResponse "Chat or message not found"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /chats/{id}/active-branch [put]
+func (h *Handlers) SelectBranch(c *gin.Context) {
+	chatID := c.Param("id")
+	if _, err := uuid.Parse(chatID); err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "chat id must be a UUID")
+		return
+	}
+	var req SelectBranchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "message_id required")
+		return
+	}
+	if _, err := uuid.Parse(req.MessageID); err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "message_id must be a UUID")
+		return
+	}
+
+	err := h.msgSvc.SelectBranch(c.Request.Context(), caller(c), chatID, req.MessageID)
+	switch {
+	case errors.Is(err, services.ErrMessageNotFound):
+		fail(c, http.StatusNotFound, ErrCodeNotFound, "message not found")
+		return
+	case errors.Is(err, services.ErrForbidden):
+		fail(c, http.StatusForbidden, ErrCodeForbidden, "not allowed to post to this chat")
+		return
+	case err != nil:
+		failChat(c, err)
+		return
+	}
+	noContent(c)
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/repo"
+	"github.com/tbourn/go-chat-backend/internal/services"
+)
+
+func TestBranchEndpoints(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	ch, _ := repo.CreateChat(context.Background(), db, domain.DefaultWorkspaceID, "u1", "t")
+	q, _ := repo.CreateMessage(db, ch.ID, "user", "first question", nil)
+	a, _ := repo.CreateMessage(db, ch.ID, "assistant", "first answer", nil)
+
+	h := New(stubChatSvc{}, &services.MessageService{DB: db}, nil)
+	r := gin.New()
+	r.GET("/chats/:id/messages", h.ListMessages)
+	r.PUT("/chats/:id/active-branch", h.SelectBranch)
+	r.PUT("/messages/:id", h.EditMessage)
+	r.GET("/messages/:id/branches", h.ListBranches)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User-ID", "u1")
+		r.ServeHTTP(w, req)
+		return w
+	}
+	contents := func(query string) []string {
+		w := do(http.MethodGet, "/chats/"+ch.ID+"/messages"+query, "")
+		var resp ListMessagesResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil || w.Code != http.StatusOK {
+			t.Fatalf("list%s -> %d %s", query, w.Code, w.Body.String())
+		}
+		out := make([]string, len(resp.Messages))
+		for i, m := range resp.Messages {
+			out[i] = m.Content
+		}
+		return out
+	}
+
+	w := do(http.MethodPut, "/messages/"+q.ID, `{"content":"  second question "}`)
+	var edited PostMessageResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &edited); err != nil || w.Code != http.StatusOK ||
+		edited.Message.Role != "assistant" || *edited.Message.ParentID == q.ID {
+		t.Fatalf("edit -> %d %s", w.Code, w.Body.String())
+	}
+	if got := contents(""); len(got) != 2 || got[0] != "second question" {
+		t.Fatalf("active branch = %v", got)
+	}
+	if got := contents("?branch=all"); len(got) != 4 {
+		t.Fatalf("all branches = %v", got)
+	}
+
+	w = do(http.MethodGet, "/messages/"+q.ID+"/branches", "")
+	var branches ListBranchesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &branches); err != nil || w.Code != http.StatusOK || len(branches.Branches) != 2 ||
+		branches.Branches[0].Message.ID != q.ID || branches.Branches[0].Active || !branches.Branches[1].Active {
+		t.Fatalf("branches -> %d %s", w.Code, w.Body.String())
+	}
+
+	if w := do(http.MethodPut, "/chats/"+ch.ID+"/active-branch", `{"message_id":"`+q.ID+`"}`); w.Code != http.StatusNoContent {
+		t.Fatalf("select -> %d %s", w.Code, w.Body.String())
+	}
+	if got := contents(""); len(got) != 2 || got[0] != "first question" || got[1] != "first answer" {
+		t.Fatalf("after select = %v", got)
+	}
+
+	for _, tc := range []struct {
+		method, path, body string
+		want               int
+	}{
+		{http.MethodGet, "/chats/" + ch.ID + "/messages?branch=mine", "", http.StatusBadRequest},
+		{http.MethodPut, "/messages/not-a-uuid", `{"content":"x"}`, http.StatusBadRequest},
+		{http.MethodPut, "/messages/" + q.ID, `{"content":""}`, http.StatusBadRequest},
+		{http.MethodPut, "/messages/" + a.ID, `{"content":"x"}`, http.StatusBadRequest},
+		{http.MethodPut, "/messages/" + uuid.NewString(), `{"content":"x"}`, http.StatusNotFound},
+		{http.MethodGet, "/messages/not-a-uuid/branches", "", http.StatusBadRequest},
+		{http.MethodGet, "/messages/" + uuid.NewString() + "/branches", "", http.StatusNotFound},
+		{http.MethodPut, "/chats/not-a-uuid/active-branch", `{"message_id":"` + q.ID + `"}`, http.StatusBadRequest},
+		{http.MethodPut, "/chats/" + ch.ID + "/active-branch", `{}`, http.StatusBadRequest},
+		{http.MethodPut, "/chats/" + ch.ID + "/active-branch", `{"message_id":"m1"}`, http.StatusBadRequest},
+		{http.MethodPut, "/chats/" + ch.ID + "/active-branch", `{"message_id":"` + uuid.NewString() + `"}`, http.StatusNotFound},
+		{http.MethodPut, "/chats/" + uuid.NewString() + "/active-branch", `{"message_id":"` + q.ID + `"}`, http.StatusNotFound},
+	} {
+		if w := do(tc.method, tc.path, tc.body); w.Code != tc.want {
+			t.Fatalf("%s %s -> %d, want %d (%s)", tc.method, tc.path, w.Code, tc.want, w.Body.String())
+		}
+	}
+}
@@ -2,8 +2,15 @@
 //
 // This file exposes REST endpoints for chat resources:
 //   - POST   /chats               (create)
-//   - GET    /chats               (list, paginated, ETag support)
-//   - PUT    /chats/{id}/title    (rename)
+//   - GET    /chats               (list, offset or cursor paginated, ETag support)
+//   - GET    /chats/{id}          (read, strong ETag support)
+//   - PUT    /chats/{id}/title    (rename, If-Match support)
+//   - DELETE /chats/{id}          (soft delete, If-Match support)
+//   - POST   /chats/{id}/restore  (undo delete within the grace window)
+//
+// Sharing endpoints live in share_handler.go. Access control (ownership,
+// shares, admin override) is enforced by the services; handlers only pass
+// the caller along and map the resulting errors.
 //
 // Handlers are transport-thin: they validate input, call application services,
 // and translate results into HTTP responses (including conditional responses).
@@ -11,15 +18,19 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 
 	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/http/middleware"
+	"github.com/tbourn/go-chat-backend/internal/pagination"
 	"github.com/tbourn/go-chat-backend/internal/repo"
 	"github.com/tbourn/go-chat-backend/internal/services"
 	"github.com/tbourn/go-chat-backend/internal/utils"
@@ -34,14 +45,31 @@ import (
 // Implementations should be safe for concurrent use and must honor the
 // provided context for cancellation and timeouts.
 type ChatService interface {
-	// Create starts a new chat for userID with an optional title.
-	Create(ctx context.Context, userID, title string) (*domain.Chat, error)
-	// List returns all chats for a user (legacy, non-paginated).
-	List(ctx context.Context, userID string) ([]domain.Chat, error)
-	// ListPage returns a page of chats for a user and the total count.
-	ListPage(ctx context.Context, userID string, page, pageSize int) ([]domain.Chat, int64, error)
-	// UpdateTitle renames a chat that belongs to userID.
-	UpdateTitle(ctx context.Context, userID, chatID, title string) error
+	// Create starts a new chat for the caller with an optional title.
+	Create(ctx context.Context, caller services.Caller, title string) (*domain.Chat, error)
+	// List returns all chats of the caller (legacy, non-paginated).
+	List(ctx context.Context, caller services.Caller) ([]domain.Chat, error)
+	// ListPage returns a page of the caller's chats and the total count.
+	ListPage(ctx context.Context, caller services.Caller, page, pageSize int) ([]domain.Chat, int64, error)
+	// ListKeyset returns a keyset page of the caller's chats and whether
+	// more follow in the paging direction.
+	ListKeyset(ctx context.Context, caller services.Caller, p pagination.Page) ([]domain.Chat, bool, error)
+	// Get returns a chat the caller may read.
+	Get(ctx context.Context, caller services.Caller, chatID string) (*domain.Chat, error)
+	// UpdateTitle renames a chat the caller may manage and returns it; when
+	// version > 0 the chat must still be at that version.
+	UpdateTitle(ctx context.Context, caller services.Caller, chatID, title string, version int64) (*domain.Chat, error)
+	// Delete soft-deletes a chat the caller may manage; when version > 0 the
+	// chat must still be at that version.
+	Delete(ctx context.Context, caller services.Caller, chatID string, version int64) error
+	// Restore undoes Delete within the grace window and returns the chat.
+	Restore(ctx context.Context, caller services.Caller, chatID string) (*domain.Chat, error)
+	// Share grants userID access to a chat the caller may manage.
+	Share(ctx context.Context, caller services.Caller, chatID, userID string) error
+	// Unshare revokes userID's access to a chat the caller may manage.
+	Unshare(ctx context.Context, caller services.Caller, chatID, userID string) error
+	// ListShares returns the users a chat the caller may manage is shared with.
+	ListShares(ctx context.Context, caller services.Caller, chatID string) ([]domain.ChatShare, error)
 }
 
 // MessageService defines message retrieval and generation operations.
@@ -50,9 +78,20 @@ type ChatService interface {
 // provided context for cancellation and timeouts.
 type MessageService interface {
 	// Answer appends a user prompt and an assistant reply to a chat atomically.
-	Answer(ctx context.Context, userID, chatID, prompt string) (*domain.Message, error)
-	// ListPage returns a page of messages within a chat and the total count.
-	ListPage(ctx context.Context, chatID string, page, pageSize int) ([]domain.Message, int64, error)
+	Answer(ctx context.Context, caller services.Caller, chatID, prompt string) (*domain.Message, error)
+	// ListPage returns a page of the messages of view within a chat and
+	// their total count.
+	ListPage(ctx context.Context, caller services.Caller, chatID string, view services.MessageView, page, pageSize int) ([]domain.Message, int64, error)
+	// ListKeyset returns a keyset page of the messages of view within a chat
+	// and whether more follow in the paging direction.
+	ListKeyset(ctx context.Context, caller services.Caller, chatID string, view services.MessageView, p pagination.Page) ([]domain.Message, bool, error)
+	// Edit answers a new version of a user message on a new branch and
+	// returns the reply.
+	Edit(ctx context.Context, caller services.Caller, messageID, prompt string) (*domain.Message, error)
+	// ListBranches returns the branches at a message.
+	ListBranches(ctx context.Context, caller services.Caller, messageID string) ([]services.Branch, error)
+	// SelectBranch makes the branch through a message the chat's active one.
+	SelectBranch(ctx context.Context, caller services.Caller, chatID, messageID string) error
 }
 
 // FeedbackService defines operations to capture user feedback on messages.
@@ -60,8 +99,8 @@ type MessageService interface {
 // Implementations should be safe for concurrent use and must honor the
 // provided context for cancellation and timeouts.
 type FeedbackService interface {
-	// Leave submits a feedback value (-1 or 1) for messageID by userID.
-	Leave(ctx context.Context, userID, messageID string, value int) error
+	// Leave submits a feedback value (-1 or 1) for messageID by the caller.
+	Leave(ctx context.Context, caller services.Caller, messageID string, value int) error
 }
 
 //
@@ -75,16 +114,35 @@ type Handlers struct {
 	chatSvc ChatService
 	msgSvc  MessageService
 	fbSvc   FeedbackService
+
+	// streamWriteTimeout extends the write deadline per streamed event.
+	streamWriteTimeout time.Duration
+
+	// cursors signs the pagination cursors of list responses.
+	cursors *pagination.Codec
 }
 
 // New constructs and returns a Handlers instance bound to the given services.
+// Pagination cursors are signed with a random key until WithCursorKey is
+// called.
 func New(chatSvc ChatService, msgSvc MessageService, fbSvc FeedbackService) *Handlers {
-	return &Handlers{chatSvc: chatSvc, msgSvc: msgSvc, fbSvc: fbSvc}
+	return &Handlers{chatSvc: chatSvc, msgSvc: msgSvc, fbSvc: fbSvc, cursors: pagination.NewCodec(nil)}
 }
 
-// userID extracts the authenticated user id from Gin context (set by upstream
-// middleware). If absent, it falls back to "X-User-ID" header (tests use it),
-// and finally to "demo-user". It never touches c.Request if it's nil.
+// WithCursorKey sets the HMAC key signing pagination cursors. Replicas must
+// share it for cursors to work across them and across restarts; an empty
+// key keeps the random per-process key.
+func (h *Handlers) WithCursorKey(key []byte) *Handlers {
+	if len(key) > 0 {
+		h.cursors = pagination.NewCodec(key)
+	}
+	return h
+}
+
+// userID extracts the authenticated user id from Gin context (set by the auth
+// middleware, see middleware.Authenticate). If absent, which only happens when
+// handlers are mounted without it (tests), it falls back to the "X-User-ID"
+// header and finally to "demo-user". It never touches c.Request if it's nil.
 func userID(c *gin.Context) string {
 	if v, ok := c.Get("userID"); ok {
 		if s, ok := v.(string); ok && s != "" {
@@ -99,6 +157,35 @@ func userID(c *gin.Context) string {
 	return "demo-user"
 }
 
+// caller builds the services.Caller for the request: the user from userID,
+// the admin flag set by the auth middleware for admin-role tokens, and the
+// workspace selected by the workspace middleware.
+func caller(c *gin.Context) services.Caller {
+	return services.Caller{
+		UserID:      userID(c),
+		Admin:       c.GetBool(middleware.ContextKeyAdmin),
+		WorkspaceID: c.GetString(middleware.ContextKeyWorkspaceID),
+	}
+}
+
+// failChat maps a ChatService error to the error response.
+func failChat(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrChatNotFound), errors.Is(err, gorm.ErrRecordNotFound):
+		fail(c, http.StatusNotFound, ErrCodeNotFound, "chat not found")
+	case errors.Is(err, services.ErrForbidden):
+		fail(c, http.StatusForbidden, ErrCodeForbidden, "only the chat owner can do this")
+	case errors.Is(err, services.ErrInvalidShare):
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+	case errors.Is(err, services.ErrVersionConflict):
+		fail(c, http.StatusPreconditionFailed, ErrCodePreconditionFailed, "chat has been modified (If-Match does not match its ETag)")
+	case errors.Is(err, services.ErrRestoreExpired):
+		fail(c, http.StatusGone, ErrCodeRestoreExpired, err.Error())
+	default:
+		fail(c, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+	}
+}
+
 //
 // DTOs
 //
@@ -124,10 +211,24 @@ type Pagination struct {
 	HasNext    bool  `json:"has_next"`
 }
 
-// ListChatsResponse wraps a page of chats and pagination information.
+// CursorPage carries pagination metadata for list responses in cursor mode.
+// Pass NextCursor as "after" to get the following page and PrevCursor as
+// "before" to get the preceding one; each is only set when that page exists.
+type CursorPage struct {
+	PageSize   int    `json:"page_size"`
+	Order      string `json:"order" enums:"asc,desc"`
+	HasNext    bool   `json:"has_next"`
+	HasPrev    bool   `json:"has_prev"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
+
+// ListChatsResponse wraps a page of chats and pagination information:
+// Pagination in offset mode, Cursor in cursor mode.
 type ListChatsResponse struct {
 	Chats      []domain.Chat `json:"chats"`
-	Pagination Pagination    `json:"pagination"`
+	Pagination *Pagination   `json:"pagination,omitempty"`
+	Cursor     *CursorPage   `json:"cursor,omitempty"`
 }
 
 //
@@ -156,6 +257,70 @@ func clampPagination(c *gin.Context) (page, pageSize int) {
 	return
 }
 
+// chatPosition returns the list position of a chat.
+func chatPosition(ch domain.Chat) pagination.Cursor {
+	return pagination.Cursor{CreatedAt: ch.CreatedAt, ID: ch.ID}
+}
+
+// keysetPage parses the cursor-mode query parameters of a list: "after" or
+// "before" holds a cursor token of the list identified by scope (empty to
+// start at the beginning or the end of the list), "order" is asc or desc
+// (desc by default when desc is set) and page_size is clamped as in offset
+// mode. ok is false when the request uses offset mode (neither after nor
+// before is present).
+func (h *Handlers) keysetPage(c *gin.Context, scope string, desc bool) (p pagination.Page, ok bool, err error) {
+	after, hasAfter := c.GetQuery("after")
+	before, hasBefore := c.GetQuery("before")
+	if !hasAfter && !hasBefore {
+		return p, false, nil
+	}
+	if hasAfter && hasBefore {
+		return p, true, errors.New("use either after or before, not both")
+	}
+	switch c.Query("order") {
+	case "":
+	case "asc":
+		desc = false
+	case "desc":
+		desc = true
+	default:
+		return p, true, errors.New("order must be asc or desc")
+	}
+	_, p.Limit = clampPagination(c)
+	p.Desc, p.Backward = desc, hasBefore
+	if token := after + before; token != "" {
+		cur, err := h.cursors.Decode(scope, token)
+		if err != nil {
+			return p, true, err
+		}
+		p.Cursor = &cur
+	}
+	return p, true, nil
+}
+
+// cursorPage builds the cursor metadata of a keyset page of items, where
+// more reports whether items follow in the paging direction and pos returns
+// the position of an item.
+func cursorPage[T any](h *Handlers, scope string, p pagination.Page, items []T, more bool, pos func(T) pagination.Cursor) *CursorPage {
+	out := &CursorPage{PageSize: p.Limit, Order: "asc"}
+	if p.Desc {
+		out.Order = "desc"
+	}
+	if len(items) == 0 {
+		return out
+	}
+	// Paging from a cursor means there are items on the other side of it.
+	out.HasNext = (more && !p.Backward) || (p.Cursor != nil && p.Backward)
+	out.HasPrev = (more && p.Backward) || (p.Cursor != nil && !p.Backward)
+	if out.HasNext {
+		out.NextCursor = h.cursors.Encode(scope, pos(items[len(items)-1]))
+	}
+	if out.HasPrev {
+		out.PrevCursor = h.cursors.Encode(scope, pos(items[0]))
+	}
+	return out
+}
+
 //
 // Handlers
 //
@@ -167,12 +332,18 @@ func clampPagination(c *gin.Context) (page, pageSize int) {
 // @Tags        Chats
 // @Accept      json
 // @Produce     json
+// @Security    BearerAuth
 //
-// @Param       X-User-ID  header  string  false "User ID (demo header)"  example(user123)
-// @Param       body       body    handlers.CreateChatRequest  true  "Create chat payload"
+// @Param       X-User-ID        header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       Idempotency-Key  header  string  false "Idempotency key for safe retries (UUID recommended)"
+// @Param       body             body    handlers.CreateChatRequest  true  "Create chat payload"
 //
 // @Success     201  {object}  domain.Chat
 // @Failure     400  {object}  handlers.ErrorResponse  "Bad request"
+// @Failure     401  {object}  handlers.ErrorResponse  "Missing or invalid bearer token"
+// @Failure     409  {object}  handlers.ErrorResponse  "A request with this Idempotency-Key is in flight (idempotency_in_flight)"
+// @Failure     422  {object}  handlers.ErrorResponse  "Idempotency-Key reused with a different body (idempotency_key_reused)"
+// @Failure     429  {object}  handlers.ErrorResponse  "Usage quota exceeded (quota_exceeded)"
 // @Failure     500  {object}  handlers.ErrorResponse  "Internal error"
 // @Router      /chats [post]
 func (h *Handlers) CreateChat(c *gin.Context) {
@@ -183,7 +354,7 @@ func (h *Handlers) CreateChat(c *gin.Context) {
 	}
 	title := strings.TrimSpace(req.Title)
 
-	ch, err := h.chatSvc.Create(c.Request.Context(), userID(c), title)
+	ch, err := h.chatSvc.Create(c.Request.Context(), caller(c), title)
 	if err != nil {
 		fail(c, http.StatusInternalServerError, ErrCodeCreateFailed, err.Error())
 		return
@@ -194,26 +365,38 @@ func (h *Handlers) CreateChat(c *gin.Context) {
 // ListChats godoc
 // @ID          listChats
 // @Summary     List chats (paginated)
-// @Description Returns a page of the user's chats. Supports weak ETag via If-None-Match and may return 304.
+// @Description Returns a page of the user's chats, newest first. Supports weak ETag via If-None-Match and may return 304.
+// @Description Offset mode (page, page_size) returns pagination with totals. Cursor mode, selected by after or before, returns
+// @Description cursor with signed next_cursor/prev_cursor tokens; pages do not shift when chats are created in between.
 // @Tags        Chats
 // @Produce     json
+// @Security    BearerAuth
 //
-// @Param       X-User-ID      header  string  false "User ID (demo header)"       example(user123)
-// @Param       If-None-Match  header  string  false "Return 304 if ETag matches"  example(W/\"abc123\")
+// @Param       X-User-ID      header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       If-None-Match  header  string  false "Return 304 if one of the listed ETags (or *) matches"  example(W/\"abc123\")
 // @Param       page           query   int     false "Page number"                  minimum(1) default(1)
 // @Param       page_size      query   int     false "Items per page"               minimum(1) maximum(100) default(20)
+// @Param       after          query   string  false "Cursor mode: items after this cursor (next_cursor); empty for the first page"
+// @Param       before         query   string  false "Cursor mode: items before this cursor (prev_cursor); empty for the last page"
+// @Param       order          query   string  false "Cursor mode: sort order by creation time"  Enums(asc, desc) default(desc)
 //
 // @Success     200  {object} handlers.ListChatsResponse
 // @Header      200  {string} ETag           "Weak ETag for current result"
 // @Header      200  {string} Cache-Control  "Caching directives (if set)"
 // @Success     304  {string} string "Not Modified"
 // @Failure     400  {object} handlers.ErrorResponse "Bad request"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid bearer token"
 // @Failure     500  {object} handlers.ErrorResponse "Internal error"
 // @Router      /chats [get]
 func (h *Handlers) ListChats(c *gin.Context) {
 	ctx := c.Request.Context()
-	uid := userID(c)
+	who := caller(c)
 	page, pageSize := clampPagination(c)
+	kp, cursorMode, err := h.keysetPage(c, "chats", true)
+	if err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+		return
+	}
 
 	// ETag pre-check (best effort).
 	var db *gorm.DB
@@ -221,23 +404,33 @@ func (h *Handlers) ListChats(c *gin.Context) {
 		db = svc.DB
 	}
 	if db != nil {
-		count, maxTS, err := repo.ChatsStats(ctx, db, uid)
+		count, maxTS, err := repo.ChatsStats(ctx, db, who.Workspace(), who.UserID)
 		if err == nil {
 			var ts int64
 			if maxTS != nil {
 				ts = maxTS.Unix()
 			}
-			etag := fmt.Sprintf(`W/"chats:%s:%d:%d"`, uid, count, ts)
-			c.Header("ETag", etag)
-			if inm := c.GetHeader("If-None-Match"); inm != "" && inm == etag {
-				c.Status(http.StatusNotModified)
+			if notModified(c, fmt.Sprintf(`W/"chats:%s:%s:%d:%d"`, who.Workspace(), who.UserID, count, ts)) {
 				return
 			}
 		}
 	}
 
+	if cursorMode {
+		items, more, err := h.chatSvc.ListKeyset(ctx, who, kp)
+		if err != nil {
+			fail(c, http.StatusInternalServerError, ErrCodeListFailed, err.Error())
+			return
+		}
+		ok(c, http.StatusOK, ListChatsResponse{
+			Chats:  items,
+			Cursor: cursorPage(h, "chats", kp, items, more, chatPosition),
+		})
+		return
+	}
+
 	// Fetch page.
-	items, total, err := h.chatSvc.ListPage(ctx, uid, page, pageSize)
+	items, total, err := h.chatSvc.ListPage(ctx, who, page, pageSize)
 	if err != nil {
 		fail(c, http.StatusInternalServerError, ErrCodeListFailed, err.Error())
 		return
@@ -246,7 +439,7 @@ func (h *Handlers) ListChats(c *gin.Context) {
 	totalPages := int((total + int64(pageSize) - 1) / int64(pageSize))
 	resp := ListChatsResponse{
 		Chats: items,
-		Pagination: Pagination{
+		Pagination: &Pagination{
 			Page:       page,
 			PageSize:   pageSize,
 			Total:      total,
@@ -257,21 +450,70 @@ func (h *Handlers) ListChats(c *gin.Context) {
 	ok(c, http.StatusOK, resp)
 }
 
+// GetChat godoc
+// @ID          getChat
+// @Summary     Get a chat
+// @Description Returns a chat the current user owns or that is shared with them. The strong ETag changes with every change to the chat;
+// @Description send it back in If-Match to rename or delete the chat only if nobody changed it in between.
+// @Tags        Chats
+// @Produce     json
+// @Security    BearerAuth
+//
+// @Param       X-User-ID      header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       If-None-Match  header  string  false "Return 304 if one of the listed ETags (or *) matches"  example("chat:141add05-4415-4938-b5a1-17e0d3171aff:3")
+// @Param       id             path    string  true  "Chat ID (UUID)"  format(uuid) example(141add05-4415-4938-b5a1-17e0d3171aff)
+//
+// @Success     200  {object} domain.Chat
+// @Header      200  {string} ETag  "Strong ETag of the chat version"
+// @Success     304  {string} string "Not Modified"
+// @Failure     400  {object} handlers.ErrorResponse "Bad request"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid bearer token"
+// @Failure     404  {object} handlers.ErrorResponse "Chat not found"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /chats/{id} [get]
+func (h *Handlers) GetChat(c *gin.Context) {
+	chatID := c.Param("id")
+	if _, err := uuid.Parse(chatID); err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "chat id must be a UUID")
+		return
+	}
+
+	ch, err := h.chatSvc.Get(c.Request.Context(), caller(c), chatID)
+	if err != nil {
+		failChat(c, err)
+		return
+	}
+	if notModified(c, chatETag(ch)) {
+		return
+	}
+	ok(c, http.StatusOK, ch)
+}
+
 // UpdateChatTitle godoc
 // @ID          updateChatTitle
 // @Summary     Rename a chat
-// @Description Updates the title of a chat owned by the current user.
+// @Description Updates the title of a chat owned by the current user (or any chat, for admins).
+// @Description With If-Match, the rename only applies if the chat still has one of the listed ETags (see getChat).
 // @Tags        Chats
 // @Accept      json
 // @Produce     json
+// @Security    BearerAuth
 //
-// @Param       X-User-ID  header  string  false "User ID (demo header)"         example(user123)
-// @Param       id         path    string  true  "Chat ID (UUID)"                format(uuid) example(141add05-4415-4938-b5a1-17e0d3171aff)
-// @Param       body       body    handlers.UpdateChatTitleRequest  true  "New title"
+// @Param       X-User-ID        header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       Idempotency-Key  header  string  false "Idempotency key for safe retries (UUID recommended)"
+// @Param       If-Match         header  string  false "Rename only if the chat's ETag matches (or *)"  example("chat:141add05-4415-4938-b5a1-17e0d3171aff:3")
+// @Param       id               path    string  true  "Chat ID (UUID)"                format(uuid) example(141add05-4415-4938-b5a1-17e0d3171aff)
+// @Param       body             body    handlers.UpdateChatTitleRequest  true  "New title"
 //
 // @Success     204  {string} string "No Content"
+// @Header      204  {string} ETag  "Strong ETag of the renamed chat"
 // @Failure     400  {object} handlers.ErrorResponse "Bad request"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid bearer token"
+// @Failure     403  {object} handlers.ErrorResponse "Chat is only shared with the caller"
 // @Failure     404  {object} handlers.ErrorResponse "Chat not found"
+// @Failure     409  {object} handlers.ErrorResponse "A request with this Idempotency-Key is in flight (idempotency_in_flight)"
+// @Failure     412  {object} handlers.ErrorResponse "The chat changed since the If-Match ETag (precondition_failed)"
+// @Failure     422  {object} handlers.ErrorResponse "Idempotency-Key reused with a different body (idempotency_key_reused)"
 // @Failure     500  {object} handlers.ErrorResponse "Internal error"
 // @Router      /chats/{id}/title [put]
 func (h *Handlers) UpdateChatTitle(c *gin.Context) {
@@ -287,10 +529,93 @@ func (h *Handlers) UpdateChatTitle(c *gin.Context) {
 		return
 	}
 
-	if err := h.chatSvc.UpdateTitle(c.Request.Context(), userID(c), chatID, req.Title); err != nil {
-		fail(c, http.StatusNotFound, ErrCodeNotFound, "chat not found")
+	version, ok := h.ifMatchVersion(c, chatID)
+	if !ok {
+		return
+	}
+	ch, err := h.chatSvc.UpdateTitle(c.Request.Context(), caller(c), chatID, req.Title, version)
+	if err != nil {
+		failChat(c, err)
 		return
 	}
 
+	c.Header("ETag", chatETag(ch))
 	noContent(c)
 }
+
+// DeleteChat godoc
+// @ID          deleteChat
+// @Summary     Delete a chat
+// @Description Soft-deletes a chat owned by the current user (or any chat, for admins) together with its messages and their feedback.
+// @Description The chat can be restored with restoreChat until the grace window ends; afterwards it is purged.
+// @Description With If-Match, the chat is only deleted if it still has one of the listed ETags (see getChat).
+// @Tags        Chats
+// @Produce     json
+// @Security    BearerAuth
+//
+// @Param       X-User-ID  header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       If-Match   header  string  false "Delete only if the chat's ETag matches (or *)"  example("chat:141add05-4415-4938-b5a1-17e0d3171aff:3")
+// @Param       id         path    string  true  "Chat ID (UUID)"         format(uuid) example(141add05-4415-4938-b5a1-17e0d3171aff)
+//
+// @Success     204  {string} string "No Content"
+// @Failure     400  {object} handlers.ErrorResponse "Bad request"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid bearer token"
+// @Failure     403  {object} handlers.ErrorResponse "Chat is only shared with the caller"
+// @Failure     404  {object} handlers.ErrorResponse "Chat not found"
+// @Failure     412  {object} handlers.ErrorResponse "The chat changed since the If-Match ETag (precondition_failed)"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /chats/{id} [delete]
+func (h *Handlers) DeleteChat(c *gin.Context) {
+	chatID := c.Param("id")
+	if _, err := uuid.Parse(chatID); err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "chat id must be a UUID")
+		return
+	}
+
+	version, ok := h.ifMatchVersion(c, chatID)
+	if !ok {
+		return
+	}
+	if err := h.chatSvc.Delete(c.Request.Context(), caller(c), chatID, version); err != nil {
+		failChat(c, err)
+		return
+	}
+
+	noContent(c)
+}
+
+// RestoreChat godoc
+// @ID          restoreChat
+// @Summary     Restore a deleted chat
+// @Description Undoes deleteChat (chat, messages and feedback) within the configured grace window.
+// @Description Restoring a chat that is not deleted returns it unchanged.
+// @Tags        Chats
+// @Produce     json
+// @Security    BearerAuth
+//
+// @Param       X-User-ID  header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       id         path    string  true  "Chat ID (UUID)"         format(uuid) example(141add05-4415-4938-b5a1-17e0d3171aff)
+//
+// @Success     200  {object} domain.Chat
+// @Failure     400  {object} handlers.ErrorResponse "Bad request"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid bearer token"
+// @Failure     403  {object} handlers.ErrorResponse "Chat is only shared with the caller"
+// @Failure     404  {object} handlers.ErrorResponse "Chat not found"
+// @Failure     410  {object} handlers.ErrorResponse "Grace window expired"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /chats/{id}/restore [post]
+func (h *Handlers) RestoreChat(c *gin.Context) {
+	chatID := c.Param("id")
+	if _, err := uuid.Parse(chatID); err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "chat id must be a UUID")
+		return
+	}
+
+	ch, err := h.chatSvc.Restore(c.Request.Context(), caller(c), chatID)
+	if err != nil {
+		failChat(c, err)
+		return
+	}
+
+	ok(c, http.StatusOK, ch)
+}
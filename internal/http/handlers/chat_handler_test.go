@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -18,6 +19,7 @@ import (
 	"gorm.io/gorm/logger"
 
 	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/pagination"
 	"github.com/tbourn/go-chat-backend/internal/repo"
 	"github.com/tbourn/go-chat-backend/internal/services"
 )
@@ -39,7 +41,7 @@ func newChatDB(t *testing.T) *gorm.DB {
 
 	// Enforce FKs and migrate schemas
 	db.Exec("PRAGMA foreign_keys=ON;")
-	if err := db.AutoMigrate(&domain.Chat{}, &domain.Message{}, &domain.Feedback{}, &domain.Idempotency{}); err != nil {
+	if err := db.AutoMigrate(&domain.Chat{}, &domain.ChatShare{}, &domain.Message{}, &domain.Feedback{}, &domain.Idempotency{}); err != nil {
 		t.Fatalf("migrate: %v", err)
 	}
 	return db
@@ -48,45 +50,81 @@ func newChatDB(t *testing.T) *gorm.DB {
 // Minimal shim implementing services.ChatRepo using repo package (like router.go)
 type testChatRepo struct{}
 
-func (testChatRepo) CreateChat(ctx context.Context, db *gorm.DB, userID, title string) (*domain.Chat, error) {
-	return repo.CreateChat(ctx, db, userID, title)
+func (testChatRepo) CreateChat(ctx context.Context, db *gorm.DB, workspaceID, userID, title string) (*domain.Chat, error) {
+	return repo.CreateChat(ctx, db, workspaceID, userID, title)
 }
 
-func (testChatRepo) ListChats(ctx context.Context, db *gorm.DB, userID string) ([]domain.Chat, error) {
-	return repo.ListChats(ctx, db, userID)
+func (testChatRepo) ListChats(ctx context.Context, db *gorm.DB, workspaceID, userID string) ([]domain.Chat, error) {
+	return repo.ListChats(ctx, db, workspaceID, userID)
 }
 
-func (testChatRepo) GetChat(ctx context.Context, db *gorm.DB, id, userID string) (*domain.Chat, error) {
-	return repo.GetChat(ctx, db, id, userID)
+func (testChatRepo) FindChat(ctx context.Context, db *gorm.DB, workspaceID, id string) (*domain.Chat, error) {
+	return repo.FindChat(ctx, db, workspaceID, id)
 }
 
-func (testChatRepo) UpdateChatTitle(ctx context.Context, db *gorm.DB, id, userID, title string) error {
-	return repo.UpdateChatTitle(ctx, db, id, userID, title)
+func (testChatRepo) IsChatSharedWith(ctx context.Context, db *gorm.DB, chatID, userID string) (bool, error) {
+	return repo.IsChatSharedWith(ctx, db, chatID, userID)
 }
 
-func (testChatRepo) CountChats(ctx context.Context, db *gorm.DB, userID string) (int64, error) {
-	return repo.CountChats(ctx, db, userID)
+func (testChatRepo) ShareChat(ctx context.Context, db *gorm.DB, chatID, userID string) error {
+	return repo.ShareChat(ctx, db, chatID, userID)
 }
 
-func (testChatRepo) ListChatsPage(ctx context.Context, db *gorm.DB, userID string, offset, limit int) ([]domain.Chat, error) {
-	return repo.ListChatsPage(ctx, db, userID, offset, limit)
+func (testChatRepo) UnshareChat(ctx context.Context, db *gorm.DB, chatID, userID string) error {
+	return repo.UnshareChat(ctx, db, chatID, userID)
+}
+
+func (testChatRepo) ListChatShares(ctx context.Context, db *gorm.DB, chatID string) ([]domain.ChatShare, error) {
+	return repo.ListChatShares(ctx, db, chatID)
+}
+
+func (testChatRepo) UpdateChatTitle(ctx context.Context, db *gorm.DB, workspaceID, id, userID, title string, version int64) error {
+	return repo.UpdateChatTitle(ctx, db, workspaceID, id, userID, title, version)
+}
+
+func (testChatRepo) CountChats(ctx context.Context, db *gorm.DB, workspaceID, userID string) (int64, error) {
+	return repo.CountChats(ctx, db, workspaceID, userID)
+}
+
+func (testChatRepo) ListChatsPage(ctx context.Context, db *gorm.DB, workspaceID, userID string, offset, limit int) ([]domain.Chat, error) {
+	return repo.ListChatsPage(ctx, db, workspaceID, userID, offset, limit)
+}
+
+func (testChatRepo) ListChatsKeyset(ctx context.Context, db *gorm.DB, workspaceID, userID string, p pagination.Page) ([]domain.Chat, bool, error) {
+	return repo.ListChatsKeyset(ctx, db, workspaceID, userID, p)
+}
+
+func (testChatRepo) DeleteChat(ctx context.Context, db *gorm.DB, workspaceID, id, userID string, version int64, at time.Time) error {
+	return repo.DeleteChat(ctx, db, workspaceID, id, userID, version, at)
+}
+
+func (testChatRepo) FindDeletedChat(ctx context.Context, db *gorm.DB, workspaceID, id string) (*domain.Chat, error) {
+	return repo.FindDeletedChat(ctx, db, workspaceID, id)
+}
+
+func (testChatRepo) RestoreChat(ctx context.Context, db *gorm.DB, workspaceID, id, userID string, deletedAt time.Time) error {
+	return repo.RestoreChat(ctx, db, workspaceID, id, userID, deletedAt)
 }
 
 // ---------- tiny stubs for other services ----------
 
-type stubMsgSvcChat struct{}
+type stubMsgSvcChat struct{ noBranches }
 
-func (stubMsgSvcChat) Answer(ctx context.Context, userID, chatID, prompt string) (*domain.Message, error) {
+func (stubMsgSvcChat) Answer(ctx context.Context, caller services.Caller, chatID, prompt string) (*domain.Message, error) {
 	return nil, nil
 }
 
-func (stubMsgSvcChat) ListPage(ctx context.Context, chatID string, page, pageSize int) ([]domain.Message, int64, error) {
+func (stubMsgSvcChat) ListPage(ctx context.Context, caller services.Caller, chatID string, _ services.MessageView, page, pageSize int) ([]domain.Message, int64, error) {
 	return nil, 0, nil
 }
 
+func (stubMsgSvcChat) ListKeyset(ctx context.Context, caller services.Caller, chatID string, _ services.MessageView, p pagination.Page) ([]domain.Message, bool, error) {
+	return nil, false, nil
+}
+
 type stubFBSvcChat struct{}
 
-func (stubFBSvcChat) Leave(ctx context.Context, userID, messageID string, value int) error {
+func (stubFBSvcChat) Leave(ctx context.Context, caller services.Caller, messageID string, value int) error {
 	return nil
 }
 
@@ -95,37 +133,77 @@ type stubChatSvcChat struct {
 	create    func(context.Context, string, string) (*domain.Chat, error)
 	list      func(context.Context, string) ([]domain.Chat, error)
 	listPage  func(context.Context, string, int, int) ([]domain.Chat, int64, error)
-	updateTit func(context.Context, string, string, string) error
+	get       func(context.Context, string, string) (*domain.Chat, error)
+	updateTit func(context.Context, string, string, string, int64) (*domain.Chat, error)
+	del       func(context.Context, string, string, int64) error
+	restore   func(context.Context, string, string) (*domain.Chat, error)
 }
 
-func (s stubChatSvcChat) Create(ctx context.Context, u, t string) (*domain.Chat, error) {
+func (s stubChatSvcChat) Create(ctx context.Context, u services.Caller, t string) (*domain.Chat, error) {
 	if s.create != nil {
-		return s.create(ctx, u, t)
+		return s.create(ctx, u.UserID, t)
 	}
-	return &domain.Chat{ID: "c", UserID: u, Title: t}, nil
+	return &domain.Chat{ID: "c", UserID: u.UserID, Title: t}, nil
 }
 
-func (s stubChatSvcChat) List(ctx context.Context, u string) ([]domain.Chat, error) {
+func (s stubChatSvcChat) List(ctx context.Context, u services.Caller) ([]domain.Chat, error) {
 	if s.list != nil {
-		return s.list(ctx, u)
+		return s.list(ctx, u.UserID)
 	}
 	return nil, nil
 }
 
-func (s stubChatSvcChat) ListPage(ctx context.Context, u string, p, ps int) ([]domain.Chat, int64, error) {
+func (s stubChatSvcChat) ListPage(ctx context.Context, u services.Caller, p, ps int) ([]domain.Chat, int64, error) {
 	if s.listPage != nil {
-		return s.listPage(ctx, u, p, ps)
+		return s.listPage(ctx, u.UserID, p, ps)
 	}
 	return nil, 0, nil
 }
 
-func (s stubChatSvcChat) UpdateTitle(ctx context.Context, u, id, t string) error {
+func (s stubChatSvcChat) Get(ctx context.Context, u services.Caller, id string) (*domain.Chat, error) {
+	if s.get != nil {
+		return s.get(ctx, u.UserID, id)
+	}
+	return &domain.Chat{ID: id, UserID: u.UserID, Version: 1}, nil
+}
+
+func (s stubChatSvcChat) ListKeyset(ctx context.Context, u services.Caller, p pagination.Page) ([]domain.Chat, bool, error) {
+	return nil, false, nil
+}
+
+func (s stubChatSvcChat) UpdateTitle(ctx context.Context, u services.Caller, id, t string, v int64) (*domain.Chat, error) {
 	if s.updateTit != nil {
-		return s.updateTit(ctx, u, id, t)
+		return s.updateTit(ctx, u.UserID, id, t, v)
+	}
+	return &domain.Chat{ID: id, UserID: u.UserID, Title: t, Version: 2}, nil
+}
+
+func (s stubChatSvcChat) Delete(ctx context.Context, u services.Caller, id string, v int64) error {
+	if s.del != nil {
+		return s.del(ctx, u.UserID, id, v)
+	}
+	return nil
+}
+
+func (s stubChatSvcChat) Restore(ctx context.Context, u services.Caller, id string) (*domain.Chat, error) {
+	if s.restore != nil {
+		return s.restore(ctx, u.UserID, id)
 	}
+	return &domain.Chat{ID: id, UserID: u.UserID}, nil
+}
+
+func (s stubChatSvcChat) Share(ctx context.Context, u services.Caller, id, target string) error {
 	return nil
 }
 
+func (s stubChatSvcChat) Unshare(ctx context.Context, u services.Caller, id, target string) error {
+	return nil
+}
+
+func (s stubChatSvcChat) ListShares(ctx context.Context, u services.Caller, id string) ([]domain.ChatShare, error) {
+	return nil, nil
+}
+
 // ---------- helpers-only tests ----------
 
 func Test_userID_and_clampPagination(t *testing.T) {
@@ -260,7 +338,7 @@ func TestListChats_ETag304_and_SuccessPage(t *testing.T) {
 	r.GET("/chats", h.ListChats)
 
 	// Compute expected ETag
-	count, maxTS, err := repo.ChatsStats(context.Background(), db, "u1")
+	count, maxTS, err := repo.ChatsStats(context.Background(), db, domain.DefaultWorkspaceID, "u1")
 	if err != nil {
 		t.Fatalf("stats: %v", err)
 	}
@@ -268,7 +346,7 @@ func TestListChats_ETag304_and_SuccessPage(t *testing.T) {
 	if maxTS != nil {
 		ts = maxTS.Unix()
 	}
-	etag := fmt.Sprintf(`W/"chats:%s:%d:%d"`, "u1", count, ts)
+	etag := fmt.Sprintf(`W/"chats:%s:%s:%d:%d"`, domain.DefaultWorkspaceID, "u1", count, ts)
 
 	// 304 path
 	w := httptest.NewRecorder()
@@ -342,9 +420,9 @@ func TestUpdateChatTitle_UUID_Binding_Success_NotFound(t *testing.T) {
 	{
 		var got struct{ uid, id, title string }
 		okSvc := stubChatSvcChat{
-			updateTit: func(ctx context.Context, u, id, t string) error {
+			updateTit: func(ctx context.Context, u, id, t string, _ int64) (*domain.Chat, error) {
 				got.uid, got.id, got.title = u, id, t
-				return nil
+				return &domain.Chat{ID: id, Title: t, Version: 2}, nil
 			},
 		}
 		h := New(okSvc, stubMsgSvcChat{}, stubFBSvcChat{})
@@ -364,10 +442,12 @@ func TestUpdateChatTitle_UUID_Binding_Success_NotFound(t *testing.T) {
 		}
 	}
 
-	// not found / any error -> 404
+	// not found -> 404
 	{
 		errSvc := stubChatSvcChat{
-			updateTit: func(context.Context, string, string, string) error { return gorm.ErrRecordNotFound },
+			updateTit: func(context.Context, string, string, string, int64) (*domain.Chat, error) {
+				return nil, gorm.ErrRecordNotFound
+			},
 		}
 		h := New(errSvc, stubMsgSvcChat{}, stubFBSvcChat{})
 		r := gin.New()
@@ -428,8 +508,8 @@ func TestListChats_EmptyState_SetsETag_WithZeroTS(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Fatalf("expected 200 on empty list; got %d body=%s", w.Code, w.Body.String())
 	}
-	if et := w.Header().Get("ETag"); et != `W/"chats:u2:0:0"` {
-		t.Fatalf(`expected ETag W/"chats:u2:0:0", got %q`, et)
+	if et := w.Header().Get("ETag"); et != `W/"chats:default:u2:0:0"` {
+		t.Fatalf(`expected ETag W/"chats:default:u2:0:0", got %q`, et)
 	}
 
 	var out ListChatsResponse
@@ -440,3 +520,308 @@ func TestListChats_EmptyState_SetsETag_WithZeroTS(t *testing.T) {
 		t.Fatalf("unexpected pagination: %#v", out.Pagination)
 	}
 }
+
+// ---------- DeleteChat / RestoreChat ----------
+
+func TestDeleteChat_RestoreChat_ErrorMappings(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc := stubChatSvcChat{
+		del: func(_ context.Context, _, id string, _ int64) error {
+			switch id {
+			case "00000000-0000-0000-0000-000000000001":
+				return services.ErrChatNotFound
+			case "00000000-0000-0000-0000-000000000002":
+				return errors.New("db down")
+			}
+			return nil
+		},
+		restore: func(_ context.Context, u, id string) (*domain.Chat, error) {
+			switch id {
+			case "00000000-0000-0000-0000-000000000001":
+				return nil, services.ErrChatNotFound
+			case "00000000-0000-0000-0000-000000000002":
+				return nil, errors.New("db down")
+			case "00000000-0000-0000-0000-000000000003":
+				return nil, services.ErrRestoreExpired
+			}
+			return &domain.Chat{ID: id, UserID: u}, nil
+		},
+	}
+	h := New(svc, stubMsgSvcChat{}, stubFBSvcChat{})
+	r := gin.New()
+	r.DELETE("/chats/:id", h.DeleteChat)
+	r.POST("/chats/:id/restore", h.RestoreChat)
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+		code         string
+	}{
+		{http.MethodDelete, "/chats/not-a-uuid", http.StatusBadRequest, ErrCodeBadRequest},
+		{http.MethodDelete, "/chats/00000000-0000-0000-0000-000000000001", http.StatusNotFound, ErrCodeNotFound},
+		{http.MethodDelete, "/chats/00000000-0000-0000-0000-000000000002", http.StatusInternalServerError, ErrCodeInternal},
+		{http.MethodDelete, "/chats/00000000-0000-0000-0000-000000000009", http.StatusNoContent, ""},
+		{http.MethodPost, "/chats/not-a-uuid/restore", http.StatusBadRequest, ErrCodeBadRequest},
+		{http.MethodPost, "/chats/00000000-0000-0000-0000-000000000001/restore", http.StatusNotFound, ErrCodeNotFound},
+		{http.MethodPost, "/chats/00000000-0000-0000-0000-000000000002/restore", http.StatusInternalServerError, ErrCodeInternal},
+		{http.MethodPost, "/chats/00000000-0000-0000-0000-000000000003/restore", http.StatusGone, ErrCodeRestoreExpired},
+		{http.MethodPost, "/chats/00000000-0000-0000-0000-000000000009/restore", http.StatusOK, ""},
+	} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, nil))
+		if w.Code != tc.want {
+			t.Fatalf("%s %s -> %d, want %d (body=%s)", tc.method, tc.path, w.Code, tc.want, w.Body.String())
+		}
+		if tc.code != "" {
+			var er ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &er); err != nil || er.Code != tc.code {
+				t.Fatalf("%s %s: code = %q (err %v), want %q", tc.method, tc.path, er.Code, err, tc.code)
+			}
+		}
+	}
+}
+
+func TestDeleteChat_ThenRestore_ListAndETag(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newChatDB(t)
+	svc := services.NewChatService(db, testChatRepo{})
+	svc.RestoreWindow = time.Hour
+	h := New(svc, stubMsgSvcChat{}, stubFBSvcChat{})
+
+	r := gin.New()
+	r.GET("/chats", h.ListChats)
+	r.DELETE("/chats/:id", h.DeleteChat)
+	r.POST("/chats/:id/restore", h.RestoreChat)
+
+	past := time.Now().UTC().Add(-time.Minute)
+	keep := &domain.Chat{ID: uuid.NewString(), UserID: "u1", Title: "keep", CreatedAt: past, UpdatedAt: past}
+	drop := &domain.Chat{ID: uuid.NewString(), UserID: "u1", Title: "drop", CreatedAt: past, UpdatedAt: past}
+	for _, c := range []*domain.Chat{keep, drop} {
+		if err := db.Create(c).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+
+	do := func(method, path, inm string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-User-ID", "u1")
+		if inm != "" {
+			req.Header.Set("If-None-Match", inm)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	list := func() (ListChatsResponse, string) {
+		w := do(http.MethodGet, "/chats", "")
+		var out ListChatsResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+			t.Fatalf("json: %v", err)
+		}
+		return out, w.Header().Get("ETag")
+	}
+
+	_, etag := list()
+	if w := do(http.MethodDelete, "/chats/"+drop.ID, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete -> %d", w.Code)
+	}
+	if w := do(http.MethodDelete, "/chats/"+drop.ID, ""); w.Code != http.StatusNotFound {
+		t.Fatalf("second delete -> %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/chats", etag); w.Code != http.StatusOK {
+		t.Fatalf("stale ETag after delete -> %d", w.Code)
+	}
+	out, _ := list()
+	if out.Pagination.Total != 1 || len(out.Chats) != 1 || out.Chats[0].ID != keep.ID {
+		t.Fatalf("deleted chat still listed: %+v", out)
+	}
+
+	if w := do(http.MethodPost, "/chats/"+drop.ID+"/restore", ""); w.Code != http.StatusOK {
+		t.Fatalf("restore -> %d body=%s", w.Code, w.Body.String())
+	}
+	out, _ = list()
+	if out.Pagination.Total != 2 {
+		t.Fatalf("restored chat not listed: %+v", out)
+	}
+
+	// Past the grace window the chat stays deleted.
+	if w := do(http.MethodDelete, "/chats/"+drop.ID, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("delete -> %d", w.Code)
+	}
+	db.Unscoped().Model(&domain.Chat{}).Where("id = ?", drop.ID).Update("deleted_at", time.Now().UTC().Add(-2*time.Hour))
+	if w := do(http.MethodPost, "/chats/"+drop.ID+"/restore", ""); w.Code != http.StatusGone {
+		t.Fatalf("expired restore -> %d", w.Code)
+	}
+}
+
+// ---------- GetChat / ETags / If-Match ----------
+
+func TestETagHelpers(t *testing.T) {
+	if got := etagList(` "a", W/"b,c" ,*,, "d"`); fmt.Sprint(got) != `["a" W/"b,c" * "d"]` {
+		t.Fatalf("etagList = %q", got)
+	}
+	for _, tc := range []struct {
+		header, etag string
+		want         bool
+	}{
+		{``, `"x"`, false},
+		{`"x"`, `"x"`, true},
+		{`W/"x"`, `"x"`, true},
+		{`"x"`, `W/"x"`, true},
+		{`"y", "x"`, `"x"`, true},
+		{`*`, `"x"`, true},
+		{`"y"`, `"x"`, false},
+	} {
+		if got := noneMatch(tc.header, tc.etag); got != tc.want {
+			t.Fatalf("noneMatch(%q, %q) = %v", tc.header, tc.etag, got)
+		}
+	}
+}
+
+func TestGetChat_ETagAndIfMatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newChatDB(t)
+	h := New(services.NewChatService(db, testChatRepo{}), stubMsgSvcChat{}, stubFBSvcChat{})
+
+	r := gin.New()
+	r.GET("/chats/:id", h.GetChat)
+	r.PUT("/chats/:id/title", h.UpdateChatTitle)
+	r.DELETE("/chats/:id", h.DeleteChat)
+
+	ch, err := repo.CreateChat(context.Background(), db, domain.DefaultWorkspaceID, "u1", "t")
+	if err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	do := func(method, path, body string, hdr ...string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("X-User-ID", "u1")
+		for i := 0; i+1 < len(hdr); i += 2 {
+			req.Header.Set(hdr[i], hdr[i+1])
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	path := "/chats/" + ch.ID
+	rename := func(title string, hdr ...string) *httptest.ResponseRecorder {
+		return do(http.MethodPut, path+"/title", `{"title":"`+title+`"}`, hdr...)
+	}
+
+	w := do(http.MethodGet, path, "")
+	v1 := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || v1 != fmt.Sprintf(`"chat:%s:1"`, ch.ID) {
+		t.Fatalf("GET -> %d ETag=%q", w.Code, v1)
+	}
+	for _, inm := range []string{v1, `"other", ` + v1, "W/" + v1, "*"} {
+		if w := do(http.MethodGet, path, "", "If-None-Match", inm); w.Code != http.StatusNotModified || w.Header().Get("ETag") != v1 {
+			t.Fatalf("If-None-Match %s -> %d", inm, w.Code)
+		}
+	}
+	if w := do(http.MethodGet, "/chats/"+uuid.NewString(), ""); w.Code != http.StatusNotFound {
+		t.Fatalf("GET missing -> %d", w.Code)
+	}
+	if w := do(http.MethodGet, path, "", "X-User-ID", "u2"); w.Code != http.StatusNotFound {
+		t.Fatalf("GET foreign -> %d", w.Code)
+	}
+
+	// First tab renames with v1 and gets v2 back; the second tab, still on v1, loses.
+	w = rename("first", "If-Match", v1)
+	v2 := w.Header().Get("ETag")
+	if w.Code != http.StatusNoContent || v2 != fmt.Sprintf(`"chat:%s:2"`, ch.ID) {
+		t.Fatalf("rename at v1 -> %d ETag=%q", w.Code, v2)
+	}
+	for _, im := range []string{v1, "W/" + v2, `"garbage"`, `"a", ` + v1} {
+		if w := rename("second", "If-Match", im); w.Code != http.StatusPreconditionFailed {
+			t.Fatalf("rename If-Match %s -> %d", im, w.Code)
+		}
+	}
+	if w := do(http.MethodDelete, path, "", "If-Match", v1); w.Code != http.StatusPreconditionFailed {
+		t.Fatalf("stale delete -> %d", w.Code)
+	}
+	if w := do(http.MethodGet, path, "", "If-None-Match", v1); w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte(`"first"`)) {
+		t.Fatalf("GET after rename -> %d %s", w.Code, w.Body.String())
+	}
+
+	// A list matches if any tag does; * matches any version.
+	if w := rename("third", "If-Match", v1+", "+v2); w.Code != http.StatusNoContent {
+		t.Fatalf("rename If-Match list -> %d", w.Code)
+	}
+	if w := rename("fourth", "If-Match", "*"); w.Code != http.StatusNoContent {
+		t.Fatalf("rename If-Match * -> %d", w.Code)
+	}
+	// Unknown chats are still 404, not 412.
+	if w := do(http.MethodDelete, "/chats/"+uuid.NewString(), "", "If-Match", `"x"`); w.Code != http.StatusNotFound {
+		t.Fatalf("delete missing -> %d", w.Code)
+	}
+	v4 := do(http.MethodGet, path, "").Header().Get("ETag")
+	if w := do(http.MethodDelete, path, "", "If-Match", v4); w.Code != http.StatusNoContent {
+		t.Fatalf("delete at current version -> %d", w.Code)
+	}
+}
+
+func TestListChats_CursorMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newChatDB(t)
+	h := New(services.NewChatService(db, testChatRepo{}), stubMsgSvcChat{}, stubFBSvcChat{}).
+		WithCursorKey([]byte("0123456789abcdef0123456789abcdef"))
+	r := gin.New()
+	r.GET("/chats", h.ListChats)
+
+	base := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		c := &domain.Chat{ID: fmt.Sprintf("c%d", i), WorkspaceID: domain.DefaultWorkspaceID, UserID: "u1", Title: "t", CreatedAt: base.Add(time.Duration(i) * time.Second)}
+		if err := db.Create(c).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	get := func(query string) (*httptest.ResponseRecorder, ListChatsResponse) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/chats?"+query, nil)
+		req.Header.Set("X-User-ID", "u1")
+		r.ServeHTTP(w, req)
+		var out ListChatsResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &out)
+		return w, out
+	}
+	ids := func(out ListChatsResponse) string {
+		var s string
+		for _, c := range out.Chats {
+			s += c.ID
+		}
+		return s
+	}
+
+	// Offset mode is unchanged.
+	if w, out := get("page=1&page_size=2"); w.Code != http.StatusOK || out.Pagination == nil || out.Cursor != nil || out.Pagination.Total != 5 {
+		t.Fatalf("offset mode -> %d %s", w.Code, w.Body.String())
+	}
+
+	// Newest first by default: walk forward to the end, then back again.
+	_, p1 := get("after=&page_size=2")
+	if ids(p1) != "c4c3" || p1.Cursor.Order != "desc" || !p1.Cursor.HasNext || p1.Cursor.HasPrev {
+		t.Fatalf("page 1 = %s %+v", ids(p1), p1.Cursor)
+	}
+	_, p2 := get("page_size=2&after=" + p1.Cursor.NextCursor)
+	_, p3 := get("page_size=2&after=" + p2.Cursor.NextCursor)
+	if ids(p2) != "c2c1" || ids(p3) != "c0" || p3.Cursor.HasNext || p3.Cursor.NextCursor != "" || !p3.Cursor.HasPrev {
+		t.Fatalf("pages 2,3 = %s %+v / %s %+v", ids(p2), p2.Cursor, ids(p3), p3.Cursor)
+	}
+	if _, back := get("page_size=2&before=" + p3.Cursor.PrevCursor); ids(back) != "c2c1" || !back.Cursor.HasNext || !back.Cursor.HasPrev {
+		t.Fatalf("back from page 3 = %s %+v", ids(back), back.Cursor)
+	}
+	if _, last := get("before=&page_size=2"); ids(last) != "c1c0" || last.Cursor.HasNext || !last.Cursor.HasPrev {
+		t.Fatalf("last page = %s %+v", ids(last), last.Cursor)
+	}
+	if _, asc := get("after=&page_size=3&order=asc"); ids(asc) != "c0c1c2" || asc.Cursor.Order != "asc" {
+		t.Fatalf("asc = %s %+v", ids(asc), asc.Cursor)
+	}
+
+	// Bad cursors and parameter combinations are rejected.
+	foreign := New(services.NewChatService(db, testChatRepo{}), stubMsgSvcChat{}, stubFBSvcChat{}).cursors.Encode("chats", pagination.Cursor{CreatedAt: base, ID: "c0"})
+	messages := h.cursors.Encode("messages:x", pagination.Cursor{CreatedAt: base, ID: "c0"})
+	for _, q := range []string{"after=garbage", "after=" + foreign, "after=" + messages, "after=&before=", "after=&order=sideways"} {
+		if w, _ := get(q); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s -> %d", q, w.Code)
+		}
+	}
+}
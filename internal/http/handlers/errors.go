@@ -27,17 +27,27 @@
 package handlers
 
 const (
-	ErrCodeBadRequest   = "bad_request"
-	ErrCodeUnauthorized = "unauthorized"
-	ErrCodeForbidden    = "forbidden"
-	ErrCodeNotFound     = "not_found"
-	ErrCodeConflict     = "conflict"
-	ErrCodeRateLimited  = "too_many_requests"
-	ErrCodeInternal     = "internal_error"
+	ErrCodeBadRequest         = "bad_request"
+	ErrCodeUnauthorized       = "unauthorized"
+	ErrCodeForbidden          = "forbidden"
+	ErrCodeNotFound           = "not_found"
+	ErrCodeConflict           = "conflict"
+	ErrCodePreconditionFailed = "precondition_failed"
+	ErrCodeRateLimited        = "too_many_requests"
+	ErrCodePayloadTooLarge    = "payload_too_large"
+	ErrCodeInternal           = "internal_error"
 
 	// Domain-specific:
 	ErrCodeAnswerFailed     = "answer_failed"
 	ErrCodeCreateFailed     = "create_failed"
 	ErrCodeListFailed       = "list_failed"
 	ErrCodeMethodNotAllowed = "method_not_allowed"
+	ErrCodeReloadFailed     = "reload_failed"
+	ErrCodeRestoreExpired   = "restore_expired"
+	ErrCodeQuotaExceeded    = "quota_exceeded"
+
+	// Idempotency-Key misuse (see middleware.IdempotencyValidator):
+	ErrCodeBadIdempotencyKey   = "bad_idempotency_key"
+	ErrCodeIdempotencyInFlight = "idempotency_in_flight"
+	ErrCodeIdempotencyReused   = "idempotency_key_reused"
 )
@@ -0,0 +1,114 @@
+// Entity tags and conditional requests.
+//
+// Lists (chats, messages) carry weak ETags built from row counts and the
+// latest update; they only support conditional GET (If-None-Match). A single
+// chat carries a strong ETag derived from its version column, which also
+// makes renames and deletes conditional (If-Match), so two clients editing
+// the same chat cannot silently overwrite each other.
+//
+// Comparison follows RFC 9110: If-None-Match uses the weak comparison (a W/
+// prefix is ignored), If-Match the strong one (weak tags never match); both
+// accept a comma-separated list of tags or "*".
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+)
+
+// chatETag returns the strong ETag of a chat.
+func chatETag(ch *domain.Chat) string {
+	return fmt.Sprintf(`"chat:%s:%d"`, ch.ID, ch.Version)
+}
+
+// etagList splits an If-Match or If-None-Match header value into its entity
+// tags. Tags are quoted strings, so commas inside them do not split.
+func etagList(h string) []string {
+	var out []string
+	for h = strings.TrimSpace(h); h != ""; h = strings.TrimLeft(h, " \t,") {
+		end := strings.IndexByte(h, ',')
+		if start := strings.IndexByte(h, '"'); start >= 0 && (end < 0 || start < end) {
+			if q := strings.IndexByte(h[start+1:], '"'); q >= 0 {
+				end = start + 1 + q + 1
+			}
+		}
+		if end < 0 {
+			end = len(h)
+		}
+		if tag := strings.TrimSpace(h[:end]); tag != "" {
+			out = append(out, tag)
+		}
+		h = h[end:]
+	}
+	return out
+}
+
+// noneMatch reports whether the If-None-Match header value h matches etag,
+// i.e. whether a GET may answer 304 Not Modified.
+func noneMatch(h, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, tag := range etagList(h) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the ETag response header and, when the request's
+// If-None-Match matches it, answers 304 and reports true.
+func notModified(c *gin.Context, etag string) bool {
+	c.Header("ETag", etag)
+	if noneMatch(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+// ifMatchVersion resolves the request's If-Match header for a change to
+// chatID into the chat version the change must apply to: 0 (unconditional)
+// when the header is absent or "*", otherwise a version listed in it. A
+// single listed version is returned as is, leaving the comparison to the
+// atomic update; other lists are checked against the current chat. When no
+// listed tag can match it writes the error response (404/403 for chats the
+// caller cannot see or manage, else 412) and reports false.
+func (h *Handlers) ifMatchVersion(c *gin.Context, chatID string) (int64, bool) {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return 0, true
+	}
+	prefix := `"chat:` + chatID + `:`
+	var versions []int64
+	for _, tag := range etagList(header) {
+		if tag == "*" {
+			return 0, true
+		}
+		if v, ok := strings.CutPrefix(tag, prefix); ok {
+			if n, err := strconv.ParseInt(strings.TrimSuffix(v, `"`), 10, 64); err == nil && n > 0 {
+				versions = append(versions, n)
+			}
+		}
+	}
+	if len(versions) == 1 {
+		return versions[0], true
+	}
+	ch, err := h.chatSvc.Get(c.Request.Context(), caller(c), chatID)
+	if err != nil {
+		failChat(c, err)
+		return 0, false
+	}
+	for _, v := range versions {
+		if v == ch.Version {
+			return v, true
+		}
+	}
+	fail(c, http.StatusPreconditionFailed, ErrCodePreconditionFailed, "chat has been modified (If-Match does not match its ETag)")
+	return 0, false
+}
@@ -38,16 +38,20 @@ type LeaveFeedbackRequest struct {
 // @Tags        Feedback
 // @Accept      json
 // @Produce     json
+// @Security    BearerAuth
 //
-// @Param       X-User-ID  header  string  false "User ID (demo header)"          example(user123)
-// @Param       id         path    string  true  "Message ID (UUID)"              format(uuid) example(fa4dfbe0-c3bf-47bd-b32f-d7de221cf43b)
-// @Param       body       body    handlers.LeaveFeedbackRequest true "Feedback payload"
+// @Param       X-User-ID        header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       Idempotency-Key  header  string  false "Idempotency key for safe retries (UUID recommended)"
+// @Param       id               path    string  true  "Message ID (UUID)"              format(uuid) example(fa4dfbe0-c3bf-47bd-b32f-d7de221cf43b)
+// @Param       body             body    handlers.LeaveFeedbackRequest true "Feedback payload"
 //
 // @Success     204  {string} string "No Content"
 // @Failure     400  {object} handlers.ErrorResponse "Invalid payload"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid bearer token"
 // @Failure     403  {object} handlers.ErrorResponse "Not allowed to leave feedback"
 // @Failure     404  {object} handlers.ErrorResponse "Message not found"
-// @Failure     409  {object} handlers.ErrorResponse "Feedback already exists"
+// @Failure     409  {object} handlers.ErrorResponse "Feedback already exists, or a request with this Idempotency-Key is in flight"
+// @Failure     422  {object} handlers.ErrorResponse "Idempotency-Key reused with a different body (idempotency_key_reused)"
 // @Failure     500  {object} handlers.ErrorResponse "Internal server error"
 // @Router      /messages/{id}/feedback [post]
 func (h *Handlers) LeaveFeedback(c *gin.Context) {
@@ -57,11 +61,10 @@ func (h *Handlers) LeaveFeedback(c *gin.Context) {
 		return
 	}
 
-	// Pull user from context → header → demo fallback (implemented in chat_handler.go)
-	uid := userID(c)
+	// Pull the caller from context → header → demo fallback (implemented in chat_handler.go)
 	messageID := c.Param("id")
 
-	if err := h.fbSvc.Leave(c.Request.Context(), uid, messageID, req.Value); err != nil {
+	if err := h.fbSvc.Leave(c.Request.Context(), caller(c), messageID, req.Value); err != nil {
 		switch err {
 		case services.ErrMessageNotFound:
 			fail(c, http.StatusNotFound, ErrCodeNotFound, "message not found")
@@ -11,6 +11,7 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/pagination"
 	"github.com/tbourn/go-chat-backend/internal/services"
 )
 
@@ -18,28 +19,54 @@ import (
 
 type stubChatSvcFeedback struct{}
 
-func (stubChatSvcFeedback) Create(context.Context, string, string) (*domain.Chat, error) {
+func (stubChatSvcFeedback) Create(context.Context, services.Caller, string) (*domain.Chat, error) {
 	return nil, nil
 }
-func (stubChatSvcFeedback) List(context.Context, string) ([]domain.Chat, error) { return nil, nil }
-func (stubChatSvcFeedback) ListPage(context.Context, string, int, int) ([]domain.Chat, int64, error) {
+func (stubChatSvcFeedback) List(context.Context, services.Caller) ([]domain.Chat, error) {
+	return nil, nil
+}
+func (stubChatSvcFeedback) ListKeyset(context.Context, services.Caller, pagination.Page) ([]domain.Chat, bool, error) {
+	return nil, false, nil
+}
+func (stubChatSvcFeedback) ListPage(context.Context, services.Caller, int, int) ([]domain.Chat, int64, error) {
 	return nil, 0, nil
 }
-func (stubChatSvcFeedback) UpdateTitle(context.Context, string, string, string) error { return nil }
+func (stubChatSvcFeedback) Get(context.Context, services.Caller, string) (*domain.Chat, error) {
+	return nil, nil
+}
+func (stubChatSvcFeedback) UpdateTitle(context.Context, services.Caller, string, string, int64) (*domain.Chat, error) {
+	return nil, nil
+}
+func (stubChatSvcFeedback) Delete(context.Context, services.Caller, string, int64) error { return nil }
+func (stubChatSvcFeedback) Restore(context.Context, services.Caller, string) (*domain.Chat, error) {
+	return nil, nil
+}
+func (stubChatSvcFeedback) Share(context.Context, services.Caller, string, string) error { return nil }
+func (stubChatSvcFeedback) Unshare(context.Context, services.Caller, string, string) error {
+	return nil
+}
+func (stubChatSvcFeedback) ListShares(context.Context, services.Caller, string) ([]domain.ChatShare, error) {
+	return nil, nil
+}
 
 type stubMsgSvcFeedback struct {
+	noBranches
 	answer func(ctx context.Context, userID, chatID, prompt string) (*domain.Message, error)
 	list   func(ctx context.Context, chatID string, page, pageSize int) ([]domain.Message, int64, error)
 }
 
-func (s stubMsgSvcFeedback) Answer(ctx context.Context, userID, chatID, prompt string) (*domain.Message, error) {
+func (s stubMsgSvcFeedback) Answer(ctx context.Context, caller services.Caller, chatID, prompt string) (*domain.Message, error) {
 	if s.answer != nil {
-		return s.answer(ctx, userID, chatID, prompt)
+		return s.answer(ctx, caller.UserID, chatID, prompt)
 	}
 	return nil, nil
 }
 
-func (s stubMsgSvcFeedback) ListPage(ctx context.Context, chatID string, page, pageSize int) ([]domain.Message, int64, error) {
+func (stubMsgSvcFeedback) ListKeyset(context.Context, services.Caller, string, services.MessageView, pagination.Page) ([]domain.Message, bool, error) {
+	return nil, false, nil
+}
+
+func (s stubMsgSvcFeedback) ListPage(ctx context.Context, _ services.Caller, chatID string, _ services.MessageView, page, pageSize int) ([]domain.Message, int64, error) {
 	if s.list != nil {
 		return s.list(ctx, chatID, page, pageSize)
 	}
@@ -50,8 +77,8 @@ type stubFBSvc struct {
 	fn func(ctx context.Context, userID, messageID string, value int) error
 }
 
-func (s stubFBSvc) Leave(ctx context.Context, userID, messageID string, value int) error {
-	return s.fn(ctx, userID, messageID, value)
+func (s stubFBSvc) Leave(ctx context.Context, caller services.Caller, messageID string, value int) error {
+	return s.fn(ctx, caller.UserID, messageID, value)
 }
 
 // ---- tests ----
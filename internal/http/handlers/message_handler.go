@@ -2,33 +2,39 @@
 //
 // This file exposes REST endpoints for chat messages:
 //   - POST /chats/{id}/messages   (append a user message and create assistant reply)
-//   - GET  /chats/{id}/messages   (list paginated messages for a chat)
+//   - POST /chats/{id}/messages:stream (same, streamed as SSE; see stream_handler.go)
+//   - GET  /chats/{id}/messages   (list messages for a chat, offset or cursor paginated)
+//
+// Editing messages and switching between the resulting branches is in
+// branch_handler.go.
 //
 // Handlers are transport-thin:
 //   - validate & normalize inputs (including newline and length constraints)
 //   - delegate to application services (MessageService)
-//   - implement conditional responses (ETag) and idempotency semantics
+//   - implement conditional responses (ETag)
 //
 // Idempotency:
-// If the client supplies an Idempotency-Key header and a previous successful
-// result exists for (user, chat, key), the handler returns that recorded
-// assistant message and sets `Idempotency-Replayed: true`.
+// Retries carrying an Idempotency-Key header are answered by the
+// IdempotencyValidator middleware with the recorded response, so a replayed
+// request never reaches these handlers.
 package handlers
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"gorm.io/gorm"
 
 	"github.com/tbourn/go-chat-backend/internal/domain"
-	"github.com/tbourn/go-chat-backend/internal/repo"
+	"github.com/tbourn/go-chat-backend/internal/pagination"
 	"github.com/tbourn/go-chat-backend/internal/services"
 	"github.com/tbourn/go-chat-backend/internal/utils"
 )
@@ -53,10 +59,12 @@ type PostMessageResponse struct {
 	Message *domain.Message `json:"message"`
 }
 
-// ListMessagesResponse contains a page of chat messages and pagination metadata.
+// ListMessagesResponse contains a page of chat messages and pagination
+// metadata: Pagination in offset mode, Cursor in cursor mode.
 type ListMessagesResponse struct {
 	Messages   []domain.Message `json:"messages"`
-	Pagination Pagination       `json:"pagination"`
+	Pagination *Pagination      `json:"pagination,omitempty"`
+	Cursor     *CursorPage      `json:"cursor,omitempty"`
 }
 
 //
@@ -119,31 +127,71 @@ func discoverMaxPromptRunes(msgSvc MessageService) int {
 // @ID          postMessage
 // @Summary     Send a message and get assistant reply
 // @Description Appends a user message to the chat and generates an assistant reply.
-// @Description Supports idempotency via the Idempotency-Key header (same key → same result).
+// @Description Supports idempotency via the Idempotency-Key header (same key and body → same response).
+// @Description Send "Accept: text/event-stream" to receive the reply as Server-Sent Events (see streamMessage).
 // @Tags        Messages
 // @Accept      json
 // @Produce     json
+// @Security    BearerAuth
 //
-// @Param       X-User-ID        header  string  true  "User ID that owns the chat"  example(user123)
+// @Param       X-User-ID        header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
 // @Param       Idempotency-Key  header  string  false "Idempotency key for safe retries (UUID recommended)"  example(7a8d9f4c-1b2a-4c3d-8e9f-0123456789ab)
 // @Param       id               path    string  true  "Chat ID (UUID)"              format(uuid)
+// @Param       debug            query   bool    false "Include retrieval_query (the context-rewritten search query) in the reply"
 // @Param       body             body    handlers.PostMessageRequest  true  "User message payload"
 //
 // @Success     200  {object}  handlers.PostMessageResponse  "Assistant reply"
 // @Failure     400  {object}  handlers.ErrorResponse        "Bad request"
+// @Failure     401  {object}  handlers.ErrorResponse        "Missing or invalid bearer token"
 // @Failure     404  {object}  handlers.ErrorResponse        "Chat not found"
+// @Failure     409  {object}  handlers.ErrorResponse        "A request with this Idempotency-Key is in flight (idempotency_in_flight), or another message was posted meanwhile (conflict)"
+// @Failure     422  {object}  handlers.ErrorResponse        "Idempotency-Key reused with a different body (idempotency_key_reused)"
+// @Failure     429  {object}  handlers.ErrorResponse        "Usage quota exceeded (quota_exceeded)"
 // @Failure     500  {object}  handlers.ErrorResponse        "Internal error"
 // @Router      /chats/{id}/messages [post]
 func (h *Handlers) PostMessage(c *gin.Context) {
+	if wantsEventStream(c) {
+		h.streamMessage(c)
+		return
+	}
+
 	ctx := c.Request.Context()
-	chatID := c.Param("id")
+	chatID, content, maxRunes, valid := h.bindMessage(c)
+	if !valid {
+		return
+	}
+
+	// The service has a second guard for length.
+	m, err := h.msgSvc.Answer(ctx, caller(c), chatID, content)
+	if err != nil {
+		failAnswer(c, err, maxRunes)
+		return
+	}
+
+	if !retrievalDebug(c) {
+		m.RetrievalQuery = ""
+	}
+	ok(c, http.StatusOK, PostMessageResponse{Message: m})
+}
+
+// bindMessage validates the chat id and the PostMessageRequest body shared by
+// PostMessage and StreamMessage. On failure it writes the error response and
+// returns valid=false.
+func (h *Handlers) bindMessage(c *gin.Context) (chatID, content string, maxRunes int, valid bool) {
+	chatID = c.Param("id")
 
 	// Validate chat id shape if you use UUIDs.
 	if _, err := uuid.Parse(chatID); err != nil {
 		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "chat id must be a UUID")
 		return
 	}
+	content, maxRunes, valid = h.bindContent(c)
+	return chatID, content, maxRunes, valid
+}
 
+// bindContent validates and sanitizes a PostMessageRequest body. On failure
+// it writes the error response and returns valid=false.
+func (h *Handlers) bindContent(c *gin.Context) (content string, maxRunes int, valid bool) {
 	var req PostMessageRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "content required")
@@ -151,8 +199,8 @@ func (h *Handlers) PostMessage(c *gin.Context) {
 	}
 
 	// Sanitize + early size cap to fail fast at the edge.
-	content := sanitizeContent(req.Content)
-	maxRunes := discoverMaxPromptRunes(h.msgSvc)
+	content = sanitizeContent(req.Content)
+	maxRunes = discoverMaxPromptRunes(h.msgSvc)
 	if maxRunes > 0 && utf8.RuneCountInString(content) > maxRunes {
 		fail(c, http.StatusBadRequest, ErrCodeBadRequest, fmt.Sprintf("content too long: max %d runes", maxRunes))
 		return
@@ -161,63 +209,61 @@ func (h *Handlers) PostMessage(c *gin.Context) {
 		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "content required")
 		return
 	}
+	return content, maxRunes, true
+}
 
-	currentUser := userID(c)
-
-	// Idempotency (replay path) – read validated key if present.
-	idemKey, _ := middlewareGetIdempotencyKey(c)
-	if idemKey != "" {
-		if svc, okSvc := h.msgSvc.(*services.MessageService); okSvc && svc.DB != nil {
-			if rec, err := repo.GetIdempotency(ctx, svc.DB, currentUser, chatID, idemKey, time.Now().UTC()); err == nil && rec != nil {
-				if prev, err2 := repo.GetMessage(svc.DB, rec.MessageID); err2 == nil {
-					c.Header("Idempotency-Replayed", "true")
-					ok(c, http.StatusOK, PostMessageResponse{Message: prev})
-					return
-				}
-			}
-		}
-	}
-
-	// Normal processing (service has a second guard for length).
-	m, err := h.msgSvc.Answer(ctx, currentUser, chatID, content)
-	if err != nil {
-		switch err {
-		case services.ErrChatNotFound:
-			fail(c, http.StatusNotFound, ErrCodeNotFound, "chat not found")
-		case services.ErrTooLong:
-			fail(c, http.StatusBadRequest, ErrCodeBadRequest, fmt.Sprintf("content too long: max %d runes", maxRunes))
-		case services.ErrEmptyPrompt:
-			fail(c, http.StatusBadRequest, ErrCodeBadRequest, "content required")
-		default:
-			fail(c, http.StatusInternalServerError, ErrCodeAnswerFailed, err.Error())
-		}
-		return
-	}
+// retrievalDebug reports whether the client asked (?debug=true) to see the
+// query a reply was retrieved with.
+func retrievalDebug(c *gin.Context) bool {
+	v, _ := strconv.ParseBool(c.Query("debug"))
+	return v
+}
 
-	// Idempotency (store path) – best effort.
-	if idemKey != "" {
-		if svc, ok := h.msgSvc.(*services.MessageService); ok && svc.DB != nil {
-			ttl := 24 * time.Hour
-			_, _ = repo.CreateIdempotency(ctx, svc.DB, currentUser, chatID, idemKey, m.ID, http.StatusOK, ttl)
-		}
+// answerError maps a MessageService.Answer error to status, code and message.
+func answerError(err error, maxRunes int) (status int, code, msg string) {
+	switch err {
+	case services.ErrChatNotFound:
+		return http.StatusNotFound, ErrCodeNotFound, "chat not found"
+	case services.ErrTooLong:
+		return http.StatusBadRequest, ErrCodeBadRequest, fmt.Sprintf("content too long: max %d runes", maxRunes)
+	case services.ErrEmptyPrompt:
+		return http.StatusBadRequest, ErrCodeBadRequest, "content required"
+	case services.ErrBranchMoved:
+		return http.StatusConflict, ErrCodeConflict, "another message was posted to the chat meanwhile; reload it and retry"
+	default:
+		return http.StatusInternalServerError, ErrCodeAnswerFailed, err.Error()
 	}
+}
 
-	ok(c, http.StatusOK, PostMessageResponse{Message: m})
+// failAnswer writes the error response for a failed answer.
+func failAnswer(c *gin.Context, err error, maxRunes int) {
+	status, code, msg := answerError(err, maxRunes)
+	fail(c, status, code, msg)
 }
 
 // ListMessages godoc
 // @ID          listMessages
 // @Summary     List messages in a chat
-// @Description Returns a paginated list of messages for the given chat.
+// @Description Returns a paginated list of messages for the given chat, oldest first.
+// @Description By default only the active branch is listed (the conversation as shown); branch=all lists the messages of every branch,
+// @Description whose parent_id tells where each one belongs.
+// @Description Offset mode (page, page_size) returns pagination with totals. Cursor mode, selected by after or before, returns
+// @Description cursor with signed next_cursor/prev_cursor tokens; pages do not shift when messages are posted in between.
 // @Tags        Messages
 // @Produce     json
+// @Security    BearerAuth
 //
 // @Param       id         path   string  true  "Chat ID (UUID)"  format(uuid)
 // @Param       page       query  int     false "Page number"     minimum(1) default(1)
 // @Param       page_size  query  int     false "Items per page"  minimum(1) maximum(100) default(20)
+// @Param       after      query  string  false "Cursor mode: items after this cursor (next_cursor); empty for the first page"
+// @Param       before     query  string  false "Cursor mode: items before this cursor (prev_cursor); empty for the last page"
+// @Param       order      query  string  false "Cursor mode: sort order by creation time"  Enums(asc, desc) default(asc)
+// @Param       branch     query  string  false "Messages to list"  Enums(active, all) default(active)
 //
 // @Success     200  {object} handlers.ListMessagesResponse
 // @Failure     400  {object} handlers.ErrorResponse "Bad request"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid bearer token"
 // @Failure     404  {object} handlers.ErrorResponse "Chat not found"
 // @Failure     500  {object} handlers.ErrorResponse "Internal error"
 // @Router      /chats/{id}/messages [get]
@@ -229,31 +275,49 @@ func (h *Handlers) ListMessages(c *gin.Context) {
 		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "chat id must be a UUID")
 		return
 	}
-
-	// ETag pre-check (best effort).
-	var db *gorm.DB
-	if svc, ok := h.msgSvc.(*services.MessageService); ok {
-		db = svc.DB
+	var view services.MessageView
+	switch c.DefaultQuery("branch", "active") {
+	case "active":
+		view = services.ActiveBranch
+	case "all":
+		view = services.AllBranches
+	default:
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "branch must be active or all")
+		return
 	}
-	if db != nil {
-		count, maxTS, err := repo.MessagesStats(ctx, db, chatID)
+
+	// ETag pre-check (best effort). Stats authorizes the caller, so ETags
+	// cannot be used to probe chats the caller has no access to. Branches end
+	// with their newest message, so the nanosecond timestamp tells them apart
+	// even when switched within a second.
+	if st, ok := h.msgSvc.(messageStatter); ok {
+		count, maxTS, err := st.Stats(ctx, caller(c), chatID, view)
+		if errors.Is(err, services.ErrChatNotFound) {
+			fail(c, http.StatusNotFound, ErrCodeNotFound, "chat not found")
+			return
+		}
 		if err == nil {
 			var ts int64
 			if maxTS != nil {
-				ts = maxTS.Unix()
+				ts = maxTS.UnixNano()
 			}
-			etag := fmt.Sprintf(`W/"messages:%s:%d:%d"`, chatID, count, ts)
-			c.Header("ETag", etag)
-			if inm := c.GetHeader("If-None-Match"); inm != "" && inm == etag {
-				c.Status(http.StatusNotModified)
+			if notModified(c, fmt.Sprintf(`W/"messages:%s:%d:%d"`, chatID, count, ts)) {
 				return
 			}
 		}
 	}
 
+	if kp, cursorMode, err := h.keysetPage(c, "messages:"+chatID, false); err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+		return
+	} else if cursorMode {
+		h.listMessagesKeyset(c, chatID, view, kp)
+		return
+	}
+
 	page, pageSize := clampMsgPagination(c)
 
-	items, total, err := h.msgSvc.ListPage(ctx, chatID, page, pageSize)
+	items, total, err := h.msgSvc.ListPage(ctx, caller(c), chatID, view, page, pageSize)
 	if err != nil {
 		switch err {
 		case services.ErrChatNotFound:
@@ -267,7 +331,7 @@ func (h *Handlers) ListMessages(c *gin.Context) {
 	totalPages := int((total + int64(pageSize) - 1) / int64(pageSize))
 	ok(c, http.StatusOK, ListMessagesResponse{
 		Messages: items,
-		Pagination: Pagination{
+		Pagination: &Pagination{
 			Page:       page,
 			PageSize:   pageSize,
 			Total:      total,
@@ -277,12 +341,27 @@ func (h *Handlers) ListMessages(c *gin.Context) {
 	})
 }
 
-// middlewareGetIdempotencyKey extracts an idempotency key if an upstream
-// middleware has already validated/stashed it. The fallback behavior reads
-// the "Idempotency-Key" header directly when no dedicated middleware exists.
-func middlewareGetIdempotencyKey(c *gin.Context) (string, bool) {
-	if v := strings.TrimSpace(c.GetHeader("Idempotency-Key")); v != "" {
-		return v, true
+// listMessagesKeyset answers ListMessages in cursor mode.
+func (h *Handlers) listMessagesKeyset(c *gin.Context, chatID string, view services.MessageView, p pagination.Page) {
+	items, more, err := h.msgSvc.ListKeyset(c.Request.Context(), caller(c), chatID, view, p)
+	switch {
+	case errors.Is(err, services.ErrChatNotFound):
+		fail(c, http.StatusNotFound, ErrCodeNotFound, "chat not found")
+		return
+	case err != nil:
+		fail(c, http.StatusInternalServerError, ErrCodeListFailed, err.Error())
+		return
 	}
-	return "", false
+	ok(c, http.StatusOK, ListMessagesResponse{
+		Messages: items,
+		Cursor: cursorPage(h, "messages:"+chatID, p, items, more, func(m domain.Message) pagination.Cursor {
+			return pagination.Cursor{CreatedAt: m.CreatedAt, ID: m.ID}
+		}),
+	})
+}
+
+// messageStatter is implemented by message services that can report the
+// message count and latest update of a chat for ETags (services.MessageService).
+type messageStatter interface {
+	Stats(ctx context.Context, caller services.Caller, chatID string, view services.MessageView) (int64, *time.Time, error)
 }
@@ -21,6 +21,7 @@ import (
 	"gorm.io/gorm/logger"
 
 	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/pagination"
 	"github.com/tbourn/go-chat-backend/internal/repo"
 	"github.com/tbourn/go-chat-backend/internal/services"
 )
@@ -36,7 +37,7 @@ func newTestDB(t *testing.T) *gorm.DB {
 		t.Fatalf("open sqlite: %v", err)
 	}
 	db.Exec("PRAGMA foreign_keys=ON;")
-	if err := db.AutoMigrate(&domain.Chat{}, &domain.Message{}, &domain.Feedback{}, &domain.Idempotency{}); err != nil {
+	if err := db.AutoMigrate(&domain.Chat{}, &domain.ChatShare{}, &domain.Message{}, &domain.MessageSource{}, &domain.Feedback{}, &domain.Idempotency{}); err != nil {
 		t.Fatalf("migrate: %v", err)
 	}
 	return db
@@ -54,33 +55,77 @@ func captureLogs(t *testing.T) *bytes.Buffer {
 // Handlers.New expects interfaces in this package; we satisfy them with stubs.
 
 type stubMsgSvc struct {
+	noBranches
 	answer func(ctx context.Context, userID, chatID, prompt string) (*domain.Message, error)
 	list   func(ctx context.Context, chatID string, page, pageSize int) ([]domain.Message, int64, error)
+	keyset func(chatID string, p pagination.Page) ([]domain.Message, bool, error)
 }
 
-func (s stubMsgSvc) Answer(ctx context.Context, userID, chatID, prompt string) (*domain.Message, error) {
-	return s.answer(ctx, userID, chatID, prompt)
+func (s stubMsgSvc) Answer(ctx context.Context, caller services.Caller, chatID, prompt string) (*domain.Message, error) {
+	return s.answer(ctx, caller.UserID, chatID, prompt)
 }
 
-func (s stubMsgSvc) ListPage(ctx context.Context, chatID string, page, pageSize int) ([]domain.Message, int64, error) {
+func (s stubMsgSvc) ListPage(ctx context.Context, _ services.Caller, chatID string, _ services.MessageView, page, pageSize int) ([]domain.Message, int64, error) {
 	return s.list(ctx, chatID, page, pageSize)
 }
 
+func (s stubMsgSvc) ListKeyset(_ context.Context, _ services.Caller, chatID string, _ services.MessageView, p pagination.Page) ([]domain.Message, bool, error) {
+	if s.keyset == nil {
+		return nil, false, nil
+	}
+	return s.keyset(chatID, p)
+}
+
+// noBranches completes message service stubs of tests that do not edit
+// messages or switch branches.
+type noBranches struct{}
+
+func (noBranches) Edit(context.Context, services.Caller, string, string) (*domain.Message, error) {
+	return nil, services.ErrMessageNotFound
+}
+
+func (noBranches) ListBranches(context.Context, services.Caller, string) ([]services.Branch, error) {
+	return nil, services.ErrMessageNotFound
+}
+
+func (noBranches) SelectBranch(context.Context, services.Caller, string, string) error {
+	return services.ErrMessageNotFound
+}
+
 type (
 	stubChatSvc struct{}
 )
 
 // we only need New(...) to succeed; chat/feedback handlers aren’t used here.
-func (stubChatSvc) Create(context.Context, string, string) (*domain.Chat, error) { return nil, nil }
-func (stubChatSvc) List(context.Context, string) ([]domain.Chat, error)          { return nil, nil }
-func (stubChatSvc) ListPage(context.Context, string, int, int) ([]domain.Chat, int64, error) {
+func (stubChatSvc) Create(context.Context, services.Caller, string) (*domain.Chat, error) {
+	return nil, nil
+}
+func (stubChatSvc) List(context.Context, services.Caller) ([]domain.Chat, error) { return nil, nil }
+func (stubChatSvc) ListKeyset(context.Context, services.Caller, pagination.Page) ([]domain.Chat, bool, error) {
+	return nil, false, nil
+}
+func (stubChatSvc) ListPage(context.Context, services.Caller, int, int) ([]domain.Chat, int64, error) {
 	return nil, 0, nil
 }
-func (stubChatSvc) UpdateTitle(context.Context, string, string, string) error { return nil }
+func (stubChatSvc) Get(context.Context, services.Caller, string) (*domain.Chat, error) {
+	return nil, nil
+}
+func (stubChatSvc) UpdateTitle(context.Context, services.Caller, string, string, int64) (*domain.Chat, error) {
+	return nil, nil
+}
+func (stubChatSvc) Delete(context.Context, services.Caller, string, int64) error { return nil }
+func (stubChatSvc) Restore(context.Context, services.Caller, string) (*domain.Chat, error) {
+	return nil, nil
+}
+func (stubChatSvc) Share(context.Context, services.Caller, string, string) error   { return nil }
+func (stubChatSvc) Unshare(context.Context, services.Caller, string, string) error { return nil }
+func (stubChatSvc) ListShares(context.Context, services.Caller, string) ([]domain.ChatShare, error) {
+	return nil, nil
+}
 
 // ---------- helpers-only unit tests ----------
 
-func Test_sanitizeContent_and_clamp_and_idemKey(t *testing.T) {
+func Test_sanitizeContent_and_clamp(t *testing.T) {
 	// sanitizeContent:
 	raw := "  line1\r\n\r\n\r\n\r\nline2\rline3  "
 	got := sanitizeContent(raw)
@@ -108,16 +153,6 @@ func Test_sanitizeContent_and_clamp_and_idemKey(t *testing.T) {
 	if p != 1 || ps != 1 {
 		t.Fatalf("clamp defaults: got %d,%d", p, ps)
 	}
-
-	// middlewareGetIdempotencyKey
-	c, _ = gin.CreateTestContext(httptest.NewRecorder())
-	req = httptest.NewRequest("POST", "/", nil)
-	req.Header.Set("Idempotency-Key", "k-1")
-	c.Request = req
-	k, ok := middlewareGetIdempotencyKey(c)
-	if !ok || k != "k-1" {
-		t.Fatalf("idem key: %v %q", ok, k)
-	}
 }
 
 // ---------- PostMessage ----------
@@ -172,87 +207,6 @@ func TestPostMessage_InvalidUUID_and_Binding_and_TooLong(t *testing.T) {
 	}
 }
 
-func TestPostMessage_Idempotency_Replay_and_Store(t *testing.T) {
-	gin.SetMode(gin.TestMode)
-	db := newTestDB(t)
-
-	// seed chat + message + idempotency record for replay
-	userID := "u1"
-	chatID := uuid.NewString()
-	now := time.Now().UTC()
-
-	if err := db.Create(&domain.Chat{ID: chatID, UserID: userID, Title: "T", CreatedAt: now, UpdatedAt: now}).Error; err != nil {
-		t.Fatalf("seed chat: %v", err)
-	}
-	prev := &domain.Message{ID: "m-prev", ChatID: chatID, Role: "assistant", Content: "previous", CreatedAt: now, UpdatedAt: now}
-	if err := db.Create(prev).Error; err != nil {
-		t.Fatalf("seed message: %v", err)
-	}
-	if _, err := repo.CreateIdempotency(context.Background(), db, userID, chatID, "key-replay", prev.ID, 200, time.Hour); err != nil {
-		t.Fatalf("seed idem: %v", err)
-	}
-
-	ms := &services.MessageService{DB: db, MaxPromptRunes: 2000}
-	h := New(stubChatSvc{}, ms, &services.FeedbackService{DB: db})
-
-	r := gin.New()
-	r.POST("/chats/:id/messages", h.PostMessage)
-
-	// replay request
-	w := httptest.NewRecorder()
-	req := httptest.NewRequest(http.MethodPost, "/chats/"+chatID+"/messages", bytes.NewBufferString(`{"content":" hello "}`))
-	req.Header.Set("X-User-ID", userID)
-	req.Header.Set("Idempotency-Key", "key-replay")
-	r.ServeHTTP(w, req)
-	if w.Code != http.StatusOK {
-		t.Fatalf("replay -> %d", w.Code)
-	}
-	if w.Header().Get("Idempotency-Replayed") != "true" {
-		t.Fatalf("expected replay header")
-	}
-	var resp PostMessageResponse
-	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
-		t.Fatalf("json: %v", err)
-	}
-	if resp.Message == nil || resp.Message.ID != prev.ID || resp.Message.Content != "previous" {
-		t.Fatalf("unexpected replay body: %#v", resp)
-	}
-
-	// ----------- store path -----------
-	// Use a fresh key; there is no record, so Answer runs and then CreateIdempotency should write a record.
-	// Also seed chat for this case
-	chat2 := uuid.NewString()
-	if err := db.Create(&domain.Chat{ID: chat2, UserID: userID, Title: "T2", CreatedAt: now, UpdatedAt: now}).Error; err != nil {
-		t.Fatalf("seed chat2: %v", err)
-	}
-
-	r2 := gin.New()
-	r2.POST("/chats/:id/messages", h.PostMessage)
-
-	w2 := httptest.NewRecorder()
-	req2 := httptest.NewRequest(http.MethodPost, "/chats/"+chat2+"/messages", bytes.NewBufferString(`{"content":"question?"}`))
-	req2.Header.Set("X-User-ID", userID)
-	req2.Header.Set("Idempotency-Key", "key-store")
-	r2.ServeHTTP(w2, req2)
-	if w2.Code != http.StatusOK {
-		t.Fatalf("store -> %d body=%s", w2.Code, w2.Body.String())
-	}
-	var resp2 PostMessageResponse
-	if err := json.Unmarshal(w2.Body.Bytes(), &resp2); err != nil {
-		t.Fatalf("json2: %v", err)
-	}
-	if resp2.Message == nil || resp2.Message.ChatID != chat2 || resp2.Message.Role != "assistant" {
-		t.Fatalf("assistant msg missing: %#v", resp2)
-	}
-	// verify idempotency row exists
-	rec, err := repo.GetIdempotency(context.Background(), db, userID, chat2, "key-store", time.Now().UTC().Add(-time.Second))
-	if err != nil || rec == nil || rec.MessageID != resp2.Message.ID {
-		t.Fatalf("idempotency not stored: rec=%+v err=%v", rec, err)
-	}
-}
-
-// ---------- ListMessages ----------
-
 func TestListMessages_UUID_And_ETag304(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	db := newTestDB(t)
@@ -290,18 +244,29 @@ func TestListMessages_UUID_And_ETag304(t *testing.T) {
 	}
 	var ts int64
 	if maxTS != nil {
-		ts = maxTS.Unix()
+		ts = maxTS.UnixNano()
 	}
 	etag := `W/"messages:` + chatID + `:` + intToStr(count) + `:` + intToStr64(ts) + `"`
 
 	// 304 path
 	w = httptest.NewRecorder()
 	req = httptest.NewRequest(http.MethodGet, "/chats/"+chatID+"/messages", nil)
+	req.Header.Set("X-User-ID", "u1")
 	req.Header.Set("If-None-Match", etag)
 	r.ServeHTTP(w, req)
 	if w.Code != http.StatusNotModified {
 		t.Fatalf("etag 304 -> %d headers=%v logs=%s", w.Code, w.Header(), buf.String())
 	}
+
+	// Another user can neither read the chat nor probe its ETag.
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/chats/"+chatID+"/messages", nil)
+	req.Header.Set("X-User-ID", "mallory")
+	req.Header.Set("If-None-Match", etag)
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNotFound || w.Header().Get("ETag") != "" {
+		t.Fatalf("foreign chat -> %d etag=%q", w.Code, w.Header().Get("ETag"))
+	}
 }
 
 func TestListMessages_Success_And_Errors(t *testing.T) {
@@ -377,6 +342,74 @@ func TestListMessages_Success_And_Errors(t *testing.T) {
 	}
 }
 
+func TestListMessages_CursorMode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	chatID := uuid.NewString()
+	at := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	var got []pagination.Page
+	svc := stubMsgSvc{
+		keyset: func(id string, p pagination.Page) ([]domain.Message, bool, error) {
+			if id != chatID {
+				return nil, false, services.ErrChatNotFound
+			}
+			got = append(got, p)
+			return []domain.Message{{ID: "m1", CreatedAt: at}, {ID: "m2", CreatedAt: at.Add(time.Second)}}, true, nil
+		},
+	}
+	h := New(stubChatSvc{}, svc, &services.FeedbackService{DB: nil})
+	r := gin.New()
+	r.GET("/chats/:id/messages", h.ListMessages)
+	get := func(path string) (*httptest.ResponseRecorder, ListMessagesResponse) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var out ListMessagesResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &out)
+		return w, out
+	}
+	base := "/chats/" + chatID + "/messages"
+
+	// An empty "after" asks for the first page, oldest first by default.
+	w, out := get(base + "?after=&page_size=2")
+	if w.Code != http.StatusOK || out.Pagination != nil || out.Cursor == nil {
+		t.Fatalf("first page -> %d %s", w.Code, w.Body.String())
+	}
+	if c := out.Cursor; c.Order != "asc" || c.PageSize != 2 || !c.HasNext || c.HasPrev || c.NextCursor == "" || c.PrevCursor != "" {
+		t.Fatalf("first page cursor = %+v", c)
+	}
+	if p := got[0]; p.Cursor != nil || p.Backward || p.Desc || p.Limit != 2 {
+		t.Fatalf("first page = %+v", p)
+	}
+
+	// The next cursor points past the last item of the page.
+	w, out = get(base + "?after=" + out.Cursor.NextCursor)
+	if w.Code != http.StatusOK || !out.Cursor.HasPrev || out.Cursor.PrevCursor == "" {
+		t.Fatalf("next page -> %d %s", w.Code, w.Body.String())
+	}
+	if p := got[1]; p.Cursor == nil || p.Cursor.ID != "m2" || !p.Cursor.CreatedAt.Equal(at.Add(time.Second)) || p.Backward {
+		t.Fatalf("next page = %+v", p)
+	}
+	if w, _ := get(base + "?before=" + out.Cursor.PrevCursor + "&order=desc"); w.Code != http.StatusOK || !got[2].Backward || !got[2].Desc || got[2].Cursor.ID != "m1" {
+		t.Fatalf("prev page -> %d %+v", w.Code, got[2])
+	}
+
+	// Cursors are bound to their chat's list.
+	other := "/chats/" + uuid.NewString() + "/messages"
+	for _, path := range []string{
+		other + "?after=" + out.Cursor.PrevCursor,
+		base + "?after=garbage",
+		base + "?after=&before=",
+		base + "?after=&order=up",
+	} {
+		if w, _ := get(path); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s -> %d", path, w.Code)
+		}
+	}
+	if w, _ := get(other + "?after="); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown chat -> %d", w.Code)
+	}
+}
+
 // ---------- tiny helpers for ETag ints (avoid importing strconv for clarity) ----------
 
 func intToStr(n int64) string {
@@ -417,15 +450,6 @@ func Test_discoverMaxPromptRunes_AllPaths(t *testing.T) {
 	}
 }
 
-func Test_middlewareGetIdempotencyKey_MissingHeader(t *testing.T) {
-	c, _ := gin.CreateTestContext(httptest.NewRecorder())
-	c.Request = httptest.NewRequest("POST", "/", nil)
-	k, ok := middlewareGetIdempotencyKey(c)
-	if ok || k != "" {
-		t.Fatalf("expected no idempotency key, got ok=%v key=%q", ok, k)
-	}
-}
-
 func TestPostMessage_EmptyAfterSanitize(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	h := New(stubChatSvc{}, stubMsgSvc{
@@ -462,6 +486,7 @@ func TestPostMessage_ErrorMappings(t *testing.T) {
 		{"chat_not_found", services.ErrChatNotFound, http.StatusNotFound},
 		{"too_long", services.ErrTooLong, http.StatusBadRequest},
 		{"empty_prompt", services.ErrEmptyPrompt, http.StatusBadRequest},
+		{"branch_moved", services.ErrBranchMoved, http.StatusConflict},
 		{"generic_500", gorm.ErrInvalidField, http.StatusInternalServerError},
 	}
 
@@ -490,3 +515,38 @@ func TestPostMessage_ErrorMappings(t *testing.T) {
 		})
 	}
 }
+
+func TestPostMessage_RetrievalQueryOnlyWithDebug(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ms := stubMsgSvc{answer: func(_ context.Context, _, chatID, _ string) (*domain.Message, error) {
+		return &domain.Message{ID: "m1", ChatID: chatID, Role: "assistant", Content: "a", RetrievalQuery: "q Gen Z"}, nil
+	}}
+	h := New(stubChatSvc{}, ms, nil)
+	r := gin.New()
+	r.POST("/chats/:id/messages", h.PostMessage)
+
+	for _, tc := range []struct {
+		query string
+		want  string
+	}{
+		{"", ""},
+		{"?debug=false", ""},
+		{"?debug=true", "q Gen Z"},
+		{"?debug=1", "q Gen Z"},
+	} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/chats/"+uuid.NewString()+"/messages"+tc.query, bytes.NewBufferString(`{"content":"q"}`))
+		req.Header.Set("X-User-ID", "u1")
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%q -> %d body=%s", tc.query, w.Code, w.Body.String())
+		}
+		var resp PostMessageResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("json: %v", err)
+		}
+		if resp.Message.RetrievalQuery != tc.want {
+			t.Fatalf("%q: retrieval_query = %q, want %q", tc.query, resp.Message.RetrievalQuery, tc.want)
+		}
+	}
+}
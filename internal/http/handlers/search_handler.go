@@ -0,0 +1,136 @@
+// Search HTTP handlers.
+//
+// This file exposes full-text search over the caller's own chat history:
+//   - GET /search/messages?q=  (messages of the caller's chats, best first)
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tbourn/go-chat-backend/internal/repo"
+	"github.com/tbourn/go-chat-backend/internal/services"
+)
+
+// SearchService defines message search.
+type SearchService interface {
+	// Messages returns a page of the caller's messages matching q and the
+	// total number of matches.
+	Messages(ctx context.Context, caller services.Caller, q services.MessageQuery) ([]repo.MessageHit, int64, error)
+}
+
+// SearchHandlers groups search endpoints.
+type SearchHandlers struct {
+	svc SearchService
+}
+
+// NewSearch constructs SearchHandlers bound to the given service.
+func NewSearch(svc SearchService) *SearchHandlers {
+	return &SearchHandlers{svc: svc}
+}
+
+// SearchHit is a message matching a search.
+type SearchHit struct {
+	MessageID string `json:"message_id" example:"5d1c8c2e-3f4b-4b8e-9a59-0c1f1b2f9e77"`
+	ChatID    string `json:"chat_id" example:"141add05-4415-4938-b5a1-17e0d3171aff"`
+	ChatTitle string `json:"chat_title" example:"Gen Z trends"`
+	Role      string `json:"role" example:"assistant"`
+	// Snippet is an HTML-escaped excerpt with the matched words in <mark> tags.
+	Snippet string `json:"snippet" example:"Gen Z spends most of its time on <mark>TikTok</mark>…"`
+	// Rank is the relevance of the hit; higher is better.
+	Rank      float64   `json:"rank" example:"2.31"`
+	CreatedAt time.Time `json:"created_at" example:"2025-05-01T12:00:00Z"`
+}
+
+// SearchMessagesResponse is a page of search results.
+type SearchMessagesResponse struct {
+	Results    []SearchHit `json:"results"`
+	Pagination *Pagination `json:"pagination"`
+}
+
+// SearchMessages godoc
+// @ID          searchMessages
+// @Summary     Search my messages
+// @Description Full-text search over the messages of the caller's own chats in the current workspace (shared and deleted chats are not searched).
+// @Description Every word of q must match (the last one as a prefix, so results follow a query as it is typed); words are matched on their stem, ignoring case and accents.
+// @Description Results are ordered by relevance and carry an HTML-escaped snippet with the matched words in <mark> tags.
+// @Tags        Search
+// @Produce     json
+// @Security    BearerAuth
+// @Security    APIKeyAuth
+//
+// @Param       X-User-ID       header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       X-Workspace-ID  header  string  false "Workspace ID (default workspace when omitted)"
+// @Param       q          query  string  true   "Words to search for"  example(gen z tiktok)
+// @Param       role       query  string  false  "Only messages of this role"  Enums(user, assistant)
+// @Param       from       query  string  false  "Only messages created at or after (RFC 3339 or YYYY-MM-DD)"  example(2025-05-01)
+// @Param       to         query  string  false  "Only messages created before (RFC 3339 or YYYY-MM-DD)"  example(2025-06-01)
+// @Param       page       query  int     false  "Page number"     minimum(1) default(1)
+// @Param       page_size  query  int     false  "Items per page"  minimum(1) maximum(100) default(20)
+//
+// @Success     200  {object} handlers.SearchMessagesResponse
+// @Failure     400  {object} handlers.ErrorResponse "Bad request (no words in q, bad role or dates)"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid credentials"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /search/messages [get]
+func (h *SearchHandlers) SearchMessages(c *gin.Context) {
+	page, pageSize := clampPagination(c)
+	q := services.MessageQuery{Text: c.Query("q"), Role: c.Query("role"), Page: page, PageSize: pageSize}
+	var err error
+	if q.From, err = queryTime(c, "from"); err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+		return
+	}
+	if q.To, err = queryTime(c, "to"); err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+		return
+	}
+
+	hits, total, err := h.svc.Messages(c.Request.Context(), caller(c), q)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidSearch) {
+			fail(c, http.StatusBadRequest, ErrCodeBadRequest, "q must contain at least one word (up to 16); role must be user or assistant; from must be before to")
+			return
+		}
+		fail(c, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		return
+	}
+
+	out := make([]SearchHit, len(hits))
+	for i, hit := range hits {
+		out[i] = SearchHit{
+			MessageID: hit.MessageID, ChatID: hit.ChatID, ChatTitle: hit.ChatTitle, Role: hit.Role,
+			Snippet: hit.Snippet, Rank: hit.Rank, CreatedAt: hit.CreatedAt,
+		}
+	}
+	totalPages := int((total + int64(pageSize) - 1) / int64(pageSize))
+	ok(c, http.StatusOK, SearchMessagesResponse{
+		Results: out,
+		Pagination: &Pagination{
+			Page:       page,
+			PageSize:   pageSize,
+			Total:      total,
+			TotalPages: totalPages,
+			HasNext:    page < totalPages,
+		},
+	})
+}
+
+// queryTime parses the optional time query parameter key, given as RFC 3339
+// or as a date (midnight UTC).
+func queryTime(c *gin.Context, key string) (*time.Time, error) {
+	v := c.Query(key)
+	if v == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, time.DateOnly} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, errors.New(key + " must be an RFC 3339 time or a YYYY-MM-DD date")
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tbourn/go-chat-backend/internal/repo"
+	"github.com/tbourn/go-chat-backend/internal/services"
+)
+
+type stubSearchSvc struct {
+	got services.MessageQuery
+	err error
+}
+
+func (s *stubSearchSvc) Messages(_ context.Context, _ services.Caller, q services.MessageQuery) ([]repo.MessageHit, int64, error) {
+	s.got = q
+	if s.err != nil {
+		return nil, 0, s.err
+	}
+	return []repo.MessageHit{{MessageID: "m1", ChatID: "c1", ChatTitle: "Trends", Role: "assistant", Snippet: "<mark>TikTok</mark>", Rank: 1.5}}, 3, nil
+}
+
+func TestSearchMessages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	svc := &stubSearchSvc{}
+	r := gin.New()
+	r.GET("/search/messages", NewSearch(svc).SearchMessages)
+	get := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/search/messages?"+query, nil))
+		return w
+	}
+
+	w := get("q=tiktok&role=assistant&from=2025-05-01&to=2025-06-01T12:00:00%2B02:00&page=2&page_size=2")
+	if w.Code != http.StatusOK {
+		t.Fatalf("search -> %d %s", w.Code, w.Body.String())
+	}
+	from, to := time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 6, 1, 10, 0, 0, 0, time.UTC)
+	if q := svc.got; q.Text != "tiktok" || q.Role != "assistant" || !q.From.Equal(from) || !q.To.Equal(to) || q.Page != 2 || q.PageSize != 2 {
+		t.Fatalf("query = %+v", q)
+	}
+	var out SearchMessagesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if len(out.Results) != 1 || out.Results[0].Snippet != "<mark>TikTok</mark>" || out.Results[0].ChatTitle != "Trends" ||
+		out.Pagination.Total != 3 || out.Pagination.TotalPages != 2 || out.Pagination.HasNext {
+		t.Fatalf("response = %s", w.Body.String())
+	}
+
+	for _, q := range []string{"q=x&from=yesterday", "q=x&to=2025-13-01"} {
+		if w := get(q); w.Code != http.StatusBadRequest {
+			t.Fatalf("%s -> %d", q, w.Code)
+		}
+	}
+	svc.err = services.ErrInvalidSearch
+	if w := get("q=%3F"); w.Code != http.StatusBadRequest {
+		t.Fatalf("invalid search -> %d", w.Code)
+	}
+	svc.err = errors.New("boom")
+	if w := get("q=x"); w.Code != http.StatusInternalServerError {
+		t.Fatalf("service error -> %d", w.Code)
+	}
+}
@@ -0,0 +1,124 @@
+// Chat sharing HTTP handlers.
+//
+// This file exposes the "shared with" relation of a chat:
+//   - GET    /chats/{id}/shares            (list users the chat is shared with)
+//   - PUT    /chats/{id}/shares/{user_id}  (grant access; idempotent)
+//   - DELETE /chats/{id}/shares/{user_id}  (revoke access; idempotent)
+//
+// Shared users can read the chat and post messages and feedback. Only the
+// owner (or an admin) can manage shares; shared users get 403 and everyone
+// else 404.
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+)
+
+// ListSharesResponse lists the users a chat is shared with.
+type ListSharesResponse struct {
+	Shares []domain.ChatShare `json:"shares"`
+}
+
+// ListChatShares godoc
+// @ID          listChatShares
+// @Summary     List chat shares
+// @Description Returns the users a chat owned by the current user is shared with, oldest first.
+// @Tags        Chats
+// @Produce     json
+// @Security    BearerAuth
+//
+// @Param       X-User-ID  header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       id         path    string  true  "Chat ID (UUID)"         format(uuid) example(141add05-4415-4938-b5a1-17e0d3171aff)
+//
+// @Success     200  {object} handlers.ListSharesResponse
+// @Failure     400  {object} handlers.ErrorResponse "Bad request"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid bearer token"
+// @Failure     403  {object} handlers.ErrorResponse "Chat is only shared with the caller"
+// @Failure     404  {object} handlers.ErrorResponse "Chat not found"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /chats/{id}/shares [get]
+func (h *Handlers) ListChatShares(c *gin.Context) {
+	chatID := c.Param("id")
+	if _, err := uuid.Parse(chatID); err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "chat id must be a UUID")
+		return
+	}
+
+	shares, err := h.chatSvc.ListShares(c.Request.Context(), caller(c), chatID)
+	if err != nil {
+		failChat(c, err)
+		return
+	}
+	ok(c, http.StatusOK, ListSharesResponse{Shares: shares})
+}
+
+// ShareChat godoc
+// @ID          shareChat
+// @Summary     Share a chat
+// @Description Grants user_id read access and permission to post messages and feedback. Sharing again is a no-op.
+// @Tags        Chats
+// @Produce     json
+// @Security    BearerAuth
+//
+// @Param       X-User-ID  header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       id         path    string  true  "Chat ID (UUID)"         format(uuid) example(141add05-4415-4938-b5a1-17e0d3171aff)
+// @Param       user_id    path    string  true  "User to share with"     example(user456)
+//
+// @Success     204  {string} string "No Content"
+// @Failure     400  {object} handlers.ErrorResponse "Bad request (e.g. sharing with the owner)"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid bearer token"
+// @Failure     403  {object} handlers.ErrorResponse "Chat is only shared with the caller"
+// @Failure     404  {object} handlers.ErrorResponse "Chat not found"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /chats/{id}/shares/{user_id} [put]
+func (h *Handlers) ShareChat(c *gin.Context) {
+	chatID := c.Param("id")
+	if _, err := uuid.Parse(chatID); err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "chat id must be a UUID")
+		return
+	}
+
+	if err := h.chatSvc.Share(c.Request.Context(), caller(c), chatID, c.Param("user_id")); err != nil {
+		failChat(c, err)
+		return
+	}
+	noContent(c)
+}
+
+// UnshareChat godoc
+// @ID          unshareChat
+// @Summary     Stop sharing a chat
+// @Description Revokes user_id's access to the chat. Revoking a share that does not exist is a no-op.
+// @Tags        Chats
+// @Produce     json
+// @Security    BearerAuth
+//
+// @Param       X-User-ID  header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       id         path    string  true  "Chat ID (UUID)"         format(uuid) example(141add05-4415-4938-b5a1-17e0d3171aff)
+// @Param       user_id    path    string  true  "User to revoke"         example(user456)
+//
+// @Success     204  {string} string "No Content"
+// @Failure     400  {object} handlers.ErrorResponse "Bad request"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid bearer token"
+// @Failure     403  {object} handlers.ErrorResponse "Chat is only shared with the caller"
+// @Failure     404  {object} handlers.ErrorResponse "Chat not found"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /chats/{id}/shares/{user_id} [delete]
+func (h *Handlers) UnshareChat(c *gin.Context) {
+	chatID := c.Param("id")
+	if _, err := uuid.Parse(chatID); err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "chat id must be a UUID")
+		return
+	}
+
+	if err := h.chatSvc.Unshare(c.Request.Context(), caller(c), chatID, c.Param("user_id")); err != nil {
+		failChat(c, err)
+		return
+	}
+	noContent(c)
+}
@@ -0,0 +1,232 @@
+// Share link HTTP handlers.
+//
+// This file exposes public read-only links to chats:
+//   - POST   /chats/{id}/share  (create or replace the chat's link)
+//   - DELETE /chats/{id}/share  (revoke it; idempotent)
+//   - GET    /shared/{token}    (read the chat without an account)
+//
+// Only the owner (or an admin) can manage a chat's link. GET /shared/{token}
+// runs without identity or workspace and never exposes user IDs; it has its
+// own rate-limit bucket per client IP (SHARED_RATE_RPS / SHARED_RATE_BURST).
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/services"
+)
+
+// ShareLinkService defines share link operations.
+type ShareLinkService interface {
+	// Create creates or replaces a chat's link and returns it with its token.
+	Create(ctx context.Context, caller services.Caller, chatID string, expiresAt *time.Time) (*domain.ShareLink, string, error)
+	// Revoke deletes a chat's link.
+	Revoke(ctx context.Context, caller services.Caller, chatID string) error
+	// View returns a page of the chat behind a token.
+	View(ctx context.Context, token string, page, pageSize int) (*services.SharedChat, error)
+}
+
+// ShareLinkHandlers groups share link endpoints.
+type ShareLinkHandlers struct {
+	svc ShareLinkService
+}
+
+// NewShareLinks constructs ShareLinkHandlers bound to the given service.
+func NewShareLinks(svc ShareLinkService) *ShareLinkHandlers {
+	return &ShareLinkHandlers{svc: svc}
+}
+
+// CreateShareLinkRequest is the optional JSON payload for creating a link.
+type CreateShareLinkRequest struct {
+	// ExpiresAt optionally limits the link's lifetime (RFC 3339, must be in the future).
+	ExpiresAt *time.Time `json:"expires_at,omitempty" example:"2026-01-01T00:00:00Z"`
+}
+
+// CreateShareLinkResponse is returned once, when a link is created.
+type CreateShareLinkResponse struct {
+	// Token goes in GET /shared/{token}. It cannot be retrieved again.
+	Token     string     `json:"token" example:"gcs_Jq0dC9m0bq3a2l6m1u5c6P2k0x8yZ3vT4nQ7rS1wE0A"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// SharedChat is the read-only view of a chat behind a share link.
+type SharedChat struct {
+	Title     string    `json:"title" example:"Gen Z trends"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SharedMessage is a message of a shared chat.
+type SharedMessage struct {
+	Role      string           `json:"role" example:"assistant"`
+	Content   string           `json:"content" example:"TikTok leads among 18–24s."`
+	Score     *float64         `json:"score,omitempty" example:"0.63"`
+	CreatedAt time.Time        `json:"created_at"`
+	Citations []SharedCitation `json:"citations,omitempty"`
+}
+
+// SharedCitation is a corpus source of a shared assistant message.
+type SharedCitation struct {
+	Rank    int     `json:"rank" example:"0"`
+	DocID   string  `json:"doc_id" example:"7"`
+	Source  string  `json:"source,omitempty" example:"data.md"`
+	Line    int     `json:"line,omitempty" example:"42"`
+	Score   float64 `json:"score" example:"0.63"`
+	Snippet string  `json:"snippet,omitempty" example:"TikTok 61%"`
+}
+
+// SharedChatResponse is the result of GET /shared/{token}.
+type SharedChatResponse struct {
+	Chat       SharedChat      `json:"chat"`
+	Messages   []SharedMessage `json:"messages"`
+	Pagination *Pagination     `json:"pagination"`
+	// ExpiresAt is when the link stops working, if it expires.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// CreateShareLink godoc
+// @ID          createShareLink
+// @Summary     Create a public share link
+// @Description Creates a read-only link to a chat for people without an account, optionally expiring. The token is only returned in this response.
+// @Description A chat has one link: creating another replaces it, and the old token stops working. Only the owner (or an admin) may do this.
+// @Tags        Chats
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Security    APIKeyAuth
+//
+// @Param       X-User-ID  header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       id         path    string  true  "Chat ID (UUID)"  format(uuid) example(141add05-4415-4938-b5a1-17e0d3171aff)
+// @Param       body       body    handlers.CreateShareLinkRequest  false  "Optional expiry"
+//
+// @Success     201  {object} handlers.CreateShareLinkResponse
+// @Failure     400  {object} handlers.ErrorResponse "Bad request (invalid id or body, past expiry)"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid credentials"
+// @Failure     403  {object} handlers.ErrorResponse "Chat is only shared with the caller"
+// @Failure     404  {object} handlers.ErrorResponse "Chat not found"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /chats/{id}/share [post]
+func (h *ShareLinkHandlers) CreateShareLink(c *gin.Context) {
+	chatID := c.Param("id")
+	if _, err := uuid.Parse(chatID); err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "chat id must be a UUID")
+		return
+	}
+	var req CreateShareLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "invalid JSON body: expires_at (RFC 3339) is expected")
+		return
+	}
+
+	l, token, err := h.svc.Create(c.Request.Context(), caller(c), chatID, req.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidShareLinkExpiry) {
+			fail(c, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+			return
+		}
+		failChat(c, err)
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	ok(c, http.StatusCreated, CreateShareLinkResponse{Token: token, ExpiresAt: l.ExpiresAt, CreatedAt: l.CreatedAt})
+}
+
+// RevokeShareLink godoc
+// @ID          revokeShareLink
+// @Summary     Revoke the public share link
+// @Description Deletes the chat's share link so its token stops working. Revoking a chat without a link is a no-op.
+// @Tags        Chats
+// @Produce     json
+// @Security    BearerAuth
+// @Security    APIKeyAuth
+//
+// @Param       X-User-ID  header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       id         path    string  true  "Chat ID (UUID)"  format(uuid) example(141add05-4415-4938-b5a1-17e0d3171aff)
+//
+// @Success     204  {string} string "No Content"
+// @Failure     400  {object} handlers.ErrorResponse "Bad request"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid credentials"
+// @Failure     403  {object} handlers.ErrorResponse "Chat is only shared with the caller"
+// @Failure     404  {object} handlers.ErrorResponse "Chat not found"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /chats/{id}/share [delete]
+func (h *ShareLinkHandlers) RevokeShareLink(c *gin.Context) {
+	chatID := c.Param("id")
+	if _, err := uuid.Parse(chatID); err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "chat id must be a UUID")
+		return
+	}
+	if err := h.svc.Revoke(c.Request.Context(), caller(c), chatID); err != nil {
+		failChat(c, err)
+		return
+	}
+	noContent(c)
+}
+
+// GetSharedChat godoc
+// @ID          getSharedChat
+// @Summary     Read a shared chat
+// @Description Returns the title and messages (oldest first, with citations) of the chat behind a share link. No credentials are needed and none are used; user IDs are never included.
+// @Description Unknown, revoked and expired tokens, and deleted chats, are all 404. Rate limited per client IP, separately from authenticated traffic.
+// @Tags        Shared
+// @Produce     json
+//
+// @Param       token      path    string  true  "Share link token"
+// @Param       page       query   int     false "Page number (1-based)"  default(1)
+// @Param       page_size  query   int     false "Page size (max 100)"    default(20)
+//
+// @Success     200  {object} handlers.SharedChatResponse
+// @Failure     404  {object} handlers.ErrorResponse "Share link not found"
+// @Failure     429  {object} handlers.ErrorResponse "Rate limited"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /shared/{token} [get]
+func (h *ShareLinkHandlers) GetSharedChat(c *gin.Context) {
+	page, pageSize := clampMsgPagination(c)
+	shared, err := h.svc.View(c.Request.Context(), c.Param("token"), page, pageSize)
+	if err != nil {
+		if errors.Is(err, services.ErrShareLinkNotFound) {
+			fail(c, http.StatusNotFound, ErrCodeNotFound, "share link not found")
+			return
+		}
+		// Recorded for the request log; this endpoint is public.
+		_ = c.Error(err)
+		fail(c, http.StatusInternalServerError, ErrCodeInternal, "internal error")
+		return
+	}
+
+	msgs := make([]SharedMessage, len(shared.Messages))
+	for i, m := range shared.Messages {
+		msgs[i] = SharedMessage{Role: m.Role, Content: m.Content, Score: m.Score, CreatedAt: m.CreatedAt}
+		for _, s := range m.Citations {
+			msgs[i].Citations = append(msgs[i].Citations, SharedCitation{
+				Rank: s.Rank, DocID: s.DocID, Source: s.Source, Line: s.Line, Score: s.Score, Snippet: s.Snippet,
+			})
+		}
+	}
+	totalPages := int((shared.Total + int64(pageSize) - 1) / int64(pageSize))
+
+	// Links are bearer secrets: keep them out of shared caches and search engines.
+	c.Header("Cache-Control", "private, no-store")
+	c.Header("X-Robots-Tag", "noindex")
+	ok(c, http.StatusOK, SharedChatResponse{
+		Chat:     SharedChat{Title: shared.Chat.Title, CreatedAt: shared.Chat.CreatedAt, UpdatedAt: shared.Chat.UpdatedAt},
+		Messages: msgs,
+		Pagination: &Pagination{
+			Page:       page,
+			PageSize:   pageSize,
+			Total:      shared.Total,
+			TotalPages: totalPages,
+			HasNext:    page < totalPages,
+		},
+		ExpiresAt: shared.Link.ExpiresAt,
+	})
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/repo"
+	"github.com/tbourn/go-chat-backend/internal/services"
+)
+
+// brokenShareLinks fails every call.
+type brokenShareLinks struct{}
+
+func (brokenShareLinks) Create(context.Context, services.Caller, string, *time.Time) (*domain.ShareLink, string, error) {
+	return nil, "", errors.New("disk on fire")
+}
+
+func (brokenShareLinks) Revoke(context.Context, services.Caller, string) error {
+	return errors.New("disk on fire")
+}
+
+func (brokenShareLinks) View(context.Context, string, int, int) (*services.SharedChat, error) {
+	return nil, errors.New("disk on fire")
+}
+
+func TestShareLinkHandlers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newChatDB(t)
+	if err := db.AutoMigrate(&domain.ShareLink{}, &domain.MessageSource{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	ctx := context.Background()
+	ch, _ := repo.CreateChat(ctx, db, domain.DefaultWorkspaceID, "u1", "Roadmap")
+	score := 0.9
+	answer, _ := repo.CreateMessage(db, ch.ID, "assistant", "ship it", &score)
+	if _, err := repo.CreateMessageSources(db, answer.ID, []domain.MessageSource{{DocID: "7", Source: "data.md", Line: 3}}); err != nil {
+		t.Fatalf("CreateMessageSources: %v", err)
+	}
+
+	h := NewShareLinks(&services.ShareLinkService{DB: db})
+	r := gin.New()
+	r.POST("/chats/:id/share", h.CreateShareLink)
+	r.DELETE("/chats/:id/share", h.RevokeShareLink)
+	r.GET("/shared/:token", h.GetSharedChat)
+	r.GET("/broken/:token", NewShareLinks(brokenShareLinks{}).GetSharedChat)
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-User-ID", "u1")
+		r.ServeHTTP(w, req)
+		return w
+	}
+	path := "/chats/" + ch.ID + "/share"
+
+	for body, want := range map[string]int{
+		`{"expires_at":"yesterday"}`: http.StatusBadRequest,
+		`{"expires_at":"` + time.Now().Add(-time.Hour).UTC().Format(time.RFC3339) + `"}`: http.StatusBadRequest,
+	} {
+		if w := do(http.MethodPost, path, body); w.Code != want {
+			t.Fatalf("create %s -> %d, want %d", body, w.Code, want)
+		}
+	}
+	if w := do(http.MethodPost, "/chats/nope/share", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("bad id -> %d", w.Code)
+	}
+	if w := do(http.MethodPost, "/chats/"+uuid.NewString()+"/share", ""); w.Code != http.StatusNotFound {
+		t.Fatalf("unknown chat -> %d", w.Code)
+	}
+
+	// An empty body creates a link that never expires.
+	w := do(http.MethodPost, path, "")
+	var created CreateShareLinkResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || w.Code != http.StatusCreated ||
+		created.ExpiresAt != nil || w.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("create -> %d %s", w.Code, w.Body.String())
+	}
+
+	w = do(http.MethodGet, "/shared/"+created.Token+"?page_size=1", "")
+	var got SharedChatResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil || w.Code != http.StatusOK || got.Chat.Title != "Roadmap" ||
+		len(got.Messages) != 1 || got.Messages[0].Citations[0].Source != "data.md" || got.Pagination.Total != 1 ||
+		w.Header().Get("X-Robots-Tag") != "noindex" {
+		t.Fatalf("shared -> %d %s", w.Code, w.Body.String())
+	}
+
+	if w := do(http.MethodDelete, path, ""); w.Code != http.StatusNoContent {
+		t.Fatalf("revoke -> %d", w.Code)
+	}
+	for _, token := range []string{created.Token, "nope"} {
+		if w := do(http.MethodGet, "/shared/"+token, ""); w.Code != http.StatusNotFound {
+			t.Fatalf("shared %s -> %d, want 404", token, w.Code)
+		}
+	}
+
+	// Internal errors are not shown to the public.
+	if w := do(http.MethodGet, "/broken/x", ""); w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "fire") {
+		t.Fatalf("broken -> %d %s", w.Code, w.Body.String())
+	}
+}
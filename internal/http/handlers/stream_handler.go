@@ -0,0 +1,255 @@
+// Streaming message HTTP handler.
+//
+// This file exposes the Server-Sent Events variant of PostMessage:
+//   - POST /chats/{id}/messages:stream
+//   - POST /chats/{id}/messages with "Accept: text/event-stream"
+//
+// The request body, validation and idempotency rules are those of PostMessage.
+// Errors detected before the stream starts are returned as regular JSON
+// errors; once the first event is written, failures are reported as an
+// "error" event carrying an ErrorResponse and the stream ends.
+//
+// Events, in order:
+//
+//	event: user_message   data: {"message": {...}}        persisted user message
+//	event: candidates     data: {"candidates": [...]}     retrieval candidates
+//	event: chunk          data: {"text": "..."}           reply fragment (repeated)
+//	event: done           data: {"message_id": "...", "score": 0.42}
+//
+// A client disconnect cancels the request context, which stops retrieval and
+// leaves the assistant reply unpersisted. Because http.Server.WriteTimeout
+// bounds the whole response, the write deadline is pushed forward by the
+// configured timeout before every event.
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-contrib/sse"
+	"github.com/gin-gonic/gin"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/search"
+	"github.com/tbourn/go-chat-backend/internal/services"
+)
+
+// streamSuffix is the custom-method suffix of the streaming route. Gin cannot
+// escape ':' in a path, so ":stream" is registered as a wildcard segment
+// named "stream" whose value must be checked by the handler.
+const streamSuffix = ":stream"
+
+// SSE event names.
+const (
+	eventUserMessage = "user_message"
+	eventCandidates  = "candidates"
+	eventChunk       = "chunk"
+	eventDone        = "done"
+	eventError       = "error"
+)
+
+// MessageStreamer is implemented by message services that can report the
+// stages of an answer as they happen (see services.MessageService.AnswerStream).
+// Services without it are streamed as a single chunk after Answer returns.
+type MessageStreamer interface {
+	AnswerStream(ctx context.Context, caller services.Caller, chatID, prompt string, hooks services.StreamHooks) (*domain.Message, error)
+}
+
+//
+// Event DTOs
+//
+
+// StreamUserMessageEvent is the payload of the "user_message" event.
+type StreamUserMessageEvent struct {
+	Message *domain.Message `json:"message"`
+}
+
+// StreamCandidate is one retrieval candidate considered for the reply.
+type StreamCandidate struct {
+	DocID   string  `json:"doc_id,omitempty" example:"3f2a9c1d7b4e8a06"`
+	Source  string  `json:"source,omitempty" example:"data.md"`
+	Line    int     `json:"line,omitempty" example:"42"`
+	Score   float64 `json:"score" example:"0.42"`
+	Snippet string  `json:"snippet" example:"Gen Z in Nashville are 20% more likely to ..."`
+}
+
+// StreamCandidatesEvent is the payload of the "candidates" event.
+type StreamCandidatesEvent struct {
+	Candidates []StreamCandidate `json:"candidates"`
+}
+
+// StreamChunkEvent is the payload of a "chunk" event. Concatenating the text
+// of all chunks yields the reply.
+type StreamChunkEvent struct {
+	Text string `json:"text"`
+}
+
+// StreamDoneEvent is the payload of the final "done" event.
+type StreamDoneEvent struct {
+	// MessageID is the id of the stored assistant message.
+	MessageID string `json:"message_id" example:"7a8d9f4c-1b2a-4c3d-8e9f-0123456789ab"`
+	// Score is the retrieval score of the reply (omitted when declined).
+	Score *float64 `json:"score,omitempty" example:"0.42"`
+	// RetrievalQuery is the context-rewritten search query (only with ?debug=true).
+	RetrievalQuery string `json:"retrieval_query,omitempty" example:"and what about Instagram? Gen Z in Nashville"`
+}
+
+// WithStreamWriteTimeout sets how far the write deadline is extended before
+// each streamed event. It should match http.Server.WriteTimeout; zero leaves
+// the server deadline untouched.
+func (h *Handlers) WithStreamWriteTimeout(d time.Duration) *Handlers {
+	h.streamWriteTimeout = d
+	return h
+}
+
+// wantsEventStream reports whether the client negotiated an SSE response.
+func wantsEventStream(c *gin.Context) bool {
+	return strings.Contains(c.GetHeader("Accept"), "text/event-stream")
+}
+
+// StreamMessage godoc
+// @ID          streamMessage
+// @Summary     Send a message and stream the assistant reply
+// @Description Same as postMessage, but the response is a text/event-stream with the events
+// @Description user_message, candidates, chunk (repeated) and done; failures after the stream
+// @Description started arrive as an error event. Also available on POST /chats/{id}/messages
+// @Description with "Accept: text/event-stream".
+// @Tags        Messages
+// @Accept      json
+// @Produce     text/event-stream
+// @Security    BearerAuth
+//
+// @Param       X-User-ID        header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       Idempotency-Key  header  string  false "Idempotency key for safe retries (UUID recommended)"
+// @Param       id               path    string  true  "Chat ID (UUID)"              format(uuid)
+// @Param       debug            query   bool    false "Include retrieval_query in the done event"
+// @Param       body             body    handlers.PostMessageRequest  true  "User message payload"
+//
+// @Success     200  {object}  handlers.StreamDoneEvent  "Event stream; the final event carries the stored message id"
+// @Failure     400  {object}  handlers.ErrorResponse    "Bad request"
+// @Failure     401  {object}  handlers.ErrorResponse    "Missing or invalid bearer token"
+// @Failure     404  {object}  handlers.ErrorResponse    "Chat not found"
+// @Failure     409  {object}  handlers.ErrorResponse    "A request with this Idempotency-Key is in flight (idempotency_in_flight), or another message was posted meanwhile (conflict)"
+// @Failure     422  {object}  handlers.ErrorResponse    "Idempotency-Key reused with a different body (idempotency_key_reused)"
+// @Failure     429  {object}  handlers.ErrorResponse    "Usage quota exceeded (quota_exceeded)"
+// @Router      /chats/{id}/messages:stream [post]
+func (h *Handlers) StreamMessage(c *gin.Context) {
+	if c.Param("stream") != streamSuffix {
+		fail(c, http.StatusNotFound, ErrCodeNotFound, "route not found")
+		return
+	}
+	h.streamMessage(c)
+}
+
+// streamMessage serves a validated PostMessage request as an event stream.
+func (h *Handlers) streamMessage(c *gin.Context) {
+	ctx := c.Request.Context()
+	chatID, content, maxRunes, valid := h.bindMessage(c)
+	if !valid {
+		return
+	}
+	currentUser := caller(c)
+
+	s := &eventStream{c: c, timeout: h.streamWriteTimeout}
+
+	var (
+		m   *domain.Message
+		err error
+	)
+	if streamer, isStreamer := h.msgSvc.(MessageStreamer); isStreamer {
+		m, err = streamer.AnswerStream(ctx, currentUser, chatID, content, services.StreamHooks{
+			UserMessage: func(um *domain.Message) error {
+				return s.send(eventUserMessage, StreamUserMessageEvent{Message: um})
+			},
+			Candidates: func(rs []search.Result) error {
+				return s.send(eventCandidates, StreamCandidatesEvent{Candidates: streamCandidates(rs)})
+			},
+			Chunk: func(text string) error {
+				return s.send(eventChunk, StreamChunkEvent{Text: text})
+			},
+		})
+	} else {
+		m, err = h.msgSvc.Answer(ctx, currentUser, chatID, content)
+		if err == nil {
+			err = s.send(eventChunk, StreamChunkEvent{Text: m.Content})
+		}
+	}
+	if err != nil {
+		// The status may already be 200; the recorded error keeps the
+		// incomplete stream out of the idempotency cache.
+		_ = c.Error(err)
+		switch {
+		case errors.Is(err, context.Canceled), errors.Is(err, s.writeErr):
+			// Client went away; nobody is listening.
+		case !s.started:
+			failAnswer(c, err, maxRunes)
+		default:
+			_, code, msg := answerError(err, maxRunes)
+			_ = s.send(eventError, ErrorResponse{
+				RequestID: c.Writer.Header().Get("X-Request-ID"),
+				Code:      code,
+				Message:   msg,
+			})
+		}
+		return
+	}
+
+	done := StreamDoneEvent{MessageID: m.ID, Score: m.Score}
+	if retrievalDebug(c) {
+		done.RetrievalQuery = m.RetrievalQuery
+	}
+	_ = s.send(eventDone, done)
+}
+
+// streamCandidates maps search results to their wire form.
+func streamCandidates(rs []search.Result) []StreamCandidate {
+	out := make([]StreamCandidate, 0, len(rs))
+	for _, r := range rs {
+		out = append(out, StreamCandidate{
+			DocID:   r.DocID,
+			Source:  r.Source,
+			Line:    r.Line,
+			Score:   r.Score,
+			Snippet: r.Snippet,
+		})
+	}
+	return out
+}
+
+// eventStream writes SSE events to a Gin response, sending the stream headers
+// with the first event and flushing after every event.
+type eventStream struct {
+	c        *gin.Context
+	timeout  time.Duration
+	started  bool
+	writeErr error // first write error; later sends fail fast with it
+}
+
+func (s *eventStream) send(event string, data any) error {
+	if s.writeErr != nil {
+		return s.writeErr
+	}
+	w := s.c.Writer
+	if s.timeout > 0 {
+		// Unsupported when the writer is wrapped (e.g. by gzip); the server
+		// deadline then applies to the whole stream.
+		_ = http.NewResponseController(w).SetWriteDeadline(time.Now().Add(s.timeout))
+	}
+	if !s.started {
+		h := w.Header()
+		h.Set("Content-Type", "text/event-stream")
+		h.Set("Cache-Control", "no-cache")
+		h.Set("X-Accel-Buffering", "no") // disable proxy buffering (nginx)
+		w.WriteHeader(http.StatusOK)
+		s.started = true
+	}
+	if err := sse.Encode(w, sse.Event{Event: event, Data: data}); err != nil {
+		s.writeErr = err
+		return err
+	}
+	w.Flush()
+	return nil
+}
@@ -0,0 +1,293 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	gingzip "github.com/gin-contrib/gzip"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/http/middleware"
+	"github.com/tbourn/go-chat-backend/internal/search"
+	"github.com/tbourn/go-chat-backend/internal/services"
+)
+
+// sseEvent is one parsed Server-Sent Event.
+type sseEvent struct {
+	name string
+	data string
+}
+
+func parseSSE(t *testing.T, body string) []sseEvent {
+	t.Helper()
+	var out []sseEvent
+	for _, block := range strings.Split(strings.TrimSpace(body), "\n\n") {
+		var ev sseEvent
+		for _, line := range strings.Split(block, "\n") {
+			switch {
+			case strings.HasPrefix(line, "event:"):
+				ev.name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+			case strings.HasPrefix(line, "data:"):
+				ev.data += strings.TrimPrefix(line, "data:")
+			}
+		}
+		if ev.name != "" {
+			out = append(out, ev)
+		}
+	}
+	return out
+}
+
+func eventNames(evs []sseEvent) string {
+	names := make([]string, len(evs))
+	for i, e := range evs {
+		names[i] = e.name
+	}
+	return strings.Join(names, ",")
+}
+
+// stubStreamSvc is a MessageService that also implements MessageStreamer.
+type stubStreamSvc struct {
+	stubMsgSvc
+	stream func(ctx context.Context, hooks services.StreamHooks) (*domain.Message, error)
+}
+
+func (s stubStreamSvc) AnswerStream(ctx context.Context, _ services.Caller, _, _ string, hooks services.StreamHooks) (*domain.Message, error) {
+	return s.stream(ctx, hooks)
+}
+
+func newStreamRouter(h *Handlers, mw ...gin.HandlerFunc) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(mw...)
+	r.POST("/chats/:id/messages", h.PostMessage)
+	r.POST("/chats/:id/messages:stream", h.StreamMessage)
+	return r
+}
+
+func postStream(r http.Handler, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+	req.Header.Set("X-User-ID", "u1")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestStreamMessage_RealService_EventsAndPersistence(t *testing.T) {
+	db := newTestDB(t)
+	idx, err := search.NewIndexFromReader(strings.NewReader(
+		"Gen Z in Nashville spend more on streaming platforms than any other generation surveyed this year."),
+		search.WithMinParagraphRunes(0), search.WithSource("data.md"))
+	if err != nil {
+		t.Fatalf("index: %v", err)
+	}
+	ms := &services.MessageService{DB: db, Index: idx, Threshold: 0.01, MaxPromptRunes: 2000}
+	r := newStreamRouter(New(stubChatSvc{}, ms, nil))
+
+	for _, tc := range []struct {
+		name    string
+		suffix  string
+		headers map[string]string
+	}{
+		{"custom method route", "/messages:stream", nil},
+		{"accept negotiation", "/messages", map[string]string{"Accept": "text/event-stream"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			chatID := uuid.NewString()
+			if err := db.Create(&domain.Chat{ID: chatID, UserID: "u1", Title: "T"}).Error; err != nil {
+				t.Fatalf("seed chat: %v", err)
+			}
+			w := postStream(r, "/chats/"+chatID+tc.suffix, `{"content":"Gen Z in Nashville streaming platforms"}`, tc.headers)
+			if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+				t.Fatalf("status=%d ct=%q body=%s", w.Code, w.Header().Get("Content-Type"), w.Body.String())
+			}
+			if w.Header().Get("Cache-Control") != "no-cache" {
+				t.Fatalf("missing Cache-Control: %v", w.Header())
+			}
+
+			evs := parseSSE(t, w.Body.String())
+			if len(evs) < 4 || evs[0].name != eventUserMessage || evs[1].name != eventCandidates || evs[len(evs)-1].name != eventDone {
+				t.Fatalf("unexpected events: %s", eventNames(evs))
+			}
+
+			var um StreamUserMessageEvent
+			if err := json.Unmarshal([]byte(evs[0].data), &um); err != nil || um.Message.Role != "user" || um.Message.ChatID != chatID {
+				t.Fatalf("user_message: %+v err=%v", um, err)
+			}
+			var cands StreamCandidatesEvent
+			if err := json.Unmarshal([]byte(evs[1].data), &cands); err != nil || len(cands.Candidates) != 1 || cands.Candidates[0].Source != "data.md" || cands.Candidates[0].DocID == "" {
+				t.Fatalf("candidates: %+v err=%v", cands, err)
+			}
+			var text strings.Builder
+			for _, e := range evs[2 : len(evs)-1] {
+				var ch StreamChunkEvent
+				if e.name != eventChunk || json.Unmarshal([]byte(e.data), &ch) != nil {
+					t.Fatalf("expected chunk, got %+v", e)
+				}
+				text.WriteString(ch.Text)
+			}
+			var done StreamDoneEvent
+			if err := json.Unmarshal([]byte(evs[len(evs)-1].data), &done); err != nil || done.MessageID == "" || done.Score == nil {
+				t.Fatalf("done: %+v err=%v", done, err)
+			}
+
+			var stored domain.Message
+			if err := db.First(&stored, "id = ?", done.MessageID).Error; err != nil {
+				t.Fatalf("assistant message not stored: %v", err)
+			}
+			if stored.Content != text.String() || stored.Role != "assistant" {
+				t.Fatalf("streamed %q but stored %q", text.String(), stored.Content)
+			}
+		})
+	}
+}
+
+func TestStreamMessage_PreStreamErrorsAreJSON(t *testing.T) {
+	db := newTestDB(t)
+	ms := &services.MessageService{DB: db, MaxPromptRunes: 10}
+	r := newStreamRouter(New(stubChatSvc{}, ms, nil))
+	chatID := uuid.NewString()
+
+	cases := []struct {
+		name, path, body string
+		status           int
+		code             string
+	}{
+		{"bogus suffix", "/chats/" + chatID + "/messagesXX", `{"content":"hi"}`, http.StatusNotFound, ErrCodeNotFound},
+		{"bad uuid", "/chats/nope/messages:stream", `{"content":"hi"}`, http.StatusBadRequest, ErrCodeBadRequest},
+		{"too long", "/chats/" + chatID + "/messages:stream", `{"content":"way more than ten runes"}`, http.StatusBadRequest, ErrCodeBadRequest},
+		{"chat not found", "/chats/" + chatID + "/messages:stream", `{"content":"hi"}`, http.StatusNotFound, ErrCodeNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := postStream(r, tc.path, tc.body, nil)
+			var er ErrorResponse
+			if w.Code != tc.status || json.Unmarshal(w.Body.Bytes(), &er) != nil || er.Code != tc.code {
+				t.Fatalf("status=%d body=%s", w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestStreamMessage_ErrorAfterStartIsEvent_CancelIsSilent(t *testing.T) {
+	started := func(ctx context.Context, hooks services.StreamHooks, err error) (*domain.Message, error) {
+		if herr := hooks.UserMessage(&domain.Message{ID: "m-user", Role: "user"}); herr != nil {
+			return nil, herr
+		}
+		return nil, err
+	}
+	chatPath := "/chats/" + uuid.NewString() + "/messages:stream"
+
+	h := New(stubChatSvc{}, stubStreamSvc{stream: func(ctx context.Context, hooks services.StreamHooks) (*domain.Message, error) {
+		return started(ctx, hooks, errors.New("db down"))
+	}}, nil)
+	w := postStream(newStreamRouter(h), chatPath, `{"content":"hi"}`, nil)
+	evs := parseSSE(t, w.Body.String())
+	if w.Code != http.StatusOK || eventNames(evs) != "user_message,error" {
+		t.Fatalf("status=%d events=%s", w.Code, eventNames(evs))
+	}
+	var er ErrorResponse
+	if err := json.Unmarshal([]byte(evs[1].data), &er); err != nil || er.Code != ErrCodeAnswerFailed {
+		t.Fatalf("error event: %+v err=%v", er, err)
+	}
+
+	h = New(stubChatSvc{}, stubStreamSvc{stream: func(ctx context.Context, hooks services.StreamHooks) (*domain.Message, error) {
+		return started(ctx, hooks, context.Canceled)
+	}}, nil)
+	w = postStream(newStreamRouter(h), chatPath, `{"content":"hi"}`, nil)
+	if evs := parseSSE(t, w.Body.String()); eventNames(evs) != "user_message" {
+		t.Fatalf("cancel should end the stream silently, got %s", eventNames(evs))
+	}
+}
+
+func TestStreamMessage_FallbackWithoutStreamer(t *testing.T) {
+	score := 0.5
+	h := New(stubChatSvc{}, stubMsgSvc{answer: func(context.Context, string, string, string) (*domain.Message, error) {
+		return &domain.Message{ID: "m1", Role: "assistant", Content: "whole reply", Score: &score}, nil
+	}}, nil)
+	w := postStream(newStreamRouter(h), "/chats/"+uuid.NewString()+"/messages:stream", `{"content":"hi"}`, nil)
+	evs := parseSSE(t, w.Body.String())
+	if eventNames(evs) != "chunk,done" || !strings.Contains(evs[0].data, "whole reply") || !strings.Contains(evs[1].data, `"message_id":"m1"`) {
+		t.Fatalf("unexpected fallback stream: %s", w.Body.String())
+	}
+}
+
+func TestStreamMessage_Gzip(t *testing.T) {
+	h := New(stubChatSvc{}, stubMsgSvc{answer: func(context.Context, string, string, string) (*domain.Message, error) {
+		return &domain.Message{ID: "m1", Role: "assistant", Content: "zipped"}, nil
+	}}, nil)
+	path := "/chats/" + uuid.NewString() + "/messages:stream"
+	gz := map[string]string{"Accept-Encoding": "gzip"}
+
+	// Default gzip settings compress the stream; events still arrive intact.
+	w := postStream(newStreamRouter(h, gingzip.Gzip(gingzip.DefaultCompression)), path, `{"content":"hi"}`, gz)
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("expected gzip-encoded stream, headers=%v", w.Header())
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("gzip reader: %v", err)
+	}
+	plain, _ := io.ReadAll(zr)
+	if evs := parseSSE(t, string(plain)); eventNames(evs) != "chunk,done" {
+		t.Fatalf("unexpected events through gzip: %q", plain)
+	}
+
+	// With the server's predicate, streams are sent uncompressed.
+	w = postStream(newStreamRouter(h, gingzip.Gzip(gingzip.DefaultCompression, gingzip.WithCustomShouldCompressFn(middleware.ShouldCompress))), path, `{"content":"hi"}`, gz)
+	if w.Header().Get("Content-Encoding") != "" {
+		t.Fatalf("stream should not be compressed, headers=%v", w.Header())
+	}
+	if evs := parseSSE(t, w.Body.String()); eventNames(evs) != "chunk,done" {
+		t.Fatalf("unexpected events: %s", w.Body.String())
+	}
+}
+
+func TestStreamMessage_ExtendsWriteDeadline(t *testing.T) {
+	const (
+		writeTimeout = 300 * time.Millisecond
+		chunks       = 4
+		pause        = 120 * time.Millisecond // chunks*pause > writeTimeout
+	)
+	h := New(stubChatSvc{}, stubStreamSvc{stream: func(ctx context.Context, hooks services.StreamHooks) (*domain.Message, error) {
+		for i := 0; i < chunks; i++ {
+			time.Sleep(pause)
+			if err := hooks.Chunk("x"); err != nil {
+				return nil, err
+			}
+		}
+		return &domain.Message{ID: "m-slow"}, nil
+	}}, nil).WithStreamWriteTimeout(writeTimeout)
+
+	srv := httptest.NewUnstartedServer(newStreamRouter(h))
+	srv.Config.WriteTimeout = writeTimeout
+	srv.Start()
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL+"/chats/"+uuid.NewString()+"/messages:stream", "application/json", strings.NewReader(`{"content":"hi"}`))
+	if err != nil {
+		t.Fatalf("post: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("stream cut short: %v (got %q)", err, body)
+	}
+	if evs := parseSSE(t, string(body)); eventNames(evs) != "chunk,chunk,chunk,chunk,done" {
+		t.Fatalf("unexpected events: %q", body)
+	}
+}
@@ -0,0 +1,326 @@
+// Chat transfer HTTP handlers.
+//
+// This file exposes whole-chat transfers:
+//   - GET  /chats/{id}/export?format=md|json|html  (download the transcript)
+//   - POST /chats/import                            (restore JSON exports)
+//
+// Exports are streamed: the transcript is written page by page as the
+// messages are read, so the response starts before the whole chat is loaded.
+// Imports take the JSON export document, one per request or one per line
+// (NDJSON), and report the outcome of every chat. Every imported chat counts
+// against the chat quotas; a chat over quota fails on its own.
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/export"
+	"github.com/tbourn/go-chat-backend/internal/http/middleware"
+	"github.com/tbourn/go-chat-backend/internal/services"
+)
+
+// TransferService defines chat export and import.
+type TransferService interface {
+	// Export writes the transcript of a chat the caller may read to w.
+	Export(ctx context.Context, caller services.Caller, chatID string, w export.Writer) error
+	// Import stores an export document as a new chat of the caller.
+	Import(ctx context.Context, caller services.Caller, doc export.Document) (*domain.Chat, error)
+}
+
+// TransferHandlers groups chat export and import endpoints.
+type TransferHandlers struct {
+	svc TransferService
+
+	// quota counts imported chats; nil counts nothing.
+	quota middleware.QuotaEnforcer
+
+	// writeTimeout extends the write deadline per written page.
+	writeTimeout time.Duration
+}
+
+// NewTransfer constructs TransferHandlers bound to the given service.
+func NewTransfer(svc TransferService) *TransferHandlers {
+	return &TransferHandlers{svc: svc}
+}
+
+// WithWriteTimeout sets how far the write deadline is extended before each
+// page of an export, so long exports are not cut off by the server's write
+// timeout. It should match http.Server.WriteTimeout; zero leaves the server
+// deadline untouched.
+func (h *TransferHandlers) WithWriteTimeout(d time.Duration) *TransferHandlers {
+	h.writeTimeout = d
+	return h
+}
+
+// WithQuota counts every imported chat as one unit of domain.UsageChats
+// against q, refunded if the chat is not imported.
+func (h *TransferHandlers) WithQuota(q middleware.QuotaEnforcer) *TransferHandlers {
+	h.quota = q
+	return h
+}
+
+// ExportChat godoc
+// @ID          exportChat
+// @Summary     Export a chat
+// @Description Downloads the full transcript of a chat the caller can read: title, timestamps, roles, scores, feedback values and citations.
+// @Description md and html are for people; json is a versioned document (kind "go-chat-backend/chat", version 1) for programs.
+// @Description The transcript is streamed as messages are read, so an error midway truncates it (a json export is then invalid).
+// @Tags        Chats
+// @Produce     text/markdown
+// @Produce     json
+// @Produce     html
+// @Security    BearerAuth
+// @Security    APIKeyAuth
+//
+// @Param       X-User-ID  header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       id         path    string  true  "Chat ID (UUID)"
+// @Param       format     query   string  false "Export format"  Enums(md, json, html) default(md)
+//
+// @Success     200  {file}   file "Transcript"
+// @Header      200  {string} Content-Disposition  "attachment; filename derived from the chat title"
+// @Failure     400  {object} handlers.ErrorResponse "Bad request (invalid id or format)"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid credentials"
+// @Failure     404  {object} handlers.ErrorResponse "Chat not found"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /chats/{id}/export [get]
+func (h *TransferHandlers) ExportChat(c *gin.Context) {
+	chatID := c.Param("id")
+	if _, err := uuid.Parse(chatID); err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "chat id must be a UUID")
+		return
+	}
+	format, err := export.ParseFormat(c.DefaultQuery("format", string(export.Markdown)))
+	if err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "format must be md, json or html")
+		return
+	}
+	w, _ := export.NewWriter(format, c.Writer, time.Now().UTC())
+
+	resp := &exportResponse{c: c, w: w, format: format, timeout: h.writeTimeout}
+	if err := h.svc.Export(c.Request.Context(), caller(c), chatID, resp); err != nil {
+		if !resp.started {
+			failChat(c, err)
+			return
+		}
+		// The status is already sent and the transcript is truncated;
+		// record the error for the request log.
+		_ = c.Error(err)
+	}
+}
+
+// exportResponse is the export.Writer of an export response: it sends the
+// headers when the transcript begins and flushes every page to the client.
+type exportResponse struct {
+	c       *gin.Context
+	w       export.Writer
+	format  export.Format
+	timeout time.Duration
+	started bool
+}
+
+func (r *exportResponse) Begin(chat export.Chat) error {
+	h := r.c.Writer.Header()
+	h.Set("Content-Type", r.format.ContentType())
+	h.Set("Content-Disposition", export.ContentDisposition(chat.Title, r.format))
+	h.Set("Cache-Control", "no-store")
+	r.c.Status(http.StatusOK)
+	r.started = true
+	r.extend()
+	return r.w.Begin(chat)
+}
+
+func (r *exportResponse) Messages(msgs []export.Message) error {
+	r.extend()
+	if err := r.w.Messages(msgs); err != nil {
+		return err
+	}
+	r.c.Writer.Flush()
+	return nil
+}
+
+func (r *exportResponse) End() error {
+	return r.w.End()
+}
+
+// extend pushes the write deadline forward by the timeout, if set.
+func (r *exportResponse) extend() {
+	if r.timeout > 0 {
+		// Unsupported when the writer is wrapped (e.g. by gzip); the server
+		// deadline then applies to the whole export.
+		_ = http.NewResponseController(r.c.Writer).SetWriteDeadline(time.Now().Add(r.timeout))
+	}
+}
+
+// ImportResult reports the outcome of one chat of an import.
+type ImportResult struct {
+	// Index is the position of the chat in the request (its line for NDJSON).
+	Index int `json:"index" example:"0"`
+	// SourceID is the chat ID in the imported document.
+	SourceID string `json:"source_id,omitempty" example:"7b0c5bb4-2f60-4c2e-9a0e-0d9d3b8e8c11"`
+	// ChatID is the ID of the new chat; empty when the chat failed.
+	ChatID string `json:"chat_id,omitempty" example:"1f0f3a51-61a6-4d8b-8b8e-7f0b1bde1c25"`
+	// Title is the title of the new chat.
+	Title string `json:"title,omitempty" example:"Gen Z trends"`
+	// Messages is the number of imported messages.
+	Messages int `json:"messages" example:"12"`
+	// Error explains why the chat was not imported.
+	Error *ErrorResponse `json:"error,omitempty"`
+}
+
+// ImportChatsResponse is the result of POST /chats/import.
+type ImportChatsResponse struct {
+	Imported int            `json:"imported" example:"2"`
+	Failed   int            `json:"failed" example:"1"`
+	Results  []ImportResult `json:"results"`
+}
+
+// ImportChats godoc
+// @ID          importChats
+// @Summary     Import chats
+// @Description Stores chats from JSON export documents (kind "go-chat-backend/chat", version 1) as new chats of the caller.
+// @Description Send one document as application/json, or many as application/x-ndjson (one document per line).
+// @Description Chats, messages and citations get new IDs; titles, contents, scores, citations and timestamps are kept; feedback is not imported.
+// @Description Every chat is written in its own transaction, so one invalid chat does not stop the others; see the per-chat results.
+// @Description Every imported chat counts against the chat quotas; chats over quota fail with code quota_exceeded. Imported messages do not count against the message quotas.
+// @Tags        Chats
+// @Accept      json
+// @Accept      x-ndjson
+// @Produce     json
+// @Security    BearerAuth
+// @Security    APIKeyAuth
+//
+// @Param       X-User-ID  header  string           false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       body       body    export.Document  true  "Export document (or NDJSON of documents)"
+//
+// @Success     200  {object} handlers.ImportChatsResponse "Per-chat results"
+// @Failure     400  {object} handlers.ErrorResponse "Bad request (empty or malformed body)"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid credentials"
+// @Failure     413  {object} handlers.ErrorResponse "Body exceeds IMPORT_MAX_BYTES"
+// @Failure     415  {object} handlers.ErrorResponse "Unsupported content type"
+// @Router      /chats/import [post]
+func (h *TransferHandlers) ImportChats(c *gin.Context) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			fail(c, http.StatusRequestEntityTooLarge, ErrCodePayloadTooLarge, "import body is too large")
+			return
+		}
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "could not read body")
+		return
+	}
+
+	var docs [][]byte
+	switch c.ContentType() {
+	case "", "application/json":
+		if len(bytes.TrimSpace(body)) == 0 {
+			fail(c, http.StatusBadRequest, ErrCodeBadRequest, "body is empty")
+			return
+		}
+		if !json.Valid(body) {
+			fail(c, http.StatusBadRequest, ErrCodeBadRequest, "body is not a JSON document")
+			return
+		}
+		docs = [][]byte{body}
+	case "application/x-ndjson", "application/jsonl":
+		if len(bytes.TrimSpace(body)) == 0 {
+			fail(c, http.StatusBadRequest, ErrCodeBadRequest, "body is empty")
+			return
+		}
+		// Blank lines are skipped but still counted, so Index is the line.
+		docs = bytes.Split(body, []byte("\n"))
+	default:
+		fail(c, http.StatusUnsupportedMediaType, ErrCodeBadRequest, "content type must be application/json or application/x-ndjson")
+		return
+	}
+
+	resp := ImportChatsResponse{Results: []ImportResult{}}
+	for i, raw := range docs {
+		if len(bytes.TrimSpace(raw)) == 0 {
+			continue
+		}
+		res := h.importOne(c, raw)
+		res.Index = i
+		if res.Error != nil {
+			resp.Failed++
+		} else {
+			resp.Imported++
+		}
+		resp.Results = append(resp.Results, res)
+	}
+	ok(c, http.StatusOK, resp)
+}
+
+// importOne decodes and imports a single document.
+func (h *TransferHandlers) importOne(c *gin.Context, raw []byte) ImportResult {
+	var doc export.Document
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return ImportResult{Error: importError(c, ErrCodeBadRequest, "malformed document: "+err.Error())}
+	}
+	res := ImportResult{SourceID: doc.Chat.ID, Messages: len(doc.Messages)}
+	counters, exceeded := h.consumeChat(c)
+	if exceeded != nil {
+		res.Messages = 0
+		res.Error = importError(c, ErrCodeQuotaExceeded, exceeded.Message)
+		return res
+	}
+	chat, err := h.svc.Import(c.Request.Context(), caller(c), doc)
+	if err != nil {
+		h.refundChat(c, counters)
+	}
+	switch {
+	case errors.Is(err, services.ErrInvalidImport):
+		res.Messages = 0
+		res.Error = importError(c, ErrCodeBadRequest, err.Error())
+	case err != nil:
+		// Recorded for the request log; the client only learns it failed.
+		_ = c.Error(err)
+		res.Messages = 0
+		res.Error = importError(c, ErrCodeInternal, "import failed")
+	default:
+		res.ChatID, res.Title = chat.ID, chat.Title
+	}
+	return res
+}
+
+// consumeChat counts one imported chat against the caller's chat quotas.
+// Enforcer errors are logged and the chat is let through, as by
+// middleware.Quota.
+func (h *TransferHandlers) consumeChat(c *gin.Context) ([]domain.UsageCounter, *middleware.QuotaExceeded) {
+	if h.quota == nil {
+		return nil, nil
+	}
+	cl := caller(c)
+	counters, exceeded, err := h.quota.ConsumeQuota(c.Request.Context(), cl.WorkspaceID, cl.UserID, domain.UsageChats)
+	if err != nil {
+		middleware.LoggerFrom(c).Error().Err(err).Str("metric", domain.UsageChats).Msg("quota check failed; allowing import")
+		return nil, nil
+	}
+	return counters, exceeded
+}
+
+// refundChat gives back the unit counted by consumeChat for a chat that was
+// not imported.
+func (h *TransferHandlers) refundChat(c *gin.Context, counters []domain.UsageCounter) {
+	if h.quota == nil || len(counters) == 0 {
+		return
+	}
+	if err := h.quota.RefundQuota(c.Request.Context(), counters); err != nil {
+		middleware.LoggerFrom(c).Error().Err(err).Str("metric", domain.UsageChats).Msg("quota refund failed")
+	}
+}
+
+// importError builds the error of a failed chat of an import.
+func importError(c *gin.Context, code, msg string) *ErrorResponse {
+	return &ErrorResponse{RequestID: c.Writer.Header().Get("X-Request-ID"), Code: code, Message: msg}
+}
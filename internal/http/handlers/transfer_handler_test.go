@@ -0,0 +1,203 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/export"
+	"github.com/tbourn/go-chat-backend/internal/http/middleware"
+	"github.com/tbourn/go-chat-backend/internal/repo"
+	"github.com/tbourn/go-chat-backend/internal/services"
+)
+
+// failingTransferSvc begins an export and then fails; imports fail outright.
+type failingTransferSvc struct{}
+
+func (failingTransferSvc) Import(context.Context, services.Caller, export.Document) (*domain.Chat, error) {
+	return nil, errors.New("disk on fire")
+}
+
+func (failingTransferSvc) Export(_ context.Context, _ services.Caller, _ string, w export.Writer) error {
+	if err := w.Begin(export.Chat{Title: "t"}); err != nil {
+		return err
+	}
+	return errors.New("disk on fire")
+}
+
+func TestExportChat(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newChatDB(t)
+	ctx := context.Background()
+	ch, _ := repo.CreateChat(ctx, db, domain.DefaultWorkspaceID, "u1", "Gen Z: trends")
+	for _, content := range []string{"first", "second"} {
+		if _, err := repo.CreateMessage(db, ch.ID, "user", content, nil); err != nil {
+			t.Fatalf("CreateMessage: %v", err)
+		}
+	}
+
+	r := gin.New()
+	r.GET("/chats/:id/export", NewTransfer(&services.TransferService{DB: db, PageSize: 1}).ExportChat)
+	r.GET("/broken/:id/export", NewTransfer(failingTransferSvc{}).ExportChat)
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-User-ID", "u1")
+		r.ServeHTTP(w, req)
+		return w
+	}
+	path := "/chats/" + ch.ID + "/export"
+
+	w := get(path)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/markdown; charset=utf-8" ||
+		w.Header().Get("Content-Disposition") != `attachment; filename="gen-z-trends.md"` ||
+		!strings.Contains(w.Body.String(), "# Gen Z: trends") || !strings.Contains(w.Body.String(), "second") {
+		t.Fatalf("md -> %d %v\n%s", w.Code, w.Header(), w.Body.String())
+	}
+
+	w = get(path + "?format=json")
+	var doc export.Document
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil || w.Code != http.StatusOK ||
+		doc.Version != export.DocumentVersion || doc.Chat.ID != ch.ID || len(doc.Messages) != 2 || doc.Messages[1].Content != "second" {
+		t.Fatalf("json -> %d %s (%v)", w.Code, w.Body.String(), err)
+	}
+	if w := get(path + "?format=html"); w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+		t.Fatalf("html -> %d %v", w.Code, w.Header())
+	}
+
+	for p, want := range map[string]int{
+		path + "?format=pdf":                     http.StatusBadRequest,
+		"/chats/nope/export":                     http.StatusBadRequest,
+		"/chats/" + uuid.NewString() + "/export": http.StatusNotFound,
+	} {
+		if w := get(p); w.Code != want || w.Header().Get("Content-Disposition") != "" {
+			t.Fatalf("%s -> %d, want %d", p, w.Code, want)
+		}
+	}
+
+	// Failing midway keeps the 200 already sent; the transcript is cut short.
+	if w := get("/broken/" + uuid.NewString() + "/export"); w.Code != http.StatusOK || strings.Contains(w.Body.String(), "error") {
+		t.Fatalf("broken -> %d %s", w.Code, w.Body.String())
+	}
+}
+
+// chatQuota allows left chats and records refunds.
+type chatQuota struct {
+	left     int
+	refunded int
+}
+
+func (q *chatQuota) ConsumeQuota(_ context.Context, _, _, metric string) ([]domain.UsageCounter, *middleware.QuotaExceeded, error) {
+	if metric != domain.UsageChats {
+		return nil, nil, errors.New("unexpected metric " + metric)
+	}
+	if q.left == 0 {
+		return nil, &middleware.QuotaExceeded{Message: "user daily quota of 2 chats exceeded"}, nil
+	}
+	q.left--
+	return []domain.UsageCounter{{Metric: metric}}, nil, nil
+}
+
+func (q *chatQuota) RefundQuota(_ context.Context, counters []domain.UsageCounter) error {
+	q.left += len(counters)
+	q.refunded += len(counters)
+	return nil
+}
+
+func TestImportChats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newChatDB(t)
+	if err := db.AutoMigrate(&domain.MessageSource{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	r := gin.New()
+	r.POST("/chats/import", NewTransfer(&services.TransferService{DB: db}).ImportChats)
+	r.POST("/broken/import", NewTransfer(failingTransferSvc{}).ImportChats)
+	quota := &chatQuota{left: 2}
+	r.POST("/quota/import", NewTransfer(&services.TransferService{DB: db}).WithQuota(quota).ImportChats)
+	post := func(path, contentType, body string) (*httptest.ResponseRecorder, ImportChatsResponse) {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("X-User-ID", "u1")
+		req.Header.Set("Content-Type", contentType)
+		r.ServeHTTP(w, req)
+		var resp ImportChatsResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		return w, resp
+	}
+	at := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	doc := func(title, role string) string {
+		b, _ := json.Marshal(export.Document{
+			Kind: export.DocumentKind, Version: export.DocumentVersion,
+			Chat:     export.Chat{ID: "src-" + title, Title: title, CreatedAt: at},
+			Messages: []export.Message{{Role: role, Content: "hi", CreatedAt: at}},
+		})
+		return string(b)
+	}
+
+	w, resp := post("/chats/import", "application/json", doc("One", "user"))
+	if w.Code != http.StatusOK || resp.Imported != 1 || resp.Failed != 0 || resp.Results[0].SourceID != "src-One" ||
+		resp.Results[0].Title != "One" || resp.Results[0].Messages != 1 {
+		t.Fatalf("json -> %d %s", w.Code, w.Body.String())
+	}
+	ch, err := repo.GetChat(context.Background(), db, domain.DefaultWorkspaceID, resp.Results[0].ChatID, "u1")
+	if err != nil || ch.UserID != "u1" || !ch.CreatedAt.Equal(at) {
+		t.Fatalf("imported chat = %+v, %v", ch, err)
+	}
+
+	// NDJSON reports each line; bad lines do not stop the others.
+	body := doc("Two", "user") + "\n\n" + doc("Bad", "system") + "\n{oops\n" + doc("Three", "assistant") + "\n"
+	w, resp = post("/chats/import", "application/x-ndjson", body)
+	if w.Code != http.StatusOK || resp.Imported != 2 || resp.Failed != 2 || len(resp.Results) != 4 {
+		t.Fatalf("ndjson -> %d %s", w.Code, w.Body.String())
+	}
+	if res := resp.Results[1]; res.Index != 2 || res.ChatID != "" || res.Error == nil || res.Error.Code != ErrCodeBadRequest ||
+		!strings.Contains(res.Error.Message, "role") {
+		t.Fatalf("bad role = %+v", res)
+	}
+	if res := resp.Results[2]; res.Index != 3 || res.Error == nil || !strings.Contains(res.Error.Message, "malformed") {
+		t.Fatalf("bad line = %+v", res)
+	}
+	if res := resp.Results[3]; res.Index != 4 || res.Title != "Three" || res.Error != nil {
+		t.Fatalf("last = %+v", res)
+	}
+
+	if _, resp := post("/broken/import", "application/json", doc("One", "user")); resp.Failed != 1 ||
+		resp.Results[0].Error.Code != ErrCodeInternal || strings.Contains(resp.Results[0].Error.Message, "fire") {
+		t.Fatalf("broken = %+v", resp)
+	}
+	// Every chat is counted; failed chats are refunded and over-quota chats
+	// fail on their own.
+	body = doc("Q1", "user") + "\n" + doc("Bad", "system") + "\n" + doc("Q2", "user") + "\n" + doc("Q3", "user")
+	w, resp = post("/quota/import", "application/x-ndjson", body)
+	if w.Code != http.StatusOK || resp.Imported != 2 || resp.Failed != 2 || quota.left != 0 || quota.refunded != 1 {
+		t.Fatalf("quota -> %d %s (left %d, refunded %d)", w.Code, w.Body.String(), quota.left, quota.refunded)
+	}
+	if res := resp.Results[3]; res.SourceID != "src-Q3" || res.ChatID != "" || res.Messages != 0 || res.Error == nil ||
+		res.Error.Code != ErrCodeQuotaExceeded {
+		t.Fatalf("over quota = %+v", res)
+	}
+
+	for _, tc := range []struct {
+		contentType, body string
+		want              int
+	}{
+		{"application/json", "", http.StatusBadRequest},
+		{"application/json", "{", http.StatusBadRequest},
+		{"application/x-ndjson", "\n \n", http.StatusBadRequest},
+		{"text/csv", "a,b", http.StatusUnsupportedMediaType},
+	} {
+		if w, _ := post("/chats/import", tc.contentType, tc.body); w.Code != tc.want {
+			t.Fatalf("%s %q -> %d, want %d", tc.contentType, tc.body, w.Code, tc.want)
+		}
+	}
+}
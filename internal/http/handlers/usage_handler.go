@@ -0,0 +1,229 @@
+// Usage and quota HTTP handlers.
+//
+// This file exposes the persistent usage quotas enforced on chat creation and
+// posted messages (see middleware.Quota):
+//   - GET    /me/usage                  (the caller's usage, limits and reset times)
+//   - GET    /users/{user_id}/quota     (a user's quota override; admins only)
+//   - PUT    /users/{user_id}/quota     (replace a user's override; admins only)
+//   - DELETE /users/{user_id}/quota     (restore the configured limits; admins only)
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/services"
+)
+
+// UsageService defines usage reporting and quota override operations.
+type UsageService interface {
+	// Usage returns the caller's usage per scope, metric and period.
+	Usage(ctx context.Context, caller services.Caller) ([]services.Usage, error)
+	// TimeZone names the time zone whose calendar periods follow.
+	TimeZone() string
+	// Override returns a user's override and effective limits (admins only).
+	Override(ctx context.Context, caller services.Caller, userID string) (*domain.QuotaOverride, domain.QuotaLimits, error)
+	// SetOverride replaces a user's override (admins only).
+	SetOverride(ctx context.Context, caller services.Caller, o domain.QuotaOverride) (*domain.QuotaOverride, domain.QuotaLimits, error)
+	// DeleteOverride removes a user's override (admins only).
+	DeleteOverride(ctx context.Context, caller services.Caller, userID string) error
+}
+
+// UsageHandlers groups usage and quota endpoints.
+type UsageHandlers struct {
+	svc UsageService
+}
+
+// NewUsage constructs UsageHandlers bound to the given service.
+func NewUsage(svc UsageService) *UsageHandlers {
+	return &UsageHandlers{svc: svc}
+}
+
+// UsageEntry is the usage of one metric in one period.
+type UsageEntry struct {
+	// Scope is "user" (the caller across workspaces) or "workspace" (all members of the current workspace).
+	Scope string `json:"scope" example:"user"`
+	// Metric is "messages" or "chats".
+	Metric string `json:"metric" example:"messages"`
+	// Period is "day" or "month".
+	Period string `json:"period" example:"day"`
+	Used   int64  `json:"used" example:"12"`
+	// Limit is 0 when unlimited.
+	Limit int64 `json:"limit" example:"100"`
+	// Remaining is omitted when unlimited.
+	Remaining *int64    `json:"remaining,omitempty" example:"88"`
+	ResetsAt  time.Time `json:"resets_at" example:"2026-10-17T00:00:00Z"`
+}
+
+// UsageResponse lists the caller's usage.
+type UsageResponse struct {
+	// Timezone is the IANA zone whose midnight resets daily quotas.
+	Timezone string       `json:"timezone" example:"UTC"`
+	Usage    []UsageEntry `json:"usage"`
+}
+
+// QuotaOverrideRequest is the JSON payload replacing a user's quota
+// override. Omitted fields use the configured default; 0 lifts the limit.
+type QuotaOverrideRequest struct {
+	MessagesPerDay   *int64 `json:"messages_per_day,omitempty" example:"500"`
+	MessagesPerMonth *int64 `json:"messages_per_month,omitempty" example:"10000"`
+	ChatsPerDay      *int64 `json:"chats_per_day,omitempty" example:"50"`
+	ChatsPerMonth    *int64 `json:"chats_per_month,omitempty" example:"0"`
+}
+
+// QuotaOverrideResponse describes a user's override and the limits in effect.
+type QuotaOverrideResponse struct {
+	UserID    string               `json:"user_id" example:"user456"`
+	Override  QuotaOverrideRequest `json:"override"`
+	Effective domain.QuotaLimits   `json:"effective"`
+}
+
+func quotaOverrideResponse(o domain.QuotaOverride, eff domain.QuotaLimits) QuotaOverrideResponse {
+	return QuotaOverrideResponse{
+		UserID: o.UserID,
+		Override: QuotaOverrideRequest{
+			MessagesPerDay: o.MessagesPerDay, MessagesPerMonth: o.MessagesPerMonth,
+			ChatsPerDay: o.ChatsPerDay, ChatsPerMonth: o.ChatsPerMonth,
+		},
+		Effective: eff,
+	}
+}
+
+// failQuota maps a QuotaService error to the error response.
+func failQuota(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrQuotaForbidden):
+		fail(c, http.StatusForbidden, ErrCodeForbidden, err.Error())
+	case errors.Is(err, services.ErrInvalidQuota):
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+	default:
+		fail(c, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+	}
+}
+
+// GetUsage godoc
+// @ID          getUsage
+// @Summary     Get my usage
+// @Description Returns the current user's usage of each quota: per user (across workspaces) and, in a non-default workspace, for the whole workspace. Daily and monthly periods follow the calendar of QUOTA_TIMEZONE.
+// @Tags        Usage
+// @Produce     json
+// @Security    BearerAuth
+// @Security    APIKeyAuth
+//
+// @Param       X-User-ID       header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       X-Workspace-ID  header  string  false "Workspace ID (default workspace when omitted)"
+//
+// @Success     200  {object} handlers.UsageResponse
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid credentials"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /me/usage [get]
+func (h *UsageHandlers) GetUsage(c *gin.Context) {
+	usage, err := h.svc.Usage(c.Request.Context(), caller(c))
+	if err != nil {
+		fail(c, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+		return
+	}
+	resp := UsageResponse{Timezone: h.svc.TimeZone(), Usage: make([]UsageEntry, 0, len(usage))}
+	for _, u := range usage {
+		e := UsageEntry{Scope: u.Scope, Metric: u.Metric, Period: u.Period, Used: u.Used, Limit: u.Limit, ResetsAt: u.ResetAt}
+		if u.Limit > 0 {
+			left := max(u.Limit-u.Used, 0)
+			e.Remaining = &left
+		}
+		resp.Usage = append(resp.Usage, e)
+	}
+	ok(c, http.StatusOK, resp)
+}
+
+// GetQuota godoc
+// @ID          getQuota
+// @Summary     Get a user's quota override
+// @Description Returns the quota override of user_id (empty when none) and the per-user limits in effect for them. Admins only.
+// @Tags        Usage
+// @Produce     json
+// @Security    BearerAuth
+// @Security    APIKeyAuth
+//
+// @Param       user_id  path  string  true  "User ID"  example(user456)
+//
+// @Success     200  {object} handlers.QuotaOverrideResponse
+// @Failure     400  {object} handlers.ErrorResponse "Bad request"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid credentials"
+// @Failure     403  {object} handlers.ErrorResponse "Caller is not an admin"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /users/{user_id}/quota [get]
+func (h *UsageHandlers) GetQuota(c *gin.Context) {
+	o, eff, err := h.svc.Override(c.Request.Context(), caller(c), c.Param("user_id"))
+	if err != nil {
+		failQuota(c, err)
+		return
+	}
+	ok(c, http.StatusOK, quotaOverrideResponse(*o, eff))
+}
+
+// SetQuota godoc
+// @ID          setQuota
+// @Summary     Set a user's quota override
+// @Description Replaces the quota override of user_id. Omitted limits use the configured default, 0 lifts a limit. Admins only.
+// @Tags        Usage
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Security    APIKeyAuth
+//
+// @Param       user_id  path  string                         true  "User ID"  example(user456)
+// @Param       body     body  handlers.QuotaOverrideRequest  true  "Limits"
+//
+// @Success     200  {object} handlers.QuotaOverrideResponse
+// @Failure     400  {object} handlers.ErrorResponse "Bad request (negative limit)"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid credentials"
+// @Failure     403  {object} handlers.ErrorResponse "Caller is not an admin"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /users/{user_id}/quota [put]
+func (h *UsageHandlers) SetQuota(c *gin.Context) {
+	var req QuotaOverrideRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "invalid JSON body: integer limits are expected")
+		return
+	}
+	o, eff, err := h.svc.SetOverride(c.Request.Context(), caller(c), domain.QuotaOverride{
+		UserID:         c.Param("user_id"),
+		MessagesPerDay: req.MessagesPerDay, MessagesPerMonth: req.MessagesPerMonth,
+		ChatsPerDay: req.ChatsPerDay, ChatsPerMonth: req.ChatsPerMonth,
+	})
+	if err != nil {
+		failQuota(c, err)
+		return
+	}
+	ok(c, http.StatusOK, quotaOverrideResponse(*o, eff))
+}
+
+// DeleteQuota godoc
+// @ID          deleteQuota
+// @Summary     Remove a user's quota override
+// @Description Restores the configured per-user limits for user_id. Removing a missing override is a no-op. Admins only.
+// @Tags        Usage
+// @Produce     json
+// @Security    BearerAuth
+// @Security    APIKeyAuth
+//
+// @Param       user_id  path  string  true  "User ID"  example(user456)
+//
+// @Success     204  {string} string "No Content"
+// @Failure     400  {object} handlers.ErrorResponse "Bad request"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid credentials"
+// @Failure     403  {object} handlers.ErrorResponse "Caller is not an admin"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /users/{user_id}/quota [delete]
+func (h *UsageHandlers) DeleteQuota(c *gin.Context) {
+	if err := h.svc.DeleteOverride(c.Request.Context(), caller(c), c.Param("user_id")); err != nil {
+		failQuota(c, err)
+		return
+	}
+	noContent(c)
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/services"
+)
+
+type stubUsageSvc struct {
+	err      error
+	gotOver  domain.QuotaOverride
+	gotUser  string
+	resetsAt time.Time
+}
+
+func (s *stubUsageSvc) Usage(_ context.Context, _ services.Caller) ([]services.Usage, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return []services.Usage{
+		{Scope: domain.QuotaScopeUser, Metric: domain.UsageMessages, Period: domain.PeriodDay, Used: 12, Limit: 10, ResetAt: s.resetsAt},
+		{Scope: domain.QuotaScopeUser, Metric: domain.UsageChats, Period: domain.PeriodMonth, Used: 3, ResetAt: s.resetsAt},
+	}, nil
+}
+
+func (s *stubUsageSvc) TimeZone() string { return "Europe/Athens" }
+
+func (s *stubUsageSvc) Override(_ context.Context, _ services.Caller, userID string) (*domain.QuotaOverride, domain.QuotaLimits, error) {
+	s.gotUser = userID
+	if s.err != nil {
+		return nil, domain.QuotaLimits{}, s.err
+	}
+	return &domain.QuotaOverride{UserID: userID}, domain.QuotaLimits{MessagesPerDay: 100}, nil
+}
+
+func (s *stubUsageSvc) SetOverride(_ context.Context, _ services.Caller, o domain.QuotaOverride) (*domain.QuotaOverride, domain.QuotaLimits, error) {
+	s.gotOver = o
+	if s.err != nil {
+		return nil, domain.QuotaLimits{}, s.err
+	}
+	return &o, o.Apply(domain.QuotaLimits{MessagesPerDay: 100}), nil
+}
+
+func (s *stubUsageSvc) DeleteOverride(_ context.Context, _ services.Caller, userID string) error {
+	s.gotUser = userID
+	return s.err
+}
+
+func newUsageRouter(svc UsageService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	h := NewUsage(svc)
+	r.GET("/me/usage", h.GetUsage)
+	r.GET("/users/:user_id/quota", h.GetQuota)
+	r.PUT("/users/:user_id/quota", h.SetQuota)
+	r.DELETE("/users/:user_id/quota", h.DeleteQuota)
+	return r
+}
+
+func TestUsageHandlers_Status(t *testing.T) {
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		err    error
+		want   int
+	}{
+		{"usage", http.MethodGet, "/me/usage", "", nil, http.StatusOK},
+		{"usage failure", http.MethodGet, "/me/usage", "", errors.New("db"), http.StatusInternalServerError},
+		{"get quota", http.MethodGet, "/users/u2/quota", "", nil, http.StatusOK},
+		{"get quota as user", http.MethodGet, "/users/u2/quota", "", services.ErrQuotaForbidden, http.StatusForbidden},
+		{"set quota", http.MethodPut, "/users/u2/quota", `{"messages_per_day":5}`, nil, http.StatusOK},
+		{"set quota bad json", http.MethodPut, "/users/u2/quota", `{"messages_per_day":"x"}`, nil, http.StatusBadRequest},
+		{"set negative quota", http.MethodPut, "/users/u2/quota", `{"chats_per_day":-1}`, services.ErrInvalidQuota, http.StatusBadRequest},
+		{"delete quota", http.MethodDelete, "/users/u2/quota", "", nil, http.StatusNoContent},
+		{"delete quota failure", http.MethodDelete, "/users/u2/quota", "", errors.New("db"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			newUsageRouter(&stubUsageSvc{err: tc.err}).ServeHTTP(w, req)
+			if w.Code != tc.want {
+				t.Fatalf("status = %d; want %d (body=%s)", w.Code, tc.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestUsageHandlers_Bodies(t *testing.T) {
+	reset := time.Date(2026, 10, 16, 21, 0, 0, 0, time.UTC)
+	svc := &stubUsageSvc{resetsAt: reset}
+	r := newUsageRouter(svc)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/me/usage", nil))
+	var usage UsageResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &usage); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if usage.Timezone != "Europe/Athens" || len(usage.Usage) != 2 || !usage.Usage[0].ResetsAt.Equal(reset) {
+		t.Fatalf("usage = %+v", usage)
+	}
+	// Remaining never goes negative and is omitted when unlimited.
+	if rem := usage.Usage[0].Remaining; rem == nil || *rem != 0 {
+		t.Fatalf("remaining = %v", rem)
+	}
+	if usage.Usage[1].Remaining != nil || strings.Count(w.Body.String(), `"remaining"`) != 1 {
+		t.Fatalf("unlimited entry has remaining: %s", w.Body.String())
+	}
+
+	// Omitted limits reach the service as nil; zero is kept.
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/users/u2/quota", strings.NewReader(`{"chats_per_month":0}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	o := svc.gotOver
+	if w.Code != http.StatusOK || o.UserID != "u2" || o.MessagesPerDay != nil || o.ChatsPerMonth == nil || *o.ChatsPerMonth != 0 {
+		t.Fatalf("set: status=%d override=%+v", w.Code, o)
+	}
+	var resp QuotaOverrideResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.UserID != "u2" || resp.Effective.MessagesPerDay != 100 || resp.Override.ChatsPerMonth == nil {
+		t.Fatalf("set response = %+v", resp)
+	}
+}
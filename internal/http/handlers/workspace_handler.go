@@ -0,0 +1,367 @@
+// Workspace HTTP handlers.
+//
+// This file exposes workspaces, the tenants that isolate chats, feedback and
+// idempotency records (and optionally the corpus) of one team from others:
+//   - POST   /workspaces                          (create; the caller becomes owner)
+//   - GET    /workspaces                          (list the caller's workspaces)
+//   - GET    /workspaces/{id}                     (show one)
+//   - PATCH  /workspaces/{id}                     (rename, change corpus)
+//   - GET    /workspaces/{id}/members             (list members)
+//   - PUT    /workspaces/{id}/members/{user_id}   (add a member or change their role)
+//   - DELETE /workspaces/{id}/members/{user_id}   (remove a member, or leave)
+//
+// Other endpoints act in the workspace named by the X-Workspace-ID header
+// (see middleware.Workspace), or in the default workspace without it.
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/services"
+)
+
+// WorkspaceService defines workspace management operations.
+type WorkspaceService interface {
+	// Create creates a workspace owned by the caller.
+	Create(ctx context.Context, caller services.Caller, name, corpusPath string) (*domain.Workspace, error)
+	// List returns the caller's workspaces, the default workspace first.
+	List(ctx context.Context, caller services.Caller) ([]services.Membership, error)
+	// Get returns a workspace the caller belongs to.
+	Get(ctx context.Context, caller services.Caller, id string) (*services.Membership, error)
+	// Update renames a workspace and/or changes its corpus; nil fields are kept.
+	Update(ctx context.Context, caller services.Caller, id string, name, corpusPath *string) (*domain.Workspace, error)
+	// Members lists the members of a workspace the caller belongs to.
+	Members(ctx context.Context, caller services.Caller, id string) ([]domain.WorkspaceMember, error)
+	// SetMember adds a member or changes their role (owners only).
+	SetMember(ctx context.Context, caller services.Caller, id, userID, role string) error
+	// RemoveMember removes a member (owners), or the caller themselves.
+	RemoveMember(ctx context.Context, caller services.Caller, id, userID string) error
+}
+
+// WorkspaceHandlers groups workspace endpoints.
+type WorkspaceHandlers struct {
+	svc WorkspaceService
+}
+
+// NewWorkspaces constructs WorkspaceHandlers bound to the given service.
+func NewWorkspaces(svc WorkspaceService) *WorkspaceHandlers {
+	return &WorkspaceHandlers{svc: svc}
+}
+
+// CreateWorkspaceRequest is the JSON payload for creating a workspace.
+type CreateWorkspaceRequest struct {
+	// Name is the display name (1–100 characters).
+	Name string `json:"name" binding:"required" example:"Research team"`
+	// CorpusPath optionally names the workspace corpus, relative to CORPUS_DIR (admins only).
+	CorpusPath string `json:"corpus_path,omitempty" example:"research.md"`
+}
+
+// UpdateWorkspaceRequest is the JSON payload for updating a workspace.
+// Omitted fields are left unchanged.
+type UpdateWorkspaceRequest struct {
+	Name *string `json:"name,omitempty" example:"Research"`
+	// CorpusPath changes the workspace corpus (admins only); "" reverts to the default corpus.
+	CorpusPath *string `json:"corpus_path,omitempty" example:"research.md"`
+}
+
+// SetWorkspaceMemberRequest is the JSON payload for adding a member.
+type SetWorkspaceMemberRequest struct {
+	// Role is "owner" or "member".
+	Role string `json:"role" binding:"required" example:"member"`
+}
+
+// WorkspaceResponse describes a workspace and the caller's role in it.
+type WorkspaceResponse struct {
+	ID         string `json:"id" example:"9d7c1f0e-2b4a-4c8e-9f61-3a5b7c9d1e2f"`
+	Name       string `json:"name" example:"Research team"`
+	CorpusPath string `json:"corpus_path,omitempty" example:"research.md"`
+	Role       string `json:"role" example:"owner"`
+}
+
+// ListWorkspacesResponse lists the caller's workspaces.
+type ListWorkspacesResponse struct {
+	Workspaces []WorkspaceResponse `json:"workspaces"`
+}
+
+// ListWorkspaceMembersResponse lists the members of a workspace.
+type ListWorkspaceMembersResponse struct {
+	Members []domain.WorkspaceMember `json:"members"`
+}
+
+func workspaceResponse(w domain.Workspace, role string) WorkspaceResponse {
+	return WorkspaceResponse{ID: w.ID, Name: w.Name, CorpusPath: w.CorpusPath, Role: role}
+}
+
+// workspaceParam returns the :id path parameter, or fails with 400 unless it
+// is a UUID or the default workspace.
+func workspaceParam(c *gin.Context) (string, bool) {
+	id := c.Param("id")
+	if id == domain.DefaultWorkspaceID {
+		return id, true
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "workspace id must be a UUID or \"default\"")
+		return "", false
+	}
+	return id, true
+}
+
+// failWorkspace maps a WorkspaceService error to the error response.
+func failWorkspace(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrWorkspaceNotFound):
+		fail(c, http.StatusNotFound, ErrCodeNotFound, "workspace not found")
+	case errors.Is(err, services.ErrWorkspaceForbidden), errors.Is(err, services.ErrCorpusNotAllowed):
+		fail(c, http.StatusForbidden, ErrCodeForbidden, err.Error())
+	case errors.Is(err, services.ErrInvalidWorkspace), errors.Is(err, services.ErrInvalidMember), errors.Is(err, services.ErrInvalidCorpus):
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+	case errors.Is(err, services.ErrLastOwner):
+		fail(c, http.StatusConflict, ErrCodeConflict, err.Error())
+	default:
+		fail(c, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+	}
+}
+
+// CreateWorkspace godoc
+// @ID          createWorkspace
+// @Summary     Create a workspace
+// @Description Creates a workspace owned by the current user. Only admins may set corpus_path, which must name a loadable corpus under CORPUS_DIR.
+// @Tags        Workspaces
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Security    APIKeyAuth
+//
+// @Param       X-User-ID  header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       body       body    handlers.CreateWorkspaceRequest  true  "Workspace payload"
+//
+// @Success     201  {object}  handlers.WorkspaceResponse
+// @Failure     400  {object}  handlers.ErrorResponse  "Bad request (name, unknown corpus)"
+// @Failure     401  {object}  handlers.ErrorResponse  "Missing or invalid credentials"
+// @Failure     403  {object}  handlers.ErrorResponse  "Corpus set by a non-admin"
+// @Failure     500  {object}  handlers.ErrorResponse  "Internal error"
+// @Router      /workspaces [post]
+func (h *WorkspaceHandlers) CreateWorkspace(c *gin.Context) {
+	var req CreateWorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "invalid JSON body: name is required")
+		return
+	}
+
+	w, err := h.svc.Create(c.Request.Context(), caller(c), req.Name, req.CorpusPath)
+	if err != nil {
+		failWorkspace(c, err)
+		return
+	}
+	ok(c, http.StatusCreated, workspaceResponse(*w, domain.WorkspaceRoleOwner))
+}
+
+// ListWorkspaces godoc
+// @ID          listWorkspaces
+// @Summary     List workspaces
+// @Description Returns the workspaces the current user belongs to, with their role in each. The default workspace is always listed first.
+// @Tags        Workspaces
+// @Produce     json
+// @Security    BearerAuth
+// @Security    APIKeyAuth
+//
+// @Param       X-User-ID  header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+//
+// @Success     200  {object} handlers.ListWorkspacesResponse
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid credentials"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /workspaces [get]
+func (h *WorkspaceHandlers) ListWorkspaces(c *gin.Context) {
+	ms, err := h.svc.List(c.Request.Context(), caller(c))
+	if err != nil {
+		fail(c, http.StatusInternalServerError, ErrCodeListFailed, err.Error())
+		return
+	}
+	resp := ListWorkspacesResponse{Workspaces: make([]WorkspaceResponse, 0, len(ms))}
+	for _, m := range ms {
+		resp.Workspaces = append(resp.Workspaces, workspaceResponse(m.Workspace, m.Role))
+	}
+	ok(c, http.StatusOK, resp)
+}
+
+// GetWorkspace godoc
+// @ID          getWorkspace
+// @Summary     Get a workspace
+// @Description Returns a workspace the current user belongs to, with their role in it.
+// @Tags        Workspaces
+// @Produce     json
+// @Security    BearerAuth
+// @Security    APIKeyAuth
+//
+// @Param       X-User-ID  header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       id         path    string  true  "Workspace ID (UUID or \"default\")"  example(9d7c1f0e-2b4a-4c8e-9f61-3a5b7c9d1e2f)
+//
+// @Success     200  {object} handlers.WorkspaceResponse
+// @Failure     400  {object} handlers.ErrorResponse "Bad request"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid credentials"
+// @Failure     404  {object} handlers.ErrorResponse "Workspace not found"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /workspaces/{id} [get]
+func (h *WorkspaceHandlers) GetWorkspace(c *gin.Context) {
+	id, valid := workspaceParam(c)
+	if !valid {
+		return
+	}
+	m, err := h.svc.Get(c.Request.Context(), caller(c), id)
+	if err != nil {
+		failWorkspace(c, err)
+		return
+	}
+	ok(c, http.StatusOK, workspaceResponse(m.Workspace, m.Role))
+}
+
+// UpdateWorkspace godoc
+// @ID          updateWorkspace
+// @Summary     Update a workspace
+// @Description Renames a workspace and/or changes its corpus. Requires the owner role; changing the corpus also requires an admin. The default workspace cannot be changed.
+// @Tags        Workspaces
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Security    APIKeyAuth
+//
+// @Param       X-User-ID  header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       id         path    string  true  "Workspace ID (UUID)"  format(uuid) example(9d7c1f0e-2b4a-4c8e-9f61-3a5b7c9d1e2f)
+// @Param       body       body    handlers.UpdateWorkspaceRequest  true  "Fields to change"
+//
+// @Success     200  {object} handlers.WorkspaceResponse
+// @Failure     400  {object} handlers.ErrorResponse "Bad request (name, unknown corpus, default workspace)"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid credentials"
+// @Failure     403  {object} handlers.ErrorResponse "Caller is not an owner, or not an admin for corpus changes"
+// @Failure     404  {object} handlers.ErrorResponse "Workspace not found"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /workspaces/{id} [patch]
+func (h *WorkspaceHandlers) UpdateWorkspace(c *gin.Context) {
+	id, valid := workspaceParam(c)
+	if !valid {
+		return
+	}
+	var req UpdateWorkspaceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "invalid JSON body: name and/or corpus_path are expected")
+		return
+	}
+
+	w, err := h.svc.Update(c.Request.Context(), caller(c), id, req.Name, req.CorpusPath)
+	if err != nil {
+		failWorkspace(c, err)
+		return
+	}
+	ok(c, http.StatusOK, workspaceResponse(*w, domain.WorkspaceRoleOwner))
+}
+
+// ListWorkspaceMembers godoc
+// @ID          listWorkspaceMembers
+// @Summary     List workspace members
+// @Description Returns the members of a workspace the current user belongs to, oldest first. The default workspace has no member list.
+// @Tags        Workspaces
+// @Produce     json
+// @Security    BearerAuth
+// @Security    APIKeyAuth
+//
+// @Param       X-User-ID  header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       id         path    string  true  "Workspace ID (UUID)"  format(uuid) example(9d7c1f0e-2b4a-4c8e-9f61-3a5b7c9d1e2f)
+//
+// @Success     200  {object} handlers.ListWorkspaceMembersResponse
+// @Failure     400  {object} handlers.ErrorResponse "Bad request"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid credentials"
+// @Failure     404  {object} handlers.ErrorResponse "Workspace not found"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /workspaces/{id}/members [get]
+func (h *WorkspaceHandlers) ListWorkspaceMembers(c *gin.Context) {
+	id, valid := workspaceParam(c)
+	if !valid {
+		return
+	}
+	members, err := h.svc.Members(c.Request.Context(), caller(c), id)
+	if err != nil {
+		failWorkspace(c, err)
+		return
+	}
+	ok(c, http.StatusOK, ListWorkspaceMembersResponse{Members: members})
+}
+
+// SetWorkspaceMember godoc
+// @ID          setWorkspaceMember
+// @Summary     Add a workspace member
+// @Description Adds user_id to the workspace with the given role, or changes their role. Requires the owner role; a workspace always keeps one owner.
+// @Tags        Workspaces
+// @Accept      json
+// @Produce     json
+// @Security    BearerAuth
+// @Security    APIKeyAuth
+//
+// @Param       X-User-ID  header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       id         path    string  true  "Workspace ID (UUID)"  format(uuid) example(9d7c1f0e-2b4a-4c8e-9f61-3a5b7c9d1e2f)
+// @Param       user_id    path    string  true  "Member user ID"       example(user456)
+// @Param       body       body    handlers.SetWorkspaceMemberRequest  true  "Role"
+//
+// @Success     204  {string} string "No Content"
+// @Failure     400  {object} handlers.ErrorResponse "Bad request (unknown role, default workspace)"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid credentials"
+// @Failure     403  {object} handlers.ErrorResponse "Caller is not an owner"
+// @Failure     404  {object} handlers.ErrorResponse "Workspace not found"
+// @Failure     409  {object} handlers.ErrorResponse "Would demote the last owner"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /workspaces/{id}/members/{user_id} [put]
+func (h *WorkspaceHandlers) SetWorkspaceMember(c *gin.Context) {
+	id, valid := workspaceParam(c)
+	if !valid {
+		return
+	}
+	var req SetWorkspaceMemberRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		fail(c, http.StatusBadRequest, ErrCodeBadRequest, "invalid JSON body: role is required")
+		return
+	}
+
+	if err := h.svc.SetMember(c.Request.Context(), caller(c), id, c.Param("user_id"), req.Role); err != nil {
+		failWorkspace(c, err)
+		return
+	}
+	noContent(c)
+}
+
+// RemoveWorkspaceMember godoc
+// @ID          removeWorkspaceMember
+// @Summary     Remove a workspace member
+// @Description Removes user_id from the workspace. Owners may remove anyone; members may remove themselves to leave. Removing a non-member is a no-op.
+// @Tags        Workspaces
+// @Produce     json
+// @Security    BearerAuth
+// @Security    APIKeyAuth
+//
+// @Param       X-User-ID  header  string  false "User ID (AUTH_MODE=header only)"  example(user123)
+// @Param       id         path    string  true  "Workspace ID (UUID)"  format(uuid) example(9d7c1f0e-2b4a-4c8e-9f61-3a5b7c9d1e2f)
+// @Param       user_id    path    string  true  "Member user ID"       example(user456)
+//
+// @Success     204  {string} string "No Content"
+// @Failure     400  {object} handlers.ErrorResponse "Bad request"
+// @Failure     401  {object} handlers.ErrorResponse "Missing or invalid credentials"
+// @Failure     403  {object} handlers.ErrorResponse "Caller is not an owner"
+// @Failure     404  {object} handlers.ErrorResponse "Workspace not found"
+// @Failure     409  {object} handlers.ErrorResponse "Would remove the last owner"
+// @Failure     500  {object} handlers.ErrorResponse "Internal error"
+// @Router      /workspaces/{id}/members/{user_id} [delete]
+func (h *WorkspaceHandlers) RemoveWorkspaceMember(c *gin.Context) {
+	id, valid := workspaceParam(c)
+	if !valid {
+		return
+	}
+	if err := h.svc.RemoveMember(c.Request.Context(), caller(c), id, c.Param("user_id")); err != nil {
+		failWorkspace(c, err)
+		return
+	}
+	noContent(c)
+}
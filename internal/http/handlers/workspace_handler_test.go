@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/services"
+)
+
+const testWorkspaceID = "9d7c1f0e-2b4a-4c8e-9f61-3a5b7c9d1e2f"
+
+type stubWorkspaceSvc struct {
+	err       error
+	gotCaller services.Caller
+	gotName   *string
+	gotCorpus *string
+	gotRole   string
+}
+
+func (s *stubWorkspaceSvc) Create(_ context.Context, who services.Caller, name, corpus string) (*domain.Workspace, error) {
+	s.gotCaller = who
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &domain.Workspace{ID: testWorkspaceID, Name: name, CorpusPath: corpus}, nil
+}
+
+func (s *stubWorkspaceSvc) List(_ context.Context, who services.Caller) ([]services.Membership, error) {
+	s.gotCaller = who
+	return []services.Membership{
+		{Workspace: domain.Workspace{ID: domain.DefaultWorkspaceID, Name: "Default"}, Role: domain.WorkspaceRoleMember},
+		{Workspace: domain.Workspace{ID: testWorkspaceID, Name: "Team"}, Role: domain.WorkspaceRoleOwner},
+	}, s.err
+}
+
+func (s *stubWorkspaceSvc) Get(_ context.Context, _ services.Caller, id string) (*services.Membership, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &services.Membership{Workspace: domain.Workspace{ID: id, Name: "Team"}, Role: domain.WorkspaceRoleMember}, nil
+}
+
+func (s *stubWorkspaceSvc) Update(_ context.Context, _ services.Caller, id string, name, corpus *string) (*domain.Workspace, error) {
+	s.gotName, s.gotCorpus = name, corpus
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &domain.Workspace{ID: id, Name: "Team"}, nil
+}
+
+func (s *stubWorkspaceSvc) Members(_ context.Context, _ services.Caller, _ string) ([]domain.WorkspaceMember, error) {
+	return []domain.WorkspaceMember{{UserID: "u1", Role: domain.WorkspaceRoleOwner}}, s.err
+}
+
+func (s *stubWorkspaceSvc) SetMember(_ context.Context, _ services.Caller, _, _, role string) error {
+	s.gotRole = role
+	return s.err
+}
+
+func (s *stubWorkspaceSvc) RemoveMember(_ context.Context, _ services.Caller, _, _ string) error {
+	return s.err
+}
+
+func newWorkspaceRouter(svc WorkspaceService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	h := NewWorkspaces(svc)
+	r.POST("/workspaces", h.CreateWorkspace)
+	r.GET("/workspaces", h.ListWorkspaces)
+	r.GET("/workspaces/:id", h.GetWorkspace)
+	r.PATCH("/workspaces/:id", h.UpdateWorkspace)
+	r.GET("/workspaces/:id/members", h.ListWorkspaceMembers)
+	r.PUT("/workspaces/:id/members/:user_id", h.SetWorkspaceMember)
+	r.DELETE("/workspaces/:id/members/:user_id", h.RemoveWorkspaceMember)
+	return r
+}
+
+func TestWorkspaceHandlers_Status(t *testing.T) {
+	ws := "/workspaces/" + testWorkspaceID
+	cases := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		err    error
+		want   int
+	}{
+		{"create", http.MethodPost, "/workspaces", `{"name":"Team"}`, nil, http.StatusCreated},
+		{"create without name", http.MethodPost, "/workspaces", `{}`, nil, http.StatusBadRequest},
+		{"create bad name", http.MethodPost, "/workspaces", `{"name":" "}`, services.ErrInvalidWorkspace, http.StatusBadRequest},
+		{"create corpus by user", http.MethodPost, "/workspaces", `{"name":"T","corpus_path":"x.md"}`, services.ErrCorpusNotAllowed, http.StatusForbidden},
+		{"list", http.MethodGet, "/workspaces", "", nil, http.StatusOK},
+		{"get", http.MethodGet, ws, "", nil, http.StatusOK},
+		{"get default", http.MethodGet, "/workspaces/default", "", nil, http.StatusOK},
+		{"get bad id", http.MethodGet, "/workspaces/nope", "", nil, http.StatusBadRequest},
+		{"get stranger", http.MethodGet, ws, "", services.ErrWorkspaceNotFound, http.StatusNotFound},
+		{"update", http.MethodPatch, ws, `{"name":"T2"}`, nil, http.StatusOK},
+		{"update by member", http.MethodPatch, ws, `{"name":"T2"}`, services.ErrWorkspaceForbidden, http.StatusForbidden},
+		{"update bad corpus", http.MethodPatch, ws, `{"corpus_path":"../x"}`, services.ErrInvalidCorpus, http.StatusBadRequest},
+		{"members", http.MethodGet, ws + "/members", "", nil, http.StatusOK},
+		{"set member", http.MethodPut, ws + "/members/u2", `{"role":"member"}`, nil, http.StatusNoContent},
+		{"set member without role", http.MethodPut, ws + "/members/u2", `{}`, nil, http.StatusBadRequest},
+		{"demote last owner", http.MethodPut, ws + "/members/u1", `{"role":"member"}`, services.ErrLastOwner, http.StatusConflict},
+		{"remove member", http.MethodDelete, ws + "/members/u2", "", nil, http.StatusNoContent},
+		{"remove failure", http.MethodDelete, ws + "/members/u2", "", errors.New("db"), http.StatusInternalServerError},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			newWorkspaceRouter(&stubWorkspaceSvc{err: tc.err}).ServeHTTP(w, req)
+			if w.Code != tc.want {
+				t.Fatalf("status = %d; want %d (body=%s)", w.Code, tc.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestWorkspaceHandlers_Bodies(t *testing.T) {
+	svc := &stubWorkspaceSvc{}
+	r := newWorkspaceRouter(svc)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/workspaces", nil)
+	req.Header.Set("X-User-ID", "u1")
+	r.ServeHTTP(w, req)
+	var list ListWorkspacesResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(list.Workspaces) != 2 || list.Workspaces[1].ID != testWorkspaceID || list.Workspaces[1].Role != domain.WorkspaceRoleOwner {
+		t.Fatalf("list = %+v", list)
+	}
+	if svc.gotCaller.UserID != "u1" {
+		t.Fatalf("caller = %+v", svc.gotCaller)
+	}
+
+	// Omitted fields reach the service as nil; present ones (even "") do not.
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPatch, "/workspaces/"+testWorkspaceID, strings.NewReader(`{"corpus_path":""}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || svc.gotName != nil || svc.gotCorpus == nil || *svc.gotCorpus != "" {
+		t.Fatalf("update: status=%d name=%v corpus=%v", w.Code, svc.gotName, svc.gotCorpus)
+	}
+
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodPut, "/workspaces/"+testWorkspaceID+"/members/u2", strings.NewReader(`{"role":"owner"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent || svc.gotRole != domain.WorkspaceRoleOwner {
+		t.Fatalf("set member: status=%d role=%q", w.Code, svc.gotRole)
+	}
+}
@@ -0,0 +1,56 @@
+// Package middleware contains shared Gin middleware used by the HTTP layer.
+//
+// This file provides RequireBearerToken, a minimal guard for operational
+// endpoints (e.g., /admin/*) that are authenticated with a single shared
+// secret rather than per-user identities.
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireBearerToken returns a Gin middleware that only admits requests whose
+// Authorization header is "Bearer <token>". The comparison is constant-time.
+//
+// An empty token rejects every request, so a missing secret can never leave
+// the guarded routes open. Rejections use the standard error envelope:
+//
+//	HTTP/1.1 401 Unauthorized
+//	WWW-Authenticate: Bearer
+//	{
+//	  "request_id": "<uuid>",
+//	  "code":       "unauthorized",
+//	  "message":    "invalid or missing bearer token"
+//	}
+func RequireBearerToken(token string) gin.HandlerFunc {
+	want := []byte(token)
+	return func(c *gin.Context) {
+		got, ok := bearerToken(c.GetHeader("Authorization"))
+		if !ok || len(want) == 0 || subtle.ConstantTimeCompare([]byte(got), want) != 1 {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+				"request_id": c.Writer.Header().Get("X-Request-ID"),
+				"code":       "unauthorized",
+				"message":    "invalid or missing bearer token",
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// bearerToken extracts the credentials from an "Authorization: Bearer <x>"
+// header value. The scheme is matched case-insensitively.
+func bearerToken(h string) (string, bool) {
+	const prefix = "bearer "
+	h = strings.TrimSpace(h)
+	if len(h) <= len(prefix) || !strings.EqualFold(h[:len(prefix)], prefix) {
+		return "", false
+	}
+	tok := strings.TrimSpace(h[len(prefix):])
+	return tok, tok != ""
+}
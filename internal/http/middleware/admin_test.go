@@ -0,0 +1,57 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequireBearerToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(token string) *gin.Engine {
+		r := gin.New()
+		r.Use(RequireBearerToken(token))
+		r.GET("/admin", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+		return r
+	}
+
+	cases := []struct {
+		name   string
+		token  string
+		header string
+		want   int
+	}{
+		{"valid", "s3cret", "Bearer s3cret", http.StatusOK},
+		{"scheme case-insensitive", "s3cret", "bearer   s3cret ", http.StatusOK},
+		{"wrong token", "s3cret", "Bearer nope", http.StatusUnauthorized},
+		{"missing header", "s3cret", "", http.StatusUnauthorized},
+		{"wrong scheme", "s3cret", "Basic s3cret", http.StatusUnauthorized},
+		{"empty credentials", "s3cret", "Bearer ", http.StatusUnauthorized},
+		{"empty configured token rejects all", "", "Bearer ", http.StatusUnauthorized},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			newRouter(tc.token).ServeHTTP(w, req)
+			if w.Code != tc.want {
+				t.Fatalf("status = %d; want %d (body=%s)", w.Code, tc.want, w.Body.String())
+			}
+			if tc.want == http.StatusUnauthorized {
+				if w.Header().Get("WWW-Authenticate") != "Bearer" {
+					t.Fatalf("missing WWW-Authenticate header")
+				}
+				if !strings.Contains(w.Body.String(), `"code":"unauthorized"`) {
+					t.Fatalf("unexpected body: %s", w.Body.String())
+				}
+			}
+		})
+	}
+}
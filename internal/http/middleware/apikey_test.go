@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tbourn/go-chat-backend/internal/auth"
+)
+
+// fakeKeys resolves "read-key" (chats:read), "root-key" (admin) and fails
+// everything else with err.
+type fakeKeys struct{ err error }
+
+func (f fakeKeys) VerifyAPIKey(_ context.Context, key string) (APIKeyPrincipal, error) {
+	switch key {
+	case "read-key":
+		return APIKeyPrincipal{KeyID: "k1", UserID: "svc-user", Scopes: []string{auth.ScopeChatsRead}}, nil
+	case "root-key":
+		return APIKeyPrincipal{KeyID: "k2", UserID: "ops", Scopes: []string{auth.ScopeAdmin}}, nil
+	}
+	return APIKeyPrincipal{}, f.err
+}
+
+func TestAPIKeyAuth_AndRequireScope(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(v APIKeyVerifier) *gin.Engine {
+		r := gin.New()
+		r.Use(APIKeyAuth(v, APIKeyOptions{}))
+		// Stand-in for the bearer middleware: only runs when no key matched.
+		r.Use(func(c *gin.Context) {
+			if !AuthenticatedByAPIKey(c) {
+				c.Set(ContextKeyUserID, "token-user")
+			}
+		})
+		handler := func(c *gin.Context) {
+			uid, _ := c.Get(ContextKeyUserID)
+			c.String(http.StatusOK, "%v admin=%v", uid, c.GetBool(ContextKeyAdmin))
+		}
+		r.GET("/chats", RequireScope(auth.ScopeChatsRead, nil), handler)
+		r.POST("/chats", RequireScope(auth.ScopeChatsWrite, nil), handler)
+		return r
+	}
+
+	cases := []struct {
+		name      string
+		verifyErr error
+		method    string
+		key       string
+		want      int
+		wantBody  string
+	}{
+		{"no key falls through", auth.ErrInvalidAPIKey, http.MethodPost, "", http.StatusOK, "token-user admin=false"},
+		{"scoped key", auth.ErrInvalidAPIKey, http.MethodGet, "read-key", http.StatusOK, "svc-user admin=false"},
+		{"missing scope", auth.ErrInvalidAPIKey, http.MethodPost, "read-key", http.StatusForbidden, `"code":"forbidden"`},
+		{"admin scope grants all", auth.ErrInvalidAPIKey, http.MethodPost, "root-key", http.StatusOK, "ops admin=true"},
+		{"invalid key", auth.ErrInvalidAPIKey, http.MethodGet, "nope", http.StatusUnauthorized, `"code":"unauthorized"`},
+		{"verifier down", errors.New("db down"), http.MethodGet, "nope", http.StatusServiceUnavailable, `"code":"internal_error"`},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.method, "/chats", nil)
+			if tc.key != "" {
+				req.Header.Set(HeaderAPIKey, tc.key)
+			}
+			newRouter(fakeKeys{err: tc.verifyErr}).ServeHTTP(w, req)
+			if w.Code != tc.want {
+				t.Fatalf("status = %d; want %d (body=%s)", w.Code, tc.want, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tc.wantBody) {
+				t.Fatalf("body = %s; want %s", w.Body.String(), tc.wantBody)
+			}
+		})
+	}
+}
+
+func TestAPIKeyAuth_Skip(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(APIKeyAuth(fakeKeys{err: fmt.Errorf("wrapped: %w", auth.ErrInvalidAPIKey)}, APIKeyOptions{
+		Skip: func(c *gin.Context) bool { return c.Request.URL.Path == "/health" },
+	}))
+	r.GET("/health", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.GET("/me", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for path, want := range map[string]int{"/health": http.StatusOK, "/me": http.StatusUnauthorized} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set(HeaderAPIKey, "bad")
+		r.ServeHTTP(w, req)
+		if w.Code != want {
+			t.Fatalf("%s: status = %d; want %d", path, w.Code, want)
+		}
+	}
+}
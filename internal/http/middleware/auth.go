@@ -0,0 +1,140 @@
+// Package middleware contains shared Gin middleware used by the HTTP layer.
+//
+// This file establishes the caller's identity for the public API:
+//
+//   - Authenticate validates "Authorization: Bearer <jwt>" with a
+//     TokenVerifier (see internal/auth) and stores the user id under the
+//     "userID" context key read by handlers, idempotency and rate limiting,
+//     plus an admin flag when the token carries the configured admin role.
+//   - HeaderIdentity is the legacy development mode that trusts the
+//     X-User-ID header (falling back to "demo-user"). It must never be used
+//     in production.
+//
+// Both must run before IdempotencyValidator and the rate limiter, which key
+// their state by user.
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tbourn/go-chat-backend/internal/auth"
+)
+
+// ContextKeyUserID is the Gin context key holding the authenticated user id.
+const ContextKeyUserID = "userID"
+
+// ContextKeyAdmin is the Gin context key set to true when the caller holds
+// the configured admin role (see AuthOptions.AdminRole). Handlers pass it to
+// the services, which then bypass chat ownership checks.
+const ContextKeyAdmin = "userIsAdmin"
+
+// ContextKeyClaims is the Gin context key holding the verified token claims
+// (auth.Claims). It is unset in header mode.
+const ContextKeyClaims = "authClaims"
+
+// TokenVerifier validates a bearer token and returns the caller's user id.
+// *auth.Verifier implements it.
+type TokenVerifier interface {
+	Verify(ctx context.Context, token string) (string, auth.Claims, error)
+}
+
+// AuthOptions configures Authenticate.
+type AuthOptions struct {
+	// Skip exempts requests from authentication (e.g. health checks, metrics,
+	// CORS preflights, or routes guarded by their own credentials).
+	Skip func(*gin.Context) bool
+
+	// AdminRole, when non-empty, marks callers whose RolesClaim contains it as
+	// admins (ContextKeyAdmin). Empty disables the admin override.
+	AdminRole string
+	// RolesClaim names the claim holding the caller's roles (an array or a
+	// space-separated string). Defaults to "roles".
+	RolesClaim string
+
+	// Fail writes the error response and aborts. It defaults to the standard
+	// error envelope with code "unauthorized" (or "internal_error" for 5xx).
+	Fail func(c *gin.Context, status int, message string)
+}
+
+// Authenticate returns a middleware that requires a valid bearer JWT on every
+// request not exempted by opts.Skip. Missing or invalid tokens get 401 with
+// a WWW-Authenticate challenge; if the signing keys cannot be loaded at all
+// the request fails with 503 so clients retry rather than re-authenticate.
+func Authenticate(v TokenVerifier, opts AuthOptions) gin.HandlerFunc {
+	fail := opts.Fail
+	if fail == nil {
+		fail = failAuth
+	}
+	rolesClaim := opts.RolesClaim
+	if rolesClaim == "" {
+		rolesClaim = "roles"
+	}
+	return func(c *gin.Context) {
+		if opts.Skip != nil && opts.Skip(c) {
+			c.Next()
+			return
+		}
+		tok, ok := bearerToken(c.GetHeader("Authorization"))
+		if !ok {
+			c.Header("WWW-Authenticate", `Bearer`)
+			fail(c, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+		uid, claims, err := v.Verify(c.Request.Context(), tok)
+		if err != nil {
+			if errors.Is(err, auth.ErrKeysUnavailable) {
+				LoggerFrom(c).Error().Err(err).Msg("jwt signing keys unavailable")
+				fail(c, http.StatusServiceUnavailable, "authentication temporarily unavailable")
+				return
+			}
+			c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			fail(c, http.StatusUnauthorized, "invalid bearer token")
+			return
+		}
+		c.Set(ContextKeyUserID, uid)
+		c.Set(ContextKeyClaims, claims)
+		if opts.AdminRole != "" && claims.Has(rolesClaim, opts.AdminRole) {
+			c.Set(ContextKeyAdmin, true)
+		}
+		c.Next()
+	}
+}
+
+// HeaderIdentity returns the legacy development middleware that takes the
+// user id from X-User-ID without any verification, defaulting to
+// "demo-user". Requests exempted by skip are passed through untouched.
+func HeaderIdentity(skip func(*gin.Context) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if skip != nil && skip(c) {
+			c.Next()
+			return
+		}
+		uid := strings.TrimSpace(c.GetHeader("X-User-ID"))
+		if uid == "" {
+			uid = "demo-user"
+		}
+		c.Set(ContextKeyUserID, uid)
+		c.Next()
+	}
+}
+
+// failAuth writes the default authentication (and scope) error envelope.
+func failAuth(c *gin.Context, status int, message string) {
+	code := "unauthorized"
+	switch {
+	case status == http.StatusForbidden:
+		code = "forbidden"
+	case status >= http.StatusInternalServerError:
+		code = "internal_error"
+	}
+	c.AbortWithStatusJSON(status, gin.H{
+		"request_id": c.Writer.Header().Get("X-Request-ID"),
+		"code":       code,
+		"message":    message,
+	})
+}
@@ -0,0 +1,156 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tbourn/go-chat-backend/internal/auth"
+)
+
+// fakeVerifier accepts "good" as user-1, "admin" as an ops user with the
+// admin role, and fails everything else with err.
+type fakeVerifier struct{ err error }
+
+func (f fakeVerifier) Verify(_ context.Context, tok string) (string, auth.Claims, error) {
+	switch tok {
+	case "good":
+		return "user-1", auth.Claims{"sub": "user-1"}, nil
+	case "admin":
+		return "ops", auth.Claims{"sub": "ops", "roles": []any{"admin"}}, nil
+	}
+	return "", nil, f.err
+}
+
+func TestAuthenticate(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(v TokenVerifier) *gin.Engine {
+		r := gin.New()
+		r.Use(Authenticate(v, AuthOptions{
+			Skip: func(c *gin.Context) bool { return c.Request.URL.Path == "/health" },
+		}))
+		handler := func(c *gin.Context) {
+			uid, _ := c.Get(ContextKeyUserID)
+			c.String(http.StatusOK, "%v", uid)
+		}
+		r.GET("/me", handler)
+		r.GET("/health", handler)
+		return r
+	}
+
+	cases := []struct {
+		name      string
+		verifyErr error
+		path      string
+		header    string
+		want      int
+		wantBody  string
+		challenge string
+	}{
+		{"valid token", auth.ErrSignature, "/me", "Bearer good", http.StatusOK, "user-1", ""},
+		{"spoofed X-User-ID ignored", auth.ErrSignature, "/me", "Bearer good", http.StatusOK, "user-1", ""},
+		{"missing header", auth.ErrSignature, "/me", "", http.StatusUnauthorized, `"code":"unauthorized"`, "Bearer"},
+		{"invalid token", auth.ErrExpired, "/me", "Bearer bad", http.StatusUnauthorized, `"code":"unauthorized"`, `Bearer error="invalid_token"`},
+		{"keys unavailable", auth.ErrKeysUnavailable, "/me", "Bearer bad", http.StatusServiceUnavailable, `"code":"internal_error"`, ""},
+		{"skipped route", auth.ErrSignature, "/health", "", http.StatusOK, "<nil>", ""},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			req.Header.Set("X-User-ID", "mallory")
+			if tc.header != "" {
+				req.Header.Set("Authorization", tc.header)
+			}
+			newRouter(fakeVerifier{err: tc.verifyErr}).ServeHTTP(w, req)
+			if w.Code != tc.want {
+				t.Fatalf("status = %d; want %d (body=%s)", w.Code, tc.want, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tc.wantBody) {
+				t.Fatalf("body = %s; want %s", w.Body.String(), tc.wantBody)
+			}
+			if got := w.Header().Get("WWW-Authenticate"); got != tc.challenge {
+				t.Fatalf("WWW-Authenticate = %q; want %q", got, tc.challenge)
+			}
+		})
+	}
+}
+
+func TestAuthenticate_AdminRole(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newRouter := func(role string) *gin.Engine {
+		r := gin.New()
+		r.Use(Authenticate(fakeVerifier{}, AuthOptions{AdminRole: role}))
+		r.GET("/me", func(c *gin.Context) {
+			c.String(http.StatusOK, "%v", c.GetBool(ContextKeyAdmin))
+		})
+		return r
+	}
+
+	cases := []struct {
+		name, role, token, want string
+	}{
+		{"admin role", "admin", "admin", "true"},
+		{"regular user", "admin", "good", "false"},
+		{"override disabled", "", "admin", "false"},
+		{"other role required", "superuser", "admin", "false"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/me", nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+			newRouter(tc.role).ServeHTTP(w, req)
+			if w.Body.String() != tc.want {
+				t.Fatalf("admin = %s; want %s", w.Body.String(), tc.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticate_CustomFail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var gotStatus int
+	r := gin.New()
+	r.Use(Authenticate(fakeVerifier{err: errors.New("boom")}, AuthOptions{
+		Fail: func(c *gin.Context, status int, msg string) {
+			gotStatus = status
+			c.AbortWithStatusJSON(status, gin.H{"code": "custom", "message": msg})
+		},
+	}))
+	r.GET("/me", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	req.Header.Set("Authorization", "Bearer bad")
+	r.ServeHTTP(w, req)
+	if gotStatus != http.StatusUnauthorized || !strings.Contains(w.Body.String(), `"code":"custom"`) {
+		t.Fatalf("custom Fail not used: status=%d body=%s", gotStatus, w.Body.String())
+	}
+}
+
+func TestHeaderIdentity(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(HeaderIdentity(nil))
+	r.GET("/me", func(c *gin.Context) {
+		uid, _ := c.Get(ContextKeyUserID)
+		c.String(http.StatusOK, "%v", uid)
+	})
+
+	for header, want := range map[string]string{" alice ": "alice", "": "demo-user"} {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/me", nil)
+		req.Header.Set("X-User-ID", header)
+		r.ServeHTTP(w, req)
+		if w.Body.String() != want {
+			t.Fatalf("X-User-ID %q → %q; want %q", header, w.Body.String(), want)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+// Package middleware contains shared Gin middleware used by the HTTP layer.
+//
+// This file provides ShouldCompress, the response-compression predicate used
+// with gin-contrib/gzip. It keeps the library's default rules and adds one:
+// Server-Sent Events are never compressed. A gzip stream buffers output until
+// flushed (and many proxies buffer compressed bodies regardless), and the
+// wrapped writer hides http.ResponseController, so streaming handlers could no
+// longer extend their write deadline.
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ShouldCompress reports whether the response to c may be gzip-compressed:
+// the client accepts gzip, the request is not a protocol upgrade, and it does
+// not ask for an event stream (by Accept header or the ":stream" route
+// suffix). Pass it to gzip.WithCustomShouldCompressFn.
+func ShouldCompress(c *gin.Context) bool {
+	r := c.Request
+	if !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") ||
+		strings.Contains(r.Header.Get("Connection"), "Upgrade") {
+		return false
+	}
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") ||
+		strings.HasSuffix(r.URL.Path, ":stream") {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestShouldCompress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cases := []struct {
+		name    string
+		path    string
+		headers map[string]string
+		want    bool
+	}{
+		{"gzip accepted", "/api/v1/chats", map[string]string{"Accept-Encoding": "gzip, br"}, true},
+		{"no accept-encoding", "/api/v1/chats", nil, false},
+		{"upgrade", "/ws", map[string]string{"Accept-Encoding": "gzip", "Connection": "Upgrade"}, false},
+		{"sse accept", "/api/v1/chats/x/messages", map[string]string{"Accept-Encoding": "gzip", "Accept": "text/event-stream"}, false},
+		{"stream suffix", "/api/v1/chats/x/messages:stream", map[string]string{"Accept-Encoding": "gzip"}, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("POST", tc.path, nil)
+			for k, v := range tc.headers {
+				c.Request.Header.Set(k, v)
+			}
+			if got := ShouldCompress(c); got != tc.want {
+				t.Fatalf("ShouldCompress = %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -1,23 +1,47 @@
 // Package middleware contains shared Gin middleware used by the HTTP layer.
 //
-// This file implements idempotency support for unsafe HTTP methods (e.g., POST).
-// It validates an Idempotency-Key request header, optionally performs a
-// user-defined lookup to detect previously completed requests, and annotates
-// the request context so downstream handlers can:
+// This file implements idempotency support for unsafe HTTP methods (POST,
+// PUT, PATCH, DELETE). It validates an Idempotency-Key request header and,
+// when an IdempotencyStore is configured, caches the first response sent for
+// a key so that retries receive the very same status code, headers and body
+// without the handler running again.
+//
+// Behavior for a request carrying a valid key on a routed unsafe method:
+//   - First use: the key is claimed (in flight) together with a fingerprint
+//     of the request (method, URI and body); the handler runs and its
+//     response is stored when it succeeded (status < 400). Failed requests,
+//     and responses marked `Cache-Control: no-store`, release the key so it
+//     can be retried.
+//   - Retry with the same fingerprint: the stored response is replayed with
+//     `Idempotency-Replayed: true`; rate limits and quotas are not charged.
+//   - Retry while the first request is still running: 409
+//     "idempotency_in_flight" with Retry-After.
+//   - Reuse with a different fingerprint: 422 "idempotency_key_reused".
+//
+// Keys are scoped to (workspace, user). Store failures are logged and the
+// request is served uncached: idempotency is a safety net, not worth an
+// outage. Requests with bodies larger than MaxRequestBytes are served
+// uncached too, so large uploads are not held in memory twice; bodies over
+// the route's size limit are rejected with 413 "payload_too_large".
+//
+// Downstream components can:
 //   - read the normalized key (GetIdempotencyKey)
 //   - detect replayed requests (IsReplay)
 //   - bypass rate limiting when a replay is served (via an internal flag)
-//
-// Design goals:
-//   - Keep transport concerns (validation, context stashing) in middleware.
-//   - Decouple persistence via a narrow IdempotencyLookup function type.
-//   - Remain framework-agnostic beyond Gin’s context.
 package middleware
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
 	"net/http"
 	"regexp"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -30,6 +54,10 @@ import (
 // retries (network, client, or server initiated) can be safely deduplicated.
 const HeaderIdempotencyKey = "Idempotency-Key"
 
+// HeaderIdempotencyReplayed is set to "true" on responses replayed from the
+// idempotency cache.
+const HeaderIdempotencyReplayed = "Idempotency-Replayed"
+
 // Context keys used internally to stash idempotency state.
 // These keys are intentionally unexported and referenced via accessor helpers.
 const (
@@ -51,11 +79,11 @@ func GetIdempotencyKey(c *gin.Context) (string, bool) {
 	return s, s != ""
 }
 
-// IsReplay reports whether the middleware detected that this request would
-// replay a previously completed operation (based on the provided key/user/chat).
+// IsReplay reports whether IdempotencyValidator is serving this request from
+// a previously stored response.
 //
-// When true, upstream components (e.g., handlers, rate limiters) may choose to
-// short-circuit computation and return the previously persisted result.
+// When true, upstream components (e.g., rate limiters, quotas) should not
+// charge the request.
 func IsReplay(c *gin.Context) bool {
 	v, ok := c.Get(ctxKeyIdemReplay)
 	if !ok {
@@ -65,42 +93,85 @@ func IsReplay(c *gin.Context) bool {
 	return b
 }
 
-// IdempotencyOptions configures header validation behavior for
-// IdempotencyValidator. TTL enforcement is intentionally out of scope here and
-// should be implemented inside the provided lookup function.
+// IdempotencyRequest identifies one use of an idempotency key.
+type IdempotencyRequest struct {
+	WorkspaceID string
+	UserID      string
+	Key         string
+	ChatID      string // chat the request acts on, if any (see IdempotencyOptions.ChatID)
+	Fingerprint string // hex SHA-256 of method, request URI and body
+}
+
+// IdempotentResponse is a response recorded for an idempotency key.
+type IdempotentResponse struct {
+	Fingerprint string // fingerprint of the request that claimed the key
+	InFlight    bool   // the claiming request has not completed yet
+	Status      int
+	Header      http.Header
+	Body        []byte
+}
+
+// IdempotencyStore persists idempotency keys and their responses.
+//
+// BeginIdempotent atomically claims req's key for lease, returning
+// claimed=true, or returns the record already holding it. CompleteIdempotent
+// stores the response of a claimed request for ttl; ReleaseIdempotent drops
+// a claim so the key can be reused.
+type IdempotencyStore interface {
+	BeginIdempotent(ctx context.Context, req IdempotencyRequest, lease time.Duration) (prev *IdempotentResponse, claimed bool, err error)
+	CompleteIdempotent(ctx context.Context, req IdempotencyRequest, resp IdempotentResponse, ttl time.Duration) error
+	ReleaseIdempotent(ctx context.Context, req IdempotencyRequest) error
+}
+
+// IdempotencyOptions configures IdempotencyValidator.
 type IdempotencyOptions struct {
 	// MaxLen caps the accepted key length. Values <= 0 default to 200.
 	MaxLen int
 	// Pattern restricts allowed characters. If nil, a conservative RFC7230-like
 	// token pattern is used: ^[A-Za-z0-9._~\-:]+$
 	Pattern *regexp.Regexp
-	// NOTE: TTL is not enforced here; enforce it within your IdempotencyLookup.
+	// TTL is how long a completed response is replayed. Defaults to 24h.
+	TTL time.Duration
+	// InFlightTimeout bounds how long a claim blocks retries (409) when the
+	// claiming request never completes, e.g. because the process died.
+	// Defaults to 5 minutes.
+	InFlightTimeout time.Duration
+	// MaxBodyBytes caps the response size that is cached; larger responses
+	// are served but not stored. Defaults to 1 MiB.
+	MaxBodyBytes int
+	// MaxRequestBytes caps the request body size that is fingerprinted;
+	// larger requests are served but not cached. Defaults to 1 MiB.
+	MaxRequestBytes int64
+	// ChatID optionally extracts the chat a request acts on, so cached
+	// responses of a deleted chat are not replayed. Nil records none.
+	ChatID func(c *gin.Context) string
+	// Fail writes the error response and aborts. It defaults to the standard
+	// error envelope (see failWorkspace).
+	Fail func(c *gin.Context, status int, code, message string)
 }
 
-// IdempotencyLookup answers whether a successful, still-valid result exists for
-// (userID, chatID, key) at the given time. Implementations typically consult a
-// database record containing the previous response metadata and TTL window.
-//
-// Return exists=true when the prior response can be replayed; return an error
-// only for lookup failures (which should not block normal processing).
-type IdempotencyLookup func(ctx context.Context, userID, chatID, key string, now time.Time) (exists bool, err error)
-
-// IdempotencyValidator validates the Idempotency-Key header (if present), stashes
-// it in the request context, and optionally checks for a prior completed request
-// via the supplied lookup. When a replay is detected, it marks the context so
-// downstream components can:
-//   - detect replay via IsReplay
-//   - bypass rate limiting (internal flag checked by your RL middleware)
-//
-// Behavior:
-//   - If header is absent: the middleware is a no-op.
-//   - If header fails validation: responds 400 with a compact error body.
-//   - If lookup indicates a replay: sets replay + rate-bypass flags.
-//   - Always invokes the next handler unless validation fails.
+// idempotencySkipHeaders are response headers never stored for replay: they
+// describe the transport or the current request rather than the result.
+var idempotencySkipHeaders = func() map[string]bool {
+	m := map[string]bool{}
+	for _, h := range []string{
+		"Content-Length", "Content-Encoding", "Date", "X-Request-ID", "Retry-After",
+		HeaderIdempotencyReplayed,
+		HeaderRateLimitLimit, HeaderRateLimitRemaining, HeaderRateLimitReset,
+	} {
+		m[http.CanonicalHeaderKey(h)] = true
+	}
+	return m
+}()
+
+// IdempotencyValidator validates the Idempotency-Key header (if present),
+// stashes it in the request context and, when store is non-nil, caches and
+// replays responses of unsafe methods as described in the file comment.
 //
-// This middleware does not itself return a cached payload; handlers remain in
-// control of how to serve replays (e.g., by fetching previously persisted data).
-func IdempotencyValidator(opts IdempotencyOptions, lookup IdempotencyLookup) gin.HandlerFunc {
+// Requests without the header, safe methods and unrouted requests pass
+// through untouched; an invalid key is rejected with 400
+// "bad_idempotency_key".
+func IdempotencyValidator(opts IdempotencyOptions, store IdempotencyStore) gin.HandlerFunc {
 	// Sensible defaults.
 	maxLen := opts.MaxLen
 	if maxLen <= 0 {
@@ -111,6 +182,26 @@ func IdempotencyValidator(opts IdempotencyOptions, lookup IdempotencyLookup) gin
 		// RFC-7230-ish token + common safe chars.
 		pat = regexp.MustCompile(`^[A-Za-z0-9._~\-:]+$`)
 	}
+	ttl := opts.TTL
+	if ttl <= 0 {
+		ttl = 24 * time.Hour
+	}
+	lease := opts.InFlightTimeout
+	if lease <= 0 {
+		lease = 5 * time.Minute
+	}
+	maxBody := opts.MaxBodyBytes
+	if maxBody <= 0 {
+		maxBody = 1 << 20
+	}
+	maxRequest := opts.MaxRequestBytes
+	if maxRequest <= 0 {
+		maxRequest = 1 << 20
+	}
+	fail := opts.Fail
+	if fail == nil {
+		fail = failWorkspace
+	}
 
 	return func(c *gin.Context) {
 		key := c.GetHeader(HeaderIdempotencyKey)
@@ -120,32 +211,213 @@ func IdempotencyValidator(opts IdempotencyOptions, lookup IdempotencyLookup) gin
 			return
 		}
 		if len(key) > maxLen || !pat.MatchString(key) {
-			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{
-				"code":    "bad_idempotency_key",
-				"message": "invalid Idempotency-Key",
-			})
+			fail(c, http.StatusBadRequest, "bad_idempotency_key", "invalid "+HeaderIdempotencyKey)
 			return
 		}
 
 		// Stash the normalized key for downstream use.
 		c.Set(ctxKeyIdemKey, key)
 
-		// If we can detect a previously stored response, mark replay + rate bypass.
-		if lookup != nil {
-			uid := userIDFromCtx(c)
-			chatID := c.Param("id") // our POST /chats/:id/messages uses :id
-			now := time.Now().UTC()
+		if store == nil || !unsafeMethod(c.Request.Method) || c.FullPath() == "" {
+			c.Next()
+			return
+		}
 
-			if exists, _ := lookup(c.Request.Context(), uid, chatID, key, now); exists {
-				c.Set(ctxKeyIdemReplay, true)
-				c.Set(ctxKeyRateBypass, true) // let RL middleware skip limiting
+		body, whole, err := readBody(c.Request, maxRequest)
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				fail(c, http.StatusRequestEntityTooLarge, "payload_too_large", "request body is too large")
+				return
 			}
+			fail(c, http.StatusBadRequest, "bad_request", "invalid request body")
+			return
+		}
+		if !whole {
+			c.Next()
+			return
+		}
+		req := IdempotencyRequest{
+			WorkspaceID: WorkspaceID(c),
+			UserID:      userIDFromCtx(c),
+			Key:         key,
+			Fingerprint: requestFingerprint(c.Request, body),
+		}
+		if opts.ChatID != nil {
+			req.ChatID = opts.ChatID(c)
 		}
 
+		ctx := c.Request.Context()
+		prev, claimed, err := store.BeginIdempotent(ctx, req, lease)
+		if err != nil {
+			LoggerFrom(c).Error().Err(err).Msg("idempotency store failed; serving request uncached")
+			c.Next()
+			return
+		}
+		if !claimed {
+			switch {
+			case prev.Fingerprint != req.Fingerprint:
+				fail(c, http.StatusUnprocessableEntity, "idempotency_key_reused",
+					HeaderIdempotencyKey+" was already used for a different request")
+			case prev.InFlight:
+				c.Header("Retry-After", "1")
+				fail(c, http.StatusConflict, "idempotency_in_flight",
+					"a request with this "+HeaderIdempotencyKey+" is still being processed")
+			default:
+				replayResponse(c, prev)
+			}
+			return
+		}
+
+		before := c.Writer.Header().Clone()
+		w := &captureWriter{ResponseWriter: c.Writer, limit: maxBody}
+		c.Writer = w
 		c.Next()
+		c.Writer = w.ResponseWriter
+
+		// The client may be gone; record the outcome regardless.
+		ctx = context.WithoutCancel(ctx)
+		status := w.Status()
+		header := storedHeaders(before, w.Header())
+		if status >= http.StatusBadRequest || len(c.Errors) > 0 || w.overflow || noStore(header) {
+			if err := store.ReleaseIdempotent(ctx, req); err != nil {
+				LoggerFrom(c).Error().Err(err).Msg("idempotency release failed")
+			}
+			return
+		}
+		resp := IdempotentResponse{
+			Fingerprint: req.Fingerprint,
+			Status:      status,
+			Header:      header,
+			Body:        w.body.Bytes(),
+		}
+		if err := store.CompleteIdempotent(ctx, req, resp, ttl); err != nil {
+			LoggerFrom(c).Error().Err(err).Msg("idempotency store failed; response not cached")
+		}
+	}
+}
+
+// unsafeMethod reports whether method may change server state.
+func unsafeMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// readBody reads up to limit bytes of r's body and puts an equivalent reader
+// back in its place. whole is false when the body is longer than limit; body
+// then holds only its start.
+func readBody(r *http.Request, limit int64) (body []byte, whole bool, err error) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true, nil
+	}
+	body, err = io.ReadAll(io.LimitReader(r.Body, limit+1))
+	if err != nil {
+		_ = r.Body.Close()
+		return nil, false, err
+	}
+	if int64(len(body)) > limit {
+		r.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+		return body, false, nil
+	}
+	_ = r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, true, nil
+}
+
+// requestFingerprint hashes what makes two requests "the same".
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method)
+	h.Write([]byte{0})
+	io.WriteString(h, r.URL.RequestURI())
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// storedHeaders returns the headers set downstream of the middleware (by the
+// handler and later middleware), minus idempotencySkipHeaders.
+func storedHeaders(before, after http.Header) http.Header {
+	out := http.Header{}
+	for k, v := range after {
+		if idempotencySkipHeaders[k] || slices.Equal(before[k], v) {
+			continue
+		}
+		out[k] = slices.Clone(v)
 	}
+	return out
 }
 
+// noStore reports whether the handler forbade storing its response (e.g.
+// one that reveals a secret once).
+func noStore(h http.Header) bool {
+	for _, v := range h.Values("Cache-Control") {
+		if strings.Contains(strings.ToLower(v), "no-store") {
+			return true
+		}
+	}
+	return false
+}
+
+// replayResponse writes a stored response and aborts the chain.
+func replayResponse(c *gin.Context, prev *IdempotentResponse) {
+	c.Set(ctxKeyIdemReplay, true)
+	c.Set(ctxKeyRateBypass, true)
+	h := c.Writer.Header()
+	for k, v := range prev.Header {
+		h[k] = slices.Clone(v)
+	}
+	h.Set(HeaderIdempotencyReplayed, "true")
+	if len(prev.Body) > 0 {
+		h.Set("Content-Length", strconv.Itoa(len(prev.Body)))
+	}
+	c.Status(prev.Status)
+	_, _ = c.Writer.Write(prev.Body)
+	c.Abort()
+}
+
+// captureWriter tees the response body into a buffer of at most limit bytes.
+type captureWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (w *captureWriter) capture(p []byte) {
+	if w.overflow {
+		return
+	}
+	if w.body.Len()+len(p) > w.limit {
+		w.overflow = true
+		w.body = bytes.Buffer{}
+		return
+	}
+	w.body.Write(p)
+}
+
+func (w *captureWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.capture(p[:n])
+	return n, err
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	w.capture([]byte(s[:n]))
+	return n, err
+}
+
+// Unwrap exposes the underlying writer to http.ResponseController (used by
+// streaming handlers for write deadlines and flushing).
+func (w *captureWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
 // userIDFromCtx extracts the user identifier from the Gin context as set by
 // upstream authentication middleware. A development-friendly "demo-user"
 // fallback is returned when no identity is available.
@@ -3,9 +3,13 @@ package middleware
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"regexp"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -57,32 +61,85 @@ func TestHelpers_GetIdempotencyKey_IsReplay_UserIDFromCtx(t *testing.T) {
 	}
 }
 
-func TestIdempotencyValidator_NoHeader_NoLookupCalled(t *testing.T) {
+// memIdemStore is an in-memory IdempotencyStore.
+type memIdemStore struct {
+	mu       sync.Mutex
+	recs     map[string]*IdempotentResponse
+	reqs     []IdempotencyRequest // Begin calls
+	ttl      time.Duration        // last Complete ttl
+	released int
+	err      error // returned by every call when set
+}
+
+func newMemIdemStore() *memIdemStore {
+	return &memIdemStore{recs: map[string]*IdempotentResponse{}}
+}
+
+func (s *memIdemStore) id(req IdempotencyRequest) string {
+	return req.WorkspaceID + "/" + req.UserID + "/" + req.Key
+}
+
+func (s *memIdemStore) BeginIdempotent(_ context.Context, req IdempotencyRequest, _ time.Duration) (*IdempotentResponse, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.reqs = append(s.reqs, req)
+	if s.err != nil {
+		return nil, false, s.err
+	}
+	if prev, ok := s.recs[s.id(req)]; ok {
+		cp := *prev
+		return &cp, false, nil
+	}
+	s.recs[s.id(req)] = &IdempotentResponse{Fingerprint: req.Fingerprint, InFlight: true}
+	return nil, true, nil
+}
+
+func (s *memIdemStore) CompleteIdempotent(_ context.Context, req IdempotencyRequest, resp IdempotentResponse, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.recs[s.id(req)] = &resp
+	s.ttl = ttl
+	return s.err
+}
+
+func (s *memIdemStore) ReleaseIdempotent(_ context.Context, req IdempotencyRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.recs, s.id(req))
+	s.released++
+	return s.err
+}
+
+func idemRequest(r http.Handler, method, path, key, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(HeaderIdempotencyKey, key)
+	}
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyValidator_NoHeader_StoreNotCalled(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
 
-	lookupCalled := false
-	lookup := func(_ context.Context, _ string, _ string, _ string, _ time.Time) (bool, error) {
-		lookupCalled = true
-		return false, nil
-	}
-	r.Use(IdempotencyValidator(IdempotencyOptions{}, lookup))
-	r.GET("/ping", func(c *gin.Context) {
+	store := newMemIdemStore()
+	r.Use(IdempotencyValidator(IdempotencyOptions{}, store))
+	r.POST("/ping", func(c *gin.Context) {
 		// header absent ⇒ no key stashed
 		if _, ok := GetIdempotencyKey(c); ok {
 			t.Fatalf("key should not be present when header missing")
 		}
 		c.Status(http.StatusNoContent)
 	})
-	w := httptest.NewRecorder()
-	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
-	r.ServeHTTP(w, req)
+	w := idemRequest(r, http.MethodPost, "/ping", "", "")
 
 	if w.Code != http.StatusNoContent {
 		t.Fatalf("expected 204, got %d", w.Code)
 	}
-	if lookupCalled {
-		t.Fatalf("lookup should not be called when header missing")
+	if len(store.reqs) != 0 {
+		t.Fatalf("store should not be called when header missing")
 	}
 }
 
@@ -125,7 +182,7 @@ func TestIdempotencyValidator_InvalidKey_Pattern(t *testing.T) {
 	}
 }
 
-func TestIdempotencyValidator_Valid_NoLookup(t *testing.T) {
+func TestIdempotencyValidator_Valid_NoStore(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
 	// MaxLen <= 0 triggers default 200, Pattern nil triggers default regex
@@ -136,10 +193,10 @@ func TestIdempotencyValidator_Valid_NoLookup(t *testing.T) {
 			t.Fatalf("expected stashed key abc-123, got %q ok=%v", key, ok)
 		}
 		if IsReplay(c) {
-			t.Fatalf("expected IsReplay=false when lookup=nil")
+			t.Fatalf("expected IsReplay=false without a store")
 		}
 		if IsRateBypass(c) {
-			t.Fatalf("expected IsRateBypass=false when lookup=nil")
+			t.Fatalf("expected IsRateBypass=false without a store")
 		}
 		c.Status(http.StatusOK)
 	})
@@ -153,71 +210,221 @@ func TestIdempotencyValidator_Valid_NoLookup(t *testing.T) {
 	}
 }
 
-func TestIdempotencyValidator_Valid_WithLookup_MissAndHit(t *testing.T) {
+func TestIdempotencyValidator_StoresAndReplays(t *testing.T) {
 	gin.SetMode(gin.TestMode)
-
-	t.Run("lookup miss", func(t *testing.T) {
-		r := gin.New()
-		lookup := func(_ context.Context, userID, chatID, key string, now time.Time) (bool, error) {
-			if userID == "" || key == "" || now.IsZero() {
-				t.Fatalf("lookup args not populated: uid=%q key=%q now=%v", userID, key, now)
-			}
-			// When no user set in context, userIDFromCtx returns "demo-user"
-			if userID != "demo-user" {
-				t.Fatalf("expected demo-user fallback, got %q", userID)
-			}
-			if chatID != "c42" {
-				t.Fatalf("expected chatID path param c42, got %q", chatID)
-			}
-			return false, nil
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set("userID", "u9")
+		c.Set(ContextKeyWorkspaceID, "ws-9")
+		c.Header("X-Request-ID", "rid") // per-request; never replayed
+		c.Next()
+	})
+	store := newMemIdemStore()
+	r.Use(IdempotencyValidator(IdempotencyOptions{
+		TTL:    time.Hour,
+		ChatID: func(c *gin.Context) string { return c.Param("id") },
+	}, store))
+	r.Use(func(c *gin.Context) {
+		if IsReplay(c) || IsRateBypass(c) {
+			t.Fatalf("replays must not reach downstream middleware")
 		}
-		r.Use(IdempotencyValidator(IdempotencyOptions{}, lookup))
-		r.POST("/chats/:id/messages", func(c *gin.Context) {
-			if IsReplay(c) || IsRateBypass(c) {
-				t.Fatalf("expected no replay/bypass on miss")
-			}
-			c.Status(http.StatusOK)
-		})
+		c.Header(HeaderRateLimitRemaining, "3")
+		c.Next()
+	})
+	calls := 0
+	r.POST("/chats", func(c *gin.Context) {
+		calls++
+		c.Header("Location", "/chats/c1")
+		c.JSON(http.StatusCreated, gin.H{"id": "c1", "n": calls})
+	})
+	r.PUT("/chats/:id/title", func(c *gin.Context) {
+		calls++
+		c.Status(http.StatusNoContent)
+	})
+
+	first := idemRequest(r, http.MethodPost, "/chats", "k1", `{"title":"a"}`)
+	if first.Code != http.StatusCreated || first.Header().Get(HeaderIdempotencyReplayed) != "" {
+		t.Fatalf("first = %d %v", first.Code, first.Header())
+	}
+	again := idemRequest(r, http.MethodPost, "/chats", "k1", `{"title":"a"}`)
+	if again.Code != http.StatusCreated || again.Body.String() != first.Body.String() || calls != 1 {
+		t.Fatalf("replay = %d %q (calls %d)", again.Code, again.Body.String(), calls)
+	}
+	h := again.Header()
+	if h.Get(HeaderIdempotencyReplayed) != "true" || h.Get("Location") != "/chats/c1" ||
+		h.Get("Content-Type") != "application/json; charset=utf-8" || h.Get(HeaderRateLimitRemaining) != "" ||
+		h.Get("X-Request-ID") != "rid" || len(h.Values("X-Request-ID")) != 1 {
+		t.Fatalf("replayed headers = %v", h)
+	}
+
+	req := store.reqs[0]
+	if req.WorkspaceID != "ws-9" || req.UserID != "u9" || req.Key != "k1" || req.ChatID != "" || len(req.Fingerprint) != 64 {
+		t.Fatalf("request = %+v", req)
+	}
+	if store.ttl != time.Hour {
+		t.Fatalf("ttl = %v", store.ttl)
+	}
 
-		w := httptest.NewRecorder()
-		req := httptest.NewRequest(http.MethodPost, "/chats/c42/messages", nil)
-		req.Header.Set(HeaderIdempotencyKey, "key-1")
-		r.ServeHTTP(w, req)
-		if w.Code != http.StatusOK {
-			t.Fatalf("miss: expected 200, got %d", w.Code)
+	// Reusing the key for another request is rejected.
+	if w := idemRequest(r, http.MethodPost, "/chats", "k1", `{"title":"b"}`); w.Code != http.StatusUnprocessableEntity ||
+		!strings.Contains(w.Body.String(), "idempotency_key_reused") {
+		t.Fatalf("reused key = %d %s", w.Code, w.Body.String())
+	}
+	if w := idemRequest(r, http.MethodPut, "/chats/c1/title", "k1", `{"title":"a"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("reused key on another route = %d", w.Code)
+	}
+
+	// Routes with a chat id record it.
+	if w := idemRequest(r, http.MethodPut, "/chats/c1/title", "k2", `{}`); w.Code != http.StatusNoContent {
+		t.Fatalf("put = %d", w.Code)
+	}
+	if w := idemRequest(r, http.MethodPut, "/chats/c1/title", "k2", `{}`); w.Code != http.StatusNoContent || calls != 2 {
+		t.Fatalf("put replay = %d (calls %d)", w.Code, calls)
+	}
+	if got := store.reqs[len(store.reqs)-1].ChatID; got != "c1" {
+		t.Fatalf("chat id = %q", got)
+	}
+}
+
+func TestIdempotencyValidator_InFlight(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(IdempotencyValidator(IdempotencyOptions{}, newMemIdemStore()))
+	var nested *httptest.ResponseRecorder
+	r.POST("/x", func(c *gin.Context) {
+		if nested == nil {
+			// A retry arriving while this request runs.
+			nested = idemRequest(r, http.MethodPost, "/x", "k", "body")
 		}
+		c.Status(http.StatusOK)
 	})
 
-	t.Run("lookup hit sets replay and bypass, passes user id", func(t *testing.T) {
-		r := gin.New()
-		// inject user before idempotency middleware
-		r.Use(func(c *gin.Context) { c.Set("userID", "u9"); c.Next() })
-		lookup := func(_ context.Context, userID, chatID, key string, _ time.Time) (bool, error) {
-			if userID != "u9" {
-				t.Fatalf("expected userID u9, got %q", userID)
-			}
-			if chatID != "abc" || key != "k-9" {
-				t.Fatalf("unexpected chatID/key: %q %q", chatID, key)
+	if w := idemRequest(r, http.MethodPost, "/x", "k", "body"); w.Code != http.StatusOK {
+		t.Fatalf("first = %d", w.Code)
+	}
+	if nested.Code != http.StatusConflict || nested.Header().Get("Retry-After") != "1" ||
+		!strings.Contains(nested.Body.String(), "idempotency_in_flight") {
+		t.Fatalf("in flight = %d %v %s", nested.Code, nested.Header(), nested.Body.String())
+	}
+}
+
+func TestIdempotencyValidator_FailuresAreNotStored(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	store := newMemIdemStore()
+	r.Use(IdempotencyValidator(IdempotencyOptions{MaxBodyBytes: 8}, store))
+	calls := 0
+	r.POST("/bad", func(c *gin.Context) { calls++; c.Status(http.StatusBadRequest) })
+	r.POST("/err", func(c *gin.Context) { calls++; _ = c.Error(errors.New("stream broke")); c.Status(http.StatusOK) })
+	r.POST("/secret", func(c *gin.Context) {
+		calls++
+		c.Header("Cache-Control", "no-store")
+		c.String(http.StatusCreated, "s3cret")
+	})
+	r.POST("/big", func(c *gin.Context) { calls++; c.String(http.StatusOK, "0123456789") })
+	r.GET("/get", func(c *gin.Context) { calls++; c.Status(http.StatusOK) })
+
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodPost, "/bad"}, {http.MethodPost, "/err"}, {http.MethodPost, "/secret"},
+		{http.MethodPost, "/big"}, {http.MethodGet, "/get"},
+	} {
+		calls = 0
+		key := "k" + strings.TrimPrefix(tc.path, "/")
+		for i := 0; i < 2; i++ {
+			if w := idemRequest(r, tc.method, tc.path, key, ""); w.Header().Get(HeaderIdempotencyReplayed) != "" {
+				t.Fatalf("%s replayed", tc.path)
 			}
-			return true, nil
 		}
-		r.Use(IdempotencyValidator(IdempotencyOptions{}, lookup))
-		r.POST("/chats/:id/messages", func(c *gin.Context) {
-			if !IsReplay(c) {
-				t.Fatalf("expected IsReplay=true on hit")
-			}
-			if !IsRateBypass(c) {
-				t.Fatalf("expected IsRateBypass=true on hit")
+		if calls != 2 {
+			t.Fatalf("%s: handler ran %d times", tc.path, calls)
+		}
+	}
+	if store.released != 8 || len(store.recs) != 0 {
+		t.Fatalf("released = %d, records = %d", store.released, len(store.recs))
+	}
+}
+
+func TestIdempotencyValidator_StoreErrorServesUncached(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	store := newMemIdemStore()
+	store.err = errors.New("db down")
+	r.Use(IdempotencyValidator(IdempotencyOptions{}, store))
+	calls := 0
+	r.POST("/x", func(c *gin.Context) { calls++; c.Status(http.StatusCreated) })
+
+	for i := 0; i < 2; i++ {
+		if w := idemRequest(r, http.MethodPost, "/x", "k", "{}"); w.Code != http.StatusCreated {
+			t.Fatalf("request %d = %d", i, w.Code)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("handler ran %d times", calls)
+	}
+}
+
+func TestIdempotencyValidator_LargeBodies(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	calls := 0
+	newRouter := func(maxRequest int64) *gin.Engine {
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, 32)
+		})
+		r.Use(IdempotencyValidator(IdempotencyOptions{MaxRequestBytes: maxRequest}, newMemIdemStore()))
+		r.POST("/x", func(c *gin.Context) {
+			calls++
+			body, err := io.ReadAll(c.Request.Body)
+			if err != nil {
+				c.Status(http.StatusRequestEntityTooLarge)
+				return
 			}
-			c.Status(http.StatusOK)
+			c.String(http.StatusCreated, "%d", len(body))
 		})
+		return r
+	}
+	r := newRouter(8)
 
-		w := httptest.NewRecorder()
-		req := httptest.NewRequest(http.MethodPost, "/chats/abc/messages", nil)
-		req.Header.Set(HeaderIdempotencyKey, "k-9")
-		r.ServeHTTP(w, req)
-		if w.Code != http.StatusOK {
-			t.Fatalf("hit: expected 200, got %d", w.Code)
+	// Over MaxRequestBytes: served whole, but not cached.
+	body := strings.Repeat("a", 20)
+	for i := 0; i < 2; i++ {
+		if w := idemRequest(r, http.MethodPost, "/x", "k", body); w.Code != http.StatusCreated || w.Body.String() != "20" ||
+			w.Header().Get(HeaderIdempotencyReplayed) != "" {
+			t.Fatalf("request %d = %d %q", i, w.Code, w.Body.String())
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("handler ran %d times", calls)
+	}
+
+	// Over the route's body limit while fingerprinting: 413.
+	w := idemRequest(newRouter(64), http.MethodPost, "/x", "k2", strings.Repeat("a", 40))
+	if w.Code != http.StatusRequestEntityTooLarge || !strings.Contains(w.Body.String(), "payload_too_large") || calls != 2 {
+		t.Fatalf("too large = %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestIdempotencyValidator_StreamingWriter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(IdempotencyValidator(IdempotencyOptions{}, newMemIdemStore()))
+	r.POST("/stream", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+		for _, ev := range []string{"a", "b"} {
+			_, _ = c.Writer.WriteString("data: " + ev + "\n\n")
+			// Streaming handlers flush through http.ResponseController.
+			if err := http.NewResponseController(c.Writer).Flush(); err != nil {
+				t.Fatalf("flush: %v", err)
+			}
 		}
 	})
+
+	first := idemRequest(r, http.MethodPost, "/stream", "k", "{}")
+	if !first.Flushed {
+		t.Fatalf("stream not flushed")
+	}
+	again := idemRequest(r, http.MethodPost, "/stream", "k", "{}")
+	if again.Body.String() != "data: a\n\ndata: b\n\n" || again.Header().Get(HeaderIdempotencyReplayed) != "true" {
+		t.Fatalf("replayed stream = %q", again.Body.String())
+	}
 }
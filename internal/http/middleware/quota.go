@@ -0,0 +1,108 @@
+// Package middleware contains shared Gin middleware used by the HTTP layer.
+//
+// This file enforces persistent usage quotas (e.g. messages per day) on
+// individual routes. Unlike RateLimiter, which smooths short bursts in
+// memory, quotas are hard daily/monthly caps counted by a QuotaEnforcer,
+// typically backed by the database.
+//
+// Behavior:
+//   - One unit is consumed before the handler runs; when a quota is
+//     exhausted the request is rejected with 429 "quota_exceeded" and
+//     headers telling the client when the quota resets.
+//   - If the handler then fails (status >= 400), the unit is refunded to
+//     the counters it was charged to (even if a period ended meanwhile) so
+//     rejected or invalid requests do not count.
+//   - Idempotent replays (see IdempotencyValidator) are not counted.
+//   - Enforcer errors are logged and the request is let through: quotas
+//     are a cost control, not worth an outage.
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+)
+
+// Quota response headers, set on 429 "quota_exceeded" responses.
+const (
+	HeaderQuotaLimit     = "X-Quota-Limit"     // the exceeded limit
+	HeaderQuotaRemaining = "X-Quota-Remaining" // always 0 on rejection
+	HeaderQuotaReset     = "X-Quota-Reset"     // Unix time the quota resets
+	HeaderQuotaScope     = "X-Quota-Scope"     // "<scope>:<period>", e.g. "user:day"
+)
+
+// QuotaExceeded describes the quota that rejected a request.
+type QuotaExceeded struct {
+	Scope   string    // "user" or "workspace"
+	Period  string    // "day" or "month"
+	Message string    // human-readable description
+	Limit   int64     // the exceeded limit
+	Reset   time.Time // when the quota resets
+}
+
+// QuotaEnforcer counts usage of a metric for a caller in a workspace.
+//
+// ConsumeQuota returns the counters it incremented, or a non-nil
+// *QuotaExceeded (and counts nothing) when a limit is reached; a non-nil
+// error is an enforcer failure. RefundQuota gives back the unit counted
+// against the counters returned by ConsumeQuota, even if ctx is cancelled.
+type QuotaEnforcer interface {
+	ConsumeQuota(ctx context.Context, workspaceID, userID, metric string) ([]domain.UsageCounter, *QuotaExceeded, error)
+	RefundQuota(ctx context.Context, counters []domain.UsageCounter) error
+}
+
+// QuotaOptions configures Quota.
+type QuotaOptions struct {
+	// Fail writes the error response and aborts. It defaults to the standard
+	// error envelope (see failWorkspace).
+	Fail func(c *gin.Context, status int, code, message string)
+}
+
+// Quota returns a middleware counting one unit of metric per request against
+// q. It must run after authentication and Workspace.
+func Quota(metric string, q QuotaEnforcer, opts QuotaOptions) gin.HandlerFunc {
+	fail := opts.Fail
+	if fail == nil {
+		fail = failWorkspace
+	}
+	return func(c *gin.Context) {
+		if IsReplay(c) {
+			c.Next()
+			return
+		}
+		ws, uid := WorkspaceID(c), userIDFromCtx(c)
+		counters, exceeded, err := q.ConsumeQuota(c.Request.Context(), ws, uid, metric)
+		if err != nil {
+			LoggerFrom(c).Error().Err(err).Str("metric", metric).Msg("quota check failed; allowing request")
+			c.Next()
+			return
+		}
+		if exceeded != nil {
+			retry := int64(time.Until(exceeded.Reset).Seconds()) + 1
+			if retry < 1 {
+				retry = 1
+			}
+			h := c.Writer.Header()
+			h.Set(HeaderQuotaLimit, strconv.FormatInt(exceeded.Limit, 10))
+			h.Set(HeaderQuotaRemaining, "0")
+			h.Set(HeaderQuotaReset, strconv.FormatInt(exceeded.Reset.Unix(), 10))
+			h.Set(HeaderQuotaScope, exceeded.Scope+":"+exceeded.Period)
+			h.Set("Retry-After", strconv.FormatInt(retry, 10))
+			fail(c, http.StatusTooManyRequests, "quota_exceeded", exceeded.Message)
+			return
+		}
+
+		c.Next()
+
+		if c.Writer.Status() >= http.StatusBadRequest {
+			if err := q.RefundQuota(c.Request.Context(), counters); err != nil {
+				LoggerFrom(c).Error().Err(err).Str("metric", metric).Msg("quota refund failed")
+			}
+		}
+	}
+}
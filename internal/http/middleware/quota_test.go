@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+)
+
+// fakeQuota allows limit units per workspace/user/metric. A non-nil err
+// fails every call.
+type fakeQuota struct {
+	mu    sync.Mutex
+	limit int
+	used  map[string]int
+	reset time.Time
+	err   error
+}
+
+func (f *fakeQuota) ConsumeQuota(_ context.Context, ws, uid, metric string) ([]domain.UsageCounter, *QuotaExceeded, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return nil, nil, f.err
+	}
+	k := ws + "/" + uid + "/" + metric
+	if f.used[k] >= f.limit {
+		return nil, &QuotaExceeded{Scope: "user", Period: "day", Message: "user daily quota exceeded", Limit: int64(f.limit), Reset: f.reset}, nil
+	}
+	f.used[k]++
+	return []domain.UsageCounter{{Scope: "user", SubjectID: k}}, nil, nil
+}
+
+func (f *fakeQuota) RefundQuota(_ context.Context, counters []domain.UsageCounter) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range counters {
+		f.used[c.SubjectID]--
+	}
+	return f.err
+}
+
+func TestQuota(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	reset := time.Now().Add(90 * time.Second).Truncate(time.Second)
+
+	newRouter := func(q QuotaEnforcer) *gin.Engine {
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			c.Set(ContextKeyUserID, "alice")
+			c.Set(ctxKeyIdemReplay, c.GetHeader("X-Replay") == "1")
+		})
+		r.POST("/messages", Quota("messages", q, QuotaOptions{}), func(c *gin.Context) {
+			if c.Query("fail") == "1" {
+				c.Status(http.StatusBadRequest)
+				return
+			}
+			c.Status(http.StatusCreated)
+		})
+		return r
+	}
+	do := func(r *gin.Engine, target string, replay bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, target, nil)
+		if replay {
+			req.Header.Set("X-Replay", "1")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("limits and refunds", func(t *testing.T) {
+		q := &fakeQuota{limit: 2, used: map[string]int{}, reset: reset}
+		r := newRouter(q)
+
+		if w := do(r, "/messages", false); w.Code != http.StatusCreated {
+			t.Fatalf("first: %d", w.Code)
+		}
+		// A failed request is refunded, a replay is free.
+		if w := do(r, "/messages?fail=1", false); w.Code != http.StatusBadRequest {
+			t.Fatalf("failing: %d", w.Code)
+		}
+		if w := do(r, "/messages", true); w.Code != http.StatusCreated {
+			t.Fatalf("replay: %d", w.Code)
+		}
+		if w := do(r, "/messages", false); w.Code != http.StatusCreated {
+			t.Fatalf("second: %d", w.Code)
+		}
+
+		w := do(r, "/messages", false)
+		if w.Code != http.StatusTooManyRequests {
+			t.Fatalf("third: %d", w.Code)
+		}
+		h := w.Header()
+		if h.Get(HeaderQuotaLimit) != "2" || h.Get(HeaderQuotaRemaining) != "0" || h.Get(HeaderQuotaScope) != "user:day" ||
+			h.Get(HeaderQuotaReset) != strconv.FormatInt(reset.Unix(), 10) {
+			t.Fatalf("quota headers = %v", h)
+		}
+		if ra, _ := strconv.Atoi(h.Get("Retry-After")); ra < 1 || ra > 91 {
+			t.Fatalf("Retry-After = %q", h.Get("Retry-After"))
+		}
+		if !strings.Contains(w.Body.String(), `"code":"quota_exceeded"`) {
+			t.Fatalf("body = %s", w.Body.String())
+		}
+		if q.used["default/alice/messages"] != 2 {
+			t.Fatalf("used = %v", q.used)
+		}
+	})
+
+	t.Run("fails open", func(t *testing.T) {
+		q := &fakeQuota{used: map[string]int{}, err: errors.New("db down")}
+		if w := do(newRouter(q), "/messages", false); w.Code != http.StatusCreated {
+			t.Fatalf("enforcer error must not block: %d", w.Code)
+		}
+	})
+}
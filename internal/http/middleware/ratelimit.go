@@ -1,30 +1,34 @@
 // Package middleware contains shared Gin middleware used by the HTTP layer.
 //
-// This file implements a lightweight, in-memory, token-bucket rate limiter
-// with per-identity buckets and opportunistic garbage collection. It is
-// designed for simplicity, low overhead, and predictable behavior in a
-// single-process deployment (e.g., a container or dev setup).
+// This file implements a token-bucket rate limiter with per-identity buckets
+// kept in a pluggable ratelimit.Store.
 //
 // Features:
-//   - Per-key token buckets using golang.org/x/time/rate
+//   - Per-key token buckets, in memory by default
+//   - Shared buckets across replicas (Redis) or across restarts (SQLite)
+//   - Local fallback when the shared store is unavailable
 //   - Pluggable identity function (user ID or client IP)
-//   - Best-effort cleanup of idle buckets to bound memory
 //   - Seamless bypass for idempotent replays (when paired with IdempotencyValidator)
 //
 // Notes:
-//   - This limiter is process-local. For horizontally scaled deployments,
-//     prefer a distributed limiter (e.g., Redis-backed) to enforce global limits.
+//   - With the default in-memory store, limits are per process: N replicas
+//     allow N times the configured rate, and buckets reset on restart.
 //   - The limiter is intended for edge-level abuse control and cost protection;
 //     it is not an authorization mechanism.
 package middleware
 
 import (
+	"context"
+	"math"
 	"net/http"
-	"sync"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/time/rate"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/tbourn/go-chat-backend/internal/ratelimit"
 )
 
 // keyFunc selects the identity used to key a rate-limit bucket.
@@ -51,29 +55,81 @@ func KeyByUserOrIP() keyFunc {
 	}
 }
 
-// visitor holds a single rate limiter and the last time it was seen.
-// Used to opportunistically evict idle buckets.
-type visitor struct {
-	limiter  *rate.Limiter
-	lastSeen time.Time
+// Rate-limit store health. Errors are counted per call; the gauge is 1 while
+// requests are being limited locally because the shared store failed.
+var (
+	rateStoreErrors = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "rate_limit_store_errors_total",
+			Help: "Rate-limit store calls that failed and fell back to local limiting.",
+		},
+	)
+	rateStoreDegraded = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "rate_limit_store_degraded",
+			Help: "1 while the shared rate-limit store is unavailable, else 0.",
+		},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(rateStoreErrors, rateStoreDegraded)
+}
+
+// Rate-limit response headers (IETF draft-ietf-httpapi-ratelimit-headers),
+// set on every limited response.
+const (
+	HeaderRateLimitLimit     = "RateLimit-Limit"     // bucket size of the route's policy
+	HeaderRateLimitRemaining = "RateLimit-Remaining" // tokens left after this request
+	HeaderRateLimitReset     = "RateLimit-Reset"     // seconds until the bucket is full again
+)
+
+// DefaultRatePolicy names the policy applied to routes without their own.
+const DefaultRatePolicy = "default"
+
+// RatePolicy is a named token-bucket limit. A request matching it spends Cost
+// tokens from the caller's bucket of Burst tokens, refilled at Rate tokens
+// per second. Every policy has its own buckets, so spending on one route
+// leaves the others' budgets untouched.
+type RatePolicy struct {
+	Name  string  // bucket namespace, e.g. "messages"
+	Rate  float64 // tokens per second
+	Burst int     // bucket size
+	Cost  int     // tokens per request
+}
+
+// normalize coerces a policy into a usable one: Cost and Burst at least 1,
+// and Burst at least Cost so the route can ever be served.
+func (p RatePolicy) normalize() RatePolicy {
+	p.Cost = max(p.Cost, 1)
+	p.Burst = max(p.Burst, p.Cost)
+	return p
+}
+
+func (p RatePolicy) limit() ratelimit.Limit {
+	return ratelimit.Limit{Rate: p.Rate, Burst: p.Burst}
 }
 
 // RateLimiter implements a per-key token-bucket rate limiter.
 //
-// Buckets are created on demand and stored in an internal map guarded by a
-// mutex. Idle buckets are evicted after a TTL via opportunistic cleanup during
-// lookups to keep memory usage bounded.
+// Each request is charged against the policy of its route (see WithPolicy),
+// or the default policy built from NewRateLimiter's arguments.
+//
+// Buckets live in a ratelimit.Store: process-local by default, or shared by
+// all replicas (see WithStore). When the shared store fails, the request is
+// checked against a local bucket instead, so limiting degrades to
+// per-process rather than failing open or closed.
 //
-// This type is safe for concurrent use.
+// This type is safe for concurrent use once installed.
 type RateLimiter struct {
-	rps      rate.Limit
-	burst    int
-	keyFn    keyFunc
-	mu       sync.Mutex
-	visitors map[string]*visitor
+	def    RatePolicy
+	routes map[string]RatePolicy // "METHOD /full/route/path" -> policy
+	keyFn  keyFunc
 
-	ttl      time.Duration
-	cleanupN uint64
+	store ratelimit.Store   // shared store; nil limits locally only
+	local *ratelimit.Memory // default and fallback buckets
+
+	degraded atomic.Bool
 }
 
 // NewRateLimiter constructs a RateLimiter with the given tokens-per-second
@@ -83,55 +139,85 @@ type RateLimiter struct {
 //   - burst: maximum burst size; values <= 0 are coerced to 1.
 //   - keyFn: function that maps a request to a bucket identity.
 //
-// The returned limiter is ready to be installed as middleware via Handler().
+// rps and burst form the default policy (cost 1). The returned limiter keeps
+// its buckets in memory and is ready to be installed as middleware via
+// Handler().
 func NewRateLimiter(rps float64, burst int, keyFn keyFunc) *RateLimiter {
-	if burst <= 0 {
-		burst = 1
-	}
 	return &RateLimiter{
-		rps:      rate.Limit(rps),
-		burst:    burst,
-		keyFn:    keyFn,
-		visitors: make(map[string]*visitor),
-		ttl:      10 * time.Minute, // evict idle entries after TTL
+		def:    RatePolicy{Name: DefaultRatePolicy, Rate: rps, Burst: burst, Cost: 1}.normalize(),
+		routes: make(map[string]RatePolicy),
+		keyFn:  keyFn,
+		local:  ratelimit.NewMemory(),
 	}
 }
 
-// getVisitor returns (and updates) the limiter for key, creating it if absent.
-// It also performs opportunistic GC of idle entries after ~5000 lookups.
-//
-// IMPORTANT: Run GC *before* touching the requested visitor so an "old" bucket
-// can be evicted even when it's the one being fetched.
-func (rl *RateLimiter) getVisitor(key string) *rate.Limiter {
-	now := time.Now()
-
-	rl.mu.Lock()
-	// Opportunistic cleanup after a threshold of lookups, then reset the counter.
-	// Do this BEFORE updating/creating the requested visitor to avoid
-	// refreshing an "old" entry that should be evicted.
-	rl.cleanupN++
-	if rl.cleanupN >= 5000 {
-		for k, vv := range rl.visitors {
-			// Evict if idle for >= TTL (robust boundary check)
-			if now.Sub(vv.lastSeen) >= rl.ttl {
-				delete(rl.visitors, k)
-			}
-		}
-		rl.cleanupN = 0
+// WithStore makes rl keep its buckets in store (e.g. ratelimit.Redis shared
+// by all replicas, or ratelimit.SQLite to survive restarts) and returns rl.
+// The in-memory buckets remain as the fallback. A nil store is ignored.
+func (rl *RateLimiter) WithStore(store ratelimit.Store) *RateLimiter {
+	rl.store = store
+	return rl
+}
+
+// WithPolicy applies p to the route registered as method and path (the full
+// Gin pattern, e.g. "/api/v1/chats/:id/messages") and returns rl. Cost and
+// Burst are coerced as by normalize. Call it before serving requests.
+func (rl *RateLimiter) WithPolicy(method, path string, p RatePolicy) *RateLimiter {
+	rl.routes[method+" "+path] = p.normalize()
+	return rl
+}
+
+// Local returns the in-memory buckets, e.g. for periodic Evict calls.
+func (rl *RateLimiter) Local() *ratelimit.Memory { return rl.local }
+
+// storeEvicter is implemented by shared stores whose idle buckets must be
+// removed explicitly (ratelimit.SQLite; Redis expires keys by itself).
+type storeEvicter interface {
+	Evict(ctx context.Context, now time.Time) (int64, error)
+}
+
+// Evict removes buckets that are full again at now from the local buckets
+// and, when it needs it, the shared store. It returns how many were removed.
+func (rl *RateLimiter) Evict(ctx context.Context, now time.Time) (int64, error) {
+	n := int64(rl.local.Evict(now))
+	if ev, ok := rl.store.(storeEvicter); ok {
+		m, err := ev.Evict(ctx, now)
+		return n + m, err
 	}
+	return n, nil
+}
 
-	// Fetch or create this visitor.
-	if v, ok := rl.visitors[key]; ok {
-		v.lastSeen = now
-		lim := v.limiter
-		rl.mu.Unlock()
-		return lim
+// policy returns the policy of the matched route.
+func (rl *RateLimiter) policy(c *gin.Context) RatePolicy {
+	if p, ok := rl.routes[c.Request.Method+" "+c.FullPath()]; ok {
+		return p
 	}
+	return rl.def
+}
 
-	lim := rate.NewLimiter(rl.rps, rl.burst)
-	rl.visitors[key] = &visitor{limiter: lim, lastSeen: now}
-	rl.mu.Unlock()
-	return lim
+// allow charges p.Cost to key's bucket of policy p in the shared store,
+// falling back to the local buckets when there is none or it fails. A zero
+// rate is only supported locally.
+func (rl *RateLimiter) allow(c *gin.Context, p RatePolicy, key string) ratelimit.Result {
+	ctx := c.Request.Context()
+	key = p.Name + ":" + key
+	if rl.store != nil && p.Rate > 0 {
+		res, err := rl.store.Allow(ctx, key, p.limit(), p.Cost)
+		if err == nil {
+			if rl.degraded.CompareAndSwap(true, false) {
+				rateStoreDegraded.Set(0)
+				LoggerFrom(c).Info().Msg("rate limit store recovered")
+			}
+			return res
+		}
+		rateStoreErrors.Inc()
+		if !rl.degraded.Swap(true) {
+			rateStoreDegraded.Set(1)
+			LoggerFrom(c).Warn().Err(err).Msg("rate limit store unavailable; limiting locally")
+		}
+	}
+	res, _ := rl.local.Allow(ctx, key, p.limit(), p.Cost) // never fails
+	return res
 }
 
 // IsRateBypass reports whether IdempotencyValidator marked this request for
@@ -152,9 +238,11 @@ func IsRateBypass(c *gin.Context) bool {
 //
 // Behavior:
 //   - If IsRateBypass(c) is true (idempotent replay), limiting is skipped.
-//   - Otherwise, the request is checked against the key’s limiter. If allowed,
-//     the request proceeds; if not, a 429 response is returned with a compact
-//     JSON body and a minimal Retry-After header.
+//   - Otherwise, the route's policy cost is charged to the key's bucket and
+//     the RateLimit-* headers describe that bucket. If allowed, the request
+//     proceeds; if not, a 429 response is returned with a compact JSON body
+//     and a Retry-After header: the wait until the bucket holds enough
+//     tokens, in whole seconds (at least 1).
 //
 // The middleware emits:
 //
@@ -171,15 +259,17 @@ func (rl *RateLimiter) Handler() gin.HandlerFunc {
 			return
 		}
 
-		key := rl.keyFn(c)
-		lim := rl.getVisitor(key)
-
-		if lim.Allow() {
+		res := rl.allow(c, rl.policy(c), rl.keyFn(c))
+		h := c.Writer.Header()
+		h.Set(HeaderRateLimitLimit, strconv.Itoa(res.Limit))
+		h.Set(HeaderRateLimitRemaining, strconv.Itoa(res.Remaining))
+		h.Set(HeaderRateLimitReset, strconv.Itoa(int(math.Ceil(res.ResetAfter.Seconds()))))
+		if res.Allowed {
 			c.Next()
 			return
 		}
 
-		c.Header("Retry-After", "1")
+		c.Header("Retry-After", strconv.Itoa(retryAfterSeconds(res.RetryAfter)))
 		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
 			"request_id": c.Writer.Header().Get("X-Request-ID"),
 			"code":       "rate_limited",
@@ -187,3 +277,9 @@ func (rl *RateLimiter) Handler() gin.HandlerFunc {
 		})
 	}
 }
+
+// retryAfterSeconds rounds d up to whole seconds for Retry-After, never
+// advertising less than one second.
+func retryAfterSeconds(d time.Duration) int {
+	return max(int(math.Ceil(d.Seconds())), 1)
+}
@@ -1,16 +1,21 @@
 package middleware
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/time/rate"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/tbourn/go-chat-backend/internal/ratelimit"
 )
 
 func TestKeyByUserOrIP(t *testing.T) {
@@ -38,51 +43,205 @@ func TestKeyByUserOrIP(t *testing.T) {
 	}
 }
 
-func TestNewRateLimiter_BurstCoercion_AndGetVisitorReuse(t *testing.T) {
+func TestNewRateLimiter_BurstCoercion(t *testing.T) {
 	rl := NewRateLimiter(2.0, 0, KeyByUserOrIP()) // burst<=0 coerced to 1
-	if rl.burst != 1 {
-		t.Fatalf("burst coercion failed, got %d", rl.burst)
+	if rl.def != (RatePolicy{Name: DefaultRatePolicy, Rate: 2, Burst: 1, Cost: 1}) {
+		t.Fatalf("burst coercion failed, got %+v", rl.def)
+	}
+	rl.WithPolicy(http.MethodPost, "/x", RatePolicy{Name: "x", Rate: 1, Burst: 2, Cost: 5})
+	if p := rl.routes["POST /x"]; p.Burst != 5 || p.Cost != 5 {
+		t.Fatalf("policy burst must cover cost, got %+v", p)
+	}
+	if rl.store != nil || rl.Local() == nil {
+		t.Fatalf("expected in-memory buckets by default")
+	}
+}
+
+// flakyStore is a ratelimit.Store that fails while down is set and
+// otherwise allows everything.
+type flakyStore struct {
+	down  atomic.Bool
+	calls atomic.Int64
+}
+
+func (s *flakyStore) Allow(_ context.Context, _ string, l ratelimit.Limit, _ int) (ratelimit.Result, error) {
+	s.calls.Add(1)
+	if s.down.Load() {
+		return ratelimit.Result{}, errors.New("connection refused")
+	}
+	return ratelimit.Result{Allowed: true, Limit: l.Burst, Remaining: l.Burst}, nil
+}
+
+func TestRateLimiter_StoreFallback(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := &flakyStore{}
+	rl := NewRateLimiter(1.0, 1, KeyByUserOrIP()).WithStore(store)
+
+	r := gin.New()
+	r.Use(rl.Handler())
+	r.GET("/ok", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	get := func() int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ok", nil))
+		return w.Code
+	}
+
+	// The shared store decides while it is up (it allows everything here).
+	for i := 0; i < 3; i++ {
+		if code := get(); code != http.StatusOK {
+			t.Fatalf("store up: request %d got %d", i, code)
+		}
+	}
+	if rl.Local().Len() != 0 {
+		t.Fatalf("local buckets used while store is up")
+	}
+
+	// Store down: local limiting with the same limits.
+	store.down.Store(true)
+	errsBefore := testutil.ToFloat64(rateStoreErrors)
+	if code := get(); code != http.StatusOK {
+		t.Fatalf("degraded: first request got %d", code)
+	}
+	if code := get(); code != http.StatusTooManyRequests {
+		t.Fatalf("degraded: second request got %d", code)
+	}
+	if !rl.degraded.Load() || testutil.ToFloat64(rateStoreDegraded) != 1 {
+		t.Fatalf("expected degraded state")
+	}
+	if got := testutil.ToFloat64(rateStoreErrors) - errsBefore; got != 2 {
+		t.Fatalf("store errors counted = %v", got)
 	}
 
-	// First call creates limiter
-	lim := rl.getVisitor("k1")
-	if lim == nil {
-		t.Fatalf("expected limiter")
+	// Recovery switches back to the store.
+	store.down.Store(false)
+	if code := get(); code != http.StatusOK {
+		t.Fatalf("recovered: got %d", code)
+	}
+	if rl.degraded.Load() || testutil.ToFloat64(rateStoreDegraded) != 0 {
+		t.Fatalf("expected recovered state")
 	}
-	// Second call reuses same limiter (pointer equality via map lookup)
-	if got := rl.getVisitor("k1"); got != lim {
-		t.Fatalf("expected same limiter instance to be reused")
+	if store.calls.Load() != 6 {
+		t.Fatalf("store calls = %d", store.calls.Load())
 	}
 }
 
-func TestRateLimiter_getVisitor_GC(t *testing.T) {
-	rl := NewRateLimiter(1.0, 1, KeyByUserOrIP())
-	// Make TTL immediate so anything old gets evicted
-	rl.ttl = 1 * time.Nanosecond
+func TestRateLimiter_SharedStore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	// Two replicas sharing one store enforce a single limit.
+	store := ratelimit.NewMemory()
+	a := NewRateLimiter(0.5, 2, KeyByUserOrIP()).WithStore(store)
+	b := NewRateLimiter(0.5, 2, KeyByUserOrIP()).WithStore(store)
 
-	// Seed an old visitor
-	rl.mu.Lock()
-	rl.visitors["old"] = &visitor{
-		limiter:  rate.NewLimiter(1, 1),
-		lastSeen: time.Now().Add(-time.Hour),
+	codes := []int{}
+	for _, rl := range []*RateLimiter{a, b, a} {
+		r := gin.New()
+		r.Use(rl.Handler())
+		r.GET("/ok", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ok", nil))
+		codes = append(codes, w.Code)
+		if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") != "2" {
+			t.Fatalf("Retry-After = %q", w.Header().Get("Retry-After"))
+		}
+	}
+	if codes[0] != 200 || codes[1] != 200 || codes[2] != 429 {
+		t.Fatalf("codes = %v", codes)
 	}
-	// Force cleanup to run on next getVisitor by setting cleanupN to 4999
-	rl.cleanupN = 4999
-	rl.mu.Unlock()
+}
+
+// evictingStore is a shared store that needs explicit eviction.
+type evictingStore struct {
+	*ratelimit.Memory
+	evictedAt time.Time
+}
 
-	// Trigger cleanup by calling getVisitor for a different key
-	_ = rl.getVisitor("new")
+func (s *evictingStore) Evict(_ context.Context, now time.Time) (int64, error) {
+	s.evictedAt = now
+	return 2, nil
+}
 
-	rl.mu.Lock()
-	_, existsOld := rl.visitors["old"]
-	_, existsNew := rl.visitors["new"]
-	rl.mu.Unlock()
+func TestRateLimiter_Evict(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	ctx := context.Background()
+	later := time.Now().Add(time.Hour)
+
+	local := NewRateLimiter(1, 1, KeyByUserOrIP())
+	r := gin.New()
+	r.Use(local.Handler())
+	r.GET("/ok", func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/ok", nil))
+	if n, err := local.Evict(ctx, later); n != 1 || err != nil || local.Local().Len() != 0 {
+		t.Fatalf("local Evict = %d, %v (len %d)", n, err, local.Local().Len())
+	}
 
-	if existsOld {
-		t.Fatalf("expected 'old' visitor to be evicted by opportunistic GC")
+	store := &evictingStore{Memory: ratelimit.NewMemory()}
+	shared := NewRateLimiter(1, 1, KeyByUserOrIP()).WithStore(store)
+	if n, err := shared.Evict(ctx, later); n != 2 || err != nil || !store.evictedAt.Equal(later) {
+		t.Fatalf("shared Evict = %d, %v", n, err)
+	}
+	// Stores without Evict (Redis, Memory) are left alone.
+	if n, err := NewRateLimiter(1, 1, KeyByUserOrIP()).WithStore(ratelimit.NewMemory()).Evict(ctx, later); n != 0 || err != nil {
+		t.Fatalf("plain store Evict = %d, %v", n, err)
 	}
-	if !existsNew {
-		t.Fatalf("expected 'new' visitor to be created")
+}
+
+func TestRateLimiter_RoutePolicies_Headers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rl := NewRateLimiter(1, 10, KeyByUserOrIP()).
+		WithPolicy(http.MethodPost, "/chats/:id/messages", RatePolicy{Name: "messages", Rate: 1, Burst: 10, Cost: 5})
+
+	r := gin.New()
+	r.Use(rl.Handler())
+	r.GET("/chats", func(c *gin.Context) { c.String(http.StatusOK, "ok") })
+	r.POST("/chats/:id/messages", func(c *gin.Context) { c.String(http.StatusCreated, "ok") })
+	do := func(method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	// Posting costs 5 of the messages bucket's 10 tokens.
+	w := do(http.MethodPost, "/chats/1/messages")
+	if w.Code != http.StatusCreated || w.Header().Get(HeaderRateLimitLimit) != "10" ||
+		w.Header().Get(HeaderRateLimitRemaining) != "5" || w.Header().Get(HeaderRateLimitReset) != "5" {
+		t.Fatalf("first post: %d %v", w.Code, w.Header())
+	}
+	if w = do(http.MethodPost, "/chats/2/messages"); w.Code != http.StatusCreated || w.Header().Get(HeaderRateLimitRemaining) != "0" {
+		t.Fatalf("second post: %d %v", w.Code, w.Header())
+	}
+	w = do(http.MethodPost, "/chats/1/messages")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("third post should be limited, got %d", w.Code)
+	}
+	// Five tokens at one per second: wait about five seconds, not one.
+	if got := w.Header().Get("Retry-After"); got != "5" {
+		t.Fatalf("Retry-After = %q", got)
+	}
+	if w.Header().Get(HeaderRateLimitRemaining) != "0" || w.Header().Get(HeaderRateLimitReset) != "10" {
+		t.Fatalf("429 headers: %v", w.Header())
+	}
+
+	// Listing uses the default bucket, untouched by the posts.
+	w = do(http.MethodGet, "/chats")
+	if w.Code != http.StatusOK || w.Header().Get(HeaderRateLimitLimit) != "10" || w.Header().Get(HeaderRateLimitRemaining) != "9" {
+		t.Fatalf("list: %d %v", w.Code, w.Header())
+	}
+	if rl.Local().Len() != 2 {
+		t.Fatalf("expected one bucket per policy, got %d", rl.Local().Len())
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	for d, want := range map[time.Duration]int{
+		0:                       1,
+		300 * time.Millisecond:  1,
+		time.Second:             1,
+		1001 * time.Millisecond: 2,
+		90 * time.Second:        90,
+	} {
+		if got := retryAfterSeconds(d); got != want {
+			t.Fatalf("retryAfterSeconds(%v) = %d, want %d", d, got, want)
+		}
 	}
 }
 
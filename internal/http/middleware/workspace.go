@@ -0,0 +1,112 @@
+// Package middleware contains shared Gin middleware used by the HTTP layer.
+//
+// This file selects the workspace (tenant) a request acts in. Clients pick a
+// workspace with the "X-Workspace-ID" header; without it, requests act in the
+// default workspace every user belongs to. The middleware runs after
+// authentication, checks that the caller is a member, and stores the
+// workspace ID and the caller's role in the Gin context for handlers (and for
+// the idempotency lookup) to scope their queries by.
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+)
+
+// HeaderWorkspaceID is the request header selecting the workspace.
+const HeaderWorkspaceID = "X-Workspace-ID"
+
+// ContextKeyWorkspaceID is the Gin context key holding the selected
+// workspace ID.
+const ContextKeyWorkspaceID = "workspaceID"
+
+// ContextKeyWorkspaceRole is the Gin context key holding the caller's role in
+// the selected workspace (domain.WorkspaceRoleOwner or WorkspaceRoleMember).
+const ContextKeyWorkspaceRole = "workspaceRole"
+
+// WorkspaceResolver returns the caller's role in a workspace. ok is false when
+// the workspace does not exist or the caller is not a member; a non-nil error
+// is treated as a server failure.
+type WorkspaceResolver interface {
+	WorkspaceRole(ctx context.Context, userID string, admin bool, workspaceID string) (role string, ok bool, err error)
+}
+
+// WorkspaceOptions configures Workspace.
+type WorkspaceOptions struct {
+	// Skip exempts requests (e.g. health checks) from workspace selection.
+	Skip func(*gin.Context) bool
+
+	// Fail writes the error response and aborts. It defaults to the standard
+	// error envelope (see failWorkspace).
+	Fail func(c *gin.Context, status int, code, message string)
+}
+
+// Workspace returns a middleware that resolves the X-Workspace-ID header.
+// Requests without it act in domain.DefaultWorkspaceID without a lookup.
+// Malformed IDs get 400, workspaces the caller cannot see 404 (so other
+// tenants' workspaces are indistinguishable from missing ones), and resolver
+// failures 503.
+func Workspace(res WorkspaceResolver, opts WorkspaceOptions) gin.HandlerFunc {
+	fail := opts.Fail
+	if fail == nil {
+		fail = failWorkspace
+	}
+	return func(c *gin.Context) {
+		if opts.Skip != nil && opts.Skip(c) {
+			c.Next()
+			return
+		}
+		id := strings.TrimSpace(c.GetHeader(HeaderWorkspaceID))
+		if id == "" || id == domain.DefaultWorkspaceID {
+			c.Set(ContextKeyWorkspaceID, domain.DefaultWorkspaceID)
+			if c.GetBool(ContextKeyAdmin) {
+				c.Set(ContextKeyWorkspaceRole, domain.WorkspaceRoleOwner)
+			} else {
+				c.Set(ContextKeyWorkspaceRole, domain.WorkspaceRoleMember)
+			}
+			c.Next()
+			return
+		}
+		if _, err := uuid.Parse(id); err != nil {
+			fail(c, http.StatusBadRequest, "bad_request", "invalid "+HeaderWorkspaceID)
+			return
+		}
+		role, ok, err := res.WorkspaceRole(c.Request.Context(), userIDFromCtx(c), c.GetBool(ContextKeyAdmin), id)
+		if err != nil {
+			LoggerFrom(c).Error().Err(err).Msg("workspace lookup failed")
+			fail(c, http.StatusServiceUnavailable, "internal_error", "workspace lookup temporarily unavailable")
+			return
+		}
+		if !ok {
+			fail(c, http.StatusNotFound, "not_found", "workspace not found")
+			return
+		}
+		c.Set(ContextKeyWorkspaceID, id)
+		c.Set(ContextKeyWorkspaceRole, role)
+		c.Next()
+	}
+}
+
+// WorkspaceID returns the workspace selected for the request, or
+// domain.DefaultWorkspaceID when Workspace did not run.
+func WorkspaceID(c *gin.Context) string {
+	if id := c.GetString(ContextKeyWorkspaceID); id != "" {
+		return id
+	}
+	return domain.DefaultWorkspaceID
+}
+
+// failWorkspace writes the default workspace error envelope.
+func failWorkspace(c *gin.Context, status int, code, message string) {
+	c.AbortWithStatusJSON(status, gin.H{
+		"request_id": c.Writer.Header().Get("X-Request-ID"),
+		"code":       code,
+		"message":    message,
+	})
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	testWorkspaceA = "6f1c2d3e-0000-4000-8000-00000000000a"
+	testWorkspaceB = "6f1c2d3e-0000-4000-8000-00000000000b"
+)
+
+// fakeWorkspaces makes "alice" the owner of workspace A; admins own every
+// workspace. A non-nil err fails every lookup.
+type fakeWorkspaces struct{ err error }
+
+func (f fakeWorkspaces) WorkspaceRole(_ context.Context, userID string, admin bool, id string) (string, bool, error) {
+	switch {
+	case f.err != nil:
+		return "", false, f.err
+	case admin:
+		return "owner", true, nil
+	case id == testWorkspaceA && userID == "alice":
+		return "owner", true, nil
+	}
+	return "", false, nil
+}
+
+func TestWorkspace(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(res WorkspaceResolver, user string, admin bool) *gin.Engine {
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			c.Set(ContextKeyUserID, user)
+			c.Set(ContextKeyAdmin, admin)
+		})
+		r.Use(Workspace(res, WorkspaceOptions{Skip: func(c *gin.Context) bool { return c.Request.URL.Path == "/health" }}))
+		handler := func(c *gin.Context) {
+			c.String(http.StatusOK, "%s %s", WorkspaceID(c), c.GetString(ContextKeyWorkspaceRole))
+		}
+		r.GET("/chats", handler)
+		r.GET("/health", handler)
+		return r
+	}
+
+	cases := []struct {
+		name     string
+		res      WorkspaceResolver
+		user     string
+		admin    bool
+		path     string
+		header   string
+		want     int
+		wantBody string
+	}{
+		{"no header is the default workspace", fakeWorkspaces{}, "bob", false, "/chats", "", http.StatusOK, "default member"},
+		{"explicit default", fakeWorkspaces{}, "root", true, "/chats", "default", http.StatusOK, "default owner"},
+		{"member", fakeWorkspaces{}, "alice", false, "/chats", testWorkspaceA, http.StatusOK, testWorkspaceA + " owner"},
+		{"admin", fakeWorkspaces{}, "root", true, "/chats", testWorkspaceB, http.StatusOK, testWorkspaceB + " owner"},
+		{"non-member", fakeWorkspaces{}, "alice", false, "/chats", testWorkspaceB, http.StatusNotFound, `"code":"not_found"`},
+		{"malformed id", fakeWorkspaces{}, "alice", false, "/chats", "../x", http.StatusBadRequest, `"code":"bad_request"`},
+		{"resolver down", fakeWorkspaces{err: errors.New("db down")}, "alice", false, "/chats", testWorkspaceA, http.StatusServiceUnavailable, `"code":"internal_error"`},
+		{"skipped", fakeWorkspaces{}, "alice", false, "/health", testWorkspaceB, http.StatusOK, "default "},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.header != "" {
+				req.Header.Set(HeaderWorkspaceID, tc.header)
+			}
+			newRouter(tc.res, tc.user, tc.admin).ServeHTTP(w, req)
+			if w.Code != tc.want {
+				t.Fatalf("status = %d; want %d (body=%s)", w.Code, tc.want, w.Body.String())
+			}
+			if !strings.Contains(w.Body.String(), tc.wantBody) {
+				t.Fatalf("body = %s; want %s", w.Body.String(), tc.wantBody)
+			}
+		})
+	}
+}
@@ -12,16 +12,24 @@ package httpapi
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/tbourn/go-chat-backend/internal/auth"
 	"github.com/tbourn/go-chat-backend/internal/config"
 	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/generator"
 	"github.com/tbourn/go-chat-backend/internal/http/handlers"
 	"github.com/tbourn/go-chat-backend/internal/http/middleware"
+	"github.com/tbourn/go-chat-backend/internal/maintenance"
+	"github.com/tbourn/go-chat-backend/internal/pagination"
+	"github.com/tbourn/go-chat-backend/internal/ratelimit"
 	"github.com/tbourn/go-chat-backend/internal/repo"
 	"github.com/tbourn/go-chat-backend/internal/search"
 	"github.com/tbourn/go-chat-backend/internal/services"
@@ -30,39 +38,222 @@ import (
 	"gorm.io/gorm"
 )
 
+// rateLimitStore builds the shared rate-limit store selected by RATE_STORE,
+// or nil to keep buckets in process memory.
+func rateLimitStore(cfg config.RateStoreConfig, db *gorm.DB) ratelimit.Store {
+	switch cfg.Kind {
+	case "redis":
+		return ratelimit.NewRedis(cfg.RedisAddr, cfg.RedisPassword, cfg.RedisDB, cfg.Timeout)
+	case "sqlite":
+		return ratelimit.NewSQLite(db)
+	}
+	return nil
+}
+
+// routePolicy assigns a rate-limit policy to a route of the public API.
+type routePolicy struct {
+	method, path string // path relative to the API base path
+	policy       middleware.RatePolicy
+}
+
+// ratePolicies declares the routes with their own rate-limit buckets and
+// costs. All other routes share the default policy (RATE_RPS/RATE_BURST,
+// one token per request).
+func ratePolicies(cfg config.Config) []routePolicy {
+	messages := middleware.RatePolicy{Name: "messages", Rate: cfg.RateRPS, Burst: cfg.RateBurst, Cost: cfg.RateMessageCost}
+	shared := middleware.RatePolicy{Name: "shared", Rate: cfg.SharedRateRPS, Burst: cfg.SharedRateBurst, Cost: 1}
+	return []routePolicy{
+		{http.MethodPost, "/chats/:id/messages", messages},
+		{http.MethodPost, "/chats/:id/messages:stream", messages},
+		{http.MethodPut, "/messages/:id", messages},
+		{http.MethodGet, "/shared/:token", shared},
+	}
+}
+
 // chatRepoShim adapts the repository free functions to the services.ChatRepo
 // interface expected by the ChatService. This keeps services decoupled from
 // the concrete repo package while reusing existing functions.
 type chatRepoShim struct{}
 
 // CreateChat proxies repo.CreateChat.
-func (chatRepoShim) CreateChat(ctx context.Context, db *gorm.DB, userID, title string) (*domain.Chat, error) {
-	return repo.CreateChat(ctx, db, userID, title)
+func (chatRepoShim) CreateChat(ctx context.Context, db *gorm.DB, workspaceID, userID, title string) (*domain.Chat, error) {
+	return repo.CreateChat(ctx, db, workspaceID, userID, title)
 }
 
 // ListChats proxies repo.ListChats.
-func (chatRepoShim) ListChats(ctx context.Context, db *gorm.DB, userID string) ([]domain.Chat, error) {
-	return repo.ListChats(ctx, db, userID)
+func (chatRepoShim) ListChats(ctx context.Context, db *gorm.DB, workspaceID, userID string) ([]domain.Chat, error) {
+	return repo.ListChats(ctx, db, workspaceID, userID)
 }
 
-// GetChat proxies repo.GetChat.
-func (chatRepoShim) GetChat(ctx context.Context, db *gorm.DB, id, userID string) (*domain.Chat, error) {
-	return repo.GetChat(ctx, db, id, userID)
+// FindChat proxies repo.FindChat.
+func (chatRepoShim) FindChat(ctx context.Context, db *gorm.DB, workspaceID, id string) (*domain.Chat, error) {
+	return repo.FindChat(ctx, db, workspaceID, id)
+}
+
+// IsChatSharedWith proxies repo.IsChatSharedWith.
+func (chatRepoShim) IsChatSharedWith(ctx context.Context, db *gorm.DB, chatID, userID string) (bool, error) {
+	return repo.IsChatSharedWith(ctx, db, chatID, userID)
 }
 
 // UpdateChatTitle proxies repo.UpdateChatTitle.
-func (chatRepoShim) UpdateChatTitle(ctx context.Context, db *gorm.DB, id, userID, title string) error {
-	return repo.UpdateChatTitle(ctx, db, id, userID, title)
+func (chatRepoShim) UpdateChatTitle(ctx context.Context, db *gorm.DB, workspaceID, id, userID, title string, version int64) error {
+	return repo.UpdateChatTitle(ctx, db, workspaceID, id, userID, title, version)
 }
 
 // CountChats proxies repo.CountChats (pagination support).
-func (chatRepoShim) CountChats(ctx context.Context, db *gorm.DB, userID string) (int64, error) {
-	return repo.CountChats(ctx, db, userID)
+func (chatRepoShim) CountChats(ctx context.Context, db *gorm.DB, workspaceID, userID string) (int64, error) {
+	return repo.CountChats(ctx, db, workspaceID, userID)
 }
 
 // ListChatsPage proxies repo.ListChatsPage (pagination support).
-func (chatRepoShim) ListChatsPage(ctx context.Context, db *gorm.DB, userID string, offset, limit int) ([]domain.Chat, error) {
-	return repo.ListChatsPage(ctx, db, userID, offset, limit)
+func (chatRepoShim) ListChatsPage(ctx context.Context, db *gorm.DB, workspaceID, userID string, offset, limit int) ([]domain.Chat, error) {
+	return repo.ListChatsPage(ctx, db, workspaceID, userID, offset, limit)
+}
+
+// ListChatsKeyset proxies repo.ListChatsKeyset (cursor pagination).
+func (chatRepoShim) ListChatsKeyset(ctx context.Context, db *gorm.DB, workspaceID, userID string, p pagination.Page) ([]domain.Chat, bool, error) {
+	return repo.ListChatsKeyset(ctx, db, workspaceID, userID, p)
+}
+
+// DeleteChat proxies repo.DeleteChat.
+func (chatRepoShim) DeleteChat(ctx context.Context, db *gorm.DB, workspaceID, id, userID string, version int64, at time.Time) error {
+	return repo.DeleteChat(ctx, db, workspaceID, id, userID, version, at)
+}
+
+// FindDeletedChat proxies repo.FindDeletedChat.
+func (chatRepoShim) FindDeletedChat(ctx context.Context, db *gorm.DB, workspaceID, id string) (*domain.Chat, error) {
+	return repo.FindDeletedChat(ctx, db, workspaceID, id)
+}
+
+// RestoreChat proxies repo.RestoreChat.
+func (chatRepoShim) RestoreChat(ctx context.Context, db *gorm.DB, workspaceID, id, userID string, deletedAt time.Time) error {
+	return repo.RestoreChat(ctx, db, workspaceID, id, userID, deletedAt)
+}
+
+// ShareChat proxies repo.ShareChat.
+func (chatRepoShim) ShareChat(ctx context.Context, db *gorm.DB, chatID, userID string) error {
+	return repo.ShareChat(ctx, db, chatID, userID)
+}
+
+// UnshareChat proxies repo.UnshareChat.
+func (chatRepoShim) UnshareChat(ctx context.Context, db *gorm.DB, chatID, userID string) error {
+	return repo.UnshareChat(ctx, db, chatID, userID)
+}
+
+// ListChatShares proxies repo.ListChatShares.
+func (chatRepoShim) ListChatShares(ctx context.Context, db *gorm.DB, chatID string) ([]domain.ChatShare, error) {
+	return repo.ListChatShares(ctx, db, chatID)
+}
+
+// apiKeyVerifier adapts services.APIKeyService to middleware.APIKeyVerifier.
+type apiKeyVerifier struct{ svc *services.APIKeyService }
+
+// VerifyAPIKey resolves key to the owning user and the key's scopes.
+func (v apiKeyVerifier) VerifyAPIKey(ctx context.Context, key string) (middleware.APIKeyPrincipal, error) {
+	k, err := v.svc.Verify(ctx, key)
+	if err != nil {
+		return middleware.APIKeyPrincipal{}, err
+	}
+	return middleware.APIKeyPrincipal{KeyID: k.ID, UserID: k.UserID, Scopes: k.ScopeList()}, nil
+}
+
+// workspaceResolver adapts services.WorkspaceService to
+// middleware.WorkspaceResolver.
+type workspaceResolver struct{ svc *services.WorkspaceService }
+
+// WorkspaceRole returns the caller's role in workspaceID; ok is false for
+// workspaces the caller cannot see.
+func (w workspaceResolver) WorkspaceRole(ctx context.Context, userID string, admin bool, workspaceID string) (string, bool, error) {
+	role, err := w.svc.Role(ctx, services.Caller{UserID: userID, Admin: admin}, workspaceID)
+	if errors.Is(err, services.ErrWorkspaceNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return role, true, nil
+}
+
+// quotaEnforcer adapts services.QuotaService to middleware.QuotaEnforcer.
+type quotaEnforcer struct{ svc *services.QuotaService }
+
+// ConsumeQuota counts one unit of metric; exceeded quotas are reported as a
+// *middleware.QuotaExceeded rather than an error.
+func (q quotaEnforcer) ConsumeQuota(ctx context.Context, workspaceID, userID, metric string) ([]domain.UsageCounter, *middleware.QuotaExceeded, error) {
+	counters, err := q.svc.Consume(ctx, services.Caller{UserID: userID, WorkspaceID: workspaceID}, metric)
+	var qe *services.QuotaError
+	if errors.As(err, &qe) {
+		return nil, &middleware.QuotaExceeded{Scope: qe.Scope, Period: qe.Period, Message: qe.Error(), Limit: qe.Limit, Reset: qe.ResetAt}, nil
+	}
+	return counters, nil, err
+}
+
+// RefundQuota gives back a unit counted by ConsumeQuota.
+func (q quotaEnforcer) RefundQuota(ctx context.Context, counters []domain.UsageCounter) error {
+	return q.svc.Refund(ctx, counters)
+}
+
+// idempotencyStore adapts the repo idempotency records to
+// middleware.IdempotencyStore; headers are stored as JSON.
+type idempotencyStore struct{ db *gorm.DB }
+
+// record converts req to an idempotency record expiring after ttl.
+func (s idempotencyStore) record(req middleware.IdempotencyRequest, state string, ttl time.Duration) *domain.Idempotency {
+	return &domain.Idempotency{
+		WorkspaceID: req.WorkspaceID,
+		UserID:      req.UserID,
+		Key:         req.Key,
+		ChatID:      req.ChatID,
+		Fingerprint: req.Fingerprint,
+		State:       state,
+		ExpiresAt:   time.Now().UTC().Add(ttl),
+	}
+}
+
+// BeginIdempotent claims req's key for lease, or returns the record holding it.
+func (s idempotencyStore) BeginIdempotent(ctx context.Context, req middleware.IdempotencyRequest, lease time.Duration) (*middleware.IdempotentResponse, bool, error) {
+	prev, claimed, err := repo.BeginIdempotency(ctx, s.db, s.record(req, domain.IdempotencyInFlight, lease), time.Now().UTC())
+	if err != nil || claimed {
+		return nil, claimed, err
+	}
+	resp := &middleware.IdempotentResponse{
+		Fingerprint: prev.Fingerprint,
+		InFlight:    prev.State == domain.IdempotencyInFlight,
+		Status:      prev.Status,
+		Body:        prev.Body,
+	}
+	if prev.Header != "" {
+		if err := json.Unmarshal([]byte(prev.Header), &resp.Header); err != nil {
+			return nil, false, err
+		}
+	}
+	return resp, false, nil
+}
+
+// CompleteIdempotent stores the response of a claimed request for ttl.
+func (s idempotencyStore) CompleteIdempotent(ctx context.Context, req middleware.IdempotencyRequest, resp middleware.IdempotentResponse, ttl time.Duration) error {
+	header, err := json.Marshal(resp.Header)
+	if err != nil {
+		return err
+	}
+	rec := s.record(req, domain.IdempotencyCompleted, ttl)
+	rec.Status, rec.Header, rec.Body = resp.Status, string(header), resp.Body
+	return repo.CompleteIdempotency(ctx, s.db, rec)
+}
+
+// ReleaseIdempotent drops the in-flight claim of req.
+func (s idempotencyStore) ReleaseIdempotent(ctx context.Context, req middleware.IdempotencyRequest) error {
+	return repo.ReleaseIdempotency(ctx, s.db, req.WorkspaceID, req.UserID, req.Key, req.Fingerprint)
+}
+
+// quotaLimits converts configured limits to the domain type.
+func quotaLimits(l config.QuotaLimits) domain.QuotaLimits {
+	return domain.QuotaLimits{
+		MessagesPerDay:   int64(l.MessagesPerDay),
+		MessagesPerMonth: int64(l.MessagesPerMonth),
+		ChatsPerDay:      int64(l.ChatsPerDay),
+		ChatsPerMonth:    int64(l.ChatsPerMonth),
+	}
 }
 
 // RegisterRoutes attaches all middleware and HTTP endpoints to the given Gin
@@ -77,10 +268,17 @@ func (chatRepoShim) ListChatsPage(ctx context.Context, db *gorm.DB, userID strin
 //  4. Recovery: capture panics after logger
 //  5. Body size limiter
 //  6. Metrics
-//  7. Idempotency validator (before rate limiter to allow bypass on replay)
-//  8. Rate limiter (per user/IP, bypass on replay)
-//  9. CORS and Security headers
-func RegisterRoutes(r *gin.Engine, db *gorm.DB, idx search.Index, cfg config.Config) {
+//  7. Authentication (X-API-Key, then JWT or X-User-ID in development)
+//  8. Workspace selection (X-Workspace-ID, membership check)
+//  9. CORS and Security headers (also on replayed and rejected responses)
+//  10. Idempotency (replays cached responses; before rate limiter to bypass it)
+//  11. Rate limiter (per user/IP and route policy, bypass on replay)
+//     (usage quotas are per route, after the scope check)
+//
+// idx is the default corpus; corpora resolves per-workspace corpora and may
+// be nil to disable them. It returns the maintenance jobs of the components
+// it built (rate limiter eviction) for the caller to schedule.
+func RegisterRoutes(r *gin.Engine, db *gorm.DB, idx search.Index, corpora services.CorpusIndexes, cfg config.Config) []maintenance.Job {
 	r.HandleMethodNotAllowed = true
 
 	// 1) Trace all HTTP requests
@@ -99,32 +297,38 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB, idx search.Index, cfg config.Con
 	// 4) Panic recovery to JSON 500 (with request id)
 	r.Use(middleware.Recovery())
 
-	// 5) Global body size limit (1 MiB)
-	r.Use(limitBody(1 << 20))
+	// 5) Body size limit (1 MiB; chat imports have their own)
+	apiPrefix := strings.TrimSuffix(cfg.APIBasePath, "/")
+	r.Use(limitBody(1<<20, map[string]int64{
+		apiPrefix + "/chats/import": cfg.ImportMaxBytes,
+	}))
 
 	// 6) Prometheus metrics and /metrics endpoint
 	r.Use(middleware.Metrics())
 	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
 
-	// 7) Idempotency validation (before rate limiting)
-	r.Use(middleware.IdempotencyValidator(
-		middleware.IdempotencyOptions{
-			MaxLen: 200,
-		},
-		func(ctx context.Context, userID, chatID, key string, now time.Time) (bool, error) {
-			rec, err := repo.GetIdempotency(ctx, db, userID, chatID, key, now)
-			if err != nil || rec == nil {
-				return false, nil
-			}
-			return true, nil
-		},
-	))
+	// 7) Caller identity; idempotency and rate limiting are keyed by it
+	apiKeySvc := services.NewAPIKeyService(db)
+	r.Use(authMiddleware(cfg, apiKeyVerifier{apiKeySvc})...)
 
-	// 8) Token-bucket rate limiter per user/IP
-	rl := middleware.NewRateLimiter(cfg.RateRPS, cfg.RateBurst, middleware.KeyByUserOrIP())
-	r.Use(rl.Handler())
+	// 8) Workspace (tenant) the request acts in
+	wsSvc := services.NewWorkspaceService(db, corpora)
+	r.Use(middleware.Workspace(workspaceResolver{wsSvc}, middleware.WorkspaceOptions{
+		Skip: authExempt(cfg),
+		Fail: handlers.Fail,
+	}))
 
 	// 9) CORS posture (safe defaults: allow all if none configured)
+	allowHeaders := []string{
+		"Origin", "Content-Type", "Accept", "Authorization", "X-User-ID", "If-Match", "If-None-Match",
+		middleware.HeaderIdempotencyKey, middleware.HeaderWorkspaceID,
+	}
+	exposeHeaders := []string{
+		"X-Request-ID", "Content-Length", "Retry-After", "ETag",
+		middleware.HeaderRateLimitLimit, middleware.HeaderRateLimitRemaining, middleware.HeaderRateLimitReset,
+		middleware.HeaderQuotaLimit, middleware.HeaderQuotaRemaining, middleware.HeaderQuotaReset, middleware.HeaderQuotaScope,
+		middleware.HeaderIdempotencyReplayed,
+	}
 	if len(cfg.CORS.AllowedOrigins) == 0 {
 		// Force ACAO: * even for requests without an Origin header (helps tests and simple health checks).
 		r.Use(func(c *gin.Context) {
@@ -134,8 +338,8 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB, idx search.Index, cfg config.Con
 		r.Use(cors.New(cors.Config{
 			AllowAllOrigins:  true,
 			AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-			AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-User-ID", middleware.HeaderIdempotencyKey},
-			ExposeHeaders:    []string{"X-Request-ID", "Content-Length"},
+			AllowHeaders:     allowHeaders,
+			ExposeHeaders:    exposeHeaders,
 			AllowCredentials: false, // must remain false with AllowAllOrigins
 			MaxAge:           12 * time.Hour,
 		}))
@@ -158,8 +362,8 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB, idx search.Index, cfg config.Con
 		r.Use(cors.New(cors.Config{
 			AllowOrigins:     cfg.CORS.AllowedOrigins,
 			AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-			AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-User-ID", middleware.HeaderIdempotencyKey},
-			ExposeHeaders:    []string{"X-Request-ID", "Content-Length"},
+			AllowHeaders:     allowHeaders,
+			ExposeHeaders:    exposeHeaders,
 			AllowCredentials: false,
 			MaxAge:           12 * time.Hour,
 		}))
@@ -173,6 +377,36 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB, idx search.Index, cfg config.Con
 		EnablePolicy: true,
 	}))
 
+	// 10) Idempotency: replay cached responses (before rate limiting)
+	r.Use(middleware.IdempotencyValidator(
+		middleware.IdempotencyOptions{
+			MaxLen: 200,
+			TTL:    cfg.IdempotencyTTL,
+			ChatID: func(c *gin.Context) string {
+				if strings.HasPrefix(c.FullPath(), apiPrefix+"/chats/:id") {
+					return c.Param("id")
+				}
+				return ""
+			},
+			Fail: handlers.Fail,
+		},
+		idempotencyStore{db},
+	))
+
+	// 11) Token-bucket rate limiter per user/IP (shared store when configured)
+	rl := middleware.NewRateLimiter(cfg.RateRPS, cfg.RateBurst, middleware.KeyByUserOrIP()).
+		WithStore(rateLimitStore(cfg.RateStore, db))
+	for _, rp := range ratePolicies(cfg) {
+		rl.WithPolicy(rp.method, apiPrefix+rp.path, rp.policy)
+	}
+	r.Use(rl.Handler())
+	jobs := []maintenance.Job{{
+		Name:  "ratelimit_evict",
+		Every: cfg.Maintenance.RateEvictInterval,
+		Run:   func(ctx context.Context) (int64, error) { return rl.Evict(ctx, time.Now()) },
+		Local: true,
+	}}
+
 	// Fallbacks
 	r.NoRoute(func(c *gin.Context) {
 		handlers.Fail(c, http.StatusNotFound, handlers.ErrCodeNotFound, "route not found")
@@ -186,43 +420,215 @@ func RegisterRoutes(r *gin.Engine, db *gorm.DB, idx search.Index, cfg config.Con
 
 	// Dependency injection: services ← repo/db/index
 	chatSvc := services.NewChatService(db, chatRepoShim{})
+	chatSvc.RestoreWindow = cfg.ChatRestoreWindow
 	msgSvc := &services.MessageService{
 		DB:             db,
 		Index:          idx,
+		Corpora:        corpora,
 		Threshold:      cfg.Threshold,
 		MaxPromptRunes: 2000,
 		MaxReplyRunes:  1500,
 		TitleMaxLen:    6,
 		TitleLocale:    language.English,
+		Generator:      newGenerator(cfg.Generator),
+		HistoryTurns:   cfg.HistoryTurns,
 	}
 
 	fbSvc := &services.FeedbackService{DB: db}
-	h := handlers.New(chatSvc, msgSvc, fbSvc)
+	h := handlers.New(chatSvc, msgSvc, fbSvc).
+		WithStreamWriteTimeout(cfg.WriteTimeout).
+		WithCursorKey([]byte(cfg.CursorSecret))
+	kh := handlers.NewAPIKeys(apiKeySvc)
+	wh := handlers.NewWorkspaces(wsSvc)
+	quotaSvc := services.NewQuotaService(db, quotaLimits(cfg.Quota.User), quotaLimits(cfg.Quota.Workspace), cfg.Quota.Location)
+	uh := handlers.NewUsage(quotaSvc)
+	sh := handlers.NewSearch(&services.SearchService{DB: db})
+	transferSvc := &services.TransferService{DB: db, MaxPromptRunes: msgSvc.MaxPromptRunes, MaxReplyRunes: msgSvc.MaxReplyRunes}
+	th := handlers.NewTransfer(transferSvc).WithWriteTimeout(cfg.WriteTimeout).WithQuota(quotaEnforcer{quotaSvc})
+	lh := handlers.NewShareLinks(&services.ShareLinkService{DB: db})
+
+	// scope restricts a route for API key callers (bearer/header users pass).
+	scope := func(s string) gin.HandlerFunc { return middleware.RequireScope(s, failAuth) }
+	read, writeChats, writeMsgs := scope(auth.ScopeChatsRead), scope(auth.ScopeChatsWrite), scope(auth.ScopeMessagesWrite)
+
+	// quota counts one unit of metric per request (refunded on failure).
+	quota := func(metric string) gin.HandlerFunc {
+		return middleware.Quota(metric, quotaEnforcer{quotaSvc}, middleware.QuotaOptions{Fail: handlers.Fail})
+	}
 
 	// Public API
 	apiBase := cfg.APIBasePath // e.g. "/api/v1"
 	api := groupWithPrefix(r, apiBase)
 	{
 		// Chats
-		api.POST("/chats", h.CreateChat)
-		api.GET("/chats", h.ListChats)
-		api.PUT("/chats/:id/title", h.UpdateChatTitle)
+		api.POST("/chats", writeChats, quota(domain.UsageChats), h.CreateChat)
+		api.GET("/chats", read, h.ListChats)
+		api.GET("/chats/:id", read, h.GetChat)
+		api.PUT("/chats/:id/title", writeChats, h.UpdateChatTitle)
+		api.DELETE("/chats/:id", writeChats, h.DeleteChat)
+		api.POST("/chats/:id/restore", writeChats, h.RestoreChat)
+		api.GET("/chats/:id/export", read, th.ExportChat)
+		// Imports count each imported chat themselves.
+		api.POST("/chats/import", writeChats, th.ImportChats)
+
+		// Sharing
+		api.GET("/chats/:id/shares", read, h.ListChatShares)
+		api.PUT("/chats/:id/shares/:user_id", writeChats, h.ShareChat)
+		api.DELETE("/chats/:id/shares/:user_id", writeChats, h.UnshareChat)
+		api.POST("/chats/:id/share", writeChats, lh.CreateShareLink)
+		api.DELETE("/chats/:id/share", writeChats, lh.RevokeShareLink)
+
+		// Public share links (no identity; own per-IP rate limit)
+		api.GET("/shared/:token", lh.GetSharedChat)
 
 		// Messages
-		api.GET("/chats/:id/messages", h.ListMessages)
-		api.POST("/chats/:id/messages", h.PostMessage)
+		api.GET("/chats/:id/messages", read, h.ListMessages)
+		api.POST("/chats/:id/messages", writeMsgs, quota(domain.UsageMessages), h.PostMessage)
+		// Gin has no escaped ':'; ":stream" is a wildcard checked by the handler.
+		api.POST("/chats/:id/messages:stream", writeMsgs, quota(domain.UsageMessages), h.StreamMessage)
+
+		// Branches
+		api.PUT("/messages/:id", writeMsgs, quota(domain.UsageMessages), h.EditMessage)
+		api.GET("/messages/:id/branches", read, h.ListBranches)
+		api.PUT("/chats/:id/active-branch", writeMsgs, h.SelectBranch)
 
 		// Feedback
-		api.POST("/messages/:id/feedback", h.LeaveFeedback)
+		api.POST("/messages/:id/feedback", writeMsgs, h.LeaveFeedback)
+
+		// Search
+		api.GET("/search/messages", read, sh.SearchMessages)
+
+		// Workspaces
+		api.POST("/workspaces", writeChats, wh.CreateWorkspace)
+		api.GET("/workspaces", read, wh.ListWorkspaces)
+		api.GET("/workspaces/:id", read, wh.GetWorkspace)
+		api.PATCH("/workspaces/:id", writeChats, wh.UpdateWorkspace)
+		api.GET("/workspaces/:id/members", read, wh.ListWorkspaceMembers)
+		api.PUT("/workspaces/:id/members/:user_id", writeChats, wh.SetWorkspaceMember)
+		api.DELETE("/workspaces/:id/members/:user_id", writeChats, wh.RemoveWorkspaceMember)
+
+		// Usage quotas (overrides are admin-only; API key callers need the admin scope)
+		api.GET("/me/usage", read, uh.GetUsage)
+		quotas := api.Group("/users/:user_id/quota", scope(auth.ScopeAdmin))
+		{
+			quotas.GET("", uh.GetQuota)
+			quotas.PUT("", uh.SetQuota)
+			quotas.DELETE("", uh.DeleteQuota)
+		}
+
+		// API keys (API key callers need the admin scope to manage keys)
+		keys := api.Group("/api-keys", scope(auth.ScopeAdmin))
+		{
+			keys.POST("", kh.CreateAPIKey)
+			keys.GET("", kh.ListAPIKeys)
+			keys.DELETE("/:id", kh.RevokeAPIKey)
+		}
+	}
+
+	// Admin (only when an admin token is configured and the index can reload)
+	if reloader, ok := idx.(handlers.CorpusReloader); ok && cfg.AdminToken != "" {
+		ah := handlers.NewAdmin(reloader)
+		admin := api.Group("/admin", middleware.RequireBearerToken(cfg.AdminToken))
+		{
+			admin.GET("/corpus", ah.CorpusVersion)
+			admin.POST("/corpus/reload", ah.ReloadCorpus)
+		}
+	}
+	return jobs
+}
+
+// authMiddleware builds the identity middleware: API keys (X-API-Key) are
+// tried first, then the mode selected by cfg.Auth.Mode for requests without
+// a key. Health, metrics, Swagger, CORS preflights and the admin group (which
+// has its own ADMIN_TOKEN guard) are exempt.
+func authMiddleware(cfg config.Config, keys middleware.APIKeyVerifier) []gin.HandlerFunc {
+	skip := authExempt(cfg)
+	apiKeys := middleware.APIKeyAuth(keys, middleware.APIKeyOptions{Skip: skip, Fail: failAuth})
+	skipIdentity := func(c *gin.Context) bool { return skip(c) || middleware.AuthenticatedByAPIKey(c) }
+	if cfg.Auth.Mode == "header" {
+		return []gin.HandlerFunc{apiKeys, middleware.HeaderIdentity(skipIdentity)}
+	}
+
+	v := &auth.Verifier{
+		Secret:    []byte(cfg.Auth.JWTSecret),
+		Issuer:    cfg.Auth.Issuer,
+		Audience:  cfg.Auth.Audience,
+		UserClaim: cfg.Auth.UserClaim,
+		Leeway:    cfg.Auth.Leeway,
+	}
+	if cfg.Auth.JWKSFile != "" || cfg.Auth.JWKSURL != "" {
+		v.Keys = &auth.JWKS{
+			Path:            cfg.Auth.JWKSFile,
+			URL:             cfg.Auth.JWKSURL,
+			RefreshInterval: cfg.Auth.JWKSRefresh,
+		}
+	}
+	return []gin.HandlerFunc{apiKeys, middleware.Authenticate(v, middleware.AuthOptions{
+		Skip:       skipIdentity,
+		AdminRole:  cfg.Auth.AdminRole,
+		RolesClaim: cfg.Auth.RolesClaim,
+		Fail:       failAuth,
+	})}
+}
+
+// authExempt reports requests that carry no user identity: health, metrics,
+// Swagger, CORS preflights, public share links and the admin group (guarded
+// by ADMIN_TOKEN).
+func authExempt(cfg config.Config) func(*gin.Context) bool {
+	adminPrefix := strings.TrimRight(cfg.APIBasePath, "/") + "/admin"
+	sharedPrefix := strings.TrimRight(cfg.APIBasePath, "/") + "/shared/"
+	return func(c *gin.Context) bool {
+		p := c.Request.URL.Path
+		return c.Request.Method == http.MethodOptions ||
+			p == "/health" || p == "/metrics" ||
+			strings.HasPrefix(p, "/swagger/") ||
+			(c.Request.Method == http.MethodGet && strings.HasPrefix(p, sharedPrefix)) ||
+			p == adminPrefix || strings.HasPrefix(p, adminPrefix+"/")
+	}
+}
+
+// failAuth writes authentication (401/503) and scope (403) failures in the
+// standard error envelope.
+func failAuth(c *gin.Context, status int, msg string) {
+	code := handlers.ErrCodeUnauthorized
+	switch {
+	case status == http.StatusForbidden:
+		code = handlers.ErrCodeForbidden
+	case status >= http.StatusInternalServerError:
+		code = handlers.ErrCodeInternal
 	}
+	handlers.Fail(c, status, code, msg)
 }
 
-// limitBody returns a Gin middleware that caps the request body size for all
-// endpoints to maxBytes using http.MaxBytesReader. Requests exceeding the cap
-// will cause downstream body reads to error.
-func limitBody(maxBytes int64) gin.HandlerFunc {
+// newGenerator builds the configured answer generator. The extractive default
+// is returned as nil: MessageService uses it directly (and as the fallback).
+func newGenerator(gc config.GeneratorConfig) generator.Generator {
+	if gc.Kind != "openai" {
+		return nil
+	}
+	return &generator.OpenAI{
+		BaseURL:        gc.BaseURL,
+		APIKey:         gc.APIKey,
+		Model:          gc.Model,
+		MaxTokens:      gc.MaxTokens,
+		MaxInputTokens: gc.MaxInputTokens,
+		Temperature:    gc.Temperature,
+		Timeout:        gc.Timeout,
+		MaxRetries:     gc.MaxRetries,
+	}
+}
+
+// limitBody returns a Gin middleware that caps the request body size to
+// maxBytes using http.MaxBytesReader, or to perRoute[c.FullPath()] for routes
+// listed there. Requests exceeding the cap will cause downstream body reads to
+// error.
+func limitBody(maxBytes int64, perRoute map[string]int64) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes)
+		limit := maxBytes
+		if n, ok := perRoute[c.FullPath()]; ok {
+			limit = n
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
 		c.Next()
 	}
 }
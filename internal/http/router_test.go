@@ -3,9 +3,14 @@ package httpapi
 import (
 	"bytes"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,7 +21,10 @@ import (
 
 	"github.com/tbourn/go-chat-backend/internal/config"
 	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/generator"
+	"github.com/tbourn/go-chat-backend/internal/http/handlers"
 	"github.com/tbourn/go-chat-backend/internal/http/middleware"
+	"github.com/tbourn/go-chat-backend/internal/repo"
 	"github.com/tbourn/go-chat-backend/internal/search"
 )
 
@@ -35,7 +43,7 @@ func newTestDB(t *testing.T) *gorm.DB {
 		t.Fatalf("open sqlite: %v", err)
 	}
 	// schema so handlers don't explode on list endpoints
-	if err := db.AutoMigrate(&domain.Chat{}, &domain.Message{}, &domain.Feedback{}, &domain.Idempotency{}); err != nil {
+	if err := db.AutoMigrate(&domain.Workspace{}, &domain.WorkspaceMember{}, &domain.Chat{}, &domain.ChatShare{}, &domain.ShareLink{}, &domain.Message{}, &domain.MessageSource{}, &domain.Feedback{}, &domain.Idempotency{}, &domain.APIKey{}, &domain.UsageCounter{}, &domain.QuotaOverride{}, &domain.RateLimitBucket{}); err != nil {
 		t.Fatalf("automigrate: %v", err)
 	}
 	return db
@@ -46,6 +54,7 @@ func TestRegisterRoutes_CORSAllowAll_Health_Metrics_Fallbacks(t *testing.T) {
 	r := gin.New()
 
 	cfg := config.Config{
+		Auth:        config.AuthConfig{Mode: "header"},
 		APIBasePath: "/api/v1",
 		RateRPS:     100,
 		RateBurst:   10,
@@ -56,7 +65,7 @@ func TestRegisterRoutes_CORSAllowAll_Health_Metrics_Fallbacks(t *testing.T) {
 	}
 	db := newTestDB(t)
 
-	RegisterRoutes(r, db, fakeIndex{}, cfg)
+	RegisterRoutes(r, db, fakeIndex{}, nil, cfg)
 
 	// /health works
 	w := httptest.NewRecorder()
@@ -95,11 +104,48 @@ func TestRegisterRoutes_CORSAllowAll_Health_Metrics_Fallbacks(t *testing.T) {
 	}
 }
 
+func TestRegisterRoutes_SQLiteRateStore(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+
+	cfg := config.Config{
+		Auth:        config.AuthConfig{Mode: "header"},
+		APIBasePath: "/api/v1",
+		RateRPS:     0.01,
+		RateBurst:   1,
+		RateStore:   config.RateStoreConfig{Kind: "sqlite"},
+		OTEL:        config.OTELConfig{ServiceName: "test-svc"},
+		Threshold:   0.2,
+	}
+	db := newTestDB(t)
+	db.Where("key = ?", "default:ip:203.0.113.50").Delete(&domain.RateLimitBucket{})
+
+	RegisterRoutes(r, db, fakeIndex{}, nil, cfg)
+
+	codes := []int{}
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/health", nil)
+		req.RemoteAddr = "203.0.113.50:1234"
+		r.ServeHTTP(w, req)
+		codes = append(codes, w.Code)
+	}
+	if codes[0] != http.StatusOK || codes[1] != http.StatusTooManyRequests {
+		t.Fatalf("codes = %v", codes)
+	}
+	var n int64
+	db.Model(&domain.RateLimitBucket{}).Where("key = ?", "default:ip:203.0.113.50").Count(&n)
+	if n != 1 {
+		t.Fatalf("expected the bucket to be persisted, got %d rows", n)
+	}
+}
+
 func TestRegisterRoutes_CORSWithOrigins_HeaderEcho(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
 
 	cfg := config.Config{
+		Auth:        config.AuthConfig{Mode: "header"},
 		APIBasePath: "/api/v2",
 		RateRPS:     50,
 		RateBurst:   5,
@@ -110,7 +156,7 @@ func TestRegisterRoutes_CORSWithOrigins_HeaderEcho(t *testing.T) {
 	}
 	db := newTestDB(t)
 
-	RegisterRoutes(r, db, fakeIndex{}, cfg)
+	RegisterRoutes(r, db, fakeIndex{}, nil, cfg)
 
 	// Any request runs through CORS middleware; header should reflect origin.
 	w := httptest.NewRecorder()
@@ -129,15 +175,17 @@ func Test_limitBody_Middleware(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
 	// tiny cap to trigger MaxBytesReader
-	r.Use(limitBody(10))
-	r.POST("/echo", func(c *gin.Context) {
+	r.Use(limitBody(10, map[string]int64{"/big": 20}))
+	echo := func(c *gin.Context) {
 		_, err := io.ReadAll(c.Request.Body)
 		if err != nil {
 			c.String(http.StatusRequestEntityTooLarge, "too big")
 			return
 		}
 		c.String(http.StatusOK, "ok")
-	})
+	}
+	r.POST("/echo", echo)
+	r.POST("/big", echo)
 
 	w := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodPost, "/echo", bytes.NewBufferString("0123456789AB")) // 12 bytes
@@ -145,6 +193,15 @@ func Test_limitBody_Middleware(t *testing.T) {
 	if w.Code != http.StatusRequestEntityTooLarge {
 		t.Fatalf("expected 413 from limitBody, got %d", w.Code)
 	}
+
+	// Routes with their own cap accept more, up to it.
+	for body, want := range map[string]int{"0123456789AB": http.StatusOK, "0123456789ABCDEFGHIJK": http.StatusRequestEntityTooLarge} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/big", bytes.NewBufferString(body)))
+		if w.Code != want {
+			t.Fatalf("/big with %d bytes -> %d, want %d", len(body), w.Code, want)
+		}
+	}
 }
 
 func Test_groupWithPrefix(t *testing.T) {
@@ -190,6 +247,7 @@ func TestPipeline_Smoke(t *testing.T) {
 	r := gin.New()
 
 	cfg := config.Config{
+		Auth:        config.AuthConfig{Mode: "header"},
 		APIBasePath: "/api/v1",
 		RateRPS:     100,
 		RateBurst:   10,
@@ -199,7 +257,7 @@ func TestPipeline_Smoke(t *testing.T) {
 		Threshold:   0.2,
 	}
 	db := newTestDB(t)
-	RegisterRoutes(r, db, fakeIndex{}, cfg)
+	RegisterRoutes(r, db, fakeIndex{}, nil, cfg)
 
 	// Any request goes through the middleware stack
 	w := httptest.NewRecorder()
@@ -225,9 +283,10 @@ func Test_chatRepoShim_Proxies(t *testing.T) {
 
 	shim := chatRepoShim{}
 	ctx := context.Background()
+	ws := domain.DefaultWorkspaceID
 
 	// --- CreateChat ---
-	c1, err := shim.CreateChat(ctx, db, "u1", "t1")
+	c1, err := shim.CreateChat(ctx, db, ws, "u1", "t1")
 	if err != nil {
 		t.Fatalf("CreateChat: %v", err)
 	}
@@ -236,7 +295,7 @@ func Test_chatRepoShim_Proxies(t *testing.T) {
 	}
 
 	// --- ListChats ---
-	all, err := shim.ListChats(ctx, db, "u1")
+	all, err := shim.ListChats(ctx, db, ws, "u1")
 	if err != nil {
 		t.Fatalf("ListChats: %v", err)
 	}
@@ -244,37 +303,51 @@ func Test_chatRepoShim_Proxies(t *testing.T) {
 		t.Fatalf("ListChats expected >=1, got %d", len(all))
 	}
 
-	// --- GetChat ---
-	got, err := shim.GetChat(ctx, db, c1.ID, "u1")
+	// --- FindChat ---
+	got, err := shim.FindChat(ctx, db, ws, c1.ID)
 	if err != nil {
-		t.Fatalf("GetChat: %v", err)
+		t.Fatalf("FindChat: %v", err)
 	}
 	if got.ID != c1.ID || got.UserID != "u1" {
-		t.Fatalf("GetChat mismatch: got=%+v want id=%s user=u1", got, c1.ID)
+		t.Fatalf("FindChat mismatch: got=%+v want id=%s user=u1", got, c1.ID)
+	}
+
+	// --- ShareChat / IsChatSharedWith / ListChatShares / UnshareChat ---
+	if err := shim.ShareChat(ctx, db, c1.ID, "u2"); err != nil {
+		t.Fatalf("ShareChat: %v", err)
+	}
+	if ok, err := shim.IsChatSharedWith(ctx, db, c1.ID, "u2"); err != nil || !ok {
+		t.Fatalf("IsChatSharedWith = %v, %v", ok, err)
+	}
+	if shares, err := shim.ListChatShares(ctx, db, c1.ID); err != nil || len(shares) != 1 {
+		t.Fatalf("ListChatShares = %+v, %v", shares, err)
+	}
+	if err := shim.UnshareChat(ctx, db, c1.ID, "u2"); err != nil {
+		t.Fatalf("UnshareChat: %v", err)
 	}
 
 	// --- UpdateChatTitle ---
-	if err := shim.UpdateChatTitle(ctx, db, c1.ID, "u1", "t1-renamed"); err != nil {
+	if err := shim.UpdateChatTitle(ctx, db, ws, c1.ID, "u1", "t1-renamed", 0); err != nil {
 		t.Fatalf("UpdateChatTitle: %v", err)
 	}
-	got2, err := shim.GetChat(ctx, db, c1.ID, "u1")
+	got2, err := shim.FindChat(ctx, db, ws, c1.ID)
 	if err != nil {
-		t.Fatalf("GetChat (after update): %v", err)
+		t.Fatalf("FindChat (after update): %v", err)
 	}
 	if got2.Title != "t1-renamed" {
 		t.Fatalf("UpdateChatTitle failed, title=%q", got2.Title)
 	}
 
 	// Seed a few more for pagination
-	if _, err := shim.CreateChat(ctx, db, "u1", "t2"); err != nil {
+	if _, err := shim.CreateChat(ctx, db, ws, "u1", "t2"); err != nil {
 		t.Fatalf("CreateChat t2: %v", err)
 	}
-	if _, err := shim.CreateChat(ctx, db, "u1", "t3"); err != nil {
+	if _, err := shim.CreateChat(ctx, db, ws, "u1", "t3"); err != nil {
 		t.Fatalf("CreateChat t3: %v", err)
 	}
 
 	// --- CountChats ---
-	n, err := shim.CountChats(ctx, db, "u1")
+	n, err := shim.CountChats(ctx, db, ws, "u1")
 	if err != nil {
 		t.Fatalf("CountChats: %v", err)
 	}
@@ -283,72 +356,133 @@ func Test_chatRepoShim_Proxies(t *testing.T) {
 	}
 
 	// --- ListChatsPage ---
-	page, err := shim.ListChatsPage(ctx, db, "u1", 0, 2)
+	page, err := shim.ListChatsPage(ctx, db, ws, "u1", 0, 2)
 	if err != nil {
 		t.Fatalf("ListChatsPage: %v", err)
 	}
 	if len(page) != 2 {
 		t.Fatalf("ListChatsPage expected 2, got %d", len(page))
 	}
+
+	// --- DeleteChat / FindDeletedChat / RestoreChat ---
+	if err := shim.DeleteChat(ctx, db, ws, c1.ID, "u1", 0, time.Now().UTC()); err != nil {
+		t.Fatalf("DeleteChat: %v", err)
+	}
+	deleted, err := shim.FindDeletedChat(ctx, db, ws, c1.ID)
+	if err != nil || deleted.ID != c1.ID {
+		t.Fatalf("FindDeletedChat: %+v, %v", deleted, err)
+	}
+	if err := shim.RestoreChat(ctx, db, ws, c1.ID, "u1", deleted.DeletedAt.Time); err != nil {
+		t.Fatalf("RestoreChat: %v", err)
+	}
+	if _, err := shim.FindChat(ctx, db, ws, c1.ID); err != nil {
+		t.Fatalf("FindChat (after restore): %v", err)
+	}
 }
 
-func TestRegisterRoutes_IdempotencyCallback_MissAndHit(t *testing.T) {
+func TestRegisterRoutes_Idempotency(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
 
 	cfg := config.Config{
-		APIBasePath: "/api/vX",
-		RateRPS:     100,
-		RateBurst:   10,
-		CORS:        config.CORSConfig{}, // allow-all branch
-		Security:    config.SecurityConfig{EnableHSTS: false},
-		OTEL:        config.OTELConfig{ServiceName: "svc"},
-		Threshold:   0.2,
+		Auth:           config.AuthConfig{Mode: "header"},
+		APIBasePath:    "/api/vX",
+		RateRPS:        100,
+		RateBurst:      10,
+		CORS:           config.CORSConfig{}, // allow-all branch
+		OTEL:           config.OTELConfig{ServiceName: "svc"},
+		Threshold:      0.2,
+		IdempotencyTTL: time.Hour,
 	}
 	db := newTestDB(t)
-	RegisterRoutes(r, db, fakeIndex{}, cfg)
+	RegisterRoutes(r, db, fakeIndex{}, nil, cfg)
 
-	const userID = "u1"
-	const key = "key-hit"
-	const chatID = "" // we’ll hit /health, so no path param
+	do := func(method, path, key, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User-ID", "idem-user")
+		if key != "" {
+			req.Header.Set(middleware.HeaderIdempotencyKey, key)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	replayed := func(w *httptest.ResponseRecorder) bool {
+		return w.Header().Get(middleware.HeaderIdempotencyReplayed) == "true"
+	}
 
-	// --- MISS: record does not exist (executes 'rec == nil' branch) ---
-	w := httptest.NewRecorder()
-	req := httptest.NewRequest(http.MethodPost, "/health", bytes.NewBufferString("{}"))
-	req.Header.Set("X-User-ID", userID)
-	req.Header.Set(middleware.HeaderIdempotencyKey, key)
-	r.ServeHTTP(w, req)
-	// NoMethod is expected for POST /health, but middleware ran.
+	// POST /chats: the retry gets the first response; no second chat.
+	first := do(http.MethodPost, "/api/vX/chats", "idem-chat", `{"title":"once"}`)
+	if first.Code != http.StatusCreated || replayed(first) {
+		t.Fatalf("create chat: %d %s", first.Code, first.Body.String())
+	}
+	retry := do(http.MethodPost, "/api/vX/chats", "idem-chat", `{"title":"once"}`)
+	if retry.Code != http.StatusCreated || !replayed(retry) || retry.Body.String() != first.Body.String() ||
+		retry.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Fatalf("create chat retry: %d %v %s", retry.Code, retry.Header(), retry.Body.String())
+	}
+	var chat domain.Chat
+	_ = json.Unmarshal(first.Body.Bytes(), &chat)
+	var chats int64
+	db.Model(&domain.Chat{}).Where("user_id = ?", "idem-user").Count(&chats)
+	if chats != 1 {
+		t.Fatalf("chats created = %d", chats)
+	}
+	if w := do(http.MethodPost, "/api/vX/chats", "idem-chat", `{"title":"twice"}`); w.Code != http.StatusUnprocessableEntity ||
+		!strings.Contains(w.Body.String(), `"code":"idempotency_key_reused"`) {
+		t.Fatalf("reused key: %d %s", w.Code, w.Body.String())
+	}
 
-	// --- seed an idempotency record so the callback returns non-nil ---
-	seed := &domain.Idempotency{
-		ID:        "idem-seed-1",
-		UserID:    userID,
-		ChatID:    chatID,
-		Key:       key,
-		MessageID: "m-1",
-		Status:    1,
-		// ensure it's considered valid "now"
-		ExpiresAt: time.Now().Add(time.Hour),
+	// PUT /chats/:id/title
+	title := "/api/vX/chats/" + chat.ID + "/title"
+	if w := do(http.MethodPut, title, "idem-title", `{"title":"renamed"}`); w.Code != http.StatusOK && w.Code != http.StatusNoContent {
+		t.Fatalf("rename: %d %s", w.Code, w.Body.String())
 	}
-	if err := db.Create(seed).Error; err != nil {
-		t.Fatalf("seed idempotency: %v", err)
+	if w := do(http.MethodPut, title, "idem-title", `{"title":"renamed"}`); !replayed(w) {
+		t.Fatalf("rename retry not replayed: %d", w.Code)
 	}
 
-	// --- HIT: record exists (executes 'return true, nil' branch) ---
-	w = httptest.NewRecorder()
-	req = httptest.NewRequest(http.MethodPost, "/health", bytes.NewBufferString("{}"))
-	req.Header.Set("X-User-ID", userID)
-	req.Header.Set(middleware.HeaderIdempotencyKey, key)
-	r.ServeHTTP(w, req)
-	// again, 405 is fine; goal is to drive the middleware branch.
+	// POST /chats/:id/messages and POST /messages/:id/feedback
+	msgs := "/api/vX/chats/" + chat.ID + "/messages"
+	w := do(http.MethodPost, msgs, "idem-msg", `{"content":"hello"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("post message: %d %s", w.Code, w.Body.String())
+	}
+	var posted handlers.PostMessageResponse
+	_ = json.Unmarshal(w.Body.Bytes(), &posted)
+	if w := do(http.MethodPost, msgs, "idem-msg", `{"content":"hello"}`); !replayed(w) || !strings.Contains(w.Body.String(), posted.Message.ID) {
+		t.Fatalf("post message retry: %d %s", w.Code, w.Body.String())
+	}
+	if n, _ := repo.CountMessages(db, chat.ID); n != 2 {
+		t.Fatalf("messages = %d, want 2", n)
+	}
+	feedback := "/api/vX/messages/" + posted.Message.ID + "/feedback"
+	if w := do(http.MethodPost, feedback, "idem-fb", `{"value":1}`); w.Code != http.StatusNoContent {
+		t.Fatalf("feedback: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPost, feedback, "idem-fb", `{"value":1}`); w.Code != http.StatusNoContent || !replayed(w) {
+		t.Fatalf("feedback retry: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPost, feedback, "", `{"value":1}`); w.Code != http.StatusConflict {
+		t.Fatalf("feedback without key: %d", w.Code)
+	}
+
+	// Responses of a deleted chat are no longer replayed.
+	if w := do(http.MethodDelete, "/api/vX/chats/"+chat.ID, "", ""); w.Code != http.StatusNoContent && w.Code != http.StatusOK {
+		t.Fatalf("delete: %d", w.Code)
+	}
+	if w := do(http.MethodPost, msgs, "idem-msg", `{"content":"hello"}`); replayed(w) || w.Code != http.StatusNotFound {
+		t.Fatalf("message retry after delete: %d %s", w.Code, w.Body.String())
+	}
 }
 
-func TestRegisterRoutes_IdempotencyCallback_ErrorBranch(t *testing.T) {
+func TestRegisterRoutes_Idempotency_UnroutedSkipsStore(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	r := gin.New()
 
 	cfg := config.Config{
+		Auth:        config.AuthConfig{Mode: "header"},
 		APIBasePath: "/api/v1",
 		RateRPS:     100,
 		RateBurst:   10,
@@ -365,12 +499,12 @@ func TestRegisterRoutes_IdempotencyCallback_ErrorBranch(t *testing.T) {
 	if err != nil {
 		t.Fatalf("open sqlite: %v", err)
 	}
-	if err := db.AutoMigrate(&domain.Chat{}, &domain.Message{}, &domain.Feedback{}, &domain.Idempotency{}); err != nil {
+	if err := db.AutoMigrate(&domain.Workspace{}, &domain.WorkspaceMember{}, &domain.Chat{}, &domain.ChatShare{}, &domain.Message{}, &domain.MessageSource{}, &domain.Feedback{}, &domain.Idempotency{}, &domain.APIKey{}, &domain.UsageCounter{}, &domain.QuotaOverride{}, &domain.RateLimitBucket{}); err != nil {
 		t.Fatalf("automigrate: %v", err)
 	}
 
 	// Wire routes first...
-	RegisterRoutes(r, db, fakeIndex{}, cfg)
+	RegisterRoutes(r, db, fakeIndex{}, nil, cfg)
 
 	// ...then force queries to fail by closing the underlying connection.
 	sqlDB, err := db.DB()
@@ -379,15 +513,616 @@ func TestRegisterRoutes_IdempotencyCallback_ErrorBranch(t *testing.T) {
 	}
 	_ = sqlDB.Close()
 
-	// Now any repo.GetIdempotency call should error → drives (err != nil) branch.
+	// Unrouted requests never reach the (now failing) idempotency store.
 	w := httptest.NewRecorder()
 	req := httptest.NewRequest(http.MethodPost, "/health", bytes.NewBufferString("{}"))
 	req.Header.Set("X-User-ID", "u1")
 	req.Header.Set(middleware.HeaderIdempotencyKey, "force-error")
 	r.ServeHTTP(w, req)
 
-	// 405 is expected for POST /health; goal is to exercise the middleware branch.
+	// 405 is expected for POST /health.
 	if w.Code != http.StatusMethodNotAllowed {
 		t.Fatalf("expected 405, got %d", w.Code)
 	}
 }
+
+func TestRegisterRoutes_AdminCorpus_MountedOnlyWithReloaderAndToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	base := config.Config{
+		Auth:        config.AuthConfig{Mode: "header"},
+		APIBasePath: "/api/v1",
+		RateRPS:     100,
+		RateBurst:   10,
+		OTEL:        config.OTELConfig{ServiceName: "svc"},
+		Threshold:   0.2,
+	}
+	rl := search.NewReloadable(func() (search.Corpus, error) { return search.Corpus{Data: []byte("alpha beta")}, nil }, search.WithMinParagraphRunes(0))
+
+	do := func(r *gin.Engine, method, auth string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/api/v1/admin/corpus/reload", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	// Token set but index not reloadable → not mounted.
+	cfg := base
+	cfg.AdminToken = "s3cret"
+	r := gin.New()
+	RegisterRoutes(r, db, fakeIndex{}, nil, cfg)
+	if code := do(r, http.MethodPost, "Bearer s3cret"); code != http.StatusNotFound {
+		t.Fatalf("expected 404 without reloadable index, got %d", code)
+	}
+
+	// Reloadable index but no token → not mounted.
+	r = gin.New()
+	RegisterRoutes(r, db, rl, nil, base)
+	if code := do(r, http.MethodPost, "Bearer s3cret"); code != http.StatusNotFound {
+		t.Fatalf("expected 404 without admin token, got %d", code)
+	}
+
+	// Both → mounted and guarded.
+	r = gin.New()
+	RegisterRoutes(r, db, rl, nil, cfg)
+	if code := do(r, http.MethodPost, ""); code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 without credentials, got %d", code)
+	}
+	if code := do(r, http.MethodPost, "Bearer s3cret"); code != http.StatusOK {
+		t.Fatalf("expected 200 with credentials, got %d", code)
+	}
+	if v := rl.Version(); v.Seq != 1 || v.Docs != 1 {
+		t.Fatalf("reload did not swap: %+v", v)
+	}
+}
+
+func TestRegisterRoutes_StreamRoute(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	chatID := "6f1c2a9b-7d4e-4f60-8a1b-2c3d4e5f6a7b"
+	if err := db.Create(&domain.Chat{ID: chatID, UserID: "u1", Title: "T"}).Error; err != nil {
+		t.Fatalf("seed chat: %v", err)
+	}
+	cfg := config.Config{
+		Auth:         config.AuthConfig{Mode: "header"},
+		APIBasePath:  "/api/v1",
+		RateRPS:      100,
+		RateBurst:    10,
+		OTEL:         config.OTELConfig{ServiceName: "svc"},
+		Threshold:    0.2,
+		WriteTimeout: time.Second,
+	}
+	r := gin.New()
+	RegisterRoutes(r, db, fakeIndex{}, nil, cfg)
+
+	do := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(`{"content":"hello"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User-ID", "u1")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do("/api/v1/chats/" + chatID + "/messages:stream")
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("stream route: status=%d headers=%v", w.Code, w.Header())
+	}
+	if !bytes.Contains(w.Body.Bytes(), []byte("event:done")) {
+		t.Fatalf("missing done event: %s", w.Body.String())
+	}
+	if w := do("/api/v1/chats/" + chatID + "/messagesX"); w.Code != http.StatusNotFound {
+		t.Fatalf("bogus suffix should 404, got %d", w.Code)
+	}
+}
+
+func Test_newGenerator(t *testing.T) {
+	if g := newGenerator(config.GeneratorConfig{Kind: "extractive"}); g != nil {
+		t.Fatalf("extractive should use the service default, got %T", g)
+	}
+	g, ok := newGenerator(config.GeneratorConfig{Kind: "openai", BaseURL: "http://llm/v1", Model: "m", Timeout: time.Second, MaxRetries: 3, MaxTokens: 64}).(*generator.OpenAI)
+	if !ok || g.BaseURL != "http://llm/v1" || g.Model != "m" || g.Timeout != time.Second || g.MaxRetries != 3 || g.MaxTokens != 64 {
+		t.Fatalf("unexpected generator: %+v", g)
+	}
+}
+
+// hs256Token signs claims with secret as a compact HS256 JWT.
+func hs256Token(t *testing.T, secret string, claims map[string]any) string {
+	t.Helper()
+	enc := func(v any) string {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(raw)
+	}
+	signed := enc(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + enc(claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestRegisterRoutes_JWTAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	secret := strings.Repeat("s", 32)
+	cfg := config.Config{
+		APIBasePath: "/api/v1",
+		RateRPS:     100,
+		RateBurst:   10,
+		OTEL:        config.OTELConfig{ServiceName: "svc"},
+		Threshold:   0.2,
+		Auth: config.AuthConfig{
+			Mode:      "jwt",
+			JWTSecret: secret,
+			Audience:  "chat-api",
+			UserClaim: "sub",
+		},
+	}
+	r := gin.New()
+	RegisterRoutes(r, db, fakeIndex{}, nil, cfg)
+
+	do := func(method, path, authz string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(`{"title":"jwt chat"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User-ID", "spoofed")
+		if authz != "" {
+			req.Header.Set("Authorization", authz)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodGet, "/health", ""); w.Code != http.StatusOK {
+		t.Fatalf("/health must stay public, got %d", w.Code)
+	}
+	w := do(http.MethodGet, "/api/v1/chats", "")
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), `"code":"`+handlers.ErrCodeUnauthorized+`"`) {
+		t.Fatalf("missing token: %d %s", w.Code, w.Body.String())
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+	wrongAud := hs256Token(t, secret, map[string]any{"sub": "jwt-user", "aud": "other", "exp": exp})
+	if w := do(http.MethodGet, "/api/v1/chats", "Bearer "+wrongAud); w.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong audience: %d", w.Code)
+	}
+
+	tok := hs256Token(t, secret, map[string]any{"sub": "jwt-user", "aud": "chat-api", "exp": exp})
+	if w := do(http.MethodPost, "/api/v1/chats", "Bearer "+tok); w.Code != http.StatusCreated {
+		t.Fatalf("create with token: %d %s", w.Code, w.Body.String())
+	}
+	var owners []string
+	db.Model(&domain.Chat{}).Where("title = ?", "jwt chat").Pluck("user_id", &owners)
+	if len(owners) != 1 || owners[0] != "jwt-user" {
+		t.Fatalf("chat owner = %v; want the token subject", owners)
+	}
+}
+
+func TestRegisterRoutes_ChatAuthorization(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	ctx := context.Background()
+	secret := strings.Repeat("s", 32)
+	cfg := config.Config{
+		APIBasePath: "/api/v1",
+		RateRPS:     1000,
+		RateBurst:   1000,
+		OTEL:        config.OTELConfig{ServiceName: "svc"},
+		Threshold:   0.2,
+		Auth: config.AuthConfig{
+			Mode:       "jwt",
+			JWTSecret:  secret,
+			UserClaim:  "sub",
+			RolesClaim: "roles",
+			AdminRole:  "admin",
+		},
+	}
+	r := gin.New()
+	RegisterRoutes(r, db, fakeIndex{}, nil, cfg)
+
+	// The owner's chat (with an assistant reply) and a deleted chat, both
+	// shared with "friend".
+	chat, err := repo.CreateChat(ctx, db, domain.DefaultWorkspaceID, "owner", "private")
+	if err != nil {
+		t.Fatalf("seed chat: %v", err)
+	}
+	reply, err := repo.CreateMessage(db, chat.ID, "assistant", "secret answer", nil)
+	if err != nil {
+		t.Fatalf("seed message: %v", err)
+	}
+	gone, _ := repo.CreateChat(ctx, db, domain.DefaultWorkspaceID, "owner", "deleted")
+	if err := repo.DeleteChat(ctx, db, domain.DefaultWorkspaceID, gone.ID, "owner", 0, time.Now().UTC()); err != nil {
+		t.Fatalf("seed deleted chat: %v", err)
+	}
+	for _, id := range []string{chat.ID, gone.ID} {
+		if err := repo.ShareChat(ctx, db, id, "friend"); err != nil {
+			t.Fatalf("seed share: %v", err)
+		}
+	}
+
+	exp := time.Now().Add(time.Hour).Unix()
+	tokens := map[string]string{
+		"stranger": hs256Token(t, secret, map[string]any{"sub": "mallory", "exp": exp}),
+		"friend":   hs256Token(t, secret, map[string]any{"sub": "friend", "exp": exp}),
+		"admin":    hs256Token(t, secret, map[string]any{"sub": "ops", "roles": []string{"admin"}, "exp": exp}),
+	}
+
+	base := "/api/v1/chats/" + chat.ID
+	routes := []struct {
+		method, path, body string
+		// want is the expected status for stranger, friend and admin.
+		want [3]int
+	}{
+		{http.MethodGet, base + "/messages", "", [3]int{404, 200, 200}},
+		{http.MethodPost, base + "/messages", `{"content":"hello"}`, [3]int{404, 200, 200}},
+		{http.MethodPost, base + "/messages:stream", `{"content":"hello"}`, [3]int{404, 200, 200}},
+		{http.MethodPost, "/api/v1/messages/" + reply.ID + "/feedback", `{"value":1}`, [3]int{404, 204, 204}},
+		{http.MethodPut, "/api/v1/messages/" + reply.ID, `{"content":"hello"}`, [3]int{404, 400, 400}}, // not a user message
+		{http.MethodGet, "/api/v1/messages/" + reply.ID + "/branches", "", [3]int{404, 200, 200}},
+		{http.MethodPut, base + "/active-branch", `{"message_id":"` + reply.ID + `"}`, [3]int{404, 204, 204}},
+		{http.MethodPut, base + "/title", `{"title":"renamed"}`, [3]int{404, 403, 204}},
+		{http.MethodGet, base + "/shares", "", [3]int{404, 403, 200}},
+		{http.MethodPut, base + "/shares/eve", "", [3]int{404, 403, 204}},
+		{http.MethodDelete, base + "/shares/eve", "", [3]int{404, 403, 204}},
+		{http.MethodPost, base + "/share", "", [3]int{404, 403, 201}},
+		{http.MethodDelete, base + "/share", "", [3]int{404, 403, 204}},
+		{http.MethodPost, "/api/v1/chats/" + gone.ID + "/restore", "", [3]int{404, 403, 200}},
+		{http.MethodDelete, base, "", [3]int{404, 403, 204}}, // last: removes the chat
+	}
+	for i, who := range []string{"stranger", "friend", "admin"} {
+		for _, rt := range routes {
+			t.Run(who+" "+rt.method+" "+rt.path, func(t *testing.T) {
+				w := httptest.NewRecorder()
+				req := httptest.NewRequest(rt.method, rt.path, strings.NewReader(rt.body))
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("Authorization", "Bearer "+tokens[who])
+				r.ServeHTTP(w, req)
+				if w.Code != rt.want[i] {
+					t.Fatalf("status = %d; want %d (body=%s)", w.Code, rt.want[i], w.Body.String())
+				}
+				if w.Code == http.StatusNotFound && (strings.Contains(w.Body.String(), "secret") || w.Header().Get("ETag") != "") {
+					t.Fatalf("404 leaked chat data: %s %v", w.Body.String(), w.Header())
+				}
+			})
+		}
+	}
+
+	// The stranger's own list never includes the owner's chats.
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/chats", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens["stranger"])
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), chat.ID) {
+		t.Fatalf("stranger list: %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestRegisterRoutes_SharedLinks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	ctx := context.Background()
+	cfg := config.Config{
+		APIBasePath:     "/api/v1",
+		RateRPS:         1000,
+		RateBurst:       1000,
+		SharedRateBurst: 2,
+		OTEL:            config.OTELConfig{ServiceName: "svc"},
+		Threshold:       0.2,
+		Auth:            config.AuthConfig{Mode: "header"},
+	}
+	r := gin.New()
+	RegisterRoutes(r, db, fakeIndex{}, nil, cfg)
+
+	chat, _ := repo.CreateChat(ctx, db, domain.DefaultWorkspaceID, "link-owner", "Quarterly review")
+	if _, err := repo.CreateMessage(db, chat.ID, "user", "how did we do?", nil); err != nil {
+		t.Fatalf("seed message: %v", err)
+	}
+	do := func(method, path, user, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if user != "" {
+			req.Header.Set("X-User-ID", user)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/api/v1/chats/"+chat.ID+"/share", "link-owner", `{"expires_at":"`+time.Now().Add(time.Hour).UTC().Format(time.RFC3339)+`"}`)
+	var created handlers.CreateShareLinkResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || w.Code != http.StatusCreated || created.Token == "" || created.ExpiresAt == nil {
+		t.Fatalf("create link: %d %s", w.Code, w.Body.String())
+	}
+
+	// No identity is needed (or used); user IDs are never exposed.
+	shared := "/api/v1/shared/" + created.Token
+	for _, user := range []string{"", "someone-else"} {
+		w = do(http.MethodGet, shared, user, "")
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "how did we do?") ||
+			strings.Contains(w.Body.String(), "link-owner") || strings.Contains(w.Body.String(), "user_id") {
+			t.Fatalf("shared view (%q): %d %s", user, w.Code, w.Body.String())
+		}
+	}
+
+	// Shared reads have their own per-IP bucket: it is empty now, while
+	// authenticated traffic from the same IP is unaffected.
+	if w = do(http.MethodGet, shared, "", ""); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("third shared view: %d", w.Code)
+	}
+	if w = do(http.MethodGet, "/api/v1/chats", "link-owner", ""); w.Code != http.StatusOK {
+		t.Fatalf("authenticated list: %d", w.Code)
+	}
+
+	var link domain.ShareLink
+	if err := db.Where("chat_id = ?", chat.ID).First(&link).Error; err != nil || link.Views != 2 {
+		t.Fatalf("link views = %d, %v; want 2", link.Views, err)
+	}
+}
+
+func TestRegisterRoutes_APIKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	secret := strings.Repeat("s", 32)
+	cfg := config.Config{
+		APIBasePath: "/api/v1",
+		RateRPS:     1000,
+		RateBurst:   1000,
+		OTEL:        config.OTELConfig{ServiceName: "svc"},
+		Threshold:   0.2,
+		Auth:        config.AuthConfig{Mode: "jwt", JWTSecret: secret, UserClaim: "sub"},
+	}
+	r := gin.New()
+	RegisterRoutes(r, db, fakeIndex{}, nil, cfg)
+
+	do := func(method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	bearer := map[string]string{"Authorization": "Bearer " + hs256Token(t, secret, map[string]any{"sub": "batch-owner", "exp": time.Now().Add(time.Hour).Unix()})}
+
+	// Issue a read-only key with the user's token.
+	w := do(http.MethodPost, "/api/v1/api-keys", `{"name":"dashboard","scopes":["chats:read"]}`, bearer)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create key: %d %s", w.Code, w.Body.String())
+	}
+	var created handlers.CreateAPIKeyResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || created.Key == "" {
+		t.Fatalf("decode key: %v %s", err, w.Body.String())
+	}
+	if w := do(http.MethodPost, "/api/v1/api-keys", `{"scopes":["admin"]}`, bearer); w.Code != http.StatusForbidden {
+		t.Fatalf("non-admin granting admin scope: %d", w.Code)
+	}
+
+	key := map[string]string{middleware.HeaderAPIKey: created.Key}
+	if w := do(http.MethodPost, "/api/v1/chats", `{"title":"t"}`, bearer); w.Code != http.StatusCreated {
+		t.Fatalf("create chat: %d", w.Code)
+	}
+	w = do(http.MethodGet, "/api/v1/chats", "", key)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"user_id":"batch-owner"`) {
+		t.Fatalf("list with key: %d %s", w.Code, w.Body.String())
+	}
+	for _, rt := range []struct{ method, path, body string }{
+		{http.MethodPost, "/api/v1/chats", `{"title":"t"}`},
+		{http.MethodGet, "/api/v1/api-keys", ""},
+	} {
+		if w := do(rt.method, rt.path, rt.body, key); w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `"code":"forbidden"`) {
+			t.Fatalf("%s %s without scope: %d %s", rt.method, rt.path, w.Code, w.Body.String())
+		}
+	}
+	if w := do(http.MethodGet, "/api/v1/chats", "", map[string]string{middleware.HeaderAPIKey: created.Key + "x"}); w.Code != http.StatusUnauthorized {
+		t.Fatalf("tampered key: %d", w.Code)
+	}
+
+	// The listing never exposes the secret; after revocation the key stops working.
+	w = do(http.MethodGet, "/api/v1/api-keys", "", bearer)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), created.Prefix) || strings.Contains(w.Body.String(), created.Key) {
+		t.Fatalf("list keys: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodDelete, "/api/v1/api-keys/"+created.ID, "", bearer); w.Code != http.StatusNoContent {
+		t.Fatalf("revoke: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/api/v1/chats", "", key); w.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked key: %d", w.Code)
+	}
+}
+
+// TestRegisterRoutes_WorkspaceIsolation drives the API as one user with a
+// chat in each of two workspaces and checks that nothing is reachable across
+// the X-Workspace-ID boundary.
+func TestRegisterRoutes_WorkspaceIsolation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	cfg := config.Config{
+		Auth:        config.AuthConfig{Mode: "header"},
+		APIBasePath: "/api/v1",
+		RateRPS:     1000,
+		RateBurst:   1000,
+		OTEL:        config.OTELConfig{ServiceName: "svc"},
+		Threshold:   0.2,
+	}
+	r := gin.New()
+	RegisterRoutes(r, db, fakeIndex{}, nil, cfg)
+
+	do := func(method, path, body, user, workspace string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-User-ID", user)
+		if workspace != "" {
+			req.Header.Set(middleware.HeaderWorkspaceID, workspace)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+	decode := func(w *httptest.ResponseRecorder, v any) {
+		t.Helper()
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("decode %s: %v", w.Body.String(), err)
+		}
+	}
+
+	var wsA, wsB handlers.WorkspaceResponse
+	for name, ws := range map[string]*handlers.WorkspaceResponse{"A": &wsA, "B": &wsB} {
+		w := do(http.MethodPost, "/api/v1/workspaces", `{"name":"`+name+`"}`, "tenant-user", "")
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create workspace %s: %d %s", name, w.Code, w.Body.String())
+		}
+		decode(w, ws)
+	}
+
+	// A chat with a message in A, and one in B.
+	var chatA, chatB domain.Chat
+	w := do(http.MethodPost, "/api/v1/chats", `{"title":"in A"}`, "tenant-user", wsA.ID)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create chat in A: %d %s", w.Code, w.Body.String())
+	}
+	decode(w, &chatA)
+	if chatA.WorkspaceID != wsA.ID {
+		t.Fatalf("chat A workspace = %q", chatA.WorkspaceID)
+	}
+	decode(do(http.MethodPost, "/api/v1/chats", `{"title":"in B"}`, "tenant-user", wsB.ID), &chatB)
+	msgA, err := repo.CreateMessage(db, chatA.ID, "assistant", "tenant A answer", nil)
+	if err != nil {
+		t.Fatalf("seed message: %v", err)
+	}
+
+	// Listings only show the selected workspace's chats.
+	for ws, want := range map[string]string{wsA.ID: chatA.ID, wsB.ID: chatB.ID} {
+		var list handlers.ListChatsResponse
+		decode(do(http.MethodGet, "/api/v1/chats", "", "tenant-user", ws), &list)
+		if len(list.Chats) != 1 || list.Chats[0].ID != want {
+			t.Fatalf("chats in %s = %+v", ws, list.Chats)
+		}
+	}
+	if w := do(http.MethodGet, "/api/v1/chats", "", "tenant-user", ""); strings.Contains(w.Body.String(), chatA.ID) {
+		t.Fatalf("default workspace lists chat A: %s", w.Body.String())
+	}
+
+	// Chat A is not found from B or from the default workspace.
+	base := "/api/v1/chats/" + chatA.ID
+	for _, ws := range []string{wsB.ID, ""} {
+		for _, rt := range []struct{ method, path, body string }{
+			{http.MethodGet, base + "/messages", ""},
+			{http.MethodPost, base + "/messages", `{"content":"hello"}`},
+			{http.MethodPut, base + "/title", `{"title":"x"}`},
+			{http.MethodGet, base + "/shares", ""},
+			{http.MethodDelete, base, ""},
+			{http.MethodPost, "/api/v1/messages/" + msgA.ID + "/feedback", `{"value":1}`},
+			{http.MethodGet, "/api/v1/messages/" + msgA.ID + "/branches", ""},
+		} {
+			w := do(rt.method, rt.path, rt.body, "tenant-user", ws)
+			if w.Code != http.StatusNotFound || strings.Contains(w.Body.String(), "tenant A") {
+				t.Fatalf("%s %s from %q: %d %s", rt.method, rt.path, ws, w.Code, w.Body.String())
+			}
+		}
+	}
+
+	// Outsiders cannot select the workspace at all.
+	if w := do(http.MethodGet, "/api/v1/chats", "", "outsider", wsA.ID); w.Code != http.StatusNotFound {
+		t.Fatalf("outsider selecting A: %d", w.Code)
+	}
+	if w := do(http.MethodGet, "/api/v1/chats", "", "tenant-user", "not-a-uuid"); w.Code != http.StatusBadRequest {
+		t.Fatalf("malformed workspace: %d", w.Code)
+	}
+
+	// Once added as a member, another user sees A's chats only when shared.
+	if w := do(http.MethodPut, "/api/v1/workspaces/"+wsA.ID+"/members/teammate", `{"role":"member"}`, "tenant-user", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("add member: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, base+"/messages", "", "teammate", wsA.ID); w.Code != http.StatusNotFound {
+		t.Fatalf("teammate reading unshared chat: %d", w.Code)
+	}
+}
+
+func TestRegisterRoutes_Quotas(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := newTestDB(t)
+	secret := strings.Repeat("s", 32)
+	cfg := config.Config{
+		APIBasePath: "/api/v1",
+		RateRPS:     1000,
+		RateBurst:   1000,
+		OTEL:        config.OTELConfig{ServiceName: "svc"},
+		Threshold:   0.2,
+		Auth: config.AuthConfig{
+			Mode:       "jwt",
+			JWTSecret:  secret,
+			UserClaim:  "sub",
+			RolesClaim: "roles",
+			AdminRole:  "admin",
+		},
+		Quota: config.QuotaConfig{User: config.QuotaLimits{MessagesPerDay: 1, ChatsPerMonth: 5}},
+	}
+	r := gin.New()
+	RegisterRoutes(r, db, fakeIndex{}, nil, cfg)
+
+	exp := time.Now().Add(time.Hour).Unix()
+	user := hs256Token(t, secret, map[string]any{"sub": "quota-user", "exp": exp})
+	admin := hs256Token(t, secret, map[string]any{"sub": "quota-ops", "roles": []string{"admin"}, "exp": exp})
+	do := func(method, path, body, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/api/v1/chats", `{"title":"quota"}`, user)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create chat: %d %s", w.Code, w.Body.String())
+	}
+	var chat domain.Chat
+	_ = json.Unmarshal(w.Body.Bytes(), &chat)
+	msgs := "/api/v1/chats/" + chat.ID + "/messages"
+
+	// An invalid message does not use up the daily quota; a valid one does.
+	if w := do(http.MethodPost, msgs, `{"content":""}`, user); w.Code != http.StatusBadRequest {
+		t.Fatalf("empty message: %d", w.Code)
+	}
+	if w := do(http.MethodPost, msgs, `{"content":"hello"}`, user); w.Code != http.StatusOK && w.Code != http.StatusCreated {
+		t.Fatalf("first message: %d %s", w.Code, w.Body.String())
+	}
+	w = do(http.MethodPost, msgs, `{"content":"again"}`, user)
+	if w.Code != http.StatusTooManyRequests || !strings.Contains(w.Body.String(), `"code":"quota_exceeded"`) ||
+		w.Header().Get(middleware.HeaderQuotaScope) != "user:day" || w.Header().Get(middleware.HeaderQuotaLimit) != "1" ||
+		w.Header().Get("Retry-After") == "" || w.Header().Get(middleware.HeaderQuotaReset) == "" {
+		t.Fatalf("second message: %d %v %s", w.Code, w.Header(), w.Body.String())
+	}
+
+	var usage handlers.UsageResponse
+	w = do(http.MethodGet, "/api/v1/me/usage", "", user)
+	if err := json.Unmarshal(w.Body.Bytes(), &usage); err != nil || len(usage.Usage) != 4 {
+		t.Fatalf("usage: %d %s", w.Code, w.Body.String())
+	}
+	if u := usage.Usage[0]; u.Metric != domain.UsageMessages || u.Used != 1 || u.Limit != 1 {
+		t.Fatalf("daily messages = %+v", u)
+	}
+	if u := usage.Usage[3]; u.Metric != domain.UsageChats || u.Period != domain.PeriodMonth || u.Used != 1 || *u.Remaining != 4 {
+		t.Fatalf("monthly chats = %+v", u)
+	}
+
+	// Only admins manage overrides; raising the limit lets the user continue.
+	quota := "/api/v1/users/quota-user/quota"
+	if w := do(http.MethodPut, quota, `{"messages_per_day":3}`, user); w.Code != http.StatusForbidden {
+		t.Fatalf("user override: %d", w.Code)
+	}
+	if w := do(http.MethodPut, quota, `{"messages_per_day":3}`, admin); w.Code != http.StatusOK {
+		t.Fatalf("admin override: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPost, msgs, `{"content":"again"}`, user); w.Code == http.StatusTooManyRequests {
+		t.Fatalf("message after override still limited")
+	}
+	if w := do(http.MethodDelete, quota, "", admin); w.Code != http.StatusNoContent {
+		t.Fatalf("delete override: %d", w.Code)
+	}
+}
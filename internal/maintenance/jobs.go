@@ -0,0 +1,55 @@
+package maintenance
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/tbourn/go-chat-backend/internal/repo"
+)
+
+// DBLeases returns Leases stored in the job_leases table of db (see
+// repo.AcquireJobLease), shared by every replica using it.
+func DBLeases(db *gorm.DB) Leases { return dbLeases{db} }
+
+type dbLeases struct{ db *gorm.DB }
+
+func (l dbLeases) Acquire(ctx context.Context, name, holder string, now, until time.Time) (bool, error) {
+	return repo.AcquireJobLease(ctx, l.db, name, holder, now, until)
+}
+
+// IdempotencyGC deletes expired idempotency records every interval.
+func IdempotencyGC(db *gorm.DB, every time.Duration) Job {
+	return Job{
+		Name:  "idempotency_gc",
+		Every: every,
+		Run: func(ctx context.Context) (int64, error) {
+			return repo.DeleteExpiredIdempotency(ctx, db, time.Now().UTC())
+		},
+	}
+}
+
+// ChatPurge hard-deletes chats soft-deleted more than retention ago, with
+// everything that belongs to them, every interval.
+func ChatPurge(db *gorm.DB, every, retention time.Duration) Job {
+	return Job{
+		Name:  "chat_purge",
+		Every: every,
+		Run: func(ctx context.Context) (int64, error) {
+			return repo.PurgeDeletedChats(ctx, db, time.Now().UTC().Add(-retention))
+		},
+	}
+}
+
+// SQLiteOptimize runs PRAGMA optimize and a WAL checkpoint every interval;
+// rows are the checkpointed WAL frames.
+func SQLiteOptimize(db *gorm.DB, every time.Duration) Job {
+	return Job{
+		Name:  "sqlite_optimize",
+		Every: every,
+		Run: func(ctx context.Context) (int64, error) {
+			return repo.OptimizeSQLite(ctx, db)
+		},
+	}
+}
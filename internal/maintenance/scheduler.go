@@ -0,0 +1,227 @@
+// Package maintenance runs periodic background jobs inside the server
+// process: garbage collection of expired idempotency records, purging of
+// soft-deleted chats past their retention, SQLite housekeeping and rate
+// limiter bucket eviction.
+//
+// Each Job runs on its own interval, spread by a random jitter so replicas
+// (and jobs sharing an interval) do not hit the database in lockstep. Within
+// a process a job runs in a single goroutine, so it never overlaps itself.
+// Across replicas, a Scheduler with Leases takes the job's lease before each
+// run: the replica holding it keeps it for one interval, and the others skip
+// their runs meanwhile, so each shared job runs on one replica at a time.
+// Local jobs, which act on process state, skip the lease. Runs, failures,
+// skips, durations and affected rows are exported as Prometheus metrics
+// labelled by job name.
+package maintenance
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	zlog "github.com/rs/zerolog/log"
+)
+
+var (
+	jobRuns = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "maintenance_job_runs_total",
+			Help: "Maintenance job runs, successful or not.",
+		},
+		[]string{"job"},
+	)
+	jobFailures = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "maintenance_job_failures_total",
+			Help: "Maintenance job runs that returned an error.",
+		},
+		[]string{"job"},
+	)
+	jobSkipped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "maintenance_job_skipped_total",
+			Help: "Maintenance job runs skipped because another replica held the job's lease.",
+		},
+		[]string{"job"},
+	)
+	jobRows = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "maintenance_job_rows_affected_total",
+			Help: "Rows (or other items) removed or rewritten by maintenance jobs.",
+		},
+		[]string{"job"},
+	)
+	jobDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "maintenance_job_duration_seconds",
+			Help:    "Duration of maintenance job runs in seconds.",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"job"},
+	)
+)
+
+func init() {
+	prometheus.MustRegister(jobRuns, jobFailures, jobSkipped, jobRows, jobDuration)
+}
+
+// Job is a periodic maintenance task.
+type Job struct {
+	Name  string        // metric label and log field, e.g. "idempotency_gc"
+	Every time.Duration // interval between runs; <= 0 disables the job
+	// Run does one pass and returns how many rows (or other items) it
+	// affected. It should return promptly once ctx is done.
+	Run func(ctx context.Context) (rows int64, err error)
+	// Local jobs act on state of their own process (e.g. in-memory
+	// buckets), so every replica runs them without taking the lease.
+	Local bool
+}
+
+// Leases grants job leases shared by all replicas.
+//
+// Acquire takes the lease of job name for holder until the given time and
+// reports whether holder has it: it fails while another holder's lease has
+// not expired at now, and renews a lease holder already has.
+type Leases interface {
+	Acquire(ctx context.Context, name, holder string, now, until time.Time) (bool, error)
+}
+
+// Scheduler runs Jobs in background goroutines between Start and Stop.
+type Scheduler struct {
+	jitter float64
+	jobs   []Job
+	rand   func() float64 // uniform in [0, 1)
+	now    func() time.Time
+
+	leases Leases // nil runs every job on every replica
+	holder string // identifies this Scheduler to leases
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New returns a Scheduler for the enabled jobs (Every > 0). jitter, clamped
+// to [0, 1], spreads each wait uniformly over Every ± jitter·Every; the first
+// run of a job happens after a random delay of up to jitter·Every.
+func New(jitter float64, jobs ...Job) *Scheduler {
+	s := &Scheduler{jitter: min(max(jitter, 0), 1), rand: rand.Float64, now: time.Now, holder: uuid.NewString()}
+	for _, j := range jobs {
+		if j.Every > 0 && j.Run != nil {
+			s.jobs = append(s.jobs, j)
+		}
+	}
+	return s
+}
+
+// WithLeases makes the Scheduler take each job's lease from l before running
+// it (see Leases), except for Local jobs.
+func (s *Scheduler) WithLeases(l Leases) *Scheduler {
+	s.leases = l
+	return s
+}
+
+// Jobs returns the names of the enabled jobs.
+func (s *Scheduler) Jobs() []string {
+	names := make([]string, len(s.jobs))
+	for i, e := range s.jobs {
+		names[i] = e.Name
+	}
+	return names
+}
+
+// Start launches the jobs. They stop when ctx is done or Stop is called.
+// Calling Start on a running Scheduler does nothing.
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.cancel != nil {
+		return
+	}
+	ctx, s.cancel = context.WithCancel(ctx)
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.loop(ctx, j)
+		}()
+	}
+}
+
+// Stop cancels the jobs and waits for running ones to return.
+func (s *Scheduler) Stop() {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	s.wg.Wait()
+}
+
+// loop runs j until ctx is done.
+func (s *Scheduler) loop(ctx context.Context, j Job) {
+	t := time.NewTimer(s.delay(j.Every, true))
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		s.run(ctx, j)
+		t.Reset(s.delay(j.Every, false))
+	}
+}
+
+// delay returns the wait before the next run of a job running every d: a
+// random share of the jitter window before the first run, else d ± jitter.
+func (s *Scheduler) delay(d time.Duration, first bool) time.Duration {
+	window := float64(d) * s.jitter
+	if first {
+		return time.Duration(window * s.rand())
+	}
+	return d + time.Duration(window*(2*s.rand()-1))
+}
+
+// run executes j once, recording metrics. A leased job is skipped, and run
+// reports false, while another replica holds its lease. The lease is kept
+// for one interval, so the holder's next run renews it and the other
+// replicas skip theirs; a run outliving its interval lets another replica
+// take over.
+func (s *Scheduler) run(ctx context.Context, j Job) bool {
+	start := s.now()
+	if s.leases != nil && !j.Local {
+		held, err := s.leases.Acquire(ctx, j.Name, s.holder, start, start.Add(j.Every))
+		switch {
+		case err != nil && ctx.Err() == nil:
+			jobFailures.WithLabelValues(j.Name).Inc()
+			zlog.Warn().Err(err).Str("job", j.Name).Msg("maintenance job lease failed; skipping run")
+			return false
+		case err != nil:
+			return false
+		case !held:
+			jobSkipped.WithLabelValues(j.Name).Inc()
+			return false
+		}
+	}
+	rows, err := j.Run(ctx)
+	jobDuration.WithLabelValues(j.Name).Observe(time.Since(start).Seconds())
+	jobRuns.WithLabelValues(j.Name).Inc()
+	if rows > 0 {
+		jobRows.WithLabelValues(j.Name).Add(float64(rows))
+	}
+	switch {
+	case err != nil && ctx.Err() == nil:
+		jobFailures.WithLabelValues(j.Name).Inc()
+		zlog.Warn().Err(err).Str("job", j.Name).Msg("maintenance job failed")
+	case err != nil:
+		// Cancelled by shutdown; not a failure.
+	case rows > 0:
+		zlog.Info().Str("job", j.Name).Int64("rows", rows).Dur("took", time.Since(start)).Msg("maintenance job done")
+	}
+	return true
+}
@@ -0,0 +1,216 @@
+package maintenance
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gorm.io/gorm"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/repo"
+)
+
+func TestScheduler_RunsEnabledJobsUntilStopped(t *testing.T) {
+	var fast, disabled atomic.Int32
+	s := New(0.5,
+		Job{Name: "fast", Every: 5 * time.Millisecond, Run: func(context.Context) (int64, error) {
+			fast.Add(1)
+			return 0, nil
+		}},
+		Job{Name: "disabled", Every: 0, Run: func(context.Context) (int64, error) {
+			disabled.Add(1)
+			return 0, nil
+		}},
+	)
+	if got := s.Jobs(); len(got) != 1 || got[0] != "fast" {
+		t.Fatalf("Jobs = %v", got)
+	}
+
+	s.Start(context.Background())
+	s.Start(context.Background()) // no-op
+	deadline := time.Now().Add(2 * time.Second)
+	for fast.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	s.Stop()
+	runs := fast.Load()
+	if runs < 3 {
+		t.Fatalf("fast job ran %d times", runs)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if fast.Load() != runs || disabled.Load() != 0 {
+		t.Fatalf("jobs ran after Stop or while disabled: fast %d→%d, disabled %d", runs, fast.Load(), disabled.Load())
+	}
+	s.Stop() // idempotent
+}
+
+func TestScheduler_StopCancelsRunningJob(t *testing.T) {
+	started := make(chan struct{})
+	s := New(0, Job{Name: "slow", Every: time.Millisecond, Run: func(ctx context.Context) (int64, error) {
+		close(started)
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}})
+	failures := testutil.ToFloat64(jobFailures.WithLabelValues("slow"))
+	s.Start(context.Background())
+	<-started
+	s.Stop()
+	// Cancellation by shutdown is not a failure.
+	if got := testutil.ToFloat64(jobFailures.WithLabelValues("slow")); got != failures {
+		t.Fatalf("failures = %v", got)
+	}
+}
+
+func TestScheduler_RunMetrics(t *testing.T) {
+	fail := false
+	s := New(0, Job{Name: "test_job", Every: time.Hour, Run: func(context.Context) (int64, error) {
+		if fail {
+			return 0, errors.New("boom")
+		}
+		return 3, nil
+	}})
+	j := s.jobs[0]
+	runs := testutil.ToFloat64(jobRuns.WithLabelValues("test_job"))
+	rows := testutil.ToFloat64(jobRows.WithLabelValues("test_job"))
+	failures := testutil.ToFloat64(jobFailures.WithLabelValues("test_job"))
+
+	s.run(context.Background(), j)
+	fail = true
+	s.run(context.Background(), j)
+
+	if got := testutil.ToFloat64(jobRuns.WithLabelValues("test_job")) - runs; got != 2 {
+		t.Fatalf("runs = %v", got)
+	}
+	if got := testutil.ToFloat64(jobRows.WithLabelValues("test_job")) - rows; got != 3 {
+		t.Fatalf("rows = %v", got)
+	}
+	if got := testutil.ToFloat64(jobFailures.WithLabelValues("test_job")) - failures; got != 1 {
+		t.Fatalf("failures = %v", got)
+	}
+}
+
+func TestScheduler_LeaseSkipsOtherReplicas(t *testing.T) {
+	db := newJobDB(t)
+	var runs atomic.Int32
+	job := Job{Name: "leased_job", Every: time.Hour, Run: func(context.Context) (int64, error) {
+		runs.Add(1)
+		return 0, nil
+	}}
+	local := Job{Name: "local_job", Every: time.Hour, Local: true, Run: func(context.Context) (int64, error) {
+		runs.Add(1)
+		return 0, nil
+	}}
+	a := New(0, job, local).WithLeases(DBLeases(db))
+	b := New(0, job, local).WithLeases(DBLeases(db))
+	now := time.Now()
+	a.now = func() time.Time { return now }
+	b.now = a.now
+	skipped := testutil.ToFloat64(jobSkipped.WithLabelValues("leased_job"))
+	ctx := context.Background()
+
+	if !a.run(ctx, job) {
+		t.Fatalf("first holder did not run")
+	}
+	// While a holds the lease, b skips the job; a renews it on its next run.
+	if b.run(ctx, job) {
+		t.Fatalf("second holder ran")
+	}
+	if !a.run(ctx, job) {
+		t.Fatalf("holder could not run again")
+	}
+	if got := testutil.ToFloat64(jobSkipped.WithLabelValues("leased_job")) - skipped; got != 1 {
+		t.Fatalf("skipped = %v", got)
+	}
+	// Local jobs run everywhere.
+	if !a.run(ctx, local) || !b.run(ctx, local) {
+		t.Fatalf("local job skipped")
+	}
+	// Once a's lease expires, b takes it over.
+	b.now = func() time.Time { return now.Add(time.Hour) }
+	if !b.run(ctx, job) {
+		t.Fatalf("expired lease not taken over")
+	}
+	if runs.Load() != 5 {
+		t.Fatalf("runs = %d, want 5", runs.Load())
+	}
+}
+
+func TestScheduler_Delay(t *testing.T) {
+	s := New(0.2)
+	for _, tc := range []struct {
+		rand  float64
+		first bool
+		want  time.Duration
+	}{
+		{0, true, 0},
+		{0.5, true, time.Second},
+		{0, false, 8 * time.Second},
+		{0.5, false, 10 * time.Second},
+		{0.75, false, 11 * time.Second},
+	} {
+		s.rand = func() float64 { return tc.rand }
+		if got := s.delay(10*time.Second, tc.first); got != tc.want {
+			t.Fatalf("delay(rand=%v, first=%v) = %v, want %v", tc.rand, tc.first, got, tc.want)
+		}
+	}
+	if New(-1).jitter != 0 || New(3).jitter != 1 {
+		t.Fatalf("jitter not clamped")
+	}
+}
+
+func newJobDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := repo.OpenSQLite(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		t.Cleanup(func() { _ = sqlDB.Close() })
+	}
+	if err := repo.AutoMigrate(db); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+	return db
+}
+
+func TestJobs(t *testing.T) {
+	db := newJobDB(t)
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	for i, exp := range []time.Time{now.Add(-time.Minute), now.Add(time.Hour)} {
+		rec := &domain.Idempotency{
+			WorkspaceID: domain.DefaultWorkspaceID,
+			UserID:      "u1",
+			Key:         []string{"expired", "live"}[i],
+			ExpiresAt:   exp,
+		}
+		if err := repo.CreateIdempotency(ctx, db, rec); err != nil {
+			t.Fatalf("seed idempotency: %v", err)
+		}
+	}
+	if n, err := IdempotencyGC(db, time.Minute).Run(ctx); n != 1 || err != nil {
+		t.Fatalf("idempotency_gc = %d, %v", n, err)
+	}
+
+	old, _ := repo.CreateChat(ctx, db, domain.DefaultWorkspaceID, "u1", "old")
+	recent, _ := repo.CreateChat(ctx, db, domain.DefaultWorkspaceID, "u1", "recent")
+	_ = repo.DeleteChat(ctx, db, domain.DefaultWorkspaceID, old.ID, "u1", 0, now.Add(-48*time.Hour))
+	_ = repo.DeleteChat(ctx, db, domain.DefaultWorkspaceID, recent.ID, "u1", 0, now)
+	if n, err := ChatPurge(db, time.Hour, 24*time.Hour).Run(ctx); n != 1 || err != nil {
+		t.Fatalf("chat_purge = %d, %v", n, err)
+	}
+
+	job := SQLiteOptimize(db, time.Hour)
+	if job.Name != "sqlite_optimize" || job.Every != time.Hour {
+		t.Fatalf("job = %+v", job)
+	}
+	if _, err := job.Run(ctx); err != nil {
+		t.Fatalf("sqlite_optimize: %v", err)
+	}
+}
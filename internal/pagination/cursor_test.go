@@ -0,0 +1,68 @@
+package pagination
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCodec_RoundTripAndTampering(t *testing.T) {
+	c := NewCodec([]byte("0123456789abcdef0123456789abcdef"))
+	cur := Cursor{CreatedAt: time.Date(2025, 5, 1, 12, 0, 0, 123456789, time.UTC), ID: "141add05-4415-4938-b5a1-17e0d3171aff"}
+
+	tok := c.Encode("chats", cur)
+	got, err := c.Decode("chats", tok)
+	if err != nil || !got.CreatedAt.Equal(cur.CreatedAt) || got.ID != cur.ID {
+		t.Fatalf("Decode = %+v, %v", got, err)
+	}
+
+	// Flip one bit of the payload.
+	b := []byte(tok)
+	b[2] ^= 1
+	for name, bad := range map[string]struct{ scope, token string }{
+		"tampered":    {"chats", string(b)},
+		"other scope": {"messages:x", tok},
+		"other key":   {"chats", NewCodec([]byte("another key")).Encode("chats", cur)},
+		"not base64":  {"chats", "!!!"},
+		"too short":   {"chats", "AAAA"},
+		"empty":       {"chats", ""},
+	} {
+		if _, err := c.Decode(bad.scope, bad.token); !errors.Is(err, ErrInvalidCursor) {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+
+	// Without a key, tokens only verify with the same Codec.
+	r1, r2 := NewCodec(nil), NewCodec(nil)
+	if _, err := r1.Decode("chats", r1.Encode("chats", cur)); err != nil {
+		t.Fatalf("random key round trip: %v", err)
+	}
+	if _, err := r2.Decode("chats", r1.Encode("chats", cur)); err == nil {
+		t.Fatalf("random keys should differ")
+	}
+}
+
+func TestPage_AscendingAndTrim(t *testing.T) {
+	for _, tc := range []struct {
+		p    Page
+		want bool
+	}{
+		{Page{}, true},
+		{Page{Backward: true}, false},
+		{Page{Desc: true}, false},
+		{Page{Desc: true, Backward: true}, true},
+	} {
+		if got := tc.p.Ascending(); got != tc.want {
+			t.Fatalf("%+v.Ascending() = %v", tc.p, got)
+		}
+	}
+
+	items, more := Trim([]int{1, 2, 3}, Page{Limit: 2})
+	if !more || len(items) != 2 || items[0] != 1 || items[1] != 2 {
+		t.Fatalf("forward Trim = %v, %v", items, more)
+	}
+	items, more = Trim([]int{3, 2}, Page{Limit: 2, Backward: true})
+	if more || items[0] != 2 || items[1] != 3 {
+		t.Fatalf("backward Trim = %v, %v", items, more)
+	}
+}
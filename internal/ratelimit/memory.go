@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// visitor holds a single rate limiter and the last time it was seen.
+// Used to opportunistically evict idle buckets.
+type visitor struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// Memory is a process-local Store with one golang.org/x/time/rate limiter
+// per key.
+//
+// Buckets are created on demand and stored in a map guarded by a mutex. Idle
+// buckets are evicted after a TTL via opportunistic cleanup during lookups
+// (and by Evict) to keep memory usage bounded. It never returns an error and
+// accepts a zero rate (the burst is then never replenished).
+type Memory struct {
+	mu       sync.Mutex
+	visitors map[string]*visitor
+
+	ttl      time.Duration
+	cleanupN uint64
+}
+
+// NewMemory returns an empty in-memory store.
+func NewMemory() *Memory {
+	return &Memory{
+		visitors: make(map[string]*visitor),
+		ttl:      10 * time.Minute, // evict idle entries after TTL
+	}
+}
+
+// Allow implements Store. A denied request's RetryAfter is the delay of a
+// reservation for cost tokens, which is then cancelled.
+func (m *Memory) Allow(_ context.Context, key string, l Limit, cost int) (Result, error) {
+	now := time.Now()
+	lim := m.getVisitor(key, l, now)
+
+	res := Result{Allowed: true, Limit: l.Burst}
+	r := lim.ReserveN(now, cost)
+	switch delay := r.DelayFrom(now); {
+	case !r.OK():
+		// cost exceeds the burst: never satisfiable, nothing was reserved.
+		res.Allowed = false
+	case delay > 0:
+		res.Allowed = false
+		res.RetryAfter = delay
+		r.CancelAt(now)
+	}
+
+	tokens := lim.TokensAt(now)
+	res.Remaining = max(int(tokens), 0)
+	if l.Rate > 0 {
+		res.ResetAfter = time.Duration((float64(l.Burst) - tokens) / l.Rate * float64(time.Second))
+	}
+	return res, nil
+}
+
+// Evict removes buckets idle for at least the TTL and returns how many were
+// removed. Such buckets are full again, so evicting them changes nothing.
+func (m *Memory) Evict(now time.Time) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.evictLocked(now)
+}
+
+func (m *Memory) evictLocked(now time.Time) int {
+	n := 0
+	for k, vv := range m.visitors {
+		// Evict if idle for >= TTL (robust boundary check)
+		if now.Sub(vv.lastSeen) >= m.ttl {
+			delete(m.visitors, k)
+			n++
+		}
+	}
+	return n
+}
+
+// Len returns the number of buckets currently held.
+func (m *Memory) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.visitors)
+}
+
+// getVisitor returns (and updates) the limiter for key, creating it if absent.
+// It also performs opportunistic GC of idle entries after ~5000 lookups.
+//
+// IMPORTANT: Run GC *before* touching the requested visitor so an "old" bucket
+// can be evicted even when it's the one being fetched.
+func (m *Memory) getVisitor(key string, l Limit, now time.Time) *rate.Limiter {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// Opportunistic cleanup after a threshold of lookups, then reset the counter.
+	m.cleanupN++
+	if m.cleanupN >= 5000 {
+		m.evictLocked(now)
+		m.cleanupN = 0
+	}
+
+	// Fetch or create this visitor, following limit changes.
+	if v, ok := m.visitors[key]; ok {
+		v.lastSeen = now
+		if v.limiter.Limit() != rate.Limit(l.Rate) {
+			v.limiter.SetLimitAt(now, rate.Limit(l.Rate))
+		}
+		if v.limiter.Burst() != l.Burst {
+			v.limiter.SetBurstAt(now, l.Burst)
+		}
+		return v.limiter
+	}
+
+	lim := rate.NewLimiter(rate.Limit(l.Rate), l.Burst)
+	m.visitors[key] = &visitor{limiter: lim, lastSeen: now}
+	return lim
+}
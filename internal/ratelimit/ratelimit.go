@@ -0,0 +1,86 @@
+// Package ratelimit provides the storage backends behind the HTTP rate
+// limiter (see middleware.RateLimiter).
+//
+// A Store keeps one token bucket per key (e.g. "user:<id>" or "ip:<addr>")
+// and decides whether a request may spend cost tokens from it. Three
+// backends are available:
+//
+//   - Memory: process-local buckets (golang.org/x/time/rate). Fast, but every
+//     replica enforces its own limit and state is lost on restart.
+//   - Redis: buckets shared by all replicas, kept in any server speaking the
+//     Redis protocol and updated atomically by a GCRA Lua script.
+//   - SQLite: buckets persisted in the application database, for single-node
+//     deployments that should keep limits across restarts.
+//
+// The shared backends implement the Generic Cell Rate Algorithm (GCRA), which
+// is equivalent to a token bucket but stores a single timestamp per key.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+)
+
+// ErrInvalidLimit is returned by the shared stores for limits they cannot
+// enforce (a non-positive rate or burst). The middleware then falls back to
+// local limiting.
+var ErrInvalidLimit = errors.New("ratelimit: rate and burst must be positive")
+
+// Limit describes a token bucket.
+type Limit struct {
+	Rate  float64 // tokens replenished per second
+	Burst int     // bucket size
+}
+
+// Result is the outcome of a Store.Allow call.
+type Result struct {
+	Allowed    bool
+	Limit      int           // bucket size (Limit.Burst)
+	Remaining  int           // tokens left after this request
+	RetryAfter time.Duration // when denied: wait before the request could succeed
+	ResetAfter time.Duration // until the bucket is full again
+}
+
+// Store decides whether a request may spend cost tokens from key's bucket.
+// Implementations must be safe for concurrent use. A non-nil error means the
+// store itself failed (e.g. the Redis server is unreachable).
+type Store interface {
+	Allow(ctx context.Context, key string, limit Limit, cost int) (Result, error)
+}
+
+// emissionInterval returns the time, in microseconds, needed to replenish
+// one token (at least 1).
+func emissionInterval(l Limit) int64 {
+	return max(int64(math.Round(1e6/l.Rate)), 1)
+}
+
+// valid reports whether the shared stores can enforce l.
+func (l Limit) valid() bool { return l.Rate > 0 && l.Burst > 0 }
+
+// gcra applies a request of cost tokens at now to a bucket whose theoretical
+// arrival time is tat (all in Unix microseconds; tat 0 is a new, full
+// bucket). interval is the emission interval of one token. It returns the
+// TAT to store, which is unchanged when the request is denied.
+//
+// The Lua script in redis.go implements the same arithmetic; keep them in
+// sync.
+func gcra(now, tat, interval int64, burst, cost int) (int64, Result) {
+	tat = max(tat, now)
+	newTAT := tat + interval*int64(cost)
+	diff := now - (newTAT - interval*int64(burst))
+	if diff < 0 {
+		return tat, Result{
+			Limit:      burst,
+			RetryAfter: time.Duration(-diff) * time.Microsecond,
+			ResetAfter: time.Duration(tat-now) * time.Microsecond,
+		}
+	}
+	return newTAT, Result{
+		Allowed:    true,
+		Limit:      burst,
+		Remaining:  int(diff / interval),
+		ResetAfter: time.Duration(newTAT-now) * time.Microsecond,
+	}
+}
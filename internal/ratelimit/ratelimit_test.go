@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+func TestGCRA(t *testing.T) {
+	const sec = int64(time.Second / time.Microsecond)
+	l := Limit{Rate: 2, Burst: 3} // one token every 500ms
+	interval := emissionInterval(l)
+	if interval != sec/2 {
+		t.Fatalf("interval = %d", interval)
+	}
+
+	now, tat := 10*sec, int64(0)
+	for i, wantRemaining := range []int{2, 1, 0} {
+		var res Result
+		tat, res = gcra(now, tat, interval, l.Burst, 1)
+		if !res.Allowed || res.Remaining != wantRemaining || res.Limit != 3 {
+			t.Fatalf("request %d = %+v", i, res)
+		}
+	}
+	stored := tat
+	tat, res := gcra(now, tat, interval, l.Burst, 1)
+	if res.Allowed || tat != stored || res.RetryAfter != 500*time.Millisecond || res.ResetAfter != 1500*time.Millisecond {
+		t.Fatalf("over burst = %+v (tat %d)", res, tat)
+	}
+
+	// One interval later a single token is back.
+	now += interval
+	if _, res = gcra(now, tat, interval, l.Burst, 1); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("after refill = %+v", res)
+	}
+	// A cost larger than what is left is denied without spending anything.
+	if _, res = gcra(now, tat, interval, l.Burst, 2); res.Allowed || res.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("cost 2 = %+v", res)
+	}
+	// Long idle buckets are full, not over-full.
+	if _, res = gcra(now+100*sec, tat, interval, l.Burst, 1); !res.Allowed || res.Remaining != 2 {
+		t.Fatalf("idle = %+v", res)
+	}
+}
+
+func TestMemory_Allow(t *testing.T) {
+	m := NewMemory()
+	ctx := context.Background()
+	l := Limit{Rate: 1, Burst: 2}
+
+	for i := 0; i < 2; i++ {
+		if res, err := m.Allow(ctx, "k", l, 1); err != nil || !res.Allowed || res.Remaining != 1-i {
+			t.Fatalf("request %d = %+v, %v", i, res, err)
+		}
+	}
+	res, _ := m.Allow(ctx, "k", l, 1)
+	if res.Allowed || res.RetryAfter <= 0 || res.RetryAfter > time.Second || res.ResetAfter > 2*time.Second {
+		t.Fatalf("denied = %+v", res)
+	}
+	// Keys are independent; a new limit applies to existing buckets.
+	if res, _ := m.Allow(ctx, "other", l, 2); !res.Allowed {
+		t.Fatalf("other key = %+v", res)
+	}
+	if res, _ := m.Allow(ctx, "k", Limit{Rate: 1, Burst: 5}, 1); res.Limit != 5 || res.ResetAfter <= 2*time.Second {
+		t.Fatalf("raised burst = %+v", res)
+	}
+	// A cost above the burst can never be served.
+	if res, _ := m.Allow(ctx, "big", l, 3); res.Allowed || res.Remaining != 2 {
+		t.Fatalf("cost above burst = %+v", res)
+	}
+	if m.Len() != 3 {
+		t.Fatalf("Len = %d", m.Len())
+	}
+}
+
+func TestMemory_getVisitorReuse(t *testing.T) {
+	m := NewMemory()
+	l := Limit{Rate: 2, Burst: 1}
+	now := time.Now()
+
+	// First call creates limiter
+	lim := m.getVisitor("k1", l, now)
+	if lim == nil {
+		t.Fatalf("expected limiter")
+	}
+	// Second call reuses same limiter (pointer equality via map lookup)
+	if got := m.getVisitor("k1", l, now); got != lim {
+		t.Fatalf("expected same limiter instance to be reused")
+	}
+}
+
+func TestMemory_getVisitor_GC(t *testing.T) {
+	m := NewMemory()
+	// Make TTL immediate so anything old gets evicted
+	m.ttl = 1 * time.Nanosecond
+
+	// Seed an old visitor
+	m.mu.Lock()
+	m.visitors["old"] = &visitor{
+		limiter:  rate.NewLimiter(1, 1),
+		lastSeen: time.Now().Add(-time.Hour),
+	}
+	// Force cleanup to run on next getVisitor by setting cleanupN to 4999
+	m.cleanupN = 4999
+	m.mu.Unlock()
+
+	// Trigger cleanup by calling getVisitor for a different key
+	_ = m.getVisitor("new", Limit{Rate: 1, Burst: 1}, time.Now())
+
+	m.mu.Lock()
+	_, existsOld := m.visitors["old"]
+	_, existsNew := m.visitors["new"]
+	m.mu.Unlock()
+
+	if existsOld {
+		t.Fatalf("expected 'old' visitor to be evicted by opportunistic GC")
+	}
+	if !existsNew {
+		t.Fatalf("expected 'new' visitor to be created")
+	}
+
+	// Evict removes idle buckets on demand.
+	if n := m.Evict(time.Now().Add(time.Second)); n != 1 || m.Len() != 0 {
+		t.Fatalf("Evict = %d, Len = %d", n, m.Len())
+	}
+}
@@ -0,0 +1,285 @@
+package ratelimit
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// gcraScript atomically applies a GCRA request to the bucket in KEYS[1], using
+// the server clock so all replicas agree on "now".
+//
+// ARGV: emission interval (µs), burst, cost.
+// Returns {allowed (0/1), remaining, retry_after (µs), reset_after (µs)}.
+//
+// It mirrors gcra() in ratelimit.go.
+const gcraScript = `
+redis.replicate_commands()
+local interval = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local cost = tonumber(ARGV[3])
+local t = redis.call("TIME")
+local now = tonumber(t[1]) * 1000000 + tonumber(t[2])
+local tat = tonumber(redis.call("GET", KEYS[1]) or now)
+if tat < now then tat = now end
+local new_tat = tat + interval * cost
+local diff = now - (new_tat - interval * burst)
+if diff < 0 then
+  return {0, 0, -diff, tat - now}
+end
+redis.call("SET", KEYS[1], string.format("%d", new_tat), "PX", math.ceil((new_tat - now) / 1000))
+return {1, math.floor(diff / interval), 0, new_tat - now}
+`
+
+// gcraScriptSHA is the SHA1 digest EVALSHA refers to gcraScript by.
+var gcraScriptSHA = func() string {
+	sum := sha1.Sum([]byte(gcraScript))
+	return hex.EncodeToString(sum[:])
+}()
+
+// maxIdleRedisConns bounds the connections kept open between requests.
+const maxIdleRedisConns = 16
+
+// Redis is a Store shared by all replicas, kept in a server speaking the
+// Redis protocol (Redis, Valkey, KeyDB, ...). Each Allow is a single
+// EVALSHA of a GCRA script, so concurrent requests from any replica cannot
+// overspend a bucket. Keys expire on their own once their bucket is full.
+//
+// It ships a minimal RESP2 client with a small connection pool; Timeout
+// bounds every call so a slow or unreachable server fails fast (and the
+// middleware can fall back to local limiting). Safe for concurrent use.
+type Redis struct {
+	Addr     string        // host:port
+	Password string        // AUTH password; empty skips AUTH
+	DB       int           // logical database selected on connect
+	Prefix   string        // prepended to every key
+	Timeout  time.Duration // per call, including dialing
+
+	mu   sync.Mutex
+	idle []*redisConn
+}
+
+// NewRedis returns a Redis store for addr. Keys are prefixed with
+// "ratelimit:".
+func NewRedis(addr, password string, db int, timeout time.Duration) *Redis {
+	return &Redis{Addr: addr, Password: password, DB: db, Prefix: "ratelimit:", Timeout: timeout}
+}
+
+// redisError is an error reply sent by the server ("-ERR ...").
+type redisError string
+
+func (e redisError) Error() string { return "redis: " + string(e) }
+
+// Allow implements Store.
+func (r *Redis) Allow(ctx context.Context, key string, l Limit, cost int) (Result, error) {
+	if !l.valid() {
+		return Result{}, ErrInvalidLimit
+	}
+	args := []string{r.Prefix + key, strconv.FormatInt(emissionInterval(l), 10), strconv.Itoa(l.Burst), strconv.Itoa(cost)}
+	reply, err := r.do(ctx, append([]string{"EVALSHA", gcraScriptSHA, "1"}, args...)...)
+	var rerr redisError
+	if errors.As(err, &rerr) && strings.HasPrefix(string(rerr), "NOSCRIPT") {
+		// First use on this server (or after SCRIPT FLUSH): send the body,
+		// which also caches it for later EVALSHAs.
+		reply, err = r.do(ctx, append([]string{"EVAL", gcraScript, "1"}, args...)...)
+	}
+	if err != nil {
+		return Result{}, err
+	}
+	v, ok := reply.([]any)
+	if !ok || len(v) != 4 {
+		return Result{}, fmt.Errorf("redis: unexpected script reply %v", reply)
+	}
+	n := make([]int64, 4)
+	for i := range v {
+		if n[i], ok = v[i].(int64); !ok {
+			return Result{}, fmt.Errorf("redis: unexpected script reply %v", reply)
+		}
+	}
+	return Result{
+		Allowed:    n[0] == 1,
+		Limit:      l.Burst,
+		Remaining:  int(n[1]),
+		RetryAfter: time.Duration(n[2]) * time.Microsecond,
+		ResetAfter: time.Duration(n[3]) * time.Microsecond,
+	}, nil
+}
+
+// Ping checks that the server is reachable.
+func (r *Redis) Ping(ctx context.Context) error {
+	_, err := r.do(ctx, "PING")
+	return err
+}
+
+// Close closes the idle connections. Connections in use are closed when
+// they are returned.
+func (r *Redis) Close() error {
+	r.mu.Lock()
+	idle := r.idle
+	r.idle = nil
+	r.mu.Unlock()
+	for _, c := range idle {
+		c.Close()
+	}
+	return nil
+}
+
+// do sends one command and reads its reply. Connections that fail at the
+// protocol level are discarded; error replies leave them usable.
+func (r *Redis) do(ctx context.Context, args ...string) (any, error) {
+	var deadline time.Time // zero: no deadline
+	if r.Timeout > 0 {
+		deadline = time.Now().Add(r.Timeout)
+	}
+	if d, ok := ctx.Deadline(); ok && (deadline.IsZero() || d.Before(deadline)) {
+		deadline = d
+	}
+	c, err := r.get(ctx, deadline)
+	if err != nil {
+		return nil, err
+	}
+	reply, err := c.roundTrip(deadline, args...)
+	var rerr redisError
+	if err != nil && !errors.As(err, &rerr) {
+		c.Close()
+		return nil, err
+	}
+	r.put(c)
+	return reply, err
+}
+
+// get returns an idle connection or dials (and authenticates) a new one.
+func (r *Redis) get(ctx context.Context, deadline time.Time) (*redisConn, error) {
+	r.mu.Lock()
+	if n := len(r.idle); n > 0 {
+		c := r.idle[n-1]
+		r.idle = r.idle[:n-1]
+		r.mu.Unlock()
+		return c, nil
+	}
+	r.mu.Unlock()
+
+	d := net.Dialer{Deadline: deadline}
+	nc, err := d.DialContext(ctx, "tcp", r.Addr)
+	if err != nil {
+		return nil, err
+	}
+	c := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+	if r.Password != "" {
+		if _, err := c.roundTrip(deadline, "AUTH", r.Password); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	if r.DB != 0 {
+		if _, err := c.roundTrip(deadline, "SELECT", strconv.Itoa(r.DB)); err != nil {
+			c.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (r *Redis) put(c *redisConn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.idle) >= maxIdleRedisConns {
+		c.Close()
+		return
+	}
+	r.idle = append(r.idle, c)
+}
+
+// redisConn is a connection with a buffered reader for replies.
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// roundTrip writes args as a RESP array of bulk strings and reads the reply.
+func (c *redisConn) roundTrip(deadline time.Time, args ...string) (any, error) {
+	if err := c.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	if _, err := io.WriteString(c.Conn, b.String()); err != nil {
+		return nil, err
+	}
+	return readReply(c.r)
+}
+
+// readReply parses one RESP2 value: simple strings and bulk strings become
+// string (nil for null bulk strings), integers int64, arrays []any, and
+// error replies a redisError.
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < -1 {
+			return nil, fmt.Errorf("redis: malformed bulk length %q", body)
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil || n < -1 {
+			return nil, fmt.Errorf("redis: malformed array length %q", body)
+		}
+		if n == -1 {
+			return nil, nil
+		}
+		// Read every element even after an error reply so the connection
+		// stays in sync.
+		out := make([]any, n)
+		var first error
+		for i := range out {
+			out[i], err = readReply(r)
+			var rerr redisError
+			switch {
+			case errors.As(err, &rerr):
+				first = cmp.Or(first, err)
+			case err != nil:
+				return nil, err
+			}
+		}
+		if first != nil {
+			return nil, first
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("redis: unknown reply type %q", kind)
+}
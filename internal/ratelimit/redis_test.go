@@ -0,0 +1,201 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is an in-process stand-in for a Redis server. It speaks enough
+// RESP2 for the Redis store (PING, AUTH, SELECT, EVAL, EVALSHA) and runs
+// gcra() in place of the Lua script, on a clock the test controls.
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+
+	mu      sync.Mutex
+	now     int64 // µs
+	loaded  bool  // script cached (EVAL seen)
+	tats    map[string]int64
+	evals   int
+	evalSHA int
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	f := &fakeRedis{ln: ln, password: password, now: time.Second.Microseconds(), tats: map[string]int64{}}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(c)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) addr() string { return f.ln.Addr().String() }
+
+func (f *fakeRedis) advance(d time.Duration) {
+	f.mu.Lock()
+	f.now += d.Microseconds()
+	f.mu.Unlock()
+}
+
+func (f *fakeRedis) serve(c net.Conn) {
+	defer c.Close()
+	r := bufio.NewReader(c)
+	authed := f.password == ""
+	for {
+		req, err := readReply(r)
+		if err != nil {
+			return
+		}
+		parts, _ := req.([]any)
+		args := make([]string, len(parts))
+		for i, p := range parts {
+			args[i], _ = p.(string)
+		}
+		if len(args) == 0 {
+			return
+		}
+		cmd := strings.ToUpper(args[0])
+		var out string
+		switch {
+		case cmd == "AUTH":
+			if args[1] != f.password {
+				out = "-WRONGPASS invalid password\r\n"
+				break
+			}
+			authed = true
+			out = "+OK\r\n"
+		case !authed:
+			out = "-NOAUTH Authentication required.\r\n"
+		case cmd == "PING":
+			out = "+PONG\r\n"
+		case cmd == "SELECT":
+			out = "+OK\r\n"
+		case cmd == "EVAL" || cmd == "EVALSHA":
+			out = f.eval(cmd, args)
+		default:
+			out = fmt.Sprintf("-ERR unknown command '%s'\r\n", args[0])
+		}
+		if _, err := c.Write([]byte(out)); err != nil {
+			return
+		}
+	}
+}
+
+func (f *fakeRedis) eval(cmd string, args []string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if cmd == "EVALSHA" {
+		f.evalSHA++
+		if !f.loaded || args[1] != gcraScriptSHA {
+			return "-NOSCRIPT No matching script. Please use EVAL.\r\n"
+		}
+	} else {
+		f.evals++
+		if args[1] != gcraScript {
+			return "-ERR unexpected script\r\n"
+		}
+		f.loaded = true
+	}
+	key := args[3]
+	interval, _ := strconv.ParseInt(args[4], 10, 64)
+	burst, _ := strconv.Atoi(args[5])
+	cost, _ := strconv.Atoi(args[6])
+	tat, res := gcra(f.now, f.tats[key], interval, burst, cost)
+	allowed := 0
+	if res.Allowed {
+		allowed = 1
+		f.tats[key] = tat
+	}
+	return fmt.Sprintf("*4\r\n:%d\r\n:%d\r\n:%d\r\n:%d\r\n", allowed, res.Remaining,
+		res.RetryAfter.Microseconds(), res.ResetAfter.Microseconds())
+}
+
+func TestRedis_AllowSharedAcrossReplicas(t *testing.T) {
+	srv := newFakeRedis(t, "s3cret")
+	ctx := context.Background()
+	l := Limit{Rate: 1, Burst: 2}
+
+	a := NewRedis(srv.addr(), "s3cret", 2, time.Second)
+	b := NewRedis(srv.addr(), "s3cret", 2, time.Second)
+	defer a.Close()
+	defer b.Close()
+
+	if err := a.Ping(ctx); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if res, err := a.Allow(ctx, "user:u1", l, 1); err != nil || !res.Allowed || res.Remaining != 1 {
+		t.Fatalf("replica a = %+v, %v", res, err)
+	}
+	if res, err := b.Allow(ctx, "user:u1", l, 1); err != nil || !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("replica b = %+v, %v", res, err)
+	}
+	res, err := a.Allow(ctx, "user:u1", l, 1)
+	if err != nil || res.Allowed || res.RetryAfter != time.Second || res.ResetAfter != 2*time.Second || res.Limit != 2 {
+		t.Fatalf("shared limit = %+v, %v", res, err)
+	}
+
+	srv.advance(time.Second)
+	if res, _ := b.Allow(ctx, "user:u1", l, 1); !res.Allowed {
+		t.Fatalf("after refill = %+v", res)
+	}
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if _, ok := srv.tats["ratelimit:user:u1"]; !ok {
+		t.Fatalf("key not prefixed: %v", srv.tats)
+	}
+	// The script body is sent once; later calls use EVALSHA.
+	if srv.evals != 1 || srv.evalSHA != 4 {
+		t.Fatalf("evals = %d, evalsha = %d", srv.evals, srv.evalSHA)
+	}
+}
+
+func TestRedis_Errors(t *testing.T) {
+	ctx := context.Background()
+	l := Limit{Rate: 1, Burst: 1}
+
+	srv := newFakeRedis(t, "s3cret")
+	bad := NewRedis(srv.addr(), "wrong", 0, time.Second)
+	var rerr redisError
+	if _, err := bad.Allow(ctx, "k", l, 1); !errors.As(err, &rerr) {
+		t.Fatalf("wrong password: err = %v", err)
+	}
+	if _, err := bad.Allow(ctx, "k", Limit{Rate: 1}, 1); !errors.Is(err, ErrInvalidLimit) {
+		t.Fatalf("zero burst: err = %v", err)
+	}
+
+	// Nothing listening: fails within the timeout.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	down := NewRedis(addr, "", 0, 200*time.Millisecond)
+	start := time.Now()
+	if _, err := down.Allow(ctx, "k", l, 1); err == nil {
+		t.Fatalf("expected error from unreachable server")
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatalf("unreachable server took %v", time.Since(start))
+	}
+}
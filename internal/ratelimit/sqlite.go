@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+)
+
+// SQLite is a Store persisting buckets in the application database
+// (table rate_limit_buckets), so limits survive restarts of a single-node
+// deployment. Updates are serialized in-process to avoid SQLITE_BUSY; use
+// Redis when several processes share the limits.
+type SQLite struct {
+	DB *gorm.DB
+
+	mu  sync.Mutex
+	now func() time.Time // tests override it
+}
+
+// NewSQLite returns a SQLite store using db, which must have the
+// domain.RateLimitBucket table (see repo.AutoMigrate).
+func NewSQLite(db *gorm.DB) *SQLite {
+	return &SQLite{DB: db}
+}
+
+// Allow implements Store.
+func (s *SQLite) Allow(ctx context.Context, key string, l Limit, cost int) (Result, error) {
+	if !l.valid() {
+		return Result{}, ErrInvalidLimit
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock().UnixMicro()
+	var res Result
+	err := s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var b domain.RateLimitBucket
+		err := tx.Where("key = ?", key).First(&b).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+		var tat int64
+		tat, res = gcra(now, b.TAT, emissionInterval(l), l.Burst, cost)
+		if !res.Allowed {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "key"}},
+			DoUpdates: clause.AssignmentColumns([]string{"tat"}),
+		}).Create(&domain.RateLimitBucket{Key: key, TAT: tat}).Error
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return res, nil
+}
+
+// Evict deletes buckets that are full again at now (their TAT has passed)
+// and returns how many were removed.
+func (s *SQLite) Evict(ctx context.Context, now time.Time) (int64, error) {
+	res := s.DB.WithContext(ctx).Where("tat <= ?", now.UnixMicro()).Delete(&domain.RateLimitBucket{})
+	return res.RowsAffected, res.Error
+}
+
+func (s *SQLite) clock() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	sqlite "github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+)
+
+func newSQLiteStore(t *testing.T) (*SQLite, *time.Time) {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "ratelimit.db")), &gorm.Config{
+		Logger: logger.Default.LogMode(logger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open sqlite: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+	if err := db.AutoMigrate(&domain.RateLimitBucket{}); err != nil {
+		t.Fatalf("automigrate: %v", err)
+	}
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	s := NewSQLite(db)
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestSQLite_AllowPersistsBuckets(t *testing.T) {
+	s, now := newSQLiteStore(t)
+	ctx := context.Background()
+	l := Limit{Rate: 1, Burst: 2}
+
+	for i := 0; i < 2; i++ {
+		if res, err := s.Allow(ctx, "user:a", l, 1); err != nil || !res.Allowed {
+			t.Fatalf("request %d = %+v, %v", i, res, err)
+		}
+	}
+	res, err := s.Allow(ctx, "user:a", l, 1)
+	if err != nil || res.Allowed || res.RetryAfter != time.Second {
+		t.Fatalf("over burst = %+v, %v", res, err)
+	}
+
+	// A new store on the same database (a restart) sees the same bucket.
+	restarted := NewSQLite(s.DB)
+	restarted.now = s.now
+	if res, _ := restarted.Allow(ctx, "user:a", l, 1); res.Allowed {
+		t.Fatalf("limit lost across restart: %+v", res)
+	}
+
+	*now = now.Add(time.Second)
+	if res, _ := restarted.Allow(ctx, "user:a", l, 1); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("after refill = %+v", res)
+	}
+
+	if _, err := s.Allow(ctx, "user:a", Limit{Rate: 0, Burst: 1}, 1); !errors.Is(err, ErrInvalidLimit) {
+		t.Fatalf("zero rate: err = %v", err)
+	}
+}
+
+func TestSQLite_ConcurrentAndEvict(t *testing.T) {
+	s, now := newSQLiteStore(t)
+	ctx := context.Background()
+	l := Limit{Rate: 1, Burst: 5}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		allowed int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if res, err := s.Allow(ctx, "ip:1", l, 1); err == nil && res.Allowed {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 5 {
+		t.Fatalf("allowed %d of 20 with burst 5", allowed)
+	}
+
+	_, _ = s.Allow(ctx, "ip:2", Limit{Rate: 100, Burst: 1}, 1)
+	// ip:2 refills after 10ms, ip:1 after 5s.
+	n, err := s.Evict(ctx, now.Add(time.Second))
+	if err != nil || n != 1 {
+		t.Fatalf("Evict = %d, %v", n, err)
+	}
+	var left int64
+	s.DB.Model(&domain.RateLimitBucket{}).Count(&left)
+	if left != 1 {
+		t.Fatalf("buckets left = %d", left)
+	}
+}
@@ -0,0 +1,76 @@
+// Package repo implements the data persistence layer for domain entities,
+// backed by GORM. This file provides repository functions for APIKey, the
+// hashed long-lived credentials used by server-to-server callers.
+package repo
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+)
+
+// CreateAPIKey inserts k. The caller fills in every field except CreatedAt.
+func CreateAPIKey(ctx context.Context, db *gorm.DB, k *domain.APIKey) error {
+	if k.CreatedAt.IsZero() {
+		k.CreatedAt = time.Now().UTC()
+	}
+	return db.WithContext(ctx).Create(k).Error
+}
+
+// FindAPIKey fetches a key by ID, including revoked keys. It returns
+// ErrNotFound if there is no such key.
+func FindAPIKey(ctx context.Context, db *gorm.DB, id string) (*domain.APIKey, error) {
+	var k domain.APIKey
+	if err := db.WithContext(ctx).Where("id = ?", id).First(&k).Error; err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// FindAPIKeyByPrefix fetches a key by its public prefix, including revoked
+// keys. It returns ErrNotFound if there is no such key.
+func FindAPIKeyByPrefix(ctx context.Context, db *gorm.DB, prefix string) (*domain.APIKey, error) {
+	var k domain.APIKey
+	if err := db.WithContext(ctx).Where("prefix = ?", prefix).First(&k).Error; err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// ListAPIKeys returns all keys of userID, including revoked ones, newest first.
+func ListAPIKeys(ctx context.Context, db *gorm.DB, userID string) ([]domain.APIKey, error) {
+	out := []domain.APIKey{}
+	err := db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").
+		Find(&out).Error
+	return out, err
+}
+
+// RevokeAPIKey marks key id as revoked at the given time. Revoking an
+// already revoked key keeps the original revocation time; an unknown id
+// returns ErrNotFound.
+func RevokeAPIKey(ctx context.Context, db *gorm.DB, id string, at time.Time) error {
+	res := db.WithContext(ctx).Model(&domain.APIKey{}).
+		Where("id = ? AND revoked_at IS NULL", id).
+		Update("revoked_at", at)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		if _, err := FindAPIKey(ctx, db, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// TouchAPIKey records that key id was used at the given time.
+func TouchAPIKey(ctx context.Context, db *gorm.DB, id string, at time.Time) error {
+	return db.WithContext(ctx).Model(&domain.APIKey{}).
+		Where("id = ?", id).
+		Update("last_used_at", at).Error
+}
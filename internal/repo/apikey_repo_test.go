@@ -0,0 +1,93 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+)
+
+func newAPIKey(userID, prefix string) *domain.APIKey {
+	return &domain.APIKey{
+		ID:         uuid.NewString(),
+		UserID:     userID,
+		Prefix:     prefix,
+		SecretHash: "hash-" + prefix,
+		Scopes:     "chats:read",
+	}
+}
+
+func TestAPIKeys_CreateFindList(t *testing.T) {
+	db := newChatRepoDB(t, &domain.APIKey{})
+	ctx := context.Background()
+
+	a := newAPIKey("u1", "gck_a")
+	if err := CreateAPIKey(ctx, db, a); err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if a.CreatedAt.IsZero() {
+		t.Fatalf("CreatedAt not set")
+	}
+	b := newAPIKey("u1", "gck_b")
+	b.CreatedAt = a.CreatedAt.Add(time.Second)
+	if err := CreateAPIKey(ctx, db, b); err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	if err := CreateAPIKey(ctx, db, newAPIKey("u2", "gck_a")); err == nil {
+		t.Fatalf("expected unique violation on duplicate prefix")
+	}
+
+	got, err := FindAPIKeyByPrefix(ctx, db, "gck_b")
+	if err != nil || got.ID != b.ID || got.SecretHash != "hash-gck_b" {
+		t.Fatalf("FindAPIKeyByPrefix = %+v, %v", got, err)
+	}
+	if _, err := FindAPIKeyByPrefix(ctx, db, "gck_missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("missing prefix: err = %v", err)
+	}
+	if got, err := FindAPIKey(ctx, db, a.ID); err != nil || got.Prefix != "gck_a" {
+		t.Fatalf("FindAPIKey = %+v, %v", got, err)
+	}
+
+	keys, err := ListAPIKeys(ctx, db, "u1")
+	if err != nil || len(keys) != 2 || keys[0].ID != b.ID {
+		t.Fatalf("ListAPIKeys = %+v, %v; want newest first", keys, err)
+	}
+	if keys, _ := ListAPIKeys(ctx, db, "u2"); len(keys) != 0 {
+		t.Fatalf("u2 keys = %+v", keys)
+	}
+}
+
+func TestAPIKeys_RevokeAndTouch(t *testing.T) {
+	db := newChatRepoDB(t, &domain.APIKey{})
+	ctx := context.Background()
+	k := newAPIKey("u1", "gck_r")
+	if err := CreateAPIKey(ctx, db, k); err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+
+	used := time.Now().UTC().Truncate(time.Second)
+	if err := TouchAPIKey(ctx, db, k.ID, used); err != nil {
+		t.Fatalf("TouchAPIKey: %v", err)
+	}
+	first := used.Add(time.Minute)
+	if err := RevokeAPIKey(ctx, db, k.ID, first); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	if err := RevokeAPIKey(ctx, db, k.ID, first.Add(time.Hour)); err != nil {
+		t.Fatalf("second RevokeAPIKey: %v", err)
+	}
+	got, _ := FindAPIKey(ctx, db, k.ID)
+	if got.RevokedAt == nil || !got.RevokedAt.Equal(first) {
+		t.Fatalf("RevokedAt = %v; want first revocation %v", got.RevokedAt, first)
+	}
+	if got.LastUsedAt == nil || !got.LastUsedAt.Equal(used) {
+		t.Fatalf("LastUsedAt = %v; want %v", got.LastUsedAt, used)
+	}
+	if err := RevokeAPIKey(ctx, db, uuid.NewString(), first); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("revoke unknown: err = %v", err)
+	}
+}
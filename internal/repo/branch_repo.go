@@ -0,0 +1,257 @@
+// Package repo implements the data persistence layer for domain entities,
+// backed by GORM. This file provides the message tree of a chat.
+//
+// Every message follows a parent (see domain.Message); the chat's active
+// message ends the active branch, the path from the first message to it.
+// New messages are appended to the active branch and become its end, and
+// choosing another branch moves the active message. Appending moves the
+// active message only from the new message's parent, so concurrent appends
+// to one chat cannot fork it silently: all but one fail with ErrActiveMoved. Listings restricted to
+// the active branch filter with the recursive path query below, so they page
+// and count like listings of the whole chat.
+package repo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/pagination"
+)
+
+// pathSQL selects the IDs of the message selected by %s and its ancestors.
+const pathSQL = `WITH RECURSIVE path(id, parent_id) AS (
+	SELECT id, parent_id FROM messages WHERE id = %s
+	UNION ALL
+	SELECT m.id, m.parent_id FROM messages m JOIN path ON m.id = path.parent_id
+) SELECT id FROM path`
+
+var (
+	// messagePathSQL selects the path ending at a message ID.
+	messagePathSQL = fmt.Sprintf(pathSQL, "?")
+	// activePathSQL selects the active branch of a chat ID.
+	activePathSQL = fmt.Sprintf(pathSQL, "(SELECT active_message_id FROM chats WHERE id = ?)")
+)
+
+// subtreeSQL selects the IDs of a message and its descendants.
+const subtreeSQL = `WITH RECURSIVE tree(id) AS (
+	SELECT id FROM messages WHERE id = ?
+	UNION ALL
+	SELECT m.id FROM messages m JOIN tree ON m.parent_id = tree.id
+) SELECT id FROM tree`
+
+// ErrActiveMoved is returned by AppendMessage when the chat's active message
+// is no longer the parent of the new message.
+var ErrActiveMoved = errors.New("active message moved")
+
+// AppendMessage inserts m at the end of the active branch of m.ChatID: m
+// follows m.ParentID (nil for the first message), which must still be the
+// chat's active message, and becomes the active message. If another message
+// was appended meanwhile nothing is stored and ErrActiveMoved is returned.
+// m.ID and m.CreatedAt are assigned when empty.
+func AppendMessage(db *gorm.DB, m *domain.Message) error {
+	if m.ID == "" {
+		m.ID = uuid.NewString()
+	}
+	if m.CreatedAt.IsZero() {
+		m.CreatedAt = time.Now().UTC()
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(m).Error; err != nil {
+			return err
+		}
+		// IS compares NULL (a chat without messages) like any other value.
+		res := tx.Unscoped().Model(&domain.Chat{}).Where("id = ? AND active_message_id IS ?", m.ChatID, m.ParentID).
+			UpdateColumn("active_message_id", m.ID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 1 {
+			return nil
+		}
+		// Messages of a missing chat have no branch to move.
+		var n int64
+		if err := tx.Unscoped().Model(&domain.Chat{}).Where("id = ?", m.ChatID).Count(&n).Error; err != nil {
+			return err
+		}
+		if n > 0 {
+			return ErrActiveMoved
+		}
+		return nil
+	})
+}
+
+// CreateMessageAfter inserts a message following parentID (nil for the root
+// of the chat) and makes it the chat's active message wherever that was: it
+// starts a new branch (see AppendMessage to extend the active one).
+func CreateMessageAfter(db *gorm.DB, chatID string, parentID *string, role, content string, score *float64) (*domain.Message, error) {
+	m := &domain.Message{
+		ID:        uuid.NewString(),
+		ChatID:    chatID,
+		ParentID:  parentID,
+		Role:      role,
+		Content:   content,
+		Score:     score,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := db.Create(m).Error; err != nil {
+		return nil, err
+	}
+	if err := setActiveMessage(db, chatID, m.ID); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// activeMessage returns the active message ID of a chat, or nil when it has
+// none (no messages, or not linked yet; see EnsureMessageTree).
+func activeMessage(db *gorm.DB, chatID string) (*string, error) {
+	var chat domain.Chat
+	err := db.Unscoped().Select("active_message_id").Where("id = ?", chatID).Limit(1).Find(&chat).Error
+	return chat.ActiveMessageID, err
+}
+
+// setActiveMessage moves the active branch of a chat to end at messageID. It
+// leaves the chat's version and UpdatedAt alone: the branch is not part of
+// the chat resource.
+func setActiveMessage(db *gorm.DB, chatID, messageID string) error {
+	return db.Model(&domain.Chat{}).Where("id = ?", chatID).UpdateColumn("active_message_id", messageID).Error
+}
+
+// SetActiveMessage makes messageID, a message of chatID, the end of the
+// chat's active branch.
+func SetActiveMessage(ctx context.Context, db *gorm.DB, chatID, messageID string) error {
+	return setActiveMessage(db.WithContext(ctx), chatID, messageID)
+}
+
+// onActivePath restricts q to the messages on the active branch of chatID.
+// Chats without an active message are not restricted, so chats from before
+// message trees keep listing all their messages until they are linked.
+func onActivePath(db, q *gorm.DB, chatID string) *gorm.DB {
+	return q.Where("(id IN (?) OR NOT EXISTS (SELECT 1 FROM chats WHERE id = ? AND active_message_id IS NOT NULL))",
+		db.Raw(activePathSQL, chatID), chatID)
+}
+
+// CountActiveMessages returns the number of messages on the active branch of
+// a chat.
+func CountActiveMessages(db *gorm.DB, chatID string) (int64, error) {
+	var total int64
+	err := onActivePath(db, db.Model(&domain.Message{}).Where("chat_id = ?", chatID), chatID).Count(&total).Error
+	return total, err
+}
+
+// ListActiveMessagesPage returns a page of the active branch of a chat,
+// ordered (CreatedAt ASC, ID ASC) like ListMessagesPage.
+func ListActiveMessagesPage(db *gorm.DB, chatID string, offset, limit int) ([]domain.Message, error) {
+	var out []domain.Message
+	err := onActivePath(db, db.Where("chat_id = ?", chatID), chatID).
+		Order("created_at ASC, id ASC").
+		Offset(offset).
+		Limit(limit).
+		Find(&out).Error
+	return out, err
+}
+
+// ListActiveMessagesKeyset returns a keyset page of the active branch of a
+// chat like ListMessagesKeyset.
+func ListActiveMessagesKeyset(db *gorm.DB, chatID string, p pagination.Page) ([]domain.Message, bool, error) {
+	var out []domain.Message
+	if err := keyset(onActivePath(db, db.Where("chat_id = ?", chatID), chatID), p).Find(&out).Error; err != nil {
+		return nil, false, err
+	}
+	out, more := pagination.Trim(out, p)
+	return out, more, nil
+}
+
+// ActiveMessagesStats is MessagesStats for the active branch of a chat.
+// Branches end with their newest message, so choosing another branch changes
+// the result.
+func ActiveMessagesStats(ctx context.Context, db *gorm.DB, chatID string) (count int64, maxUpdatedAt *time.Time, err error) {
+	db = db.WithContext(ctx)
+	q := onActivePath(db, db.Model(&domain.Message{}).Where("chat_id = ?", chatID), chatID)
+	if err = q.Count(&count).Error; err != nil {
+		return 0, nil, err
+	}
+	if count == 0 {
+		return 0, nil, nil
+	}
+	var row struct {
+		UpdatedAt time.Time
+	}
+	if err = q.Select("updated_at").Order("updated_at DESC").Limit(1).Scan(&row).Error; err != nil {
+		return 0, nil, err
+	}
+	return count, &row.UpdatedAt, nil
+}
+
+// ListPathMessages returns the last limit messages of the path ending at
+// leafID (the message and its ancestors), oldest first.
+func ListPathMessages(db *gorm.DB, leafID string, limit int) ([]domain.Message, error) {
+	var out []domain.Message
+	err := db.Where("id IN (?)", db.Raw(messagePathSQL, leafID)).
+		Order("created_at DESC, id DESC").Limit(limit).Find(&out).Error
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, err
+}
+
+// ListActivePathIDs returns the IDs of the messages on the active branch of a
+// chat, in no particular order; none when the chat has no active message.
+func ListActivePathIDs(ctx context.Context, db *gorm.DB, chatID string) ([]string, error) {
+	var ids []string
+	err := db.WithContext(ctx).Raw(activePathSQL, chatID).Scan(&ids).Error
+	return ids, err
+}
+
+// ListSiblings returns m and the other messages following the same parent
+// (the branches at m), oldest first.
+func ListSiblings(ctx context.Context, db *gorm.DB, m *domain.Message) ([]domain.Message, error) {
+	var out []domain.Message
+	q := db.WithContext(ctx).Where("chat_id = ?", m.ChatID)
+	if m.ParentID == nil {
+		q = q.Where("parent_id IS NULL")
+	} else {
+		q = q.Where("parent_id = ?", *m.ParentID)
+	}
+	err := q.Order("created_at ASC, id ASC").Find(&out).Error
+	return out, err
+}
+
+// LatestDescendant returns the ID of the newest message in the subtree of
+// messageID (messageID itself when nothing follows it): the end of the
+// branch through messageID that was last added to.
+func LatestDescendant(ctx context.Context, db *gorm.DB, messageID string) (string, error) {
+	var m domain.Message
+	err := db.WithContext(ctx).Select("id").Where("id IN (?)", db.Raw(subtreeSQL, messageID)).
+		Order("created_at DESC, id DESC").First(&m).Error
+	return m.ID, err
+}
+
+// EnsureMessageTree links the messages of chats without an active message,
+// which predate message trees: each message follows the one before it
+// (by created_at, then id) and the last becomes the active message. Chats
+// that already have an active message are left alone, so it is a no-op once
+// every chat with messages is linked.
+func EnsureMessageTree(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`UPDATE messages SET parent_id = (
+			SELECT p.id FROM messages p
+			WHERE p.chat_id = messages.chat_id
+			  AND (p.created_at < messages.created_at OR (p.created_at = messages.created_at AND p.id < messages.id))
+			ORDER BY p.created_at DESC, p.id DESC LIMIT 1)
+		WHERE chat_id IN (SELECT id FROM chats WHERE active_message_id IS NULL)`).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec(`UPDATE chats SET active_message_id = (
+			SELECT m.id FROM messages m WHERE m.chat_id = chats.id
+			ORDER BY m.created_at DESC, m.id DESC LIMIT 1)
+		WHERE active_message_id IS NULL`).Error
+	})
+}
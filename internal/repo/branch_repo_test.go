@@ -0,0 +1,133 @@
+package repo
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/pagination"
+)
+
+func TestMessageTree_BranchesAndActivePath(t *testing.T) {
+	db := newMsgRepoDB(t, &domain.Chat{}, &domain.Message{})
+	ctx := context.Background()
+	c, _ := CreateChat(ctx, db, domain.DefaultWorkspaceID, "u1", "t")
+	ids := func(ms []domain.Message) []string {
+		out := make([]string, len(ms))
+		for i, m := range ms {
+			out[i] = m.ID
+		}
+		return out
+	}
+
+	// q1 → a1 → q2 → a2, then q2 is edited: q2' → a2' follows a1 too.
+	q1, _ := CreateMessage(db, c.ID, "user", "q1", nil)
+	a1, _ := CreateMessage(db, c.ID, "assistant", "a1", nil)
+	q2, _ := CreateMessage(db, c.ID, "user", "q2", nil)
+	a2, _ := CreateMessage(db, c.ID, "assistant", "a2", nil)
+	if q1.ParentID != nil || *a1.ParentID != q1.ID || *a2.ParentID != q2.ID {
+		t.Fatalf("parents not linked: %+v %+v %+v", q1, a1, a2)
+	}
+	q2b, err := CreateMessageAfter(db, c.ID, q2.ParentID, "user", "q2'", nil)
+	if err != nil {
+		t.Fatalf("CreateMessageAfter: %v", err)
+	}
+	a2b, _ := CreateMessage(db, c.ID, "assistant", "a2'", nil)
+
+	active := []string{q1.ID, a1.ID, q2b.ID, a2b.ID}
+	if got, err := ListActiveMessagesPage(db, c.ID, 0, 10); err != nil || !slices.Equal(ids(got), active) {
+		t.Fatalf("active page = %v, %v", ids(got), err)
+	}
+	if got, _ := ListActiveMessagesPage(db, c.ID, 1, 2); !slices.Equal(ids(got), active[1:3]) {
+		t.Fatalf("active page 2 = %v", ids(got))
+	}
+	if n, err := CountActiveMessages(db, c.ID); err != nil || n != 4 {
+		t.Fatalf("CountActiveMessages = %d, %v", n, err)
+	}
+	if n, _ := CountMessages(db, c.ID); n != 6 {
+		t.Fatalf("CountMessages = %d, want every branch", n)
+	}
+	got, more, err := ListActiveMessagesKeyset(db, c.ID, pagination.Page{Cursor: &pagination.Cursor{CreatedAt: a1.CreatedAt, ID: a1.ID}, Limit: 1})
+	if err != nil || !more || !slices.Equal(ids(got), []string{q2b.ID}) {
+		t.Fatalf("keyset = %v %v %v", ids(got), more, err)
+	}
+	if got, _ := ListPathMessages(db, a2.ID, 3); !slices.Equal(ids(got), []string{a1.ID, q2.ID, a2.ID}) {
+		t.Fatalf("ListPathMessages = %v", ids(got))
+	}
+	if got, _ := ListActivePathIDs(ctx, db, c.ID); len(got) != 4 || !slices.Contains(got, q2b.ID) || slices.Contains(got, q2.ID) {
+		t.Fatalf("ListActivePathIDs = %v", got)
+	}
+	if got, err := ListSiblings(ctx, db, q2); err != nil || !slices.Equal(ids(got), []string{q2.ID, q2b.ID}) {
+		t.Fatalf("ListSiblings = %v, %v", ids(got), err)
+	}
+	if got, _ := ListSiblings(ctx, db, q1); !slices.Equal(ids(got), []string{q1.ID}) {
+		t.Fatalf("ListSiblings(root) = %v", ids(got))
+	}
+
+	// Choosing the first branch again ends it at its newest message.
+	_, ts1, _ := ActiveMessagesStats(ctx, db, c.ID)
+	leaf, err := LatestDescendant(ctx, db, q2.ID)
+	if err != nil || leaf != a2.ID {
+		t.Fatalf("LatestDescendant = %q, %v", leaf, err)
+	}
+	if err := SetActiveMessage(ctx, db, c.ID, leaf); err != nil {
+		t.Fatalf("SetActiveMessage: %v", err)
+	}
+	if got, _ := ListActiveMessagesPage(db, c.ID, 0, 10); !slices.Equal(ids(got), []string{q1.ID, a1.ID, q2.ID, a2.ID}) {
+		t.Fatalf("after switch = %v", ids(got))
+	}
+	if n, ts2, _ := ActiveMessagesStats(ctx, db, c.ID); n != 4 || ts2.Equal(*ts1) {
+		t.Fatalf("stats did not change with the branch: %d %v %v", n, ts1, ts2)
+	}
+	var chat domain.Chat
+	db.First(&chat, "id = ?", c.ID)
+	if chat.Version != c.Version {
+		t.Fatalf("switching branches bumped the chat version")
+	}
+}
+
+func TestEnsureMessageTree_LinksOlderChats(t *testing.T) {
+	db := newMsgRepoDB(t, &domain.Chat{}, &domain.Message{})
+	ctx := context.Background()
+	at := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, c := range []domain.Chat{{ID: "old", UserID: "u1"}, {ID: "empty", UserID: "u1"}} {
+		if err := db.Create(&c).Error; err != nil {
+			t.Fatalf("seed chat: %v", err)
+		}
+	}
+	// m2 and m3 share a timestamp; ties are broken by id.
+	for _, m := range []domain.Message{
+		{ID: "m3", ChatID: "old", Role: "user", Content: "c", CreatedAt: at.Add(time.Second)},
+		{ID: "m1", ChatID: "old", Role: "user", Content: "a", CreatedAt: at},
+		{ID: "m2", ChatID: "old", Role: "assistant", Content: "b", CreatedAt: at.Add(time.Second)},
+	} {
+		if err := db.Create(&m).Error; err != nil {
+			t.Fatalf("seed msg: %v", err)
+		}
+	}
+	// Unlinked chats list every message.
+	if n, _ := CountActiveMessages(db, "old"); n != 3 {
+		t.Fatalf("unlinked count = %d", n)
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := EnsureMessageTree(db); err != nil {
+			t.Fatalf("EnsureMessageTree: %v", err)
+		}
+	}
+	var msgs []domain.Message
+	db.Order("id").Find(&msgs)
+	if msgs[0].ParentID != nil || *msgs[1].ParentID != "m1" || *msgs[2].ParentID != "m2" {
+		t.Fatalf("parents = %+v", msgs)
+	}
+	var chats []domain.Chat
+	db.Order("id").Find(&chats)
+	if chats[0].ActiveMessageID != nil || chats[1].ActiveMessageID == nil || *chats[1].ActiveMessageID != "m3" {
+		t.Fatalf("active = %+v", chats)
+	}
+	if got, _ := ListActivePathIDs(ctx, db, "old"); len(got) != 3 {
+		t.Fatalf("active path = %v", got)
+	}
+}
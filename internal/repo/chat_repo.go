@@ -6,6 +6,16 @@
 // They follow the "thin repository" approach: no business logic, only CRUD
 // persistence and query composition.
 //
+// Workspace scoping:
+//   - Every chat belongs to a workspace, and every function here takes the
+//     workspaceID it operates in. A chat of another workspace behaves
+//     exactly like a missing one, so tenants can never see or modify each
+//     other's chats, even with a known chat ID.
+//   - Functions keyed by a chat ID alone (messages, shares, MessagesStats)
+//     must only be given IDs resolved through the workspace-scoped lookups
+//     below; the service layer always authorizes the chat first.
+//   - PurgeDeletedChats is maintenance and deliberately spans workspaces.
+//
 // Error semantics:
 //   - When a chat is not found, functions return gorm.ErrRecordNotFound
 //     (also exported here as ErrNotFound for convenience).
@@ -14,29 +24,66 @@
 //
 // Functions:
 //
-//   - CreateChat(ctx, db, userID, title) -> *domain.Chat, error
+//   - CreateChat(ctx, db, workspaceID, userID, title) -> *domain.Chat, error
 //     Inserts a new Chat row with UUID primary key and UTC timestamp.
 //
-//   - ListChats(ctx, db, userID) -> []domain.Chat, error
-//     Returns all chats for a user, ordered by creation time descending.
+//   - ImportChat(ctx, db, chat, msgs) -> error
+//     Inserts a complete chat (messages and their citations) in one
+//     transaction, keeping the given IDs and timestamps.
+//
+//   - ListChats(ctx, db, workspaceID, userID) -> []domain.Chat, error
+//     Returns all of a user's chats in a workspace, ordered by creation time descending.
 //
-//   - CountChats(ctx, db, userID) -> (int64, error)
-//     Returns the total number of chats owned by the user.
+//   - CountChats(ctx, db, workspaceID, userID) -> (int64, error)
+//     Returns the total number of chats the user owns in the workspace.
 //
-//   - ListChatsPage(ctx, db, userID, offset, limit) -> []domain.Chat, error
+//   - ListChatsPage(ctx, db, workspaceID, userID, offset, limit) -> []domain.Chat, error
 //     Returns a paginated slice of chats for a user.
 //
-//   - GetChat(ctx, db, id, userID) -> *domain.Chat, error
+//   - GetChat(ctx, db, workspaceID, id, userID) -> *domain.Chat, error
 //     Fetches a single chat by ID/userID, or ErrNotFound if missing.
 //
-//   - UpdateChatTitle(ctx, db, id, userID, title) -> error
-//     Updates the title of a chat, enforcing user ownership.
-//     Returns ErrNotFound if the chat does not exist.
+//   - FindChat(ctx, db, workspaceID, id) -> *domain.Chat, error
+//     Fetches a chat of the workspace whoever owns it (for authorization
+//     decisions).
+//
+//   - UpdateChatTitle(ctx, db, workspaceID, id, userID, title, version) -> error
+//     Updates the title of a chat, enforcing user ownership and, when
+//     version > 0, that the chat is still at that version.
+//     Returns ErrNotFound if no chat matches.
+//
+//   - DeleteChat(ctx, db, workspaceID, id, userID, version, at) -> error
+//     Soft-deletes a chat with its messages and their feedback, with the
+//     same optional version check.
+//
+//   - FindDeletedChat(ctx, db, workspaceID, id) -> *domain.Chat, error
+//     Fetches a soft-deleted chat of the workspace whoever owns it, or
+//     ErrNotFound.
+//
+//   - RestoreChat(ctx, db, workspaceID, id, userID, deletedAt) -> error
+//     Undoes DeleteChat for the rows deleted together with the chat.
+//
+//   - PurgeDeletedChats(ctx, db, before) -> (int64, error)
+//     Hard-deletes chats soft-deleted before the cutoff, with everything
+//     that belongs to them.
+//
+//   - ShareChat / UnshareChat / ListChatShares / IsChatSharedWith
+//     Manage and query the users a chat is shared with (see share_repo.go).
+//
+// Soft-deleted rows are invisible to every other function here (GORM adds
+// "deleted_at IS NULL" to queries on models with a DeletedAt field).
+//
+// Versioning:
+//   - Every change to a chat row (rename, delete, restore, auto-title)
+//     increments Chat.Version, from which the HTTP layer derives a strong
+//     ETag. Passing the version a client last saw to UpdateChatTitle or
+//     DeleteChat makes the change conditional: it matches no row (and
+//     returns ErrNotFound) once anyone else has changed the chat.
 //
 // Usage:
 //
 //	// Within a service layer
-//	chat, err := repo.CreateChat(ctx, db, userID, "My first chat")
+//	chat, err := repo.CreateChat(ctx, db, workspaceID, userID, "My first chat")
 //	if errors.Is(err, repo.ErrNotFound) {
 //	    // handle missing
 //	} else if err != nil {
@@ -54,6 +101,7 @@ import (
 
 	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
 	"github.com/tbourn/go-chat-backend/internal/domain"
 )
@@ -63,16 +111,18 @@ import (
 // across the service layer and handlers.
 var ErrNotFound = gorm.ErrRecordNotFound
 
-// CreateChat inserts a new Chat row owned by userID with the given title.
-// The chat ID is a randomly generated UUID (string), and CreatedAt is set to UTC.
+// CreateChat inserts a new Chat row in workspaceID owned by userID with the
+// given title. The chat ID is a randomly generated UUID (string), and CreatedAt is set to UTC.
 //
 // On success, it returns the persisted Chat. On failure, it returns a DB error.
-func CreateChat(ctx context.Context, db *gorm.DB, userID, title string) (*domain.Chat, error) {
+func CreateChat(ctx context.Context, db *gorm.DB, workspaceID, userID, title string) (*domain.Chat, error) {
 	c := &domain.Chat{
-		ID:        uuid.NewString(),
-		UserID:    userID,
-		Title:     title,
-		CreatedAt: time.Now().UTC(),
+		ID:          uuid.NewString(),
+		WorkspaceID: workspaceID,
+		UserID:      userID,
+		Title:       title,
+		Version:     1,
+		CreatedAt:   time.Now().UTC(),
 	}
 	if err := db.WithContext(ctx).Create(c).Error; err != nil {
 		return nil, err
@@ -80,38 +130,69 @@ func CreateChat(ctx context.Context, db *gorm.DB, userID, title string) (*domain
 	return c, nil
 }
 
-// ListChats returns all chats belonging to userID, ordered by creation time
-// descending (most recent first). It returns an empty slice if the user has
-// no chats. On DB error, it returns the error.
-func ListChats(ctx context.Context, db *gorm.DB, userID string) ([]domain.Chat, error) {
+// ImportChat inserts chat with its messages and their citations in one
+// transaction: either all rows are written or none. IDs and timestamps are
+// stored as given (zero UpdatedAt values default to CreatedAt); each
+// message's ChatID and each citation's MessageID must already be set.
+func ImportChat(ctx context.Context, db *gorm.DB, chat *domain.Chat, msgs []domain.Message) error {
+	if chat.UpdatedAt.IsZero() {
+		chat.UpdatedAt = chat.CreatedAt
+	}
+	var srcs []domain.MessageSource
+	for i := range msgs {
+		if msgs[i].UpdatedAt.IsZero() {
+			msgs[i].UpdatedAt = msgs[i].CreatedAt
+		}
+		srcs = append(srcs, msgs[i].Citations...)
+	}
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit(clause.Associations).Create(chat).Error; err != nil {
+			return err
+		}
+		if len(msgs) > 0 {
+			if err := tx.Omit(clause.Associations).CreateInBatches(msgs, 100).Error; err != nil {
+				return err
+			}
+		}
+		if len(srcs) > 0 {
+			return tx.Omit(clause.Associations).CreateInBatches(srcs, 100).Error
+		}
+		return nil
+	})
+}
+
+// ListChats returns all chats belonging to userID in workspaceID, ordered by
+// creation time descending (most recent first). It returns an empty slice if
+// the user has no chats there. On DB error, it returns the error.
+func ListChats(ctx context.Context, db *gorm.DB, workspaceID, userID string) ([]domain.Chat, error) {
 	var out []domain.Chat
 	err := db.WithContext(ctx).
-		Where("user_id = ?", userID).
+		Where("workspace_id = ? AND user_id = ?", workspaceID, userID).
 		Order("created_at desc").
 		Find(&out).Error
 	return out, err
 }
 
-// CountChats returns the total number of chats owned by userID.
-// On DB error, it returns the error.
-func CountChats(ctx context.Context, db *gorm.DB, userID string) (int64, error) {
+// CountChats returns the total number of chats owned by userID in
+// workspaceID. On DB error, it returns the error.
+func CountChats(ctx context.Context, db *gorm.DB, workspaceID, userID string) (int64, error) {
 	var total int64
 	err := db.WithContext(ctx).
 		Model(&domain.Chat{}).
-		Where("user_id = ?", userID).
+		Where("workspace_id = ? AND user_id = ?", workspaceID, userID).
 		Count(&total).Error
 	return total, err
 }
 
-// ListChatsPage returns a paginated slice of chats for userID, ordered by
-// creation time descending. Use CountChats to obtain the total for pagination
+// ListChatsPage returns a paginated slice of chats for userID in
+// workspaceID, ordered by creation time descending. Use CountChats to obtain the total for pagination
 // metadata. On DB error, it returns the error.
 //
 // The caller is responsible for computing offset and limit (e.g., (page-1)*pageSize).
-func ListChatsPage(ctx context.Context, db *gorm.DB, userID string, offset, limit int) ([]domain.Chat, error) {
+func ListChatsPage(ctx context.Context, db *gorm.DB, workspaceID, userID string, offset, limit int) ([]domain.Chat, error) {
 	var out []domain.Chat
 	err := db.WithContext(ctx).
-		Where("user_id = ?", userID).
+		Where("workspace_id = ? AND user_id = ?", workspaceID, userID).
 		Order("created_at desc").
 		Offset(offset).
 		Limit(limit).
@@ -119,13 +200,13 @@ func ListChatsPage(ctx context.Context, db *gorm.DB, userID string, offset, limi
 	return out, err
 }
 
-// GetChat fetches a single chat by its ID and owner (userID). If the record
-// does not exist, it returns ErrNotFound. On other DB errors, the raw error
+// GetChat fetches a single chat of workspaceID by its ID and owner (userID).
+// If the record does not exist, it returns ErrNotFound. On other DB errors, the raw error
 // is returned.
-func GetChat(ctx context.Context, db *gorm.DB, id, userID string) (*domain.Chat, error) {
+func GetChat(ctx context.Context, db *gorm.DB, workspaceID, id, userID string) (*domain.Chat, error) {
 	var c domain.Chat
 	err := db.WithContext(ctx).
-		Where("id = ? AND user_id = ?", id, userID).
+		Where("id = ? AND workspace_id = ? AND user_id = ?", id, workspaceID, userID).
 		First(&c).Error
 	if err != nil {
 		return nil, err
@@ -133,14 +214,27 @@ func GetChat(ctx context.Context, db *gorm.DB, id, userID string) (*domain.Chat,
 	return &c, nil
 }
 
-// UpdateChatTitle updates the title of a chat identified by id and owned by
-// userID. If no rows are affected (chat missing or not owned by userID),
-// it returns ErrNotFound. On DB error, the raw error is returned.
-func UpdateChatTitle(ctx context.Context, db *gorm.DB, id, userID, title string) error {
-	res := db.WithContext(ctx).
+// FindChat fetches a live chat of workspaceID by ID regardless of its owner.
+// It exists for authorization checks, which must distinguish "missing" from
+// "not yours"; callers must not expose the result before checking access.
+func FindChat(ctx context.Context, db *gorm.DB, workspaceID, id string) (*domain.Chat, error) {
+	var c domain.Chat
+	if err := db.WithContext(ctx).Where("id = ? AND workspace_id = ?", id, workspaceID).First(&c).Error; err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// UpdateChatTitle updates the title of a chat of workspaceID identified by id
+// and owned by userID, and increments its version. When version > 0 the chat
+// must still be at that version. If no rows are affected (chat missing, in
+// another workspace, not owned by userID or at another version), it returns
+// ErrNotFound. On DB error, the raw error is returned.
+func UpdateChatTitle(ctx context.Context, db *gorm.DB, workspaceID, id, userID, title string, version int64) error {
+	res := whereVersion(db.WithContext(ctx).
 		Model(&domain.Chat{}).
-		Where("id = ? AND user_id = ?", id, userID).
-		Update("title", title)
+		Where("id = ? AND workspace_id = ? AND user_id = ?", id, workspaceID, userID), version).
+		Updates(map[string]any{"title": title, "version": gorm.Expr("version + 1")})
 	if res.Error != nil {
 		return res.Error
 	}
@@ -149,3 +243,119 @@ func UpdateChatTitle(ctx context.Context, db *gorm.DB, id, userID, title string)
 	}
 	return nil
 }
+
+// DeleteChat soft-deletes the chat of workspaceID identified by id and owned
+// by userID, together with its messages and the feedback on them. All rows get the same
+// deletion timestamp (at), which RestoreChat uses to undo exactly this
+// deletion. UpdatedAt is bumped as well so list ETags change (see ChatsStats),
+// and so is the chat's version. When version > 0 the chat must still be at
+// that version. If the chat is missing, already deleted, in another
+// workspace, not owned by userID or at another version, it returns
+// ErrNotFound.
+func DeleteChat(ctx context.Context, db *gorm.DB, workspaceID, id, userID string, version int64, at time.Time) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := whereVersion(tx.Model(&domain.Chat{}).
+			Where("id = ? AND workspace_id = ? AND user_id = ?", id, workspaceID, userID), version).
+			Updates(map[string]any{"deleted_at": at, "updated_at": at, "version": gorm.Expr("version + 1")})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Model(&domain.Feedback{}).
+			Where("message_id IN (?)", tx.Model(&domain.Message{}).Select("id").Where("chat_id = ?", id)).
+			Updates(map[string]any{"deleted_at": at, "updated_at": at}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&domain.Message{}).
+			Where("chat_id = ?", id).
+			Updates(map[string]any{"deleted_at": at, "updated_at": at}).Error
+	})
+}
+
+// FindDeletedChat fetches a soft-deleted chat of workspaceID by its ID
+// regardless of its owner (see FindChat). Live chats are not returned; if no
+// deleted chat matches, it returns ErrNotFound.
+func FindDeletedChat(ctx context.Context, db *gorm.DB, workspaceID, id string) (*domain.Chat, error) {
+	var c domain.Chat
+	err := db.WithContext(ctx).Unscoped().
+		Where("id = ? AND workspace_id = ? AND deleted_at IS NOT NULL", id, workspaceID).
+		First(&c).Error
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// RestoreChat undoes DeleteChat: the chat and the messages and feedback that
+// were deleted with it (same deletedAt) become visible again. UpdatedAt is set
+// to now and the chat's version is incremented. If no deleted chat matches,
+// it returns ErrNotFound.
+func RestoreChat(ctx context.Context, db *gorm.DB, workspaceID, id, userID string, deletedAt time.Time) error {
+	now := time.Now().UTC()
+	restore := map[string]any{"deleted_at": nil, "updated_at": now}
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		res := tx.Unscoped().Model(&domain.Chat{}).
+			Where("id = ? AND workspace_id = ? AND user_id = ? AND deleted_at = ?", id, workspaceID, userID, deletedAt).
+			Updates(map[string]any{"deleted_at": nil, "updated_at": now, "version": gorm.Expr("version + 1")})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Unscoped().Model(&domain.Message{}).
+			Where("chat_id = ? AND deleted_at = ?", id, deletedAt).
+			Updates(restore).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&domain.Feedback{}).
+			Where("message_id IN (?) AND deleted_at = ?",
+				tx.Unscoped().Model(&domain.Message{}).Select("id").Where("chat_id = ?", id), deletedAt).
+			Updates(restore).Error
+	})
+}
+
+// whereVersion restricts q to chats at version, unless version is 0.
+func whereVersion(q *gorm.DB, version int64) *gorm.DB {
+	if version > 0 {
+		return q.Where("version = ?", version)
+	}
+	return q
+}
+
+// PurgeDeletedChats permanently removes chats soft-deleted before the cutoff,
+// in every workspace, along with their messages, citations, feedback, shares, share links and
+// idempotency records, in one transaction. It returns the number of chats removed.
+func PurgeDeletedChats(ctx context.Context, db *gorm.DB, before time.Time) (int64, error) {
+	var purged int64
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		chats := tx.Unscoped().Model(&domain.Chat{}).Select("id").
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", before)
+		msgs := tx.Unscoped().Model(&domain.Message{}).Select("id").Where("chat_id IN (?)", chats)
+
+		if err := tx.Unscoped().Where("message_id IN (?)", msgs).Delete(&domain.Feedback{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("message_id IN (?)", msgs).Delete(&domain.MessageSource{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("chat_id IN (?)", chats).Delete(&domain.Idempotency{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("chat_id IN (?)", chats).Delete(&domain.ChatShare{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("chat_id IN (?)", chats).Delete(&domain.ShareLink{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("chat_id IN (?)", chats).Delete(&domain.Message{}).Error; err != nil {
+			return err
+		}
+		res := tx.Unscoped().Where("deleted_at IS NOT NULL AND deleted_at < ?", before).Delete(&domain.Chat{})
+		purged = res.RowsAffected
+		return res.Error
+	})
+	return purged, err
+}
@@ -2,12 +2,14 @@ package repo
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
 	"testing"
 	"time"
 
 	sqlite "github.com/glebarez/sqlite" // pure-Go SQLite
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 
@@ -42,7 +44,7 @@ func newChatRepoDB(t *testing.T, migrate ...any) *gorm.DB {
 
 func TestCreateChat_Error_NoTable(t *testing.T) {
 	db := newChatRepoDB(t /* no migrations */)
-	chat, err := CreateChat(context.Background(), db, "u1", "t")
+	chat, err := CreateChat(context.Background(), db, domain.DefaultWorkspaceID, "u1", "t")
 	if err == nil || chat != nil {
 		t.Fatalf("expected error creating without table, got chat=%v err=%v", chat, err)
 	}
@@ -52,7 +54,7 @@ func TestCreateChat_Success_PersistsAndSetsFields(t *testing.T) {
 	db := newChatRepoDB(t, &domain.Chat{})
 
 	start := time.Now().UTC().Add(-time.Minute)
-	chat, err := CreateChat(context.Background(), db, "u1", "My Chat")
+	chat, err := CreateChat(context.Background(), db, domain.DefaultWorkspaceID, "u1", "My Chat")
 	if err != nil {
 		t.Fatalf("CreateChat: %v", err)
 	}
@@ -90,7 +92,7 @@ func TestListChats_OrderDescendingAndFilter(t *testing.T) {
 		}
 	}
 
-	list, err := ListChats(context.Background(), db, "u1")
+	list, err := ListChats(context.Background(), db, domain.DefaultWorkspaceID, "u1")
 	if err != nil {
 		t.Fatalf("ListChats: %v", err)
 	}
@@ -105,7 +107,7 @@ func TestListChats_OrderDescendingAndFilter(t *testing.T) {
 
 func TestCountChats_Error_NoTable(t *testing.T) {
 	db := newChatRepoDB(t /* no migrations */)
-	if _, err := CountChats(context.Background(), db, "u1"); err == nil {
+	if _, err := CountChats(context.Background(), db, domain.DefaultWorkspaceID, "u1"); err == nil {
 		t.Fatalf("expected error when table missing")
 	}
 }
@@ -123,7 +125,7 @@ func TestCountChats_Success(t *testing.T) {
 		t.Fatalf("seed x: %v", err)
 	}
 
-	total, err := CountChats(context.Background(), db, "u1")
+	total, err := CountChats(context.Background(), db, domain.DefaultWorkspaceID, "u1")
 	if err != nil {
 		t.Fatalf("CountChats: %v", err)
 	}
@@ -150,7 +152,7 @@ func TestListChatsPage_PaginationAndOrder(t *testing.T) {
 	}
 
 	// Offset 1, limit 2 => should return the 2nd and 3rd newest => IDs 'd','c'
-	page, err := ListChatsPage(context.Background(), db, "u1", 1, 2)
+	page, err := ListChatsPage(context.Background(), db, domain.DefaultWorkspaceID, "u1", 1, 2)
 	if err != nil {
 		t.Fatalf("ListChatsPage: %v", err)
 	}
@@ -163,7 +165,7 @@ func TestGetChat_FoundAndNotFound(t *testing.T) {
 	db := newChatRepoDB(t, &domain.Chat{})
 
 	// Not found
-	if _, err := GetChat(context.Background(), db, "nope", "u1"); err == nil {
+	if _, err := GetChat(context.Background(), db, domain.DefaultWorkspaceID, "nope", "u1"); err == nil {
 		t.Fatalf("expected ErrRecordNotFound for missing chat")
 	}
 
@@ -172,7 +174,7 @@ func TestGetChat_FoundAndNotFound(t *testing.T) {
 	if err := db.Create(c).Error; err != nil {
 		t.Fatalf("seed chat: %v", err)
 	}
-	got, err := GetChat(context.Background(), db, "cid", "owner")
+	got, err := GetChat(context.Background(), db, domain.DefaultWorkspaceID, "cid", "owner")
 	if err != nil {
 		t.Fatalf("GetChat: %v", err)
 	}
@@ -181,6 +183,20 @@ func TestGetChat_FoundAndNotFound(t *testing.T) {
 	}
 }
 
+func TestFindChat_IgnoresOwner(t *testing.T) {
+	db := newChatRepoDB(t, &domain.Chat{})
+	ctx := context.Background()
+	c, _ := CreateChat(ctx, db, domain.DefaultWorkspaceID, "u1", "t")
+
+	got, err := FindChat(ctx, db, domain.DefaultWorkspaceID, c.ID)
+	if err != nil || got.UserID != "u1" {
+		t.Fatalf("FindChat = %+v, %v", got, err)
+	}
+	if _, err := FindChat(ctx, db, domain.DefaultWorkspaceID, "missing"); err != gorm.ErrRecordNotFound {
+		t.Fatalf("FindChat(missing): expected ErrRecordNotFound, got %v", err)
+	}
+}
+
 func TestUpdateChatTitle_SuccessAndNotFound(t *testing.T) {
 	db := newChatRepoDB(t, &domain.Chat{})
 
@@ -191,7 +207,7 @@ func TestUpdateChatTitle_SuccessAndNotFound(t *testing.T) {
 	}
 
 	// Success
-	if err := UpdateChatTitle(context.Background(), db, "c1", "u1", "new"); err != nil {
+	if err := UpdateChatTitle(context.Background(), db, domain.DefaultWorkspaceID, "c1", "u1", "new", 0); err != nil {
 		t.Fatalf("UpdateChatTitle: %v", err)
 	}
 	var got domain.Chat
@@ -203,19 +219,276 @@ func TestUpdateChatTitle_SuccessAndNotFound(t *testing.T) {
 	}
 
 	// Not found (wrong user or id) -> gorm.ErrRecordNotFound
-	if err := UpdateChatTitle(context.Background(), db, "c1", "other", "x"); err == nil {
+	if err := UpdateChatTitle(context.Background(), db, domain.DefaultWorkspaceID, "c1", "other", "x", 0); err == nil {
 		t.Fatalf("expected ErrRecordNotFound when user mismatches")
 	}
-	if err := UpdateChatTitle(context.Background(), db, "missing", "u1", "x"); err == nil {
+	if err := UpdateChatTitle(context.Background(), db, domain.DefaultWorkspaceID, "missing", "u1", "x", 0); err == nil {
 		t.Fatalf("expected ErrRecordNotFound when id missing")
 	}
 }
 
+func TestChatVersion_ConditionalChanges(t *testing.T) {
+	db := newChatRepoDB(t, &domain.Chat{}, &domain.Message{}, &domain.Feedback{})
+	ctx := context.Background()
+	ws := domain.DefaultWorkspaceID
+	c, _ := CreateChat(ctx, db, ws, "u1", "t")
+	if c.Version != 1 {
+		t.Fatalf("new chat version = %d", c.Version)
+	}
+	version := func() int64 {
+		var got domain.Chat
+		if err := db.Unscoped().First(&got, "id = ?", c.ID).Error; err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		return got.Version
+	}
+
+	if err := UpdateChatTitle(ctx, db, ws, c.ID, "u1", "a", 1); err != nil || version() != 2 {
+		t.Fatalf("rename at v1: err=%v version=%d", err, version())
+	}
+	// A second client still holding v1 loses.
+	if err := UpdateChatTitle(ctx, db, ws, c.ID, "u1", "b", 1); err != gorm.ErrRecordNotFound {
+		t.Fatalf("stale rename: %v", err)
+	}
+	if err := UpdateChatTitle(ctx, db, ws, c.ID, "u1", "c", 0); err != nil || version() != 3 {
+		t.Fatalf("unconditional rename: err=%v version=%d", err, version())
+	}
+
+	at := time.Now().UTC().Truncate(time.Second)
+	if err := DeleteChat(ctx, db, ws, c.ID, "u1", 2, at); err != gorm.ErrRecordNotFound {
+		t.Fatalf("stale delete: %v", err)
+	}
+	if err := DeleteChat(ctx, db, ws, c.ID, "u1", 3, at); err != nil || version() != 4 {
+		t.Fatalf("delete at v3: err=%v version=%d", err, version())
+	}
+	if err := RestoreChat(ctx, db, ws, c.ID, "u1", at); err != nil || version() != 5 {
+		t.Fatalf("restore: err=%v version=%d", err, version())
+	}
+}
+
 func TestUpdateChatTitle_Error_NoTable(t *testing.T) {
 	db := newChatRepoDB(t /* no migrations */)
 
-	err := UpdateChatTitle(context.Background(), db, "anyid", "anyuser", "newtitle")
+	err := UpdateChatTitle(context.Background(), db, domain.DefaultWorkspaceID, "anyid", "anyuser", "newtitle", 0)
 	if err == nil {
 		t.Fatalf("expected error when table does not exist")
 	}
 }
+
+// seedChatTree creates a chat owned by u1 with one assistant message, a
+// citation, feedback and an idempotency record.
+func seedChatTree(t *testing.T, db *gorm.DB, title string) *domain.Chat {
+	t.Helper()
+	ctx := context.Background()
+	c, err := CreateChat(ctx, db, domain.DefaultWorkspaceID, "u1", title)
+	if err != nil {
+		t.Fatalf("CreateChat: %v", err)
+	}
+	m, err := CreateMessage(db, c.ID, "assistant", "answer", nil)
+	if err != nil {
+		t.Fatalf("CreateMessage: %v", err)
+	}
+	if _, err := CreateMessageSources(db, m.ID, []domain.MessageSource{{DocID: "d1", Snippet: "s"}}); err != nil {
+		t.Fatalf("CreateMessageSources: %v", err)
+	}
+	if err := CreateFeedback(ctx, db, domain.DefaultWorkspaceID, m.ID, "u1", 1); err != nil {
+		t.Fatalf("CreateFeedback: %v", err)
+	}
+	if err := CreateIdempotency(ctx, db, &domain.Idempotency{
+		WorkspaceID: domain.DefaultWorkspaceID,
+		UserID:      "u1",
+		Key:         "k-" + title,
+		ChatID:      c.ID,
+		State:       domain.IdempotencyCompleted,
+		Status:      201,
+		ExpiresAt:   time.Now().UTC().Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("CreateIdempotency: %v", err)
+	}
+	return c
+}
+
+func countRows(t *testing.T, db *gorm.DB, model any, where string, args ...any) int64 {
+	t.Helper()
+	var n int64
+	if err := db.Unscoped().Model(model).Where(where, args...).Count(&n).Error; err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	return n
+}
+
+func TestDeleteChat_RestoreChat_Cascade(t *testing.T) {
+	db := newChatRepoDB(t, &domain.Chat{}, &domain.Message{}, &domain.MessageSource{}, &domain.Feedback{}, &domain.Idempotency{})
+	ctx := context.Background()
+	c := seedChatTree(t, db, "a")
+	other := seedChatTree(t, db, "b")
+
+	if err := DeleteChat(ctx, db, domain.DefaultWorkspaceID, c.ID, "u2", 0, time.Now().UTC()); err != gorm.ErrRecordNotFound {
+		t.Fatalf("delete by non-owner: expected ErrRecordNotFound, got %v", err)
+	}
+
+	at := time.Now().UTC()
+	if err := DeleteChat(ctx, db, domain.DefaultWorkspaceID, c.ID, "u1", 0, at); err != nil {
+		t.Fatalf("DeleteChat: %v", err)
+	}
+	if err := DeleteChat(ctx, db, domain.DefaultWorkspaceID, c.ID, "u1", 0, at); err != gorm.ErrRecordNotFound {
+		t.Fatalf("second delete: expected ErrRecordNotFound, got %v", err)
+	}
+
+	// Hidden from normal queries; the other chat is untouched.
+	if _, err := GetChat(ctx, db, domain.DefaultWorkspaceID, c.ID, "u1"); err != gorm.ErrRecordNotFound {
+		t.Fatalf("GetChat after delete: %v", err)
+	}
+	if n, _ := CountChats(ctx, db, domain.DefaultWorkspaceID, "u1"); n != 1 {
+		t.Fatalf("CountChats after delete = %d, want 1", n)
+	}
+	if n, _ := CountMessages(db, c.ID); n != 0 {
+		t.Fatalf("CountMessages after delete = %d, want 0", n)
+	}
+	if n, _ := CountMessages(db, other.ID); n != 1 {
+		t.Fatalf("other chat messages = %d, want 1", n)
+	}
+	var fb int64
+	db.Model(&domain.Feedback{}).Count(&fb)
+	if fb != 1 {
+		t.Fatalf("visible feedback = %d, want 1", fb)
+	}
+	if _, err := GetIdempotency(ctx, db, domain.DefaultWorkspaceID, "u1", "k-a", time.Now().UTC()); err != ErrNotFound {
+		t.Fatalf("idempotency of deleted chat: expected ErrNotFound, got %v", err)
+	}
+
+	deleted, err := FindDeletedChat(ctx, db, domain.DefaultWorkspaceID, c.ID)
+	if err != nil || !deleted.DeletedAt.Valid || deleted.UserID != "u1" {
+		t.Fatalf("FindDeletedChat: %+v, %v", deleted, err)
+	}
+	if _, err := FindDeletedChat(ctx, db, domain.DefaultWorkspaceID, other.ID); err != gorm.ErrRecordNotFound {
+		t.Fatalf("FindDeletedChat(live): expected ErrRecordNotFound, got %v", err)
+	}
+
+	// Restore brings back the whole tree.
+	if err := RestoreChat(ctx, db, domain.DefaultWorkspaceID, c.ID, "u1", deleted.DeletedAt.Time); err != nil {
+		t.Fatalf("RestoreChat: %v", err)
+	}
+	if _, err := GetChat(ctx, db, domain.DefaultWorkspaceID, c.ID, "u1"); err != nil {
+		t.Fatalf("GetChat after restore: %v", err)
+	}
+	if n, _ := CountMessages(db, c.ID); n != 1 {
+		t.Fatalf("CountMessages after restore = %d, want 1", n)
+	}
+	db.Model(&domain.Feedback{}).Count(&fb)
+	if fb != 2 {
+		t.Fatalf("visible feedback after restore = %d, want 2", fb)
+	}
+	if _, err := GetIdempotency(ctx, db, domain.DefaultWorkspaceID, "u1", "k-a", time.Now().UTC()); err != nil {
+		t.Fatalf("idempotency after restore: %v", err)
+	}
+	if err := RestoreChat(ctx, db, domain.DefaultWorkspaceID, c.ID, "u1", deleted.DeletedAt.Time); err != gorm.ErrRecordNotFound {
+		t.Fatalf("second restore: expected ErrRecordNotFound, got %v", err)
+	}
+}
+
+func TestPurgeDeletedChats_RemovesOnlyExpired(t *testing.T) {
+	db := newChatRepoDB(t, &domain.Chat{}, &domain.ChatShare{}, &domain.ShareLink{}, &domain.Message{}, &domain.MessageSource{}, &domain.Feedback{}, &domain.Idempotency{})
+	ctx := context.Background()
+	old := seedChatTree(t, db, "old")
+	recent := seedChatTree(t, db, "recent")
+	live := seedChatTree(t, db, "live")
+	for _, c := range []*domain.Chat{old, live} {
+		if err := ShareChat(ctx, db, c.ID, "u2"); err != nil {
+			t.Fatalf("ShareChat: %v", err)
+		}
+		if err := SaveShareLink(ctx, db, &domain.ShareLink{ChatID: c.ID, TokenHash: c.ID, CreatedBy: "u1"}); err != nil {
+			t.Fatalf("SaveShareLink: %v", err)
+		}
+	}
+
+	now := time.Now().UTC()
+	if err := DeleteChat(ctx, db, domain.DefaultWorkspaceID, old.ID, "u1", 0, now.Add(-48*time.Hour)); err != nil {
+		t.Fatalf("delete old: %v", err)
+	}
+	if err := DeleteChat(ctx, db, domain.DefaultWorkspaceID, recent.ID, "u1", 0, now.Add(-time.Hour)); err != nil {
+		t.Fatalf("delete recent: %v", err)
+	}
+
+	n, err := PurgeDeletedChats(ctx, db, now.Add(-24*time.Hour))
+	if err != nil || n != 1 {
+		t.Fatalf("PurgeDeletedChats = %d, %v; want 1", n, err)
+	}
+
+	if got := countRows(t, db, &domain.Chat{}, "id = ?", old.ID); got != 0 {
+		t.Fatalf("purged chat still present")
+	}
+	if got := countRows(t, db, &domain.Message{}, "chat_id = ?", old.ID); got != 0 {
+		t.Fatalf("purged chat messages still present: %d", got)
+	}
+	if got := countRows(t, db, &domain.Idempotency{}, "chat_id = ?", old.ID); got != 0 {
+		t.Fatalf("purged chat idempotency still present: %d", got)
+	}
+	if got := countRows(t, db, &domain.ChatShare{}, "chat_id = ?", old.ID); got != 0 {
+		t.Fatalf("purged chat shares still present: %d", got)
+	}
+	if got := countRows(t, db, &domain.ChatShare{}, "chat_id = ?", live.ID); got != 1 {
+		t.Fatalf("live chat shares = %d, want 1", got)
+	}
+	if got := countRows(t, db, &domain.ShareLink{}, "1 = 1"); got != 1 {
+		t.Fatalf("share links = %d, want only the live chat's", got)
+	}
+	if got := countRows(t, db, &domain.Feedback{}, "1 = 1"); got != 2 {
+		t.Fatalf("feedback rows = %d, want 2", got)
+	}
+	if got := countRows(t, db, &domain.MessageSource{}, "1 = 1"); got != 2 {
+		t.Fatalf("message sources = %d, want 2", got)
+	}
+	for _, id := range []string{recent.ID, live.ID} {
+		if got := countRows(t, db, &domain.Chat{}, "id = ?", id); got != 1 {
+			t.Fatalf("chat %s should remain", id)
+		}
+	}
+
+	// Nothing left to purge.
+	if n, err := PurgeDeletedChats(ctx, db, now.Add(-24*time.Hour)); err != nil || n != 0 {
+		t.Fatalf("second purge = %d, %v", n, err)
+	}
+}
+
+func TestImportChat_KeepsTimestampsAndIsAtomic(t *testing.T) {
+	db := newChatRepoDB(t, &domain.Chat{}, &domain.Message{}, &domain.MessageSource{})
+	ctx := context.Background()
+	at := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+
+	chat := &domain.Chat{ID: uuid.NewString(), WorkspaceID: domain.DefaultWorkspaceID, UserID: "u1", Title: "old", Version: 1, CreatedAt: at}
+	score := 0.4
+	msgs := []domain.Message{
+		{ID: uuid.NewString(), ChatID: chat.ID, Role: "user", Content: "q", CreatedAt: at},
+		{ID: uuid.NewString(), ChatID: chat.ID, Role: "assistant", Content: "a", Score: &score, CreatedAt: at.Add(time.Minute)},
+	}
+	msgs[1].Citations = []domain.MessageSource{{ID: uuid.NewString(), MessageID: msgs[1].ID, DocID: "d1", Snippet: "s"}}
+	if err := ImportChat(ctx, db, chat, msgs); err != nil {
+		t.Fatalf("ImportChat: %v", err)
+	}
+
+	got, err := FindChat(ctx, db, domain.DefaultWorkspaceID, chat.ID)
+	if err != nil || !got.CreatedAt.Equal(at) || !got.UpdatedAt.Equal(at) {
+		t.Fatalf("chat = %+v, %v", got, err)
+	}
+	stored, _ := ListMessages(db, chat.ID, 0)
+	if len(stored) != 2 || !stored[1].CreatedAt.Equal(at.Add(time.Minute)) || *stored[1].Score != score {
+		t.Fatalf("messages = %+v", stored)
+	}
+	if err := AttachCitations(db, stored); err != nil || len(stored[1].Citations) != 1 {
+		t.Fatalf("citations = %+v, %v", stored[1].Citations, err)
+	}
+
+	// A failing row rolls the whole chat back.
+	bad := &domain.Chat{ID: uuid.NewString(), WorkspaceID: domain.DefaultWorkspaceID, UserID: "u1", Title: "bad", Version: 1, CreatedAt: at}
+	err = ImportChat(ctx, db, bad, []domain.Message{
+		{ID: uuid.NewString(), ChatID: bad.ID, Role: "user", Content: "ok", CreatedAt: at},
+		{ID: uuid.NewString(), ChatID: bad.ID, Role: "system", Content: "nope", CreatedAt: at},
+	})
+	if err == nil {
+		t.Fatalf("expected role check violation")
+	}
+	if _, err := FindChat(ctx, db, domain.DefaultWorkspaceID, bad.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("bad chat persisted: %v", err)
+	}
+}
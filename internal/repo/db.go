@@ -4,6 +4,7 @@
 package repo
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"time"
@@ -45,12 +46,64 @@ func OpenSQLite(path string) (*gorm.DB, error) {
 	return db, nil
 }
 
-// AutoMigrate keeps as you had it.
+// OptimizeSQLite runs SQLite's periodic housekeeping: PRAGMA optimize (which
+// refreshes query planner statistics where useful) and a WAL checkpoint that
+// truncates the write-ahead log. It returns the number of WAL frames
+// checkpointed (0 when the database is not in WAL mode).
+func OptimizeSQLite(ctx context.Context, db *gorm.DB) (int64, error) {
+	db = db.WithContext(ctx)
+	if err := db.Exec("PRAGMA optimize;").Error; err != nil {
+		return 0, err
+	}
+	// Columns: busy flag, frames in the WAL, frames checkpointed (-1 when
+	// not in WAL mode).
+	var busy, frames, checkpointed int64
+	if err := db.Raw("PRAGMA wal_checkpoint(TRUNCATE);").Row().Scan(&busy, &frames, &checkpointed); err != nil {
+		return 0, err
+	}
+	return max(checkpointed, 0), nil
+}
+
+// AutoMigrate migrates the schema of all models and then sets up the message
+// search index (see EnsureMessageSearch) and links the messages of older
+// chats into trees (see EnsureMessageTree).
 func AutoMigrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+	if err := dropLegacyIdempotency(db); err != nil {
+		return err
+	}
+	err := db.AutoMigrate(
+		&domain.Workspace{},
+		&domain.WorkspaceMember{},
 		&domain.Chat{},
+		&domain.ChatShare{},
+		&domain.ShareLink{},
 		&domain.Message{},
+		&domain.MessageSource{},
 		&domain.Feedback{},
 		&domain.Idempotency{},
+		&domain.APIKey{},
+		&domain.UsageCounter{},
+		&domain.QuotaOverride{},
+		&domain.RateLimitBucket{},
+		&domain.JobLease{},
 	)
+	if err != nil {
+		return err
+	}
+	if err := EnsureMessageSearch(db); err != nil {
+		return err
+	}
+	return EnsureMessageTree(db)
+}
+
+// dropLegacyIdempotency removes idempotency records from before responses
+// were cached (they only referenced a message id and were unique per chat),
+// along with that schema, so AutoMigrate recreates the table. They are a
+// retry cache, so dropping them only means such retries run again.
+func dropLegacyIdempotency(db *gorm.DB) error {
+	m := db.Migrator()
+	if !m.HasTable(&domain.Idempotency{}) || !m.HasColumn(&domain.Idempotency{}, "message_id") {
+		return nil
+	}
+	return m.DropTable(&domain.Idempotency{})
 }
@@ -1,6 +1,7 @@
 package repo
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"strings"
@@ -95,7 +96,7 @@ func TestOpenSQLite_SetsPragmas_Pool_AndAutoMigrate(t *testing.T) {
 		t.Fatalf("AutoMigrate: %v", err)
 	}
 	m := db.Migrator()
-	for _, tbl := range []any{&domain.Chat{}, &domain.Message{}, &domain.Feedback{}, &domain.Idempotency{}} {
+	for _, tbl := range []any{&domain.Chat{}, &domain.ChatShare{}, &domain.Message{}, &domain.Feedback{}, &domain.Idempotency{}, &domain.APIKey{}, &domain.Workspace{}, &domain.WorkspaceMember{}, &domain.UsageCounter{}, &domain.QuotaOverride{}, &domain.RateLimitBucket{}} {
 		if !m.HasTable(tbl) {
 			t.Fatalf("expected table for %T to exist", tbl)
 		}
@@ -122,5 +123,66 @@ func TestOpenSQLite_SetsPragmas_Pool_AndAutoMigrate(t *testing.T) {
 	}
 }
 
+func TestOptimizeSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.db")
+	db, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		t.Cleanup(func() { _ = sqlDB.Close() })
+	}
+	if err := AutoMigrate(db); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+	if _, err := OptimizeSQLite(context.Background(), db); err != nil {
+		t.Fatalf("OptimizeSQLite: %v", err)
+	}
+	// The checkpoint truncated the write-ahead log.
+	if fi, err := os.Stat(path + "-wal"); err == nil && fi.Size() != 0 {
+		t.Fatalf("WAL not truncated: %d bytes", fi.Size())
+	}
+}
+
+func TestAutoMigrate_DropsLegacyIdempotency(t *testing.T) {
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "legacy.db"))
+	if err != nil {
+		t.Fatalf("OpenSQLite: %v", err)
+	}
+	sqlDB, _ := db.DB()
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	// Schema of message-id records, unique per (user, chat, key).
+	for _, stmt := range []string{
+		`CREATE TABLE idempotency (id TEXT NOT NULL PRIMARY KEY, workspace_id TEXT NOT NULL DEFAULT 'default',
+			user_id TEXT NOT NULL, chat_id TEXT NOT NULL, key TEXT NOT NULL, message_id TEXT NOT NULL,
+			status INTEGER NOT NULL, created_at DATETIME NOT NULL, expires_at DATETIME NOT NULL)`,
+		`CREATE UNIQUE INDEX ux_user_chat_key ON idempotency (user_id, chat_id, key)`,
+		`INSERT INTO idempotency VALUES ('i1', 'default', 'u1', 'c1', 'k1', 'm1', 200, '2026-01-01', '2099-01-01')`,
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatalf("legacy schema: %v", err)
+		}
+	}
+
+	if err := AutoMigrate(db); err != nil {
+		t.Fatalf("AutoMigrate: %v", err)
+	}
+	m := db.Migrator()
+	if m.HasColumn(&domain.Idempotency{}, "message_id") || m.HasIndex(&domain.Idempotency{}, "ux_user_chat_key") ||
+		!m.HasIndex(&domain.Idempotency{}, "ux_idempotency_key") {
+		t.Fatalf("legacy idempotency schema not replaced")
+	}
+	var n int64
+	db.Model(&domain.Idempotency{}).Count(&n)
+	if n != 0 {
+		t.Fatalf("legacy records kept: %d", n)
+	}
+	// Migrating again is a no-op.
+	if err := AutoMigrate(db); err != nil {
+		t.Fatalf("AutoMigrate (again): %v", err)
+	}
+}
+
 // Compile-time guard to ensure signature stability.
 var _ func(string) (*gorm.DB, error) = OpenSQLite
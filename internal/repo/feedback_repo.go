@@ -13,13 +13,17 @@
 //
 // Functions:
 //
-//   - CreateFeedback(ctx, db, messageID, userID, value) -> error
-//     Inserts a feedback row. The (message_id,user_id) pair must be unique.
+//   - CreateFeedback(ctx, db, workspaceID, messageID, userID, value) -> error
+//     Inserts a feedback row in the workspace of the rated message's chat.
+//     The (message_id,user_id) pair must be unique.
+//
+//   - ListFeedback(ctx, db, messageIDs) -> ([]domain.Feedback, error)
+//     Returns the feedback on a set of messages (e.g. a page of a transcript).
 //
 // Usage:
 //
 //	// In the service layer
-//	err := repo.CreateFeedback(ctx, db, msgID, userID, +1)
+//	err := repo.CreateFeedback(ctx, db, workspaceID, msgID, userID, +1)
 //	if err != nil {
 //	    // detect unique-violation and translate to services.ErrDuplicateFeedback
 //	}
@@ -35,7 +39,8 @@ import (
 	"github.com/tbourn/go-chat-backend/internal/domain"
 )
 
-// CreateFeedback inserts a feedback row for the given message and user.
+// CreateFeedback inserts a feedback row for the given message and user,
+// recorded in workspaceID (the workspace of the message's chat).
 //
 // The combination (message_id, user_id) must be unique, enforced by the
 // database schema (unique index). If a duplicate exists, the database will
@@ -46,13 +51,28 @@ import (
 // enforced at higher layers (handlers/services) and/or via DB constraints.
 //
 // On success, it returns nil. On failure, it returns a DB error.
-func CreateFeedback(ctx context.Context, db *gorm.DB, messageID, userID string, value int) error {
+func CreateFeedback(ctx context.Context, db *gorm.DB, workspaceID, messageID, userID string, value int) error {
 	fb := &domain.Feedback{
-		ID:        uuid.NewString(),
-		MessageID: messageID,
-		UserID:    userID,
-		Value:     value,
-		CreatedAt: time.Now().UTC(),
+		ID:          uuid.NewString(),
+		WorkspaceID: workspaceID,
+		MessageID:   messageID,
+		UserID:      userID,
+		Value:       value,
+		CreatedAt:   time.Now().UTC(),
 	}
 	return db.WithContext(ctx).Create(fb).Error
 }
+
+// ListFeedback returns the live feedback left on the given messages, ordered
+// by message, then oldest first.
+func ListFeedback(ctx context.Context, db *gorm.DB, messageIDs []string) ([]domain.Feedback, error) {
+	var out []domain.Feedback
+	if len(messageIDs) == 0 {
+		return out, nil
+	}
+	err := db.WithContext(ctx).
+		Where("message_id IN ?", messageIDs).
+		Order("message_id ASC, created_at ASC, id ASC").
+		Find(&out).Error
+	return out, err
+}
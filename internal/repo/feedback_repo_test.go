@@ -37,7 +37,7 @@ func ensureFeedbackUniqueIndex(t *testing.T, db *gorm.DB) {
 
 func TestCreateFeedback_Error_NoTable(t *testing.T) {
 	db := newFeedbackDB(t /* no migrations */)
-	err := CreateFeedback(context.Background(), db, "m1", "u1", 1)
+	err := CreateFeedback(context.Background(), db, domain.DefaultWorkspaceID, "m1", "u1", 1)
 	if err == nil {
 		t.Fatalf("expected error when feedbacks table is missing")
 	}
@@ -54,7 +54,7 @@ func TestCreateFeedback_Success_InsertsRow(t *testing.T) {
 	ctx := context.WithValue(context.Background(), "req", "123")
 	start := time.Now().UTC()
 
-	if err := CreateFeedback(ctx, db, "m1", "u1", -1); err != nil {
+	if err := CreateFeedback(ctx, db, domain.DefaultWorkspaceID, "m1", "u1", -1); err != nil {
 		t.Fatalf("CreateFeedback error: %v", err)
 	}
 
@@ -80,11 +80,41 @@ func TestCreateFeedback_Duplicate_ReturnsError(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	if err := CreateFeedback(ctx, db, "mdup", "u1", 1); err != nil {
+	if err := CreateFeedback(ctx, db, domain.DefaultWorkspaceID, "mdup", "u1", 1); err != nil {
 		t.Fatalf("first CreateFeedback should succeed: %v", err)
 	}
 	// Same (message_id, user_id) → unique violation → repo should return raw DB error
-	if err := CreateFeedback(ctx, db, "mdup", "u1", -1); err == nil {
+	if err := CreateFeedback(ctx, db, domain.DefaultWorkspaceID, "mdup", "u1", -1); err == nil {
 		t.Fatalf("expected duplicate error on second insert")
 	}
 }
+
+func TestListFeedback_ByMessages(t *testing.T) {
+	db := newChatRepoDB(t, &domain.Chat{}, &domain.Message{}, &domain.Feedback{})
+	ctx := context.Background()
+	c, _ := CreateChat(ctx, db, domain.DefaultWorkspaceID, "u1", "t")
+	m1, _ := CreateMessage(db, c.ID, "assistant", "a", nil)
+	m2, _ := CreateMessage(db, c.ID, "assistant", "b", nil)
+	m3, _ := CreateMessage(db, c.ID, "assistant", "c", nil)
+	for _, f := range []struct {
+		msg, user string
+		value     int
+	}{{m1.ID, "u1", 1}, {m1.ID, "u2", -1}, {m2.ID, "u1", -1}, {m3.ID, "u1", 1}} {
+		if err := CreateFeedback(ctx, db, domain.DefaultWorkspaceID, f.msg, f.user, f.value); err != nil {
+			t.Fatalf("CreateFeedback: %v", err)
+		}
+	}
+
+	got, err := ListFeedback(ctx, db, []string{m1.ID, m2.ID})
+	if err != nil || len(got) != 3 {
+		t.Fatalf("ListFeedback = %+v, %v", got, err)
+	}
+	for _, f := range got {
+		if f.MessageID == m3.ID {
+			t.Fatalf("unexpected feedback on m3: %+v", f)
+		}
+	}
+	if got, err := ListFeedback(ctx, db, nil); err != nil || len(got) != 0 {
+		t.Fatalf("ListFeedback(nil) = %+v, %v", got, err)
+	}
+}
@@ -1,6 +1,6 @@
 // Package repo implements the data persistence layer for domain entities,
 // backed by GORM. This file provides repository helpers for the Idempotency
-// model used to implement safe-retry semantics for POST endpoints.
+// model used to implement safe-retry semantics for mutating endpoints.
 package repo
 
 import (
@@ -16,17 +16,20 @@ import (
 )
 
 // ErrDuplicate indicates that an idempotency record already exists for the
-// given (user_id, chat_id, key) tuple.
+// given (workspace_id, user_id, key) tuple.
 var ErrDuplicate = errors.New("duplicate")
 
-// GetIdempotency returns a non-expired record or ErrNotFound.
-func GetIdempotency(ctx context.Context, db *gorm.DB, userID, chatID, key string, now time.Time) (*domain.Idempotency, error) {
-	if strings.TrimSpace(chatID) == "" {
-		return nil, ErrNotFound
-	}
+// deletedChatRecord matches records of a soft-deleted chat.
+const deletedChatRecord = "EXISTS (SELECT 1 FROM chats WHERE chats.id = idempotency.chat_id AND chats.deleted_at IS NOT NULL)"
+
+// GetIdempotency returns the non-expired record of (workspaceID, userID, key)
+// or ErrNotFound. Records of a soft-deleted chat are not returned, so retries
+// against a deleted chat are not replayed.
+func GetIdempotency(ctx context.Context, db *gorm.DB, workspaceID, userID, key string, now time.Time) (*domain.Idempotency, error) {
 	var rec domain.Idempotency
 	err := db.WithContext(ctx).
-		Where("user_id = ? AND chat_id = ? AND key = ? AND expires_at > ?", userID, chatID, key, now).
+		Where("workspace_id = ? AND user_id = ? AND key = ? AND expires_at > ?", workspaceID, userID, key, now).
+		Where("NOT " + deletedChatRecord).
 		First(&rec).Error
 	if errors.Is(err, gorm.ErrRecordNotFound) {
 		return nil, ErrNotFound
@@ -34,18 +37,14 @@ func GetIdempotency(ctx context.Context, db *gorm.DB, userID, chatID, key string
 	return &rec, err
 }
 
-// CreateIdempotency inserts a record and returns ErrDuplicate on unique violation.
-func CreateIdempotency(ctx context.Context, db *gorm.DB, userID, chatID, key, messageID string, status int, ttl time.Duration) (*domain.Idempotency, error) {
-	now := time.Now().UTC()
-	rec := &domain.Idempotency{
-		ID:        uuid.NewString(),
-		UserID:    userID,
-		ChatID:    chatID,
-		Key:       key,
-		MessageID: messageID,
-		Status:    status,
-		CreatedAt: now,
-		ExpiresAt: now.Add(ttl),
+// CreateIdempotency inserts rec, assigning its ID and CreatedAt when empty,
+// and returns ErrDuplicate on unique violation.
+func CreateIdempotency(ctx context.Context, db *gorm.DB, rec *domain.Idempotency) error {
+	if rec.ID == "" {
+		rec.ID = uuid.NewString()
+	}
+	if rec.CreatedAt.IsZero() {
+		rec.CreatedAt = time.Now().UTC()
 	}
 	if err := db.WithContext(ctx).Create(rec).Error; err != nil {
 		// glebarez/sqlite often returns plain-text errors for UNIQUE violations.
@@ -53,9 +52,82 @@ func CreateIdempotency(ctx context.Context, db *gorm.DB, userID, chatID, key, me
 		if errors.Is(err, gorm.ErrDuplicatedKey) ||
 			strings.Contains(low, "unique constraint failed") ||
 			strings.Contains(low, "constraint failed: unique") {
-			return nil, ErrDuplicate
+			return ErrDuplicate
+		}
+		return err
+	}
+	return nil
+}
+
+// BeginIdempotency claims rec's key for a new request by inserting rec
+// (normally in state domain.IdempotencyInFlight). When a live record already
+// holds the key it is returned with claimed=false. Expired records and those
+// of a soft-deleted chat are replaced.
+func BeginIdempotency(ctx context.Context, db *gorm.DB, rec *domain.Idempotency, now time.Time) (prev *domain.Idempotency, claimed bool, err error) {
+	// Concurrent claimants race on the unique index; a loser sees the
+	// winner's record on its next attempt.
+	for attempt := 0; attempt < 3; attempt++ {
+		err = CreateIdempotency(ctx, db, rec)
+		if err == nil {
+			return nil, true, nil
+		}
+		if !errors.Is(err, ErrDuplicate) {
+			return nil, false, err
+		}
+		prev, err = GetIdempotency(ctx, db, rec.WorkspaceID, rec.UserID, rec.Key, now)
+		if err == nil {
+			return prev, false, nil
 		}
-		return nil, err
+		if !errors.Is(err, ErrNotFound) {
+			return nil, false, err
+		}
+		err = db.WithContext(ctx).
+			Where("workspace_id = ? AND user_id = ? AND key = ?", rec.WorkspaceID, rec.UserID, rec.Key).
+			Where("expires_at <= ? OR "+deletedChatRecord, now).
+			Delete(&domain.Idempotency{}).Error
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return nil, false, ErrDuplicate
+}
+
+// CompleteIdempotency stores the response of a claimed request: the
+// in-flight record with rec's key and fingerprint takes rec's Status, Header,
+// Body and ExpiresAt. It returns ErrNotFound when the claim was lost (it
+// expired and another request took the key over).
+func CompleteIdempotency(ctx context.Context, db *gorm.DB, rec *domain.Idempotency) error {
+	res := db.WithContext(ctx).Model(&domain.Idempotency{}).
+		Where("workspace_id = ? AND user_id = ? AND key = ? AND fingerprint = ? AND state = ?",
+			rec.WorkspaceID, rec.UserID, rec.Key, rec.Fingerprint, domain.IdempotencyInFlight).
+		Updates(map[string]any{
+			"state":      domain.IdempotencyCompleted,
+			"status":     rec.Status,
+			"header":     rec.Header,
+			"body":       rec.Body,
+			"expires_at": rec.ExpiresAt,
+		})
+	if res.Error != nil {
+		return res.Error
 	}
-	return rec, nil
+	if res.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ReleaseIdempotency deletes the in-flight record with the given key and
+// fingerprint, so the request can be retried with the same key.
+func ReleaseIdempotency(ctx context.Context, db *gorm.DB, workspaceID, userID, key, fingerprint string) error {
+	return db.WithContext(ctx).
+		Where("workspace_id = ? AND user_id = ? AND key = ? AND fingerprint = ? AND state = ?",
+			workspaceID, userID, key, fingerprint, domain.IdempotencyInFlight).
+		Delete(&domain.Idempotency{}).Error
+}
+
+// DeleteExpiredIdempotency removes records (completed or in flight) that
+// expired at or before now and returns how many were removed.
+func DeleteExpiredIdempotency(ctx context.Context, db *gorm.DB, now time.Time) (int64, error) {
+	res := db.WithContext(ctx).Where("expires_at <= ?", now).Delete(&domain.Idempotency{})
+	return res.RowsAffected, res.Error
 }
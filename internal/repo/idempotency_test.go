@@ -31,110 +31,101 @@ func newIdemDB(t *testing.T, migrate ...any) *gorm.DB {
 	return db
 }
 
-func ensureUniqueIndex(t *testing.T, db *gorm.DB) {
-	t.Helper()
-	// Ensure uniqueness on (user_id, chat_id, key) so duplicate path is guaranteed.
-	db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_idempotency_user_chat_key ON idempotencies(user_id, chat_id, key)`)
-}
-
-func TestGetIdempotency_NoChatID_ReturnsNotFound(t *testing.T) {
-	db := newIdemDB(t, &domain.Idempotency{})
-	now := time.Now().UTC()
-
-	rec, err := GetIdempotency(context.Background(), db, "u1", "   ", "k1", now)
-	if rec != nil || err != ErrNotFound {
-		t.Fatalf("expected (nil, ErrNotFound) for empty chatID, got (%v, %v)", rec, err)
+// idemRec returns an in-flight record of u1's key k in the default workspace.
+func idemRec(k, fingerprint string, expires time.Time) *domain.Idempotency {
+	return &domain.Idempotency{
+		WorkspaceID: domain.DefaultWorkspaceID,
+		UserID:      "u1",
+		Key:         k,
+		Fingerprint: fingerprint,
+		State:       domain.IdempotencyInFlight,
+		ExpiresAt:   expires,
 	}
 }
 
 func TestGetIdempotency_ExpiredOrMissing_ReturnsNotFound(t *testing.T) {
-	db := newIdemDB(t, &domain.Idempotency{})
+	db := newIdemDB(t, &domain.Chat{}, &domain.Idempotency{})
 	now := time.Now().UTC()
 
 	// Insert an expired record (expires_at <= now)
 	exp := &domain.Idempotency{
-		ID:        "expired",
-		UserID:    "u1",
-		ChatID:    "c1",
-		Key:       "k1",
-		Status:    200,
-		CreatedAt: now.Add(-2 * time.Hour),
-		ExpiresAt: now.Add(-time.Hour),
+		ID:          "expired",
+		WorkspaceID: domain.DefaultWorkspaceID,
+		UserID:      "u1",
+		Key:         "k1",
+		Status:      200,
+		CreatedAt:   now.Add(-2 * time.Hour),
+		ExpiresAt:   now.Add(-time.Hour),
 	}
 	if err := db.Create(exp).Error; err != nil {
 		t.Fatalf("seed expired: %v", err)
 	}
 
-	rec, err := GetIdempotency(context.Background(), db, "u1", "c1", "k1", now)
+	rec, err := GetIdempotency(context.Background(), db, domain.DefaultWorkspaceID, "u1", "k1", now)
 	if rec != nil || err != ErrNotFound {
 		t.Fatalf("expected (nil, ErrNotFound) for expired, got (%v, %v)", rec, err)
 	}
 
 	// Also check a totally missing key
-	rec2, err2 := GetIdempotency(context.Background(), db, "u1", "c1", "missing", now)
+	rec2, err2 := GetIdempotency(context.Background(), db, domain.DefaultWorkspaceID, "u1", "missing", now)
 	if rec2 != nil || err2 != ErrNotFound {
 		t.Fatalf("expected (nil, ErrNotFound) for missing, got (%v, %v)", rec2, err2)
 	}
 }
 
 func TestGetIdempotency_Success(t *testing.T) {
-	db := newIdemDB(t, &domain.Idempotency{})
+	db := newIdemDB(t, &domain.Chat{}, &domain.Idempotency{})
 	now := time.Now().UTC()
 
 	ok := &domain.Idempotency{
-		ID:        "ok",
-		UserID:    "u1",
-		ChatID:    "c2",
-		Key:       "k2",
-		MessageID: "m1",
-		Status:    201,
-		CreatedAt: now.Add(-time.Minute),
-		ExpiresAt: now.Add(time.Hour),
+		ID:          "ok",
+		WorkspaceID: domain.DefaultWorkspaceID,
+		UserID:      "u1",
+		ChatID:      "c2",
+		Key:         "k2",
+		State:       domain.IdempotencyCompleted,
+		Status:      201,
+		Body:        []byte("body"),
+		CreatedAt:   now.Add(-time.Minute),
+		ExpiresAt:   now.Add(time.Hour),
 	}
 	if err := db.Create(ok).Error; err != nil {
 		t.Fatalf("seed ok: %v", err)
 	}
 
-	rec, err := GetIdempotency(context.Background(), db, "u1", "c2", "k2", now)
+	rec, err := GetIdempotency(context.Background(), db, domain.DefaultWorkspaceID, "u1", "k2", now)
 	if err != nil {
 		t.Fatalf("GetIdempotency success err: %v", err)
 	}
-	if rec == nil || rec.MessageID != "m1" || rec.Status != 201 {
+	if rec == nil || rec.ChatID != "c2" || rec.Status != 201 || string(rec.Body) != "body" {
 		t.Fatalf("unexpected record: %+v", rec)
 	}
 }
 
 func TestCreateIdempotency_SuccessAndDuplicate(t *testing.T) {
 	db := newIdemDB(t, &domain.Idempotency{})
-	ensureUniqueIndex(t, db)
 
-	ttl := 90 * time.Minute
 	start := time.Now().UTC()
+	rec := idemRec("k9", "fp", start.Add(90*time.Minute))
 
 	// Success
-	rec, err := CreateIdempotency(context.Background(), db, "u9", "c9", "k9", "m9", 202, ttl)
-	if err != nil {
+	if err := CreateIdempotency(context.Background(), db, rec); err != nil {
 		t.Fatalf("CreateIdempotency error: %v", err)
 	}
-	if rec == nil || rec.ID == "" || rec.UserID != "u9" || rec.ChatID != "c9" || rec.Key != "k9" || rec.MessageID != "m9" || rec.Status != 202 {
+	if rec.ID == "" || rec.CreatedAt.Before(start) {
 		t.Fatalf("unexpected record: %+v", rec)
 	}
-	// ExpiresAt should be in (start, start+2h) — loose bound to avoid timing flakes.
-	if !(rec.ExpiresAt.After(start) && rec.ExpiresAt.Before(start.Add(2*time.Hour))) {
-		t.Fatalf("unexpected ExpiresAt: %v", rec.ExpiresAt)
-	}
 
-	// Duplicate (same user, chat, key) should map to ErrDuplicate
-	_, err2 := CreateIdempotency(context.Background(), db, "u9", "c9", "k9", "mX", 200, ttl)
-	if err2 != ErrDuplicate {
-		t.Fatalf("expected ErrDuplicate, got %v", err2)
+	// Duplicate (same workspace, user, key) should map to ErrDuplicate
+	if err := CreateIdempotency(context.Background(), db, idemRec("k9", "other", start.Add(time.Hour))); err != ErrDuplicate {
+		t.Fatalf("expected ErrDuplicate, got %v", err)
 	}
 }
 
 // Generic DB error path: attempt insert without migrating the table.
 func TestCreateIdempotency_Error_NoTable(t *testing.T) {
-	db := newIdemDB(t) // intentionally NOT migrating idempotencies
-	_, err := CreateIdempotency(context.Background(), db, "uX", "cX", "kX", "mX", 200, time.Minute)
+	db := newIdemDB(t) // intentionally NOT migrating idempotency
+	err := CreateIdempotency(context.Background(), db, idemRec("kX", "fp", time.Now().Add(time.Minute)))
 	if err == nil {
 		t.Fatalf("expected error when table is missing")
 	}
@@ -142,3 +133,112 @@ func TestCreateIdempotency_Error_NoTable(t *testing.T) {
 		t.Fatalf("expected non-duplicate error, got ErrDuplicate")
 	}
 }
+
+func TestBeginIdempotency_ClaimExistingAndTakeover(t *testing.T) {
+	db := newIdemDB(t, &domain.Chat{}, &domain.Idempotency{})
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	// First request claims the key.
+	prev, claimed, err := BeginIdempotency(ctx, db, idemRec("k", "fp-1", now.Add(time.Minute)), now)
+	if err != nil || !claimed || prev != nil {
+		t.Fatalf("first Begin = %v, %v, %v", prev, claimed, err)
+	}
+	// A retry sees the in-flight claim.
+	prev, claimed, err = BeginIdempotency(ctx, db, idemRec("k", "fp-2", now.Add(time.Minute)), now)
+	if err != nil || claimed || prev == nil || prev.State != domain.IdempotencyInFlight || prev.Fingerprint != "fp-1" {
+		t.Fatalf("retry Begin = %+v, %v, %v", prev, claimed, err)
+	}
+	// Once the claim has expired (e.g. the process died), the key is taken over.
+	later := now.Add(2 * time.Minute)
+	prev, claimed, err = BeginIdempotency(ctx, db, idemRec("k", "fp-3", later.Add(time.Minute)), later)
+	if err != nil || !claimed || prev != nil {
+		t.Fatalf("takeover Begin = %v, %v, %v", prev, claimed, err)
+	}
+	if got, _ := GetIdempotency(ctx, db, domain.DefaultWorkspaceID, "u1", "k", later); got == nil || got.Fingerprint != "fp-3" {
+		t.Fatalf("expected the new claim, got %+v", got)
+	}
+
+	// Records of a deleted chat are taken over too.
+	deleted := &domain.Chat{ID: "c-del", UserID: "u1", Title: "t"}
+	if err := db.Create(deleted).Error; err != nil {
+		t.Fatalf("seed chat: %v", err)
+	}
+	rec := idemRec("k-chat", "fp", now.Add(time.Hour))
+	rec.ChatID = deleted.ID
+	if _, claimed, err := BeginIdempotency(ctx, db, rec, now); !claimed || err != nil {
+		t.Fatalf("chat Begin = %v, %v", claimed, err)
+	}
+	if err := db.Delete(deleted).Error; err != nil {
+		t.Fatalf("soft delete chat: %v", err)
+	}
+	rec = idemRec("k-chat", "fp", now.Add(time.Hour))
+	if prev, claimed, err := BeginIdempotency(ctx, db, rec, now); !claimed || err != nil {
+		t.Fatalf("deleted chat Begin = %+v, %v, %v", prev, claimed, err)
+	}
+}
+
+func TestCompleteAndReleaseIdempotency(t *testing.T) {
+	db := newIdemDB(t, &domain.Chat{}, &domain.Idempotency{})
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	if _, claimed, err := BeginIdempotency(ctx, db, idemRec("k", "fp", now.Add(time.Minute)), now); !claimed || err != nil {
+		t.Fatalf("Begin = %v, %v", claimed, err)
+	}
+	done := idemRec("k", "fp", now.Add(24*time.Hour))
+	done.Status, done.Header, done.Body = 201, `{"X-A":["1"]}`, []byte("created")
+	if err := CompleteIdempotency(ctx, db, done); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	got, err := GetIdempotency(ctx, db, domain.DefaultWorkspaceID, "u1", "k", now.Add(time.Hour))
+	if err != nil || got.State != domain.IdempotencyCompleted || got.Status != 201 || got.Header != done.Header || string(got.Body) != "created" {
+		t.Fatalf("completed record = %+v, %v", got, err)
+	}
+	// Completing again (no in-flight claim) reports the lost claim.
+	if err := CompleteIdempotency(ctx, db, done); err != ErrNotFound {
+		t.Fatalf("second Complete: %v", err)
+	}
+	// Release only drops in-flight claims with the same fingerprint.
+	if err := ReleaseIdempotency(ctx, db, domain.DefaultWorkspaceID, "u1", "k", "fp"); err != nil {
+		t.Fatalf("Release completed: %v", err)
+	}
+	if _, err := GetIdempotency(ctx, db, domain.DefaultWorkspaceID, "u1", "k", now); err != nil {
+		t.Fatalf("completed record released: %v", err)
+	}
+
+	if _, claimed, _ := BeginIdempotency(ctx, db, idemRec("k2", "fp", now.Add(time.Minute)), now); !claimed {
+		t.Fatalf("Begin k2 not claimed")
+	}
+	if err := ReleaseIdempotency(ctx, db, domain.DefaultWorkspaceID, "u1", "k2", "other"); err != nil {
+		t.Fatalf("Release other fingerprint: %v", err)
+	}
+	if _, err := GetIdempotency(ctx, db, domain.DefaultWorkspaceID, "u1", "k2", now); err != nil {
+		t.Fatalf("claim with another fingerprint released: %v", err)
+	}
+	if err := ReleaseIdempotency(ctx, db, domain.DefaultWorkspaceID, "u1", "k2", "fp"); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if _, err := GetIdempotency(ctx, db, domain.DefaultWorkspaceID, "u1", "k2", now); err != ErrNotFound {
+		t.Fatalf("released claim still present: %v", err)
+	}
+}
+
+func TestDeleteExpiredIdempotency(t *testing.T) {
+	db := newIdemDB(t, &domain.Chat{}, &domain.Idempotency{})
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	for k, exp := range map[string]time.Time{"old": now.Add(-time.Hour), "edge": now, "live": now.Add(time.Hour)} {
+		if err := CreateIdempotency(ctx, db, idemRec(k, "fp", exp)); err != nil {
+			t.Fatalf("seed %s: %v", k, err)
+		}
+	}
+	n, err := DeleteExpiredIdempotency(ctx, db, now)
+	if err != nil || n != 2 {
+		t.Fatalf("DeleteExpiredIdempotency = %d, %v", n, err)
+	}
+	if _, err := GetIdempotency(ctx, db, domain.DefaultWorkspaceID, "u1", "live", now); err != nil {
+		t.Fatalf("live record deleted: %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+// Package repo implements the data persistence layer for domain entities,
+// backed by GORM. This file provides keyset (cursor) pagination over chats
+// and messages, ordered by (created_at, id) (see package pagination).
+package repo
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/pagination"
+)
+
+// ListChatsKeyset returns a page of the chats of userID in workspaceID, in
+// list order, and whether more chats follow in the paging direction.
+func ListChatsKeyset(ctx context.Context, db *gorm.DB, workspaceID, userID string, p pagination.Page) ([]domain.Chat, bool, error) {
+	var out []domain.Chat
+	err := keyset(db.WithContext(ctx).Where("workspace_id = ? AND user_id = ?", workspaceID, userID), p).
+		Find(&out).Error
+	if err != nil {
+		return nil, false, err
+	}
+	out, more := pagination.Trim(out, p)
+	return out, more, nil
+}
+
+// ListMessagesKeyset returns a page of the messages of a chat, in list
+// order, and whether more messages follow in the paging direction.
+func ListMessagesKeyset(db *gorm.DB, chatID string, p pagination.Page) ([]domain.Message, bool, error) {
+	var out []domain.Message
+	if err := keyset(db.Where("chat_id = ?", chatID), p).Find(&out).Error; err != nil {
+		return nil, false, err
+	}
+	out, more := pagination.Trim(out, p)
+	return out, more, nil
+}
+
+// keyset restricts q to the rows past p.Cursor in the page's reading order
+// and fetches one row more than p.Limit so callers can tell if more follow.
+func keyset(q *gorm.DB, p pagination.Page) *gorm.DB {
+	op, order := "<", "created_at DESC, id DESC"
+	if p.Ascending() {
+		op, order = ">", "created_at ASC, id ASC"
+	}
+	if p.Cursor != nil {
+		q = q.Where("(created_at "+op+" ? OR (created_at = ? AND id "+op+" ?))",
+			p.Cursor.CreatedAt, p.Cursor.CreatedAt, p.Cursor.ID)
+	}
+	return q.Order(order).Limit(p.Limit + 1)
+}
@@ -0,0 +1,114 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/pagination"
+)
+
+func TestListChatsKeyset_WalksBothWaysInBothOrders(t *testing.T) {
+	db := newChatRepoDB(t, &domain.Chat{})
+	ctx := context.Background()
+	ws := domain.DefaultWorkspaceID
+
+	// Seven chats; c2..c4 share a timestamp so ties are broken by id. The
+	// sub-second parts vary in length to catch text-ordering mistakes.
+	base := time.Date(2025, 5, 1, 12, 0, 0, 0, time.UTC)
+	offsets := []time.Duration{0, 500 * time.Millisecond, time.Second, time.Second, time.Second, time.Second + 123456789, 2 * time.Second}
+	var asc []string
+	for i, off := range offsets {
+		c := &domain.Chat{ID: fmt.Sprintf("c%d", i), WorkspaceID: ws, UserID: "u1", Title: "t", CreatedAt: base.Add(off)}
+		if err := db.Create(c).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+		asc = append(asc, c.ID)
+	}
+	if err := db.Create(&domain.Chat{ID: "other", WorkspaceID: ws, UserID: "u2", CreatedAt: base}).Error; err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	desc := slices.Clone(asc)
+	slices.Reverse(desc)
+
+	ids := func(cs []domain.Chat) []string {
+		out := make([]string, len(cs))
+		for i, c := range cs {
+			out[i] = c.ID
+		}
+		return out
+	}
+	at := func(c domain.Chat) *pagination.Cursor {
+		return &pagination.Cursor{CreatedAt: c.CreatedAt, ID: c.ID}
+	}
+
+	for _, order := range []struct {
+		desc bool
+		want []string
+	}{{false, asc}, {true, desc}} {
+		// Forward from the start.
+		var got []string
+		var last *pagination.Cursor
+		for {
+			page, more, err := ListChatsKeyset(ctx, db, ws, "u1", pagination.Page{Cursor: last, Desc: order.desc, Limit: 3})
+			if err != nil {
+				t.Fatalf("ListChatsKeyset: %v", err)
+			}
+			got = append(got, ids(page)...)
+			if !more {
+				break
+			}
+			last = at(page[len(page)-1])
+		}
+		if !slices.Equal(got, order.want) {
+			t.Fatalf("desc=%v forward = %v, want %v", order.desc, got, order.want)
+		}
+
+		// Backward from the end; pages still come in list order.
+		got, last = nil, nil
+		for {
+			page, more, err := ListChatsKeyset(ctx, db, ws, "u1", pagination.Page{Cursor: last, Backward: true, Desc: order.desc, Limit: 3})
+			if err != nil {
+				t.Fatalf("ListChatsKeyset: %v", err)
+			}
+			got = append(ids(page), got...)
+			if !more {
+				break
+			}
+			last = at(page[0])
+		}
+		if !slices.Equal(got, order.want) {
+			t.Fatalf("desc=%v backward = %v, want %v", order.desc, got, order.want)
+		}
+	}
+}
+
+func TestListMessagesKeyset_StableUnderInserts(t *testing.T) {
+	db := newChatRepoDB(t, &domain.Chat{}, &domain.Message{})
+	ctx := context.Background()
+	c, _ := CreateChat(ctx, db, domain.DefaultWorkspaceID, "u1", "t")
+	for i := 0; i < 4; i++ {
+		if _, err := CreateMessage(db, c.ID, "user", fmt.Sprint(i), nil); err != nil {
+			t.Fatalf("CreateMessage: %v", err)
+		}
+	}
+
+	first, more, err := ListMessagesKeyset(db, c.ID, pagination.Page{Limit: 2})
+	if err != nil || !more || first[0].Content != "0" || first[1].Content != "1" {
+		t.Fatalf("first page = %+v, %v, %v", first, more, err)
+	}
+	// A message arriving between requests does not shift the next page.
+	if _, err := CreateMessage(db, c.ID, "user", "4", nil); err != nil {
+		t.Fatalf("CreateMessage: %v", err)
+	}
+	next, more, err := ListMessagesKeyset(db, c.ID, pagination.Page{
+		Cursor: &pagination.Cursor{CreatedAt: first[1].CreatedAt, ID: first[1].ID},
+		Limit:  2,
+	})
+	if err != nil || !more || next[0].Content != "2" || next[1].Content != "3" {
+		t.Fatalf("next page = %+v, %v, %v", next, more, err)
+	}
+}
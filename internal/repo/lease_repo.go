@@ -0,0 +1,35 @@
+// Package repo implements the data persistence layer for domain entities,
+// backed by GORM. This file provides repository functions for JobLease, the
+// cross-replica lock of maintenance jobs.
+package repo
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+)
+
+// AcquireJobLease takes the lease of job name for holder until the given
+// time, creating it if needed. It succeeds when the lease is free at now
+// (never taken, or expired) or already held by holder, and reports whether
+// holder has the lease.
+//
+// The check and the takeover are a single conditional UPDATE, so of several
+// concurrent callers at most one gets a free lease.
+func AcquireJobLease(ctx context.Context, db *gorm.DB, name, holder string, now, until time.Time) (bool, error) {
+	row := domain.JobLease{Name: name, Holder: "", ExpiresAt: time.Unix(0, 0).UTC()}
+	if err := db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error; err != nil {
+		return false, err
+	}
+	res := db.WithContext(ctx).Model(&domain.JobLease{}).
+		Where("name = ? AND (expires_at <= ? OR holder = ?)", name, now.UTC(), holder).
+		Updates(map[string]any{"holder": holder, "expires_at": until.UTC()})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
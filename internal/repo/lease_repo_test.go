@@ -0,0 +1,36 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+)
+
+func TestAcquireJobLease(t *testing.T) {
+	db := newChatRepoDB(t, &domain.JobLease{})
+	ctx := context.Background()
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	if ok, err := AcquireJobLease(ctx, db, "gc", "a", now, now.Add(time.Hour)); err != nil || !ok {
+		t.Fatalf("first acquire = %v, %v", ok, err)
+	}
+	// Another holder waits for the lease to expire; the holder may renew it.
+	if ok, err := AcquireJobLease(ctx, db, "gc", "b", now.Add(time.Minute), now.Add(time.Hour)); err != nil || ok {
+		t.Fatalf("held lease taken = %v, %v", ok, err)
+	}
+	if ok, _ := AcquireJobLease(ctx, db, "gc", "a", now.Add(time.Minute), now.Add(2*time.Hour)); !ok {
+		t.Fatalf("holder could not renew")
+	}
+	if ok, _ := AcquireJobLease(ctx, db, "gc", "b", now.Add(time.Hour), now.Add(2*time.Hour)); ok {
+		t.Fatalf("renewed lease taken")
+	}
+	if ok, _ := AcquireJobLease(ctx, db, "gc", "b", now.Add(2*time.Hour), now.Add(3*time.Hour)); !ok {
+		t.Fatalf("expired lease not taken")
+	}
+	// Leases are per job.
+	if ok, _ := AcquireJobLease(ctx, db, "purge", "a", now, now.Add(time.Hour)); !ok {
+		t.Fatalf("other job's lease not taken")
+	}
+}
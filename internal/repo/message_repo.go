@@ -1,5 +1,10 @@
 // Package repo implements the data persistence layer for domain entities,
 // backed by GORM. This file provides repository functions for the Message model.
+//
+// Messages are addressed by chat ID; the chat must already have been resolved
+// within the caller's workspace (see the chat_repo.go package notes).
+// GetMessage, which is addressed by message ID alone, filters by workspace
+// itself.
 package repo
 
 import (
@@ -11,17 +16,20 @@ import (
 	"github.com/tbourn/go-chat-backend/internal/domain"
 )
 
-// CreateMessage inserts a new message row.
+// CreateMessage appends a new message to the active branch of a chat: it
+// follows the chat's current active message and becomes the active message
+// itself (see AppendMessage). Callers that decided what to write from an
+// earlier read of the branch use AppendMessage with that parent instead.
 func CreateMessage(db *gorm.DB, chatID, role, content string, score *float64) (*domain.Message, error) {
-	m := &domain.Message{
-		ID:        uuid.NewString(),
-		ChatID:    chatID,
-		Role:      role,
-		Content:   content,
-		Score:     score,
-		CreatedAt: time.Now().UTC(),
+	parent, err := activeMessage(db, chatID)
+	if err != nil {
+		return nil, err
+	}
+	m := &domain.Message{ChatID: chatID, ParentID: parent, Role: role, Content: content, Score: score}
+	if err := AppendMessage(db, m); err != nil {
+		return nil, err
 	}
-	return m, db.Create(m).Error
+	return m, nil
 }
 
 // ListMessages returns messages ordered deterministically (CreatedAt ASC, ID ASC).
@@ -35,10 +43,22 @@ func ListMessages(db *gorm.DB, chatID string, limit int) ([]domain.Message, erro
 	return out, err
 }
 
+// ListRecentMessages returns the last limit messages of a chat in the same
+// order as ListMessages (oldest first).
+func ListRecentMessages(db *gorm.DB, chatID string, limit int) ([]domain.Message, error) {
+	var out []domain.Message
+	err := db.Where("chat_id = ?", chatID).Order("created_at DESC, id DESC").Limit(limit).Find(&out).Error
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, err
+}
+
 // CountMessages uses a raw COUNT so a missing table surfaces as an error (as tests expect).
+// Soft-deleted messages are not counted.
 func CountMessages(db *gorm.DB, chatID string) (int64, error) {
 	var total int64
-	err := db.Raw("SELECT COUNT(*) FROM messages WHERE chat_id = ?", chatID).Scan(&total).Error
+	err := db.Raw("SELECT COUNT(*) FROM messages WHERE chat_id = ? AND deleted_at IS NULL", chatID).Scan(&total).Error
 	return total, err
 }
 
@@ -54,21 +74,73 @@ func ListMessagesPage(db *gorm.DB, chatID string, offset, limit int) ([]domain.M
 	return out, err
 }
 
-// LeaveFeedback creates a feedback row for a message.
-func LeaveFeedback(db *gorm.DB, messageID string, value int) error {
+// CreateMessageSources stores the citations of an assistant message. Rank and
+// ID are assigned here in slice order; MessageID is overwritten.
+func CreateMessageSources(db *gorm.DB, messageID string, srcs []domain.MessageSource) ([]domain.MessageSource, error) {
+	if len(srcs) == 0 {
+		return nil, nil
+	}
+	now := time.Now().UTC()
+	out := make([]domain.MessageSource, len(srcs))
+	for i, s := range srcs {
+		s.ID = uuid.NewString()
+		s.MessageID = messageID
+		s.Rank = i
+		s.CreatedAt = now
+		out[i] = s
+	}
+	return out, db.Create(&out).Error
+}
+
+// AttachCitations loads the sources of every assistant message in msgs (in
+// one query) and sets their Citations, ordered by rank. Messages without
+// sources are left untouched.
+func AttachCitations(db *gorm.DB, msgs []domain.Message) error {
+	ids := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		if m.Role == "assistant" {
+			ids = append(ids, m.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	var srcs []domain.MessageSource
+	if err := db.Where("message_id IN ?", ids).Order("message_id ASC, rank ASC").Find(&srcs).Error; err != nil {
+		return err
+	}
+	byMsg := make(map[string][]domain.MessageSource, len(ids))
+	for _, s := range srcs {
+		byMsg[s.MessageID] = append(byMsg[s.MessageID], s)
+	}
+	for i := range msgs {
+		if cs, ok := byMsg[msgs[i].ID]; ok {
+			msgs[i].Citations = cs
+		}
+	}
+	return nil
+}
+
+// LeaveFeedback creates a feedback row for a message of workspaceID.
+func LeaveFeedback(db *gorm.DB, workspaceID, messageID string, value int) error {
 	fb := &domain.Feedback{
-		ID:        uuid.NewString(),
-		MessageID: messageID,
-		Value:     value,
-		CreatedAt: time.Now().UTC(),
+		ID:          uuid.NewString(),
+		WorkspaceID: workspaceID,
+		MessageID:   messageID,
+		Value:       value,
+		CreatedAt:   time.Now().UTC(),
 	}
 	return db.Create(fb).Error
 }
 
-// GetMessage fetches a message by ID.
-func GetMessage(db *gorm.DB, id string) (*domain.Message, error) {
+// GetMessage fetches a message by ID. Messages of chats outside workspaceID
+// (or of deleted chats) are reported as ErrNotFound.
+func GetMessage(db *gorm.DB, workspaceID, id string) (*domain.Message, error) {
 	var m domain.Message
-	if err := db.Where("id = ?", id).First(&m).Error; err != nil {
+	err := db.Where("id = ?", id).
+		Where("chat_id IN (?)", db.Model(&domain.Chat{}).Select("id").Where("workspace_id = ?", workspaceID)).
+		First(&m).Error
+	if err != nil {
 		return nil, err
 	}
 	return &m, nil
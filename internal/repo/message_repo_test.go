@@ -62,7 +62,7 @@ func TestCreateMessage_InsertsAndStoresScore(t *testing.T) {
 	}
 
 	// read it back
-	got, err := GetMessage(db, msg.ID)
+	got, err := GetMessage(db, domain.DefaultWorkspaceID, msg.ID)
 	if err != nil {
 		t.Fatalf("GetMessage: %v", err)
 	}
@@ -109,6 +109,15 @@ func TestListMessages_OrderAndLimit(t *testing.T) {
 	if len(top2) != 2 || top2[0].ID != "a" || top2[1].ID != "b" {
 		t.Fatalf("unexpected order/limit: %+v", top2)
 	}
+
+	// most recent, still oldest first
+	last2, err := ListRecentMessages(db, "c2", 2)
+	if err != nil {
+		t.Fatalf("ListRecentMessages error: %v", err)
+	}
+	if len(last2) != 2 || last2[0].ID != "b" || last2[1].ID != "z" {
+		t.Fatalf("unexpected recent messages: %+v", last2)
+	}
 }
 
 func TestCountMessages_Error_NoTable(t *testing.T) {
@@ -177,7 +186,7 @@ func TestLeaveFeedback_InsertsRow(t *testing.T) {
 		t.Fatalf("seed message: %v", err)
 	}
 
-	if err := LeaveFeedback(db, "mfb", 1); err != nil {
+	if err := LeaveFeedback(db, domain.DefaultWorkspaceID, "mfb", 1); err != nil {
 		t.Fatalf("LeaveFeedback error: %v", err)
 	}
 
@@ -191,31 +200,39 @@ func TestLeaveFeedback_InsertsRow(t *testing.T) {
 }
 
 func TestGetMessage_FoundAndNotFound(t *testing.T) {
-	db := newMsgRepoDB(t, &domain.Message{})
+	db := newMsgRepoDB(t, &domain.Chat{}, &domain.Message{})
 
 	// not found
-	if _, err := GetMessage(db, "nope"); err == nil {
+	if _, err := GetMessage(db, domain.DefaultWorkspaceID, "nope"); err == nil {
 		t.Fatalf("expected gorm.ErrRecordNotFound")
 	}
 
 	// insert & get
+	if err := db.Create(&domain.Chat{ID: "c9", UserID: "u1", Title: "t"}).Error; err != nil {
+		t.Fatalf("seed chat: %v", err)
+	}
 	msg := &domain.Message{ID: "mid", ChatID: "c9", Role: "user", Content: "hi"}
 	if err := db.Create(msg).Error; err != nil {
 		t.Fatalf("seed message: %v", err)
 	}
-	got, err := GetMessage(db, "mid")
+	got, err := GetMessage(db, domain.DefaultWorkspaceID, "mid")
 	if err != nil {
 		t.Fatalf("GetMessage error: %v", err)
 	}
 	if got.ID != "mid" || got.ChatID != "c9" {
 		t.Fatalf("unexpected message: %+v", got)
 	}
+
+	// messages of another workspace's chat are invisible
+	if _, err := GetMessage(db, "ws-other", "mid"); err != gorm.ErrRecordNotFound {
+		t.Fatalf("GetMessage(other workspace): expected ErrRecordNotFound, got %v", err)
+	}
 }
 
 // sanity: the repository funcs accept a *gorm.DB that may have context/tx set;
 // ensure they work with a context-scoped DB too
 func TestRepoWithContextHandles(t *testing.T) {
-	db := newMsgRepoDB(t, &domain.Message{})
+	db := newMsgRepoDB(t, &domain.Chat{}, &domain.Message{})
 	ctx := context.WithValue(context.Background(), "k", "v")
 	tdb := db.WithContext(ctx)
 
@@ -232,3 +249,48 @@ func TestRepoWithContextHandles(t *testing.T) {
 		t.Fatalf("ListMessagesPage with context: %v", err)
 	}
 }
+
+func TestMessageSources_CreateAndAttach(t *testing.T) {
+	db := newMsgRepoDB(t, &domain.Chat{}, &domain.Message{}, &domain.MessageSource{})
+	if err := db.Create(&domain.Chat{ID: "c1", UserID: "u1", Title: "t"}).Error; err != nil {
+		t.Fatalf("seed chat: %v", err)
+	}
+	u, _ := CreateMessage(db, "c1", "user", "q", nil)
+	a1, _ := CreateMessage(db, "c1", "assistant", "a1", nil)
+	a2, _ := CreateMessage(db, "c1", "assistant", "a2", nil)
+
+	// Empty input is a no-op.
+	if out, err := CreateMessageSources(db, a2.ID, nil); err != nil || out != nil {
+		t.Fatalf("empty sources: %v %v", out, err)
+	}
+	out, err := CreateMessageSources(db, a1.ID, []domain.MessageSource{
+		{MessageID: "ignored", DocID: "d1", Source: "data.md", Line: 3, Score: 0.9, Snippet: "one"},
+		{DocID: "d2", Source: "data.md", Line: 9, Score: 0.8, Snippet: "two"},
+	})
+	if err != nil || len(out) != 2 {
+		t.Fatalf("create: %v %v", out, err)
+	}
+	if out[0].MessageID != a1.ID || out[0].Rank != 0 || out[1].Rank != 1 || out[0].ID == "" {
+		t.Fatalf("rank/ids not assigned: %+v", out)
+	}
+
+	msgs := []domain.Message{*u, *a1, *a2}
+	if err := AttachCitations(db, msgs); err != nil {
+		t.Fatalf("attach: %v", err)
+	}
+	if msgs[0].Citations != nil || msgs[2].Citations != nil {
+		t.Fatalf("only a1 should have citations: %+v", msgs)
+	}
+	if cs := msgs[1].Citations; len(cs) != 2 || cs[0].DocID != "d1" || cs[1].DocID != "d2" || cs[1].Line != 9 {
+		t.Fatalf("unexpected citations: %+v", cs)
+	}
+
+	// No assistant messages → no query (works even without the table).
+	bare := newMsgRepoDB(t, &domain.Chat{}, &domain.Message{})
+	if err := AttachCitations(bare, []domain.Message{*u}); err != nil {
+		t.Fatalf("user-only attach should not query: %v", err)
+	}
+	if err := AttachCitations(bare, []domain.Message{*a1}); err == nil {
+		t.Fatalf("expected error when table is missing")
+	}
+}
@@ -0,0 +1,131 @@
+// Package repo implements the data persistence layer for domain entities,
+// backed by GORM. This file provides full-text search over messages.
+//
+// The index is an SQLite FTS5 table (messages_fts) over messages.content,
+// stored as an external-content table keyed by the messages rowid and kept in
+// sync by triggers on insert, delete and content updates, so every write path
+// (including cascades from purged chats) updates it without repo code.
+// Soft-deleted messages and chats stay indexed and are filtered at query time.
+//
+// VACUUM may renumber the rowids of messages (it has no INTEGER PRIMARY KEY);
+// the repo never runs it, but after a manual VACUUM drop messages_fts and let
+// EnsureMessageSearch rebuild it.
+package repo
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Snippet highlight markers. They are control characters, which cannot occur
+// in sanitized message content, so callers can escape a snippet for their
+// output format and then replace them.
+const (
+	SnippetMarkStart = "\x02"
+	SnippetMarkEnd   = "\x03"
+)
+
+// messageSearchDDL creates the index and its triggers; every statement is
+// idempotent.
+var messageSearchDDL = []string{
+	`CREATE VIRTUAL TABLE IF NOT EXISTS messages_fts USING fts5(
+		content, content='messages', content_rowid='rowid',
+		tokenize='porter unicode61 remove_diacritics 2')`,
+	`CREATE TRIGGER IF NOT EXISTS messages_fts_ai AFTER INSERT ON messages BEGIN
+		INSERT INTO messages_fts(rowid, content) VALUES (new.rowid, new.content);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS messages_fts_ad AFTER DELETE ON messages BEGIN
+		INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+	END`,
+	`CREATE TRIGGER IF NOT EXISTS messages_fts_au AFTER UPDATE OF content ON messages BEGIN
+		INSERT INTO messages_fts(messages_fts, rowid, content) VALUES ('delete', old.rowid, old.content);
+		INSERT INTO messages_fts(rowid, content) VALUES (new.rowid, new.content);
+	END`,
+}
+
+// EnsureMessageSearch creates the message search index and its triggers when
+// any of them is missing (on first start, or after a migration recreated the
+// messages table and dropped its triggers) and then rebuilds the index from
+// the messages table. It is a no-op when everything is in place.
+func EnsureMessageSearch(db *gorm.DB) error {
+	var n int64
+	err := db.Raw(`SELECT COUNT(*) FROM sqlite_master WHERE name IN
+		('messages_fts', 'messages_fts_ai', 'messages_fts_ad', 'messages_fts_au')`).Scan(&n).Error
+	if err != nil || n == 4 {
+		return err
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, stmt := range messageSearchDDL {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Exec(`INSERT INTO messages_fts(messages_fts) VALUES ('rebuild')`).Error
+	})
+}
+
+// MessageSearch selects the messages SearchMessages returns: the live
+// messages of the live chats userID owns in workspaceID that match Query.
+type MessageSearch struct {
+	WorkspaceID string
+	UserID      string
+	// Query is an FTS5 match expression.
+	Query string
+	// Role keeps only messages of this role when set.
+	Role string
+	// From and To keep only messages created at or after From and before To
+	// when set.
+	From, To *time.Time
+	// Offset and Limit select the page of hits.
+	Offset, Limit int
+}
+
+// MessageHit is a message matching a search.
+type MessageHit struct {
+	MessageID string
+	ChatID    string
+	ChatTitle string
+	Role      string
+	// Snippet is an excerpt of the content with the matched terms enclosed
+	// in SnippetMarkStart and SnippetMarkEnd.
+	Snippet string
+	// Rank is the BM25 relevance of the hit; higher is better.
+	Rank      float64
+	CreatedAt time.Time
+}
+
+// SearchMessages returns a page of the messages matching s, best first (ties
+// newest first), and the total number of matches.
+func SearchMessages(ctx context.Context, db *gorm.DB, s MessageSearch) ([]MessageHit, int64, error) {
+	q := db.WithContext(ctx).Table("messages_fts").
+		Joins("JOIN messages m ON m.rowid = messages_fts.rowid").
+		Joins("JOIN chats c ON c.id = m.chat_id").
+		Where("messages_fts MATCH ?", s.Query).
+		Where("c.workspace_id = ? AND c.user_id = ?", s.WorkspaceID, s.UserID).
+		Where("c.deleted_at IS NULL AND m.deleted_at IS NULL")
+	if s.Role != "" {
+		q = q.Where("m.role = ?", s.Role)
+	}
+	if s.From != nil {
+		q = q.Where("m.created_at >= ?", s.From.UTC())
+	}
+	if s.To != nil {
+		q = q.Where("m.created_at < ?", s.To.UTC())
+	}
+
+	var total int64
+	if err := q.Session(&gorm.Session{}).Count(&total).Error; err != nil || total == 0 {
+		return []MessageHit{}, total, err
+	}
+
+	out := []MessageHit{}
+	err := q.Select(`m.id AS message_id, m.chat_id, c.title AS chat_title, m.role, m.created_at,
+			snippet(messages_fts, 0, ?, ?, '…', 16) AS snippet, -bm25(messages_fts) AS rank`,
+		SnippetMarkStart, SnippetMarkEnd).
+		Order("rank DESC, m.created_at DESC, m.id DESC").
+		Offset(s.Offset).Limit(s.Limit).
+		Scan(&out).Error
+	return out, total, err
+}
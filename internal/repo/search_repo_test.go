@@ -0,0 +1,142 @@
+package repo
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+)
+
+func TestSearchMessages_IndexSyncAndFilters(t *testing.T) {
+	db := newChatRepoDB(t, &domain.Chat{}, &domain.Message{}, &domain.Feedback{})
+	ctx := context.Background()
+	ws := domain.DefaultWorkspaceID
+
+	mine, _ := CreateChat(ctx, db, ws, "u1", "Trends")
+	other, _ := CreateChat(ctx, db, ws, "u2", "Theirs")
+	// Indexed by the rebuild when the index is created.
+	old, _ := CreateMessage(db, mine.ID, "user", "What do Gen Z users watch on TikTok?", nil)
+	if _, err := CreateMessage(db, other.ID, "user", "TikTok for someone else", nil); err != nil {
+		t.Fatalf("CreateMessage: %v", err)
+	}
+	if err := EnsureMessageSearch(db); err != nil {
+		t.Fatalf("EnsureMessageSearch: %v", err)
+	}
+	if err := EnsureMessageSearch(db); err != nil {
+		t.Fatalf("EnsureMessageSearch again: %v", err)
+	}
+	// Indexed by the triggers.
+	reply, _ := CreateMessage(db, mine.ID, "assistant", "Gen Z spends most of its time on TikTok and YouTube.", nil)
+	if _, err := CreateMessage(db, mine.ID, "user", "Thanks!", nil); err != nil {
+		t.Fatalf("CreateMessage: %v", err)
+	}
+
+	search := func(s MessageSearch) ([]string, int64) {
+		t.Helper()
+		s.WorkspaceID, s.UserID = ws, "u1"
+		if s.Limit == 0 {
+			s.Limit = 10
+		}
+		hits, total, err := SearchMessages(ctx, db, s)
+		if err != nil {
+			t.Fatalf("SearchMessages(%+v): %v", s, err)
+		}
+		ids := make([]string, len(hits))
+		for i, h := range hits {
+			ids[i] = h.MessageID
+		}
+		return ids, total
+	}
+
+	hits, total, err := SearchMessages(ctx, db, MessageSearch{WorkspaceID: ws, UserID: "u1", Query: `"tiktok"`, Limit: 10})
+	if err != nil || total != 2 || len(hits) != 2 {
+		t.Fatalf("tiktok = %+v, %d, %v", hits, total, err)
+	}
+	for _, h := range hits {
+		if h.ChatID != mine.ID || h.ChatTitle != "Trends" || h.Rank <= 0 || h.CreatedAt.IsZero() ||
+			!strings.Contains(h.Snippet, SnippetMarkStart+"TikTok"+SnippetMarkEnd) {
+			t.Fatalf("hit = %+v", h)
+		}
+	}
+	if hits[0].Rank < hits[1].Rank {
+		t.Fatalf("hits not ranked: %+v", hits)
+	}
+
+	// Stemming and prefixes; the page is cut but the total is not.
+	if ids, total := search(MessageSearch{Query: `"spend"`}); len(ids) != 1 || ids[0] != reply.ID || total != 1 {
+		t.Fatalf("stemmed = %v, %d", ids, total)
+	}
+	if ids, total := search(MessageSearch{Query: `"tik"*`, Limit: 1}); len(ids) != 1 || total != 2 {
+		t.Fatalf("prefix page = %v, %d", ids, total)
+	}
+
+	// Role and date filters.
+	if ids, _ := search(MessageSearch{Query: `"tiktok"`, Role: "assistant"}); len(ids) != 1 || ids[0] != reply.ID {
+		t.Fatalf("role = %v", ids)
+	}
+	to := reply.CreatedAt
+	if ids, _ := search(MessageSearch{Query: `"tiktok"`, To: &to}); len(ids) != 1 || ids[0] != old.ID {
+		t.Fatalf("to = %v", ids)
+	}
+	if ids, _ := search(MessageSearch{Query: `"tiktok"`, From: &to}); len(ids) != 1 || ids[0] != reply.ID {
+		t.Fatalf("from = %v", ids)
+	}
+	future := time.Now().Add(time.Hour)
+	if ids, total := search(MessageSearch{Query: `"tiktok"`, From: &future}); len(ids) != 0 || total != 0 {
+		t.Fatalf("future = %v, %d", ids, total)
+	}
+
+	// Edits and deletes are reflected.
+	if err := db.Model(&domain.Message{}).Where("id = ?", old.ID).Update("content", "Instagram instead").Error; err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if ids, _ := search(MessageSearch{Query: `"tiktok"`}); len(ids) != 1 || ids[0] != reply.ID {
+		t.Fatalf("after update = %v", ids)
+	}
+	if ids, _ := search(MessageSearch{Query: `"instagram"`}); len(ids) != 1 || ids[0] != old.ID {
+		t.Fatalf("updated content = %v", ids)
+	}
+	if err := db.Unscoped().Delete(&domain.Message{}, "id = ?", reply.ID).Error; err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if ids, _ := search(MessageSearch{Query: `"youtube"`}); len(ids) != 0 {
+		t.Fatalf("after delete = %v", ids)
+	}
+
+	// Deleted chats are hidden.
+	if err := DeleteChat(ctx, db, ws, mine.ID, "u1", 0, time.Now()); err != nil {
+		t.Fatalf("DeleteChat: %v", err)
+	}
+	if ids, _ := search(MessageSearch{Query: `"instagram"`}); len(ids) != 0 {
+		t.Fatalf("deleted chat = %v", ids)
+	}
+}
+
+func TestEnsureMessageSearch_RestoresMissingTriggers(t *testing.T) {
+	db := newChatRepoDB(t, &domain.Chat{}, &domain.Message{})
+	ctx := context.Background()
+	if err := EnsureMessageSearch(db); err != nil {
+		t.Fatalf("EnsureMessageSearch: %v", err)
+	}
+	c, _ := CreateChat(ctx, db, domain.DefaultWorkspaceID, "u1", "t")
+
+	// Messages written while a trigger is missing are picked up by the rebuild.
+	if err := db.Exec("DROP TRIGGER messages_fts_ai").Error; err != nil {
+		t.Fatalf("drop trigger: %v", err)
+	}
+	if _, err := CreateMessage(db, c.ID, "user", "unindexed words", nil); err != nil {
+		t.Fatalf("CreateMessage: %v", err)
+	}
+	if err := EnsureMessageSearch(db); err != nil {
+		t.Fatalf("EnsureMessageSearch: %v", err)
+	}
+	if _, err := CreateMessage(db, c.ID, "user", "more words", nil); err != nil {
+		t.Fatalf("CreateMessage: %v", err)
+	}
+	_, total, err := SearchMessages(ctx, db, MessageSearch{WorkspaceID: domain.DefaultWorkspaceID, UserID: "u1", Query: `"words"`, Limit: 10})
+	if err != nil || total != 2 {
+		t.Fatalf("total = %d, %v", total, err)
+	}
+}
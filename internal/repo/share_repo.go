@@ -0,0 +1,48 @@
+// Package repo implements the data persistence layer for domain entities,
+// backed by GORM. This file provides repository functions for ChatShare,
+// the "shared with" relation between chats and users other than the owner.
+package repo
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+)
+
+// ShareChat grants userID access to chatID. Sharing again is a no-op.
+func ShareChat(ctx context.Context, db *gorm.DB, chatID, userID string) error {
+	return db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&domain.ChatShare{ChatID: chatID, UserID: userID, CreatedAt: time.Now().UTC()}).Error
+}
+
+// UnshareChat revokes userID's access to chatID. Revoking a share that does
+// not exist is not an error.
+func UnshareChat(ctx context.Context, db *gorm.DB, chatID, userID string) error {
+	return db.WithContext(ctx).
+		Where("chat_id = ? AND user_id = ?", chatID, userID).
+		Delete(&domain.ChatShare{}).Error
+}
+
+// ListChatShares returns the users chatID is shared with, oldest grant first.
+func ListChatShares(ctx context.Context, db *gorm.DB, chatID string) ([]domain.ChatShare, error) {
+	out := []domain.ChatShare{}
+	err := db.WithContext(ctx).
+		Where("chat_id = ?", chatID).
+		Order("created_at ASC, user_id ASC").
+		Find(&out).Error
+	return out, err
+}
+
+// IsChatSharedWith reports whether chatID is shared with userID.
+func IsChatSharedWith(ctx context.Context, db *gorm.DB, chatID, userID string) (bool, error) {
+	var n int64
+	err := db.WithContext(ctx).Model(&domain.ChatShare{}).
+		Where("chat_id = ? AND user_id = ?", chatID, userID).
+		Count(&n).Error
+	return n > 0, err
+}
@@ -0,0 +1,47 @@
+package repo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+)
+
+func TestChatShares_ShareListUnshare(t *testing.T) {
+	db := newChatRepoDB(t, &domain.Chat{}, &domain.ChatShare{})
+	ctx := context.Background()
+	c, err := CreateChat(ctx, db, domain.DefaultWorkspaceID, "owner", "t")
+	if err != nil {
+		t.Fatalf("CreateChat: %v", err)
+	}
+
+	if ok, err := IsChatSharedWith(ctx, db, c.ID, "bob"); err != nil || ok {
+		t.Fatalf("IsChatSharedWith before share = %v, %v", ok, err)
+	}
+	for _, u := range []string{"bob", "carol", "bob"} { // re-sharing is a no-op
+		if err := ShareChat(ctx, db, c.ID, u); err != nil {
+			t.Fatalf("ShareChat(%s): %v", u, err)
+		}
+	}
+	shares, err := ListChatShares(ctx, db, c.ID)
+	if err != nil || len(shares) != 2 {
+		t.Fatalf("ListChatShares = %+v, %v; want 2", shares, err)
+	}
+	if ok, _ := IsChatSharedWith(ctx, db, c.ID, "bob"); !ok {
+		t.Fatalf("expected chat shared with bob")
+	}
+
+	if err := UnshareChat(ctx, db, c.ID, "bob"); err != nil {
+		t.Fatalf("UnshareChat: %v", err)
+	}
+	if err := UnshareChat(ctx, db, c.ID, "nobody"); err != nil {
+		t.Fatalf("UnshareChat(missing): %v", err)
+	}
+	if ok, _ := IsChatSharedWith(ctx, db, c.ID, "bob"); ok {
+		t.Fatalf("bob should no longer have access")
+	}
+	shares, _ = ListChatShares(ctx, db, c.ID)
+	if len(shares) != 1 || shares[0].UserID != "carol" {
+		t.Fatalf("remaining shares = %+v", shares)
+	}
+}
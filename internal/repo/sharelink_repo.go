@@ -0,0 +1,59 @@
+// Package repo implements the data persistence layer for domain entities,
+// backed by GORM. This file provides repository functions for ShareLink,
+// the public read-only links to chats.
+package repo
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+)
+
+// SaveShareLink stores l as the link of l.ChatID, replacing (and so
+// invalidating) any previous link of that chat. Views start again at zero.
+func SaveShareLink(ctx context.Context, db *gorm.DB, l *domain.ShareLink) error {
+	if l.CreatedAt.IsZero() {
+		l.CreatedAt = time.Now().UTC()
+	}
+	l.Views, l.LastViewedAt = 0, nil
+	return db.WithContext(ctx).
+		Omit(clause.Associations).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "chat_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"token_hash", "created_by", "expires_at", "views", "last_viewed_at", "created_at"}),
+		}).
+		Create(l).Error
+}
+
+// DeleteShareLink removes the link of chatID. Deleting a link that does not
+// exist is not an error.
+func DeleteShareLink(ctx context.Context, db *gorm.DB, chatID string) error {
+	return db.WithContext(ctx).
+		Where("chat_id = ?", chatID).
+		Delete(&domain.ShareLink{}).Error
+}
+
+// FindShareLink fetches the link with the given token hash together with its
+// chat (in Chat). It returns ErrNotFound if there is no such link or the
+// chat is deleted; expiry is left to the caller.
+func FindShareLink(ctx context.Context, db *gorm.DB, tokenHash string) (*domain.ShareLink, error) {
+	var l domain.ShareLink
+	if err := db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&l).Error; err != nil {
+		return nil, err
+	}
+	if err := db.WithContext(ctx).Where("id = ?", l.ChatID).First(&l.Chat).Error; err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// CountShareLinkView records a view of the link of chatID at the given time.
+func CountShareLinkView(ctx context.Context, db *gorm.DB, chatID string, at time.Time) error {
+	return db.WithContext(ctx).Model(&domain.ShareLink{}).
+		Where("chat_id = ?", chatID).
+		Updates(map[string]any{"views": gorm.Expr("views + 1"), "last_viewed_at": at}).Error
+}
@@ -0,0 +1,64 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+)
+
+func TestShareLinks_SaveFindCountDelete(t *testing.T) {
+	db := newChatRepoDB(t, &domain.Chat{}, &domain.ShareLink{}, &domain.Message{}, &domain.Feedback{})
+	ctx := context.Background()
+	c, err := CreateChat(ctx, db, domain.DefaultWorkspaceID, "owner", "t")
+	if err != nil {
+		t.Fatalf("CreateChat: %v", err)
+	}
+
+	if err := SaveShareLink(ctx, db, &domain.ShareLink{ChatID: c.ID, TokenHash: "h1", CreatedBy: "owner"}); err != nil {
+		t.Fatalf("SaveShareLink: %v", err)
+	}
+	at := time.Now().UTC().Truncate(time.Second)
+	for i := 0; i < 2; i++ {
+		if err := CountShareLinkView(ctx, db, c.ID, at); err != nil {
+			t.Fatalf("CountShareLinkView: %v", err)
+		}
+	}
+	l, err := FindShareLink(ctx, db, "h1")
+	if err != nil || l.Chat.ID != c.ID || l.Views != 2 || l.LastViewedAt == nil || !l.LastViewedAt.Equal(at) {
+		t.Fatalf("FindShareLink = %+v, %v", l, err)
+	}
+
+	// A new link replaces the old one and starts counting again.
+	exp := at.Add(time.Hour)
+	if err := SaveShareLink(ctx, db, &domain.ShareLink{ChatID: c.ID, TokenHash: "h2", CreatedBy: "owner", ExpiresAt: &exp}); err != nil {
+		t.Fatalf("SaveShareLink again: %v", err)
+	}
+	if _, err := FindShareLink(ctx, db, "h1"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("old token: err = %v", err)
+	}
+	if l, err := FindShareLink(ctx, db, "h2"); err != nil || l.Views != 0 || l.LastViewedAt != nil || !l.ExpiresAt.Equal(exp) {
+		t.Fatalf("new link = %+v, %v", l, err)
+	}
+
+	// Links of deleted chats are not found.
+	if err := DeleteChat(ctx, db, domain.DefaultWorkspaceID, c.ID, "owner", 0, at); err != nil {
+		t.Fatalf("DeleteChat: %v", err)
+	}
+	if _, err := FindShareLink(ctx, db, "h2"); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("deleted chat: err = %v", err)
+	}
+
+	for i := 0; i < 2; i++ { // deleting twice is a no-op
+		if err := DeleteShareLink(ctx, db, c.ID); err != nil {
+			t.Fatalf("DeleteShareLink: %v", err)
+		}
+	}
+	if got := countRows(t, db, &domain.ShareLink{}, "1 = 1"); got != 0 {
+		t.Fatalf("links after delete = %d", got)
+	}
+}
@@ -14,19 +14,21 @@ import (
 	"github.com/tbourn/go-chat-backend/internal/domain"
 )
 
-// ChatsStats returns aggregate metadata for a user's chats: the total number of
-// rows and the maximum UpdatedAt timestamp among those rows.
+// ChatsStats returns aggregate metadata for a user's chats in workspaceID: the
+// number of live (not soft-deleted) chats and the maximum UpdatedAt timestamp
+// among all of the user's chats there, including soft-deleted ones.
 //
-// It executes two lightweight queries against the chats table scoped to the
-// provided userID. When the user has no chats, the returned count is 0 and
-// maxUpdatedAt is nil.
+// Deleting and restoring a chat bump its UpdatedAt (see DeleteChat and
+// RestoreChat), so including deleted rows in the maximum makes both visible
+// to ETags even when the live count ends up unchanged. When the user has no
+// live chats, the returned count is 0 and maxUpdatedAt is nil.
 //
 // Return values:
-//   - count:        total chats for userID
-//   - maxUpdatedAt: pointer to the greatest UpdatedAt, or nil if no rows
+//   - count:        live chats for userID in workspaceID
+//   - maxUpdatedAt: pointer to the greatest UpdatedAt, or nil if no live rows
 //   - err:          database error, if any
-func ChatsStats(ctx context.Context, db *gorm.DB, userID string) (count int64, maxUpdatedAt *time.Time, err error) {
-	q := db.WithContext(ctx).Model(&domain.Chat{}).Where("user_id = ?", userID)
+func ChatsStats(ctx context.Context, db *gorm.DB, workspaceID, userID string) (count int64, maxUpdatedAt *time.Time, err error) {
+	q := db.WithContext(ctx).Model(&domain.Chat{}).Where("workspace_id = ? AND user_id = ?", workspaceID, userID)
 
 	// Count
 	if err = q.Count(&count).Error; err != nil {
@@ -40,7 +42,8 @@ func ChatsStats(ctx context.Context, db *gorm.DB, userID string) (count int64, m
 	var row struct {
 		UpdatedAt time.Time
 	}
-	if err = q.Select("updated_at").Order("updated_at DESC").Limit(1).Scan(&row).Error; err != nil {
+	if err = db.WithContext(ctx).Unscoped().Model(&domain.Chat{}).Where("workspace_id = ? AND user_id = ?", workspaceID, userID).
+		Select("updated_at").Order("updated_at DESC").Limit(1).Scan(&row).Error; err != nil {
 		return 0, nil, err
 	}
 	return count, &row.UpdatedAt, nil
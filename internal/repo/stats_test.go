@@ -33,7 +33,7 @@ func newTestDB(t *testing.T, migrate ...any) *gorm.DB {
 
 func TestChatsStats_CountError_NoTable(t *testing.T) {
 	db := newTestDB(t /* no migrations */)
-	_, _, err := ChatsStats(context.Background(), db, "u1")
+	_, _, err := ChatsStats(context.Background(), db, domain.DefaultWorkspaceID, "u1")
 	if err == nil {
 		t.Fatalf("expected error due to missing chats table")
 	}
@@ -41,7 +41,7 @@ func TestChatsStats_CountError_NoTable(t *testing.T) {
 
 func TestChatsStats_ZeroRows(t *testing.T) {
 	db := newTestDB(t, &domain.Chat{})
-	count, maxAt, err := ChatsStats(context.Background(), db, "u1")
+	count, maxAt, err := ChatsStats(context.Background(), db, domain.DefaultWorkspaceID, "u1")
 	if err != nil {
 		t.Fatalf("ChatsStats error: %v", err)
 	}
@@ -72,7 +72,7 @@ func TestChatsStats_Success_FilterAndMax(t *testing.T) {
 		t.Fatalf("seed c3: %v", err)
 	}
 
-	count, maxAt, err := ChatsStats(context.Background(), db, "u1")
+	count, maxAt, err := ChatsStats(context.Background(), db, domain.DefaultWorkspaceID, "u1")
 	if err != nil {
 		t.Fatalf("ChatsStats error: %v", err)
 	}
@@ -105,7 +105,7 @@ func TestChatsStats_SelectLatest_ErrorPath(t *testing.T) {
 		t.Fatalf("rename column: %v", err)
 	}
 
-	_, _, err := ChatsStats(context.Background(), db, "uerr")
+	_, _, err := ChatsStats(context.Background(), db, domain.DefaultWorkspaceID, "uerr")
 	if err == nil {
 		t.Fatalf("expected error from latest-updated select after column rename")
 	}
@@ -191,3 +191,37 @@ func TestMessagesStats_SelectLatest_ErrorPath(t *testing.T) {
 		t.Fatalf("expected error from latest-updated select after column rename")
 	}
 }
+
+func TestChatsStats_DeletionChangesStats(t *testing.T) {
+	db := newTestDB(t, &domain.Chat{}, &domain.Message{}, &domain.Feedback{})
+	ctx := context.Background()
+	base := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	for i, id := range []string{"c1", "c2"} {
+		if err := db.Create(&domain.Chat{ID: id, UserID: "u1", Title: id, CreatedAt: base, UpdatedAt: base.Add(time.Duration(i) * time.Minute)}).Error; err != nil {
+			t.Fatalf("seed: %v", err)
+		}
+	}
+	count, before, err := ChatsStats(ctx, db, domain.DefaultWorkspaceID, "u1")
+	if err != nil || count != 2 {
+		t.Fatalf("ChatsStats = %d, %v", count, err)
+	}
+
+	at := time.Now().UTC()
+	if err := DeleteChat(ctx, db, domain.DefaultWorkspaceID, "c1", "u1", 0, at); err != nil {
+		t.Fatalf("DeleteChat: %v", err)
+	}
+	count, after, err := ChatsStats(ctx, db, domain.DefaultWorkspaceID, "u1")
+	if err != nil || count != 1 {
+		t.Fatalf("ChatsStats after delete = %d, %v", count, err)
+	}
+	if !after.After(*before) {
+		t.Fatalf("expected max updated_at to move forward on delete: before=%v after=%v", before, after)
+	}
+
+	if err := DeleteChat(ctx, db, domain.DefaultWorkspaceID, "c2", "u1", 0, at); err != nil {
+		t.Fatalf("DeleteChat: %v", err)
+	}
+	if count, maxAt, err := ChatsStats(ctx, db, domain.DefaultWorkspaceID, "u1"); err != nil || count != 0 || maxAt != nil {
+		t.Fatalf("ChatsStats with only deleted chats = %d, %v, %v", count, maxAt, err)
+	}
+}
@@ -0,0 +1,92 @@
+// Package repo implements the data persistence layer for domain entities,
+// backed by GORM. This file provides repository functions for usage quotas:
+// UsageCounter (units used per subject, metric and calendar period) and
+// QuotaOverride (per-user limits set by admins).
+package repo
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+)
+
+// usageKey restricts a query to the counter identified by key's primary key
+// fields.
+func usageKey(db *gorm.DB, key domain.UsageCounter) *gorm.DB {
+	return db.Where("scope = ? AND subject_id = ? AND metric = ? AND period = ? AND period_start = ?",
+		key.Scope, key.SubjectID, key.Metric, key.Period, key.PeriodStart)
+}
+
+// IncrementUsage adds one unit to the counter identified by key (its Count is
+// ignored), creating it if needed, unless that would exceed limit. A limit of
+// 0 means unlimited. It reports whether the unit was counted.
+//
+// The check and the increment are a single conditional UPDATE, so concurrent
+// callers cannot overshoot the limit. Run it in a transaction to increment
+// several counters all-or-nothing.
+func IncrementUsage(ctx context.Context, db *gorm.DB, key domain.UsageCounter, limit int64) (bool, error) {
+	now := time.Now().UTC()
+	row := key
+	row.Count, row.UpdatedAt = 0, now
+	if err := db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error; err != nil {
+		return false, err
+	}
+
+	q := usageKey(db.WithContext(ctx).Model(&domain.UsageCounter{}), key)
+	if limit > 0 {
+		q = q.Where("count < ?", limit)
+	}
+	res := q.Updates(map[string]any{"count": gorm.Expr("count + 1"), "updated_at": now})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected == 1, nil
+}
+
+// DecrementUsage removes one unit from the counter identified by key, never
+// going below zero. Missing counters are left alone.
+func DecrementUsage(ctx context.Context, db *gorm.DB, key domain.UsageCounter) error {
+	return usageKey(db.WithContext(ctx).Model(&domain.UsageCounter{}), key).
+		Where("count > 0").
+		Updates(map[string]any{"count": gorm.Expr("count - 1"), "updated_at": time.Now().UTC()}).Error
+}
+
+// GetUsage returns the count of the counter identified by key, or 0 if it
+// does not exist.
+func GetUsage(ctx context.Context, db *gorm.DB, key domain.UsageCounter) (int64, error) {
+	var n int64
+	err := usageKey(db.WithContext(ctx).Model(&domain.UsageCounter{}), key).
+		Select("COALESCE(MAX(count), 0)").
+		Scan(&n).Error
+	return n, err
+}
+
+// GetQuotaOverride fetches the quota override of userID, or ErrNotFound.
+func GetQuotaOverride(ctx context.Context, db *gorm.DB, userID string) (*domain.QuotaOverride, error) {
+	var o domain.QuotaOverride
+	if err := db.WithContext(ctx).Where("user_id = ?", userID).First(&o).Error; err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// SetQuotaOverride creates or replaces the quota override of o.UserID.
+func SetQuotaOverride(ctx context.Context, db *gorm.DB, o *domain.QuotaOverride) error {
+	o.UpdatedAt = time.Now().UTC()
+	return db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"messages_per_day", "messages_per_month", "chats_per_day", "chats_per_month", "updated_at"}),
+		}).
+		Create(o).Error
+}
+
+// DeleteQuotaOverride removes the quota override of userID. Removing a
+// missing override is not an error.
+func DeleteQuotaOverride(ctx context.Context, db *gorm.DB, userID string) error {
+	return db.WithContext(ctx).Where("user_id = ?", userID).Delete(&domain.QuotaOverride{}).Error
+}
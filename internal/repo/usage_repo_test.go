@@ -0,0 +1,116 @@
+package repo
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+)
+
+func TestUsage_IncrementWithinLimit(t *testing.T) {
+	db := newChatRepoDB(t, &domain.UsageCounter{})
+	ctx := context.Background()
+	key := domain.UsageCounter{Scope: domain.QuotaScopeUser, SubjectID: "u1", Metric: domain.UsageMessages, Period: domain.PeriodDay, PeriodStart: "2026-10-16"}
+
+	for i := 0; i < 2; i++ {
+		if ok, err := IncrementUsage(ctx, db, key, 2); err != nil || !ok {
+			t.Fatalf("IncrementUsage #%d = %v, %v", i, ok, err)
+		}
+	}
+	if ok, err := IncrementUsage(ctx, db, key, 2); err != nil || ok {
+		t.Fatalf("IncrementUsage over limit = %v, %v", ok, err)
+	}
+	if n, _ := GetUsage(ctx, db, key); n != 2 {
+		t.Fatalf("GetUsage = %d, want 2", n)
+	}
+
+	// Other periods and subjects have their own counters; 0 is unlimited.
+	next := key
+	next.PeriodStart = "2026-10-17"
+	if ok, _ := IncrementUsage(ctx, db, next, 2); !ok {
+		t.Fatalf("next day should start from zero")
+	}
+	if n, _ := GetUsage(ctx, db, domain.UsageCounter{Scope: domain.QuotaScopeUser, SubjectID: "nobody"}); n != 0 {
+		t.Fatalf("GetUsage(missing) = %d", n)
+	}
+	if ok, _ := IncrementUsage(ctx, db, key, 0); !ok {
+		t.Fatalf("limit 0 must be unlimited")
+	}
+
+	if err := DecrementUsage(ctx, db, key); err != nil {
+		t.Fatalf("DecrementUsage: %v", err)
+	}
+	if n, _ := GetUsage(ctx, db, key); n != 2 {
+		t.Fatalf("GetUsage after decrement = %d, want 2", n)
+	}
+	fresh := domain.UsageCounter{Scope: domain.QuotaScopeUser, SubjectID: "u2", Metric: domain.UsageChats, Period: domain.PeriodMonth, PeriodStart: "2026-10"}
+	if err := DecrementUsage(ctx, db, fresh); err != nil {
+		t.Fatalf("DecrementUsage(missing): %v", err)
+	}
+	if n, _ := GetUsage(ctx, db, fresh); n != 0 {
+		t.Fatalf("decrement must not go below zero: %d", n)
+	}
+}
+
+func TestUsage_ConcurrentIncrementsRespectLimit(t *testing.T) {
+	db := newChatRepoDB(t, &domain.UsageCounter{})
+	ctx := context.Background()
+	key := domain.UsageCounter{Scope: domain.QuotaScopeWorkspace, SubjectID: "ws", Metric: domain.UsageChats, Period: domain.PeriodMonth, PeriodStart: "2026-10"}
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		granted int
+	)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var ok bool
+			err := db.Transaction(func(tx *gorm.DB) error {
+				var err error
+				ok, err = IncrementUsage(ctx, tx, key, 5)
+				return err
+			})
+			if err == nil && ok {
+				mu.Lock()
+				granted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if n, _ := GetUsage(ctx, db, key); granted > 5 || n != int64(granted) {
+		t.Fatalf("granted %d, stored %d; limit 5", granted, n)
+	}
+}
+
+func TestQuotaOverrides(t *testing.T) {
+	db := newChatRepoDB(t, &domain.QuotaOverride{})
+	ctx := context.Background()
+
+	if _, err := GetQuotaOverride(ctx, db, "u1"); err != gorm.ErrRecordNotFound {
+		t.Fatalf("missing override: %v", err)
+	}
+	ten, zero := int64(10), int64(0)
+	if err := SetQuotaOverride(ctx, db, &domain.QuotaOverride{UserID: "u1", MessagesPerDay: &ten}); err != nil {
+		t.Fatalf("SetQuotaOverride: %v", err)
+	}
+	// Setting again replaces every field.
+	if err := SetQuotaOverride(ctx, db, &domain.QuotaOverride{UserID: "u1", ChatsPerMonth: &zero}); err != nil {
+		t.Fatalf("SetQuotaOverride(again): %v", err)
+	}
+	o, err := GetQuotaOverride(ctx, db, "u1")
+	if err != nil || o.MessagesPerDay != nil || o.ChatsPerMonth == nil || *o.ChatsPerMonth != 0 {
+		t.Fatalf("GetQuotaOverride = %+v, %v", o, err)
+	}
+	if err := DeleteQuotaOverride(ctx, db, "u1"); err != nil {
+		t.Fatalf("DeleteQuotaOverride: %v", err)
+	}
+	if _, err := GetQuotaOverride(ctx, db, "u1"); err != gorm.ErrRecordNotFound {
+		t.Fatalf("after delete: %v", err)
+	}
+}
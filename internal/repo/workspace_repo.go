@@ -0,0 +1,125 @@
+// Package repo implements the data persistence layer for domain entities,
+// backed by GORM. This file provides repository functions for Workspace and
+// WorkspaceMember, the tenants chats are isolated in and who belongs to them.
+//
+// The default workspace (domain.DefaultWorkspaceID) has no rows here; every
+// user is implicitly a member of it (see services.WorkspaceService).
+package repo
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+)
+
+// CreateWorkspace inserts w and makes ownerID its owner, in one transaction.
+// The caller fills in ID, Name and CorpusPath.
+func CreateWorkspace(ctx context.Context, db *gorm.DB, w *domain.Workspace, ownerID string) error {
+	now := time.Now().UTC()
+	if w.CreatedAt.IsZero() {
+		w.CreatedAt = now
+	}
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(w).Error; err != nil {
+			return err
+		}
+		return tx.Create(&domain.WorkspaceMember{
+			WorkspaceID: w.ID,
+			UserID:      ownerID,
+			Role:        domain.WorkspaceRoleOwner,
+			CreatedAt:   now,
+		}).Error
+	})
+}
+
+// FindWorkspace fetches a workspace by ID, or ErrNotFound.
+func FindWorkspace(ctx context.Context, db *gorm.DB, id string) (*domain.Workspace, error) {
+	var w domain.Workspace
+	if err := db.WithContext(ctx).Where("id = ?", id).First(&w).Error; err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// ListUserMemberships returns userID's workspace memberships, with their
+// workspaces loaded, oldest first.
+func ListUserMemberships(ctx context.Context, db *gorm.DB, userID string) ([]domain.WorkspaceMember, error) {
+	out := []domain.WorkspaceMember{}
+	err := db.WithContext(ctx).
+		Preload("Workspace").
+		Where("user_id = ?", userID).
+		Order("created_at ASC, workspace_id ASC").
+		Find(&out).Error
+	return out, err
+}
+
+// UpdateWorkspace sets the name and corpus path of workspace id. It returns
+// ErrNotFound if there is no such workspace.
+func UpdateWorkspace(ctx context.Context, db *gorm.DB, id, name, corpusPath string) error {
+	res := db.WithContext(ctx).
+		Model(&domain.Workspace{}).
+		Where("id = ?", id).
+		Updates(map[string]any{"name": name, "corpus_path": corpusPath, "updated_at": time.Now().UTC()})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// GetWorkspaceMember fetches userID's membership of workspaceID, or
+// ErrNotFound if the user is not a member.
+func GetWorkspaceMember(ctx context.Context, db *gorm.DB, workspaceID, userID string) (*domain.WorkspaceMember, error) {
+	var m domain.WorkspaceMember
+	err := db.WithContext(ctx).
+		Where("workspace_id = ? AND user_id = ?", workspaceID, userID).
+		First(&m).Error
+	if err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ListWorkspaceMembers returns the members of workspaceID, oldest first.
+func ListWorkspaceMembers(ctx context.Context, db *gorm.DB, workspaceID string) ([]domain.WorkspaceMember, error) {
+	out := []domain.WorkspaceMember{}
+	err := db.WithContext(ctx).
+		Where("workspace_id = ?", workspaceID).
+		Order("created_at ASC, user_id ASC").
+		Find(&out).Error
+	return out, err
+}
+
+// CountWorkspaceOwners returns the number of owners of workspaceID.
+func CountWorkspaceOwners(ctx context.Context, db *gorm.DB, workspaceID string) (int64, error) {
+	var n int64
+	err := db.WithContext(ctx).Model(&domain.WorkspaceMember{}).
+		Where("workspace_id = ? AND role = ?", workspaceID, domain.WorkspaceRoleOwner).
+		Count(&n).Error
+	return n, err
+}
+
+// SetWorkspaceMember adds userID to workspaceID with role, or changes the
+// role of an existing member.
+func SetWorkspaceMember(ctx context.Context, db *gorm.DB, workspaceID, userID, role string) error {
+	return db.WithContext(ctx).
+		Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "workspace_id"}, {Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"role"}),
+		}).
+		Create(&domain.WorkspaceMember{WorkspaceID: workspaceID, UserID: userID, Role: role, CreatedAt: time.Now().UTC()}).Error
+}
+
+// RemoveWorkspaceMember removes userID from workspaceID. Removing a user who
+// is not a member is not an error.
+func RemoveWorkspaceMember(ctx context.Context, db *gorm.DB, workspaceID, userID string) error {
+	return db.WithContext(ctx).
+		Where("workspace_id = ? AND user_id = ?", workspaceID, userID).
+		Delete(&domain.WorkspaceMember{}).Error
+}
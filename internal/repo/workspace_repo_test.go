@@ -0,0 +1,158 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+)
+
+func TestWorkspaces_CreateMembersUpdate(t *testing.T) {
+	db := newChatRepoDB(t, &domain.Workspace{}, &domain.WorkspaceMember{})
+	ctx := context.Background()
+
+	w := &domain.Workspace{ID: "ws-1", Name: "Team A"}
+	if err := CreateWorkspace(ctx, db, w, "alice"); err != nil {
+		t.Fatalf("CreateWorkspace: %v", err)
+	}
+	if m, err := GetWorkspaceMember(ctx, db, w.ID, "alice"); err != nil || m.Role != domain.WorkspaceRoleOwner {
+		t.Fatalf("owner membership = %+v, %v", m, err)
+	}
+	if _, err := GetWorkspaceMember(ctx, db, w.ID, "bob"); err != gorm.ErrRecordNotFound {
+		t.Fatalf("non-member: expected ErrRecordNotFound, got %v", err)
+	}
+
+	// Adding twice changes the role instead of failing.
+	if err := SetWorkspaceMember(ctx, db, w.ID, "bob", domain.WorkspaceRoleOwner); err != nil {
+		t.Fatalf("SetWorkspaceMember: %v", err)
+	}
+	if err := SetWorkspaceMember(ctx, db, w.ID, "bob", domain.WorkspaceRoleMember); err != nil {
+		t.Fatalf("SetWorkspaceMember(again): %v", err)
+	}
+	members, err := ListWorkspaceMembers(ctx, db, w.ID)
+	if err != nil || len(members) != 2 || members[1].UserID != "bob" || members[1].Role != domain.WorkspaceRoleMember {
+		t.Fatalf("ListWorkspaceMembers = %+v, %v", members, err)
+	}
+	if n, err := CountWorkspaceOwners(ctx, db, w.ID); err != nil || n != 1 {
+		t.Fatalf("CountWorkspaceOwners = %d, %v", n, err)
+	}
+
+	if ms, err := ListUserMemberships(ctx, db, "bob"); err != nil || len(ms) != 1 || ms[0].Workspace.Name != "Team A" {
+		t.Fatalf("ListUserMemberships(bob) = %+v, %v", ms, err)
+	}
+	if ms, _ := ListUserMemberships(ctx, db, "carol"); len(ms) != 0 {
+		t.Fatalf("ListUserMemberships(carol) = %+v", ms)
+	}
+
+	if err := UpdateWorkspace(ctx, db, w.ID, "Team A2", "team-a.md"); err != nil {
+		t.Fatalf("UpdateWorkspace: %v", err)
+	}
+	if got, _ := FindWorkspace(ctx, db, w.ID); got.Name != "Team A2" || got.CorpusPath != "team-a.md" {
+		t.Fatalf("FindWorkspace after update = %+v", got)
+	}
+	if err := UpdateWorkspace(ctx, db, "missing", "x", ""); err != gorm.ErrRecordNotFound {
+		t.Fatalf("UpdateWorkspace(missing): expected ErrRecordNotFound, got %v", err)
+	}
+
+	if err := RemoveWorkspaceMember(ctx, db, w.ID, "bob"); err != nil {
+		t.Fatalf("RemoveWorkspaceMember: %v", err)
+	}
+	if err := RemoveWorkspaceMember(ctx, db, w.ID, "nobody"); err != nil {
+		t.Fatalf("RemoveWorkspaceMember(missing): %v", err)
+	}
+	if members, _ := ListWorkspaceMembers(ctx, db, w.ID); len(members) != 1 {
+		t.Fatalf("members after remove = %+v", members)
+	}
+}
+
+// TestWorkspaceIsolation checks that the same user, with a chat in each of two
+// workspaces, can only reach each chat (and what hangs off it) from its own
+// workspace.
+func TestWorkspaceIsolation(t *testing.T) {
+	db := newChatRepoDB(t, &domain.Chat{}, &domain.Message{}, &domain.Feedback{}, &domain.Idempotency{})
+	ctx := context.Background()
+	const wsA, wsB = "ws-a", "ws-b"
+
+	a, err := CreateChat(ctx, db, wsA, "u1", "a")
+	if err != nil {
+		t.Fatalf("CreateChat(a): %v", err)
+	}
+	b, err := CreateChat(ctx, db, wsB, "u1", "b")
+	if err != nil {
+		t.Fatalf("CreateChat(b): %v", err)
+	}
+	msgA, _ := CreateMessage(db, a.ID, "assistant", "answer", nil)
+	if err := CreateIdempotency(ctx, db, &domain.Idempotency{
+		WorkspaceID: wsA, UserID: "u1", Key: "k", ChatID: a.ID,
+		State: domain.IdempotencyCompleted, Status: 201, ExpiresAt: time.Now().UTC().Add(time.Hour),
+	}); err != nil {
+		t.Fatalf("CreateIdempotency: %v", err)
+	}
+	if err := CreateFeedback(ctx, db, wsA, msgA.ID, "u1", 1); err != nil {
+		t.Fatalf("CreateFeedback: %v", err)
+	}
+
+	// Listings, counts and stats only see the workspace's own chats.
+	for ws, want := range map[string]string{wsA: a.ID, wsB: b.ID} {
+		list, err := ListChats(ctx, db, ws, "u1")
+		if err != nil || len(list) != 1 || list[0].ID != want {
+			t.Fatalf("ListChats(%s) = %+v, %v", ws, list, err)
+		}
+		page, _ := ListChatsPage(ctx, db, ws, "u1", 0, 10)
+		if len(page) != 1 || page[0].ID != want {
+			t.Fatalf("ListChatsPage(%s) = %+v", ws, page)
+		}
+		if n, _ := CountChats(ctx, db, ws, "u1"); n != 1 {
+			t.Fatalf("CountChats(%s) = %d", ws, n)
+		}
+		if n, _, _ := ChatsStats(ctx, db, ws, "u1"); n != 1 {
+			t.Fatalf("ChatsStats(%s) = %d", ws, n)
+		}
+	}
+
+	// Addressing A's chat from B behaves exactly like a missing chat.
+	if _, err := GetChat(ctx, db, wsB, a.ID, "u1"); err != gorm.ErrRecordNotFound {
+		t.Fatalf("GetChat across workspaces: %v", err)
+	}
+	if _, err := FindChat(ctx, db, wsB, a.ID); err != gorm.ErrRecordNotFound {
+		t.Fatalf("FindChat across workspaces: %v", err)
+	}
+	if err := UpdateChatTitle(ctx, db, wsB, a.ID, "u1", "x", 0); err != gorm.ErrRecordNotFound {
+		t.Fatalf("UpdateChatTitle across workspaces: %v", err)
+	}
+	if _, err := GetMessage(db, wsB, msgA.ID); err != gorm.ErrRecordNotFound {
+		t.Fatalf("GetMessage across workspaces: %v", err)
+	}
+	if _, err := GetIdempotency(ctx, db, wsB, "u1", "k", time.Now().UTC()); err != ErrNotFound {
+		t.Fatalf("GetIdempotency across workspaces: %v", err)
+	}
+	if _, err := GetIdempotency(ctx, db, wsA, "u1", "k", time.Now().UTC()); err != nil {
+		t.Fatalf("GetIdempotency in own workspace: %v", err)
+	}
+	if n := countRows(t, db, &domain.Feedback{}, "workspace_id = ?", wsA); n != 1 {
+		t.Fatalf("feedback in %s = %d, want 1", wsA, n)
+	}
+
+	at := time.Now().UTC()
+	if err := DeleteChat(ctx, db, wsB, a.ID, "u1", 0, at); err != gorm.ErrRecordNotFound {
+		t.Fatalf("DeleteChat across workspaces: %v", err)
+	}
+	if err := DeleteChat(ctx, db, wsA, a.ID, "u1", 0, at); err != nil {
+		t.Fatalf("DeleteChat: %v", err)
+	}
+	if _, err := FindDeletedChat(ctx, db, wsB, a.ID); err != gorm.ErrRecordNotFound {
+		t.Fatalf("FindDeletedChat across workspaces: %v", err)
+	}
+	if err := RestoreChat(ctx, db, wsB, a.ID, "u1", at); err != gorm.ErrRecordNotFound {
+		t.Fatalf("RestoreChat across workspaces: %v", err)
+	}
+	if err := RestoreChat(ctx, db, wsA, a.ID, "u1", at); err != nil {
+		t.Fatalf("RestoreChat: %v", err)
+	}
+	if got, _ := GetChat(ctx, db, wsA, a.ID, "u1"); got == nil || got.Title != "a" {
+		t.Fatalf("chat a after cross-workspace attempts = %+v", got)
+	}
+}
@@ -0,0 +1,175 @@
+package search
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// bm25Index ranks paragraphs with Okapi BM25. Corpus statistics (document
+// frequencies, IDF, average length) and per-paragraph term frequencies are
+// computed once at build time; the index is read-only afterwards.
+//
+// Raw BM25 scores are unbounded, so TopK divides each score by the score of
+// a paragraph of average length containing every query term once (the sum of
+// their IDFs), or by the best raw score when that is higher. This keeps
+// Result.Score in (0,1] like the Jaccard index: the top paragraph scores 1
+// when it matches the whole query, and the share of the query's IDF it
+// covers when it matches part of it, so callers that threshold scores behave
+// the same with either implementation. Below the top, scores stay
+// proportional to the raw BM25 scores, so strong matches do not tie at 1.
+type bm25Index struct {
+	cfg      config
+	docs     []bm25Doc
+	postings map[string][]bm25Posting
+	idf      map[string]float64
+	avgLen   float64
+}
+
+type bm25Doc struct {
+	docRef
+	text     string
+	length   int // token count, including repeats
+	lenRunes int
+}
+
+type bm25Posting struct {
+	doc int
+	tf  int
+}
+
+func buildBM25Index(paragraphs []string, cfg config) *bm25Index {
+	ix := &bm25Index{
+		cfg:      cfg,
+		docs:     make([]bm25Doc, 0, len(paragraphs)),
+		postings: make(map[string][]bm25Posting),
+	}
+	total := 0
+	ids := docIDs{}
+	for i, raw := range paragraphs {
+		t, ok := cleanParagraph(raw, cfg)
+		if !ok {
+			continue
+		}
+		tf, n := termCounts(t, cfg.stopwords)
+		if n == 0 {
+			continue
+		}
+		id := len(ix.docs)
+		ix.docs = append(ix.docs, bm25Doc{
+			docRef:   docRef{id: ids.next(t), line: cfg.lineOf(i), fact: parsedFact(t)},
+			text:     t,
+			length:   n,
+			lenRunes: utf8.RuneCountInString(t),
+		})
+		for term, c := range tf {
+			ix.postings[term] = append(ix.postings[term], bm25Posting{doc: id, tf: c})
+		}
+		total += n
+		if cfg.maxDocs > 0 && len(ix.docs) >= cfg.maxDocs {
+			break
+		}
+	}
+	if len(ix.docs) == 0 {
+		return ix
+	}
+	ix.avgLen = float64(total) / float64(len(ix.docs))
+	ix.idf = make(map[string]float64, len(ix.postings))
+	for term, ps := range ix.postings {
+		ix.idf[term] = ix.idfFor(len(ps))
+	}
+	return ix
+}
+
+// idfFor returns the (always positive) Lucene-style BM25 IDF for a term that
+// appears in df documents.
+func (ix *bm25Index) idfFor(df int) float64 {
+	n := float64(len(ix.docs))
+	return math.Log(1 + (n-float64(df)+0.5)/(float64(df)+0.5))
+}
+
+// TopK returns up to k best-matching paragraphs by normalized BM25 score.
+// Ties are broken like the Jaccard index: shorter snippet, then lexical order.
+func (ix *bm25Index) TopK(q string, k int) []Result {
+	if len(ix.docs) == 0 {
+		return nil
+	}
+	if strings.TrimSpace(q) == "" {
+		return nil
+	}
+	if k <= 0 {
+		k = 3
+	}
+	qTokens := tokenize(q, ix.cfg.stopwords)
+	if len(qTokens) == 0 {
+		return nil
+	}
+
+	// Visit terms in a fixed order so floating-point sums (and therefore
+	// ties) are identical across calls.
+	terms := make([]string, 0, len(qTokens))
+	for term := range qTokens {
+		terms = append(terms, term)
+	}
+	sort.Strings(terms)
+
+	k1, b := ix.cfg.bm25K1, ix.cfg.bm25B
+	acc := make(map[int]float64)
+	best := 0.0
+	for _, term := range terms {
+		idf, ok := ix.idf[term]
+		if !ok {
+			// Unseen terms still count towards the full match so a query
+			// made mostly of unknown words scores low, as with Jaccard.
+			best += ix.idfFor(0)
+			continue
+		}
+		best += idf
+		for _, p := range ix.postings[term] {
+			d := ix.docs[p.doc]
+			tf := float64(p.tf)
+			norm := k1 * (1 - b + b*float64(d.length)/ix.avgLen)
+			acc[p.doc] += idf * tf * (k1 + 1) / (tf + norm)
+		}
+	}
+	if len(acc) == 0 || best <= 0 {
+		return nil
+	}
+
+	top := newTopK(k)
+	for id, sc := range acc {
+		if sc <= 0 {
+			continue
+		}
+		d := ix.docs[id]
+		top.offer(candidate{doc: id, ref: d.docRef, text: d.text, score: sc, lenRunes: d.lenRunes})
+	}
+	out := top.results(ix.cfg.source)
+	scale := math.Max(best, out[0].Score) // out[0] has the best raw score
+	for i := range out {
+		out[i].Score /= scale
+	}
+	return out
+}
+
+// termCounts tokenizes s like tokenize but keeps per-term frequencies. It
+// returns the counts and the total number of (non-stopword) tokens.
+func termCounts(s string, stop map[string]struct{}) (map[string]int, int) {
+	words := wordRE.FindAllString(strings.ToLower(s), -1)
+	if len(words) == 0 {
+		return nil, 0
+	}
+	out := make(map[string]int, len(words))
+	n := 0
+	for _, w := range words {
+		if stop != nil {
+			if _, skip := stop[w]; skip {
+				continue
+			}
+		}
+		out[w]++
+		n++
+	}
+	return out, n
+}
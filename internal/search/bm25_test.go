@@ -0,0 +1,236 @@
+package search
+
+import (
+	"bytes"
+	"testing"
+)
+
+// ---------- Options ----------
+func TestBM25Options(t *testing.T) {
+	def := defaultConfig()
+	if def.scoring != ScoringJaccard || def.bm25K1 != DefaultBM25K1 || def.bm25B != DefaultBM25B {
+		t.Fatalf("defaultConfig unexpected: %#v", def)
+	}
+
+	cfg := def
+	WithScoring(ScoringBM25)(&cfg)
+	if cfg.scoring != ScoringBM25 {
+		t.Fatalf("WithScoring failed: %q", cfg.scoring)
+	}
+	WithScoring("tfidf")(&cfg) // unknown → ignored
+	if cfg.scoring != ScoringBM25 {
+		t.Fatalf("unknown scoring should be ignored, got %q", cfg.scoring)
+	}
+
+	WithBM25Params(2.0, 0.5)(&cfg)
+	if cfg.bm25K1 != 2.0 || cfg.bm25B != 0.5 {
+		t.Fatalf("WithBM25Params failed: %#v", cfg)
+	}
+	WithBM25Params(-1, 1.5)(&cfg) // both out of range → ignored
+	if cfg.bm25K1 != 2.0 || cfg.bm25B != 0.5 {
+		t.Fatalf("out-of-range BM25 params should be ignored: %#v", cfg)
+	}
+}
+
+// ---------- Constructors pick the implementation ----------
+func TestBM25_ConstructorsSelectImplementation(t *testing.T) {
+	paras := []string{"alpha beta", "gamma delta"}
+
+	if _, ok := NewIndexFromStrings(paras, WithMinParagraphRunes(0)).(*index); !ok {
+		t.Fatalf("default scoring should build the Jaccard index")
+	}
+	if _, ok := NewIndexFromStrings(paras, WithMinParagraphRunes(0), WithScoring(ScoringBM25)).(*bm25Index); !ok {
+		t.Fatalf("ScoringBM25 should build a bm25Index from strings")
+	}
+
+	idx, err := NewIndexFromReader(bytes.NewBufferString("alpha beta\n\ngamma delta"),
+		WithMinParagraphRunes(0), WithScoring(ScoringBM25))
+	if err != nil {
+		t.Fatalf("NewIndexFromReader: %v", err)
+	}
+	if _, ok := idx.(*bm25Index); !ok {
+		t.Fatalf("ScoringBM25 should build a bm25Index from a reader, got %T", idx)
+	}
+	if out := idx.TopK("gamma", 3); len(out) != 1 || out[0].Snippet != "gamma delta" {
+		t.Fatalf("unexpected results: %+v", out)
+	}
+}
+
+// ---------- Build filters ----------
+func TestBM25_BuildFiltersAndStats(t *testing.T) {
+	paras := []string{
+		"",
+		"short",
+		"The and a", // all stopwords → skipped
+		"Keep this paragraph keep",
+		"Another paragraph here",
+	}
+	ix := buildBM25Index(paras, func() config {
+		c := defaultConfig()
+		c.minParagraphRunes = 6
+		c.stopwords = map[string]struct{}{"the": {}, "and": {}, "a": {}}
+		return c
+	}())
+	if len(ix.docs) != 2 {
+		t.Fatalf("expected 2 docs, got %d", len(ix.docs))
+	}
+	// "keep" appears twice in one doc → tf=2, df=1
+	ps := ix.postings["keep"]
+	if len(ps) != 1 || ps[0].tf != 2 {
+		t.Fatalf("unexpected postings for 'keep': %+v", ps)
+	}
+	// "paragraph" appears in both docs → lower IDF than "keep"
+	if ix.idf["paragraph"] >= ix.idf["keep"] {
+		t.Fatalf("expected common term to have lower IDF: %v vs %v", ix.idf["paragraph"], ix.idf["keep"])
+	}
+	if ix.avgLen != 3.5 {
+		t.Fatalf("avgLen = %v; want 3.5", ix.avgLen)
+	}
+
+	capped := buildBM25Index(paras, func() config {
+		c := defaultConfig()
+		c.minParagraphRunes = 0
+		c.maxDocs = 1
+		return c
+	}())
+	if len(capped.docs) != 1 {
+		t.Fatalf("maxDocs cap failed, got %d", len(capped.docs))
+	}
+}
+
+// ---------- Ranking ----------
+func TestBM25_RareTermOutweighsCommonTerm(t *testing.T) {
+	paras := []string{
+		"Gen Z in Nashville are interested in Esports",
+		"Gen Z in Nashville are average people",
+		"Millennials in Austin are average people",
+		"Boomers in Denver are average people",
+	}
+	idx := NewIndexFromStrings(paras, WithMinParagraphRunes(0), WithScoring(ScoringBM25))
+
+	out := idx.TopK("esports average", 4)
+	if len(out) == 0 {
+		t.Fatalf("expected results")
+	}
+	if out[0].Snippet != paras[0] {
+		t.Fatalf("rare term should dominate ranking, got %+v", out)
+	}
+	for _, r := range out {
+		if r.Score <= 0 || r.Score > 1 {
+			t.Fatalf("scores must be normalized to (0,1]: %+v", out)
+		}
+	}
+
+	// Jaccard cannot tell the two apart: both share one token with the query.
+	jac := NewIndexFromStrings(paras, WithMinParagraphRunes(0)).TopK("esports average", 4)
+	if len(jac) < 2 || jac[0].Snippet == paras[0] {
+		t.Fatalf("expected Jaccard to rank the shorter common-term snippet first, got %+v", jac)
+	}
+}
+
+func TestBM25_SingleOccurrenceMatchesClearThreshold(t *testing.T) {
+	paras := []string{
+		"Gen Z in Nashville discover brands through podcasts",
+		"Millennials in Austin discover brands through television",
+		"Boomers in Denver read newspapers every morning",
+		"Gen X in Chicago listen to radio on commutes",
+	}
+	idx := NewIndexFromStrings(paras, WithMinParagraphRunes(0), WithScoring(ScoringBM25))
+	const threshold = 0.32 // THRESHOLD default
+
+	// Every query term once, at about average length: a full match.
+	out := idx.TopK("Nashville podcasts brands", 1)
+	if len(out) != 1 || out[0].Snippet != paras[0] || out[0].Score < 0.9 {
+		t.Fatalf("full match should score near 1, got %+v", out)
+	}
+	// Two of three terms, including the rarest, still clear the threshold.
+	out = idx.TopK("Nashville podcasts tiktok", 1)
+	if len(out) != 1 || out[0].Snippet != paras[0] || out[0].Score < threshold {
+		t.Fatalf("partial match should clear the threshold, got %+v", out)
+	}
+}
+
+func TestBM25_StrongMatchesDoNotTie(t *testing.T) {
+	paras := []string{
+		"tiktok tiktok daily",
+		"tiktok users daily",
+		"Boomers in Denver read newspapers every single morning before work",
+		"Gen X in Chicago listen to talk radio during their long commutes",
+	}
+	idx := NewIndexFromStrings(paras, WithMinParagraphRunes(0), WithScoring(ScoringBM25))
+
+	// Both short paragraphs beat an average-length full match; they keep
+	// distinct scores, the best one scoring 1.
+	out := idx.TopK("tiktok", 2)
+	if len(out) != 2 || out[0].Snippet != paras[0] || out[0].Score != 1 || out[1].Score >= 1 || out[1].Score < 0.5 {
+		t.Fatalf("expected distinct scores below a top score of 1, got %+v", out)
+	}
+}
+
+func TestBM25_LengthNormalization(t *testing.T) {
+	paras := []string{
+		"tiktok users daily",
+		"tiktok users daily and also many other unrelated words here today",
+	}
+
+	// With b=0.75 the shorter doc wins.
+	idx := NewIndexFromStrings(paras, WithMinParagraphRunes(0), WithScoring(ScoringBM25))
+	out := idx.TopK("tiktok", 2)
+	if len(out) != 2 || out[0].Snippet != paras[0] || out[0].Score <= out[1].Score {
+		t.Fatalf("expected shorter doc to score higher with length normalization: %+v", out)
+	}
+
+	// With b=0 length is ignored → equal scores, tie broken by rune length.
+	flat := NewIndexFromStrings(paras, WithMinParagraphRunes(0), WithScoring(ScoringBM25), WithBM25Params(1.2, 0))
+	out = flat.TopK("tiktok", 2)
+	if len(out) != 2 || out[0].Score != out[1].Score || out[0].Snippet != paras[0] {
+		t.Fatalf("expected equal scores with b=0 and length tie-break: %+v", out)
+	}
+}
+
+func TestBM25_TieBreakAndKCap(t *testing.T) {
+	idx := NewIndexFromStrings([]string{
+		"beta alpha",
+		"alpha beta",
+		"delta epsilon",
+	}, WithMinParagraphRunes(0), WithScoring(ScoringBM25))
+
+	out := idx.TopK("alpha beta", 0) // k<=0 → 3, capped by candidates
+	if len(out) != 2 {
+		t.Fatalf("expected 2 results, got %+v", out)
+	}
+	if out[0].Snippet != "alpha beta" || out[1].Snippet != "beta alpha" {
+		t.Fatalf("expected lexical tie-break, got %+v", out)
+	}
+}
+
+func TestBM25_EmptyCases(t *testing.T) {
+	empty := NewIndexFromStrings(nil, WithScoring(ScoringBM25))
+	if out := empty.TopK("alpha", 3); out != nil {
+		t.Fatalf("empty index should return nil")
+	}
+
+	idx := NewIndexFromStrings([]string{"alpha beta"}, WithMinParagraphRunes(0), WithScoring(ScoringBM25))
+	if out := idx.TopK("   ", 3); out != nil {
+		t.Fatalf("blank query should return nil")
+	}
+	if out := idx.TopK("zeta", 3); out != nil {
+		t.Fatalf("no-overlap query should return nil, got %+v", out)
+	}
+
+	stop := NewIndexFromStrings([]string{"alpha beta"}, WithMinParagraphRunes(0),
+		WithScoring(ScoringBM25), WithStopwords([]string{"the"}))
+	if out := stop.TopK("the", 3); out != nil {
+		t.Fatalf("stopword-only query should return nil")
+	}
+}
+
+func TestTermCounts(t *testing.T) {
+	tf, n := termCounts("Alpha alpha BETA the", map[string]struct{}{"the": {}})
+	if n != 3 || tf["alpha"] != 2 || tf["beta"] != 1 {
+		t.Fatalf("termCounts unexpected: %v %d", tf, n)
+	}
+	if tf, n := termCounts("!!!", nil); tf != nil || n != 0 {
+		t.Fatalf("termCounts should be empty for no words")
+	}
+}
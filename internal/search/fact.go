@@ -0,0 +1,207 @@
+package search
+
+// Structured facts.
+//
+// Almost every row of the shipped corpus follows one of two shapes:
+//
+//	"<audience> in <location> are N% more likely to <behaviour> compared to the average person."
+//	"N% of <audience> in <location> <behaviour>."
+//
+// ParseFact turns such a row into a typed Fact so callers can filter on real
+// fields (audience, location, metric) instead of guessing from capitalised
+// words. Rows that match neither shape are kept as raw text. The indexes
+// parse every paragraph when they are built and attach the Fact to its
+// results (Result.Fact).
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// MetricType distinguishes the quantitative shapes found in the corpus.
+type MetricType string
+
+const (
+	// MetricNone marks a fact whose text could not be parsed.
+	MetricNone MetricType = ""
+	// MetricIndex is a relative likelihood versus a baseline group
+	// ("N% more/less likely ... compared to <baseline>").
+	MetricIndex MetricType = "index"
+	// MetricShare is the percentage of an audience exhibiting a behaviour
+	// ("N% of <audience> <behaviour>").
+	MetricShare MetricType = "share"
+)
+
+// Fact is one corpus row broken into typed fields. Text is always set; the
+// remaining fields are zero when Metric is MetricNone.
+type Fact struct {
+	Text      string     // original row text (whitespace-normalized)
+	Audience  string     // e.g. "Gen Z"
+	Location  string     // e.g. "Nashville"; empty when the row names none
+	Metric    MetricType // index or share
+	Value     float64    // percentage; negative for "less likely" index facts
+	Behaviour string     // e.g. "visit Reddit daily"
+	Baseline  string     // comparison group for index facts, e.g. "the average person"
+}
+
+// Parsed reports whether the row matched a known shape.
+func (f Fact) Parsed() bool { return f.Metric != MetricNone }
+
+// parsedFact parses an indexed paragraph, returning nil for rows that match
+// no known shape.
+func parsedFact(text string) *Fact {
+	f := ParseFact(text)
+	if !f.Parsed() {
+		return nil
+	}
+	return &f
+}
+
+var (
+	// "\(" → "(" etc.; the corpus escapes markdown punctuation.
+	mdEscapeRE = regexp.MustCompile(`\\([\\` + "`" + `*_{}\[\]()#+\-.!|])`)
+
+	indexFactRE = regexp.MustCompile(`^(.+?) (?:is|are) (\d+(?:\.\d+)?)% (more|less) likely (to|than) (.+)$`)
+	shareFactRE = regexp.MustCompile(`^(?i:(?:only|approximately|around|about|nearly|almost|over|roughly|just) )?(\d+(?:\.\d+)?)% of (.+)$`)
+
+	// "<audience> in <Location>" where the location is a run of capitalised
+	// words, optionally preceded by "the".
+	locationRE = regexp.MustCompile(`^(.+?) in (?:the )?(\p{Lu}[^\s,]*(?: \p{Lu}[^\s,]*)*)$`)
+
+	// Clause boundaries that end the behaviour/baseline text: a sentence
+	// break, or a comma followed by a trailing commentary clause.
+	clauseEndRE = regexp.MustCompile(`\. |, (?:making|which|while|whereas|compared|showing|suggesting|indicating|highlighting|representing|showcasing|reflecting|demonstrating|signifying|revealing|meaning|with|even|but|though|although|despite|and (?:they|this|it|are|is)|this|so|as|than|likely|yet)\b`)
+)
+
+// verbStarts are lowercase words that begin the behaviour in a share fact
+// ("N% of <audience> <verb> ..."). The corpus is regular enough that a fixed
+// lexicon splits the vast majority of rows.
+var verbStarts = map[string]struct{}{
+	"are": {}, "is": {}, "were": {}, "was": {}, "have": {}, "has": {}, "had": {},
+	"use": {}, "used": {}, "find": {}, "found": {}, "discover": {}, "discovered": {},
+	"describe": {}, "described": {}, "visit": {}, "visited": {}, "consider": {},
+	"follow": {}, "identify": {}, "drink": {}, "prefer": {}, "feel": {}, "believe": {},
+	"spend": {}, "want": {}, "buy": {}, "bought": {}, "tend": {}, "rely": {}, "like": {},
+	"research": {}, "say": {}, "said": {}, "purchase": {}, "purchased": {}, "trust": {},
+	"play": {}, "played": {}, "watch": {}, "watched": {}, "report": {}, "reported": {},
+	"favor": {}, "favour": {}, "enjoy": {}, "select": {}, "selected": {}, "worry": {},
+	"support": {}, "value": {}, "live": {}, "prioritize": {}, "prioritise": {},
+	"click": {}, "clicked": {}, "participate": {}, "participated": {}, "took": {},
+	"listen": {}, "listened": {}, "drive": {}, "own": {}, "plan": {}, "would": {},
+	"will": {}, "can": {}, "do": {}, "did": {}, "agree": {}, "engage": {}, "read": {},
+	"shop": {}, "expect": {}, "think": {}, "intend": {}, "choose": {}, "chose": {},
+	"go": {}, "work": {}, "see": {}, "saw": {}, "look": {}, "make": {}, "made": {},
+	"access": {}, "attend": {}, "attended": {}, "pay": {}, "paid": {}, "post": {},
+	"posted": {}, "share": {}, "shared": {}, "send": {}, "sent": {}, "get": {},
+	"got": {}, "keep": {}, "stay": {}, "seek": {}, "search": {}, "searched": {},
+	"typically": {}, "always": {}, "mainly": {}, "actively": {}, "currently": {},
+	"usually": {}, "often": {}, "regularly": {}, "frequently": {}, "never": {},
+	"also": {}, "still": {}, "primarily": {}, "mostly": {}, "strongly": {},
+	"personally": {}, "already": {},
+}
+
+// relativeStarts open a relative clause inside the audience ("internet users
+// who play games ..."): the next verb belongs to the audience, not the
+// behaviour.
+var relativeStarts = map[string]struct{}{"who": {}, "whose": {}, "that": {}}
+
+// ParseFact parses one corpus row. It never fails: rows that match neither
+// known shape come back with only Text set.
+func ParseFact(text string) Fact {
+	text = strings.TrimSpace(normalizeWhitespace(text))
+	f := Fact{Text: text}
+	s := mdEscapeRE.ReplaceAllString(text, "$1")
+
+	if m := shareFactRE.FindStringSubmatch(s); m != nil {
+		v, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			return f
+		}
+		aud, beh, ok := splitAudience(m[2])
+		if !ok {
+			return f
+		}
+		f.Metric, f.Value = MetricShare, v
+		f.Audience, f.Location = splitLocation(aud)
+		f.Behaviour = clause(beh)
+		return f
+	}
+
+	if m := indexFactRE.FindStringSubmatch(s); m != nil {
+		aud := m[1]
+		if strings.ContainsAny(aud, ",%") {
+			return f
+		}
+		v, err := strconv.ParseFloat(m[2], 64)
+		if err != nil {
+			return f
+		}
+		if m[3] == "less" {
+			v = -v
+		}
+		rest := m[5]
+		if m[4] == "than" {
+			// "... more likely than <baseline> to <behaviour>"
+			i := strings.Index(rest, " to ")
+			if i < 0 {
+				return f
+			}
+			f.Baseline, rest = rest[:i], rest[i+len(" to "):]
+		} else if i := strings.Index(rest, " compared to "); i >= 0 {
+			f.Baseline = clause(rest[i+len(" compared to "):])
+			rest = rest[:i]
+		}
+		f.Metric, f.Value = MetricIndex, v
+		f.Audience, f.Location = splitLocation(aud)
+		f.Behaviour = clause(rest)
+		return f
+	}
+	return f
+}
+
+// splitAudience splits "<audience> <behaviour>" at the first lowercase verb
+// outside a relative clause.
+func splitAudience(s string) (audience, behaviour string, ok bool) {
+	words := strings.Fields(s)
+	inRelative := false
+	for i, w := range words {
+		if i == 0 {
+			continue
+		}
+		lw := strings.ToLower(w)
+		if _, rel := relativeStarts[lw]; rel {
+			inRelative = true
+			continue
+		}
+		if w != lw {
+			continue // capitalised: part of a name
+		}
+		if _, verb := verbStarts[lw]; !verb {
+			continue
+		}
+		if inRelative {
+			inRelative = false
+			continue
+		}
+		return strings.Join(words[:i], " "), strings.Join(words[i:], " "), true
+	}
+	return "", "", false
+}
+
+// splitLocation peels a trailing "in <Location>" off an audience.
+func splitLocation(aud string) (audience, location string) {
+	aud = strings.TrimSpace(aud)
+	if m := locationRE.FindStringSubmatch(aud); m != nil {
+		return m[1], m[2]
+	}
+	return aud, ""
+}
+
+// clause returns s up to the first clause boundary, without the final period.
+func clause(s string) string {
+	if loc := clauseEndRE.FindStringIndex(s); loc != nil {
+		s = s[:loc[0]]
+	}
+	return strings.TrimSpace(strings.TrimRight(strings.TrimSpace(s), "."))
+}
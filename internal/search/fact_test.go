@@ -0,0 +1,123 @@
+package search
+
+import "testing"
+
+func TestParseFact_Shapes(t *testing.T) {
+	cases := []struct {
+		name string
+		in   string
+		want Fact
+	}{
+		{
+			name: "index with location",
+			in:   "Gen Z in Nashville are 182% more likely to visit Reddit daily compared to the average person.",
+			want: Fact{Audience: "Gen Z", Location: "Nashville", Metric: MetricIndex, Value: 182,
+				Behaviour: "visit Reddit daily", Baseline: "the average person"},
+		},
+		{
+			name: "index less likely is negative",
+			in:   "Gen Z in Nashville are 75% less likely to use Facebook more than once a day compared to the average person.",
+			want: Fact{Audience: "Gen Z", Location: "Nashville", Metric: MetricIndex, Value: -75,
+				Behaviour: "use Facebook more than once a day", Baseline: "the average person"},
+		},
+		{
+			name: "index trailing clause and other baseline",
+			in:   "Gen Z in Nashville are 84% more likely to feel affluent compared to the average person, even though only 6.6% of them identify as such.",
+			want: Fact{Audience: "Gen Z", Location: "Nashville", Metric: MetricIndex, Value: 84,
+				Behaviour: "feel affluent", Baseline: "the average person"},
+		},
+		{
+			name: "index likely than baseline",
+			in:   "Shampoo users in Vietnam are 14% more likely than the average person to discover new brands through consumer review sites.",
+			want: Fact{Audience: "Shampoo users", Location: "Vietnam", Metric: MetricIndex, Value: 14,
+				Behaviour: "discover new brands through consumer review sites", Baseline: "the average person"},
+		},
+		{
+			name: "index without location or baseline",
+			in:   "This audience is 41% more likely to use LinkedIn more than once a day, suggesting LinkedIn could be effective.",
+			want: Fact{Audience: "This audience", Metric: MetricIndex, Value: 41, Behaviour: "use LinkedIn more than once a day"},
+		},
+		{
+			name: "share with location",
+			in:   "12% of Gen Z in Nashville discover new brands and products through ads or sponsored content on podcasts.",
+			want: Fact{Audience: "Gen Z", Location: "Nashville", Metric: MetricShare, Value: 12,
+				Behaviour: "discover new brands and products through ads or sponsored content on podcasts"},
+		},
+		{
+			name: "share decimal, qualifier, the-location, trailing clause",
+			in:   "Only 4.2% of internet users in the USA posted about charity online, suggesting limited promotion.",
+			want: Fact{Audience: "internet users", Location: "USA", Metric: MetricShare, Value: 4.2, Behaviour: "posted about charity online"},
+		},
+		{
+			name: "share relative clause in audience",
+			in:   "52% of EV owners who are Formula E fans are interested in cars and motoring.",
+			want: Fact{Audience: "EV owners who are Formula E fans", Metric: MetricShare, Value: 52, Behaviour: "are interested in cars and motoring"},
+		},
+		{
+			name: "share keeps commas inside behaviour",
+			in:   "48% of internet users are interested in health food, drinks, or nutrition, showing strong interest.",
+			want: Fact{Audience: "internet users", Metric: MetricShare, Value: 48, Behaviour: "are interested in health food, drinks, or nutrition"},
+		},
+		{
+			name: "markdown escapes",
+			in:   `Younger audiences \(16-24\) are 83% more likely to find out about brands through vlogs compared to older consumers \(55-64\).`,
+			want: Fact{Audience: "Younger audiences (16-24)", Metric: MetricIndex, Value: 83,
+				Behaviour: "find out about brands through vlogs", Baseline: "older consumers (55-64)"},
+		},
+		{name: "absolute count stays raw", in: "Approximately 285 million people use online pinboards like Pinterest."},
+		{name: "times more likely stays raw", in: "Gen Z charity donors are over 3 times more likely to be between 16 and 24 years old compared to the average person."},
+		{name: "share without verb stays raw", in: "12% of Gen Z Nashville."},
+		{name: "clause before index stays raw", in: "Despite everything, X is 5% more likely to win compared to Y."},
+		{name: "than without behaviour stays raw", in: "Gen Z are 5% more likely than the average person."},
+		{name: "plain text", in: "hello world"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := ParseFact("  " + tc.in + "  ")
+			tc.want.Text = tc.in
+			if got != tc.want {
+				t.Fatalf("ParseFact(%q)\n got  %+v\n want %+v", tc.in, got, tc.want)
+			}
+			if got.Parsed() != (tc.want.Metric != MetricNone) {
+				t.Fatalf("Parsed() = %v", got.Parsed())
+			}
+		})
+	}
+}
+
+func TestIndexResultsCarryFacts(t *testing.T) {
+	paras := []string{
+		"Gen Z in Nashville are 5% more likely to run compared to the average person.",
+		"not a fact at all",
+	}
+	for _, scoring := range []Scoring{ScoringJaccard, ScoringBM25} {
+		idx := NewIndexFromStrings(paras, WithMinParagraphRunes(0), WithScoring(scoring))
+		out := idx.TopK("Gen Z Nashville run", 1)
+		if len(out) != 1 || out[0].Fact == nil || out[0].Fact.Location != "Nashville" || out[0].Fact.Metric != MetricIndex {
+			t.Fatalf("%s: expected parsed fact, got %+v", scoring, out)
+		}
+		if out := idx.TopK("not a fact", 1); len(out) != 1 || out[0].Fact != nil {
+			t.Fatalf("%s: unparsed row should have no fact, got %+v", scoring, out)
+		}
+	}
+}
+
+// The shipped corpus is the parser's reason to exist: nearly every row should
+// come back typed.
+func TestParseFacts_CorpusCoverage(t *testing.T) {
+	paras := loadCorpusParagraphs(t)
+	var parsed int
+	for _, p := range paras {
+		f := ParseFact(p)
+		if !f.Parsed() {
+			continue
+		}
+		parsed++
+		if f.Audience == "" || f.Behaviour == "" || f.Value == 0 {
+			t.Fatalf("incomplete fact from %q: %+v", p, f)
+		}
+	}
+	if ratio := float64(parsed) / float64(len(paras)); ratio < 0.9 {
+		t.Fatalf("only %.1f%% of %d rows parsed", 100*ratio, len(paras))
+	}
+}
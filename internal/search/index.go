@@ -6,12 +6,21 @@
 //   - Clear, documented types and functional options (Option pattern)
 //   - Unicode-aware tokenization with optional stop-word removal
 //   - Immutable, read-only index after construction (safe for concurrent use)
-//   - Deterministic scoring and sorting (stable order for ties)
+//   - Inverted postings: only paragraphs sharing a query token are scored
+//   - Deterministic scoring and bounded top-k selection (stable order for ties)
 //   - Sensible defaults (paragraph filtering, result caps)
 //   - Backward-compatible Index interface (TopK(query, k int) []Result)
 //
-// Scoring uses Jaccard similarity between the query token set and each
-// paragraph’s token set: score = |Q ∩ P| / |Q ∪ P|.
+// Two scoring strategies are available (see WithScoring):
+//
+//   - Jaccard (default): similarity between the query token set and each
+//     paragraph’s token set: score = |Q ∩ P| / |Q ∪ P|.
+//   - BM25: Okapi BM25 over corpus IDF and per-paragraph term frequencies,
+//     normalized to [0,1] (see bm25.go).
+//
+// Both parse every paragraph with ParseFact (see fact.go) at build time, so
+// results of rows with a known shape carry typed fields (audience, location,
+// metric, value, behaviour) that callers can filter on rather than free text.
 package search
 
 import (
@@ -19,15 +28,18 @@ import (
 	"io"
 	"os"
 	"regexp"
-	"sort"
 	"strings"
 	"unicode/utf8"
 )
 
-// Result is a ranked snippet with its similarity score.
+// Result is a ranked snippet with its similarity score and provenance.
 type Result struct {
 	Snippet string
 	Score   float64
+	DocID   string // stable document ID (see provenance.go)
+	Source  string // corpus file label set with WithSource; empty if unset
+	Line    int    // 1-based line in Source; 0 if unknown
+	Fact    *Fact  // Snippet as a typed fact; nil if it matches no known shape
 }
 
 // Index is the minimal interface implemented by all search indices.
@@ -40,10 +52,31 @@ type Index interface {
 
 type Option func(*config)
 
+// Scoring selects the ranking function used by an Index.
+type Scoring string
+
+const (
+	// ScoringJaccard ranks paragraphs by token-set Jaccard similarity.
+	ScoringJaccard Scoring = "jaccard"
+	// ScoringBM25 ranks paragraphs with Okapi BM25 (see WithBM25Params).
+	ScoringBM25 Scoring = "bm25"
+)
+
+// Default BM25 tuning parameters.
+const (
+	DefaultBM25K1 = 1.2
+	DefaultBM25B  = 0.75
+)
+
 type config struct {
 	minParagraphRunes int
 	stopwords         map[string]struct{}
 	maxDocs           int
+	scoring           Scoring
+	bm25K1            float64
+	bm25B             float64
+	source            string
+	lines             []int
 }
 
 func defaultConfig() config {
@@ -51,6 +84,9 @@ func defaultConfig() config {
 		minParagraphRunes: 40,
 		stopwords:         nil,
 		maxDocs:           0,
+		scoring:           ScoringJaccard,
+		bm25K1:            DefaultBM25K1,
+		bm25B:             DefaultBM25B,
 	}
 }
 
@@ -85,18 +121,49 @@ func WithMaxDocs(n int) Option {
 	}
 }
 
+// WithScoring selects the ranking function. Unknown values are ignored and
+// the default (ScoringJaccard) is kept.
+func WithScoring(s Scoring) Option {
+	return func(c *config) {
+		switch s {
+		case ScoringJaccard, ScoringBM25:
+			c.scoring = s
+		}
+	}
+}
+
+// WithBM25Params tunes BM25 term-frequency saturation (k1 >= 0) and length
+// normalization (b in [0,1]). Out-of-range values are ignored individually.
+// It has no effect unless ScoringBM25 is selected.
+func WithBM25Params(k1, b float64) Option {
+	return func(c *config) {
+		if k1 >= 0 {
+			c.bm25K1 = k1
+		}
+		if b >= 0 && b <= 1 {
+			c.bm25B = b
+		}
+	}
+}
+
 // ----------------------------------------------------------------------------
 // Implementation
 
 type doc struct {
-	text   string
-	tokens map[string]struct{}
-	tLen   int
+	docRef
+	text     string
+	tokens   map[string]struct{}
+	tLen     int
+	lenRunes int
 }
 
+// index is the Jaccard implementation. postings maps each token to the
+// ascending positions of the docs containing it, so TopK only scores docs
+// that share at least one token with the query.
 type index struct {
-	cfg  config
-	docs []doc
+	cfg      config
+	docs     []doc
+	postings map[string][]int
 }
 
 // NewIndexFromMarkdown builds an Index by reading the Markdown at path
@@ -111,6 +178,8 @@ func NewIndexFromMarkdown(path string, opts ...Option) (Index, error) {
 
 // NewIndexFromReader builds an Index from UTF-8 text provided by r.
 // The reader is fully consumed; paragraphs are split on blank lines.
+// Unless WithSourceLines is given, each Result reports the line its
+// paragraph starts on in r.
 func NewIndexFromReader(r io.Reader, opts ...Option) (Index, error) {
 	cfg := defaultConfig()
 	for _, o := range opts {
@@ -120,8 +189,11 @@ func NewIndexFromReader(r io.Reader, opts ...Option) (Index, error) {
 	if err != nil {
 		return &index{cfg: cfg, docs: nil}, err
 	}
-	paras := splitParasFromBytes(all)
-	return buildIndex(paras, cfg), nil
+	paras, lines := splitParasWithLines(all)
+	if cfg.lines == nil {
+		cfg.lines = lines
+	}
+	return build(paras, cfg), nil
 }
 
 // NewIndexFromStrings builds an Index directly from a slice of paragraphs.
@@ -130,31 +202,59 @@ func NewIndexFromStrings(paragraphs []string, opts ...Option) Index {
 	for _, o := range opts {
 		o(&cfg)
 	}
+	return build(paragraphs, cfg)
+}
+
+// build dispatches to the index implementation selected by cfg.scoring.
+func build(paragraphs []string, cfg config) Index {
+	if cfg.scoring == ScoringBM25 {
+		return buildBM25Index(paragraphs, cfg)
+	}
 	return buildIndex(paragraphs, cfg)
 }
 
+// cleanParagraph normalizes whitespace in raw and reports whether the result
+// passes the paragraph filters shared by all index implementations.
+func cleanParagraph(raw string, cfg config) (string, bool) {
+	t := strings.TrimSpace(normalizeWhitespace(raw))
+	if t == "" {
+		return "", false
+	}
+	if cfg.minParagraphRunes > 0 && utf8.RuneCountInString(t) < cfg.minParagraphRunes {
+		return "", false
+	}
+	return t, true
+}
+
 func buildIndex(paragraphs []string, cfg config) *index {
 	docs := make([]doc, 0, len(paragraphs))
-	count := 0
-	for _, raw := range paragraphs {
-		t := strings.TrimSpace(normalizeWhitespace(raw))
-		if t == "" {
-			continue
-		}
-		if cfg.minParagraphRunes > 0 && utf8.RuneCountInString(t) < cfg.minParagraphRunes {
+	postings := make(map[string][]int)
+	ids := docIDs{}
+	for i, raw := range paragraphs {
+		t, ok := cleanParagraph(raw, cfg)
+		if !ok {
 			continue
 		}
 		toks := tokenize(t, cfg.stopwords)
 		if len(toks) == 0 {
 			continue
 		}
-		docs = append(docs, doc{text: t, tokens: toks, tLen: len(toks)})
-		count++
-		if cfg.maxDocs > 0 && count >= cfg.maxDocs {
+		id := len(docs)
+		docs = append(docs, doc{
+			docRef:   docRef{id: ids.next(t), line: cfg.lineOf(i), fact: parsedFact(t)},
+			text:     t,
+			tokens:   toks,
+			tLen:     len(toks),
+			lenRunes: utf8.RuneCountInString(t),
+		})
+		for tok := range toks {
+			postings[tok] = append(postings[tok], id)
+		}
+		if cfg.maxDocs > 0 && len(docs) >= cfg.maxDocs {
 			break
 		}
 	}
-	return &index{cfg: cfg, docs: docs}
+	return &index{cfg: cfg, docs: docs, postings: postings}
 }
 
 // TopK returns up to k best-matching paragraphs by Jaccard similarity.
@@ -174,54 +274,31 @@ func (i *index) TopK(q string, k int) []Result {
 	}
 	qLen := len(qTokens)
 
-	type scored struct {
-		snippet  string
-		score    float64
-		lenRunes int
+	// Count |Q ∩ P| for every doc reachable through the query's postings.
+	over := make(map[int]int)
+	for tok := range qTokens {
+		for _, id := range i.postings[tok] {
+			over[id]++
+		}
+	}
+	if len(over) == 0 {
+		return nil
 	}
 
-	buf := make([]scored, 0, min(k*4, len(i.docs)))
-	for _, d := range i.docs {
-		over := overlap(qTokens, d.tokens)
-		if over == 0 {
-			continue
-		}
-		union := float64(qLen + d.tLen - over)
+	top := newTopK(k)
+	for id, n := range over {
+		d := i.docs[id]
+		union := float64(qLen + d.tLen - n)
 		if union <= 0 {
 			continue
 		}
-		score := float64(over) / union
+		score := float64(n) / union
 		if score <= 0 {
 			continue
 		}
-		buf = append(buf, scored{
-			snippet:  d.text,
-			score:    score,
-			lenRunes: utf8.RuneCountInString(d.text),
-		})
-	}
-	if len(buf) == 0 {
-		return nil
-	}
-
-	sort.SliceStable(buf, func(a, b int) bool {
-		if buf[a].score != buf[b].score {
-			return buf[a].score > buf[b].score
-		}
-		if buf[a].lenRunes != buf[b].lenRunes {
-			return buf[a].lenRunes < buf[b].lenRunes
-		}
-		return buf[a].snippet < buf[b].snippet
-	})
-
-	if k > len(buf) {
-		k = len(buf)
+		top.offer(candidate{doc: id, ref: d.docRef, text: d.text, score: score, lenRunes: d.lenRunes})
 	}
-	out := make([]Result, k)
-	for i := 0; i < k; i++ {
-		out[i] = Result{Snippet: buf[i].snippet, Score: buf[i].score}
-	}
-	return out
+	return top.results(i.cfg.source)
 }
 
 // ----------------------------------------------------------------------------
@@ -250,22 +327,6 @@ func tokenize(s string, stop map[string]struct{}) map[string]struct{} {
 	return out
 }
 
-func overlap(a, b map[string]struct{}) int {
-	if len(a) == 0 || len(b) == 0 {
-		return 0
-	}
-	n := 0
-	if len(a) > len(b) {
-		a, b = b, a
-	}
-	for k := range a {
-		if _, ok := b[k]; ok {
-			n++
-		}
-	}
-	return n
-}
-
 func normalizeWhitespace(s string) string {
 	var b strings.Builder
 	b.Grow(len(s))
@@ -287,20 +348,6 @@ func normalizeWhitespace(s string) string {
 var paraSplitRE = regexp.MustCompile(`\n\s*\n`)
 
 func splitParasFromBytes(all []byte) []string {
-	raw := string(all)
-	chunks := paraSplitRE.Split(raw, -1)
-	out := make([]string, 0, len(chunks))
-	for _, c := range chunks {
-		if t := strings.TrimSpace(c); t != "" {
-			out = append(out, t)
-		}
-	}
-	return out
-}
-
-func min(a, b int) int {
-	if a < b {
-		return a
-	}
-	return b
+	paras, _ := splitParasWithLines(all)
+	return paras
 }
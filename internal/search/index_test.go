@@ -182,7 +182,7 @@ func TestTopK_BranchesAndSorting(t *testing.T) {
 	}
 }
 
-// ---------- Helpers: tokenize / overlap / whitespace / split / min ----------
+// ---------- Helpers: tokenize / whitespace / split ----------
 func TestHelpers_TokenizeOverlapWhitespaceSplitMin(t *testing.T) {
 	// tokenize
 	toks := tokenize("Hello HELLO 123 world", nil)
@@ -208,17 +208,6 @@ func TestHelpers_TokenizeOverlapWhitespaceSplitMin(t *testing.T) {
 		t.Fatalf("tokenize should return nil when no words")
 	}
 
-	// overlap
-	if overlap(nil, toks) != 0 || overlap(toks, nil) != 0 {
-		t.Fatalf("overlap with nil should be 0")
-	}
-	if overlap(map[string]struct{}{"a": {}}, map[string]struct{}{"b": {}}) != 0 {
-		t.Fatalf("overlap disjoint should be 0")
-	}
-	if overlap(map[string]struct{}{"a": {}, "b": {}}, map[string]struct{}{"b": {}, "c": {}}) != 1 {
-		t.Fatalf("overlap count wrong")
-	}
-
 	// normalizeWhitespace
 	ws := "alpha\t beta\r  gamma"
 	if got := normalizeWhitespace(ws); got != "alpha beta gamma" {
@@ -231,11 +220,6 @@ func TestHelpers_TokenizeOverlapWhitespaceSplitMin(t *testing.T) {
 	if len(ps) != 3 || ps[0] != "p1" || ps[1] != "p2" || ps[2] != "p3" {
 		t.Fatalf("splitParasFromBytes failed: %#v", ps)
 	}
-
-	// min
-	if min(2, 5) != 2 || min(5, 2) != 2 {
-		t.Fatalf("min failed")
-	}
 }
 
 func TestTopK_KGreaterThanLen_And_LenRunesTieBreak(t *testing.T) {
@@ -272,14 +256,7 @@ func TestTopK_NoOverlap_ReturnsNil(t *testing.T) {
 	}
 }
 
-func TestHelpers_OverlapSwap_And_TokenizeAlphaNum(t *testing.T) {
-	// overlap swap branch: len(a) > len(b) triggers a,b swap
-	a := map[string]struct{}{"a": {}, "b": {}, "c": {}}
-	b := map[string]struct{}{"a": {}}
-	if got := overlap(a, b); got != 1 {
-		t.Fatalf("expected overlap 1 with swap branch, got %d", got)
-	}
-
+func TestHelpers_TokenizeAlphaNum(t *testing.T) {
 	// tokenize alphanumeric: \p{L}+\p{N}* should keep trailing digits
 	toks := tokenize("foo bar abc123", nil)
 	if _, ok := toks["abc123"]; !ok {
@@ -14,14 +14,23 @@ import (
 //   - Avoids emitting a leading blank line.
 //   - Normalizes the tail to end with exactly one newline.
 func PrepareMarkdownInMemory(path string) ([]byte, error) {
+	b, _, err := PrepareMarkdownWithLines(path)
+	return b, err
+}
+
+// PrepareMarkdownWithLines is PrepareMarkdownInMemory that also reports, for
+// each emitted paragraph in order, the 1-based line of the file it came from
+// (pass it to WithSourceLines). lines is nil when the original bytes are
+// returned unchanged, since their own line numbers are then accurate.
+func PrepareMarkdownWithLines(path string) (out []byte, lines []int, err error) {
 	orig, err := os.ReadFile(path)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	f, err := os.Open(path)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	defer f.Close()
 
@@ -32,6 +41,7 @@ func PrepareMarkdownInMemory(path string) ([]byte, error) {
 	wroteAny := false
 	wroteBlank := true // start true to avoid a leading blank
 	sawTable := false
+	lineNo := 0
 
 	writeFact := func(s string) {
 		s = strings.TrimSpace(s)
@@ -41,11 +51,13 @@ func PrepareMarkdownInMemory(path string) ([]byte, error) {
 		b.WriteString(s)
 		b.WriteByte('\n')
 		b.WriteByte('\n')
+		lines = append(lines, lineNo)
 		wroteAny = true
 		wroteBlank = true
 	}
 
 	for sc.Scan() {
+		lineNo++
 		line := strings.TrimSpace(sc.Text())
 		if line == "" {
 			if !wroteBlank {
@@ -90,19 +102,19 @@ func PrepareMarkdownInMemory(path string) ([]byte, error) {
 		writeFact(line)
 	}
 	if err := sc.Err(); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// No transform → original bytes
 	if !sawTable && !wroteAny {
-		return orig, nil
+		return orig, nil, nil
 	}
 
-	out := b.String()
+	res := b.String()
 	if sawTable {
 		// Table flows expect a single trailing newline
-		out = strings.TrimRight(out, "\n") + "\n"
+		res = strings.TrimRight(res, "\n") + "\n"
 	}
 	// For non-table flows, keep the natural "\n\n" tail
-	return []byte(out), nil
+	return []byte(res), lines, nil
 }
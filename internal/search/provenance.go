@@ -0,0 +1,92 @@
+package search
+
+// Provenance.
+//
+// Every indexed paragraph carries a stable document ID plus the source file
+// and line it came from, so answers can cite the exact corpus row they were
+// built from. IDs are derived from the paragraph text (not its position), so
+// they survive reloads that only add or reorder rows.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+)
+
+// docRef is the per-paragraph metadata shared by all index implementations:
+// its provenance and, for rows of a known shape, its parsed Fact.
+type docRef struct {
+	id   string
+	line int
+	fact *Fact
+}
+
+// WithSource labels every Result with the corpus file name (e.g. "data.md").
+func WithSource(name string) Option {
+	return func(c *config) {
+		c.source = strings.TrimSpace(name)
+	}
+}
+
+// WithSourceLines maps input paragraphs to their 1-based line in the source
+// file: lines[i] is the line of the i-th non-empty paragraph. Use it when the
+// indexed text was preprocessed (see PrepareMarkdownWithLines) and no longer
+// lines up with the original file. Without it, NewIndexFromReader uses each
+// paragraph's starting line in the input it was given.
+func WithSourceLines(lines []int) Option {
+	return func(c *config) {
+		c.lines = lines
+	}
+}
+
+// lineOf returns the source line of the i-th input paragraph, or 0 if unknown.
+func (c config) lineOf(i int) int {
+	if i >= 0 && i < len(c.lines) {
+		return c.lines[i]
+	}
+	return 0
+}
+
+// docIDs assigns stable IDs: the first 16 hex digits of the SHA-256 of the
+// paragraph text, suffixed "-2", "-3", ... for verbatim duplicates.
+type docIDs map[string]int
+
+func (ids docIDs) next(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	id := hex.EncodeToString(sum[:8])
+	ids[id]++
+	if n := ids[id]; n > 1 {
+		id += "-" + strconv.Itoa(n)
+	}
+	return id
+}
+
+// splitParasWithLines splits all on blank lines like splitParasFromBytes and
+// also returns the 1-based line on which each paragraph starts.
+func splitParasWithLines(all []byte) ([]string, []int) {
+	raw := string(all)
+	var (
+		paras []string
+		lines []int
+	)
+	line, pos := 1, 0
+	for _, loc := range paraSplitRE.FindAllStringIndex(raw, -1) {
+		paras, lines = appendPara(paras, lines, raw[pos:loc[0]], line)
+		line += strings.Count(raw[pos:loc[1]], "\n")
+		pos = loc[1]
+	}
+	paras, lines = appendPara(paras, lines, raw[pos:], line)
+	return paras, lines
+}
+
+// appendPara appends chunk (trimmed) if non-empty, advancing its start line
+// past any leading blank lines.
+func appendPara(paras []string, lines []int, chunk string, line int) ([]string, []int) {
+	t := strings.TrimSpace(chunk)
+	if t == "" {
+		return paras, lines
+	}
+	lead := chunk[:strings.Index(chunk, t)]
+	return append(paras, t), append(lines, line+strings.Count(lead, "\n"))
+}
@@ -0,0 +1,86 @@
+package search
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitParasWithLines(t *testing.T) {
+	in := "\n\nalpha\nbeta\n\n  \n\ngamma\n\n\n  delta  \n"
+	paras, lines := splitParasWithLines([]byte(in))
+	if want := []string{"alpha\nbeta", "gamma", "delta"}; !reflect.DeepEqual(paras, want) {
+		t.Fatalf("paras = %q; want %q", paras, want)
+	}
+	if want := []int{3, 8, 11}; !reflect.DeepEqual(lines, want) {
+		t.Fatalf("lines = %v; want %v", lines, want)
+	}
+	if p, l := splitParasWithLines(nil); p != nil || l != nil {
+		t.Fatalf("empty input: %v %v", p, l)
+	}
+}
+
+func TestDocIDs_StableAndDistinctForDuplicates(t *testing.T) {
+	ids := docIDs{}
+	a1 := ids.next("alpha")
+	b := ids.next("beta")
+	a2 := ids.next("alpha")
+	if len(a1) != 16 || a1 == b || a2 != a1+"-2" {
+		t.Fatalf("unexpected ids: %q %q %q", a1, b, a2)
+	}
+	if again := (docIDs{}).next("alpha"); again != a1 {
+		t.Fatalf("id not stable across builds: %q vs %q", again, a1)
+	}
+}
+
+func TestResults_CarryProvenance_BothScorings(t *testing.T) {
+	in := "| text |\n| :--- |\n| alpha beta |\n| gamma delta |\n| alpha beta |\n"
+	for _, s := range []Scoring{ScoringJaccard, ScoringBM25} {
+		t.Run(string(s), func(t *testing.T) {
+			// Raw input: lines are where paragraphs start in the reader.
+			idx, err := NewIndexFromReader(strings.NewReader("alpha one\n\ngamma two\n"),
+				WithMinParagraphRunes(0), WithScoring(s), WithSource("raw.md"))
+			if err != nil {
+				t.Fatalf("build: %v", err)
+			}
+			out := idx.TopK("gamma", 1)
+			if len(out) != 1 || out[0].Line != 3 || out[0].Source != "raw.md" || out[0].DocID == "" {
+				t.Fatalf("unexpected provenance: %+v", out)
+			}
+
+			// Preprocessed input: lines map back to the original table rows.
+			p := filepath.Join(t.TempDir(), "data.md")
+			if err := os.WriteFile(p, []byte(in), 0o600); err != nil {
+				t.Fatalf("write: %v", err)
+			}
+			b, lines, err := PrepareMarkdownWithLines(p)
+			if err != nil {
+				t.Fatalf("prepare: %v", err)
+			}
+			idx, _ = NewIndexFromReader(strings.NewReader(string(b)),
+				WithMinParagraphRunes(0), WithScoring(s), WithSourceLines(lines))
+			out = idx.TopK("alpha beta", 3)
+			if len(out) != 2 || out[0].Line != 3 || out[1].Line != 5 || out[0].Source != "" {
+				t.Fatalf("unexpected provenance: %+v", out)
+			}
+			if out[0].DocID == out[1].DocID {
+				t.Fatalf("duplicate rows must get distinct ids: %+v", out)
+			}
+		})
+	}
+}
+
+func TestPrepareMarkdownWithLines_UnchangedInputHasNoLineMap(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "a.md")
+	if err := os.WriteFile(p, []byte("\n text \n"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, lines, err := PrepareMarkdownWithLines(p); err != nil || lines != nil {
+		t.Fatalf("lines = %v err = %v", lines, err)
+	}
+	if _, _, err := PrepareMarkdownWithLines(filepath.Join(t.TempDir(), "missing.md")); err == nil {
+		t.Fatalf("expected error for missing file")
+	}
+}
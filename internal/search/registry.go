@@ -0,0 +1,142 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrInvalidCorpusName is returned by Registry.Index for names that are empty,
+// absolute or escape the registry's directory.
+var ErrInvalidCorpusName = errors.New("corpus name must be a relative path inside the corpus directory")
+
+// Registry serves one Reloadable index per corpus file under a directory, so
+// several tenants can each answer from their own corpus in one process.
+// Indexes are built on first use and then kept (and reloaded) for the life
+// of the Registry. It is safe for concurrent use.
+type Registry struct {
+	dir   string
+	build func(path string) *Reloadable
+
+	mu      sync.Mutex
+	indexes map[string]*Reloadable // by cleaned name
+}
+
+// NewRegistry returns a Registry resolving corpus names under dir. build
+// creates the (not yet loaded) index for a corpus file path; it is where
+// loaders, options and OnSwap hooks are configured.
+func NewRegistry(dir string, build func(path string) *Reloadable) *Registry {
+	return &Registry{dir: dir, build: build, indexes: map[string]*Reloadable{}}
+}
+
+// Index returns the index of corpus name (a path relative to the registry's
+// directory), loading it on first use. A corpus whose first load fails is not
+// kept, so the next call retries.
+func (g *Registry) Index(name string) (Index, error) {
+	name, err := cleanCorpusName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// First loads are serialized; they happen once per corpus.
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if r, ok := g.indexes[name]; ok {
+		return r, nil
+	}
+	r := g.build(filepath.Join(g.dir, name))
+	if _, _, err := r.Reload(); err != nil {
+		return nil, fmt.Errorf("load corpus %q: %w", name, err)
+	}
+	g.indexes[name] = r
+	return r, nil
+}
+
+// Names returns the names of the loaded corpora, sorted.
+func (g *Registry) Names() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	out := make([]string, 0, len(g.indexes))
+	for n := range g.indexes {
+		out = append(out, n)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// ReloadAll reloads every loaded corpus. Failed reloads keep their previous
+// snapshot serving; their errors are joined in the result.
+func (g *Registry) ReloadAll() error {
+	var errs []error
+	for name, r := range g.snapshot() {
+		if _, _, err := r.Reload(); err != nil {
+			errs = append(errs, fmt.Errorf("reload corpus %q: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Watch polls the files of the loaded corpora every interval and reloads the
+// ones whose modification time or size changed, like Reloadable.WatchFile:
+// the first poll of each corpus always reloads. Corpora loaded after Watch
+// started are picked up on the next poll. Errors are passed to onErr with the
+// corpus name; onErr may be nil. It blocks until ctx is done.
+func (g *Registry) Watch(ctx context.Context, every time.Duration, onErr func(name string, err error)) {
+	if every <= 0 {
+		return
+	}
+	type stamp struct {
+		mod  time.Time
+		size int64
+	}
+	seen := map[string]stamp{}
+
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		for name, r := range g.snapshot() {
+			fi, err := os.Stat(filepath.Join(g.dir, name))
+			if err == nil {
+				cur := stamp{fi.ModTime(), fi.Size()}
+				prev, ok := seen[name]
+				if ok && prev.mod.Equal(cur.mod) && prev.size == cur.size {
+					continue
+				}
+				seen[name] = cur
+				_, _, err = r.Reload() // a no-op when the hash is unchanged
+			}
+			if err != nil && onErr != nil {
+				onErr(name, err)
+			}
+		}
+	}
+}
+
+// snapshot copies the loaded indexes so reloads run without holding mu.
+func (g *Registry) snapshot() map[string]*Reloadable {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	out := make(map[string]*Reloadable, len(g.indexes))
+	for n, r := range g.indexes {
+		out[n] = r
+	}
+	return out
+}
+
+// cleanCorpusName validates name and returns it in canonical form.
+func cleanCorpusName(name string) (string, error) {
+	if name == "" || !filepath.IsLocal(name) {
+		return "", ErrInvalidCorpusName
+	}
+	return filepath.Clean(name), nil
+}
@@ -0,0 +1,135 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newFileRegistry(dir string) *Registry {
+	return NewRegistry(dir, func(path string) *Reloadable {
+		return NewReloadable(func() (Corpus, error) {
+			b, err := os.ReadFile(path)
+			return Corpus{Data: b}, err
+		}, WithMinParagraphRunes(0))
+	})
+}
+
+func TestRegistry_IndexPerCorpus(t *testing.T) {
+	dir := t.TempDir()
+	for name, body := range map[string]string{"a.md": "alpha beta", "sub/b.md": "gamma delta"} {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o700); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(body), 0o600); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	g := newFileRegistry(dir)
+
+	a, err := g.Index("a.md")
+	if err != nil {
+		t.Fatalf("Index(a.md): %v", err)
+	}
+	b, err := g.Index("sub/../sub/b.md")
+	if err != nil {
+		t.Fatalf("Index(sub/b.md): %v", err)
+	}
+	// Each corpus only answers from its own documents.
+	if out := a.TopK("gamma", 1); len(out) != 0 {
+		t.Fatalf("corpus a leaked corpus b: %+v", out)
+	}
+	if out := b.TopK("gamma", 1); len(out) != 1 {
+		t.Fatalf("corpus b: %+v", out)
+	}
+	// The same (cleaned) name returns the same index.
+	if again, _ := g.Index("sub/b.md"); again != b {
+		t.Fatalf("Index did not reuse the loaded corpus")
+	}
+	if names := g.Names(); len(names) != 2 || names[0] != "a.md" || names[1] != filepath.Join("sub", "b.md") {
+		t.Fatalf("Names = %v", names)
+	}
+
+	for _, bad := range []string{"", "../a.md", "/etc/passwd", "sub/../../a.md"} {
+		if _, err := g.Index(bad); !errors.Is(err, ErrInvalidCorpusName) {
+			t.Fatalf("Index(%q) err = %v; want ErrInvalidCorpusName", bad, err)
+		}
+	}
+
+	// A missing corpus fails and is not kept, so it loads once it appears.
+	if _, err := g.Index("late.md"); err == nil {
+		t.Fatalf("expected error for missing corpus")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "late.md"), []byte("epsilon"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if _, err := g.Index("late.md"); err != nil {
+		t.Fatalf("Index(late.md) after create: %v", err)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "a.md")); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := g.ReloadAll(); err == nil {
+		t.Fatalf("ReloadAll: expected the missing a.md to be reported")
+	}
+	if out := a.TopK("alpha", 1); len(out) != 1 {
+		t.Fatalf("failed reload must keep the previous snapshot: %+v", out)
+	}
+}
+
+func TestRegistry_Watch(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "a.md")
+	if err := os.WriteFile(p, []byte("alpha beta"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	g := newFileRegistry(dir)
+	idx, err := g.Index("a.md")
+	if err != nil {
+		t.Fatalf("Index: %v", err)
+	}
+	r := idx.(*Reloadable)
+
+	errs := make(chan string, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		g.Watch(ctx, 10*time.Millisecond, func(name string, _ error) { errs <- name })
+		close(done)
+	}()
+
+	if err := os.WriteFile(p, []byte("gamma delta epsilon"), 0o600); err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for r.Version().Seq < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("watcher did not reload; version=%+v", r.Version())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := os.Remove(p); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	select {
+	case name := <-errs:
+		if name != "a.md" {
+			t.Fatalf("error reported for %q", name)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected stat error from watcher")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("Watch did not return after cancel")
+	}
+}
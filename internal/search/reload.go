@@ -0,0 +1,191 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrEmptyCorpus is returned by Reloadable.Reload when the corpus builds into
+// an index with no documents. The previously loaded index keeps serving.
+var ErrEmptyCorpus = errors.New("corpus produced no documents")
+
+// Corpus is the (already preprocessed) text to index, plus the optional
+// source line of each paragraph (see WithSourceLines).
+type Corpus struct {
+	Data  []byte
+	Lines []int
+}
+
+// CorpusLoader returns the corpus to index.
+type CorpusLoader func() (Corpus, error)
+
+// Version identifies a loaded corpus snapshot.
+type Version struct {
+	Seq      uint64    // increments on every successful swap; 0 = nothing loaded
+	Hash     string    // hex SHA-256 of the indexed corpus (text and line map)
+	Docs     int       // number of indexed paragraphs
+	LoadedAt time.Time // UTC time of the swap
+}
+
+// sizer is implemented by index types that can report their document count.
+type sizer interface {
+	Len() int
+}
+
+// Len reports the number of indexed paragraphs.
+func (i *index) Len() int { return len(i.docs) }
+
+// Len reports the number of indexed paragraphs.
+func (ix *bm25Index) Len() int { return len(ix.docs) }
+
+type snapshot struct {
+	idx Index
+	ver Version
+}
+
+// Reloadable is an Index whose underlying corpus can be rebuilt and swapped
+// atomically while queries are in flight. Readers never block: TopK always
+// runs against one complete snapshot. Reloads are serialized.
+//
+// A reload that fails to read or build, or that yields zero documents, leaves
+// the current snapshot serving. Before the first successful reload TopK
+// returns nil, like an empty index.
+type Reloadable struct {
+	load   CorpusLoader
+	opts   []Option
+	onSwap func(prev, next Version)
+
+	mu  sync.Mutex // serializes Reload
+	cur atomic.Pointer[snapshot]
+}
+
+// NewReloadable returns a Reloadable that builds its index from load using
+// opts. It does not load anything; call Reload to populate it.
+func NewReloadable(load CorpusLoader, opts ...Option) *Reloadable {
+	r := &Reloadable{load: load, opts: opts}
+	r.cur.Store(&snapshot{})
+	return r
+}
+
+// OnSwap registers fn to be called after each successful swap. It must be
+// set before the Reloadable is shared between goroutines.
+func (r *Reloadable) OnSwap(fn func(prev, next Version)) { r.onSwap = fn }
+
+// TopK delegates to the current snapshot.
+func (r *Reloadable) TopK(q string, k int) []Result {
+	s := r.cur.Load()
+	if s.idx == nil {
+		return nil
+	}
+	return s.idx.TopK(q, k)
+}
+
+// Version returns the version of the snapshot currently serving.
+func (r *Reloadable) Version() Version { return r.cur.Load().ver }
+
+// Reload reads and indexes the corpus and swaps it in. changed is false when
+// the corpus hash matches the serving snapshot (nothing is rebuilt). On error
+// the serving snapshot is left untouched and its version is returned.
+func (r *Reloadable) Reload() (v Version, changed bool, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	prev := r.cur.Load()
+	c, err := r.load()
+	if err != nil {
+		return prev.ver, false, err
+	}
+	hash := c.hash()
+	if prev.idx != nil && hash == prev.ver.Hash {
+		return prev.ver, false, nil
+	}
+
+	opts := append(r.opts[:len(r.opts):len(r.opts)], WithSourceLines(c.Lines))
+	idx, err := NewIndexFromReader(bytes.NewReader(c.Data), opts...)
+	if err != nil {
+		return prev.ver, false, err
+	}
+	n := 0
+	if s, ok := idx.(sizer); ok {
+		n = s.Len()
+	}
+	if n == 0 {
+		return prev.ver, false, ErrEmptyCorpus
+	}
+
+	next := &snapshot{
+		idx: idx,
+		ver: Version{
+			Seq:      prev.ver.Seq + 1,
+			Hash:     hash,
+			Docs:     n,
+			LoadedAt: time.Now().UTC(),
+		},
+	}
+	r.cur.Store(next)
+	if r.onSwap != nil {
+		r.onSwap(prev.ver, next.ver)
+	}
+	return next.ver, true, nil
+}
+
+// hash fingerprints the corpus text and its line map, so edits that only
+// move rows around in the source file still trigger a swap.
+func (c Corpus) hash() string {
+	h := sha256.New()
+	h.Write(c.Data)
+	var buf [8]byte
+	for _, l := range c.Lines {
+		binary.LittleEndian.PutUint64(buf[:], uint64(l))
+		h.Write(buf[:])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// WatchFile polls path every interval and calls Reload when its modification
+// time or size changes. The first poll always reloads (a no-op when the hash
+// is unchanged) so edits made before the watcher started are not missed.
+// Reload errors (and stat errors) are passed to onErr, which may be nil. It
+// blocks until ctx is done.
+func (r *Reloadable) WatchFile(ctx context.Context, path string, every time.Duration, onErr func(error)) {
+	if every <= 0 {
+		return
+	}
+	report := func(err error) {
+		if err != nil && onErr != nil {
+			onErr(err)
+		}
+	}
+
+	var lastMod time.Time
+	var lastSize int64 = -1
+
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		fi, err := os.Stat(path)
+		if err != nil {
+			report(err)
+			continue
+		}
+		if fi.ModTime().Equal(lastMod) && fi.Size() == lastSize {
+			continue
+		}
+		lastMod, lastSize = fi.ModTime(), fi.Size()
+		_, _, err = r.Reload()
+		report(err)
+	}
+}
@@ -0,0 +1,225 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memLoader returns a CorpusLoader serving whatever the test sets.
+type memLoader struct {
+	mu   sync.Mutex
+	body string
+	err  error
+}
+
+func (m *memLoader) set(body string, err error) {
+	m.mu.Lock()
+	m.body, m.err = body, err
+	m.mu.Unlock()
+}
+
+func (m *memLoader) load() (Corpus, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.err != nil {
+		return Corpus{}, m.err
+	}
+	return Corpus{Data: []byte(m.body)}, nil
+}
+
+func TestReloadable_SwapNoopAndFailuresKeepPrevious(t *testing.T) {
+	ld := &memLoader{}
+	r := NewReloadable(ld.load, WithMinParagraphRunes(0))
+
+	var swaps []Version
+	r.OnSwap(func(_, next Version) { swaps = append(swaps, next) })
+
+	// Nothing loaded yet → behaves like an empty index.
+	if out := r.TopK("alpha", 3); out != nil {
+		t.Fatalf("expected nil before first load, got %+v", out)
+	}
+	if v := r.Version(); v.Seq != 0 || v.Hash != "" {
+		t.Fatalf("unexpected initial version: %+v", v)
+	}
+
+	// First load.
+	ld.set("alpha beta\n\ngamma delta", nil)
+	v1, changed, err := r.Reload()
+	if err != nil || !changed || v1.Seq != 1 || v1.Docs != 2 || len(v1.Hash) != 64 || v1.LoadedAt.IsZero() {
+		t.Fatalf("first reload: v=%+v changed=%v err=%v", v1, changed, err)
+	}
+	if out := r.TopK("alpha", 3); len(out) != 1 || out[0].Snippet != "alpha beta" {
+		t.Fatalf("unexpected results after load: %+v", out)
+	}
+
+	// Same bytes → no-op.
+	v, changed, err := r.Reload()
+	if err != nil || changed || v != v1 {
+		t.Fatalf("identical corpus should not swap: v=%+v changed=%v err=%v", v, changed, err)
+	}
+
+	// Loader error → previous keeps serving.
+	ld.set("", errors.New("disk on fire"))
+	if v, _, err := r.Reload(); err == nil || v != v1 {
+		t.Fatalf("expected error and previous version, got v=%+v err=%v", v, err)
+	}
+
+	// Empty corpus → ErrEmptyCorpus, previous keeps serving.
+	ld.set("\n\n   \n", nil)
+	if v, _, err := r.Reload(); !errors.Is(err, ErrEmptyCorpus) || v != v1 {
+		t.Fatalf("expected ErrEmptyCorpus and previous version, got v=%+v err=%v", v, err)
+	}
+	if out := r.TopK("alpha", 3); len(out) != 1 {
+		t.Fatalf("previous index should still serve: %+v", out)
+	}
+
+	// New content → swap.
+	ld.set("epsilon zeta", nil)
+	v2, changed, err := r.Reload()
+	if err != nil || !changed || v2.Seq != 2 || v2.Hash == v1.Hash || v2.Docs != 1 {
+		t.Fatalf("second reload: v=%+v changed=%v err=%v", v2, changed, err)
+	}
+	if out := r.TopK("alpha", 3); out != nil {
+		t.Fatalf("old corpus should be gone: %+v", out)
+	}
+	if len(swaps) != 2 || swaps[0] != v1 || swaps[1] != v2 {
+		t.Fatalf("OnSwap calls unexpected: %+v", swaps)
+	}
+}
+
+func TestReloadable_ReadErrorFromReaderKeepsPrevious(t *testing.T) {
+	r := NewReloadable(func() (Corpus, error) { return Corpus{Data: []byte("alpha")}, nil }, WithMinParagraphRunes(10))
+	if _, _, err := r.Reload(); !errors.Is(err, ErrEmptyCorpus) {
+		t.Fatalf("filtered-out corpus should be empty, got %v", err)
+	}
+}
+
+func TestReloadable_ConcurrentQueriesDuringReload(t *testing.T) {
+	ld := &memLoader{}
+	ld.set("alpha beta", nil)
+	r := NewReloadable(ld.load, WithMinParagraphRunes(0), WithScoring(ScoringBM25))
+	if _, _, err := r.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				_ = r.TopK("alpha", 3)
+				_ = r.Version()
+			}
+		}()
+	}
+	for n := 0; n < 50; n++ {
+		if n%2 == 0 {
+			ld.set("alpha gamma", nil)
+		} else {
+			ld.set("alpha beta", nil)
+		}
+		if _, _, err := r.Reload(); err != nil {
+			t.Fatalf("reload %d: %v", n, err)
+		}
+	}
+	cancel()
+	wg.Wait()
+	if v := r.Version(); v.Seq != 51 {
+		t.Fatalf("expected 51 swaps, got %d", v.Seq)
+	}
+}
+
+func TestReloadable_WatchFile(t *testing.T) {
+	dir := t.TempDir()
+	p := filepath.Join(dir, "data.md")
+	if err := os.WriteFile(p, []byte("alpha beta"), 0o600); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	r := NewReloadable(func() (Corpus, error) {
+		b, err := os.ReadFile(p)
+		return Corpus{Data: b}, err
+	}, WithMinParagraphRunes(0))
+	if _, _, err := r.Reload(); err != nil {
+		t.Fatalf("initial reload: %v", err)
+	}
+
+	errs := make(chan error, 16)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		r.WatchFile(ctx, p, 10*time.Millisecond, func(err error) { errs <- err })
+		close(done)
+	}()
+
+	// Change content (and size) → picked up by the watcher.
+	if err := os.WriteFile(p, []byte("gamma delta epsilon"), 0o600); err != nil {
+		t.Fatalf("rewrite: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for r.Version().Seq < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("watcher did not reload; version=%+v", r.Version())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if out := r.TopK("gamma", 1); len(out) != 1 {
+		t.Fatalf("new corpus not serving: %+v", out)
+	}
+
+	// Removing the file surfaces a stat error but keeps serving.
+	if err := os.Remove(p); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Fatalf("expected non-nil error")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatalf("expected stat error from watcher")
+	}
+	if out := r.TopK("gamma", 1); len(out) != 1 {
+		t.Fatalf("previous corpus should keep serving: %+v", out)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("WatchFile did not return after cancel")
+	}
+
+	// Non-positive interval returns immediately.
+	r.WatchFile(context.Background(), p, 0, nil)
+}
+
+func TestReloadable_LineMapChangeSwaps(t *testing.T) {
+	lines := []int{3}
+	r := NewReloadable(func() (Corpus, error) {
+		return Corpus{Data: []byte("alpha beta"), Lines: lines}, nil
+	}, WithMinParagraphRunes(0), WithSource("data.md"))
+	v1, _, err := r.Reload()
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if out := r.TopK("alpha", 1); len(out) != 1 || out[0].Line != 3 || out[0].Source != "data.md" {
+		t.Fatalf("unexpected provenance: %+v", out)
+	}
+
+	// Same text, row moved in the source file → new snapshot with new line.
+	lines = []int{7}
+	v2, changed, err := r.Reload()
+	if err != nil || !changed || v2.Hash == v1.Hash {
+		t.Fatalf("line-only change should swap: v=%+v changed=%v err=%v", v2, changed, err)
+	}
+	if out := r.TopK("alpha", 1); out[0].Line != 7 {
+		t.Fatalf("line not updated: %+v", out)
+	}
+}
@@ -0,0 +1,83 @@
+package search
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// candidate is a scored document considered for a TopK result set.
+type candidate struct {
+	doc      int // position in the index; final tie-break keeps build order
+	ref      docRef
+	text     string
+	score    float64
+	lenRunes int
+}
+
+// better reports whether a ranks ahead of b: higher score first, then the
+// shorter snippet, then lexical order, then earlier document.
+func better(a, b candidate) bool {
+	if a.score != b.score {
+		return a.score > b.score
+	}
+	if a.lenRunes != b.lenRunes {
+		return a.lenRunes < b.lenRunes
+	}
+	if a.text != b.text {
+		return a.text < b.text
+	}
+	return a.doc < b.doc
+}
+
+// worstFirst is a heap whose root is the lowest-ranked retained candidate.
+type worstFirst []candidate
+
+func (h worstFirst) Len() int           { return len(h) }
+func (h worstFirst) Less(i, j int) bool { return better(h[j], h[i]) }
+func (h worstFirst) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *worstFirst) Push(x any)        { *h = append(*h, x.(candidate)) }
+func (h *worstFirst) Pop() any {
+	old := *h
+	n := len(old)
+	c := old[n-1]
+	*h = old[:n-1]
+	return c
+}
+
+// topK retains the k best candidates offered to it in O(n log k) time and
+// O(k) space, so scoring never has to buffer and sort every match.
+type topK struct {
+	k int
+	h worstFirst
+}
+
+func newTopK(k int) *topK {
+	return &topK{k: k, h: make(worstFirst, 0, k)}
+}
+
+// offer considers c for the result set.
+func (t *topK) offer(c candidate) {
+	if len(t.h) < t.k {
+		heap.Push(&t.h, c)
+		return
+	}
+	if better(c, t.h[0]) {
+		t.h[0] = c
+		heap.Fix(&t.h, 0)
+	}
+}
+
+// results returns the retained candidates best-first, labelled with source,
+// or nil when empty.
+func (t *topK) results(source string) []Result {
+	if len(t.h) == 0 {
+		return nil
+	}
+	cs := []candidate(t.h)
+	sort.Slice(cs, func(a, b int) bool { return better(cs[a], cs[b]) })
+	out := make([]Result, len(cs))
+	for i, c := range cs {
+		out[i] = Result{Snippet: c.text, Score: c.score, DocID: c.ref.id, Source: source, Line: c.ref.line, Fact: c.ref.fact}
+	}
+	return out
+}
@@ -0,0 +1,192 @@
+package search
+
+import (
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// ---------- topK selection ----------
+func TestTopK_HeapKeepsBestInOrder(t *testing.T) {
+	top := newTopK(2)
+	if top.results("") != nil {
+		t.Fatalf("empty selection should return nil")
+	}
+	top.offer(candidate{doc: 0, text: "ccc", score: 0.5, lenRunes: 3})
+	top.offer(candidate{doc: 1, text: "a", score: 0.9, lenRunes: 1})
+	top.offer(candidate{doc: 2, text: "bb", score: 0.5, lenRunes: 2}) // beats doc 0 on length
+	top.offer(candidate{doc: 3, text: "z", score: 0.1, lenRunes: 1})  // never retained
+
+	out := top.results("")
+	if len(out) != 2 || out[0].Snippet != "a" || out[1].Snippet != "bb" {
+		t.Fatalf("unexpected selection: %+v", out)
+	}
+}
+
+func TestBetter_TieBreakChain(t *testing.T) {
+	base := candidate{doc: 5, text: "b", score: 0.5, lenRunes: 1}
+	cases := []struct {
+		name string
+		a    candidate
+	}{
+		{"higher score", candidate{doc: 9, text: "zz", score: 0.6, lenRunes: 2}},
+		{"shorter", candidate{doc: 9, text: "", score: 0.5, lenRunes: 0}},
+		{"lexical", candidate{doc: 9, text: "a", score: 0.5, lenRunes: 1}},
+		{"earlier doc", candidate{doc: 1, text: "b", score: 0.5, lenRunes: 1}},
+	}
+	for _, tc := range cases {
+		if !better(tc.a, base) || better(base, tc.a) {
+			t.Fatalf("%s: expected %+v to rank ahead of %+v", tc.name, tc.a, base)
+		}
+	}
+}
+
+// ---------- Postings-based TopK matches a full scan ----------
+
+// scanTopK is the pre-postings algorithm: score every doc, sort the whole
+// buffer. It is the reference for equivalence tests and benchmarks.
+func scanTopK(i *index, q string, k int) []Result {
+	qTokens := tokenize(q, i.cfg.stopwords)
+	if len(qTokens) == 0 {
+		return nil
+	}
+	type scored struct {
+		ref      docRef
+		snippet  string
+		score    float64
+		lenRunes int
+	}
+	var buf []scored
+	for _, d := range i.docs {
+		over := 0
+		for term := range qTokens {
+			if _, ok := d.tokens[term]; ok {
+				over++
+			}
+		}
+		if over == 0 {
+			continue
+		}
+		buf = append(buf, scored{
+			ref:      d.docRef,
+			snippet:  d.text,
+			score:    float64(over) / float64(len(qTokens)+d.tLen-over),
+			lenRunes: utf8.RuneCountInString(d.text),
+		})
+	}
+	sort.SliceStable(buf, func(a, b int) bool {
+		if buf[a].score != buf[b].score {
+			return buf[a].score > buf[b].score
+		}
+		if buf[a].lenRunes != buf[b].lenRunes {
+			return buf[a].lenRunes < buf[b].lenRunes
+		}
+		return buf[a].snippet < buf[b].snippet
+	})
+	if k > len(buf) {
+		k = len(buf)
+	}
+	out := make([]Result, k)
+	for j := 0; j < k; j++ {
+		out[j] = Result{Snippet: buf[j].snippet, Score: buf[j].score, DocID: buf[j].ref.id, Source: i.cfg.source, Line: buf[j].ref.line, Fact: buf[j].ref.fact}
+	}
+	return out
+}
+
+var benchQueries = []string{
+	"What percentage of Gen Z in Nashville discover new brands through podcasts?",
+	"Are Gen Z in Nashville interested in Esports?",
+	"How many use Instagram more than once a day?",
+	"investments",
+}
+
+// loadCorpusParagraphs returns the shipped corpus as index paragraphs,
+// skipping the calling test/benchmark if the file is unavailable.
+func loadCorpusParagraphs(tb testing.TB) []string {
+	tb.Helper()
+	const path = "../../data/data.md"
+	if _, err := os.Stat(path); err != nil {
+		tb.Skipf("corpus not available: %v", err)
+	}
+	b, err := PrepareMarkdownInMemory(path)
+	if err != nil {
+		tb.Fatalf("prepare corpus: %v", err)
+	}
+	return splitParasFromBytes(b)
+}
+
+func TestTopK_PostingsMatchFullScan_OnCorpus(t *testing.T) {
+	paras := loadCorpusParagraphs(t)
+	ii := buildIndex(paras, func() config { c := defaultConfig(); c.minParagraphRunes = 1; return c }())
+
+	for _, q := range benchQueries {
+		for _, k := range []int{1, 3, 10, 50} {
+			got := ii.TopK(q, k)
+			want := scanTopK(ii, q, k)
+			if len(got) != len(want) {
+				t.Fatalf("%q k=%d: len %d != %d", q, k, len(got), len(want))
+			}
+			for j := range got {
+				if got[j] != want[j] {
+					t.Fatalf("%q k=%d: result %d differs:\n got  %+v\n want %+v", q, k, j, got[j], want[j])
+				}
+			}
+		}
+	}
+}
+
+func TestTopK_Deterministic_WithDuplicateParagraphs(t *testing.T) {
+	paras := []string{"alpha beta", "alpha beta", "alpha gamma"}
+	idx := NewIndexFromStrings(paras, WithMinParagraphRunes(0))
+	first := idx.TopK("alpha beta", 3)
+	for n := 0; n < 20; n++ {
+		again := idx.TopK("alpha beta", 3)
+		for j := range first {
+			if again[j] != first[j] {
+				t.Fatalf("non-deterministic results: %+v vs %+v", first, again)
+			}
+		}
+	}
+}
+
+// ---------- Benchmarks (shipped corpus) ----------
+
+func BenchmarkTopK_Corpus(b *testing.B) {
+	paras := loadCorpusParagraphs(b)
+	opts := []Option{WithMinParagraphRunes(1)}
+	jac := NewIndexFromStrings(paras, opts...).(*index)
+	bm := NewIndexFromStrings(paras, append(opts, WithScoring(ScoringBM25))...)
+
+	b.Run("scan", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			scanTopK(jac, benchQueries[n%len(benchQueries)], 10)
+		}
+	})
+	b.Run("jaccard", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			jac.TopK(benchQueries[n%len(benchQueries)], 10)
+		}
+	})
+	b.Run("bm25", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			bm.TopK(benchQueries[n%len(benchQueries)], 10)
+		}
+	})
+}
+
+func BenchmarkBuildIndex_Corpus(b *testing.B) {
+	paras := loadCorpusParagraphs(b)
+	for _, s := range []Scoring{ScoringJaccard, ScoringBM25} {
+		b.Run(strings.ToLower(string(s)), func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				NewIndexFromStrings(paras, WithMinParagraphRunes(1), WithScoring(s))
+			}
+		})
+	}
+}
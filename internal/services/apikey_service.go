@@ -0,0 +1,179 @@
+// Package services – APIKeyService
+//
+// This file implements the APIKeyService, which issues, lists, revokes and
+// verifies API keys for server-to-server callers. Secrets are generated and
+// hashed by the auth package; only the hash is persisted and the key itself
+// is returned exactly once, from Create.
+//
+// Keys act as their owner, limited to their scopes (enforced per route by
+// middleware.RequireScope). The admin scope can only be granted by admins.
+package services
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	zlog "github.com/rs/zerolog/log"
+	"gorm.io/gorm"
+
+	"github.com/tbourn/go-chat-backend/internal/auth"
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/repo"
+)
+
+// defaultTouchInterval is how stale LastUsedAt may get before Verify writes it.
+const defaultTouchInterval = time.Minute
+
+// APIKeyService manages API keys. It is safe for concurrent use.
+type APIKeyService struct {
+	// DB is the GORM handle used for persistence.
+	DB *gorm.DB
+
+	// TouchInterval throttles LastUsedAt updates so that busy keys do not
+	// cost a write per request; 0 uses one minute.
+	TouchInterval time.Duration
+
+	// now returns the current time; tests override it.
+	now func() time.Time
+}
+
+// NewAPIKeyService constructs an APIKeyService with default settings.
+func NewAPIKeyService(db *gorm.DB) *APIKeyService {
+	return &APIKeyService{DB: db}
+}
+
+// Create issues a key for the caller with the given name, scopes and
+// optional expiry. It returns the stored key and the secret key string,
+// which cannot be recovered later.
+//
+// Errors: ErrInvalidScope for empty or unknown scopes, ErrScopeNotAllowed
+// when a non-admin asks for the admin scope, ErrInvalidExpiry when
+// expiresAt is not in the future.
+func (s *APIKeyService) Create(ctx context.Context, caller Caller, name string, scopes []string, expiresAt *time.Time) (*domain.APIKey, string, error) {
+	scopes, err := normalizeScopes(scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	if !caller.Admin && auth.HasScope(scopes, auth.ScopeAdmin) {
+		return nil, "", ErrScopeNotAllowed
+	}
+	now := s.clock()
+	if expiresAt != nil {
+		if !expiresAt.After(now) {
+			return nil, "", ErrInvalidExpiry
+		}
+		t := expiresAt.UTC()
+		expiresAt = &t
+	}
+
+	secret, prefix, err := auth.NewAPIKey()
+	if err != nil {
+		return nil, "", err
+	}
+	k := &domain.APIKey{
+		ID:         uuid.NewString(),
+		UserID:     caller.UserID,
+		Name:       strings.TrimSpace(name),
+		Prefix:     prefix,
+		SecretHash: auth.HashAPIKey(secret),
+		Scopes:     strings.Join(scopes, " "),
+		ExpiresAt:  expiresAt,
+		CreatedAt:  now,
+	}
+	if err := repo.CreateAPIKey(ctx, s.DB, k); err != nil {
+		return nil, "", err
+	}
+	return k, secret, nil
+}
+
+// List returns the caller's keys, including revoked and expired ones,
+// newest first.
+func (s *APIKeyService) List(ctx context.Context, caller Caller) ([]domain.APIKey, error) {
+	return repo.ListAPIKeys(ctx, s.DB, caller.UserID)
+}
+
+// Revoke revokes key id. Owners may revoke their own keys and admins any
+// key; everyone else gets ErrAPIKeyNotFound. Revoking twice is a no-op.
+func (s *APIKeyService) Revoke(ctx context.Context, caller Caller, id string) error {
+	k, err := repo.FindAPIKey(ctx, s.DB, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrAPIKeyNotFound
+		}
+		return err
+	}
+	if !caller.Admin && (caller.UserID == "" || k.UserID != caller.UserID) {
+		return ErrAPIKeyNotFound
+	}
+	return repo.RevokeAPIKey(ctx, s.DB, k.ID, s.clock())
+}
+
+// Verify resolves a presented key string to its active key record. Unknown,
+// malformed, revoked and expired keys all return auth.ErrInvalidAPIKey.
+// LastUsedAt is refreshed at most once per TouchInterval.
+func (s *APIKeyService) Verify(ctx context.Context, key string) (*domain.APIKey, error) {
+	prefix, ok := auth.APIKeyPrefix(key)
+	if !ok {
+		return nil, auth.ErrInvalidAPIKey
+	}
+	k, err := repo.FindAPIKeyByPrefix(ctx, s.DB, prefix)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, auth.ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+	now := s.clock()
+	if !auth.APIKeyMatches(key, k.SecretHash) || !k.Active(now) {
+		return nil, auth.ErrInvalidAPIKey
+	}
+
+	interval := s.TouchInterval
+	if interval <= 0 {
+		interval = defaultTouchInterval
+	}
+	if k.LastUsedAt == nil || now.Sub(*k.LastUsedAt) >= interval {
+		// last_used_at is informational; a key that authenticated is not
+		// rejected because the timestamp could not be written.
+		if err := repo.TouchAPIKey(ctx, s.DB, k.ID, now); err != nil {
+			zlog.Warn().Err(err).Str("api_key.id", k.ID).Msg("api key last_used_at update failed")
+		} else {
+			k.LastUsedAt = &now
+		}
+	}
+	return k, nil
+}
+
+// clock returns the current UTC time.
+func (s *APIKeyService) clock() time.Time {
+	if s.now != nil {
+		return s.now().UTC()
+	}
+	return time.Now().UTC()
+}
+
+// normalizeScopes trims, validates, de-duplicates and sorts scopes.
+func normalizeScopes(in []string) ([]string, error) {
+	seen := make(map[string]struct{}, len(in))
+	out := make([]string, 0, len(in))
+	for _, sc := range in {
+		sc = strings.TrimSpace(sc)
+		if !auth.ValidScope(sc) {
+			return nil, ErrInvalidScope
+		}
+		if _, dup := seen[sc]; dup {
+			continue
+		}
+		seen[sc] = struct{}{}
+		out = append(out, sc)
+	}
+	if len(out) == 0 {
+		return nil, ErrInvalidScope
+	}
+	sort.Strings(out)
+	return out, nil
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tbourn/go-chat-backend/internal/auth"
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/repo"
+)
+
+func newAPIKeyService(t *testing.T) (*APIKeyService, *time.Time) {
+	t.Helper()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	s := NewAPIKeyService(newMsgDB(t, &domain.APIKey{}))
+	s.now = func() time.Time { return now }
+	return s, &now
+}
+
+func TestAPIKeyService_CreateValidation(t *testing.T) {
+	s, now := newAPIKeyService(t)
+	ctx := context.Background()
+	user := Caller{UserID: "u1"}
+	past := now.Add(-time.Second)
+
+	cases := []struct {
+		name    string
+		caller  Caller
+		scopes  []string
+		expires *time.Time
+		want    error
+	}{
+		{"no scopes", user, nil, nil, ErrInvalidScope},
+		{"blank scope", user, []string{" "}, nil, ErrInvalidScope},
+		{"unknown scope", user, []string{"chats:read", "chats:*"}, nil, ErrInvalidScope},
+		{"admin scope by user", user, []string{"admin"}, nil, ErrScopeNotAllowed},
+		{"expiry in the past", user, []string{"chats:read"}, &past, ErrInvalidExpiry},
+		{"expiry now", user, []string{"chats:read"}, now, ErrInvalidExpiry},
+		{"admin scope by admin", Caller{UserID: "root", Admin: true}, []string{"admin"}, nil, nil},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := s.Create(ctx, tc.caller, "k", tc.scopes, tc.expires)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("err = %v; want %v", err, tc.want)
+			}
+		})
+	}
+}
+
+func TestAPIKeyService_CreateVerifyList(t *testing.T) {
+	s, now := newAPIKeyService(t)
+	ctx := context.Background()
+	user := Caller{UserID: "u1"}
+
+	exp := now.Add(time.Hour)
+	k, secret, err := s.Create(ctx, user, "  batch job ", []string{"messages:write", "chats:read", "chats:read"}, &exp)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if k.Name != "batch job" || k.Scopes != "chats:read messages:write" || k.UserID != "u1" {
+		t.Fatalf("unexpected key: %+v", k)
+	}
+	if k.SecretHash == secret || k.SecretHash != auth.HashAPIKey(secret) {
+		t.Fatalf("secret must be stored hashed")
+	}
+
+	got, err := s.Verify(ctx, secret)
+	if err != nil || got.ID != k.ID {
+		t.Fatalf("Verify = %+v, %v", got, err)
+	}
+	stored, _ := repo.FindAPIKey(ctx, s.DB, k.ID)
+	if stored.LastUsedAt == nil || !stored.LastUsedAt.Equal(*now) {
+		t.Fatalf("LastUsedAt = %v; want %v", stored.LastUsedAt, *now)
+	}
+
+	// Within the touch interval the timestamp is not rewritten.
+	*now = now.Add(30 * time.Second)
+	if _, err := s.Verify(ctx, secret); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	stored, _ = repo.FindAPIKey(ctx, s.DB, k.ID)
+	if stored.LastUsedAt.Equal(*now) {
+		t.Fatalf("LastUsedAt rewritten within the touch interval")
+	}
+
+	// Tampered, unknown and malformed keys are all ErrInvalidAPIKey.
+	other, _, _ := auth.NewAPIKey()
+	tampered := secret[:len(secret)-1] + "A"
+	if tampered == secret {
+		tampered = secret[:len(secret)-1] + "B"
+	}
+	for _, bad := range []string{tampered, other, "not-a-key", ""} {
+		if _, err := s.Verify(ctx, bad); !errors.Is(err, auth.ErrInvalidAPIKey) {
+			t.Fatalf("Verify(%q) err = %v; want ErrInvalidAPIKey", bad, err)
+		}
+	}
+
+	// Expired keys stop working.
+	*now = exp
+	if _, err := s.Verify(ctx, secret); !errors.Is(err, auth.ErrInvalidAPIKey) {
+		t.Fatalf("expired key: err = %v", err)
+	}
+
+	keys, err := s.List(ctx, user)
+	if err != nil || len(keys) != 1 || keys[0].ID != k.ID {
+		t.Fatalf("List = %+v, %v", keys, err)
+	}
+	if keys, _ := s.List(ctx, Caller{UserID: "u2"}); len(keys) != 0 {
+		t.Fatalf("other user's list = %+v", keys)
+	}
+}
+
+func TestAPIKeyService_Revoke(t *testing.T) {
+	s, _ := newAPIKeyService(t)
+	ctx := context.Background()
+	owner := Caller{UserID: "u1"}
+
+	k, secret, err := s.Create(ctx, owner, "", []string{"chats:read"}, nil)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := s.Revoke(ctx, Caller{UserID: "mallory"}, k.ID); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Fatalf("stranger revoke: err = %v", err)
+	}
+	if err := s.Revoke(ctx, owner, "missing"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Fatalf("missing key: err = %v", err)
+	}
+	if err := s.Revoke(ctx, owner, k.ID); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if err := s.Revoke(ctx, owner, k.ID); err != nil {
+		t.Fatalf("second Revoke: %v", err)
+	}
+	if _, err := s.Verify(ctx, secret); !errors.Is(err, auth.ErrInvalidAPIKey) {
+		t.Fatalf("revoked key: err = %v", err)
+	}
+
+	k2, _, _ := s.Create(ctx, owner, "", []string{"chats:read"}, nil)
+	if err := s.Revoke(ctx, Caller{UserID: "root", Admin: true}, k2.ID); err != nil {
+		t.Fatalf("admin Revoke: %v", err)
+	}
+}
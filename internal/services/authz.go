@@ -0,0 +1,118 @@
+// Package services – authorization
+//
+// This file centralizes the access policy for chats. Every service method that
+// touches an existing chat (or something inside it) resolves the chat through
+// authorizeChat, so ownership, sharing and the admin override are enforced in
+// one place rather than per handler.
+//
+// Policy:
+//   - Chats are looked up in the caller's workspace only; a chat of another
+//     workspace is indistinguishable from a missing one (ErrChatNotFound),
+//     for admins too. Workspace membership itself is checked before the
+//     service is reached (see WorkspaceService.Role).
+//   - The owner and admins may do anything.
+//   - Users the chat is shared with may read it and post messages/feedback,
+//     but managing it (rename, delete, restore, sharing) returns ErrForbidden.
+//   - Everyone else gets ErrChatNotFound, so the existence of other users'
+//     chats is never revealed.
+package services
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/repo"
+)
+
+// Caller identifies who a service call is made on behalf of.
+type Caller struct {
+	// UserID is the authenticated user.
+	UserID string
+	// Admin grants access to every chat regardless of owner or shares.
+	Admin bool
+	// WorkspaceID is the workspace the call operates in; empty means
+	// domain.DefaultWorkspaceID.
+	WorkspaceID string
+}
+
+// Workspace returns the workspace the call operates in.
+func (c Caller) Workspace() string {
+	if c.WorkspaceID == "" {
+		return domain.DefaultWorkspaceID
+	}
+	return c.WorkspaceID
+}
+
+// Access is the kind of operation being authorized on a chat.
+type Access int
+
+const (
+	// AccessRead covers reading a chat and its messages.
+	AccessRead Access = iota
+	// AccessWrite covers posting messages and leaving feedback.
+	AccessWrite
+	// AccessManage covers renaming, deleting, restoring and sharing a chat.
+	AccessManage
+)
+
+// ChatLookup is the repository contract the authorization policy needs.
+type ChatLookup interface {
+	// FindChat fetches a live chat of the workspace by ID regardless of its owner.
+	FindChat(ctx context.Context, db *gorm.DB, workspaceID, id string) (*domain.Chat, error)
+
+	// IsChatSharedWith reports whether the chat is shared with userID.
+	IsChatSharedWith(ctx context.Context, db *gorm.DB, chatID, userID string) (bool, error)
+}
+
+// repoLookup implements ChatLookup over the repo package.
+type repoLookup struct{}
+
+func (repoLookup) FindChat(ctx context.Context, db *gorm.DB, workspaceID, id string) (*domain.Chat, error) {
+	return repo.FindChat(ctx, db, workspaceID, id)
+}
+
+func (repoLookup) IsChatSharedWith(ctx context.Context, db *gorm.DB, chatID, userID string) (bool, error) {
+	return repo.IsChatSharedWith(ctx, db, chatID, userID)
+}
+
+// authorizeChat loads the live chat chatID of the caller's workspace and
+// checks that caller may perform access on it. It returns ErrChatNotFound for
+// missing chats and for chats the caller cannot see at all.
+func authorizeChat(ctx context.Context, db *gorm.DB, l ChatLookup, caller Caller, chatID string, access Access) (*domain.Chat, error) {
+	chat, err := l.FindChat(ctx, db, caller.Workspace(), chatID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrChatNotFound
+		}
+		return nil, err
+	}
+	if err := checkAccess(ctx, db, l, caller, chat, access); err != nil {
+		return nil, err
+	}
+	return chat, nil
+}
+
+// checkAccess applies the policy described in the file comment to an already
+// loaded chat.
+func checkAccess(ctx context.Context, db *gorm.DB, l ChatLookup, caller Caller, chat *domain.Chat, access Access) error {
+	if caller.Admin || (caller.UserID != "" && chat.UserID == caller.UserID) {
+		return nil
+	}
+	if caller.UserID == "" {
+		return ErrChatNotFound
+	}
+	shared, err := l.IsChatSharedWith(ctx, db, chat.ID, caller.UserID)
+	if err != nil {
+		return err
+	}
+	if !shared {
+		return ErrChatNotFound
+	}
+	if access == AccessManage {
+		return ErrForbidden
+	}
+	return nil
+}
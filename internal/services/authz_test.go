@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/repo"
+)
+
+func TestAuthorizeChat_Policy(t *testing.T) {
+	db := newMsgDB(t, &domain.Chat{}, &domain.ChatShare{})
+	ctx := context.Background()
+	if err := db.Create(&domain.Chat{ID: "c1", UserID: "owner", Title: "t"}).Error; err != nil {
+		t.Fatalf("seed chat: %v", err)
+	}
+	if err := repo.ShareChat(ctx, db, "c1", "friend"); err != nil {
+		t.Fatalf("share: %v", err)
+	}
+
+	owner := Caller{UserID: "owner"}
+	friend := Caller{UserID: "friend"}
+	admin := Caller{UserID: "root", Admin: true}
+	stranger := Caller{UserID: "mallory"}
+	anonymous := Caller{}
+
+	cases := []struct {
+		name   string
+		caller Caller
+		chatID string
+		access Access
+		want   error
+	}{
+		{"owner read", owner, "c1", AccessRead, nil},
+		{"owner write", owner, "c1", AccessWrite, nil},
+		{"owner manage", owner, "c1", AccessManage, nil},
+		{"shared read", friend, "c1", AccessRead, nil},
+		{"shared write", friend, "c1", AccessWrite, nil},
+		{"shared manage", friend, "c1", AccessManage, ErrForbidden},
+		{"admin manage", admin, "c1", AccessManage, nil},
+		{"stranger read", stranger, "c1", AccessRead, ErrChatNotFound},
+		{"stranger manage", stranger, "c1", AccessManage, ErrChatNotFound},
+		{"anonymous read", anonymous, "c1", AccessRead, ErrChatNotFound},
+		{"missing chat", owner, "nope", AccessRead, ErrChatNotFound},
+		{"missing chat admin", admin, "nope", AccessRead, ErrChatNotFound},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			chat, err := authorizeChat(ctx, db, repoLookup{}, tc.caller, tc.chatID, tc.access)
+			if !errors.Is(err, tc.want) {
+				t.Fatalf("err = %v; want %v", err, tc.want)
+			}
+			if tc.want == nil && (chat == nil || chat.UserID != "owner") {
+				t.Fatalf("chat = %+v; want owner's chat", chat)
+			}
+		})
+	}
+}
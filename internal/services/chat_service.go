@@ -1,10 +1,13 @@
 // Package services – ChatService
 //
 // This file implements the ChatService, which manages the lifecycle of chats.
-// It validates and normalizes titles, enforces ownership rules, and coordinates
-// repository operations for creating, listing (with pagination), and updating
-// chats. Title handling is intentionally minimal here because automatic title
-// generation is performed in MessageService on the first user message.
+// It validates and normalizes titles, enforces the access policy (see authz.go),
+// and coordinates repository operations for reading, creating, listing (with
+// pagination), updating, deleting, restoring and sharing chats. Renames and
+// deletes can be made conditional on the chat's version (optimistic
+// concurrency, see ErrVersionConflict). Title handling is intentionally
+// minimal here because automatic title generation is performed in
+// MessageService on the first user message.
 //
 // Service-level errors (e.g., ErrChatNotFound) are returned for predictable
 // cases so handlers can map them to HTTP results consistently.
@@ -15,34 +18,60 @@ import (
 	"errors"
 	"regexp"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"gorm.io/gorm"
 
 	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/pagination"
 	"golang.org/x/text/language"
 )
 
 // ChatRepo defines the repository contract required by ChatService.
 // Implementations are responsible for persistence of chat aggregates.
 type ChatRepo interface {
-	// CreateChat inserts a new chat row for the given user.
-	CreateChat(ctx context.Context, db *gorm.DB, userID, title string) (*domain.Chat, error)
+	// ChatLookup resolves chats for the authorization policy.
+	ChatLookup
 
-	// ListChats returns all chats belonging to the user (non-paginated).
-	ListChats(ctx context.Context, db *gorm.DB, userID string) ([]domain.Chat, error)
+	// CreateChat inserts a new chat row in the workspace for the given user.
+	CreateChat(ctx context.Context, db *gorm.DB, workspaceID, userID, title string) (*domain.Chat, error)
 
-	// GetChat fetches a chat by ID ensuring it belongs to the user.
-	GetChat(ctx context.Context, db *gorm.DB, id, userID string) (*domain.Chat, error)
+	// ListChats returns all of the user's chats in the workspace (non-paginated).
+	ListChats(ctx context.Context, db *gorm.DB, workspaceID, userID string) ([]domain.Chat, error)
 
-	// UpdateChatTitle updates a chat’s title (only if it belongs to the user).
-	UpdateChatTitle(ctx context.Context, db *gorm.DB, id, userID, title string) error
+	// UpdateChatTitle updates a chat’s title (only if it belongs to the user
+	// and, when version > 0, is still at that version).
+	UpdateChatTitle(ctx context.Context, db *gorm.DB, workspaceID, id, userID, title string, version int64) error
 
 	// CountChats returns the total number of chats for pagination.
-	CountChats(ctx context.Context, db *gorm.DB, userID string) (int64, error)
+	CountChats(ctx context.Context, db *gorm.DB, workspaceID, userID string) (int64, error)
 
-	// ListChatsPage returns a page of chats belonging to the user.
-	ListChatsPage(ctx context.Context, db *gorm.DB, userID string, offset, limit int) ([]domain.Chat, error)
+	// ListChatsPage returns a page of the user's chats in the workspace.
+	ListChatsPage(ctx context.Context, db *gorm.DB, workspaceID, userID string, offset, limit int) ([]domain.Chat, error)
+
+	// ListChatsKeyset returns a keyset page of the user's chats in the
+	// workspace and whether more follow in the paging direction.
+	ListChatsKeyset(ctx context.Context, db *gorm.DB, workspaceID, userID string, p pagination.Page) ([]domain.Chat, bool, error)
+
+	// DeleteChat soft-deletes a chat (and its messages and feedback) at the
+	// given time, with the same version check as UpdateChatTitle.
+	DeleteChat(ctx context.Context, db *gorm.DB, workspaceID, id, userID string, version int64, at time.Time) error
+
+	// FindDeletedChat fetches a soft-deleted chat of the workspace regardless of its owner.
+	FindDeletedChat(ctx context.Context, db *gorm.DB, workspaceID, id string) (*domain.Chat, error)
+
+	// RestoreChat undoes the deletion of a chat deleted at deletedAt.
+	RestoreChat(ctx context.Context, db *gorm.DB, workspaceID, id, userID string, deletedAt time.Time) error
+
+	// ShareChat grants userID access to the chat; sharing twice is a no-op.
+	ShareChat(ctx context.Context, db *gorm.DB, chatID, userID string) error
+
+	// UnshareChat revokes userID's access to the chat.
+	UnshareChat(ctx context.Context, db *gorm.DB, chatID, userID string) error
+
+	// ListChatShares returns the users the chat is shared with.
+	ListChatShares(ctx context.Context, db *gorm.DB, chatID string) ([]domain.ChatShare, error)
 }
 
 // ChatService provides chat-level operations such as creating,
@@ -58,6 +87,10 @@ type ChatService struct {
 	TitleMaxLen int
 	// TitleLocale is retained for compatibility; auto-titling is handled in MessageService.
 	TitleLocale language.Tag
+
+	// RestoreWindow is how long after deletion a chat can be restored;
+	// 0 allows restoring until the chat is purged.
+	RestoreWindow time.Duration
 }
 
 // NewChatService constructs a ChatService with sane defaults for title handling.
@@ -70,25 +103,26 @@ func NewChatService(db *gorm.DB, r ChatRepo) *ChatService {
 	}
 }
 
-// Create inserts a new chat owned by userID with the provided title.
+// Create inserts a new chat owned by the caller, in the caller's workspace,
+// with the provided title.
 // Titles are normalized, trimmed, clipped, and a default fallback is applied.
-func (s *ChatService) Create(ctx context.Context, userID, title string) (*domain.Chat, error) {
+func (s *ChatService) Create(ctx context.Context, caller Caller, title string) (*domain.Chat, error) {
 	title = normalizeTitle(title)
 	if title == "" {
 		title = "New chat"
 	}
-	return s.Repo.CreateChat(ctx, s.DB, userID, s.clip(title))
+	return s.Repo.CreateChat(ctx, s.DB, caller.Workspace(), caller.UserID, s.clip(title))
 }
 
-// List returns all chats for a user (non-paginated).
+// List returns all chats owned by the caller (non-paginated).
 // Prefer ListPage for scalability on large datasets.
-func (s *ChatService) List(ctx context.Context, userID string) ([]domain.Chat, error) {
-	return s.Repo.ListChats(ctx, s.DB, userID)
+func (s *ChatService) List(ctx context.Context, caller Caller) ([]domain.Chat, error) {
+	return s.Repo.ListChats(ctx, s.DB, caller.Workspace(), caller.UserID)
 }
 
-// ListPage returns a page of chats for a user (paginated).
+// ListPage returns a page of chats owned by the caller (paginated).
 // It applies defaults for invalid page/pageSize and returns total count.
-func (s *ChatService) ListPage(ctx context.Context, userID string, page, pageSize int) ([]domain.Chat, int64, error) {
+func (s *ChatService) ListPage(ctx context.Context, caller Caller, page, pageSize int) ([]domain.Chat, int64, error) {
 	if page < 1 {
 		page = 1
 	}
@@ -97,7 +131,7 @@ func (s *ChatService) ListPage(ctx context.Context, userID string, page, pageSiz
 	}
 	offset := (page - 1) * pageSize
 
-	total, err := s.Repo.CountChats(ctx, s.DB, userID)
+	total, err := s.Repo.CountChats(ctx, s.DB, caller.Workspace(), caller.UserID)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -105,25 +139,152 @@ func (s *ChatService) ListPage(ctx context.Context, userID string, page, pageSiz
 		return []domain.Chat{}, 0, nil
 	}
 
-	items, err := s.Repo.ListChatsPage(ctx, s.DB, userID, offset, pageSize)
+	items, err := s.Repo.ListChatsPage(ctx, s.DB, caller.Workspace(), caller.UserID, offset, pageSize)
 	return items, total, err
 }
 
-// UpdateTitle updates a chat’s title, ensuring the chat exists and
-// belongs to the given user. Falls back to "Untitled" if title is blank.
-func (s *ChatService) UpdateTitle(ctx context.Context, userID, chatID, title string) error {
+// Get returns a chat the caller may read.
+func (s *ChatService) Get(ctx context.Context, caller Caller, chatID string) (*domain.Chat, error) {
+	return s.authorize(ctx, caller, chatID, AccessRead)
+}
+
+// ListKeyset returns a keyset page of chats owned by the caller and whether
+// more follow in the paging direction. Unlike ListPage it runs no COUNT, and
+// pages do not shift when chats are created in between.
+func (s *ChatService) ListKeyset(ctx context.Context, caller Caller, p pagination.Page) ([]domain.Chat, bool, error) {
+	if p.Limit <= 0 {
+		p.Limit = 20
+	}
+	items, more, err := s.Repo.ListChatsKeyset(ctx, s.DB, caller.Workspace(), caller.UserID, p)
+	if items == nil && err == nil {
+		items = []domain.Chat{}
+	}
+	return items, more, err
+}
+
+// UpdateTitle updates a chat’s title, ensuring the chat exists and the
+// caller may manage it, and returns the updated chat. Falls back to
+// "Untitled" if title is blank. When version > 0 the rename only applies if
+// the chat is still at that version; otherwise it returns ErrVersionConflict.
+func (s *ChatService) UpdateTitle(ctx context.Context, caller Caller, chatID, title string, version int64) (*domain.Chat, error) {
 	title = normalizeTitle(title)
 	if title == "" {
 		title = "Untitled"
 	}
-	// Ensure the chat exists and belongs to the user.
-	if _, err := s.Repo.GetChat(ctx, s.DB, chatID, userID); err != nil {
+	chat, err := s.authorize(ctx, caller, chatID, AccessManage)
+	if err != nil {
+		return nil, err
+	}
+	if version > 0 && chat.Version != version {
+		return nil, ErrVersionConflict
+	}
+	err = s.Repo.UpdateChatTitle(ctx, s.DB, chat.WorkspaceID, chatID, chat.UserID, s.clip(title), version)
+	if err != nil {
+		return nil, versionErr(err, version)
+	}
+	chat, err = s.Repo.FindChat(ctx, s.DB, chat.WorkspaceID, chatID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrChatNotFound
+	}
+	return chat, err
+}
+
+// Delete soft-deletes a chat, together with its messages and their feedback.
+// It returns ErrChatNotFound if the chat does not exist, is already deleted
+// or is not visible to the caller, and ErrForbidden for shared users. When
+// version > 0 the chat must still be at that version; otherwise it returns
+// ErrVersionConflict.
+func (s *ChatService) Delete(ctx context.Context, caller Caller, chatID string, version int64) error {
+	chat, err := s.authorize(ctx, caller, chatID, AccessManage)
+	if err != nil {
+		return err
+	}
+	if version > 0 && chat.Version != version {
+		return ErrVersionConflict
+	}
+	err = s.Repo.DeleteChat(ctx, s.DB, chat.WorkspaceID, chatID, chat.UserID, version, time.Now().UTC())
+	if err != nil {
+		return versionErr(err, version)
+	}
+	return nil
+}
+
+// Restore undoes Delete and returns the restored chat. Restoring a chat that
+// is not deleted returns it unchanged, so retries are harmless. It returns
+// ErrChatNotFound for unknown chats and ErrRestoreExpired once RestoreWindow
+// has passed since the deletion.
+func (s *ChatService) Restore(ctx context.Context, caller Caller, chatID string) (*domain.Chat, error) {
+	deleted, err := s.Repo.FindDeletedChat(ctx, s.DB, caller.Workspace(), chatID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return s.authorize(ctx, caller, chatID, AccessManage)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := checkAccess(ctx, s.DB, s.Repo, caller, deleted, AccessManage); err != nil {
+		return nil, err
+	}
+	if s.RestoreWindow > 0 && time.Since(deleted.DeletedAt.Time) > s.RestoreWindow {
+		return nil, ErrRestoreExpired
+	}
+	if err := s.Repo.RestoreChat(ctx, s.DB, deleted.WorkspaceID, chatID, deleted.UserID, deleted.DeletedAt.Time); err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return ErrChatNotFound
+			return nil, ErrChatNotFound
 		}
+		return nil, err
+	}
+	return s.Repo.FindChat(ctx, s.DB, deleted.WorkspaceID, chatID)
+}
+
+// Share grants userID read and write access to a chat the caller manages.
+// Sharing with the owner, or with an empty or overlong user ID, returns
+// ErrInvalidShare.
+func (s *ChatService) Share(ctx context.Context, caller Caller, chatID, userID string) error {
+	chat, err := s.authorize(ctx, caller, chatID, AccessManage)
+	if err != nil {
 		return err
 	}
-	return s.Repo.UpdateChatTitle(ctx, s.DB, chatID, userID, s.clip(title))
+	userID = strings.TrimSpace(userID)
+	if userID == "" || utf8.RuneCountInString(userID) > maxShareUserIDLen || userID == chat.UserID {
+		return ErrInvalidShare
+	}
+	return s.Repo.ShareChat(ctx, s.DB, chatID, userID)
+}
+
+// Unshare revokes userID's access to a chat the caller manages. Revoking a
+// share that does not exist is not an error.
+func (s *ChatService) Unshare(ctx context.Context, caller Caller, chatID, userID string) error {
+	if _, err := s.authorize(ctx, caller, chatID, AccessManage); err != nil {
+		return err
+	}
+	return s.Repo.UnshareChat(ctx, s.DB, chatID, strings.TrimSpace(userID))
+}
+
+// ListShares returns the users a chat the caller manages is shared with.
+func (s *ChatService) ListShares(ctx context.Context, caller Caller, chatID string) ([]domain.ChatShare, error) {
+	if _, err := s.authorize(ctx, caller, chatID, AccessManage); err != nil {
+		return nil, err
+	}
+	return s.Repo.ListChatShares(ctx, s.DB, chatID)
+}
+
+// versionErr maps a "no row matched" error of a chat update to
+// ErrVersionConflict when the update was conditional (the chat changed since
+// it was authorized) and to ErrChatNotFound otherwise.
+func versionErr(err error, version int64) error {
+	switch {
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		return err
+	case version > 0:
+		return ErrVersionConflict
+	default:
+		return ErrChatNotFound
+	}
+}
+
+// authorize applies the chat access policy using the service's repository.
+func (s *ChatService) authorize(ctx context.Context, caller Caller, chatID string, access Access) (*domain.Chat, error) {
+	return authorizeChat(ctx, s.DB, s.Repo, caller, chatID, access)
 }
 
 // clip truncates a chat title to the configured maximum rune length.
@@ -140,5 +301,8 @@ func normalizeTitle(s string) string {
 	return s
 }
 
+// maxShareUserIDLen matches the width of chat_shares.user_id.
+const maxShareUserIDLen = 64
+
 // whitespaceRE collapses consecutive whitespace to a single space.
 var whitespaceRE = regexp.MustCompile(`\s+`)
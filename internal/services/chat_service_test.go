@@ -3,12 +3,15 @@ package services
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
+	"time"
 	"unicode/utf8"
 
 	"gorm.io/gorm"
 
 	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/pagination"
 	"golang.org/x/text/language"
 )
 
@@ -16,20 +19,25 @@ import (
 
 type fakeChatRepo struct {
 	// capture args
+	workspace    string // workspace of the last call
 	createUserID string
 	createTitle  string
 
 	listUserID string
 
-	getID     string
-	getUserID string
-	getChat   *domain.Chat
-	getErr    error
+	getID   string
+	getChat *domain.Chat
+	getErr  error
 
-	updateID     string
-	updateUserID string
-	updateTitle  string
-	updateErr    error
+	sharedWith map[string]bool
+	shareErr   error
+	shares     []domain.ChatShare
+
+	updateID      string
+	updateUserID  string
+	updateTitle   string
+	updateVersion int64
+	updateErr     error
 
 	countUserID string
 	countTotal  int64
@@ -40,15 +48,26 @@ type fakeChatRepo struct {
 	pageLimit  int
 	pageItems  []domain.Chat
 	pageErr    error
+
+	deleteAt      time.Time
+	deleteUserID  string
+	deleteVersion int64
+	deleteErr     error
+	deleted       *domain.Chat
+	deletedErr    error
+	restoredAt    time.Time
+	restoreErr    error
 }
 
-func (r *fakeChatRepo) CreateChat(ctx context.Context, db *gorm.DB, userID, title string) (*domain.Chat, error) {
+func (r *fakeChatRepo) CreateChat(ctx context.Context, db *gorm.DB, workspaceID, userID, title string) (*domain.Chat, error) {
+	r.workspace = workspaceID
 	r.createUserID = userID
 	r.createTitle = title
-	return &domain.Chat{ID: "c1", UserID: userID, Title: title}, nil
+	return &domain.Chat{ID: "c1", WorkspaceID: workspaceID, UserID: userID, Title: title}, nil
 }
 
-func (r *fakeChatRepo) ListChats(ctx context.Context, db *gorm.DB, userID string) ([]domain.Chat, error) {
+func (r *fakeChatRepo) ListChats(ctx context.Context, db *gorm.DB, workspaceID, userID string) ([]domain.Chat, error) {
+	r.workspace = workspaceID
 	r.listUserID = userID
 	return []domain.Chat{
 		{ID: "c1", UserID: userID, Title: "t1"},
@@ -56,26 +75,84 @@ func (r *fakeChatRepo) ListChats(ctx context.Context, db *gorm.DB, userID string
 	}, nil
 }
 
-func (r *fakeChatRepo) GetChat(ctx context.Context, db *gorm.DB, id, userID string) (*domain.Chat, error) {
-	r.getID, r.getUserID = id, userID
+func (r *fakeChatRepo) FindChat(ctx context.Context, db *gorm.DB, workspaceID, id string) (*domain.Chat, error) {
+	r.workspace = workspaceID
+	r.getID = id
+	if r.getChat == nil && r.getErr == nil {
+		return nil, gorm.ErrRecordNotFound
+	}
 	return r.getChat, r.getErr
 }
 
-func (r *fakeChatRepo) UpdateChatTitle(ctx context.Context, db *gorm.DB, id, userID, title string) error {
+func (r *fakeChatRepo) IsChatSharedWith(ctx context.Context, db *gorm.DB, chatID, userID string) (bool, error) {
+	return r.sharedWith[userID], nil
+}
+
+func (r *fakeChatRepo) ShareChat(ctx context.Context, db *gorm.DB, chatID, userID string) error {
+	if r.shareErr == nil {
+		r.shares = append(r.shares, domain.ChatShare{ChatID: chatID, UserID: userID})
+	}
+	return r.shareErr
+}
+
+func (r *fakeChatRepo) UnshareChat(ctx context.Context, db *gorm.DB, chatID, userID string) error {
+	out := r.shares[:0]
+	for _, sh := range r.shares {
+		if sh.UserID != userID {
+			out = append(out, sh)
+		}
+	}
+	r.shares = out
+	return nil
+}
+
+func (r *fakeChatRepo) ListChatShares(ctx context.Context, db *gorm.DB, chatID string) ([]domain.ChatShare, error) {
+	return r.shares, nil
+}
+
+func (r *fakeChatRepo) UpdateChatTitle(ctx context.Context, db *gorm.DB, workspaceID, id, userID, title string, version int64) error {
+	r.workspace = workspaceID
+	r.updateVersion = version
 	r.updateID, r.updateUserID, r.updateTitle = id, userID, title
 	return r.updateErr
 }
 
-func (r *fakeChatRepo) CountChats(ctx context.Context, db *gorm.DB, userID string) (int64, error) {
+func (r *fakeChatRepo) CountChats(ctx context.Context, db *gorm.DB, workspaceID, userID string) (int64, error) {
+	r.workspace = workspaceID
 	r.countUserID = userID
 	return r.countTotal, r.countErr
 }
 
-func (r *fakeChatRepo) ListChatsPage(ctx context.Context, db *gorm.DB, userID string, offset, limit int) ([]domain.Chat, error) {
+func (r *fakeChatRepo) ListChatsPage(ctx context.Context, db *gorm.DB, workspaceID, userID string, offset, limit int) ([]domain.Chat, error) {
+	r.workspace = workspaceID
 	r.pageUserID, r.pageOffset, r.pageLimit = userID, offset, limit
 	return r.pageItems, r.pageErr
 }
 
+func (r *fakeChatRepo) ListChatsKeyset(ctx context.Context, db *gorm.DB, workspaceID, userID string, p pagination.Page) ([]domain.Chat, bool, error) {
+	r.workspace = workspaceID
+	r.pageUserID, r.pageLimit = userID, p.Limit
+	return r.pageItems, false, r.pageErr
+}
+
+func (r *fakeChatRepo) DeleteChat(ctx context.Context, db *gorm.DB, workspaceID, id, userID string, version int64, at time.Time) error {
+	r.workspace = workspaceID
+	r.deleteVersion = version
+	r.deleteAt, r.deleteUserID = at, userID
+	return r.deleteErr
+}
+
+func (r *fakeChatRepo) FindDeletedChat(ctx context.Context, db *gorm.DB, workspaceID, id string) (*domain.Chat, error) {
+	r.workspace = workspaceID
+	return r.deleted, r.deletedErr
+}
+
+func (r *fakeChatRepo) RestoreChat(ctx context.Context, db *gorm.DB, workspaceID, id, userID string, deletedAt time.Time) error {
+	r.workspace = workspaceID
+	r.restoredAt = deletedAt
+	return r.restoreErr
+}
+
 // ----- Tests -----
 
 func TestNewChatService_Defaults(t *testing.T) {
@@ -137,7 +214,7 @@ func TestCreate_DefaultTitleWhenBlank_AndClipped(t *testing.T) {
 	s.TitleMaxLen = 4
 
 	// blank -> "New chat" -> clipped to "New "
-	chat, err := s.Create(context.Background(), "u1", "    ")
+	chat, err := s.Create(context.Background(), Caller{UserID: "u1"}, "    ")
 	if err != nil {
 		t.Fatalf("Create returned error: %v", err)
 	}
@@ -154,7 +231,7 @@ func TestCreate_NormalizesAndClips(t *testing.T) {
 	s := NewChatService(nil, r)
 	s.TitleMaxLen = 3
 
-	_, err := s.Create(context.Background(), "user-x", "  A   B  ")
+	_, err := s.Create(context.Background(), Caller{UserID: "user-x"}, "  A   B  ")
 	if err != nil {
 		t.Fatalf("Create error: %v", err)
 	}
@@ -168,7 +245,7 @@ func TestList_ForwardsToRepo(t *testing.T) {
 	r := &fakeChatRepo{}
 	s := NewChatService(nil, r)
 
-	out, err := s.List(context.Background(), "u2")
+	out, err := s.List(context.Background(), Caller{UserID: "u2"})
 	if err != nil {
 		t.Fatalf("List error: %v", err)
 	}
@@ -185,7 +262,7 @@ func TestListPage_DefaultsAndTotalZero(t *testing.T) {
 	s := NewChatService(nil, r)
 
 	// page=0 -> default to 1, size=0 -> default to 20
-	items, total, err := s.ListPage(context.Background(), "u3", 0, 0)
+	items, total, err := s.ListPage(context.Background(), Caller{UserID: "u3"}, 0, 0)
 	if err != nil {
 		t.Fatalf("ListPage error: %v", err)
 	}
@@ -203,7 +280,7 @@ func TestListPage_CountError(t *testing.T) {
 	r := &fakeChatRepo{countErr: sentinel}
 	s := NewChatService(nil, r)
 
-	_, _, err := s.ListPage(context.Background(), "u4", 1, 10)
+	_, _, err := s.ListPage(context.Background(), Caller{UserID: "u4"}, 1, 10)
 	if !errors.Is(err, sentinel) {
 		t.Fatalf("expected count error to propagate, got %v", err)
 	}
@@ -218,7 +295,7 @@ func TestListPage_Success_OffsetLimitAndItemsError(t *testing.T) {
 	}
 	s := NewChatService(nil, r)
 
-	_, total, err := s.ListPage(context.Background(), "u5", 3, 10)
+	_, total, err := s.ListPage(context.Background(), Caller{UserID: "u5"}, 3, 10)
 	if total != 42 {
 		t.Fatalf("total = %d; want 42", total)
 	}
@@ -235,7 +312,7 @@ func TestListPage_Success_OffsetLimitAndItemsError(t *testing.T) {
 		pageItems:  []domain.Chat{{ID: "x1"}, {ID: "x2"}},
 	}
 	s2 := NewChatService(nil, r2)
-	items, total2, err2 := s2.ListPage(context.Background(), "u6", -10, -5) // forces defaults: page=1, size=20
+	items, total2, err2 := s2.ListPage(context.Background(), Caller{UserID: "u6"}, -10, -5) // forces defaults: page=1, size=20
 	if err2 != nil {
 		t.Fatalf("ListPage success error: %v", err2)
 	}
@@ -251,7 +328,7 @@ func TestUpdateTitle_NotFoundMapsToErrChatNotFound(t *testing.T) {
 	r := &fakeChatRepo{getErr: gorm.ErrRecordNotFound}
 	s := NewChatService(nil, r)
 
-	err := s.UpdateTitle(context.Background(), "u1", "chat-1", "ignored")
+	_, err := s.UpdateTitle(context.Background(), Caller{UserID: "u1"}, "chat-1", "ignored", 0)
 	if !errors.Is(err, ErrChatNotFound) {
 		t.Fatalf("expected ErrChatNotFound mapping, got %v", err)
 	}
@@ -262,7 +339,7 @@ func TestUpdateTitle_RepoGetOtherError(t *testing.T) {
 	r := &fakeChatRepo{getErr: sentinel}
 	s := NewChatService(nil, r)
 
-	err := s.UpdateTitle(context.Background(), "u1", "chat-1", "ok")
+	_, err := s.UpdateTitle(context.Background(), Caller{UserID: "u1"}, "chat-1", "ok", 0)
 	if !errors.Is(err, sentinel) {
 		t.Fatalf("expected sentinel error, got %v", err)
 	}
@@ -274,7 +351,7 @@ func TestUpdateTitle_BlankBecomesUntitled_AndClippedAndNormalized(t *testing.T)
 	s.TitleMaxLen = 7
 
 	// Blank -> "Untitled", clipped to 7 runes -> "Untitle"
-	err := s.UpdateTitle(context.Background(), "u1", "chat-1", "   \t  ")
+	_, err := s.UpdateTitle(context.Background(), Caller{UserID: "u1"}, "chat-1", "   \t  ", 0)
 	if err != nil {
 		t.Fatalf("UpdateTitle error: %v", err)
 	}
@@ -286,7 +363,7 @@ func TestUpdateTitle_BlankBecomesUntitled_AndClippedAndNormalized(t *testing.T)
 	r2 := &fakeChatRepo{getChat: &domain.Chat{ID: "chat-2", UserID: "u2"}}
 	s2 := NewChatService(nil, r2)
 	s2.TitleMaxLen = 5
-	err = s2.UpdateTitle(context.Background(), "u2", "chat-2", "  A   B   C  ")
+	_, err = s2.UpdateTitle(context.Background(), Caller{UserID: "u2"}, "chat-2", "  A   B   C  ", 0)
 	if err != nil {
 		t.Fatalf("UpdateTitle error: %v", err)
 	}
@@ -295,3 +372,196 @@ func TestUpdateTitle_BlankBecomesUntitled_AndClippedAndNormalized(t *testing.T)
 		t.Fatalf("expected normalized title %q; got %q", "A B C", r2.updateTitle)
 	}
 }
+
+func TestChatService_Delete_MapsNotFound(t *testing.T) {
+	r := &fakeChatRepo{getChat: &domain.Chat{ID: "c1", UserID: "u1"}}
+	s := NewChatService(nil, r)
+
+	before := time.Now().UTC()
+	if err := s.Delete(context.Background(), Caller{UserID: "u1"}, "c1", 0); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if r.deleteAt.Before(before) {
+		t.Fatalf("expected deletion time >= %v, got %v", before, r.deleteAt)
+	}
+
+	r.deleteErr = gorm.ErrRecordNotFound
+	if err := s.Delete(context.Background(), Caller{UserID: "u1"}, "c1", 0); !errors.Is(err, ErrChatNotFound) {
+		t.Fatalf("expected ErrChatNotFound, got %v", err)
+	}
+	r.deleteErr = errors.New("db down")
+	if err := s.Delete(context.Background(), Caller{UserID: "u1"}, "c1", 0); err == nil || errors.Is(err, ErrChatNotFound) {
+		t.Fatalf("expected raw error, got %v", err)
+	}
+}
+
+func TestChatService_Restore(t *testing.T) {
+	deletedAt := time.Now().UTC().Add(-time.Hour)
+	deleted := &domain.Chat{ID: "c1", UserID: "u1", DeletedAt: gorm.DeletedAt{Time: deletedAt, Valid: true}}
+	live := &domain.Chat{ID: "c1", UserID: "u1", Title: "t"}
+
+	// Within the window: restored with the original deletion time, then re-read.
+	r := &fakeChatRepo{deleted: deleted, getChat: live}
+	s := NewChatService(nil, r)
+	s.RestoreWindow = 2 * time.Hour
+	got, err := s.Restore(context.Background(), Caller{UserID: "u1"}, "c1")
+	if err != nil || got != live || !r.restoredAt.Equal(deletedAt) {
+		t.Fatalf("Restore = %+v, %v (restoredAt %v)", got, err, r.restoredAt)
+	}
+
+	// Past the window.
+	s.RestoreWindow = 30 * time.Minute
+	if _, err := s.Restore(context.Background(), Caller{UserID: "u1"}, "c1"); !errors.Is(err, ErrRestoreExpired) {
+		t.Fatalf("expected ErrRestoreExpired, got %v", err)
+	}
+
+	// Not deleted: the live chat is returned unchanged.
+	r = &fakeChatRepo{deletedErr: gorm.ErrRecordNotFound, getChat: live}
+	s = NewChatService(nil, r)
+	if got, err := s.Restore(context.Background(), Caller{UserID: "u1"}, "c1"); err != nil || got != live || !r.restoredAt.IsZero() {
+		t.Fatalf("expected live chat without restore, got %+v, %v", got, err)
+	}
+
+	// Unknown chat.
+	r.getChat, r.getErr = nil, gorm.ErrRecordNotFound
+	if _, err := s.Restore(context.Background(), Caller{UserID: "u1"}, "c1"); !errors.Is(err, ErrChatNotFound) {
+		t.Fatalf("expected ErrChatNotFound, got %v", err)
+	}
+}
+
+func TestChatService_SharedAndForeignCallers(t *testing.T) {
+	chat := &domain.Chat{ID: "c1", UserID: "owner", Title: "t"}
+	r := &fakeChatRepo{getChat: chat, sharedWith: map[string]bool{"friend": true}}
+	s := NewChatService(nil, r)
+	ctx := context.Background()
+
+	// Strangers cannot tell the chat exists; shared users may not manage it.
+	for _, tc := range []struct {
+		caller Caller
+		want   error
+	}{
+		{Caller{UserID: "mallory"}, ErrChatNotFound},
+		{Caller{UserID: "friend"}, ErrForbidden},
+	} {
+		if _, err := s.UpdateTitle(ctx, tc.caller, "c1", "x", 0); !errors.Is(err, tc.want) {
+			t.Fatalf("UpdateTitle(%s) = %v; want %v", tc.caller.UserID, err, tc.want)
+		}
+		if err := s.Delete(ctx, tc.caller, "c1", 0); !errors.Is(err, tc.want) {
+			t.Fatalf("Delete(%s) = %v; want %v", tc.caller.UserID, err, tc.want)
+		}
+		if err := s.Share(ctx, tc.caller, "c1", "eve"); !errors.Is(err, tc.want) {
+			t.Fatalf("Share(%s) = %v; want %v", tc.caller.UserID, err, tc.want)
+		}
+	}
+	if r.updateTitle != "" || !r.deleteAt.IsZero() || len(r.shares) != 0 {
+		t.Fatalf("repo mutated by unauthorized caller: %+v", r)
+	}
+
+	// Admins act on the owner's behalf.
+	admin := Caller{UserID: "root", Admin: true}
+	if _, err := s.UpdateTitle(ctx, admin, "c1", "renamed", 0); err != nil || r.updateUserID != "owner" {
+		t.Fatalf("admin UpdateTitle: err=%v user=%q", err, r.updateUserID)
+	}
+	if err := s.Delete(ctx, admin, "c1", 0); err != nil || r.deleteUserID != "owner" {
+		t.Fatalf("admin Delete: err=%v user=%q", err, r.deleteUserID)
+	}
+}
+
+func TestChatService_VersionConflicts(t *testing.T) {
+	r := &fakeChatRepo{getChat: &domain.Chat{ID: "c1", UserID: "owner", Version: 3}}
+	s := NewChatService(nil, r)
+	ctx := context.Background()
+	owner := Caller{UserID: "owner"}
+
+	if got, err := s.Get(ctx, owner, "c1"); err != nil || got.Version != 3 {
+		t.Fatalf("Get = %+v, %v", got, err)
+	}
+	if _, err := s.Get(ctx, Caller{UserID: "mallory"}, "c1"); !errors.Is(err, ErrChatNotFound) {
+		t.Fatalf("Get(stranger) = %v", err)
+	}
+
+	// Stale versions fail before touching the repo.
+	if _, err := s.UpdateTitle(ctx, owner, "c1", "x", 2); !errors.Is(err, ErrVersionConflict) || r.updateTitle != "" {
+		t.Fatalf("stale UpdateTitle = %v (repo title %q)", err, r.updateTitle)
+	}
+	if err := s.Delete(ctx, owner, "c1", 2); !errors.Is(err, ErrVersionConflict) || !r.deleteAt.IsZero() {
+		t.Fatalf("stale Delete = %v", err)
+	}
+
+	// The current version is passed on, so the repo checks it atomically.
+	if _, err := s.UpdateTitle(ctx, owner, "c1", "x", 3); err != nil || r.updateVersion != 3 {
+		t.Fatalf("UpdateTitle = %v, version %d", err, r.updateVersion)
+	}
+	if err := s.Delete(ctx, owner, "c1", 3); err != nil || r.deleteVersion != 3 {
+		t.Fatalf("Delete = %v, version %d", err, r.deleteVersion)
+	}
+
+	// Losing the race at the repo is a conflict when conditional, else not found.
+	r.updateErr, r.deleteErr = gorm.ErrRecordNotFound, gorm.ErrRecordNotFound
+	if _, err := s.UpdateTitle(ctx, owner, "c1", "x", 3); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("racing UpdateTitle = %v", err)
+	}
+	if err := s.Delete(ctx, owner, "c1", 3); !errors.Is(err, ErrVersionConflict) {
+		t.Fatalf("racing Delete = %v", err)
+	}
+	if _, err := s.UpdateTitle(ctx, owner, "c1", "x", 0); !errors.Is(err, ErrChatNotFound) {
+		t.Fatalf("unconditional UpdateTitle = %v", err)
+	}
+}
+
+func TestChatService_Share(t *testing.T) {
+	r := &fakeChatRepo{getChat: &domain.Chat{ID: "c1", UserID: "owner"}}
+	s := NewChatService(nil, r)
+	ctx := context.Background()
+	owner := Caller{UserID: "owner"}
+
+	for _, target := range []string{"", "   ", "owner", strings.Repeat("x", 65)} {
+		if err := s.Share(ctx, owner, "c1", target); !errors.Is(err, ErrInvalidShare) {
+			t.Fatalf("Share(%q) = %v; want ErrInvalidShare", target, err)
+		}
+	}
+	if err := s.Share(ctx, owner, "c1", " friend "); err != nil {
+		t.Fatalf("Share: %v", err)
+	}
+	shares, err := s.ListShares(ctx, owner, "c1")
+	if err != nil || len(shares) != 1 || shares[0].UserID != "friend" {
+		t.Fatalf("ListShares = %+v, %v", shares, err)
+	}
+	if err := s.Unshare(ctx, owner, "c1", "friend"); err != nil {
+		t.Fatalf("Unshare: %v", err)
+	}
+	if shares, _ := s.ListShares(ctx, owner, "c1"); len(shares) != 0 {
+		t.Fatalf("shares after Unshare = %+v", shares)
+	}
+	if _, err := s.ListShares(ctx, Caller{UserID: "mallory"}, "c1"); !errors.Is(err, ErrChatNotFound) {
+		t.Fatalf("ListShares(stranger) = %v; want ErrChatNotFound", err)
+	}
+}
+
+func TestChatService_UsesCallerWorkspace(t *testing.T) {
+	r := &fakeChatRepo{}
+	s := NewChatService(nil, r)
+	ctx := context.Background()
+
+	if _, err := s.Create(ctx, Caller{UserID: "u1"}, "t"); err != nil || r.workspace != domain.DefaultWorkspaceID {
+		t.Fatalf("Create without workspace: workspace = %q, err = %v", r.workspace, err)
+	}
+	team := Caller{UserID: "u1", WorkspaceID: "ws-1"}
+	if _, err := s.List(ctx, team); err != nil || r.workspace != "ws-1" {
+		t.Fatalf("List: workspace = %q, err = %v", r.workspace, err)
+	}
+	if _, _, err := s.ListPage(ctx, team, 1, 10); err != nil || r.workspace != "ws-1" {
+		t.Fatalf("ListPage: workspace = %q, err = %v", r.workspace, err)
+	}
+
+	// Chats are looked up in the caller's workspace; other workspaces' chats
+	// are not found.
+	r.getChat = &domain.Chat{ID: "c1", WorkspaceID: "ws-1", UserID: "u1"}
+	if _, err := s.UpdateTitle(ctx, team, "c1", "new", 0); err != nil || r.workspace != "ws-1" {
+		t.Fatalf("UpdateTitle: workspace = %q, err = %v", r.workspace, err)
+	}
+	r.getChat = nil
+	if err := s.Delete(ctx, Caller{UserID: "u1", WorkspaceID: "ws-2"}, "c1", 0); !errors.Is(err, ErrChatNotFound) || r.workspace != "ws-2" {
+		t.Fatalf("Delete in other workspace: workspace = %q, err = %v", r.workspace, err)
+	}
+}
@@ -0,0 +1,104 @@
+// Package services – conversational context
+//
+// Follow-up questions usually omit what the conversation is about: after
+// "What share of Gen Z in Nashville use podcasts?" the user asks "and what
+// about Instagram?". Retrieval only sees the current prompt, so this file
+// recovers the audience and location from earlier user turns and appends
+// whichever the new prompt lacks to the retrieval query. The generator still
+// receives the prompt as typed (plus history).
+
+package services
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/tbourn/go-chat-backend/internal/generator"
+)
+
+// queryContext is who (audience) and where (location) a prompt asks about.
+type queryContext struct {
+	Audience string
+	Location string
+}
+
+var (
+	// Generational cohorts, the most common audiences in the corpus.
+	cohortRE = regexp.MustCompile(`(?i)\b(gen(?:eration)?[ -]?(?:z|x|y|alpha)|millennials?|(?:baby )?boomers?|zoomers?)\b`)
+
+	// "<up to two qualifiers> <group noun>", e.g. "TikTok users", "luxury consumers".
+	groupRE = regexp.MustCompile(`(?i)((?:[\p{L}\p{N}+&'/-]+ ){0,2})\b(users|owners|fans|buyers|consumers|shoppers|parents|mothers|moms|fathers|dads|gamers|drinkers|listeners|viewers|readers|subscribers|purchasers|donors|players|travell?ers|students|adults|teens|teenagers|women|men|drivers|investors|professionals)\b`)
+
+	// "in [the] <Capitalised Words>", e.g. "in Nashville", "in the UK", "in Saudi Arabia".
+	promptLocationRE = regexp.MustCompile(`\b(?i:in) (?:the )?(\p{Lu}[\p{L}.]*(?: \p{Lu}[\p{L}.]*)*)`)
+)
+
+// audienceStop are qualifier words that belong to the question, not to the
+// audience ("what percentage of TikTok users" → "TikTok users").
+var audienceStop = map[string]struct{}{
+	"percentage": {}, "percent": {}, "share": {}, "proportion": {}, "many": {}, "among": {},
+	"all": {}, "most": {}, "some": {}, "about": {}, "between": {}, "compared": {}, "versus": {}, "vs": {},
+}
+
+// parseQueryContext extracts the audience and location named in prompt.
+func parseQueryContext(prompt string) queryContext {
+	var qc queryContext
+	if m := promptLocationRE.FindStringSubmatch(prompt); m != nil {
+		qc.Location = strings.TrimRight(m[1], ".")
+	}
+	if m := groupRE.FindStringSubmatch(prompt); m != nil {
+		words := strings.Fields(m[1])
+		for len(words) > 0 && isQuestionWord(words[0]) {
+			words = words[1:]
+		}
+		qc.Audience = strings.Join(append(words, m[2]), " ")
+	}
+	if qc.Audience == "" {
+		if m := cohortRE.FindString(prompt); m != "" {
+			qc.Audience = m
+		}
+	}
+	return qc
+}
+
+// isQuestionWord reports whether w is part of the question rather than the
+// audience it qualifies.
+func isQuestionWord(w string) bool {
+	lw := strings.ToLower(w)
+	if _, stop := qStop[lw]; stop {
+		return true
+	}
+	_, stop := audienceStop[lw]
+	return stop
+}
+
+// rewriteQuery returns the retrieval query for prompt: the prompt itself,
+// plus the audience and/or location of the most recent earlier user turn that
+// named them, for whichever the prompt does not name itself.
+func rewriteQuery(prompt string, history []generator.Turn) string {
+	cur := parseQueryContext(prompt)
+	var carried queryContext
+	needAudience := func() bool { return cur.Audience == "" && carried.Audience == "" }
+	needLocation := func() bool { return cur.Location == "" && carried.Location == "" }
+	for i := len(history) - 1; i >= 0 && (needAudience() || needLocation()); i-- {
+		if history[i].Role != roleUser {
+			continue
+		}
+		prev := parseQueryContext(history[i].Content)
+		if needAudience() {
+			carried.Audience = prev.Audience
+		}
+		if needLocation() {
+			carried.Location = prev.Location
+		}
+	}
+
+	q := prompt
+	if carried.Audience != "" {
+		q += " " + carried.Audience
+	}
+	if carried.Location != "" {
+		q += " in " + carried.Location
+	}
+	return q
+}
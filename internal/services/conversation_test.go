@@ -0,0 +1,53 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/tbourn/go-chat-backend/internal/generator"
+)
+
+func TestParseQueryContext(t *testing.T) {
+	cases := []struct {
+		prompt string
+		want   queryContext
+	}{
+		{"What percentage of Gen Z in Nashville discover new brands through podcasts?", queryContext{"Gen Z", "Nashville"}},
+		{"How many TikTok users in the UK shop online?", queryContext{"TikTok users", "UK"}},
+		{"What share of luxury consumers in Saudi Arabia buy jewelry?", queryContext{"luxury consumers", "Saudi Arabia"}},
+		{"Are millennials more likely to stream?", queryContext{"millennials", ""}},
+		{"In India, what do Gen Z gamers play?", queryContext{"Gen Z gamers", "India"}},
+		{"and what about Instagram?", queryContext{}},
+		{"what about in the U.S.?", queryContext{"", "U.S"}},
+	}
+	for _, tc := range cases {
+		if got := parseQueryContext(tc.prompt); got != tc.want {
+			t.Errorf("parseQueryContext(%q) = %+v, want %+v", tc.prompt, got, tc.want)
+		}
+	}
+}
+
+func TestRewriteQuery(t *testing.T) {
+	history := []generator.Turn{
+		{Role: roleUser, Content: "What percentage of Gen Z in Nashville discover new brands through podcasts?"},
+		{Role: roleAssistant, Content: "12% of Gen Z in Nashville discover new brands through podcasts."},
+		{Role: roleUser, Content: "and what about Instagram?"},
+		{Role: roleAssistant, Content: "Millennials in the UK ..."}, // assistant turns are ignored
+	}
+	cases := []struct {
+		name, prompt, want string
+		history            []generator.Turn
+	}{
+		{"no history", "and what about Instagram?", "and what about Instagram?", nil},
+		{"carries audience and location", "and TikTok?", "and TikTok? Gen Z in Nashville", history},
+		{"keeps own location", "what about in the UK?", "what about in the UK? Gen Z", history},
+		{"keeps own audience", "What about millennials?", "What about millennials? in Nashville", history},
+		{"self-contained prompt unchanged", "How many TikTok users in Canada shop online?", "How many TikTok users in Canada shop online?", history},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := rewriteQuery(tc.prompt, tc.history); got != tc.want {
+				t.Fatalf("rewriteQuery(%q) = %q, want %q", tc.prompt, got, tc.want)
+			}
+		})
+	}
+}
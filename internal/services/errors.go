@@ -15,6 +15,22 @@ var (
 	// accessible to the current user.
 	ErrChatNotFound = errors.New("chat not found")
 
+	// ErrForbidden is returned when the caller can see a chat (it is shared
+	// with them) but may not perform the requested operation on it.
+	ErrForbidden = errors.New("operation not permitted on this chat")
+
+	// ErrInvalidShare is returned when a chat cannot be shared with the given
+	// user (empty or too long ID, or the chat's owner).
+	ErrInvalidShare = errors.New("invalid share target")
+
+	// ErrVersionConflict is returned when a conditional change targets a
+	// chat version that is no longer current (someone else changed the chat).
+	ErrVersionConflict = errors.New("chat has been modified")
+
+	// ErrRestoreExpired is returned when a deleted chat can no longer be
+	// restored because its grace window has passed.
+	ErrRestoreExpired = errors.New("chat restore window has expired")
+
 	// ErrEmptyPrompt is returned when a request to create a message contains
 	// an empty prompt.
 	ErrEmptyPrompt = errors.New("prompt is empty")
@@ -38,4 +54,104 @@ var (
 	// ErrDuplicateFeedback is returned when a user attempts to leave feedback
 	// on a message that they have already rated.
 	ErrDuplicateFeedback = errors.New("feedback already exists")
+
+	// ErrBranchMoved is returned when another message was added to a chat
+	// while a prompt was being answered, so the prompt or its reply would no
+	// longer follow the conversation it was answered from.
+	ErrBranchMoved = errors.New("chat received another message meanwhile")
+
+	// ErrNotEditable is returned when editing a message that is not a user
+	// message (assistant replies are regenerated by editing their prompt).
+	ErrNotEditable = errors.New("only user messages can be edited")
+)
+
+// Share link errors.
+var (
+	// ErrShareLinkNotFound is returned for share link tokens that are
+	// malformed, unknown, revoked or expired, or whose chat was deleted.
+	// Callers must not distinguish these cases to clients.
+	ErrShareLinkNotFound = errors.New("share link not found")
+
+	// ErrInvalidShareLinkExpiry is returned when a share link expiry is not
+	// in the future.
+	ErrInvalidShareLinkExpiry = errors.New("share link expiry must be in the future")
+)
+
+// Import errors.
+var (
+	// ErrInvalidImport is returned (wrapped with the reason) for chat
+	// import documents that cannot be stored.
+	ErrInvalidImport = errors.New("invalid import document")
+)
+
+// Search errors.
+var (
+	// ErrInvalidSearch is returned for a search without words (or with too
+	// many), an unknown role filter or an empty date range.
+	ErrInvalidSearch = errors.New("invalid search query")
+)
+
+// API key errors.
+var (
+	// ErrAPIKeyNotFound indicates that the API key does not exist or does not
+	// belong to the current user.
+	ErrAPIKeyNotFound = errors.New("api key not found")
+
+	// ErrInvalidScope is returned when an API key is requested without scopes
+	// or with a scope that does not exist.
+	ErrInvalidScope = errors.New("invalid api key scope")
+
+	// ErrScopeNotAllowed is returned when a non-admin caller requests the
+	// admin scope.
+	ErrScopeNotAllowed = errors.New("only admins can grant the admin scope")
+
+	// ErrInvalidExpiry is returned when an API key expiry is not in the future.
+	ErrInvalidExpiry = errors.New("api key expiry must be in the future")
+)
+
+// Workspace errors.
+var (
+	// ErrWorkspaceNotFound indicates that the workspace does not exist or the
+	// current user is not a member of it.
+	ErrWorkspaceNotFound = errors.New("workspace not found")
+
+	// ErrWorkspaceForbidden is returned when a member who is not an owner
+	// attempts to manage the workspace.
+	ErrWorkspaceForbidden = errors.New("operation requires the workspace owner role")
+
+	// ErrInvalidWorkspace is returned for an empty or overlong workspace name,
+	// or for changes to the default workspace other than by an admin.
+	ErrInvalidWorkspace = errors.New("invalid workspace")
+
+	// ErrInvalidMember is returned for an empty or overlong member user ID or
+	// an unknown role.
+	ErrInvalidMember = errors.New("invalid workspace member")
+
+	// ErrLastOwner is returned when a change would leave a workspace without
+	// an owner.
+	ErrLastOwner = errors.New("workspace must keep at least one owner")
+
+	// ErrCorpusNotAllowed is returned when a non-admin sets a workspace
+	// corpus.
+	ErrCorpusNotAllowed = errors.New("only admins can set a workspace corpus")
+
+	// ErrInvalidCorpus is returned when a workspace corpus cannot be used: it
+	// is outside the corpus directory, fails to load, or per-workspace
+	// corpora are disabled.
+	ErrInvalidCorpus = errors.New("corpus not available")
+)
+
+// Quota errors.
+var (
+	// ErrQuotaExceeded is returned (wrapped in a *QuotaError) when a request
+	// would exceed a usage quota.
+	ErrQuotaExceeded = errors.New("usage quota exceeded")
+
+	// ErrQuotaForbidden is returned when a non-admin reads or changes
+	// another user's quota override.
+	ErrQuotaForbidden = errors.New("only admins can manage quota overrides")
+
+	// ErrInvalidQuota is returned for a negative limit or an empty or
+	// overlong user ID in a quota override.
+	ErrInvalidQuota = errors.New("invalid quota override")
 )
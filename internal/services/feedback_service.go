@@ -2,7 +2,7 @@
 //
 // This file implements the FeedbackService, which governs how users leave
 // feedback (-1 or +1) on assistant messages. It enforces business rules
-// (message existence, chat ownership, assistant-only restriction, uniqueness)
+// (message existence, chat access, assistant-only restriction, uniqueness)
 // and persists feedback atomically in the database. Service-level errors
 // (e.g. ErrInvalidFeedback, ErrMessageNotFound, ErrForbiddenFeedback,
 // ErrDuplicateFeedback) are returned for predictable cases so handlers can
@@ -32,12 +32,14 @@ type FeedbackService struct {
 	DB *gorm.DB
 }
 
-// Leave records a feedback value for messageID on behalf of userID.
+// Leave records a feedback value for messageID on behalf of caller.
 //
 // Semantics and validation:
 //   - value must be exactly -1 (negative) or 1 (positive); otherwise ErrInvalidFeedback.
-//   - messageID must exist; otherwise ErrMessageNotFound.
-//   - The message must belong to a chat owned by userID; otherwise ErrForbiddenFeedback.
+//   - messageID must exist in the caller's workspace; otherwise ErrMessageNotFound.
+//   - The caller must have write access to the message's chat (owner, shared
+//     user or admin); otherwise ErrMessageNotFound, so other users' messages
+//     are indistinguishable from missing ones.
 //   - Feedback is allowed only for assistant messages; user messages are rejected
 //     with ErrForbiddenFeedback.
 //   - A user may leave at most one feedback per message; attempting to do so
@@ -52,14 +54,14 @@ type FeedbackService struct {
 //     ErrMessageNotFound, ErrForbiddenFeedback, ErrDuplicateFeedback) for the
 //     validation cases above.
 //   - Returns the underlying DB error for unexpected failures.
-func (s *FeedbackService) Leave(ctx context.Context, userID, messageID string, value int) error {
+func (s *FeedbackService) Leave(ctx context.Context, caller Caller, messageID string, value int) error {
 	if value != -1 && value != 1 {
 		return ErrInvalidFeedback
 	}
 
 	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		// 1) Load message and verify it exists.
-		msg, err := repo.GetMessage(tx, messageID)
+		// 1) Load message and verify it exists in the caller's workspace.
+		msg, err := repo.GetMessage(tx, caller.Workspace(), messageID)
 		if err != nil {
 			// repo.GetMessage returns gorm.ErrRecordNotFound if missing.
 			if errors.Is(err, gorm.ErrRecordNotFound) || isNotFound(err) {
@@ -68,10 +70,12 @@ func (s *FeedbackService) Leave(ctx context.Context, userID, messageID string, v
 			return err
 		}
 
-		// 2) Ensure the message's chat belongs to this user.
-		if _, err := repo.GetChat(ctx, tx, msg.ChatID, userID); err != nil {
-			// either not found or not owned by this user
-			return ErrForbiddenFeedback
+		// 2) Ensure the caller may write to the message's chat.
+		if _, err := authorizeChat(ctx, tx, repoLookup{}, caller, msg.ChatID, AccessWrite); err != nil {
+			if errors.Is(err, ErrChatNotFound) {
+				return ErrMessageNotFound
+			}
+			return err
 		}
 
 		// 3) Only allow feedback on assistant messages.
@@ -81,11 +85,12 @@ func (s *FeedbackService) Leave(ctx context.Context, userID, messageID string, v
 
 		// 4) Insert feedback with (message_id, user_id) uniqueness semantics.
 		fb := &domain.Feedback{
-			ID:        uuid.NewString(),
-			MessageID: messageID,
-			UserID:    userID,
-			Value:     value,
-			CreatedAt: time.Now().UTC(),
+			ID:          uuid.NewString(),
+			WorkspaceID: caller.Workspace(),
+			MessageID:   messageID,
+			UserID:      caller.UserID,
+			Value:       value,
+			CreatedAt:   time.Now().UTC(),
 		}
 		if err := tx.Create(fb).Error; err != nil {
 			// Map duplicate key to a stable service error.
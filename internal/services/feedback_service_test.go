@@ -28,7 +28,7 @@ func newTestDB(t *testing.T) *gorm.DB {
 		t.Fatalf("open sqlite: %v", err)
 	}
 	db.Exec("PRAGMA foreign_keys=ON;")
-	if err := db.AutoMigrate(&domain.Chat{}, &domain.Message{}, &domain.Feedback{}); err != nil {
+	if err := db.AutoMigrate(&domain.Chat{}, &domain.ChatShare{}, &domain.Message{}, &domain.Feedback{}); err != nil {
 		t.Fatalf("automigrate: %v", err)
 	}
 	return db
@@ -38,7 +38,7 @@ func TestFeedback_Leave_InvalidValue(t *testing.T) {
 	db := newTestDB(t)
 	svc := &FeedbackService{DB: db}
 
-	err := svc.Leave(context.Background(), "u1", "m1", 0) // not -1 or 1
+	err := svc.Leave(context.Background(), Caller{UserID: "u1"}, "m1", 0) // not -1 or 1
 	if !errors.Is(err, ErrInvalidFeedback) {
 		t.Fatalf("expected ErrInvalidFeedback, got %v", err)
 	}
@@ -49,7 +49,7 @@ func TestFeedback_Leave_MessageNotFound(t *testing.T) {
 	svc := &FeedbackService{DB: db}
 
 	// no messages seeded -> GetMessage should return not found
-	err := svc.Leave(context.Background(), "u1", "missing", 1)
+	err := svc.Leave(context.Background(), Caller{UserID: "u1"}, "missing", 1)
 	if !errors.Is(err, ErrMessageNotFound) {
 		t.Fatalf("expected ErrMessageNotFound, got %v", err)
 	}
@@ -70,9 +70,20 @@ func TestFeedback_Leave_ChatNotOwned(t *testing.T) {
 	}
 
 	svc := &FeedbackService{DB: db}
-	err := svc.Leave(context.Background(), "uX", msg.ID, 1) // uX does NOT own c1
-	if !errors.Is(err, ErrForbiddenFeedback) {
-		t.Fatalf("expected ErrForbiddenFeedback (not owner), got %v", err)
+	err := svc.Leave(context.Background(), Caller{UserID: "uX"}, msg.ID, 1) // uX does NOT own c1
+	if !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("expected ErrMessageNotFound (not owner), got %v", err)
+	}
+
+	// Once shared, uX may rate the message; an admin may too.
+	if err := repo.ShareChat(context.Background(), db, chat.ID, "uX"); err != nil {
+		t.Fatalf("share: %v", err)
+	}
+	if err := svc.Leave(context.Background(), Caller{UserID: "uX"}, msg.ID, 1); err != nil {
+		t.Fatalf("shared user feedback: %v", err)
+	}
+	if err := svc.Leave(context.Background(), Caller{UserID: "root", Admin: true}, msg.ID, -1); err != nil {
+		t.Fatalf("admin feedback: %v", err)
 	}
 }
 
@@ -90,7 +101,7 @@ func TestFeedback_Leave_NotAssistantRole(t *testing.T) {
 	}
 
 	svc := &FeedbackService{DB: db}
-	err := svc.Leave(context.Background(), "u1", msg.ID, -1)
+	err := svc.Leave(context.Background(), Caller{UserID: "u1"}, msg.ID, -1)
 	if !errors.Is(err, ErrForbiddenFeedback) {
 		t.Fatalf("expected ErrForbiddenFeedback (role=user), got %v", err)
 	}
@@ -111,12 +122,12 @@ func TestFeedback_Leave_DuplicateFeedback(t *testing.T) {
 	svc := &FeedbackService{DB: db}
 
 	// First leave: should succeed
-	if err := svc.Leave(context.Background(), "u1", msg.ID, 1); err != nil {
+	if err := svc.Leave(context.Background(), Caller{UserID: "u1"}, msg.ID, 1); err != nil {
 		t.Fatalf("first Leave failed: %v", err)
 	}
 
 	// Second leave (same user + message): should trip unique constraint
-	err := svc.Leave(context.Background(), "u1", msg.ID, -1)
+	err := svc.Leave(context.Background(), Caller{UserID: "u1"}, msg.ID, -1)
 	if !errors.Is(err, ErrDuplicateFeedback) {
 		t.Fatalf("expected ErrDuplicateFeedback, got %v", err)
 	}
@@ -135,7 +146,7 @@ func TestFeedback_Leave_Success(t *testing.T) {
 	}
 
 	svc := &FeedbackService{DB: db}
-	if err := svc.Leave(context.Background(), "u9", msg.ID, -1); err != nil {
+	if err := svc.Leave(context.Background(), Caller{UserID: "u9"}, msg.ID, -1); err != nil {
 		t.Fatalf("Leave success returned error: %v", err)
 	}
 
@@ -222,7 +233,7 @@ func TestFeedback_Leave_GetMessageUnexpectedDBError(t *testing.T) {
 	}
 
 	svc := &FeedbackService{DB: db}
-	err := svc.Leave(context.Background(), "u1", "m-any", 1)
+	err := svc.Leave(context.Background(), Caller{UserID: "u1"}, "m-any", 1)
 	if err == nil {
 		t.Fatalf("expected error from forced query callback; got nil")
 	}
@@ -248,7 +259,7 @@ func TestFeedback_Leave_CreateUnexpectedDBError(t *testing.T) {
 	}
 
 	svc := &FeedbackService{DB: db}
-	err := svc.Leave(context.Background(), "uX", msg.ID, 1)
+	err := svc.Leave(context.Background(), Caller{UserID: "uX"}, msg.ID, 1)
 	if err == nil {
 		t.Fatalf("expected error when feedbacks table is missing; got nil")
 	}
@@ -283,7 +294,7 @@ func TestFeedback_Leave_DuplicateFeedback_GormErrDuplicatedKey(t *testing.T) {
 	}
 
 	svc := &FeedbackService{DB: db}
-	got := svc.Leave(context.Background(), "uY", msg.ID, 1)
+	got := svc.Leave(context.Background(), Caller{UserID: "uY"}, msg.ID, 1)
 	if !errors.Is(got, ErrDuplicateFeedback) {
 		t.Fatalf("expected ErrDuplicateFeedback via gorm.ErrDuplicatedKey, got %v", got)
 	}
@@ -2,8 +2,10 @@
 //
 // This file implements MessageService, the application-level component that
 // owns the lifecycle of chat messages and assistant replies. It validates
-// inputs, checks chat ownership, performs retrieval over the configured
-// search.Index, and persists the user/assistant message pair atomically.
+// inputs, checks chat access, performs retrieval over the configured
+// search.Index (or the workspace's own corpus), turns the best snippets into a reply with the configured
+// generator.Generator, and persists the user/assistant message pair atomically,
+// together with the corpus sources (citations) the reply was built from.
 //
 // Optional enhancement: it also auto-generates a chat title from the first
 // user prompt when the chat still has a default/empty title.
@@ -15,15 +17,20 @@ package services
 
 import (
 	"context"
+	"errors"
 	"regexp"
+	"slices"
 	"sort"
 	"strings"
+	"time"
 	"unicode"
 	"unicode/utf8"
 
 	"gorm.io/gorm"
 
 	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/generator"
+	"github.com/tbourn/go-chat-backend/internal/pagination"
 	"github.com/tbourn/go-chat-backend/internal/repo"
 	"github.com/tbourn/go-chat-backend/internal/search"
 
@@ -40,6 +47,9 @@ const (
 	roleUser      = "user"
 	roleAssistant = "assistant"
 
+	// declineReply is the answer when retrieval finds no supporting snippet.
+	declineReply = "I can’t answer that from the provided data."
+
 	// default titles we consider “placeholder” and eligible for auto-generation
 	defaultTitleNew      = "New chat"
 	defaultTitleUntitled = "Untitled"
@@ -51,6 +61,18 @@ type MessageService struct {
 	Index     search.Index
 	Threshold float64
 
+	// Corpora resolves the corpus of workspaces that configure their own
+	// (domain.Workspace.CorpusPath). Nil means every workspace uses Index.
+	Corpora CorpusIndexes
+
+	// Generator turns retrieved snippets into the reply; nil (or a failing
+	// generator) means the extractive answer.
+	Generator generator.Generator
+
+	// HistoryTurns earlier messages are used as conversational context: to
+	// carry audience/location into follow-up queries and as generator history.
+	HistoryTurns int
+
 	// Optional guards
 	MaxPromptRunes int
 	MaxReplyRunes  int
@@ -60,81 +82,207 @@ type MessageService struct {
 	TitleMaxLen int
 }
 
+// MessageView selects the messages of a chat that listings return.
+type MessageView int
+
+const (
+	// ActiveBranch lists the conversation as currently shown: the path from
+	// the first message to the chat's active message.
+	ActiveBranch MessageView = iota
+	// AllBranches lists every message of every branch; parent IDs tell
+	// where each one belongs.
+	AllBranches
+)
+
+// Branch is one of the messages following the same parent: an edit of a user
+// message (or the original) and the conversation after it.
+type Branch struct {
+	Message domain.Message
+	// Active reports whether the branch is on the chat's active branch.
+	Active bool
+}
+
 // Answer validates prompt, verifies chat, retrieves a reply, and persists both
-// user and assistant messages atomically. It may auto-generate a chat title.
-func (s *MessageService) Answer(ctx context.Context, userID, chatID, prompt string) (*domain.Message, error) {
+// user and assistant messages atomically, at the end of the chat's active
+// branch. It may auto-generate a chat title.
+func (s *MessageService) Answer(ctx context.Context, caller Caller, chatID, prompt string) (*domain.Message, error) {
 	tr := otel.Tracer("services/MessageService")
 	ctx, span := tr.Start(ctx, "Answer",
 		trace.WithAttributes(
 			attribute.String("chat.id", chatID),
-			attribute.String("user.id", userID),
+			attribute.String("user.id", caller.UserID),
 		),
 	)
 	defer span.End()
 
 	// Normalize & validate prompt
-	prompt = strings.TrimSpace(prompt)
-	if prompt == "" {
-		return nil, ErrEmptyPrompt
+	prompt, err := s.checkPrompt(prompt)
+	if err != nil {
+		return nil, err
 	}
-	if s.MaxPromptRunes > 0 && utf8.RuneCountInString(prompt) > s.MaxPromptRunes {
-		return nil, ErrTooLong
+
+	// Ensure the chat exists and the caller may post to it
+	chat, err := s.authorize(ctx, caller, chatID, AccessWrite)
+	if err != nil {
+		return nil, err
 	}
+	return s.answer(ctx, chat, nil, prompt)
+}
 
-	// Ensure the chat exists and belongs to the user
-	chat, err := repo.GetChat(ctx, s.DB, chatID, userID)
+// Edit answers prompt as a new version of the user message messageID: the
+// prompt is stored next to it (following the same parent) with a fresh
+// reply, starting a branch that becomes the chat's active branch. The
+// original message and the conversation after it are kept. It returns the
+// reply, like Answer.
+func (s *MessageService) Edit(ctx context.Context, caller Caller, messageID, prompt string) (*domain.Message, error) {
+	tr := otel.Tracer("services/MessageService")
+	ctx, span := tr.Start(ctx, "Edit",
+		trace.WithAttributes(
+			attribute.String("message.id", messageID),
+			attribute.String("user.id", caller.UserID),
+		),
+	)
+	defer span.End()
+
+	prompt, err := s.checkPrompt(prompt)
 	if err != nil {
-		return nil, ErrChatNotFound
+		return nil, err
 	}
+	m, chat, err := s.message(ctx, caller, messageID, AccessWrite)
+	if err != nil {
+		return nil, err
+	}
+	if m.Role != roleUser {
+		return nil, ErrNotEditable
+	}
+	span.SetAttributes(attribute.String("chat.id", chat.ID))
+	return s.answer(ctx, chat, m, prompt)
+}
 
-	// Build reply from retrieval
-	reply, score := s.retrieve(ctx, prompt)
+// answer builds the reply to prompt and persists both in one transaction.
+// The prompt is appended to the chat's active branch or, when edited is set,
+// added next to edited with the history that preceded it.
+func (s *MessageService) answer(ctx context.Context, chat *domain.Chat, edited *domain.Message, prompt string) (*domain.Message, error) {
+	idx, err := s.indexFor(ctx, chat)
+	if err != nil {
+		return nil, err
+	}
+
+	// Build reply from retrieval, with follow-ups rewritten using earlier turns
+	var history []generator.Turn
+	switch {
+	case edited == nil:
+		history = s.history(ctx, chat.ID, chat.ActiveMessageID)
+	case edited.ParentID != nil:
+		history = s.history(ctx, chat.ID, edited.ParentID)
+	}
+	query := s.retrievalQuery(ctx, prompt, history)
+	reply, score, sources := s.respond(ctx, prompt, query, history, candidates(idx, query))
 
 	// Persist user + assistant (and maybe update title) in one transaction
 	var assistantMsg *domain.Message
 	err = s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		if _, err := repo.CreateMessage(tx, chatID, roleUser, prompt, nil); err != nil {
-			return err
+		var (
+			userMsg *domain.Message
+			err     error
+		)
+		if edited != nil {
+			userMsg, err = repo.CreateMessageAfter(tx, chat.ID, edited.ParentID, roleUser, prompt, nil)
+		} else {
+			// Follow the message the history was read up to.
+			userMsg = &domain.Message{ChatID: chat.ID, ParentID: chat.ActiveMessageID, Role: roleUser, Content: prompt}
+			err = repo.AppendMessage(tx, userMsg)
 		}
-		m, err := repo.CreateMessage(tx, chatID, roleAssistant, reply, score)
 		if err != nil {
 			return err
 		}
+		m, err := s.createReply(tx, chat, userMsg.ID, prompt, reply, score, sources)
 		assistantMsg = m
-
-		// Auto-title if placeholder
-		if s.shouldAutoTitle(chat.Title) {
-			gen := s.generateTitleFromPrompt(prompt)
-			if gen != "" {
-				gen = s.clipTitle(gen)
-				if uerr := tx.Model(&domain.Chat{}).Where("id = ?", chatID).Update("title", gen).Error; uerr == nil {
-					chat.Title = gen
-				}
-			}
-		}
-		return nil
+		return err
 	})
+	if errors.Is(err, repo.ErrActiveMoved) {
+		return nil, ErrBranchMoved
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	// Clip reply length if configured
-	if s.MaxReplyRunes > 0 && utf8.RuneCountInString(assistantMsg.Content) > s.MaxReplyRunes {
-		runes := []rune(assistantMsg.Content)
-		assistantMsg.Content = string(runes[:s.MaxReplyRunes])
+	assistantMsg.Content = s.clipReply(assistantMsg.Content)
+	assistantMsg.RetrievalQuery = query
+	return assistantMsg, nil
+}
+
+// retrievalQuery rewrites prompt with the conversation context (see
+// rewriteQuery) and records the result on the current span.
+func (s *MessageService) retrievalQuery(ctx context.Context, prompt string, history []generator.Turn) string {
+	query := rewriteQuery(prompt, history)
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("retrieval.query", query),
+		attribute.Bool("retrieval.rewritten", query != prompt),
+	)
+	return query
+}
+
+// checkPrompt trims prompt and enforces the non-empty and length rules.
+func (s *MessageService) checkPrompt(prompt string) (string, error) {
+	prompt = strings.TrimSpace(prompt)
+	if prompt == "" {
+		return "", ErrEmptyPrompt
+	}
+	if s.MaxPromptRunes > 0 && utf8.RuneCountInString(prompt) > s.MaxPromptRunes {
+		return "", ErrTooLong
 	}
+	return prompt, nil
+}
 
-	return assistantMsg, nil
+// createReply stores the assistant message following the user message
+// promptID, with its citations, inside tx and auto-titles the chat if it
+// still has a placeholder title.
+func (s *MessageService) createReply(tx *gorm.DB, chat *domain.Chat, promptID, prompt, reply string, score *float64, sources []search.Result) (*domain.Message, error) {
+	m := &domain.Message{ChatID: chat.ID, ParentID: &promptID, Role: roleAssistant, Content: reply, Score: score}
+	if err := repo.AppendMessage(tx, m); err != nil {
+		return nil, err
+	}
+	cites, err := repo.CreateMessageSources(tx, m.ID, citationsFrom(sources))
+	if err != nil {
+		return nil, err
+	}
+	m.Citations = cites
+
+	// Auto-title if placeholder
+	if s.shouldAutoTitle(chat.Title) {
+		gen := s.generateTitleFromPrompt(prompt)
+		if gen != "" {
+			gen = s.clipTitle(gen)
+			if uerr := tx.Model(&domain.Chat{}).Where("id = ?", chat.ID).
+				Updates(map[string]any{"title": gen, "version": gorm.Expr("version + 1")}).Error; uerr == nil {
+				chat.Title = gen
+				chat.Version++
+			}
+		}
+	}
+	return m, nil
+}
+
+// clipReply truncates a reply to MaxReplyRunes when configured.
+func (s *MessageService) clipReply(reply string) string {
+	if s.MaxReplyRunes > 0 && utf8.RuneCountInString(reply) > s.MaxReplyRunes {
+		return string([]rune(reply)[:s.MaxReplyRunes])
+	}
+	return reply
 }
 
-// ListPage returns paginated messages for a chat.
-func (s *MessageService) ListPage(ctx context.Context, chatID string, page, pageSize int) ([]domain.Message, int64, error) {
+// ListPage returns paginated messages of view for a chat the caller may read.
+func (s *MessageService) ListPage(ctx context.Context, caller Caller, chatID string, view MessageView, page, pageSize int) ([]domain.Message, int64, error) {
 	tr := otel.Tracer("services/MessageService")
 	ctx, span := tr.Start(ctx, "ListPage",
 		trace.WithAttributes(
 			attribute.String("chat.id", chatID),
+			attribute.String("user.id", caller.UserID),
 			attribute.Int("page", page),
 			attribute.Int("page_size", pageSize),
+			attribute.Bool("all_branches", view == AllBranches),
 		),
 	)
 	defer span.End()
@@ -147,16 +295,16 @@ func (s *MessageService) ListPage(ctx context.Context, chatID string, page, page
 	}
 	offset := (page - 1) * pageSize
 
-	// Ensure chat exists
-	var chatCount int64
-	if err := s.DB.WithContext(ctx).Model(&domain.Chat{}).Where("id = ?", chatID).Count(&chatCount).Error; err != nil {
+	// Ensure the chat exists and the caller may read it
+	if _, err := s.authorize(ctx, caller, chatID, AccessRead); err != nil {
 		return nil, 0, err
 	}
-	if chatCount == 0 {
-		return nil, 0, ErrChatNotFound
-	}
 
-	total, err := repo.CountMessages(s.DB.WithContext(ctx), chatID)
+	count, list := repo.CountActiveMessages, repo.ListActiveMessagesPage
+	if view == AllBranches {
+		count, list = repo.CountMessages, repo.ListMessagesPage
+	}
+	total, err := count(s.DB.WithContext(ctx), chatID)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -164,8 +312,186 @@ func (s *MessageService) ListPage(ctx context.Context, chatID string, page, page
 		return []domain.Message{}, 0, nil
 	}
 
-	items, err := repo.ListMessagesPage(s.DB.WithContext(ctx), chatID, offset, pageSize)
-	return items, total, err
+	items, err := list(s.DB.WithContext(ctx), chatID, offset, pageSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := repo.AttachCitations(s.DB.WithContext(ctx), items); err != nil {
+		return nil, 0, err
+	}
+	return items, total, nil
+}
+
+// ListKeyset returns a keyset page of messages of view of a chat the caller
+// may read, with their citations, and whether more follow in the paging
+// direction. Unlike ListPage it runs no COUNT, and pages do not shift when
+// messages are posted in between.
+func (s *MessageService) ListKeyset(ctx context.Context, caller Caller, chatID string, view MessageView, p pagination.Page) ([]domain.Message, bool, error) {
+	tr := otel.Tracer("services/MessageService")
+	ctx, span := tr.Start(ctx, "ListKeyset",
+		trace.WithAttributes(
+			attribute.String("chat.id", chatID),
+			attribute.String("user.id", caller.UserID),
+			attribute.Bool("backward", p.Backward),
+			attribute.Int("page_size", p.Limit),
+			attribute.Bool("all_branches", view == AllBranches),
+		),
+	)
+	defer span.End()
+
+	if p.Limit <= 0 {
+		p.Limit = 20
+	}
+	if _, err := s.authorize(ctx, caller, chatID, AccessRead); err != nil {
+		return nil, false, err
+	}
+
+	list := repo.ListActiveMessagesKeyset
+	if view == AllBranches {
+		list = repo.ListMessagesKeyset
+	}
+	items, more, err := list(s.DB.WithContext(ctx), chatID, p)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := repo.AttachCitations(s.DB.WithContext(ctx), items); err != nil {
+		return nil, false, err
+	}
+	if items == nil {
+		items = []domain.Message{}
+	}
+	return items, more, nil
+}
+
+// Stats returns the message count and latest update of view of a chat the
+// caller may read, for conditional responses (ETags).
+func (s *MessageService) Stats(ctx context.Context, caller Caller, chatID string, view MessageView) (int64, *time.Time, error) {
+	if _, err := s.authorize(ctx, caller, chatID, AccessRead); err != nil {
+		return 0, nil, err
+	}
+	if view == AllBranches {
+		return repo.MessagesStats(ctx, s.DB, chatID)
+	}
+	return repo.ActiveMessagesStats(ctx, s.DB, chatID)
+}
+
+// ListBranches returns the branches at messageID, a message of a chat the
+// caller may read: the message and the others following the same parent
+// (its edits and the original), oldest first.
+func (s *MessageService) ListBranches(ctx context.Context, caller Caller, messageID string) ([]Branch, error) {
+	tr := otel.Tracer("services/MessageService")
+	ctx, span := tr.Start(ctx, "ListBranches",
+		trace.WithAttributes(
+			attribute.String("message.id", messageID),
+			attribute.String("user.id", caller.UserID),
+		),
+	)
+	defer span.End()
+
+	m, chat, err := s.message(ctx, caller, messageID, AccessRead)
+	if err != nil {
+		return nil, err
+	}
+	siblings, err := repo.ListSiblings(ctx, s.DB, m)
+	if err != nil {
+		return nil, err
+	}
+	active, err := repo.ListActivePathIDs(ctx, s.DB, chat.ID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Branch, len(siblings))
+	for i, sib := range siblings {
+		out[i] = Branch{Message: sib, Active: slices.Contains(active, sib.ID)}
+	}
+	return out, nil
+}
+
+// SelectBranch makes the branch through messageID, a message of chatID, the
+// chat's active branch. The branch ends at its newest message, so switching
+// back to a branch shows it as it was left. The caller needs write access.
+func (s *MessageService) SelectBranch(ctx context.Context, caller Caller, chatID, messageID string) error {
+	tr := otel.Tracer("services/MessageService")
+	ctx, span := tr.Start(ctx, "SelectBranch",
+		trace.WithAttributes(
+			attribute.String("chat.id", chatID),
+			attribute.String("message.id", messageID),
+			attribute.String("user.id", caller.UserID),
+		),
+	)
+	defer span.End()
+
+	chat, err := s.authorize(ctx, caller, chatID, AccessWrite)
+	if err != nil {
+		return err
+	}
+	m, err := repo.GetMessage(s.DB.WithContext(ctx), chat.WorkspaceID, messageID)
+	if err != nil {
+		if isNotFound(err) {
+			return ErrMessageNotFound
+		}
+		return err
+	}
+	if m.ChatID != chat.ID {
+		return ErrMessageNotFound
+	}
+	leaf, err := repo.LatestDescendant(ctx, s.DB, m.ID)
+	if err != nil {
+		return err
+	}
+	return repo.SetActiveMessage(ctx, s.DB, chat.ID, leaf)
+}
+
+// message loads messageID and its chat, which the caller needs access to.
+// Messages of chats the caller cannot see are reported as ErrMessageNotFound.
+func (s *MessageService) message(ctx context.Context, caller Caller, messageID string, access Access) (*domain.Message, *domain.Chat, error) {
+	m, err := repo.GetMessage(s.DB.WithContext(ctx), caller.Workspace(), messageID)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, nil, ErrMessageNotFound
+		}
+		return nil, nil, err
+	}
+	chat, err := s.authorize(ctx, caller, m.ChatID, access)
+	if errors.Is(err, ErrChatNotFound) {
+		return nil, nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return m, chat, nil
+}
+
+// Authorize reports whether caller may perform access on chatID, returning
+// ErrChatNotFound or ErrForbidden otherwise. Handlers use it to guard
+// shortcuts that bypass the service, such as idempotent replays.
+func (s *MessageService) Authorize(ctx context.Context, caller Caller, chatID string, access Access) error {
+	_, err := s.authorize(ctx, caller, chatID, access)
+	return err
+}
+
+// authorize applies the chat access policy (see authz.go).
+func (s *MessageService) authorize(ctx context.Context, caller Caller, chatID string, access Access) (*domain.Chat, error) {
+	return authorizeChat(ctx, s.DB, repoLookup{}, caller, chatID, access)
+}
+
+// citationsFrom converts the retrieval results a reply was built from into
+// message sources (rank follows slice order).
+func citationsFrom(rs []search.Result) []domain.MessageSource {
+	if len(rs) == 0 {
+		return nil
+	}
+	out := make([]domain.MessageSource, len(rs))
+	for i, r := range rs {
+		out[i] = domain.MessageSource{
+			DocID:   r.DocID,
+			Source:  r.Source,
+			Line:    r.Line,
+			Score:   r.Score,
+			Snippet: r.Snippet,
+		}
+	}
+	return out
 }
 
 // --- Retrieval with precision filtering and re-ranking ---
@@ -177,29 +503,125 @@ func (s *MessageService) ListPage(ctx context.Context, chatID string, page, page
 //  4. Build STRONG entities = long/number entities + compound caps ("Gen Z", "United States")
 //     + single proper nouns (capitalized len>=4, e.g., "Nashville").
 //  5. Compute overlap (Jaccard + small phrase boosts) and blend with normalized index score.
-//  6. Gates: require a content-term hit; enforce strict strong-entity coverage (when query is specific).
-//  7. Return 1–2 snippets; only add the second if it matches the same strong entities as top.
-func (s *MessageService) retrieve(ctx context.Context, prompt string) (reply string, score *float64) {
-	tr := otel.Tracer("services/MessageService")
-	_, span := tr.Start(ctx, "retrieve",
-		trace.WithAttributes(attribute.String("query", prompt)),
+//  6. Gates: drop facts about another audience or location than the prompt names (see factGate);
+//     require a content-term hit; enforce strict strong-entity coverage (when query is specific).
+//  7. Select 1–2 snippets; only add the second if it matches the same strong entities as top.
+//  8. Turn the snippets into a reply with the configured Generator.
+//
+// sources holds the index results the reply was built from, in reply order.
+func (s *MessageService) retrieve(ctx context.Context, prompt string) (reply string, score *float64, sources []search.Result) {
+	return s.respond(ctx, prompt, prompt, nil, candidates(s.Index, prompt))
+}
+
+// respond ranks the results of query (steps 2–7) and generates the reply to
+// prompt (step 8), or declines when no snippet survives the gates.
+func (s *MessageService) respond(ctx context.Context, prompt, query string, history []generator.Turn, results []search.Result) (reply string, score *float64, sources []search.Result) {
+	snippets, score, sources := s.rank(ctx, query, results)
+	if len(snippets) == 0 {
+		return declineReply, nil, nil
+	}
+	return s.generate(ctx, generator.Request{Prompt: prompt, History: history, Snippets: snippets}), score, sources
+}
+
+// generate asks the configured Generator for a reply, falling back to the
+// extractive answer when it is unset, fails or returns nothing.
+func (s *MessageService) generate(ctx context.Context, req generator.Request) string {
+	if s.Generator != nil {
+		tr := otel.Tracer("services/MessageService")
+		gctx, span := tr.Start(ctx, "generate",
+			trace.WithAttributes(attribute.Int("generate.history", len(req.History)), attribute.Int("generate.snippets", len(req.Snippets))),
+		)
+		reply, err := s.Generator.Generate(gctx, req)
+		if reply = strings.TrimSpace(reply); err == nil && reply != "" {
+			span.End()
+			return reply
+		}
+		if err != nil {
+			span.RecordError(err)
+		}
+		span.SetAttributes(attribute.Bool("generate.fallback", true))
+		span.End()
+	}
+	reply, _ := generator.Extractive{}.Generate(ctx, req)
+	return reply
+}
+
+// history returns up to HistoryTurns messages of the path ending at leafID,
+// oldest first. Without leafID the chat has no messages or is not linked into
+// a tree yet (see repo.EnsureMessageTree), and its latest messages are used.
+// Errors yield no history rather than failing the answer.
+func (s *MessageService) history(ctx context.Context, chatID string, leafID *string) []generator.Turn {
+	if s.HistoryTurns <= 0 {
+		return nil
+	}
+	var (
+		msgs []domain.Message
+		err  error
 	)
-	defer span.End()
+	if leafID != nil {
+		msgs, err = repo.ListPathMessages(s.DB.WithContext(ctx), *leafID, s.HistoryTurns)
+	} else {
+		msgs, err = repo.ListRecentMessages(s.DB.WithContext(ctx), chatID, s.HistoryTurns)
+	}
+	if err != nil {
+		return nil
+	}
+	turns := make([]generator.Turn, 0, len(msgs))
+	for _, m := range msgs {
+		turns = append(turns, generator.Turn{Role: m.Role, Content: m.Content})
+	}
+	return turns
+}
 
-	if s.Index == nil {
-		return "I can’t answer that from the provided data.", nil
+// indexFor returns the index chat's workspace answers from: its own corpus
+// when it configures one (and Corpora is set), the shared Index otherwise. A
+// configured corpus that cannot be loaded is an error rather than a silent
+// fallback to another corpus.
+func (s *MessageService) indexFor(ctx context.Context, chat *domain.Chat) (search.Index, error) {
+	if s.Corpora == nil || chat.WorkspaceID == "" || chat.WorkspaceID == domain.DefaultWorkspaceID {
+		return s.Index, nil
 	}
+	w, err := repo.FindWorkspace(ctx, s.DB, chat.WorkspaceID)
+	if err != nil {
+		if isNotFound(err) {
+			return s.Index, nil
+		}
+		return nil, err
+	}
+	if w.CorpusPath == "" {
+		return s.Index, nil
+	}
+	return s.Corpora.Index(w.CorpusPath)
+}
 
-	// Pull more candidates than we will answer with
+// candidates pulls more results than we will answer with (step 1) from idx,
+// retrying with a keyword-only query when the full prompt finds nothing.
+func candidates(idx search.Index, prompt string) []search.Result {
+	if idx == nil {
+		return nil
+	}
 	const K = 10
-	results := s.Index.TopK(prompt, K)
+	results := idx.TopK(prompt, K)
 	if len(results) == 0 {
 		if simplified := simplifyQuery(prompt); simplified != "" && simplified != prompt {
-			results = s.Index.TopK(simplified, K)
+			results = idx.TopK(simplified, K)
 		}
 	}
+	return results
+}
+
+// rank applies steps 2–7 to the candidates of prompt and returns the selected
+// snippet texts (none when declining) with their index results.
+func (s *MessageService) rank(ctx context.Context, prompt string, results []search.Result) (snippets []string, score *float64, sources []search.Result) {
+	tr := otel.Tracer("services/MessageService")
+	_, span := tr.Start(ctx, "retrieve",
+		trace.WithAttributes(attribute.String("query", prompt)),
+	)
+	defer span.End()
+
+	results = factGate(prompt, results)
 	if len(results) == 0 {
-		return "I can’t answer that from the provided data.", nil
+		return nil, nil, nil
 	}
 
 	// Extract query terms/entities
@@ -344,6 +766,7 @@ func (s *MessageService) retrieve(ctx context.Context, prompt string) (reply str
 	}
 
 	type cand struct {
+		res          search.Result
 		text         string
 		indexScore   float64
 		overlapRel   float64
@@ -398,6 +821,7 @@ func (s *MessageService) retrieve(ctx context.Context, prompt string) (reply str
 		}
 
 		cands = append(cands, cand{
+			res:          r,
 			text:         clean,
 			indexScore:   r.Score,
 			overlapRel:   ov,
@@ -408,7 +832,7 @@ func (s *MessageService) retrieve(ctx context.Context, prompt string) (reply str
 
 	// NEW: decline if nothing passes the precision gates
 	if len(cands) == 0 {
-		return "I can’t answer that from the provided data.", nil
+		return nil, nil, nil
 	}
 
 	// Sort by combined descending
@@ -422,11 +846,12 @@ func (s *MessageService) retrieve(ctx context.Context, prompt string) (reply str
 		thr = 0.20
 	}
 	if top.indexScore < thr {
-		return "I can’t answer that from the provided data.", nil
+		return nil, nil, nil
 	}
 
 	// Only add a second if it's close AND covers at least the same strong entities as top.
-	out := top.text
+	snippets = []string{top.text}
+	sources = []search.Result{top.res}
 	if len(cands) > 1 && cands[1].combined >= top.combined*0.9 {
 		ok := true
 		for e := range top.strongEntHit {
@@ -436,12 +861,48 @@ func (s *MessageService) retrieve(ctx context.Context, prompt string) (reply str
 			}
 		}
 		if ok {
-			out = out + "\n" + cands[1].text
+			snippets = append(snippets, cands[1].text)
+			sources = append(sources, cands[1].res)
 		}
 	}
 
 	v := top.indexScore
-	return collapseWhitespaceLines(out), &v
+	return snippets, &v, sources
+}
+
+// factGate drops results whose parsed fact (search.Result.Fact) is about
+// another audience or location than the prompt asks for. A field filters
+// only when the prompt names its value for at least one result, so prompts
+// that name neither, and results without a fact or a location, pass.
+func factGate(prompt string, results []search.Result) []search.Result {
+	words := " " + strings.Join(alnumRE.FindAllString(strings.ToLower(prompt), -1), " ") + " "
+	named := func(v string) bool {
+		phrase := strings.Join(alnumRE.FindAllString(strings.ToLower(v), -1), " ")
+		return phrase != "" && strings.Contains(words, " "+phrase+" ")
+	}
+	var audience, location bool
+	for _, r := range results {
+		if r.Fact != nil {
+			audience = audience || named(r.Fact.Audience)
+			location = location || (r.Fact.Location != "" && named(r.Fact.Location))
+		}
+	}
+	if !audience && !location {
+		return results
+	}
+	out := results[:0:0]
+	for _, r := range results {
+		if f := r.Fact; f != nil {
+			if audience && !named(f.Audience) {
+				continue
+			}
+			if location && f.Location != "" && !named(f.Location) {
+				continue
+			}
+		}
+		out = append(out, r)
+	}
+	return out
 }
 
 // shouldAutoTitle reports whether the current title is a placeholder.
@@ -600,25 +1061,6 @@ func stripMarkdownTablesToLines(s string) string {
 	return strings.Join(out, "\n")
 }
 
-// collapseWhitespaceLines trims each line, collapses internal whitespace to a single
-// space, and drops empty lines entirely.
-func collapseWhitespaceLines(s string) string {
-	if s == "" {
-		return ""
-	}
-	s = strings.ReplaceAll(s, "\r\n", "\n")
-	raw := strings.Split(s, "\n")
-	out := make([]string, 0, len(raw))
-	for _, ln := range raw {
-		parts := strings.Fields(ln)
-		if len(parts) == 0 {
-			continue
-		}
-		out = append(out, strings.Join(parts, " "))
-	}
-	return strings.Join(out, "\n")
-}
-
 // --- Precision helpers ---
 
 var (
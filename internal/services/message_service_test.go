@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -16,6 +17,7 @@ import (
 	"gorm.io/gorm/logger"
 
 	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/generator"
 	"github.com/tbourn/go-chat-backend/internal/search"
 )
 
@@ -64,7 +66,7 @@ func mkIdx(entries map[string][]search.Result) search.Index {
 func TestMessageService_Answer_EmptyPrompt(t *testing.T) {
 	db := newMsgDB(t, &domain.Chat{}, &domain.Message{})
 	s := &MessageService{DB: db}
-	_, err := s.Answer(context.Background(), "u1", "c1", "   ")
+	_, err := s.Answer(context.Background(), Caller{UserID: "u1"}, "c1", "   ")
 	if err == nil || err != ErrEmptyPrompt {
 		t.Fatalf("expected ErrEmptyPrompt, got %v", err)
 	}
@@ -73,7 +75,7 @@ func TestMessageService_Answer_EmptyPrompt(t *testing.T) {
 func TestMessageService_Answer_TooLong(t *testing.T) {
 	db := newMsgDB(t, &domain.Chat{}, &domain.Message{})
 	s := &MessageService{DB: db, MaxPromptRunes: 3}
-	_, err := s.Answer(context.Background(), "u1", "c1", "abcd")
+	_, err := s.Answer(context.Background(), Caller{UserID: "u1"}, "c1", "abcd")
 	if err == nil || err != ErrTooLong {
 		t.Fatalf("expected ErrTooLong, got %v", err)
 	}
@@ -83,14 +85,14 @@ func TestMessageService_Answer_ChatNotFound(t *testing.T) {
 	// Migrate tables but do NOT insert the chat
 	db := newMsgDB(t, &domain.Chat{}, &domain.Message{})
 	s := &MessageService{DB: db}
-	_, err := s.Answer(context.Background(), "uX", "c-missing", "hello")
+	_, err := s.Answer(context.Background(), Caller{UserID: "uX"}, "c-missing", "hello")
 	if err == nil || err != ErrChatNotFound {
 		t.Fatalf("expected ErrChatNotFound, got %v", err)
 	}
 }
 
 func TestMessageService_Answer_Success_AutoTitle_And_ClipReply(t *testing.T) {
-	db := newMsgDB(t, &domain.Chat{}, &domain.Message{})
+	db := newMsgDB(t, &domain.Chat{}, &domain.Message{}, &domain.MessageSource{})
 	// Chat owned by u1 with placeholder title → triggers auto-title
 	chat := &domain.Chat{ID: "c1", UserID: "u1", Title: "New chat"}
 	if err := db.Create(chat).Error; err != nil {
@@ -117,7 +119,7 @@ func TestMessageService_Answer_Success_AutoTitle_And_ClipReply(t *testing.T) {
 		MaxPromptRunes: 0,
 	}
 
-	got, err := s.Answer(context.Background(), "u1", "c1", prompt)
+	got, err := s.Answer(context.Background(), Caller{UserID: "u1"}, "c1", prompt)
 	if err != nil {
 		t.Fatalf("Answer error: %v", err)
 	}
@@ -147,7 +149,7 @@ func TestMessageService_ListPage_DBErrorOnChatCount(t *testing.T) {
 	// DB without Chat table -> first Count() errors
 	db := newMsgDB(t /* no migrate */)
 	s := &MessageService{DB: db}
-	_, _, err := s.ListPage(context.Background(), "c1", 1, 10)
+	_, _, err := s.ListPage(context.Background(), Caller{UserID: "u1"}, "c1", ActiveBranch, 1, 10)
 	if err == nil {
 		t.Fatalf("expected error due to missing chats table")
 	}
@@ -160,14 +162,14 @@ func TestMessageService_ListPage_CountMessagesError(t *testing.T) {
 		t.Fatalf("seed chat: %v", err)
 	}
 	s := &MessageService{DB: db}
-	_, _, err := s.ListPage(context.Background(), "c1", 1, 10)
+	_, _, err := s.ListPage(context.Background(), Caller{UserID: "u1"}, "c1", ActiveBranch, 1, 10)
 	if err == nil {
 		t.Fatalf("expected error due to missing messages table")
 	}
 }
 
 func TestMessageService_ListPage_TotalZero_And_Success(t *testing.T) {
-	db := newMsgDB(t, &domain.Chat{}, &domain.Message{})
+	db := newMsgDB(t, &domain.Chat{}, &domain.Message{}, &domain.MessageSource{})
 	if err := db.Create(&domain.Chat{ID: "c2", UserID: "u1", Title: "t"}).Error; err != nil {
 		t.Fatalf("seed chat: %v", err)
 	}
@@ -175,7 +177,7 @@ func TestMessageService_ListPage_TotalZero_And_Success(t *testing.T) {
 	s := &MessageService{DB: db}
 
 	// total==0 branch
-	items, total, err := s.ListPage(context.Background(), "c2", 0, 0) // defaults page=1,size=20
+	items, total, err := s.ListPage(context.Background(), Caller{UserID: "u1"}, "c2", ActiveBranch, 0, 0) // defaults page=1,size=20
 	if err != nil {
 		t.Fatalf("ListPage error: %v", err)
 	}
@@ -196,7 +198,7 @@ func TestMessageService_ListPage_TotalZero_And_Success(t *testing.T) {
 		}
 	}
 
-	pageItems, total2, err := s.ListPage(context.Background(), "c2", -5, -7) // defaults to 1/20
+	pageItems, total2, err := s.ListPage(context.Background(), Caller{UserID: "u1"}, "c2", ActiveBranch, -5, -7) // defaults to 1/20
 	if err != nil {
 		t.Fatalf("ListPage success error: %v", err)
 	}
@@ -208,7 +210,7 @@ func TestMessageService_ListPage_TotalZero_And_Success(t *testing.T) {
 func TestMessageService_ListPage_ChatNotFound(t *testing.T) {
 	db := newMsgDB(t, &domain.Chat{}, &domain.Message{})
 	s := &MessageService{DB: db}
-	_, _, err := s.ListPage(context.Background(), "nope", 1, 10)
+	_, _, err := s.ListPage(context.Background(), Caller{UserID: "u1"}, "nope", ActiveBranch, 1, 10)
 	if err == nil || err != ErrChatNotFound {
 		t.Fatalf("expected ErrChatNotFound, got %v", err)
 	}
@@ -218,7 +220,7 @@ func TestMessageService_ListPage_ChatNotFound(t *testing.T) {
 
 func TestRetrieve_IndexNil_And_NoCandidatesAfterFallback(t *testing.T) {
 	s := &MessageService{Index: nil}
-	r, sc := s.retrieve(context.Background(), "anything")
+	r, sc, _ := s.retrieve(context.Background(), "anything")
 	if sc != nil || r == "" || !strings.Contains(r, "can’t answer") {
 		t.Fatalf("nil index should decline, got %q score=%v", r, sc)
 	}
@@ -228,7 +230,7 @@ func TestRetrieve_IndexNil_And_NoCandidatesAfterFallback(t *testing.T) {
 		"gen z nashville": {}, // simplified returns empty too
 	})
 	s2 := &MessageService{Index: idx}
-	r2, sc2 := s2.retrieve(context.Background(), `What do Gen Z in Nashville do?`)
+	r2, sc2, _ := s2.retrieve(context.Background(), `What do Gen Z in Nashville do?`)
 	if sc2 != nil || !strings.Contains(r2, "can’t answer") {
 		t.Fatalf("empty results should decline, got %q score=%v", r2, sc2)
 	}
@@ -242,7 +244,7 @@ func TestRetrieve_ThresholdFail_And_TwoSnippetMerge(t *testing.T) {
 		},
 	})
 	s1 := &MessageService{Index: idx1, Threshold: 0.9}
-	r1, sc1 := s1.retrieve(context.Background(), "Gen Z Nashville streaming")
+	r1, sc1, _ := s1.retrieve(context.Background(), "Gen Z Nashville streaming")
 	if sc1 != nil || !strings.Contains(r1, "can’t answer") {
 		t.Fatalf("below threshold should decline, got %q score=%v", r1, sc1)
 	}
@@ -256,7 +258,7 @@ func TestRetrieve_ThresholdFail_And_TwoSnippetMerge(t *testing.T) {
 		},
 	})
 	s2 := &MessageService{Index: idx2, Threshold: 0.1}
-	out, score := s2.retrieve(context.Background(), prompt)
+	out, score, _ := s2.retrieve(context.Background(), prompt)
 	if score == nil || !strings.Contains(out, "\n") {
 		t.Fatalf("expected merged two-line output with score set, got %q score=%v", out, score)
 	}
@@ -274,7 +276,7 @@ func TestRetrieve_ContentOrEntityGateRemovesAllCandidates(t *testing.T) {
 		},
 	})
 	s := &MessageService{Index: idx}
-	out, sc := s.retrieve(context.Background(), prompt)
+	out, sc, _ := s.retrieve(context.Background(), prompt)
 	if sc != nil || !strings.Contains(out, "can’t answer") {
 		t.Fatalf("expected decline due to content-term gate, got %q score=%v", out, sc)
 	}
@@ -332,7 +334,7 @@ func TestSimplifyQuery(t *testing.T) {
 	}
 }
 
-func TestStripMarkdownTablesAndCollapseWhitespace(t *testing.T) {
+func TestStripMarkdownTablesToLines(t *testing.T) {
 	md := `
 | text | value |
 | --- | --- |
@@ -351,11 +353,6 @@ Some line
 	if !strings.Contains(clean, "Gen Z Nashville") || !strings.Contains(clean, "row 2") {
 		t.Fatalf("table rows not joined: %q", clean)
 	}
-
-	ws := " a \r\n \n b \n\n c "
-	if got := collapseWhitespaceLines(ws); got != "a\nb\nc" {
-		t.Fatalf("collapseWhitespaceLines failed: %q", got)
-	}
 }
 
 func TestExtractQueryTerms_NumberCapsLong_and_OverlapRelevance(t *testing.T) {
@@ -403,7 +400,7 @@ func TestIsNumber_IsCapitalized(t *testing.T) {
 // ---------- Answer(): title update failure branch ----------
 
 func TestMessageService_Answer_AutoTitle_UpdateFails_NoPanic(t *testing.T) {
-	db := newMsgDB(t, &domain.Chat{}, &domain.Message{})
+	db := newMsgDB(t, &domain.Chat{}, &domain.Message{}, &domain.MessageSource{})
 
 	// Seed chat with placeholder title (auto-title should attempt an Update).
 	chat := &domain.Chat{ID: "cUpd", UserID: "u1", Title: "New chat"}
@@ -411,9 +408,9 @@ func TestMessageService_Answer_AutoTitle_UpdateFails_NoPanic(t *testing.T) {
 		t.Fatalf("seed chat: %v", err)
 	}
 
-	// Force ONLY the chat UPDATE to fail (transaction should still succeed).
+	// Force ONLY the chat title UPDATE to fail (transaction should still succeed).
 	if err := db.Callback().Update().Before("gorm:update").Register("force_update_error_chats", func(tx *gorm.DB) {
-		if tx.Statement != nil && strings.Contains(tx.Statement.Table, "chats") {
+		if tx.Statement != nil && strings.Contains(tx.Statement.Table, "chats") && tx.Statement.Changed("Title") {
 			tx.AddError(errors.New("forced-update-error"))
 		}
 	}); err != nil {
@@ -436,7 +433,7 @@ func TestMessageService_Answer_AutoTitle_UpdateFails_NoPanic(t *testing.T) {
 		TitleMaxLen:   20,
 	}
 
-	got, err := s.Answer(context.Background(), "u1", "cUpd", prompt)
+	got, err := s.Answer(context.Background(), Caller{UserID: "u1"}, "cUpd", prompt)
 	if err != nil {
 		t.Fatalf("Answer returned error despite update failure: %v", err)
 	}
@@ -468,7 +465,7 @@ func TestRetrieve_StrongEntityOne_FallbackByOverlap(t *testing.T) {
 	})
 	s := &MessageService{Index: idx} // default Threshold=0.20 applies to raw score (0.30 >= 0.20)
 
-	out, sc := s.retrieve(context.Background(), prompt)
+	out, sc, _ := s.retrieve(context.Background(), prompt)
 	if sc == nil || !strings.Contains(strings.ToLower(out), "apps") {
 		t.Fatalf("expected fallback accept via overlap, got out=%q score=%v", out, sc)
 	}
@@ -485,7 +482,7 @@ func TestRetrieve_SecondCandidate_NotMerged_When_StrongEntitiesMismatch(t *testi
 		},
 	})
 	s := &MessageService{Index: idx, Threshold: 0.10}
-	out, _ := s.retrieve(context.Background(), prompt)
+	out, _, _ := s.retrieve(context.Background(), prompt)
 	if strings.Contains(out, "\n") {
 		t.Fatalf("second candidate should NOT merge due to missing strong entities; got %q", out)
 	}
@@ -502,7 +499,7 @@ func TestRetrieve_NoStrongEntities_LowOverlap_ShortSnippet_Rejected(t *testing.T
 		},
 	})
 	s := &MessageService{Index: idx}
-	out, sc := s.retrieve(context.Background(), prompt)
+	out, sc, _ := s.retrieve(context.Background(), prompt)
 	if sc != nil || !strings.Contains(out, "can’t answer") {
 		t.Fatalf("expected decline for short+low-overlap with no strong entities, got %q score=%v", out, sc)
 	}
@@ -517,14 +514,6 @@ func TestGenerateTitleFromPrompt_AllStopwords_Empty(t *testing.T) {
 	}
 }
 
-// ---------- collapseWhitespaceLines(): empty fast-path ----------
-
-func TestCollapseWhitespaceLines_EmptyInput(t *testing.T) {
-	if got := collapseWhitespaceLines(""); got != "" {
-		t.Fatalf("expected empty output for empty input, got %q", got)
-	}
-}
-
 // ---------- overlapRelevance(): no tokens -> 0 ----------
 
 func TestOverlapRelevance_NoTokens_ReturnsZero(t *testing.T) {
@@ -567,7 +556,7 @@ func TestMessageService_Answer_NoAutoTitle_CustomTitle(t *testing.T) {
 	})
 
 	s := &MessageService{DB: db, Index: idx}
-	msg, err := s.Answer(context.Background(), "u1", "cNoAuto", prompt)
+	msg, err := s.Answer(context.Background(), Caller{UserID: "u1"}, "cNoAuto", prompt)
 	if err != nil {
 		t.Fatalf("Answer error: %v", err)
 	}
@@ -595,7 +584,7 @@ func TestRetrieve_StrongEntityOne_RejectedWhenOverlapLow(t *testing.T) {
 		},
 	})
 	s := &MessageService{Index: idx, Threshold: 0.1}
-	out, sc := s.retrieve(context.Background(), prompt)
+	out, sc, _ := s.retrieve(context.Background(), prompt)
 	if sc != nil || !strings.Contains(out, "can’t answer") {
 		t.Fatalf("expected rejection (requiredHits==1 & low ov), got %q score=%v", out, sc)
 	}
@@ -613,7 +602,7 @@ func TestRetrieve_TwoStrongEntities_RejectWhenOneMissing(t *testing.T) {
 		},
 	})
 	s := &MessageService{Index: idx}
-	out, sc := s.retrieve(context.Background(), prompt)
+	out, sc, _ := s.retrieve(context.Background(), prompt)
 	if sc != nil || !strings.Contains(out, "can’t answer") {
 		t.Fatalf("expected rejection due to missing second strong entity, got %q score=%v", out, sc)
 	}
@@ -662,3 +651,297 @@ func TestOverlapRelevance_ClampToOne(t *testing.T) {
 		t.Fatalf("expected score clamped to 1.0, got %v", score)
 	}
 }
+
+func TestFactGate_FiltersOnAudienceAndLocation(t *testing.T) {
+	fact := func(text string) search.Result {
+		f := search.ParseFact(text)
+		r := search.Result{Snippet: text, Score: 0.5}
+		if f.Parsed() {
+			r.Fact = &f
+		}
+		return r
+	}
+	results := []search.Result{
+		fact("40% of Gen Z in Nashville use TikTok daily."),
+		fact("35% of Gen Z in Austin use TikTok daily."),
+		fact("20% of Millennials in Nashville use TikTok daily."),
+		fact("30% of Gen Z use TikTok daily."),
+		fact("TikTok is a video app."),
+	}
+	snippets := func(rs []search.Result) []string {
+		out := make([]string, len(rs))
+		for i, r := range rs {
+			out[i] = r.Snippet
+		}
+		return out
+	}
+
+	got := snippets(factGate("What share of Gen Z in Nashville use TikTok?", results))
+	want := []string{results[0].Snippet, results[3].Snippet, results[4].Snippet}
+	if !slices.Equal(got, want) {
+		t.Fatalf("gate = %q, want %q", got, want)
+	}
+	// "Austin" as part of another word is not a mention.
+	if got := factGate("How do Austinites use TikTok?", results); len(got) != len(results) {
+		t.Fatalf("unnamed fields must not filter: %q", snippets(got))
+	}
+}
+
+// ---------- citations ----------
+
+func TestMessageService_Answer_StoresCitations_ListPageReturnsThem(t *testing.T) {
+	db := newMsgDB(t, &domain.Chat{}, &domain.Message{}, &domain.MessageSource{})
+	if err := db.Create(&domain.Chat{ID: "c1", UserID: "u1", Title: "t"}).Error; err != nil {
+		t.Fatalf("seed chat: %v", err)
+	}
+	prompt := `Gen Z in Nashville spend on streaming platforms`
+	idx := mkIdx(map[string][]search.Result{
+		prompt: {
+			{Snippet: "In Nashville, Gen Z spend more on streaming platforms.", Score: 0.8, DocID: "d1", Source: "data.md", Line: 4},
+			{Snippet: "Gen Z in Nashville show strong adoption of streaming platforms.", Score: 0.79, DocID: "d2", Source: "data.md", Line: 12},
+		},
+	})
+	s := &MessageService{DB: db, Index: idx, Threshold: 0.05}
+
+	got, err := s.Answer(context.Background(), Caller{UserID: "u1"}, "c1", prompt)
+	if err != nil {
+		t.Fatalf("Answer: %v", err)
+	}
+	// One citation per snippet in the reply.
+	if n := len(strings.Split(got.Content, "\n")); len(got.Citations) != n {
+		t.Fatalf("reply has %d snippets but %d citations", n, len(got.Citations))
+	}
+	if c := got.Citations[0]; c.DocID != "d1" || c.Source != "data.md" || c.Line != 4 || c.Score != 0.8 || c.Rank != 0 {
+		t.Fatalf("unexpected citations on reply: %+v", got.Citations)
+	}
+
+	items, _, err := s.ListPage(context.Background(), Caller{UserID: "u1"}, "c1", ActiveBranch, 1, 10)
+	if err != nil {
+		t.Fatalf("ListPage: %v", err)
+	}
+	if len(items) != 2 || items[0].Citations != nil || len(items[1].Citations) != len(got.Citations) || items[1].Citations[0].DocID != "d1" {
+		t.Fatalf("unexpected listed citations: %+v", items)
+	}
+
+	// A declined answer has no sources.
+	if _, _, src := s.retrieve(context.Background(), "nothing matches"); src != nil {
+		t.Fatalf("expected no sources, got %+v", src)
+	}
+}
+
+// ---------- generator ----------
+
+type stubGenerator struct {
+	reply string
+	err   error
+	calls []generator.Request
+}
+
+func (g *stubGenerator) Generate(_ context.Context, req generator.Request) (string, error) {
+	g.calls = append(g.calls, req)
+	return g.reply, g.err
+}
+
+func TestMessageService_Answer_UsesGeneratorWithHistory_FallsBackOnError(t *testing.T) {
+	db := newMsgDB(t, &domain.Chat{}, &domain.Message{}, &domain.MessageSource{})
+	if err := db.Create(&domain.Chat{ID: "c1", UserID: "u1", Title: "t"}).Error; err != nil {
+		t.Fatalf("seed chat: %v", err)
+	}
+	base := time.Now().UTC().Add(-time.Hour)
+	for i, m := range []struct{ role, content string }{{"user", "old question"}, {"assistant", "old answer"}, {"user", "follow-up"}} {
+		if err := db.Create(&domain.Message{ID: fmt.Sprintf("m%d", i), ChatID: "c1", Role: m.role, Content: m.content, CreatedAt: base.Add(time.Duration(i) * time.Minute)}).Error; err != nil {
+			t.Fatalf("seed message: %v", err)
+		}
+	}
+	prompt := `Gen Z in Nashville spend on streaming platforms`
+	idx := mkIdx(map[string][]search.Result{
+		prompt: {{Snippet: "In Nashville, Gen Z spend more on streaming platforms.", Score: 0.8, DocID: "d1"}},
+	})
+	gen := &stubGenerator{reply: "  Gen Z in Nashville lead on streaming.  "}
+	s := &MessageService{DB: db, Index: idx, Threshold: 0.05, Generator: gen, HistoryTurns: 2}
+
+	got, err := s.Answer(context.Background(), Caller{UserID: "u1"}, "c1", prompt)
+	if err != nil {
+		t.Fatalf("Answer: %v", err)
+	}
+	if got.Content != "Gen Z in Nashville lead on streaming." || len(got.Citations) != 1 {
+		t.Fatalf("expected generated reply with citations, got %+v", got)
+	}
+	if len(gen.calls) != 1 {
+		t.Fatalf("expected one generator call, got %d", len(gen.calls))
+	}
+	req := gen.calls[0]
+	if req.Prompt != prompt || len(req.Snippets) != 1 || req.Snippets[0] != "In Nashville, Gen Z spend more on streaming platforms." {
+		t.Fatalf("unexpected request: %+v", req)
+	}
+	if len(req.History) != 2 || req.History[0].Content != "old answer" || req.History[1].Content != "follow-up" {
+		t.Fatalf("expected last two turns oldest first, got %+v", req.History)
+	}
+
+	// Failure (or an empty reply) falls back to the extractive answer.
+	for _, g := range []*stubGenerator{{err: errors.New("upstream down")}, {reply: "   "}} {
+		s.Generator = g
+		got, err := s.Answer(context.Background(), Caller{UserID: "u1"}, "c1", prompt)
+		if err != nil || got.Content != "In Nashville, Gen Z spend more on streaming platforms." {
+			t.Fatalf("expected extractive fallback, got %+v err=%v", got, err)
+		}
+	}
+
+	// Declines never reach the generator.
+	gen = &stubGenerator{reply: "should not be used"}
+	s.Generator = gen
+	if reply, score, _ := s.retrieve(context.Background(), "nothing matches"); reply != declineReply || score != nil || len(gen.calls) != 0 {
+		t.Fatalf("expected decline without generator call, got %q calls=%d", reply, len(gen.calls))
+	}
+}
+
+func TestMessageService_Answer_FollowUpCarriesAudienceAndLocation(t *testing.T) {
+	db := newMsgDB(t, &domain.Chat{}, &domain.Message{}, &domain.MessageSource{})
+	if err := db.Create(&domain.Chat{ID: "c1", UserID: "u1", Title: "t"}).Error; err != nil {
+		t.Fatalf("seed chat: %v", err)
+	}
+	base := time.Now().UTC().Add(-time.Hour)
+	for i, m := range []struct{ role, content string }{
+		{"user", "What share of Gen Z in Nashville listen to podcasts?"},
+		{"assistant", "Gen Z in Nashville: 41% listen to podcasts weekly."},
+	} {
+		if err := db.Create(&domain.Message{ID: fmt.Sprintf("m%d", i), ChatID: "c1", Role: m.role, Content: m.content, CreatedAt: base.Add(time.Duration(i) * time.Minute)}).Error; err != nil {
+			t.Fatalf("seed message: %v", err)
+		}
+	}
+	prompt := "and what about streaming platforms?"
+	want := prompt + " Gen Z in Nashville"
+	idx := mkIdx(map[string][]search.Result{
+		want: {{Snippet: "Gen Z in Nashville spend 30% more on streaming platforms.", Score: 0.8, DocID: "d1"}},
+	})
+	s := &MessageService{DB: db, Index: idx, Threshold: 0.05, HistoryTurns: 6}
+
+	got, err := s.Answer(context.Background(), Caller{UserID: "u1"}, "c1", prompt)
+	if err != nil {
+		t.Fatalf("Answer: %v", err)
+	}
+	if got.RetrievalQuery != want {
+		t.Fatalf("retrieval query = %q, want %q", got.RetrievalQuery, want)
+	}
+	if got.Content != "Gen Z in Nashville spend 30% more on streaming platforms." {
+		t.Fatalf("expected carried-context answer, got %q", got.Content)
+	}
+
+	// Without history the prompt is searched as typed and declined.
+	s.HistoryTurns = 0
+	got, err = s.Answer(context.Background(), Caller{UserID: "u1"}, "c1", prompt)
+	if err != nil {
+		t.Fatalf("Answer: %v", err)
+	}
+	if got.RetrievalQuery != prompt || got.Content != declineReply {
+		t.Fatalf("expected decline for bare follow-up, got %+v", got)
+	}
+}
+
+// ---------- Edit() and branches ----------
+
+func TestMessageService_EditAndBranches(t *testing.T) {
+	db := newMsgDB(t, &domain.Chat{}, &domain.ChatShare{}, &domain.Message{}, &domain.MessageSource{})
+	ctx := context.Background()
+	if err := db.Create(&domain.Chat{ID: "c1", UserID: "u1", Title: "t"}).Error; err != nil {
+		t.Fatalf("seed chat: %v", err)
+	}
+	gen := &stubGenerator{reply: "generated"}
+	idx := mkIdx(map[string][]search.Result{
+		"q1":  {{Snippet: "q1 snippet", Score: 0.8}},
+		"q2":  {{Snippet: "q2 snippet", Score: 0.8}},
+		"q2'": {{Snippet: "q2' snippet", Score: 0.8}},
+	})
+	s := &MessageService{DB: db, Index: idx, Threshold: 0.05, Generator: gen, HistoryTurns: 10}
+	owner := Caller{UserID: "u1"}
+
+	if _, err := s.Answer(ctx, owner, "c1", "q1"); err != nil {
+		t.Fatalf("Answer q1: %v", err)
+	}
+	a2, err := s.Answer(ctx, owner, "c1", "q2")
+	if err != nil {
+		t.Fatalf("Answer q2: %v", err)
+	}
+	q2 := *a2.ParentID
+
+	// The edit is answered with the history before the edited message only.
+	gen.calls = nil
+	a2b, err := s.Edit(ctx, owner, q2, "q2'")
+	if err != nil {
+		t.Fatalf("Edit: %v", err)
+	}
+	if h := gen.calls[0].History; len(h) != 2 || h[0].Content != "q1" || h[1].Content != "generated" {
+		t.Fatalf("edit history = %+v", h)
+	}
+	var q2b domain.Message
+	db.First(&q2b, "id = ?", *a2b.ParentID)
+	var orig domain.Message
+	db.First(&orig, "id = ?", q2)
+	if q2b.Content != "q2'" || q2b.Role != roleUser || *q2b.ParentID != *orig.ParentID {
+		t.Fatalf("edited prompt = %+v, original = %+v", q2b, orig)
+	}
+
+	contents := func(view MessageView) []string {
+		items, _, err := s.ListPage(ctx, owner, "c1", view, 1, 20)
+		if err != nil {
+			t.Fatalf("ListPage: %v", err)
+		}
+		out := make([]string, len(items))
+		for i, m := range items {
+			out[i] = m.Content
+		}
+		return out
+	}
+	if got := contents(ActiveBranch); !slices.Equal(got, []string{"q1", "generated", "q2'", "generated"}) {
+		t.Fatalf("active branch = %v", got)
+	}
+	if got := contents(AllBranches); len(got) != 6 {
+		t.Fatalf("all branches = %v", got)
+	}
+
+	branches, err := s.ListBranches(ctx, owner, q2)
+	if err != nil || len(branches) != 2 || branches[0].Message.ID != q2 || branches[0].Active || !branches[1].Active {
+		t.Fatalf("ListBranches = %+v, %v", branches, err)
+	}
+
+	// Selecting the original brings back its reply; new turns follow it.
+	if err := s.SelectBranch(ctx, owner, "c1", q2); err != nil {
+		t.Fatalf("SelectBranch: %v", err)
+	}
+	if got := contents(ActiveBranch); !slices.Equal(got, []string{"q1", "generated", "q2", "generated"}) {
+		t.Fatalf("after select = %v", got)
+	}
+	a3, err := s.Answer(ctx, owner, "c1", "q1")
+	if err != nil {
+		t.Fatalf("Answer after select: %v", err)
+	}
+	var q3 domain.Message
+	db.First(&q3, "id = ?", *a3.ParentID)
+	if q3.ParentID == nil || *q3.ParentID != a2.ID {
+		t.Fatalf("new turn follows %v, want %s", q3.ParentID, a2.ID)
+	}
+
+	// Only user messages are edited; others' messages are not found.
+	if _, err := s.Edit(ctx, owner, a2.ID, "x"); !errors.Is(err, ErrNotEditable) {
+		t.Fatalf("edit reply: %v", err)
+	}
+	if _, err := s.Edit(ctx, owner, q2, " "); !errors.Is(err, ErrEmptyPrompt) {
+		t.Fatalf("edit empty: %v", err)
+	}
+	stranger := Caller{UserID: "u2"}
+	if _, err := s.Edit(ctx, stranger, q2, "x"); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("stranger edit: %v", err)
+	}
+	if _, err := s.ListBranches(ctx, stranger, q2); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("stranger branches: %v", err)
+	}
+	if err := s.SelectBranch(ctx, stranger, "c1", q2); !errors.Is(err, ErrChatNotFound) {
+		t.Fatalf("stranger select: %v", err)
+	}
+	if err := db.Create(&domain.Chat{ID: "c2", UserID: "u1", Title: "t"}).Error; err != nil {
+		t.Fatalf("seed chat: %v", err)
+	}
+	if err := s.SelectBranch(ctx, owner, "c2", q2); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("select from other chat: %v", err)
+	}
+}
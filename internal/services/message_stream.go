@@ -0,0 +1,162 @@
+// Package services – streamed answers
+//
+// AnswerStream is the incremental counterpart of MessageService.Answer used by
+// the Server-Sent Events endpoint. It runs the same pipeline but reports each
+// stage through StreamHooks as soon as it is available:
+//
+//  1. the user message, once persisted;
+//  2. the retrieval candidates;
+//  3. the reply, in word-aligned chunks;
+//
+// and finally returns the stored assistant message. Unlike Answer, the user
+// message is committed on its own so clients can render it immediately; if
+// the caller goes away (ctx cancelled) before the reply is persisted, only the
+// user message remains. If another message is posted to the chat meanwhile,
+// the reply is not stored and ErrBranchMoved is returned, so concurrent posts
+// never fork the chat.
+
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/repo"
+	"github.com/tbourn/go-chat-backend/internal/search"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// streamChunkRunes is the target size of each streamed reply chunk.
+const streamChunkRunes = 48
+
+// StreamHooks receives the intermediate results of AnswerStream. Nil hooks are
+// skipped; a hook returning an error aborts the answer with that error.
+type StreamHooks struct {
+	UserMessage func(*domain.Message) error
+	Candidates  func([]search.Result) error
+	Chunk       func(string) error
+}
+
+// AnswerStream validates prompt, verifies chat, persists the user message and
+// streams the reply through hooks before persisting the assistant message.
+// The returned message is the same as Answer would return.
+func (s *MessageService) AnswerStream(ctx context.Context, caller Caller, chatID, prompt string, hooks StreamHooks) (*domain.Message, error) {
+	tr := otel.Tracer("services/MessageService")
+	ctx, span := tr.Start(ctx, "AnswerStream",
+		trace.WithAttributes(
+			attribute.String("chat.id", chatID),
+			attribute.String("user.id", caller.UserID),
+		),
+	)
+	defer span.End()
+
+	prompt, err := s.checkPrompt(prompt)
+	if err != nil {
+		return nil, err
+	}
+	chat, err := s.authorize(ctx, caller, chatID, AccessWrite)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := s.indexFor(ctx, chat)
+	if err != nil {
+		return nil, err
+	}
+
+	history := s.history(ctx, chatID, chat.ActiveMessageID)
+	userMsg := &domain.Message{ChatID: chatID, ParentID: chat.ActiveMessageID, Role: roleUser, Content: prompt}
+	if err := repo.AppendMessage(s.DB.WithContext(ctx), userMsg); err != nil {
+		if errors.Is(err, repo.ErrActiveMoved) {
+			return nil, ErrBranchMoved
+		}
+		return nil, err
+	}
+	if err := emit(ctx, hooks.UserMessage, userMsg); err != nil {
+		return nil, err
+	}
+
+	query := s.retrievalQuery(ctx, prompt, history)
+	results := candidates(idx, query)
+	if err := emit(ctx, hooks.Candidates, results); err != nil {
+		return nil, err
+	}
+
+	reply, score, sources := s.respond(ctx, prompt, query, history, results)
+	for _, chunk := range chunkReply(s.clipReply(reply), streamChunkRunes) {
+		if err := emit(ctx, hooks.Chunk, chunk); err != nil {
+			return nil, err
+		}
+	}
+
+	var assistantMsg *domain.Message
+	err = s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		m, err := s.createReply(tx, chat, userMsg.ID, prompt, reply, score, sources)
+		assistantMsg = m
+		return err
+	})
+	if errors.Is(err, repo.ErrActiveMoved) {
+		return nil, ErrBranchMoved
+	}
+	if err != nil {
+		return nil, err
+	}
+	assistantMsg.Content = s.clipReply(assistantMsg.Content)
+	assistantMsg.RetrievalQuery = query
+	return assistantMsg, nil
+}
+
+// emit checks for cancellation and then calls hook (if set) with v.
+func emit[T any](ctx context.Context, hook func(T) error, v T) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if hook == nil {
+		return nil
+	}
+	return hook(v)
+}
+
+// chunkReply splits reply into pieces of roughly max runes, breaking after
+// whitespace where possible. Concatenating the chunks yields reply exactly.
+func chunkReply(reply string, max int) []string {
+	if reply == "" {
+		return nil
+	}
+	if max <= 0 {
+		return []string{reply}
+	}
+	var out []string
+	for utf8.RuneCountInString(reply) > max {
+		cut, n, lastSpace := 0, 0, 0
+		for i, r := range reply {
+			if n == max {
+				cut = i
+				break
+			}
+			if unicode.IsSpace(r) {
+				lastSpace = i + utf8.RuneLen(r)
+			}
+			n++
+		}
+		if lastSpace > 0 {
+			cut = lastSpace
+		}
+		out = append(out, reply[:cut])
+		reply = reply[cut:]
+	}
+	if strings.TrimSpace(reply) != "" || len(out) == 0 {
+		out = append(out, reply)
+	} else {
+		out[len(out)-1] += reply
+	}
+	return out
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/generator"
+	"github.com/tbourn/go-chat-backend/internal/repo"
+	"github.com/tbourn/go-chat-backend/internal/search"
+)
+
+func newStreamService(t *testing.T) (*MessageService, string) {
+	t.Helper()
+	db := newMsgDB(t, &domain.Chat{}, &domain.ChatShare{}, &domain.Message{}, &domain.MessageSource{})
+	if err := db.Create(&domain.Chat{ID: "c1", UserID: "u1", Title: "New chat"}).Error; err != nil {
+		t.Fatalf("seed chat: %v", err)
+	}
+	prompt := `Gen Z in Nashville spend on streaming platforms`
+	idx := mkIdx(map[string][]search.Result{
+		prompt: {
+			{Snippet: "In Nashville, Gen Z spend more on streaming platforms than any other generation surveyed.", Score: 0.8, DocID: "d1"},
+		},
+	})
+	return &MessageService{DB: db, Index: idx, Threshold: 0.05}, prompt
+}
+
+func TestMessageService_AnswerStream_EventOrderAndPersistence(t *testing.T) {
+	s, prompt := newStreamService(t)
+
+	var events []string
+	var chunks []string
+	got, err := s.AnswerStream(context.Background(), Caller{UserID: "u1"}, "c1", prompt, StreamHooks{
+		UserMessage: func(m *domain.Message) error {
+			if m.Role != roleUser || m.Content != prompt || m.ID == "" {
+				t.Fatalf("unexpected user message: %+v", m)
+			}
+			events = append(events, "user")
+			return nil
+		},
+		Candidates: func(rs []search.Result) error {
+			if len(rs) != 1 || rs[0].DocID != "d1" {
+				t.Fatalf("unexpected candidates: %+v", rs)
+			}
+			events = append(events, "candidates")
+			return nil
+		},
+		Chunk: func(c string) error {
+			events = append(events, "chunk")
+			chunks = append(chunks, c)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("AnswerStream: %v", err)
+	}
+	if len(events) < 3 || events[0] != "user" || events[1] != "candidates" || events[2] != "chunk" {
+		t.Fatalf("unexpected event order: %v", events)
+	}
+	if len(chunks) < 2 {
+		t.Fatalf("expected the reply to be split into several chunks, got %q", chunks)
+	}
+	if strings.Join(chunks, "") != got.Content {
+		t.Fatalf("chunks %q do not add up to reply %q", chunks, got.Content)
+	}
+	if got.Role != roleAssistant || got.Score == nil || len(got.Citations) != 1 {
+		t.Fatalf("unexpected assistant message: %+v", got)
+	}
+
+	var n int64
+	s.DB.Model(&domain.Message{}).Where("chat_id = ?", "c1").Count(&n)
+	if n != 2 {
+		t.Fatalf("expected 2 stored messages, got %d", n)
+	}
+	var chat domain.Chat
+	s.DB.First(&chat, "id = ?", "c1")
+	if chat.Title == "New chat" {
+		t.Fatalf("expected auto-title after stream")
+	}
+}
+
+func TestMessageService_AnswerStream_AbortKeepsOnlyUserMessage(t *testing.T) {
+	s, prompt := newStreamService(t)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	_, err := s.AnswerStream(ctx, Caller{UserID: "u1"}, "c1", prompt, StreamHooks{
+		UserMessage: func(*domain.Message) error { cancel(); return nil },
+		Chunk:       func(string) error { t.Fatalf("no chunk expected after cancel"); return nil },
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+
+	var msgs []domain.Message
+	s.DB.Where("chat_id = ?", "c1").Find(&msgs)
+	if len(msgs) != 1 || msgs[0].Role != roleUser {
+		t.Fatalf("expected only the user message, got %+v", msgs)
+	}
+
+	// A hook error aborts the same way.
+	boom := errors.New("client gone")
+	if _, err := s.AnswerStream(context.Background(), Caller{UserID: "u1"}, "c1", prompt, StreamHooks{
+		Chunk: func(string) error { return boom },
+	}); !errors.Is(err, boom) {
+		t.Fatalf("expected hook error, got %v", err)
+	}
+}
+
+// gatedGenerator hands each Generate call's release channel to calls and
+// blocks until it is closed.
+type gatedGenerator struct{ calls chan chan struct{} }
+
+func (g gatedGenerator) Generate(context.Context, generator.Request) (string, error) {
+	release := make(chan struct{})
+	g.calls <- release
+	<-release
+	return "generated", nil
+}
+
+func TestMessageService_ConcurrentPostsDoNotFork(t *testing.T) {
+	s, prompt := newStreamService(t)
+	ctx := context.Background()
+
+	// Two posts answered from the same branch: the second to commit stores
+	// nothing.
+	gen := gatedGenerator{calls: make(chan chan struct{})}
+	s.Generator = gen
+	errs := make(chan error)
+	for range 2 {
+		go func() {
+			_, err := s.Answer(ctx, Caller{UserID: "u1"}, "c1", prompt)
+			errs <- err
+		}()
+	}
+	first, second := <-gen.calls, <-gen.calls
+	close(first)
+	if err := <-errs; err != nil {
+		t.Fatalf("first post: %v", err)
+	}
+	close(second)
+	if err := <-errs; err != ErrBranchMoved {
+		t.Fatalf("second post: err = %v, want ErrBranchMoved", err)
+	}
+
+	// A post while a stream is answering: the stream's reply is not stored.
+	s.Generator = nil
+	posted := false
+	_, err := s.AnswerStream(ctx, Caller{UserID: "u1"}, "c1", prompt, StreamHooks{
+		Chunk: func(string) error {
+			if !posted {
+				posted = true
+				if _, err := s.Answer(ctx, Caller{UserID: "u1"}, "c1", prompt); err != nil {
+					t.Fatalf("post during stream: %v", err)
+				}
+			}
+			return nil
+		},
+	})
+	if err != ErrBranchMoved {
+		t.Fatalf("stream: err = %v, want ErrBranchMoved", err)
+	}
+
+	// Every message has at most one follower, and the active branch holds
+	// them all: the chat never forked.
+	var forks int64
+	s.DB.Raw("SELECT COUNT(*) FROM (SELECT parent_id FROM messages WHERE chat_id = ? GROUP BY parent_id HAVING COUNT(*) > 1)", "c1").Scan(&forks)
+	var total, active int64
+	s.DB.Model(&domain.Message{}).Where("chat_id = ?", "c1").Count(&total)
+	active, _ = repo.CountActiveMessages(s.DB, "c1")
+	if forks != 0 || total != 5 || active != total {
+		t.Fatalf("forks = %d, messages = %d, active = %d; want 0, 5, 5", forks, total, active)
+	}
+}
+
+func TestMessageService_AnswerStream_ValidationBeforeAnyEvent(t *testing.T) {
+	s, _ := newStreamService(t)
+	hooks := StreamHooks{UserMessage: func(*domain.Message) error { t.Fatalf("unexpected event"); return nil }}
+
+	if _, err := s.AnswerStream(context.Background(), Caller{UserID: "u1"}, "c1", "  ", hooks); err != ErrEmptyPrompt {
+		t.Fatalf("expected ErrEmptyPrompt, got %v", err)
+	}
+	if _, err := s.AnswerStream(context.Background(), Caller{UserID: "u2"}, "c1", "hello", hooks); err != ErrChatNotFound {
+		t.Fatalf("expected ErrChatNotFound, got %v", err)
+	}
+}
+
+func TestChunkReply(t *testing.T) {
+	cases := []struct {
+		in   string
+		max  int
+		want []string
+	}{
+		{"", 5, nil},
+		{"short", 10, []string{"short"}},
+		{"hello world foo", 0, []string{"hello world foo"}},
+		{"hello world foo", 8, []string{"hello ", "world ", "foo"}},
+		{"abcdefghij", 4, []string{"abcd", "efgh", "ij"}},
+		{"héllo wörld", 6, []string{"héllo ", "wörld"}},
+		{"one two   ", 4, []string{"one ", "two   "}},
+	}
+	for _, tc := range cases {
+		got := chunkReply(tc.in, tc.max)
+		if strings.Join(got, "") != tc.in {
+			t.Fatalf("chunkReply(%q,%d) lost text: %q", tc.in, tc.max, got)
+		}
+		if len(got) != len(tc.want) {
+			t.Fatalf("chunkReply(%q,%d) = %q, want %q", tc.in, tc.max, got, tc.want)
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Fatalf("chunkReply(%q,%d) = %q, want %q", tc.in, tc.max, got, tc.want)
+			}
+		}
+	}
+}
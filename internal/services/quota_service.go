@@ -0,0 +1,308 @@
+// Package services – QuotaService
+//
+// This file implements the QuotaService, which enforces hard daily and
+// monthly usage quotas on chat creation and posted messages. Unlike the
+// in-memory rate limiter, which smooths bursts, quotas are persisted and
+// survive restarts.
+//
+// Policy:
+//   - Every user has per-user limits (configured defaults, replaceable per
+//     user by admins through a QuotaOverride); they count usage across all
+//     workspaces.
+//   - Every workspace other than the default one also has workspace-wide
+//     limits, counting the usage of all its members.
+//   - Periods follow calendar days and months in the quota time zone and
+//     reset at its midnight / on the first of the month.
+//   - A unit is counted against every applicable counter at once, or not at
+//     all; a zero limit is unlimited but still counted for reporting.
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/repo"
+)
+
+// QuotaError reports which quota a request exceeded. It wraps
+// ErrQuotaExceeded.
+type QuotaError struct {
+	Scope   string    // domain.QuotaScopeUser or QuotaScopeWorkspace
+	Metric  string    // domain.UsageMessages or UsageChats
+	Period  string    // domain.PeriodDay or PeriodMonth
+	Limit   int64     // the exceeded limit
+	ResetAt time.Time // start of the next period (UTC)
+}
+
+// Error implements error.
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s %s quota of %d %s exceeded", e.Scope, periodAdjective(e.Period), e.Limit, e.Metric)
+}
+
+// Unwrap returns ErrQuotaExceeded.
+func (e *QuotaError) Unwrap() error { return ErrQuotaExceeded }
+
+// Usage is the caller's usage of one metric in one period.
+type Usage struct {
+	Scope   string
+	Metric  string
+	Period  string
+	Used    int64
+	Limit   int64 // 0 = unlimited
+	ResetAt time.Time
+}
+
+// QuotaService enforces and reports usage quotas. It is safe for concurrent
+// use.
+type QuotaService struct {
+	// DB is the GORM handle used for persistence.
+	DB *gorm.DB
+
+	// User holds the default per-user limits.
+	User domain.QuotaLimits
+
+	// Workspace holds the limits of each non-default workspace.
+	Workspace domain.QuotaLimits
+
+	// Location sets the calendar used for periods; nil means UTC.
+	Location *time.Location
+
+	// now returns the current time; tests override it.
+	now func() time.Time
+}
+
+// NewQuotaService constructs a QuotaService.
+func NewQuotaService(db *gorm.DB, user, workspace domain.QuotaLimits, loc *time.Location) *QuotaService {
+	return &QuotaService{DB: db, User: user, Workspace: workspace, Location: loc}
+}
+
+// quotaMetrics and quotaPeriods list what Usage reports, in order.
+var (
+	quotaMetrics = []string{domain.UsageMessages, domain.UsageChats}
+	quotaPeriods = []string{domain.PeriodDay, domain.PeriodMonth}
+)
+
+// counter is one usage counter that applies to a request, with its limit.
+type counter struct {
+	key     domain.UsageCounter
+	limit   int64
+	resetAt time.Time
+}
+
+// Consume counts one unit of metric for the caller and returns the keys of
+// the counters it incremented, to pass to Refund. If any applicable limit is
+// already reached nothing is counted and a *QuotaError is returned.
+func (s *QuotaService) Consume(ctx context.Context, caller Caller, metric string) ([]domain.UsageCounter, error) {
+	counters, err := s.counters(ctx, caller, metric)
+	if err != nil {
+		return nil, err
+	}
+	err = s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, c := range counters {
+			ok, err := repo.IncrementUsage(ctx, tx, c.key, c.limit)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return &QuotaError{Scope: c.key.Scope, Metric: metric, Period: c.key.Period, Limit: c.limit, ResetAt: c.resetAt}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]domain.UsageCounter, len(counters))
+	for i, c := range counters {
+		keys[i] = c.key
+	}
+	return keys, nil
+}
+
+// Refund gives back the unit counted by Consume against keys, for requests
+// that failed after their quota was checked. The keys name the periods the
+// unit was counted in, so a request that fails after midnight is refunded to
+// the day it was charged to. The refund is made even if ctx is cancelled,
+// since requests often fail because their client went away.
+func (s *QuotaService) Refund(ctx context.Context, keys []domain.UsageCounter) error {
+	ctx = context.WithoutCancel(ctx)
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, key := range keys {
+			if err := repo.DecrementUsage(ctx, tx, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Usage returns the caller's current usage and limits: per-user entries
+// first, then those of the caller's workspace (unless it is the default
+// one).
+func (s *QuotaService) Usage(ctx context.Context, caller Caller) ([]Usage, error) {
+	var out []Usage
+	for _, metric := range quotaMetrics {
+		counters, err := s.counters(ctx, caller, metric)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range counters {
+			used, err := repo.GetUsage(ctx, s.DB, c.key)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, Usage{Scope: c.key.Scope, Metric: metric, Period: c.key.Period, Used: used, Limit: c.limit, ResetAt: c.resetAt})
+		}
+	}
+	sortUsage(out)
+	return out, nil
+}
+
+// TimeZone returns the name of the quota time zone.
+func (s *QuotaService) TimeZone() string { return s.location().String() }
+
+// Override returns userID's quota override (all fields nil when there is
+// none) and the limits in effect for them. Admins only.
+func (s *QuotaService) Override(ctx context.Context, caller Caller, userID string) (*domain.QuotaOverride, domain.QuotaLimits, error) {
+	userID, err := s.checkOverride(caller, userID)
+	if err != nil {
+		return nil, domain.QuotaLimits{}, err
+	}
+	o, err := repo.GetQuotaOverride(ctx, s.DB, userID)
+	if isNotFound(err) {
+		o, err = &domain.QuotaOverride{UserID: userID}, nil
+	}
+	if err != nil {
+		return nil, domain.QuotaLimits{}, err
+	}
+	return o, o.Apply(s.User), nil
+}
+
+// SetOverride replaces the quota override of o.UserID. Admins only; limits
+// must not be negative (ErrInvalidQuota).
+func (s *QuotaService) SetOverride(ctx context.Context, caller Caller, o domain.QuotaOverride) (*domain.QuotaOverride, domain.QuotaLimits, error) {
+	userID, err := s.checkOverride(caller, o.UserID)
+	if err != nil {
+		return nil, domain.QuotaLimits{}, err
+	}
+	for _, v := range []*int64{o.MessagesPerDay, o.MessagesPerMonth, o.ChatsPerDay, o.ChatsPerMonth} {
+		if v != nil && *v < 0 {
+			return nil, domain.QuotaLimits{}, ErrInvalidQuota
+		}
+	}
+	o.UserID = userID
+	if err := repo.SetQuotaOverride(ctx, s.DB, &o); err != nil {
+		return nil, domain.QuotaLimits{}, err
+	}
+	return &o, o.Apply(s.User), nil
+}
+
+// DeleteOverride restores the configured limits for userID. Admins only.
+func (s *QuotaService) DeleteOverride(ctx context.Context, caller Caller, userID string) error {
+	userID, err := s.checkOverride(caller, userID)
+	if err != nil {
+		return err
+	}
+	return repo.DeleteQuotaOverride(ctx, s.DB, userID)
+}
+
+// counters returns the counters metric is counted against for the caller in
+// the current periods, per-user first.
+func (s *QuotaService) counters(ctx context.Context, caller Caller, metric string) ([]counter, error) {
+	limits := s.User
+	o, err := repo.GetQuotaOverride(ctx, s.DB, caller.UserID)
+	switch {
+	case err == nil:
+		limits = o.Apply(limits)
+	case !isNotFound(err):
+		return nil, err
+	}
+
+	now := s.clock().In(s.location())
+	var out []counter
+	add := func(scope, subject string, l domain.QuotaLimits) {
+		for _, period := range quotaPeriods {
+			start, reset := periodBounds(now, period)
+			out = append(out, counter{
+				key:     domain.UsageCounter{Scope: scope, SubjectID: subject, Metric: metric, Period: period, PeriodStart: start},
+				limit:   l.Limit(metric, period),
+				resetAt: reset.UTC(),
+			})
+		}
+	}
+	add(domain.QuotaScopeUser, caller.UserID, limits)
+	if ws := caller.Workspace(); ws != domain.DefaultWorkspaceID {
+		add(domain.QuotaScopeWorkspace, ws, s.Workspace)
+	}
+	return out, nil
+}
+
+// checkOverride validates an override request and returns the trimmed user.
+func (s *QuotaService) checkOverride(caller Caller, userID string) (string, error) {
+	if !caller.Admin {
+		return "", ErrQuotaForbidden
+	}
+	userID = strings.TrimSpace(userID)
+	if userID == "" || utf8.RuneCountInString(userID) > maxShareUserIDLen {
+		return "", ErrInvalidQuota
+	}
+	return userID, nil
+}
+
+func (s *QuotaService) location() *time.Location {
+	if s.Location == nil {
+		return time.UTC
+	}
+	return s.Location
+}
+
+func (s *QuotaService) clock() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
+
+// periodBounds returns the key of the period containing t (in t's location)
+// and the start of the next one.
+func periodBounds(t time.Time, period string) (string, time.Time) {
+	y, m, d := t.Date()
+	if period == domain.PeriodMonth {
+		return t.Format("2006-01"), time.Date(y, m+1, 1, 0, 0, 0, 0, t.Location())
+	}
+	return t.Format("2006-01-02"), time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+}
+
+// periodAdjective turns a period into "daily" or "monthly".
+func periodAdjective(period string) string {
+	if period == domain.PeriodMonth {
+		return "monthly"
+	}
+	return "daily"
+}
+
+// sortUsage orders usage by scope (user first), then metric and period as
+// listed in quotaMetrics and quotaPeriods.
+func sortUsage(u []Usage) {
+	rank := func(x Usage) int {
+		r := 0
+		if x.Scope == domain.QuotaScopeWorkspace {
+			r = 4
+		}
+		if x.Metric == domain.UsageChats {
+			r += 2
+		}
+		if x.Period == domain.PeriodMonth {
+			r++
+		}
+		return r
+	}
+	sort.SliceStable(u, func(i, j int) bool { return rank(u[i]) < rank(u[j]) })
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/repo"
+)
+
+func newQuotaService(t *testing.T, user, workspace domain.QuotaLimits, loc *time.Location, now *time.Time) *QuotaService {
+	t.Helper()
+	db := newMsgDB(t, &domain.UsageCounter{}, &domain.QuotaOverride{})
+	s := NewQuotaService(db, user, workspace, loc)
+	s.now = func() time.Time { return *now }
+	return s
+}
+
+func TestQuotaService_DailyAndMonthlyLimits(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skipf("tzdata unavailable: %v", err)
+	}
+	// 23:30 in New York on Oct 31 is already Nov 1 in UTC.
+	now := time.Date(2026, 10, 31, 23, 30, 0, 0, ny)
+	s := newQuotaService(t, domain.QuotaLimits{MessagesPerDay: 2, MessagesPerMonth: 3}, domain.QuotaLimits{}, ny, &now)
+	ctx := context.Background()
+	u := Caller{UserID: "u1"}
+
+	for i := 0; i < 2; i++ {
+		if _, err := s.Consume(ctx, u, domain.UsageMessages); err != nil {
+			t.Fatalf("Consume #%d: %v", i, err)
+		}
+	}
+	_, err = s.Consume(ctx, u, domain.UsageMessages)
+	var qe *QuotaError
+	if !errors.As(err, &qe) || !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("third message: err = %v", err)
+	}
+	wantReset := time.Date(2026, 11, 1, 0, 0, 0, 0, ny).UTC()
+	if qe.Scope != domain.QuotaScopeUser || qe.Period != domain.PeriodDay || qe.Limit != 2 || !qe.ResetAt.Equal(wantReset) {
+		t.Fatalf("QuotaError = %+v; want daily user limit 2 resetting at %v", qe, wantReset)
+	}
+	// Chats are counted separately and are unlimited here.
+	if _, err := s.Consume(ctx, u, domain.UsageChats); err != nil {
+		t.Fatalf("Consume chats: %v", err)
+	}
+
+	// The next local day resets the daily quota but not the monthly one...
+	now = time.Date(2026, 11, 1, 0, 30, 0, 0, ny)
+	if _, err := s.Consume(ctx, u, domain.UsageMessages); err != nil {
+		t.Fatalf("Consume on Nov 1: %v", err)
+	}
+	// ...which is per calendar month: October's two messages do not count.
+	if _, err := s.Consume(ctx, u, domain.UsageMessages); err != nil {
+		t.Fatalf("second Consume on Nov 1: %v", err)
+	}
+
+	usage, err := s.Usage(ctx, u)
+	if err != nil || len(usage) != 4 {
+		t.Fatalf("Usage = %+v, %v", usage, err)
+	}
+	if m := usage[1]; m.Metric != domain.UsageMessages || m.Period != domain.PeriodMonth || m.Used != 2 || m.Limit != 3 ||
+		!m.ResetAt.Equal(time.Date(2026, 12, 1, 0, 0, 0, 0, ny).UTC()) {
+		t.Fatalf("monthly messages = %+v", m)
+	}
+	if c := usage[2]; c.Metric != domain.UsageChats || c.Used != 0 || c.Limit != 0 {
+		t.Fatalf("daily chats on Nov 1 = %+v", c)
+	}
+	if s.TimeZone() != "America/New_York" {
+		t.Fatalf("TimeZone = %q", s.TimeZone())
+	}
+
+	// A unit charged before midnight and refunded after it goes back to the
+	// day and month it was charged to, even once the request context is
+	// cancelled.
+	now = time.Date(2026, 11, 30, 23, 59, 0, 0, ny)
+	charged, err := s.Consume(ctx, u, domain.UsageChats)
+	if err != nil {
+		t.Fatalf("Consume chats on Nov 30: %v", err)
+	}
+	now = time.Date(2026, 12, 1, 0, 1, 0, 0, ny)
+	if _, err := s.Consume(ctx, u, domain.UsageChats); err != nil {
+		t.Fatalf("Consume chats on Dec 1: %v", err)
+	}
+	gone, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := s.Refund(gone, charged); err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+	for _, key := range charged {
+		if n, _ := repo.GetUsage(ctx, s.DB, key); n != 0 {
+			t.Fatalf("charged counter %+v = %d after refund", key, n)
+		}
+	}
+	if usage, _ := s.Usage(ctx, u); usage[2].Used != 1 || usage[3].Used != 1 {
+		t.Fatalf("December chats after refund = %+v", usage[2:4])
+	}
+}
+
+func TestQuotaService_WorkspaceLimitsAndRefund(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	s := newQuotaService(t, domain.QuotaLimits{}, domain.QuotaLimits{ChatsPerDay: 2}, nil, &now)
+	ctx := context.Background()
+	const ws = "9d7c1f0e-2b4a-4c8e-9f61-3a5b7c9d1e2f"
+	a, b := Caller{UserID: "a", WorkspaceID: ws}, Caller{UserID: "b", WorkspaceID: ws}
+
+	if _, err := s.Consume(ctx, a, domain.UsageChats); err != nil {
+		t.Fatalf("a: %v", err)
+	}
+	charged, err := s.Consume(ctx, b, domain.UsageChats)
+	if err != nil {
+		t.Fatalf("b: %v", err)
+	}
+	_, err = s.Consume(ctx, a, domain.UsageChats)
+	var qe *QuotaError
+	if !errors.As(err, &qe) || qe.Scope != domain.QuotaScopeWorkspace {
+		t.Fatalf("workspace limit: err = %v", err)
+	}
+	// A rejected request counts nowhere, not even on the user's counters.
+	if usage, _ := s.Usage(ctx, a); usage[2].Used != 1 {
+		t.Fatalf("a's daily chats after rejection = %+v", usage[2])
+	}
+	// The default workspace has no workspace-wide limit.
+	if _, err := s.Consume(ctx, Caller{UserID: "a"}, domain.UsageChats); err != nil {
+		t.Fatalf("default workspace: %v", err)
+	}
+
+	if err := s.Refund(ctx, charged); err != nil {
+		t.Fatalf("Refund: %v", err)
+	}
+	if _, err := s.Consume(ctx, a, domain.UsageChats); err != nil {
+		t.Fatalf("after refund: %v", err)
+	}
+	usage, _ := s.Usage(ctx, a)
+	if len(usage) != 8 || usage[6].Scope != domain.QuotaScopeWorkspace || usage[6].Metric != domain.UsageChats || usage[6].Used != 2 || usage[6].Limit != 2 {
+		t.Fatalf("Usage = %+v", usage)
+	}
+}
+
+func TestQuotaService_Overrides(t *testing.T) {
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	s := newQuotaService(t, domain.QuotaLimits{MessagesPerDay: 1, ChatsPerDay: 5}, domain.QuotaLimits{}, nil, &now)
+	ctx := context.Background()
+	root, u := Caller{UserID: "root", Admin: true}, Caller{UserID: "u1"}
+	ten, neg := int64(10), int64(-1)
+
+	if _, _, err := s.SetOverride(ctx, u, domain.QuotaOverride{UserID: "u1", MessagesPerDay: &ten}); !errors.Is(err, ErrQuotaForbidden) {
+		t.Fatalf("non-admin SetOverride: err = %v", err)
+	}
+	if _, _, err := s.Override(ctx, u, "u1"); !errors.Is(err, ErrQuotaForbidden) {
+		t.Fatalf("non-admin Override: err = %v", err)
+	}
+	if _, _, err := s.SetOverride(ctx, root, domain.QuotaOverride{UserID: "u1", MessagesPerDay: &neg}); !errors.Is(err, ErrInvalidQuota) {
+		t.Fatalf("negative limit: err = %v", err)
+	}
+	if _, _, err := s.SetOverride(ctx, root, domain.QuotaOverride{UserID: " "}); !errors.Is(err, ErrInvalidQuota) {
+		t.Fatalf("blank user: err = %v", err)
+	}
+
+	o, eff, err := s.Override(ctx, root, "u1")
+	if err != nil || o.MessagesPerDay != nil || eff.MessagesPerDay != 1 {
+		t.Fatalf("Override before set = %+v %+v, %v", o, eff, err)
+	}
+	if _, eff, err = s.SetOverride(ctx, root, domain.QuotaOverride{UserID: "u1", MessagesPerDay: &ten}); err != nil || eff.MessagesPerDay != 10 || eff.ChatsPerDay != 5 {
+		t.Fatalf("SetOverride = %+v, %v", eff, err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := s.Consume(ctx, u, domain.UsageMessages); err != nil {
+			t.Fatalf("Consume #%d with override: %v", i, err)
+		}
+	}
+	if _, err := s.Consume(ctx, u, domain.UsageMessages); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("over override: err = %v", err)
+	}
+	// Other users keep the configured default.
+	_, _ = s.Consume(ctx, Caller{UserID: "u2"}, domain.UsageMessages)
+	if _, err := s.Consume(ctx, Caller{UserID: "u2"}, domain.UsageMessages); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("u2 default limit: err = %v", err)
+	}
+
+	if err := s.DeleteOverride(ctx, root, "u1"); err != nil {
+		t.Fatalf("DeleteOverride: %v", err)
+	}
+	if _, eff, _ := s.Override(ctx, root, "u1"); eff.MessagesPerDay != 1 {
+		t.Fatalf("effective after delete = %+v", eff)
+	}
+}
@@ -0,0 +1,127 @@
+// Package services – SearchService
+//
+// This file implements SearchService, full-text search over the caller's own
+// chat history (see repo.SearchMessages). Free-text queries are turned into
+// FTS5 expressions here, so users cannot inject query syntax, and snippets
+// are returned as HTML-escaped text with matches wrapped in <mark> tags.
+package services
+
+import (
+	"context"
+	"html"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+
+	"github.com/tbourn/go-chat-backend/internal/repo"
+)
+
+// Search limits.
+const (
+	maxSearchRunes = 256
+	maxSearchTerms = 16
+)
+
+// MessageQuery is a search over the caller's messages.
+type MessageQuery struct {
+	// Text is the free-text query; every word must match, the last one as a
+	// prefix.
+	Text string
+	// Role keeps only "user" or "assistant" messages when set.
+	Role string
+	// From and To keep only messages created at or after From and before To
+	// when set.
+	From, To *time.Time
+	// Page (from 1) and PageSize select the page of results.
+	Page, PageSize int
+}
+
+// SearchService searches the messages of the caller's chats.
+type SearchService struct {
+	DB *gorm.DB
+}
+
+// Messages returns a page of the caller's messages matching q, best first,
+// and the total number of matches. Only chats the caller owns in their
+// workspace are searched, excluding deleted chats and messages. It returns
+// ErrInvalidSearch when q has no words or invalid filters.
+func (s *SearchService) Messages(ctx context.Context, caller Caller, q MessageQuery) ([]repo.MessageHit, int64, error) {
+	tr := otel.Tracer("services/SearchService")
+	ctx, span := tr.Start(ctx, "Messages",
+		trace.WithAttributes(
+			attribute.String("user.id", caller.UserID),
+			attribute.String("role", q.Role),
+			attribute.Int("page", q.Page),
+			attribute.Int("page_size", q.PageSize),
+		),
+	)
+	defer span.End()
+
+	match, err := ftsQuery(q.Text)
+	if err != nil {
+		return nil, 0, err
+	}
+	if q.Role != "" && q.Role != roleUser && q.Role != roleAssistant {
+		return nil, 0, ErrInvalidSearch
+	}
+	if q.From != nil && q.To != nil && !q.From.Before(*q.To) {
+		return nil, 0, ErrInvalidSearch
+	}
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	if q.PageSize <= 0 {
+		q.PageSize = 20
+	}
+
+	hits, total, err := repo.SearchMessages(ctx, s.DB, repo.MessageSearch{
+		WorkspaceID: caller.Workspace(),
+		UserID:      caller.UserID,
+		Query:       match,
+		Role:        q.Role,
+		From:        q.From,
+		To:          q.To,
+		Offset:      (q.Page - 1) * q.PageSize,
+		Limit:       q.PageSize,
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := range hits {
+		hits[i].Snippet = highlight(hits[i].Snippet)
+	}
+	return hits, total, nil
+}
+
+// ftsQuery turns free text into an FTS5 expression matching all of its words
+// (runs of letters and digits), each quoted so it is taken literally, and the
+// last one as a prefix so results follow a query as it is typed.
+func ftsQuery(text string) (string, error) {
+	if len([]rune(text)) > maxSearchRunes {
+		return "", ErrInvalidSearch
+	}
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 || len(words) > maxSearchTerms {
+		return "", ErrInvalidSearch
+	}
+	for i, w := range words {
+		words[i] = `"` + w + `"`
+	}
+	return strings.Join(words, " ") + "*", nil
+}
+
+// highlight escapes a snippet for HTML and turns the repo's match markers
+// into <mark> tags.
+func highlight(snippet string) string {
+	return strings.NewReplacer(
+		repo.SnippetMarkStart, "<mark>",
+		repo.SnippetMarkEnd, "</mark>",
+	).Replace(html.EscapeString(snippet))
+}
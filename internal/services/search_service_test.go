@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/repo"
+)
+
+func TestFtsQueryAndHighlight(t *testing.T) {
+	for in, want := range map[string]string{
+		"Gen Z TikTok":          `"Gen" "Z" "TikTok"*`,
+		`tik" OR chats:* NEAR(`: `"tik" "OR" "chats" "NEAR"*`,
+		"  café, 2024!":         `"café" "2024"*`,
+	} {
+		if got, err := ftsQuery(in); err != nil || got != want {
+			t.Fatalf("ftsQuery(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", " -*()\" ", strings.Repeat("a ", 17), strings.Repeat("a", 257)} {
+		if _, err := ftsQuery(in); !errors.Is(err, ErrInvalidSearch) {
+			t.Fatalf("ftsQuery(%q) err = %v", in, err)
+		}
+	}
+
+	got := highlight("a <b> " + repo.SnippetMarkStart + "TikTok" + repo.SnippetMarkEnd + " & more")
+	if want := "a &lt;b&gt; <mark>TikTok</mark> &amp; more"; got != want {
+		t.Fatalf("highlight = %q, want %q", got, want)
+	}
+}
+
+func TestSearchService_Messages(t *testing.T) {
+	db := newTestDB(t)
+	if err := repo.EnsureMessageSearch(db); err != nil {
+		t.Fatalf("EnsureMessageSearch: %v", err)
+	}
+	ctx := context.Background()
+	svc := &SearchService{DB: db}
+	u1 := Caller{UserID: "u1"}
+
+	chat, _ := repo.CreateChat(ctx, db, domain.DefaultWorkspaceID, "u1", "Trends")
+	for _, m := range []struct{ role, content string }{
+		{roleUser, "Where do <teens> watch videos?"},
+		{roleAssistant, "Teens watch TikTok videos."},
+	} {
+		if _, err := repo.CreateMessage(db, chat.ID, m.role, m.content, nil); err != nil {
+			t.Fatalf("CreateMessage: %v", err)
+		}
+	}
+	shared, _ := repo.CreateChat(ctx, db, domain.DefaultWorkspaceID, "u2", "Shared")
+	if _, err := repo.CreateMessage(db, shared.ID, roleUser, "teens elsewhere", nil); err != nil {
+		t.Fatalf("CreateMessage: %v", err)
+	}
+	if err := repo.ShareChat(ctx, db, shared.ID, "u1"); err != nil {
+		t.Fatalf("ShareChat: %v", err)
+	}
+
+	// Only the caller's own chats; the last word is a prefix.
+	hits, total, err := svc.Messages(ctx, u1, MessageQuery{Text: "teen vid", PageSize: 1})
+	if err != nil || total != 2 || len(hits) != 1 || hits[0].ChatID != chat.ID {
+		t.Fatalf("Messages = %+v, %d, %v", hits, total, err)
+	}
+	hits, _, err = svc.Messages(ctx, u1, MessageQuery{Text: "teens", Role: roleUser})
+	if err != nil || len(hits) != 1 || hits[0].Snippet != "Where do &lt;<mark>teens</mark>&gt; watch videos?" {
+		t.Fatalf("role filter = %+v, %v", hits, err)
+	}
+	if hits, total, err := svc.Messages(ctx, Caller{UserID: "u1", WorkspaceID: "other"}, MessageQuery{Text: "teens"}); err != nil || total != 0 || hits == nil {
+		t.Fatalf("other workspace = %+v, %d, %v", hits, total, err)
+	}
+
+	now := time.Now()
+	for name, q := range map[string]MessageQuery{
+		"no words": {Text: "?!"},
+		"role":     {Text: "teens", Role: "system"},
+		"range":    {Text: "teens", From: &now, To: &now},
+	} {
+		if _, _, err := svc.Messages(ctx, u1, q); !errors.Is(err, ErrInvalidSearch) {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+}
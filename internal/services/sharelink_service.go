@@ -0,0 +1,192 @@
+// Package services – ShareLinkService
+//
+// This file implements ShareLinkService, which manages public read-only links
+// to chats. The owner (or an admin) creates a chat's link, optionally
+// expiring, and revokes it; anyone holding the token can then read the chat
+// and its messages without an account. Tokens are generated and hashed by
+// the auth package; only the hash is persisted and the token itself is
+// returned exactly once, from Create.
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	zlog "github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+
+	"github.com/tbourn/go-chat-backend/internal/auth"
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/repo"
+)
+
+// sharedChatViews counts reads through share links by result: ok, expired
+// or not_found (malformed, unknown or revoked tokens and deleted chats).
+var sharedChatViews = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "shared_chat_views_total",
+		Help: "Reads of chats through public share links, by result.",
+	},
+	[]string{"result"},
+)
+
+func init() {
+	prometheus.MustRegister(sharedChatViews)
+}
+
+// ShareLinkService manages and resolves public share links.
+type ShareLinkService struct {
+	// DB is the GORM handle used for persistence.
+	DB *gorm.DB
+
+	// now returns the current time; tests override it.
+	now func() time.Time
+}
+
+// SharedChat is a chat read through a share link: the chat, its link and one
+// page of messages (oldest first, with citations) out of Total.
+type SharedChat struct {
+	Chat     domain.Chat
+	Link     domain.ShareLink
+	Messages []domain.Message
+	Total    int64
+}
+
+// Create creates the share link of chatID, valid until expiresAt (or
+// forever when nil), and returns it with its token, which cannot be
+// recovered later. A previous link of the chat stops working.
+//
+// Errors: ErrChatNotFound / ErrForbidden as for other owner-only
+// operations, ErrInvalidShareLinkExpiry when expiresAt is not in the future.
+func (s *ShareLinkService) Create(ctx context.Context, caller Caller, chatID string, expiresAt *time.Time) (*domain.ShareLink, string, error) {
+	tr := otel.Tracer("services/ShareLinkService")
+	ctx, span := tr.Start(ctx, "Create",
+		trace.WithAttributes(
+			attribute.String("chat.id", chatID),
+			attribute.String("user.id", caller.UserID),
+		),
+	)
+	defer span.End()
+
+	if _, err := authorizeChat(ctx, s.DB, repoLookup{}, caller, chatID, AccessManage); err != nil {
+		return nil, "", err
+	}
+	now := s.clock()
+	if expiresAt != nil {
+		if !expiresAt.After(now) {
+			return nil, "", ErrInvalidShareLinkExpiry
+		}
+		t := expiresAt.UTC()
+		expiresAt = &t
+	}
+
+	token, err := auth.NewShareToken()
+	if err != nil {
+		return nil, "", err
+	}
+	l := &domain.ShareLink{
+		ChatID:    chatID,
+		TokenHash: auth.HashShareToken(token),
+		CreatedBy: caller.UserID,
+		ExpiresAt: expiresAt,
+		CreatedAt: now,
+	}
+	if err := repo.SaveShareLink(ctx, s.DB, l); err != nil {
+		return nil, "", err
+	}
+	return l, token, nil
+}
+
+// Revoke deletes the share link of chatID, if any. It needs the same access
+// as Create; revoking twice is a no-op.
+func (s *ShareLinkService) Revoke(ctx context.Context, caller Caller, chatID string) error {
+	tr := otel.Tracer("services/ShareLinkService")
+	ctx, span := tr.Start(ctx, "Revoke",
+		trace.WithAttributes(
+			attribute.String("chat.id", chatID),
+			attribute.String("user.id", caller.UserID),
+		),
+	)
+	defer span.End()
+
+	if _, err := authorizeChat(ctx, s.DB, repoLookup{}, caller, chatID, AccessManage); err != nil {
+		return err
+	}
+	return repo.DeleteShareLink(ctx, s.DB, chatID)
+}
+
+// View resolves token and returns page page (1-based) of its chat's
+// messages on the active branch. Every call counts as a view of the link. Tokens that do not lead
+// to a live chat return ErrShareLinkNotFound.
+func (s *ShareLinkService) View(ctx context.Context, token string, page, pageSize int) (*SharedChat, error) {
+	tr := otel.Tracer("services/ShareLinkService")
+	ctx, span := tr.Start(ctx, "View",
+		trace.WithAttributes(
+			attribute.Int("page", page),
+			attribute.Int("page_size", pageSize),
+		),
+	)
+	defer span.End()
+
+	if !auth.ValidShareToken(token) {
+		sharedChatViews.WithLabelValues("not_found").Inc()
+		return nil, ErrShareLinkNotFound
+	}
+	l, err := repo.FindShareLink(ctx, s.DB, auth.HashShareToken(token))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			sharedChatViews.WithLabelValues("not_found").Inc()
+			return nil, ErrShareLinkNotFound
+		}
+		return nil, err
+	}
+	now := s.clock()
+	if !l.Active(now) {
+		sharedChatViews.WithLabelValues("expired").Inc()
+		return nil, ErrShareLinkNotFound
+	}
+	span.SetAttributes(attribute.String("chat.id", l.ChatID))
+
+	if page < 1 {
+		page = 1
+	}
+	if pageSize <= 0 {
+		pageSize = 20
+	}
+	db := s.DB.WithContext(ctx)
+	total, err := repo.CountActiveMessages(db, l.ChatID)
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := repo.ListActiveMessagesPage(db, l.ChatID, (page-1)*pageSize, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.AttachCitations(db, msgs); err != nil {
+		return nil, err
+	}
+
+	// The view counter is a statistic for the owner; the visitor still gets
+	// the page when it cannot be bumped.
+	if err := repo.CountShareLinkView(ctx, s.DB, l.ChatID, now); err != nil {
+		zlog.Warn().Err(err).Str("chat.id", l.ChatID).Msg("share link view count failed")
+	} else {
+		l.Views++
+		l.LastViewedAt = &now
+	}
+	sharedChatViews.WithLabelValues("ok").Inc()
+	return &SharedChat{Chat: l.Chat, Link: *l, Messages: msgs, Total: total}, nil
+}
+
+// clock returns the current UTC time.
+func (s *ShareLinkService) clock() time.Time {
+	if s.now != nil {
+		return s.now().UTC()
+	}
+	return time.Now().UTC()
+}
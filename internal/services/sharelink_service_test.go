@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/repo"
+)
+
+func TestShareLinkService(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&domain.ShareLink{}, &domain.MessageSource{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	ctx := context.Background()
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	svc := &ShareLinkService{DB: db, now: func() time.Time { return now }}
+	owner, friend := Caller{UserID: "u1"}, Caller{UserID: "u2"}
+
+	chat, _ := repo.CreateChat(ctx, db, domain.DefaultWorkspaceID, owner.UserID, "Trends")
+	for _, content := range []string{"q1", "q2", "q3"} {
+		if _, err := repo.CreateMessage(db, chat.ID, roleUser, content, nil); err != nil {
+			t.Fatalf("CreateMessage: %v", err)
+		}
+	}
+	if err := repo.ShareChat(ctx, db, chat.ID, friend.UserID); err != nil {
+		t.Fatalf("ShareChat: %v", err)
+	}
+
+	// Only the owner manages links.
+	if _, _, err := svc.Create(ctx, friend, chat.ID, nil); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("friend create: %v", err)
+	}
+	if _, _, err := svc.Create(ctx, Caller{UserID: "u3"}, chat.ID, nil); !errors.Is(err, ErrChatNotFound) {
+		t.Fatalf("stranger create: %v", err)
+	}
+	past := now.Add(-time.Second)
+	if _, _, err := svc.Create(ctx, owner, chat.ID, &past); !errors.Is(err, ErrInvalidShareLinkExpiry) {
+		t.Fatalf("past expiry: %v", err)
+	}
+
+	exp := now.Add(time.Hour)
+	link, token, err := svc.Create(ctx, owner, chat.ID, &exp)
+	if err != nil || link.TokenHash == token || !link.ExpiresAt.Equal(exp) {
+		t.Fatalf("Create = %+v, %q, %v", link, token, err)
+	}
+	shared, err := svc.View(ctx, token, 2, 2)
+	if err != nil || shared.Chat.Title != "Trends" || shared.Total != 3 || len(shared.Messages) != 1 ||
+		shared.Messages[0].Content != "q3" || shared.Link.Views != 1 {
+		t.Fatalf("View = %+v, %v", shared, err)
+	}
+	if _, err := svc.View(ctx, "gcs_nope", 1, 20); !errors.Is(err, ErrShareLinkNotFound) {
+		t.Fatalf("malformed token: %v", err)
+	}
+
+	// A new link replaces the old one.
+	_, token2, err := svc.Create(ctx, owner, chat.ID, nil)
+	if err != nil {
+		t.Fatalf("Create again: %v", err)
+	}
+	if _, err := svc.View(ctx, token, 1, 20); !errors.Is(err, ErrShareLinkNotFound) {
+		t.Fatalf("replaced token: %v", err)
+	}
+	if _, err := svc.View(ctx, token2, 1, 20); err != nil {
+		t.Fatalf("new token: %v", err)
+	}
+
+	// Expired links stop working.
+	_, token3, _ := svc.Create(ctx, owner, chat.ID, &exp)
+	svc.now = func() time.Time { return exp }
+	if _, err := svc.View(ctx, token3, 1, 20); !errors.Is(err, ErrShareLinkNotFound) {
+		t.Fatalf("expired token: %v", err)
+	}
+
+	// Revoked links stop working; revoking twice is fine.
+	svc.now = nil
+	_, token4, _ := svc.Create(ctx, owner, chat.ID, nil)
+	for i := 0; i < 2; i++ {
+		if err := svc.Revoke(ctx, owner, chat.ID); err != nil {
+			t.Fatalf("Revoke: %v", err)
+		}
+	}
+	if _, err := svc.View(ctx, token4, 1, 20); !errors.Is(err, ErrShareLinkNotFound) {
+		t.Fatalf("revoked token: %v", err)
+	}
+	if err := svc.Revoke(ctx, friend, chat.ID); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("friend revoke: %v", err)
+	}
+}
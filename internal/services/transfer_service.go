@@ -0,0 +1,249 @@
+// Package services – TransferService
+//
+// This file implements TransferService, which moves whole chats in and out of
+// the system: Export renders a chat's transcript (messages with scores,
+// feedback and citations) through an export.Writer, reading the messages page
+// by page so long chats are never held in memory at once; Import stores a
+// chat from a JSON export document as a new chat of the caller.
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/export"
+	"github.com/tbourn/go-chat-backend/internal/repo"
+)
+
+const (
+	// defaultExportPageSize is the number of messages read per page when
+	// TransferService.PageSize is not set.
+	defaultExportPageSize = 200
+
+	// maxImportTitleRunes caps imported titles, like titles set through the
+	// API.
+	maxImportTitleRunes = 255
+
+	// importedTitle is the title of imported chats without one.
+	importedTitle = "Imported chat"
+)
+
+// TransferService exports and imports chats.
+type TransferService struct {
+	DB *gorm.DB
+
+	// PageSize is the number of messages read (and written) at a time.
+	PageSize int
+
+	// MaxPromptRunes and MaxReplyRunes cap the content of imported user and
+	// assistant messages, like MessageService caps prompts and replies.
+	// Zero means unlimited.
+	MaxPromptRunes int
+	MaxReplyRunes  int
+}
+
+// Export writes the transcript of chatID to w: the chat, then the messages
+// of its active branch oldest first. The caller needs read access to the chat; otherwise
+// ErrChatNotFound is returned before anything is written. Errors after Begin
+// leave a truncated transcript.
+func (s *TransferService) Export(ctx context.Context, caller Caller, chatID string, w export.Writer) error {
+	tr := otel.Tracer("services/TransferService")
+	ctx, span := tr.Start(ctx, "Export",
+		trace.WithAttributes(
+			attribute.String("chat.id", chatID),
+			attribute.String("user.id", caller.UserID),
+		),
+	)
+	defer span.End()
+
+	chat, err := authorizeChat(ctx, s.DB, repoLookup{}, caller, chatID, AccessRead)
+	if err != nil {
+		return err
+	}
+	if err := w.Begin(export.Chat{ID: chat.ID, Title: chat.Title, CreatedAt: chat.CreatedAt, UpdatedAt: chat.UpdatedAt}); err != nil {
+		return err
+	}
+
+	size := s.PageSize
+	if size <= 0 {
+		size = defaultExportPageSize
+	}
+	db := s.DB.WithContext(ctx)
+	for offset, total := 0, 0; ; offset += size {
+		msgs, err := repo.ListActiveMessagesPage(db, chatID, offset, size)
+		if err != nil {
+			return err
+		}
+		if len(msgs) > 0 {
+			page, err := s.exportPage(ctx, msgs)
+			if err != nil {
+				return err
+			}
+			if err := w.Messages(page); err != nil {
+				return err
+			}
+		}
+		total += len(msgs)
+		if len(msgs) < size {
+			span.SetAttributes(attribute.Int("messages", total))
+			return w.End()
+		}
+	}
+}
+
+// exportPage loads the citations and feedback of a page of messages and
+// converts it to its export form.
+func (s *TransferService) exportPage(ctx context.Context, msgs []domain.Message) ([]export.Message, error) {
+	if err := repo.AttachCitations(s.DB.WithContext(ctx), msgs); err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(msgs))
+	for i, m := range msgs {
+		ids[i] = m.ID
+	}
+	fbs, err := repo.ListFeedback(ctx, s.DB, ids)
+	if err != nil {
+		return nil, err
+	}
+	byMsg := make(map[string][]export.Feedback, len(fbs))
+	for _, f := range fbs {
+		byMsg[f.MessageID] = append(byMsg[f.MessageID], export.Feedback{UserID: f.UserID, Value: f.Value})
+	}
+
+	out := make([]export.Message, len(msgs))
+	for i, m := range msgs {
+		out[i] = export.Message{
+			ID:        m.ID,
+			Role:      m.Role,
+			Content:   m.Content,
+			Score:     m.Score,
+			CreatedAt: m.CreatedAt,
+			Feedback:  byMsg[m.ID],
+		}
+		for _, c := range m.Citations {
+			out[i].Citations = append(out[i].Citations, export.Citation{
+				Rank: c.Rank, DocID: c.DocID, Source: c.Source, Line: c.Line, Score: c.Score, Snippet: c.Snippet,
+			})
+		}
+	}
+	return out, nil
+}
+
+// Import stores doc as a new chat owned by the caller in their workspace, in
+// one transaction, and returns it. Chat, message and citation IDs are newly
+// assigned; titles, contents, scores, citations and timestamps are kept.
+// Feedback is not imported, since it was left by other users. Documents of
+// another kind or a newer version, messages that would violate the schema,
+// and messages longer than MaxPromptRunes/MaxReplyRunes are rejected with an
+// error wrapping ErrInvalidImport.
+func (s *TransferService) Import(ctx context.Context, caller Caller, doc export.Document) (*domain.Chat, error) {
+	tr := otel.Tracer("services/TransferService")
+	ctx, span := tr.Start(ctx, "Import",
+		trace.WithAttributes(
+			attribute.String("user.id", caller.UserID),
+			attribute.Int("messages", len(doc.Messages)),
+		),
+	)
+	defer span.End()
+
+	if doc.Kind != export.DocumentKind {
+		return nil, fmt.Errorf("%w: kind must be %q", ErrInvalidImport, export.DocumentKind)
+	}
+	if doc.Version < 1 || doc.Version > export.DocumentVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d (supported: 1 to %d)", ErrInvalidImport, doc.Version, export.DocumentVersion)
+	}
+
+	title := normalizeTitle(doc.Chat.Title)
+	if title == "" {
+		title = importedTitle
+	}
+	if utf8.RuneCountInString(title) > maxImportTitleRunes {
+		title = string([]rune(title)[:maxImportTitleRunes])
+	}
+	chat := &domain.Chat{
+		ID:          uuid.NewString(),
+		WorkspaceID: caller.Workspace(),
+		UserID:      caller.UserID,
+		Title:       title,
+		Version:     1,
+		CreatedAt:   doc.Chat.CreatedAt.UTC(),
+		UpdatedAt:   doc.Chat.UpdatedAt.UTC(),
+	}
+
+	msgs := make([]domain.Message, len(doc.Messages))
+	for i, m := range doc.Messages {
+		if err := s.checkImportedMessage(m); err != nil {
+			return nil, fmt.Errorf("%w: message %d: %s", ErrInvalidImport, i, err)
+		}
+		msgs[i] = domain.Message{
+			ID:        uuid.NewString(),
+			ChatID:    chat.ID,
+			Role:      m.Role,
+			Content:   m.Content,
+			Score:     m.Score,
+			CreatedAt: m.CreatedAt.UTC(),
+		}
+		for _, c := range m.Citations {
+			msgs[i].Citations = append(msgs[i].Citations, domain.MessageSource{
+				ID: uuid.NewString(), MessageID: msgs[i].ID, Rank: c.Rank, DocID: c.DocID,
+				Source: c.Source, Line: c.Line, Score: c.Score, Snippet: c.Snippet, CreatedAt: msgs[i].CreatedAt,
+			})
+		}
+	}
+	// The transcript is one branch: each message follows the one before.
+	for i := 1; i < len(msgs); i++ {
+		msgs[i].ParentID = &msgs[i-1].ID
+	}
+	if len(msgs) > 0 {
+		chat.ActiveMessageID = &msgs[len(msgs)-1].ID
+	}
+	// Chats without timestamps start with their first message (or now).
+	if chat.CreatedAt.IsZero() {
+		chat.CreatedAt = time.Now().UTC()
+		if len(msgs) > 0 {
+			chat.CreatedAt = msgs[0].CreatedAt
+		}
+	}
+
+	if err := repo.ImportChat(ctx, s.DB, chat, msgs); err != nil {
+		return nil, err
+	}
+	return chat, nil
+}
+
+// checkImportedMessage validates a message against the schema of messages
+// and message_sources and the content caps.
+func (s *TransferService) checkImportedMessage(m export.Message) error {
+	limit := s.MaxPromptRunes
+	if m.Role == roleAssistant {
+		limit = s.MaxReplyRunes
+	}
+	switch {
+	case m.Role != roleUser && m.Role != roleAssistant:
+		return fmt.Errorf("role must be %q or %q, not %q", roleUser, roleAssistant, m.Role)
+	case strings.TrimSpace(m.Content) == "":
+		return fmt.Errorf("content is empty")
+	case limit > 0 && utf8.RuneCountInString(m.Content) > limit:
+		return fmt.Errorf("%s content exceeds %d characters", m.Role, limit)
+	case m.CreatedAt.IsZero():
+		return fmt.Errorf("created_at is missing")
+	case len(m.Citations) > 0 && m.Role != roleAssistant:
+		return fmt.Errorf("only assistant messages have citations")
+	}
+	for _, c := range m.Citations {
+		if c.DocID == "" || utf8.RuneCountInString(c.DocID) > 64 || utf8.RuneCountInString(c.Source) > 255 {
+			return fmt.Errorf("citation %d: doc_id must have 1 to 64 characters and source up to 255", c.Rank)
+		}
+	}
+	return nil
+}
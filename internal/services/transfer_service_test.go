@@ -0,0 +1,162 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/export"
+	"github.com/tbourn/go-chat-backend/internal/repo"
+)
+
+// recordingWriter records the calls of an export.
+type recordingWriter struct {
+	chat  *export.Chat
+	pages [][]export.Message
+	ended bool
+}
+
+func (w *recordingWriter) Begin(c export.Chat) error { w.chat = &c; return nil }
+func (w *recordingWriter) Messages(m []export.Message) error {
+	w.pages = append(w.pages, m)
+	return nil
+}
+func (w *recordingWriter) End() error { w.ended = true; return nil }
+
+func TestTransferService_Export(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&domain.MessageSource{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	ctx := context.Background()
+	chat, _ := repo.CreateChat(ctx, db, domain.DefaultWorkspaceID, "u1", "Trends")
+	var reply *domain.Message
+	for i := 0; i < 5; i++ {
+		m, err := repo.CreateMessage(db, chat.ID, roleUser, fmt.Sprint(i), nil)
+		if err != nil {
+			t.Fatalf("CreateMessage: %v", err)
+		}
+		reply = m
+	}
+	score := 0.5
+	answer, _ := repo.CreateMessage(db, chat.ID, roleAssistant, "answer", &score)
+	if _, err := repo.CreateMessageSources(db, answer.ID, []domain.MessageSource{{DocID: "7", Source: "data.md", Line: 3, Snippet: "s"}}); err != nil {
+		t.Fatalf("CreateMessageSources: %v", err)
+	}
+	if err := repo.CreateFeedback(ctx, db, domain.DefaultWorkspaceID, answer.ID, "u2", -1); err != nil {
+		t.Fatalf("CreateFeedback: %v", err)
+	}
+	if err := repo.ShareChat(ctx, db, chat.ID, "u2"); err != nil {
+		t.Fatalf("ShareChat: %v", err)
+	}
+
+	svc := &TransferService{DB: db, PageSize: 2}
+	var w recordingWriter
+	if err := svc.Export(ctx, Caller{UserID: "u2"}, chat.ID, &w); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	if w.chat == nil || w.chat.Title != "Trends" || !w.ended || len(w.pages) != 3 {
+		t.Fatalf("export = %+v", w)
+	}
+	var all []export.Message
+	for _, p := range w.pages {
+		if len(p) > 2 {
+			t.Fatalf("page of %d messages", len(p))
+		}
+		all = append(all, p...)
+	}
+	if len(all) != 6 || all[0].Content != "0" || all[4].ID != reply.ID {
+		t.Fatalf("messages = %+v", all)
+	}
+	last := all[5]
+	if *last.Score != 0.5 || len(last.Citations) != 1 || last.Citations[0].Source != "data.md" ||
+		len(last.Feedback) != 1 || last.Feedback[0] != (export.Feedback{UserID: "u2", Value: -1}) {
+		t.Fatalf("answer = %+v", last)
+	}
+
+	// Chats the caller cannot read are not found and nothing is written.
+	w = recordingWriter{}
+	if err := svc.Export(ctx, Caller{UserID: "u3"}, chat.ID, &w); !errors.Is(err, ErrChatNotFound) || w.chat != nil {
+		t.Fatalf("stranger: %v %+v", err, w)
+	}
+}
+
+func TestTransferService_Import(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&domain.MessageSource{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	ctx := context.Background()
+	svc := &TransferService{DB: db, MaxPromptRunes: 4, MaxReplyRunes: 5}
+	at := time.Date(2024, 3, 1, 9, 0, 0, 0, time.FixedZone("CET", 3600))
+	score := 0.7
+	doc := export.Document{
+		Kind:    export.DocumentKind,
+		Version: export.DocumentVersion,
+		Chat:    export.Chat{ID: "old", Title: "  Gen   Z ", CreatedAt: at},
+		Messages: []export.Message{
+			{ID: "m1", Role: roleUser, Content: "hi", CreatedAt: at},
+			{ID: "m2", Role: roleAssistant, Content: "hello", Score: &score, CreatedAt: at.Add(time.Minute),
+				Feedback:  []export.Feedback{{UserID: "u9", Value: 1}},
+				Citations: []export.Citation{{Rank: 0, DocID: "7", Source: "data.md", Line: 2}}},
+		},
+	}
+
+	chat, err := svc.Import(ctx, Caller{UserID: "u1"}, doc)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	if chat.ID == "old" || chat.UserID != "u1" || chat.Title != "Gen Z" || !chat.CreatedAt.Equal(at) || !chat.UpdatedAt.Equal(at) {
+		t.Fatalf("chat = %+v", chat)
+	}
+	var w recordingWriter
+	if err := svc.Export(ctx, Caller{UserID: "u1"}, chat.ID, &w); err != nil || len(w.pages) != 1 {
+		t.Fatalf("Export: %v %+v", err, w)
+	}
+	got := w.pages[0]
+	if len(got) != 2 || got[0].ID == "m1" || !got[1].CreatedAt.Equal(at.Add(time.Minute)) || *got[1].Score != score ||
+		len(got[1].Citations) != 1 || got[1].Citations[0].Source != "data.md" || len(got[1].Feedback) != 0 {
+		t.Fatalf("messages = %+v", got)
+	}
+	var linked []domain.Message
+	db.Where("chat_id = ?", chat.ID).Order("created_at").Find(&linked)
+	if linked[0].ParentID != nil || *linked[1].ParentID != linked[0].ID || *chat.ActiveMessageID != linked[1].ID {
+		t.Fatalf("imported messages are not one branch: %+v (active %v)", linked, chat.ActiveMessageID)
+	}
+
+	// An empty title gets a default and an untimed chat starts with its first message.
+	doc.Chat = export.Chat{}
+	if chat, err := svc.Import(ctx, Caller{UserID: "u1"}, doc); err != nil || chat.Title != importedTitle || !chat.CreatedAt.Equal(at) {
+		t.Fatalf("untitled: %+v %v", chat, err)
+	}
+
+	for name, mutate := range map[string]func(d *export.Document){
+		"kind":       func(d *export.Document) { d.Kind = "other" },
+		"version":    func(d *export.Document) { d.Version = export.DocumentVersion + 1 },
+		"role":       func(d *export.Document) { d.Messages[0].Role = "system" },
+		"content":    func(d *export.Document) { d.Messages[0].Content = " " },
+		"prompt cap": func(d *export.Document) { d.Messages[0].Content = "héllo" },
+		"reply cap":  func(d *export.Document) { d.Messages[1].Content = "héllo!" },
+		"timestamp":  func(d *export.Document) { d.Messages[1].CreatedAt = time.Time{} },
+		"citation":   func(d *export.Document) { d.Messages[1].Citations[0].DocID = "" },
+		"cited user": func(d *export.Document) {
+			d.Messages[0].Citations = []export.Citation{{DocID: "1"}}
+		},
+	} {
+		bad := doc
+		bad.Messages = []export.Message{doc.Messages[0], doc.Messages[1]}
+		bad.Messages[1].Citations = []export.Citation{doc.Messages[1].Citations[0]}
+		mutate(&bad)
+		if _, err := svc.Import(ctx, Caller{UserID: "u1"}, bad); !errors.Is(err, ErrInvalidImport) {
+			t.Fatalf("%s: err = %v", name, err)
+		}
+	}
+	var n int64
+	db.Model(&domain.Chat{}).Count(&n)
+	if n != 2 {
+		t.Fatalf("chats = %d, want 2", n)
+	}
+}
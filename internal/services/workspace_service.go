@@ -0,0 +1,305 @@
+// Package services – WorkspaceService
+//
+// This file implements the WorkspaceService, which manages workspaces: the
+// tenants that isolate one team's chats, feedback and idempotency records
+// from every other team sharing the deployment. A workspace may also answer
+// from its own corpus instead of the server's default one.
+//
+// Policy:
+//   - Every user is implicitly a member of the default workspace
+//     (domain.DefaultWorkspaceID), which has no stored members or settings.
+//   - Any user may create a workspace and becomes its owner.
+//   - Members may use the workspace and list its members; owners may also
+//     rename it and manage members. A workspace always keeps one owner.
+//   - Admins act as owners of every workspace. Only admins may point a
+//     workspace at a corpus, since corpus files live on the server.
+//   - Non-members get ErrWorkspaceNotFound, so the existence of other teams'
+//     workspaces is never revealed.
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/repo"
+	"github.com/tbourn/go-chat-backend/internal/search"
+)
+
+// maxWorkspaceNameLen caps workspace names (see domain.Workspace.Name).
+const maxWorkspaceNameLen = 100
+
+// CorpusIndexes resolves a workspace corpus name, relative to the server's
+// corpus directory, to its search index (see search.Registry).
+type CorpusIndexes interface {
+	Index(name string) (search.Index, error)
+}
+
+// Membership is a workspace together with the caller's role in it.
+type Membership struct {
+	Workspace domain.Workspace
+	Role      string
+}
+
+// WorkspaceService manages workspaces and their members.
+type WorkspaceService struct {
+	// DB is the GORM handle used for persistence.
+	DB *gorm.DB
+
+	// Corpora validates corpus names when they are set. Nil disables
+	// per-workspace corpora.
+	Corpora CorpusIndexes
+}
+
+// NewWorkspaceService constructs a WorkspaceService.
+func NewWorkspaceService(db *gorm.DB, corpora CorpusIndexes) *WorkspaceService {
+	return &WorkspaceService{DB: db, Corpora: corpora}
+}
+
+// defaultWorkspace describes the implicit default workspace.
+func defaultWorkspace() domain.Workspace {
+	return domain.Workspace{ID: domain.DefaultWorkspaceID, Name: "Default"}
+}
+
+// Role returns the caller's role in workspaceID. It returns
+// ErrWorkspaceNotFound when the workspace does not exist or the caller is not
+// a member.
+func (s *WorkspaceService) Role(ctx context.Context, caller Caller, workspaceID string) (string, error) {
+	if workspaceID == domain.DefaultWorkspaceID {
+		if caller.Admin {
+			return domain.WorkspaceRoleOwner, nil
+		}
+		return domain.WorkspaceRoleMember, nil
+	}
+	if caller.Admin {
+		if _, err := repo.FindWorkspace(ctx, s.DB, workspaceID); err != nil {
+			if isNotFound(err) {
+				return "", ErrWorkspaceNotFound
+			}
+			return "", err
+		}
+		return domain.WorkspaceRoleOwner, nil
+	}
+	m, err := repo.GetWorkspaceMember(ctx, s.DB, workspaceID, caller.UserID)
+	if err != nil {
+		if isNotFound(err) {
+			return "", ErrWorkspaceNotFound
+		}
+		return "", err
+	}
+	return m.Role, nil
+}
+
+// Create creates a workspace owned by the caller. corpusPath is optional;
+// setting it requires an admin caller (ErrCorpusNotAllowed) and a corpus that
+// loads (ErrInvalidCorpus). Names must be 1–100 characters
+// (ErrInvalidWorkspace).
+func (s *WorkspaceService) Create(ctx context.Context, caller Caller, name, corpusPath string) (*domain.Workspace, error) {
+	name, err := normalizeWorkspaceName(name)
+	if err != nil {
+		return nil, err
+	}
+	corpusPath = strings.TrimSpace(corpusPath)
+	if err := s.checkCorpus(caller, corpusPath); err != nil {
+		return nil, err
+	}
+	w := &domain.Workspace{ID: uuid.NewString(), Name: name, CorpusPath: corpusPath}
+	if err := repo.CreateWorkspace(ctx, s.DB, w, caller.UserID); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// List returns the workspaces the caller belongs to, the default workspace
+// first, with the caller's role in each.
+func (s *WorkspaceService) List(ctx context.Context, caller Caller) ([]Membership, error) {
+	role, _ := s.Role(ctx, caller, domain.DefaultWorkspaceID)
+	out := []Membership{{Workspace: defaultWorkspace(), Role: role}}
+
+	ms, err := repo.ListUserMemberships(ctx, s.DB, caller.UserID)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range ms {
+		if caller.Admin {
+			m.Role = domain.WorkspaceRoleOwner
+		}
+		out = append(out, Membership{Workspace: m.Workspace, Role: m.Role})
+	}
+	return out, nil
+}
+
+// Get returns a workspace the caller belongs to, with the caller's role.
+func (s *WorkspaceService) Get(ctx context.Context, caller Caller, workspaceID string) (*Membership, error) {
+	role, err := s.Role(ctx, caller, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if workspaceID == domain.DefaultWorkspaceID {
+		return &Membership{Workspace: defaultWorkspace(), Role: role}, nil
+	}
+	w, err := repo.FindWorkspace(ctx, s.DB, workspaceID)
+	if err != nil {
+		if isNotFound(err) {
+			return nil, ErrWorkspaceNotFound
+		}
+		return nil, err
+	}
+	return &Membership{Workspace: *w, Role: role}, nil
+}
+
+// Update renames a workspace and/or changes its corpus; nil arguments are
+// left unchanged and an empty corpusPath reverts to the default corpus. It
+// requires the owner role, and an admin for corpus changes. The default
+// workspace cannot be changed (ErrInvalidWorkspace).
+func (s *WorkspaceService) Update(ctx context.Context, caller Caller, workspaceID string, name, corpusPath *string) (*domain.Workspace, error) {
+	m, err := s.manage(ctx, caller, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	w := m.Workspace
+	if name != nil {
+		if w.Name, err = normalizeWorkspaceName(*name); err != nil {
+			return nil, err
+		}
+	}
+	if corpusPath != nil {
+		p := strings.TrimSpace(*corpusPath)
+		if p != w.CorpusPath {
+			if err := s.checkCorpus(caller, p); err != nil {
+				return nil, err
+			}
+			w.CorpusPath = p
+		}
+	}
+	if err := repo.UpdateWorkspace(ctx, s.DB, w.ID, w.Name, w.CorpusPath); err != nil {
+		if isNotFound(err) {
+			return nil, ErrWorkspaceNotFound
+		}
+		return nil, err
+	}
+	return repo.FindWorkspace(ctx, s.DB, w.ID)
+}
+
+// Members returns the members of a workspace the caller belongs to. The
+// default workspace has no member list (ErrInvalidWorkspace).
+func (s *WorkspaceService) Members(ctx context.Context, caller Caller, workspaceID string) ([]domain.WorkspaceMember, error) {
+	if workspaceID == domain.DefaultWorkspaceID {
+		return nil, ErrInvalidWorkspace
+	}
+	if _, err := s.Role(ctx, caller, workspaceID); err != nil {
+		return nil, err
+	}
+	return repo.ListWorkspaceMembers(ctx, s.DB, workspaceID)
+}
+
+// SetMember adds userID to a workspace the caller owns, or changes their
+// role. Demoting the last owner returns ErrLastOwner.
+func (s *WorkspaceService) SetMember(ctx context.Context, caller Caller, workspaceID, userID, role string) error {
+	if _, err := s.manage(ctx, caller, workspaceID); err != nil {
+		return err
+	}
+	userID = strings.TrimSpace(userID)
+	if userID == "" || utf8.RuneCountInString(userID) > maxShareUserIDLen || !domain.ValidWorkspaceRole(role) {
+		return ErrInvalidMember
+	}
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if role != domain.WorkspaceRoleOwner {
+			if err := keepOwner(ctx, tx, workspaceID, userID); err != nil {
+				return err
+			}
+		}
+		return repo.SetWorkspaceMember(ctx, tx, workspaceID, userID, role)
+	})
+}
+
+// RemoveMember removes userID from a workspace. Owners may remove anyone and
+// members may remove themselves (leave). Removing the last owner returns
+// ErrLastOwner; removing a non-member is not an error.
+func (s *WorkspaceService) RemoveMember(ctx context.Context, caller Caller, workspaceID, userID string) error {
+	userID = strings.TrimSpace(userID)
+	if userID != caller.UserID || workspaceID == domain.DefaultWorkspaceID {
+		if _, err := s.manage(ctx, caller, workspaceID); err != nil {
+			return err
+		}
+	} else if _, err := s.Role(ctx, caller, workspaceID); err != nil {
+		return err
+	}
+	return s.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := keepOwner(ctx, tx, workspaceID, userID); err != nil {
+			return err
+		}
+		return repo.RemoveWorkspaceMember(ctx, tx, workspaceID, userID)
+	})
+}
+
+// manage loads a stored workspace the caller owns. The default workspace
+// yields ErrInvalidWorkspace, members ErrWorkspaceForbidden.
+func (s *WorkspaceService) manage(ctx context.Context, caller Caller, workspaceID string) (*Membership, error) {
+	m, err := s.Get(ctx, caller, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	if workspaceID == domain.DefaultWorkspaceID {
+		return nil, ErrInvalidWorkspace
+	}
+	if m.Role != domain.WorkspaceRoleOwner {
+		return nil, ErrWorkspaceForbidden
+	}
+	return m, nil
+}
+
+// checkCorpus validates a corpus change: clearing is always allowed; setting
+// one requires an admin and a corpus that loads.
+func (s *WorkspaceService) checkCorpus(caller Caller, corpusPath string) error {
+	if corpusPath == "" {
+		return nil
+	}
+	if !caller.Admin {
+		return ErrCorpusNotAllowed
+	}
+	if s.Corpora == nil {
+		return ErrInvalidCorpus
+	}
+	if _, err := s.Corpora.Index(corpusPath); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidCorpus, err)
+	}
+	return nil
+}
+
+// keepOwner returns ErrLastOwner if userID is the only owner of workspaceID.
+func keepOwner(ctx context.Context, tx *gorm.DB, workspaceID, userID string) error {
+	cur, err := repo.GetWorkspaceMember(ctx, tx, workspaceID, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if cur.Role != domain.WorkspaceRoleOwner {
+		return nil
+	}
+	n, err := repo.CountWorkspaceOwners(ctx, tx, workspaceID)
+	if err != nil {
+		return err
+	}
+	if n <= 1 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+// normalizeWorkspaceName trims and validates a workspace name.
+func normalizeWorkspaceName(name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" || utf8.RuneCountInString(name) > maxWorkspaceNameLen {
+		return "", ErrInvalidWorkspace
+	}
+	return name, nil
+}
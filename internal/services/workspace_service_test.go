@@ -0,0 +1,225 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/tbourn/go-chat-backend/internal/domain"
+	"github.com/tbourn/go-chat-backend/internal/repo"
+	"github.com/tbourn/go-chat-backend/internal/search"
+)
+
+// fakeCorpora serves its indexes by corpus name and fails every other name.
+type fakeCorpora map[string]search.Index
+
+func (f fakeCorpora) Index(name string) (search.Index, error) {
+	if idx, ok := f[name]; ok {
+		return idx, nil
+	}
+	return nil, errors.New("no such corpus")
+}
+
+func newWorkspaceService(t *testing.T) *WorkspaceService {
+	t.Helper()
+	db := newMsgDB(t, &domain.Workspace{}, &domain.WorkspaceMember{}, &domain.Chat{}, &domain.ChatShare{},
+		&domain.Message{}, &domain.MessageSource{}, &domain.Feedback{})
+	return NewWorkspaceService(db, fakeCorpora{"team.md": mkIdx(nil)})
+}
+
+func TestWorkspaceService_RolesAndMembers(t *testing.T) {
+	s := newWorkspaceService(t)
+	ctx := context.Background()
+	alice, bob, root := Caller{UserID: "alice"}, Caller{UserID: "bob"}, Caller{UserID: "root", Admin: true}
+
+	if _, err := s.Create(ctx, alice, "   ", ""); !errors.Is(err, ErrInvalidWorkspace) {
+		t.Fatalf("blank name: err = %v", err)
+	}
+	if _, err := s.Create(ctx, alice, strings.Repeat("n", 101), ""); !errors.Is(err, ErrInvalidWorkspace) {
+		t.Fatalf("long name: err = %v", err)
+	}
+	w, err := s.Create(ctx, alice, "  Team   A ", "")
+	if err != nil || w.Name != "Team A" {
+		t.Fatalf("Create = %+v, %v", w, err)
+	}
+
+	roles := []struct {
+		caller Caller
+		ws     string
+		want   string
+		err    error
+	}{
+		{alice, w.ID, domain.WorkspaceRoleOwner, nil},
+		{bob, w.ID, "", ErrWorkspaceNotFound},
+		{root, w.ID, domain.WorkspaceRoleOwner, nil},
+		{root, "missing", "", ErrWorkspaceNotFound},
+		{bob, domain.DefaultWorkspaceID, domain.WorkspaceRoleMember, nil},
+		{root, domain.DefaultWorkspaceID, domain.WorkspaceRoleOwner, nil},
+	}
+	for _, tc := range roles {
+		if got, err := s.Role(ctx, tc.caller, tc.ws); got != tc.want || !errors.Is(err, tc.err) {
+			t.Fatalf("Role(%s, %s) = %q, %v; want %q, %v", tc.caller.UserID, tc.ws, got, err, tc.want, tc.err)
+		}
+	}
+
+	// Only owners manage members; members can see them.
+	if err := s.SetMember(ctx, bob, w.ID, "bob", domain.WorkspaceRoleOwner); !errors.Is(err, ErrWorkspaceNotFound) {
+		t.Fatalf("stranger SetMember: err = %v", err)
+	}
+	if err := s.SetMember(ctx, alice, w.ID, "bob", "admin"); !errors.Is(err, ErrInvalidMember) {
+		t.Fatalf("bad role: err = %v", err)
+	}
+	if err := s.SetMember(ctx, alice, w.ID, "bob", domain.WorkspaceRoleMember); err != nil {
+		t.Fatalf("SetMember: %v", err)
+	}
+	if err := s.SetMember(ctx, bob, w.ID, "carol", domain.WorkspaceRoleMember); !errors.Is(err, ErrWorkspaceForbidden) {
+		t.Fatalf("member SetMember: err = %v", err)
+	}
+	if members, err := s.Members(ctx, bob, w.ID); err != nil || len(members) != 2 {
+		t.Fatalf("Members = %+v, %v", members, err)
+	}
+	if _, err := s.Members(ctx, bob, domain.DefaultWorkspaceID); !errors.Is(err, ErrInvalidWorkspace) {
+		t.Fatalf("default Members: err = %v", err)
+	}
+
+	// A workspace keeps at least one owner.
+	if err := s.SetMember(ctx, alice, w.ID, "alice", domain.WorkspaceRoleMember); !errors.Is(err, ErrLastOwner) {
+		t.Fatalf("demote last owner: err = %v", err)
+	}
+	if err := s.RemoveMember(ctx, alice, w.ID, "alice"); !errors.Is(err, ErrLastOwner) {
+		t.Fatalf("remove last owner: err = %v", err)
+	}
+
+	// Members may leave; the default workspace cannot be changed.
+	if err := s.RemoveMember(ctx, bob, w.ID, "bob"); err != nil {
+		t.Fatalf("leave: %v", err)
+	}
+	if _, err := s.Role(ctx, bob, w.ID); !errors.Is(err, ErrWorkspaceNotFound) {
+		t.Fatalf("Role after leaving: err = %v", err)
+	}
+	name := "x"
+	if _, err := s.Update(ctx, root, domain.DefaultWorkspaceID, &name, nil); !errors.Is(err, ErrInvalidWorkspace) {
+		t.Fatalf("update default: err = %v", err)
+	}
+
+	list, err := s.List(ctx, alice)
+	if err != nil || len(list) != 2 || list[0].Workspace.ID != domain.DefaultWorkspaceID || list[1].Role != domain.WorkspaceRoleOwner {
+		t.Fatalf("List = %+v, %v", list, err)
+	}
+	if list, _ := s.List(ctx, bob); len(list) != 1 {
+		t.Fatalf("List(bob) = %+v", list)
+	}
+}
+
+func TestWorkspaceService_Corpus(t *testing.T) {
+	s := newWorkspaceService(t)
+	ctx := context.Background()
+	alice, root := Caller{UserID: "alice"}, Caller{UserID: "root", Admin: true}
+
+	if _, err := s.Create(ctx, alice, "A", "team.md"); !errors.Is(err, ErrCorpusNotAllowed) {
+		t.Fatalf("non-admin corpus: err = %v", err)
+	}
+	if _, err := s.Create(ctx, root, "A", "../etc/passwd"); !errors.Is(err, ErrInvalidCorpus) {
+		t.Fatalf("unknown corpus: err = %v", err)
+	}
+	w, err := s.Create(ctx, alice, "A", "")
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	corpus := "team.md"
+	if _, err := s.Update(ctx, alice, w.ID, nil, &corpus); !errors.Is(err, ErrCorpusNotAllowed) {
+		t.Fatalf("owner sets corpus: err = %v", err)
+	}
+	got, err := s.Update(ctx, root, w.ID, nil, &corpus)
+	if err != nil || got.CorpusPath != "team.md" || got.Name != "A" {
+		t.Fatalf("admin Update = %+v, %v", got, err)
+	}
+
+	// Renaming keeps the corpus; owners may still rename.
+	name := "Renamed"
+	if got, err := s.Update(ctx, alice, w.ID, &name, &corpus); err != nil || got.Name != "Renamed" || got.CorpusPath != "team.md" {
+		t.Fatalf("owner rename = %+v, %v", got, err)
+	}
+
+	s.Corpora = nil
+	if _, err := s.Create(ctx, root, "B", "team.md"); !errors.Is(err, ErrInvalidCorpus) {
+		t.Fatalf("corpora disabled: err = %v", err)
+	}
+}
+
+// TestWorkspaceIsolation_Services checks that a user with a chat in each of two
+// workspaces can only reach each chat from its own workspace, and that each
+// workspace answers from its own corpus.
+func TestWorkspaceIsolation_Services(t *testing.T) {
+	ws := newWorkspaceService(t)
+	ctx := context.Background()
+	root := Caller{UserID: "root", Admin: true}
+
+	prompt := `Gen Z in Nashville spend on streaming platforms`
+	teamIdx := mkIdx(map[string][]search.Result{prompt: {{DocID: "team-doc", Snippet: "In Nashville, Gen Z spend more on streaming platforms.", Score: 0.8}}})
+	defaultIdx := mkIdx(map[string][]search.Result{prompt: {{DocID: "default-doc", Snippet: "Gen Z in Nashville show strong adoption of streaming platforms.", Score: 0.8}}})
+	ws.Corpora = fakeCorpora{"team.md": teamIdx}
+
+	wA, err := ws.Create(ctx, root, "A", "team.md")
+	if err != nil {
+		t.Fatalf("Create A: %v", err)
+	}
+	wB, err := ws.Create(ctx, root, "B", "")
+	if err != nil {
+		t.Fatalf("Create B: %v", err)
+	}
+	for _, id := range []string{wA.ID, wB.ID} {
+		if err := ws.SetMember(ctx, root, id, "u1", domain.WorkspaceRoleMember); err != nil {
+			t.Fatalf("SetMember: %v", err)
+		}
+	}
+	inA, inB := Caller{UserID: "u1", WorkspaceID: wA.ID}, Caller{UserID: "u1", WorkspaceID: wB.ID}
+
+	chatA, _ := repo.CreateChat(ctx, ws.DB, wA.ID, "u1", "a")
+	chatB, _ := repo.CreateChat(ctx, ws.DB, wB.ID, "u1", "b")
+
+	msgs := &MessageService{DB: ws.DB, Index: defaultIdx, Corpora: ws.Corpora, Threshold: 0.05}
+	fb := &FeedbackService{DB: ws.DB}
+
+	// Each workspace answers from its own corpus.
+	replyA, err := msgs.Answer(ctx, inA, chatA.ID, prompt)
+	if err != nil || len(replyA.Citations) == 0 || replyA.Citations[0].DocID != "team-doc" {
+		t.Fatalf("answer in A = %+v, %v", replyA, err)
+	}
+	replyB, err := msgs.Answer(ctx, inB, chatB.ID, prompt)
+	if err != nil || len(replyB.Citations) == 0 || replyB.Citations[0].DocID != "default-doc" {
+		t.Fatalf("answer in B = %+v, %v", replyB, err)
+	}
+
+	// A's chat and message are invisible from B, even to the owner.
+	if _, err := msgs.Answer(ctx, inB, chatA.ID, prompt); !errors.Is(err, ErrChatNotFound) {
+		t.Fatalf("Answer across workspaces: err = %v", err)
+	}
+	if _, _, err := msgs.ListPage(ctx, inB, chatA.ID, ActiveBranch, 1, 10); !errors.Is(err, ErrChatNotFound) {
+		t.Fatalf("ListPage across workspaces: err = %v", err)
+	}
+	if _, _, err := msgs.Stats(ctx, inB, chatA.ID, ActiveBranch); !errors.Is(err, ErrChatNotFound) {
+		t.Fatalf("Stats across workspaces: err = %v", err)
+	}
+	if err := fb.Leave(ctx, inB, replyA.ID, 1); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("feedback across workspaces: err = %v", err)
+	}
+	if err := fb.Leave(ctx, Caller{UserID: "root", Admin: true, WorkspaceID: wB.ID}, replyA.ID, 1); !errors.Is(err, ErrMessageNotFound) {
+		t.Fatalf("admin feedback across workspaces: err = %v", err)
+	}
+	if err := fb.Leave(ctx, inA, replyA.ID, 1); err != nil {
+		t.Fatalf("feedback in A: %v", err)
+	}
+	var stored domain.Feedback
+	if err := ws.DB.First(&stored, "message_id = ?", replyA.ID).Error; err != nil || stored.WorkspaceID != wA.ID {
+		t.Fatalf("stored feedback = %+v, %v", stored, err)
+	}
+
+	// A workspace corpus that cannot be loaded fails instead of falling back.
+	ws.Corpora = fakeCorpora{}
+	msgs.Corpora = ws.Corpora
+	if _, err := msgs.Answer(ctx, inA, chatA.ID, prompt); err == nil {
+		t.Fatalf("expected an error for an unavailable workspace corpus")
+	}
+}